@@ -0,0 +1,64 @@
+import { Command, Option } from 'commander';
+import { consoleLogSink } from '../utils/logger';
+import { IndexArchiveManifest, createIndex } from '../lib';
+
+export interface ArchiveOptions {
+  index: string;
+}
+
+function describeArchive(manifest: IndexArchiveManifest): string {
+  const embedder = manifest.embedder ? `${manifest.embedder}, ${manifest.dimensions} dimensions` : 'no embedder';
+  return `${manifest.chunks} chunk(s) and ${manifest.locations} location(s) (${embedder})`;
+}
+
+/**
+ * Export command - writes the chunks, vectors, and locations of an index to a portable archive
+ */
+export async function exportArchive(file: string, options: ArchiveOptions) {
+  const index = await createIndex({ index: options.index, logger: consoleLogSink });
+  try {
+    const manifest = await index.exportArchive(file);
+    console.log(`Exported ${describeArchive(manifest)} to ${file}.`);
+  } finally {
+    await index.close();
+  }
+}
+
+/**
+ * Import command - loads an exported archive into a new index without embedding it again
+ */
+export async function importArchive(file: string, options: ArchiveOptions) {
+  const index = await createIndex({ index: options.index, logger: consoleLogSink });
+  try {
+    const manifest = await index.importArchive(file);
+    console.log(`Imported ${describeArchive(manifest)} into ${options.index}.`);
+  } finally {
+    await index.close();
+  }
+}
+
+export const exportArchiveCommand = new Command('export')
+  .description('Write the chunks, vectors, and locations of an index to a .tar.gz archive')
+  .argument('<file>', 'Archive to write, e.g. index.tar.gz')
+  .addOption(new Option('--index <index>', 'Index to export (required)').makeOptionMandatory())
+  .action(async (file, options) => {
+    try {
+      await exportArchive(file, options);
+    } catch (error) {
+      console.error('Export failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
+
+export const importArchiveCommand = new Command('import')
+  .description('Load an archive written by "index export" into a new index, keeping its vectors')
+  .argument('<file>', 'Archive to read')
+  .addOption(new Option('--index <index>', 'Index to import into; it must be empty (required)').makeOptionMandatory())
+  .action(async (file, options) => {
+    try {
+      await importArchive(file, options);
+    } catch (error) {
+      console.error('Import failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
@@ -0,0 +1,76 @@
+import { Command, Option } from 'commander';
+import { configFile, configSettings } from '../config';
+
+export type ConfigOutputFormat = 'pretty' | 'json';
+
+export interface ConfigPrintOptions {
+  format?: ConfigOutputFormat;
+}
+
+/** Where the effective value of a setting comes from. */
+export type ConfigSource = 'env' | 'file' | 'default';
+
+export interface ResolvedSetting {
+  key: string;
+  env: string;
+  /** The effective value, or null if the setting is unset and has no default. */
+  value: string | number | boolean | string[] | null;
+  source: ConfigSource;
+}
+
+/** Resolves every setting of a config file to its effective value and where that value comes from. */
+export function resolveSettings(): ResolvedSetting[] {
+  return configSettings.map(({ key, env, resolve }) => {
+    const source: ConfigSource = configFile?.applied.includes(env)
+      ? 'file'
+      : process.env[env]?.trim()
+        ? 'env'
+        : 'default';
+    const value = resolve() as ResolvedSetting['value'] | undefined;
+    return { key, env, value: value ?? null, source };
+  });
+}
+
+function formatValue(value: ResolvedSetting['value']): string {
+  if (value === null) {
+    return '(unset)';
+  }
+  return Array.isArray(value) ? value.join(', ') : String(value);
+}
+
+function printPretty(settings: ResolvedSetting[]): void {
+  console.log(`Config file: ${configFile?.path ?? '(none)'}`);
+  const width = Math.max(...settings.map(({ key }) => key.length));
+  for (const { key, env, value, source } of settings) {
+    const origin = source === 'env' ? env : source;
+    console.log(`  ${key.padEnd(width)}  ${formatValue(value)}  (${origin})`);
+  }
+}
+
+/**
+ * Config print command - prints the effective configuration, after the environment and the config file
+ */
+export function printConfig(options: ConfigPrintOptions): void {
+  const settings = resolveSettings();
+  if (options.format === 'json') {
+    console.log(JSON.stringify({ configFile: configFile?.path ?? null, settings }, null, 2));
+    return;
+  }
+  printPretty(settings);
+}
+
+const printCommand = new Command('print')
+  .description('Print the effective configuration and where each setting comes from')
+  .addOption(new Option('--format <format>', 'Output format').choices(['pretty', 'json']).default('pretty'))
+  .action((options) => {
+    try {
+      printConfig(options);
+    } catch (error) {
+      console.error('Config print failed:', error);
+      process.exit(1);
+    }
+  });
+
+export const configCommand = new Command('config')
+  .description('Inspect the configuration read from flags, the environment, and .scsi.yaml')
+  .addCommand(printCommand);
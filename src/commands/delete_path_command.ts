@@ -0,0 +1,111 @@
+import { Command, Option } from 'commander';
+import { execFileSync } from 'child_process';
+import path from 'path';
+import { appConfig } from '../config';
+import { consoleLogSink, logger } from '../utils/logger';
+import { DeletePathResult, createIndex } from '../lib';
+import { parseLanguageNames } from '../languages';
+
+export interface DeletePathOptions {
+  index: string;
+  /** Workspace whose files are removed (default: the name of the current directory). */
+  workspace?: string;
+}
+
+export interface ReindexPathOptions {
+  index: string;
+  /** Repository checkout that the path and indexed paths are relative to (default: current directory). */
+  root?: string;
+  /** Branch recorded on the new locations (default: the checked-out branch of `root`). */
+  branch?: string;
+  /** Workspace of the checkout (default: the name of the `root` directory). */
+  workspace?: string;
+}
+
+function printRemoved(pattern: string, removed: DeletePathResult): void {
+  console.log(
+    `Removed ${removed.deletedChunks} chunk(s) and ${removed.deletedLocations} location(s) ` +
+      `of ${removed.deletedFiles} file(s) matching ${pattern}.`
+  );
+}
+
+function detectBranch(root: string): string {
+  try {
+    return execFileSync('git', ['rev-parse', '--abbrev-ref', 'HEAD'], { cwd: root }).toString().trim();
+  } catch {
+    logger.warn(`Could not extract git branch for ${root}. Using 'unknown'.`);
+    return 'unknown';
+  }
+}
+
+/**
+ * Delete command - removes the files under a path or matching a glob from an index
+ */
+export async function deletePath(pattern: string, options: DeletePathOptions) {
+  const index = await createIndex({
+    index: options.index,
+    embedder: null,
+    workspace: options.workspace,
+    logger: consoleLogSink,
+  });
+  try {
+    printRemoved(pattern, await index.deletePath(pattern));
+  } finally {
+    await index.close();
+  }
+}
+
+/**
+ * Reindex command - removes a file or directory from an index, then indexes it again
+ */
+export async function reindexPath(target: string, options: ReindexPathOptions) {
+  const root = path.resolve(options.root ?? process.cwd());
+  const index = await createIndex({
+    index: options.index,
+    root,
+    branch: options.branch ?? detectBranch(root),
+    workspace: options.workspace,
+    languages: appConfig.languages ? parseLanguageNames(appConfig.languages) : undefined,
+    logger: consoleLogSink,
+  });
+  try {
+    const result = await index.reindexPath(target);
+    printRemoved(target, result.removed);
+    console.log(`Indexed ${result.chunks} chunk(s) from ${result.indexedFiles} file(s).`);
+    for (const error of result.errors) {
+      console.error(`${error.fatal ? 'Failed' : 'Degraded'}: ${error.path}: ${error.error}`);
+    }
+  } finally {
+    await index.close();
+  }
+}
+
+export const deletePathCommand = new Command('delete')
+  .description('Remove the chunks of the files under a path, or matching a glob, from an index')
+  .argument('<path-or-glob>', 'Repository-relative file or directory (src/legacy), or glob (**/*.pb.go)')
+  .addOption(new Option('--index <index>', 'Index to delete from (required)').makeOptionMandatory())
+  .addOption(new Option('--workspace <name>', 'Workspace to delete from (default: name of the current directory)'))
+  .action(async (pattern, options) => {
+    try {
+      await deletePath(pattern, options);
+    } catch (error) {
+      console.error('Delete failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
+
+export const reindexPathCommand = new Command('reindex')
+  .description('Remove a file or directory from an index and index it again')
+  .argument('<path>', 'File or directory, relative to --root')
+  .addOption(new Option('--index <index>', 'Index to reindex into (required)').makeOptionMandatory())
+  .addOption(new Option('--root <path>', 'Repository checkout that indexed paths are relative to'))
+  .addOption(new Option('--branch <branch>', 'Branch recorded on the new locations (default: auto-detect)'))
+  .addOption(new Option('--workspace <name>', 'Workspace of the checkout (default: name of the --root directory)'))
+  .action(async (target, options) => {
+    try {
+      await reindexPath(target, options);
+    } catch (error) {
+      console.error('Reindex failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
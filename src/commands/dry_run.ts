@@ -0,0 +1,116 @@
+import path from 'path';
+import { findFilesToIndex } from './full_index_producer';
+import { EmbedTemplate } from '../utils/embed_template';
+import { IndexError, StrictIndexError, getParseErrors, reportIndexErrors } from '../utils/index_errors';
+import { createLogger } from '../utils/logger';
+import { LanguageParser } from '../utils/parser';
+import { ProgressTracker } from '../utils/progress';
+import { throwIfCancelled } from '../utils/cancellation';
+import { estimateTokens } from '../utils/token_counter';
+
+export interface DryRunOptions {
+  repoName: string;
+  branch: string;
+  languages?: string;
+  gitignore?: boolean;
+  include?: string[];
+  exclude?: string[];
+  strict?: boolean;
+  /** Renders the text embedded per chunk, whose length the token estimate is based on. */
+  embedTemplate: EmbedTemplate;
+  signal?: AbortSignal;
+  progress?: ProgressTracker;
+}
+
+export interface DryRunLanguageCounts {
+  files: number;
+  chunks: number;
+  estimatedTokens: number;
+}
+
+export interface DryRunReport extends DryRunLanguageCounts {
+  /** Counts per language, languages with the most chunks first. */
+  languages: Record<string, DryRunLanguageCounts>;
+  /** Files that would be skipped or indexed in a degraded form. */
+  errors: IndexError[];
+}
+
+/**
+ * Walks and parses a repository the way `index` does, without enqueueing, embedding, or storing
+ * anything, and counts the files, chunks, and tokens a full index of it would embed.
+ *
+ * Every file is counted, as with `--force`: the index is not read, so files whose content is already
+ * indexed are not told apart.
+ *
+ * @throws StrictIndexError at the first per-file error when `options.strict` is set.
+ * @throws IndexingCancelledError if `options.signal` is aborted.
+ */
+export async function dryRunIndex(directory: string, options: DryRunOptions): Promise<DryRunReport> {
+  const logger = createLogger({ name: options.repoName, branch: options.branch });
+  const { gitRoot, files } = await findFilesToIndex(directory, options, logger);
+  options.progress?.setFilesTotal(files.length);
+
+  // Parsing in-process is slower than the producer's threads, but a dry run is just a preview
+  const languageParser = new LanguageParser(options.languages);
+  const report: DryRunReport = { files: 0, chunks: 0, estimatedTokens: 0, languages: {}, errors: [] };
+  for (const file of files) {
+    throwIfCancelled(options.signal);
+    const errors: IndexError[] = [];
+    let chunks = 0;
+    try {
+      const result = languageParser.parseFile(path.resolve(gitRoot, file), options.branch, file);
+      errors.push(...getParseErrors(file, result.fallback, result.metrics.chunksSkipped, result.skipped));
+      if (!result.skipped) {
+        const counts = (report.languages[result.metrics.language] ??= { files: 0, chunks: 0, estimatedTokens: 0 });
+        const tokens = result.chunks.reduce((total, chunk) => total + estimateTokens(options.embedTemplate(chunk)), 0);
+        chunks = result.chunks.length;
+        counts.files++;
+        counts.chunks += chunks;
+        counts.estimatedTokens += tokens;
+        report.files++;
+        report.chunks += chunks;
+        report.estimatedTokens += tokens;
+      }
+    } catch (error) {
+      errors.push({ path: file, error: error instanceof Error ? error.message : String(error), fatal: true });
+    }
+    report.errors.push(...errors);
+    const strictError = options.strict && errors.find((error) => !error.skipped);
+    if (strictError) {
+      throw new StrictIndexError(strictError);
+    }
+    options.progress?.addFileDone(chunks);
+  }
+
+  report.languages = Object.fromEntries(
+    Object.entries(report.languages).sort(([a, x], [b, y]) => y.chunks - x.chunks || a.localeCompare(b))
+  );
+  reportIndexErrors(report.errors, logger);
+  return report;
+}
+
+/** Prints a dry run's counts per language and in total. */
+export function printDryRunReport(repoName: string, report: DryRunReport): void {
+  const rows = [
+    ['Language', 'Files', 'Chunks', 'Est. tokens'],
+    ...Object.entries(report.languages).map(([language, counts]) => [
+      language,
+      `${counts.files}`,
+      `${counts.chunks}`,
+      `${counts.estimatedTokens}`,
+    ]),
+    ['Total', `${report.files}`, `${report.chunks}`, `${report.estimatedTokens}`],
+  ];
+  const widths = rows[0].map((_, column) => Math.max(...rows.map((row) => row[column].length)));
+  console.log(`Dry run for ${repoName}: nothing was enqueued, embedded, or stored.`);
+  for (const row of rows) {
+    // Names are left-aligned, counts right-aligned
+    const cells = row.map((cell, column) => (column === 0 ? cell.padEnd(widths[0]) : cell.padStart(widths[column])));
+    console.log(`  ${cells.join('  ')}`);
+  }
+  const skipped = report.errors.filter((error) => error.fatal).length;
+  if (skipped > 0) {
+    console.log(`${skipped} file(s) would be skipped, see the error report above.`);
+  }
+  console.log(`Embedding inputs: ${report.chunks} chunks, about ${report.estimatedTokens} tokens.`);
+}
@@ -1,5 +1,5 @@
 import { Command } from 'commander';
-import { LanguageParser } from '../utils/parser';
+import { LanguageParser, getTreeSitterLanguage } from '../utils/parser';
 import { appConfig } from '../config';
 import * as fs from 'fs';
 import * as path from 'path';
@@ -17,18 +17,17 @@ export const dumpTreeCommand = new Command('dump-tree')
       }
 
       const fileContent = fs.readFileSync(absolutePath, 'utf-8');
-      const fileExtension = path.extname(absolutePath);
 
       const languageParser = new LanguageParser(appConfig.languages);
-      const langConfig = languageParser.fileSuffixMap.get(fileExtension);
+      const langConfig = languageParser.getLanguageConfigForFile(absolutePath);
 
       if (!langConfig || !langConfig.parser) {
-        console.error(`No parser found for file extension: ${fileExtension}`);
+        console.error(`No parser found for file: ${path.basename(absolutePath)}`);
         process.exit(1);
       }
 
       const parser = new Parser();
-      parser.setLanguage(langConfig.parser);
+      parser.setLanguage(getTreeSitterLanguage(langConfig, absolutePath));
 
       const tree = parser.parse(fileContent);
       console.log(tree.rootNode.toString());
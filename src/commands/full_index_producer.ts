@@ -1,12 +1,10 @@
-import { glob } from 'glob';
-import {
-  createIndex,
-  createLocationsIndex,
-  createSettingsIndex,
-  deleteIndex,
-  deleteLocationsIndex,
-} from '../utils/elasticsearch';
+import { createChunkStore, deleteChangedFile } from '../utils/chunk_store';
+import { CodeChunk } from '../utils/elasticsearch';
+import { createFileFilter, walkFiles } from '../utils/file_walker';
 import { LanguageParser } from '../utils/parser';
+import { createLanguageFileMatcher } from '../utils/language_detection';
+import { IndexError, StrictIndexError, getParseErrors, reportIndexErrors } from '../utils/index_errors';
+import { parseLanguageNames } from '../languages';
 import path from 'path';
 import { Worker } from 'worker_threads';
 import PQueue from 'p-queue';
@@ -14,6 +12,10 @@ import { execFileSync } from 'child_process';
 import fs from 'fs';
 import ignore from 'ignore';
 import { createLogger } from '../utils/logger';
+import { FileHashCache } from '../utils/file_hash_cache';
+import { detectFileChanges } from '../utils/file_changes';
+import { throwIfCancelled } from '../utils/cancellation';
+import { ProgressTracker } from '../utils/progress';
 import { IQueueWithEnqueueMetadata } from '../utils/queue';
 import { SqliteQueue } from '../utils/sqlite_queue';
 import { createMetrics, createAttributes } from '../utils/metrics';
@@ -32,8 +34,40 @@ export interface IndexOptions {
   branch?: string;
   parseConcurrency?: number;
   languages?: string;
+  /**
+   * Re-parse every file even if its content hash matches what is already indexed.
+   */
+  force?: boolean;
+  /**
+   * Honor `.gitignore` files, including nested ones (default: true).
+   */
+  gitignore?: boolean;
+  /**
+   * Only index files matching at least one of these `.gitignore`-style patterns.
+   */
+  include?: string[];
+  /**
+   * Skip files matching any of these `.gitignore`-style patterns, on top of the ignore files.
+   */
+  exclude?: string[];
+  /**
+   * Abort at the first file that fails to parse or is only indexed in a degraded form.
+   */
+  strict?: boolean;
+  /**
+   * Stops parsing between files when aborted. Chunks enqueued so far are kept, but the enqueue is not
+   * marked complete, so the next run re-enqueues.
+   */
+  signal?: AbortSignal;
+  /**
+   * Receives the walking and parsing progress of the run.
+   */
+  progress?: ProgressTracker;
 }
 
+/** File in the queue directory that remembers the content hashes of the files of the last run. */
+const FILE_HASH_CACHE_NAME = 'file_hashes.json';
+
 async function getQueue(options: IndexOptions, repoName?: string, branch?: string): Promise<IQueueWithEnqueueMetadata> {
   const queueDbPath = path.join(options.queueDir, 'queue.db');
   const queue = new SqliteQueue({
@@ -45,7 +79,65 @@ async function getQueue(options: IndexOptions, repoName?: string, branch?: strin
   return queue;
 }
 
-export async function index(directory: string, clean: boolean, options: IndexOptions) {
+/**
+ * Walks a directory of a repository for the files an index run parses: files of the enabled languages
+ * that are not left out by the ignore files, `.indexerignore`, or the include and exclude patterns.
+ *
+ * @returns The repository root, the paths of the files relative to it, and whether a path is under the
+ *   directory and of an enabled language, so that a walk would have found it if it were not left out.
+ */
+export async function findFilesToIndex(
+  directory: string,
+  options: Pick<IndexOptions, 'languages' | 'gitignore' | 'include' | 'exclude' | 'signal' | 'progress'>,
+  logger: ReturnType<typeof createLogger>
+): Promise<{ gitRoot: string; files: string[]; isInScope: (file: string) => boolean }> {
+  // Use execFileSync to prevent shell injection from special characters in directory paths
+  const gitRoot = execFileSync('git', ['rev-parse', '--show-toplevel'], {
+    cwd: directory,
+  })
+    .toString()
+    .trim();
+  const fileFilter = createFileFilter(gitRoot, {
+    gitignore: options.gitignore,
+    include: options.include,
+    exclude: options.exclude,
+  });
+
+  // Load .indexerignore if it exists
+  const ig = ignore();
+  const indexerignorePath = path.join(gitRoot, '.indexerignore');
+  if (fs.existsSync(indexerignorePath)) {
+    ig.add(fs.readFileSync(indexerignorePath, 'utf8'));
+    logger.info(`Loaded .indexerignore with custom exclusions`);
+  }
+
+  ig.add(['**/*_lexer.ts', '**/*_parser.ts']);
+
+  const relativeSearchDir = path.relative(gitRoot, directory);
+
+  const globPattern = path.join(relativeSearchDir, '**/*');
+
+  // Files are matched by name here; binary files are skipped once their content is read
+  const isLanguageFile = createLanguageFileMatcher(parseLanguageNames(options.languages));
+  options.progress?.setPhase('walking');
+  const relativeFiles = (await walkFiles(gitRoot, globPattern, fileFilter, options.signal)).filter(isLanguageFile);
+
+  const prefix = relativeSearchDir ? `${relativeSearchDir.split(path.sep).join('/')}/` : '';
+  const isInScope = (file: string) => file.startsWith(prefix) && isLanguageFile(file);
+  return { gitRoot, files: ig.filter(relativeFiles), isInScope };
+}
+
+/**
+ * Parses the files of a repository and enqueues their chunks for the indexer worker.
+ *
+ * A file that fails to parse does not stop the run: it is recorded and the rest of the repository is
+ * still indexed, unless `options.strict` is set.
+ *
+ * @returns The per-file errors of the run, also logged as a report at the end.
+ * @throws StrictIndexError at the first per-file error when `options.strict` is set.
+ * @throws IndexingCancelledError if `options.signal` is aborted.
+ */
+export async function index(directory: string, clean: boolean, options: IndexOptions): Promise<IndexError[]> {
   const repoName = options?.repoName ?? path.basename(path.resolve(directory));
   // Use execFileSync to prevent shell injection from special characters in directory paths
   const gitBranch =
@@ -64,76 +156,83 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
   logger.info('Starting full indexing process', {
     directory,
     clean,
+    force: options.force === true,
+    gitignore: options.gitignore !== false,
+    include: options.include,
+    exclude: options.exclude,
     supportedFileExtensions,
   });
+  const store = createChunkStore(options.elasticsearchIndex);
   if (clean) {
     logger.info('Clean flag is set, deleting existing index and clearing queue.');
-    await deleteIndex(options.elasticsearchIndex);
-    await deleteLocationsIndex(options.elasticsearchIndex);
+    await store.clean();
 
     // Clear the queue when doing a clean reindex
     const workQueue: IQueueWithEnqueueMetadata = await getQueue(options, repoName, gitBranch);
     await workQueue.clear();
   }
 
-  await createIndex(options.elasticsearchIndex);
-  await createSettingsIndex(options.elasticsearchIndex);
-  await createLocationsIndex(options.elasticsearchIndex);
+  await store.setup();
 
-  // Use execFileSync to prevent shell injection from special characters in directory paths
-  const gitRoot = execFileSync('git', ['rev-parse', '--show-toplevel'], {
-    cwd: directory,
-  })
-    .toString()
-    .trim();
-  const ig = ignore();
-  const gitignorePath = path.join(gitRoot, '.gitignore');
-  if (fs.existsSync(gitignorePath)) {
-    ig.add(fs.readFileSync(gitignorePath, 'utf8'));
-  }
-
-  // Load .indexerignore if it exists
-  const indexerignorePath = path.join(gitRoot, '.indexerignore');
-  if (fs.existsSync(indexerignorePath)) {
-    ig.add(fs.readFileSync(indexerignorePath, 'utf8'));
-    logger.info(`Loaded .indexerignore with custom exclusions`);
-  }
-
-  ig.add(['**/*_lexer.ts', '**/*_parser.ts']);
-
-  const relativeSearchDir = path.relative(gitRoot, directory);
-
-  const extensionPattern =
-    supportedFileExtensions.length === 1 ? supportedFileExtensions.join(',') : `{${supportedFileExtensions.join(',')}}`;
-  const globPattern = path.join(relativeSearchDir, `**/*${extensionPattern}`);
-
-  const allFiles = await glob(globPattern, {
-    cwd: gitRoot,
-  });
-
-  // Normalize to relative paths - glob may return absolute paths despite cwd
-  // Use fs.realpathSync to resolve symlinks (e.g., /tmp -> /private/tmp on macOS)
-  const realGitRoot = fs.realpathSync(gitRoot);
-  const relativeFiles = allFiles.map((f) => {
-    if (path.isAbsolute(f)) {
-      const realPath = fs.realpathSync(f);
-      return path.relative(realGitRoot, realPath);
-    }
-    return f;
-  });
-
-  const files = ig.filter(relativeFiles);
+  const found = await findFilesToIndex(directory, options, logger);
+  const gitRoot = found.gitRoot;
+  let files = found.files;
 
   logger.info(`Found ${files.length} files to process.`);
 
+  let changedFiles = new Set<string>();
+  if (!clean) {
+    const hashCache = new FileHashCache(path.join(options.queueDir, FILE_HASH_CACHE_NAME));
+    ({ files, changedFiles } = await detectFileChanges(store, files, {
+      root: gitRoot,
+      branch: gitBranch,
+      workspace: repoName,
+      isInScope: found.isInScope,
+      hashCache,
+      force: options.force,
+      logger,
+    }));
+    hashCache.save();
+  }
+  options.progress?.setFilesTotal(files.length);
+
   let successCount = 0;
   let failureCount = 0;
+  const errors: IndexError[] = [];
+  let strictError: StrictIndexError | undefined;
 
   const parseConcurrency =
     typeof options.parseConcurrency === 'number' && Number.isFinite(options.parseConcurrency)
       ? Math.floor(options.parseConcurrency)
       : 1;
   const producerQueue = new PQueue({ concurrency: Math.max(1, parseConcurrency) });
+  // Files already being parsed finish and are enqueued; the rest are dropped.
+  const onAbort = () => producerQueue.clear();
+  options.signal?.addEventListener('abort', onAbort, { once: true });
+
+  const recordError = (error: IndexError) => {
+    errors.push(error);
+    if (options.strict && !strictError && !error.skipped) {
+      strictError = new StrictIndexError(error);
+      producerQueue.clear();
+    }
+  };
+
+  // Replaces the locations of a changed file once it is parsed; false if they could not be removed
+  const deleteStaleLocations = async (file: string, chunks: CodeChunk[]): Promise<boolean> => {
+    if (!changedFiles.has(file)) {
+      return true;
+    }
+    try {
+      await deleteChangedFile(store, file, chunks, { workspace: repoName });
+      return true;
+    } catch (error) {
+      const message = error instanceof Error ? error.message : String(error);
+      logger.error('Failed to remove the stale locations of a changed file', { file, error: message });
+      recordError({ path: file, error: `Failed to remove stale locations: ${message}`, fatal: true });
+      return false;
+    }
+  };
 
   const workQueue: IQueueWithEnqueueMetadata = await getQueue(options, repoName, gitBranch);
   // Ensure enqueue completion metadata reflects this run.
@@ -141,12 +240,19 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
 
   const producerWorkerPath = path.join(__dirname, '..', '..', 'dist', 'utils', 'producer_worker.js');
 
-  files.forEach((file) => {
+  for (const file of files) {
+    // Files are handed out as parse threads free up, so the jobs waiting stay few however large the repository
+    if (producerQueue.size >= producerQueue.concurrency) {
+      await producerQueue.onEmpty();
+    }
+    if (options.signal?.aborted || strictError) {
+      break;
+    }
     producerQueue.add(
       () =>
-        new Promise<void>((resolve, reject) => {
+        new Promise<void>((resolve) => {
           const worker = new Worker(producerWorkerPath, {
-            workerData: { repoName, gitBranch, languages: options.languages },
+            workerData: { repoName, gitBranch, languages: options.languages, workspace: repoName },
           });
           const absolutePath = path.resolve(gitRoot, file);
           worker.on('message', async (message) => {
@@ -194,9 +300,13 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
                 }
               }
 
-              if (message.data.length > 0) {
+              const chunksSkipped = message.metrics?.chunksSkipped ?? 0;
+              getParseErrors(file, message.fallback, chunksSkipped, message.skipped).forEach(recordError);
+
+              if ((await deleteStaleLocations(file, message.data)) && message.data.length > 0) {
                 await workQueue.enqueue(message.data);
               }
+              options.progress?.addFileDone(message.data.length);
             } else if (message.status === MESSAGE_STATUS_FAILURE) {
               failureCount++;
 
@@ -215,15 +325,22 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
                 file: message.filePath,
                 error: message.error,
               });
+              recordError({ path: file, error: message.error, fatal: true });
+              await deleteStaleLocations(file, []);
+              options.progress?.addFileDone();
             }
-            worker.terminate();
+            // Wait for the thread to exit, so no more than parseConcurrency threads hold a parser at a time
+            await worker.terminate();
             resolve();
           });
-          worker.on('error', (err) => {
+          worker.on('error', async (err) => {
             failureCount++;
             logger.error('Worker thread error', { file, error: err.message });
-            worker.terminate();
-            reject(err);
+            recordError({ path: file, error: `Worker thread error: ${err.message}`, fatal: true });
+            await deleteStaleLocations(file, []);
+            options.progress?.addFileDone();
+            await worker.terminate();
+            resolve();
           });
           const relativePath = file;
           worker.postMessage({
@@ -233,9 +350,16 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
           });
         })
     );
-  });
+  }
 
   await producerQueue.onIdle();
+  options.signal?.removeEventListener('abort', onAbort);
+  await store.close();
+
+  if (strictError) {
+    throw strictError;
+  }
+  throwIfCancelled(options.signal);
 
   // Use execFileSync to prevent shell injection from special characters in directory paths
   const commitHash = execFileSync('git', ['rev-parse', 'HEAD'], {
@@ -247,6 +371,7 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
   logger.info('--- Indexing Summary ---');
   logger.info(`Successfully processed: ${successCount} files`);
   logger.info(`Failed to parse:      ${failureCount} files`);
+  logger.info(`Skipped:              ${errors.filter((error) => error.skipped).length} files`);
   logger.info(`HEAD commit hash:     ${commitHash}`);
   logger.info('---');
   logger.info('File parsing and enqueueing complete.');
@@ -257,4 +382,7 @@ export async function index(directory: string, clean: boolean, options: IndexOpt
   await workQueue.markEnqueueCompleted();
 
   logger.info('Note: Commit hash will be updated after worker completes successfully.');
+
+  reportIndexErrors(errors, logger);
+  return errors;
 }
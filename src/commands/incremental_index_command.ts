@@ -1,13 +1,21 @@
-import { createLocationsIndex, deleteDocumentsByFilePaths, getLastIndexedCommit } from '../utils/elasticsearch';
-import { languageConfigurations, parseLanguageNames } from '../languages';
+import { ChunkStore, createChunkStore, deleteChangedFile } from '../utils/chunk_store';
+import { CodeChunk } from '../utils/elasticsearch';
+import { createFileFilter } from '../utils/file_walker';
+import { parseLanguageNames } from '../languages';
+import { createLanguageFileMatcher } from '../utils/language_detection';
+import { IndexError, StrictIndexError, getParseErrors, reportIndexErrors } from '../utils/index_errors';
+import type { ParseFallback, ParseSkip } from '../utils/parser';
 import path from 'path';
 import { Worker } from 'worker_threads';
 import PQueue from 'p-queue';
 import { createLogger } from '../utils/logger';
+import { throwIfCancelled } from '../utils/cancellation';
+import { ProgressTracker } from '../utils/progress';
 import { IQueueWithEnqueueMetadata } from '../utils/queue';
 import { SqliteQueue } from '../utils/sqlite_queue';
 import simpleGit from 'simple-git';
-import { createMetrics, createAttributes } from '../utils/metrics';
+import { createMetrics, createAttributes, Metrics } from '../utils/metrics';
+import { getCommitKey } from '../utils/workspace';
 import {
   MESSAGE_STATUS_SUCCESS,
   MESSAGE_STATUS_FAILURE,
@@ -24,6 +32,18 @@ export interface IncrementalIndexOptions {
   languages?: string;
   repoName?: string;
   branch?: string;
+  /** Honor `.gitignore` files, including nested ones (default: true). */
+  gitignore?: boolean;
+  /** Only index files matching at least one of these `.gitignore`-style patterns. */
+  include?: string[];
+  /** Skip files matching any of these `.gitignore`-style patterns. */
+  exclude?: string[];
+  /** Abort at the first file that fails to parse or is only indexed in a degraded form. */
+  strict?: boolean;
+  /** Stops parsing between files when aborted; the enqueue is then not marked complete. */
+  signal?: AbortSignal;
+  /** Receives the parsing progress of the run. */
+  progress?: ProgressTracker;
 }
 
 async function getQueue(
@@ -41,7 +61,329 @@ async function getQueue(
   return queue;
 }
 
-export async function incrementalIndex(directory: string, options: IncrementalIndexOptions) {
+/**
+ * Dependencies for parsing files in producer worker threads and enqueueing their chunks.
+ */
+export interface ParseAndEnqueueContext {
+  /** Absolute path of the repository root; files are relative to it. */
+  gitRoot: string;
+  repoName: string;
+  gitBranch: string;
+  queue: IQueueWithEnqueueMetadata;
+  parseConcurrency?: number;
+  languages?: string;
+  logger: ReturnType<typeof createLogger>;
+  metrics: Metrics;
+  /** Stop at the first per-file error, see `StrictIndexError`. */
+  strict?: boolean;
+  /** Stops handing out files when aborted; files being parsed are still enqueued. */
+  signal?: AbortSignal;
+  /** Counts each file as done once it is parsed or failed to parse. */
+  progress?: ProgressTracker;
+  /**
+   * Files whose previous locations in `store` are replaced once they are parsed, keeping the chunks they
+   * still have (see `deleteChangedFile`). Other files are expected to have no locations left.
+   */
+  changedFiles?: { store: ChunkStore; paths: Set<string> };
+}
+
+/**
+ * Parses files in a pool of producer worker threads and enqueues the resulting chunks.
+ *
+ * Shared by the incremental index and `watch`, which both re-index an explicit list of files.
+ *
+ * @param files Repository-relative paths of the files to parse.
+ * @returns How many files were parsed and enqueued, how many failed to parse, and the per-file errors.
+ * @throws StrictIndexError at the first per-file error when `context.strict` is set.
+ * @throws IndexingCancelledError if `context.signal` is aborted.
+ */
+export async function parseAndEnqueueFiles(
+  files: string[],
+  context: ParseAndEnqueueContext
+): Promise<{ successCount: number; failureCount: number; errors: IndexError[] }> {
+  const { gitRoot, repoName, gitBranch, queue, logger, metrics } = context;
+  let successCount = 0;
+  let failureCount = 0;
+  const errors: IndexError[] = [];
+  let strictError: StrictIndexError | undefined;
+
+  const producerWorkerPath = path.join(__dirname, '..', '..', 'dist', 'utils', 'producer_worker.js');
+
+  const configuredPoolSize =
+    typeof context.parseConcurrency === 'number' && Number.isFinite(context.parseConcurrency)
+      ? Math.floor(context.parseConcurrency)
+      : 1;
+  const poolSize = Math.max(1, Math.min(configuredPoolSize, files.length));
+
+  const producerQueue = new PQueue({ concurrency: poolSize });
+
+  const recordError = (error: IndexError) => {
+    errors.push(error);
+    if (context.strict && !strictError && !error.skipped) {
+      strictError = new StrictIndexError(error);
+      producerQueue.clear();
+    }
+  };
+  const onAbort = () => producerQueue.clear();
+  context.signal?.addEventListener('abort', onAbort, { once: true });
+
+  // Replaces the locations of a changed file once it is parsed; false if they could not be removed
+  const deleteStaleLocations = async (file: string, chunks: CodeChunk[]): Promise<boolean> => {
+    const { changedFiles } = context;
+    if (!changedFiles?.paths.has(file)) {
+      return true;
+    }
+    try {
+      await deleteChangedFile(changedFiles.store, file, chunks, { workspace: repoName });
+      return true;
+    } catch (error) {
+      const message = error instanceof Error ? error.message : String(error);
+      logger.error('Failed to remove the stale locations of a changed file', { file, error: message });
+      recordError({ path: file, error: `Failed to remove stale locations: ${message}`, fatal: true });
+      return false;
+    }
+  };
+
+  const workers = Array.from(
+    { length: poolSize },
+    () =>
+      new Worker(producerWorkerPath, {
+        workerData: { repoName, gitBranch, languages: context.languages, workspace: repoName },
+      })
+  );
+
+  const idleWorkers: Worker[] = workers.slice();
+  const waiters: Array<(worker: Worker) => void> = [];
+
+  const acquireWorker = async (): Promise<Worker> => {
+    const worker = idleWorkers.pop();
+    if (worker) return worker;
+    return await new Promise<Worker>((resolve) => waiters.push(resolve));
+  };
+
+  const releaseWorker = (worker: Worker): void => {
+    const waiter = waiters.shift();
+    if (waiter) {
+      waiter(worker);
+    } else {
+      idleWorkers.push(worker);
+    }
+  };
+
+  const addOneTimeListener = (
+    worker: Worker,
+    event: 'message' | 'error',
+    handler: (...args: unknown[]) => void
+  ): (() => void) => {
+    const w = worker as unknown as {
+      once?: (event: string, handler: (...args: unknown[]) => void) => void;
+      on: (event: string, handler: (...args: unknown[]) => void) => void;
+      off?: (event: string, handler: (...args: unknown[]) => void) => void;
+      removeListener?: (event: string, handler: (...args: unknown[]) => void) => void;
+    };
+
+    if (typeof w.once === 'function') {
+      w.once(event, handler);
+      // Critical: remove the listener when the opposite event wins the race.
+      // (On Node.js, removeListener(event, originalHandler) also removes the internal once wrapper.)
+      return () => {
+        if (typeof w.off === 'function') {
+          w.off(event, handler);
+        } else if (typeof w.removeListener === 'function') {
+          w.removeListener(event, handler);
+        }
+      };
+    }
+
+    w.on(event, handler);
+    return () => {
+      if (typeof w.off === 'function') {
+        w.off(event, handler);
+      } else if (typeof w.removeListener === 'function') {
+        w.removeListener(event, handler);
+      }
+    };
+  };
+
+  const runParseJob = async (file: string): Promise<void> => {
+    const relativePath = file;
+    const absolutePath = path.resolve(gitRoot, file);
+
+    const worker = await acquireWorker();
+    let chunks = 0;
+    try {
+      const message = await new Promise<unknown>((resolve, reject) => {
+        const cleanups: Array<() => void> = [];
+        const cleanup = () => cleanups.forEach((fn) => fn());
+
+        cleanups.push(
+          addOneTimeListener(worker, 'message', (msg: unknown) => {
+            cleanup();
+            resolve(msg);
+          })
+        );
+
+        cleanups.push(
+          addOneTimeListener(worker, 'error', (err: unknown) => {
+            cleanup();
+            reject(err);
+          })
+        );
+
+        worker.postMessage({
+          filePath: absolutePath,
+          gitBranch,
+          relativePath,
+        });
+      });
+
+      const payload = message as {
+        status?: unknown;
+        data?: unknown;
+        metrics?: unknown;
+        error?: unknown;
+        filePath?: unknown;
+        fallback?: ParseFallback;
+        skipped?: ParseSkip;
+      };
+
+      const status = payload.status;
+      const metricsPayload = payload.metrics as
+        | {
+            filesProcessed?: unknown;
+            filesFailed?: unknown;
+            chunksCreated?: unknown;
+            chunksSkipped?: unknown;
+            chunkSizes?: unknown;
+            language?: unknown;
+            parserType?: unknown;
+          }
+        | undefined;
+
+      if (status === MESSAGE_STATUS_SUCCESS) {
+        successCount++;
+
+        // Record parser metrics from worker
+        if (metricsPayload && metrics.parser) {
+          const attrs = createAttributes(metrics, {
+            language: typeof metricsPayload.language === 'string' ? metricsPayload.language : LANGUAGE_UNKNOWN,
+            parser_type: typeof metricsPayload.parserType === 'string' ? metricsPayload.parserType : '',
+          });
+
+          const filesProcessed =
+            typeof metricsPayload.filesProcessed === 'number' ? metricsPayload.filesProcessed : 0;
+          const chunksCreated = typeof metricsPayload.chunksCreated === 'number' ? metricsPayload.chunksCreated : 0;
+          const chunksSkipped = typeof metricsPayload.chunksSkipped === 'number' ? metricsPayload.chunksSkipped : 0;
+          const chunkSizes = Array.isArray(metricsPayload.chunkSizes) ? metricsPayload.chunkSizes : [];
+
+          if (filesProcessed > 0) {
+            metrics.parser.filesProcessed.add(filesProcessed, {
+              ...attrs,
+              status: METRIC_STATUS_SUCCESS,
+            });
+          }
+
+          if (chunksCreated > 0) {
+            metrics.parser.chunksCreated.add(chunksCreated, attrs);
+          }
+
+          if (chunksSkipped > 0) {
+            metrics.parser.chunksSkipped?.add(chunksSkipped, {
+              ...attrs,
+              size: 'oversized',
+            });
+          }
+
+          chunkSizes.forEach((size: unknown) => {
+            if (typeof size === 'number') {
+              metrics.parser?.chunkSize.record(size, attrs);
+            }
+          });
+        }
+
+        const chunksSkipped = typeof metricsPayload?.chunksSkipped === 'number' ? metricsPayload.chunksSkipped : 0;
+        getParseErrors(relativePath, payload.fallback, chunksSkipped, payload.skipped).forEach(recordError);
+
+        const data = Array.isArray(payload.data) ? (payload.data as CodeChunk[]) : [];
+        if ((await deleteStaleLocations(relativePath, data)) && data.length > 0) {
+          await queue.enqueue(data);
+          chunks = data.length;
+        }
+        return;
+      }
+
+      if (status === MESSAGE_STATUS_FAILURE) {
+        failureCount++;
+
+        // Record failure metric
+        const filesFailed = typeof metricsPayload?.filesFailed === 'number' ? metricsPayload.filesFailed : 0;
+        const language = typeof metricsPayload?.language === 'string' ? metricsPayload.language : LANGUAGE_UNKNOWN;
+        if (metricsPayload && metrics.parser && filesFailed > 0) {
+          metrics.parser.filesFailed.add(
+            filesFailed,
+            createAttributes(metrics, {
+              language,
+              status: METRIC_STATUS_FAILURE,
+            })
+          );
+        }
+
+        const error = typeof payload.error === 'string' ? payload.error : 'Unknown error';
+        logger.warn('Failed to parse file', {
+          file: typeof payload.filePath === 'string' ? payload.filePath : absolutePath,
+          error,
+        });
+        recordError({ path: relativePath, error, fatal: true });
+        await deleteStaleLocations(relativePath, []);
+        return;
+      }
+
+      failureCount++;
+      logger.warn('Unexpected worker response while parsing file', { file: relativePath, status });
+      recordError({ path: relativePath, error: `Unexpected worker response: ${String(status)}`, fatal: true });
+      await deleteStaleLocations(relativePath, []);
+    } catch (err) {
+      failureCount++;
+      const message = err instanceof Error ? err.message : String(err);
+      logger.error('Worker thread error', { file, error: message });
+      recordError({ path: relativePath, error: `Worker thread error: ${message}`, fatal: true });
+      await deleteStaleLocations(relativePath, []);
+    } finally {
+      context.progress?.addFileDone(chunks);
+      releaseWorker(worker);
+    }
+  };
+
+  for (const file of files) {
+    // Files are handed out as parse threads free up, so the jobs waiting stay few however large the diff
+    if (producerQueue.size >= poolSize) {
+      await producerQueue.onEmpty();
+    }
+    if (context.signal?.aborted || strictError) {
+      break;
+    }
+    producerQueue.add(() => runParseJob(file));
+  }
+
+  await producerQueue.onIdle();
+  context.signal?.removeEventListener('abort', onAbort);
+  await Promise.all(workers.map(async (w) => await w.terminate()));
+
+  if (strictError) {
+    throw strictError;
+  }
+  throwIfCancelled(context.signal);
+  return { successCount, failureCount, errors };
+}
+
+/**
+ * Removes files changed since the last indexed commit from the index and enqueues their new versions.
+ *
+ * @returns The per-file errors of the run, also logged as a report at the end.
+ * @throws StrictIndexError at the first per-file error when `options.strict` is set.
+ * @throws IndexingCancelledError if `options.signal` is aborted.
+ */
+export async function incrementalIndex(directory: string, options: IncrementalIndexOptions): Promise<IndexError[]> {
   const repoName = options?.repoName ?? path.basename(path.resolve(directory));
 
   const git = simpleGit(directory);
@@ -50,28 +392,25 @@ export async function incrementalIndex(directory: string, options: IncrementalIn
   const logger = createLogger({ name: repoName, branch: gitBranch });
   const metrics = createMetrics({ name: repoName, branch: gitBranch });
 
-  const supportedExtensions = new Set<string>();
-  const enabledLanguageNames = parseLanguageNames(options.languages);
-  enabledLanguageNames.forEach((name) => {
-    const config = languageConfigurations[name];
-    config.fileSuffixes.forEach((suffix) => supportedExtensions.add(suffix));
-  });
+  const isLanguageFile = createLanguageFileMatcher(parseLanguageNames(options.languages));
 
   logger.info('Starting incremental indexing process', {
     directory,
     ...options,
   });
 
-  const lastCommitHash = await getLastIndexedCommit(gitBranch, options.elasticsearchIndex);
+  const store = createChunkStore(options.elasticsearchIndex);
+  const lastCommitHash = await store.getLastIndexedCommit(getCommitKey(gitBranch, repoName));
 
   if (!lastCommitHash) {
     logger.warn('No previous commit hash found. Please run a full index first.', { gitBranch });
-    return;
+    await store.close();
+    return [];
   }
 
   // Ensure the locations store exists for this index. This allows upgrading existing deployments
   // without requiring a full clean reindex just to create the new index.
-  await createLocationsIndex(options.elasticsearchIndex);
+  await store.setup();
 
   logger.info(`Last indexed commit hash: ${lastCommitHash}`, { gitBranch });
 
@@ -81,7 +420,8 @@ export async function incrementalIndex(directory: string, options: IncrementalIn
   const changedFiles = changedFilesRaw.split('\n').filter((line) => line);
 
   const filesToDelete: string[] = [];
-  const filesToIndex: string[] = [];
+  const modifiedFiles = new Set<string>();
+  const candidateFiles: string[] = [];
 
   for (const line of changedFiles) {
     const parts = line.split('\t');
@@ -92,276 +432,96 @@ export async function incrementalIndex(directory: string, options: IncrementalIn
       const oldFile = parts[1];
       const newFile = parts[2];
       filesToDelete.push(oldFile);
-      if (supportedExtensions.has(path.extname(newFile))) {
-        filesToIndex.push(newFile);
+      if (isLanguageFile(newFile)) {
+        candidateFiles.push(newFile);
       }
     } else if (status.startsWith('C')) {
       // Handle Copy (CXXX)
       const newFile = parts[2];
-      if (supportedExtensions.has(path.extname(newFile))) {
-        filesToIndex.push(newFile);
+      if (isLanguageFile(newFile)) {
+        candidateFiles.push(newFile);
       }
     } else if (status === 'D') {
       const file = parts[1];
       filesToDelete.push(file);
     } else if (status === 'A') {
       const file = parts[1];
-      if (supportedExtensions.has(path.extname(file))) {
-        filesToIndex.push(file);
+      if (isLanguageFile(file)) {
+        candidateFiles.push(file);
       }
     } else if (status === 'M') {
       const file = parts[1];
       // Always remove stale indexed locations for changed files, even if this file type is no
       // longer enabled. Otherwise changing the enabled language set can leave stale docs.
-      filesToDelete.push(file);
-      if (supportedExtensions.has(path.extname(file))) {
-        filesToIndex.push(file);
+      modifiedFiles.add(file);
+      if (isLanguageFile(file)) {
+        candidateFiles.push(file);
       }
     }
   }
 
+  // Changed files in ignored paths (e.g. force-added to git) are removed above but not re-indexed.
+  const fileFilter = createFileFilter(gitRoot, {
+    gitignore: options.gitignore,
+    include: options.include,
+    exclude: options.exclude,
+  });
+  const filesToIndex = candidateFiles.filter((file) => fileFilter.accepts(file));
+  // Modified files that are re-indexed keep their locations until they are parsed, see `deleteChangedFile`
+  const reindexedFiles = new Set(filesToIndex.filter((file) => modifiedFiles.has(file)));
+  filesToDelete.push(...Array.from(modifiedFiles).filter((file) => !reindexedFiles.has(file)));
+
   logger.info(`Found ${changedFiles.length} changed files`, {
     toIndex: filesToIndex.length,
     toDelete: filesToDelete.length,
   });
 
   let workQueue: IQueueWithEnqueueMetadata | undefined;
+  let errors: IndexError[] = [];
 
   if (filesToDelete.length > 0) {
     logger.info('Removing stale indexed locations for changed/deleted files...', { count: filesToDelete.length });
-    await deleteDocumentsByFilePaths(filesToDelete, options.elasticsearchIndex, {
+    await store.deleteDocumentsByFilePaths(filesToDelete, {
       deleteDocumentsPageSize: options.deleteDocumentsPageSize,
+      workspace: repoName,
     });
     logger.info('Removed stale indexed locations for changed/deleted files.', { count: filesToDelete.length });
   }
 
+  options.progress?.setFilesTotal(filesToIndex.length);
+
   if (filesToIndex.length === 0) {
+    await store.close();
     logger.info('No new or modified files to process.');
   } else {
     logger.info('Processing and enqueueing added/modified files...');
 
-    let successCount = 0;
-    let failureCount = 0;
     const enqueueQueue = await getQueue(options, repoName, gitBranch);
     workQueue = enqueueQueue;
     // Ensure enqueue completion metadata reflects this run. If the process dies mid-enqueue,
     // the index command can detect it and safely re-enqueue from scratch.
     await enqueueQueue.markEnqueueStarted();
 
-    const producerWorkerPath = path.join(__dirname, '..', '..', 'dist', 'utils', 'producer_worker.js');
-
-    const configuredPoolSize =
-      typeof options.parseConcurrency === 'number' && Number.isFinite(options.parseConcurrency)
-        ? Math.floor(options.parseConcurrency)
-        : 1;
-    const poolSize = Math.max(1, Math.min(configuredPoolSize, filesToIndex.length));
-
-    const producerQueue = new PQueue({ concurrency: poolSize });
-
-    const workers = Array.from(
-      { length: poolSize },
-      () =>
-        new Worker(producerWorkerPath, {
-          workerData: { repoName, gitBranch, languages: options.languages },
-        })
-    );
-
-    const idleWorkers: Worker[] = workers.slice();
-    const waiters: Array<(worker: Worker) => void> = [];
-
-    const acquireWorker = async (): Promise<Worker> => {
-      const worker = idleWorkers.pop();
-      if (worker) return worker;
-      return await new Promise<Worker>((resolve) => waiters.push(resolve));
-    };
-
-    const releaseWorker = (worker: Worker): void => {
-      const waiter = waiters.shift();
-      if (waiter) {
-        waiter(worker);
-      } else {
-        idleWorkers.push(worker);
-      }
-    };
-
-    const addOneTimeListener = (
-      worker: Worker,
-      event: 'message' | 'error',
-      handler: (...args: unknown[]) => void
-    ): (() => void) => {
-      const w = worker as unknown as {
-        once?: (event: string, handler: (...args: unknown[]) => void) => void;
-        on: (event: string, handler: (...args: unknown[]) => void) => void;
-        off?: (event: string, handler: (...args: unknown[]) => void) => void;
-        removeListener?: (event: string, handler: (...args: unknown[]) => void) => void;
-      };
-
-      if (typeof w.once === 'function') {
-        w.once(event, handler);
-        // Critical: remove the listener when the opposite event wins the race.
-        // (On Node.js, removeListener(event, originalHandler) also removes the internal once wrapper.)
-        return () => {
-          if (typeof w.off === 'function') {
-            w.off(event, handler);
-          } else if (typeof w.removeListener === 'function') {
-            w.removeListener(event, handler);
-          }
-        };
-      }
-
-      w.on(event, handler);
-      return () => {
-        if (typeof w.off === 'function') {
-          w.off(event, handler);
-        } else if (typeof w.removeListener === 'function') {
-          w.removeListener(event, handler);
-        }
-      };
-    };
-
-    const runParseJob = async (file: string): Promise<void> => {
-      const relativePath = file;
-      const absolutePath = path.resolve(gitRoot, file);
-
-      const worker = await acquireWorker();
-      try {
-        const message = await new Promise<unknown>((resolve, reject) => {
-          const cleanups: Array<() => void> = [];
-          const cleanup = () => cleanups.forEach((fn) => fn());
-
-          cleanups.push(
-            addOneTimeListener(worker, 'message', (msg: unknown) => {
-              cleanup();
-              resolve(msg);
-            })
-          );
-
-          cleanups.push(
-            addOneTimeListener(worker, 'error', (err: unknown) => {
-              cleanup();
-              reject(err);
-            })
-          );
-
-          worker.postMessage({
-            filePath: absolutePath,
-            gitBranch,
-            relativePath,
-          });
-        });
-
-        const payload = message as {
-          status?: unknown;
-          data?: unknown;
-          metrics?: unknown;
-          error?: unknown;
-          filePath?: unknown;
-        };
-
-        const status = payload.status;
-        const metricsPayload = payload.metrics as
-          | {
-              filesProcessed?: unknown;
-              filesFailed?: unknown;
-              chunksCreated?: unknown;
-              chunksSkipped?: unknown;
-              chunkSizes?: unknown;
-              language?: unknown;
-              parserType?: unknown;
-            }
-          | undefined;
-
-        if (status === MESSAGE_STATUS_SUCCESS) {
-          successCount++;
-
-          // Record parser metrics from worker
-          if (metricsPayload && metrics.parser) {
-            const attrs = createAttributes(metrics, {
-              language: typeof metricsPayload.language === 'string' ? metricsPayload.language : LANGUAGE_UNKNOWN,
-              parser_type: typeof metricsPayload.parserType === 'string' ? metricsPayload.parserType : '',
-            });
-
-            const filesProcessed =
-              typeof metricsPayload.filesProcessed === 'number' ? metricsPayload.filesProcessed : 0;
-            const chunksCreated = typeof metricsPayload.chunksCreated === 'number' ? metricsPayload.chunksCreated : 0;
-            const chunksSkipped = typeof metricsPayload.chunksSkipped === 'number' ? metricsPayload.chunksSkipped : 0;
-            const chunkSizes = Array.isArray(metricsPayload.chunkSizes) ? metricsPayload.chunkSizes : [];
-
-            if (filesProcessed > 0) {
-              metrics.parser.filesProcessed.add(filesProcessed, {
-                ...attrs,
-                status: METRIC_STATUS_SUCCESS,
-              });
-            }
-
-            if (chunksCreated > 0) {
-              metrics.parser.chunksCreated.add(chunksCreated, attrs);
-            }
-
-            if (chunksSkipped > 0) {
-              metrics.parser.chunksSkipped?.add(chunksSkipped, {
-                ...attrs,
-                size: 'oversized',
-              });
-            }
-
-            chunkSizes.forEach((size: unknown) => {
-              if (typeof size === 'number') {
-                metrics.parser?.chunkSize.record(size, attrs);
-              }
-            });
-          }
-
-          if (Array.isArray(payload.data) && payload.data.length > 0) {
-            await enqueueQueue.enqueue(payload.data);
-          }
-          return;
-        }
-
-        if (status === MESSAGE_STATUS_FAILURE) {
-          failureCount++;
-
-          // Record failure metric
-          const filesFailed = typeof metricsPayload?.filesFailed === 'number' ? metricsPayload.filesFailed : 0;
-          const language = typeof metricsPayload?.language === 'string' ? metricsPayload.language : LANGUAGE_UNKNOWN;
-          if (metricsPayload && metrics.parser && filesFailed > 0) {
-            metrics.parser.filesFailed.add(
-              filesFailed,
-              createAttributes(metrics, {
-                language,
-                status: METRIC_STATUS_FAILURE,
-              })
-            );
-          }
-
-          logger.warn('Failed to parse file', {
-            file: typeof payload.filePath === 'string' ? payload.filePath : absolutePath,
-            error: typeof payload.error === 'string' ? payload.error : 'Unknown error',
-          });
-          return;
-        }
-
-        failureCount++;
-        logger.warn('Unexpected worker response while parsing file', { file: relativePath, status });
-      } catch (err) {
-        failureCount++;
-        const message = err instanceof Error ? err.message : String(err);
-        logger.error('Worker thread error', { file, error: message });
-      } finally {
-        releaseWorker(worker);
-      }
-    };
-
-    filesToIndex.forEach((file) => {
-      producerQueue.add(() => runParseJob(file));
-    });
-
-    await producerQueue.onIdle();
-    await Promise.all(workers.map(async (w) => await w.terminate()));
+    const parsed = await parseAndEnqueueFiles(filesToIndex, {
+      gitRoot,
+      repoName,
+      gitBranch,
+      queue: enqueueQueue,
+      parseConcurrency: options.parseConcurrency,
+      languages: options.languages,
+      logger,
+      metrics,
+      strict: options.strict,
+      signal: options.signal,
+      progress: options.progress,
+      changedFiles: { store, paths: reindexedFiles },
+    }).finally(() => store.close());
+    errors = parsed.errors;
 
     logger.info('--- Incremental Indexing Summary (Additions/Modifications) ---');
-    logger.info(`Successfully processed: ${successCount} files`);
-    logger.info(`Failed to parse:      ${failureCount} files`);
+    logger.info(`Successfully processed: ${parsed.successCount} files`);
+    logger.info(`Failed to parse:      ${parsed.failureCount} files`);
+    logger.info(`Skipped:              ${errors.filter((error) => error.skipped).length} files`);
   }
 
   const newCommitHash = await git.revparse(['HEAD']);
@@ -378,4 +538,7 @@ export async function incrementalIndex(directory: string, options: IncrementalIn
   logger.info('---');
   logger.info('Incremental file parsing and enqueueing complete.');
   logger.info('Note: Commit hash will be updated after worker completes successfully.');
+
+  reportIndexErrors(errors, logger);
+  return errors;
 }
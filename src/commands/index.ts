@@ -1,5 +1,8 @@
 // Main command
 export * from './index_command';
+export * from './delete_path_command';
+export * from './archive_command';
+export * from './watch_command';
 
 // Utility commands
 export * from './setup_command';
@@ -13,6 +16,7 @@ export * from './scaffold_language_command';
 
 // User-facing commands
 export * from './search_command';
+export * from './serve_command';
 
 // Internal utilities (not exposed as CLI commands)
 export * from './full_index_producer';
@@ -1,12 +1,21 @@
 import { Command, Option } from 'commander';
 import { index as indexRepo } from './full_index_producer';
 import { incrementalIndex } from './incremental_index_command';
+import { DryRunReport, dryRunIndex, printDryRunReport } from './dry_run';
 import { worker } from './worker_command';
-import { appConfig } from '../config';
+import { deletePathCommand, reindexPathCommand } from './delete_path_command';
+import { exportArchiveCommand, importArchiveCommand } from './archive_command';
+import { appConfig, embeddingConfig, indexingConfig } from '../config';
 import { logger } from '../utils/logger';
+import { IndexingCancelledError, startCancellableRun, throwIfCancelled } from '../utils/cancellation';
 import { shutdown } from '../utils/otel_provider';
 import { cloneOrPullRepo, pullRepo } from '../utils/git_helper';
+import { RefCheckout, checkoutRef, isBareRepository } from '../utils/git_ref';
+import { ProgressTracker, createConsoleProgress } from '../utils/progress';
 import { parseLanguageNames } from '../languages';
+import { parseEmbedTemplate } from '../utils/embed_template';
+import { parseChunkStrategies } from '../utils/chunk_strategy';
+import { getCommitKey } from '../utils/workspace';
 import path from 'path';
 import fs from 'fs';
 import { execFileSync } from 'child_process';
@@ -180,15 +189,33 @@ async function indexRepos(
   repoArgs: string[],
   options: {
     clean?: boolean;
+    force?: boolean;
     pull?: boolean;
     watch?: boolean;
     concurrency?: string;
     branch?: string;
     githubToken?: string;
     batchSize?: string;
+    /** Most chunks in memory between parsing and storing (default: `SCS_IDXR_MAX_IN_FLIGHT_CHUNKS`). */
+    maxInFlightChunks?: string;
     deleteDocumentsPageSize?: string;
     parseConcurrency?: string;
+    embeddingBatchSize?: string;
+    embeddingConcurrency?: string;
+    embedCache?: boolean;
     languages?: string;
+    gitignore?: boolean;
+    include?: string[];
+    exclude?: string[];
+    strict?: boolean;
+    /** Branch, tag, or commit to index instead of the working tree; see `checkoutRef`. */
+    ref?: string;
+    /** Fold near-duplicate chunks before embedding (default: `SCS_IDXR_DEDUP`); see `ChunkDeduplicator`. */
+    dedup?: boolean;
+    /** Walk and parse, then print what would be embedded instead of enqueueing anything; see `dryRunIndex`. */
+    dryRun?: boolean;
+    /** Cancels the run between files and batches; see `startCancellableRun`. */
+    signal?: AbortSignal;
   }
 ) {
   logger.info('Starting index command...');
@@ -199,6 +226,15 @@ async function indexRepos(
     process.exit(1);
   }
 
+  if (options.ref && options.watch) {
+    throw new Error('--ref cannot be combined with --watch: a ref is a fixed snapshot with nothing to watch.');
+  }
+
+  if (options.dryRun && (options.watch || options.clean)) {
+    const option = options.watch ? '--watch' : '--clean';
+    throw new Error(`--dry-run cannot be combined with ${option}: a dry run changes nothing.`);
+  }
+
   if (options.watch && repoArgs.length > 1) {
     logger.warn(
       `Watch mode enabled with ${repoArgs.length} repositories. Only the first repository (${repoArgs[0]}) will be watched.`
@@ -228,9 +264,28 @@ async function indexRepos(
 
   const concurrency = parsePositiveInt('concurrency', options.concurrency, 2);
   const batchSize = parsePositiveInt('batch-size', options.batchSize, 100);
+  const maxInFlightChunks = parsePositiveInt(
+    'max-in-flight-chunks',
+    options.maxInFlightChunks,
+    indexingConfig.maxInFlightChunks
+  );
   const deleteDocumentsPageSize = parsePositiveInt('delete-documents-page-size', options.deleteDocumentsPageSize, 500);
   const parseConcurrency = parsePositiveInt('parse-concurrency', options.parseConcurrency, DEFAULT_PARSE_CONCURRENCY);
+  const embeddingBatchSize = parsePositiveInt(
+    'embedding-batch-size',
+    options.embeddingBatchSize,
+    embeddingConfig.batchSize
+  );
+  const embeddingConcurrency = parsePositiveInt(
+    'embedding-concurrency',
+    options.embeddingConcurrency,
+    embeddingConfig.concurrency
+  );
   const githubToken = options.githubToken ?? appConfig.githubToken;
+  const dedupThreshold = (options.dedup ?? indexingConfig.dedup) ? indexingConfig.dedupThreshold : undefined;
+  // Fails on a mistyped template field or chunk strategy before any repository is walked
+  const embedTemplate = parseEmbedTemplate(embeddingConfig.template);
+  parseChunkStrategies(indexingConfig.chunkStrategies ?? []);
 
   let languages = options.languages ?? appConfig.languages;
   if (languages !== undefined && languages.trim().length === 0) {
@@ -248,8 +303,10 @@ async function indexRepos(
   }
   const isSingleRepo = repoArgs.length === 1;
   const failedRepos: string[] = [];
+  const dryRunReports: Array<{ repoName: string; report: DryRunReport }> = [];
 
   for (let i = 0; i < repoArgs.length; i++) {
+    throwIfCancelled(options.signal);
     const repoArg = repoArgs[i];
     const config = parseRepoArg(repoArg, options.branch);
     const isFirstRepo = i === 0;
@@ -298,12 +355,31 @@ async function indexRepos(
       }
     }
 
-    // Step 4: Determine git branch
-    let gitBranch = config.branch;
+    // Step 4: With --ref, check out the ref in a temporary worktree and index that instead
+    let checkout: RefCheckout | undefined;
+    try {
+      if (options.ref) {
+        checkout = checkoutRef(config.repoPath, options.ref);
+      } else if (isBareRepository(config.repoPath)) {
+        throw new Error(`Repository at ${config.repoPath} is bare; pass --ref to index one of its branches or tags.`);
+      }
+    } catch (error) {
+      const errorMessage = error instanceof Error ? error.message : 'Checkout failed';
+      logger.error(`Cannot index ${config.repoName}.`, { error: errorMessage });
+      if (isSingleRepo) {
+        throw error;
+      }
+      failedRepos.push(config.repoName);
+      continue;
+    }
+    const repoPath = checkout?.path ?? config.repoPath;
+
+    // Step 5: Determine git branch; a ref is recorded under its commit SHA unless --branch is given
+    let gitBranch = config.branch ?? checkout?.commit;
     if (!gitBranch) {
       try {
         gitBranch = execFileSync('git', ['rev-parse', '--abbrev-ref', 'HEAD'], {
-          cwd: config.repoPath,
+          cwd: repoPath,
         })
           .toString()
           .trim();
@@ -314,6 +390,9 @@ async function indexRepos(
     }
 
     const queueDir = path.join(appConfig.queueBaseDir, config.repoName);
+    // One tracker per repository, so the worker continues the file and chunk counts of the producer
+    const consoleProgress = createConsoleProgress();
+    const progress = new ProgressTracker(consoleProgress.onProgress);
 
     const producerOptions = {
       queueDir,
@@ -322,6 +401,12 @@ async function indexRepos(
       branch: gitBranch,
       parseConcurrency,
       languages,
+      gitignore: options.gitignore,
+      include: options.include ?? indexingConfig.include,
+      exclude: options.exclude ?? indexingConfig.exclude,
+      strict: options.strict,
+      signal: options.signal,
+      progress,
     };
     const incrementalOptions = {
       ...producerOptions,
@@ -333,21 +418,54 @@ async function indexRepos(
       repoName: config.repoName,
       branch: gitBranch,
       batchSize,
+      maxInFlightChunks,
+      embeddingBatchSize,
+      embeddingConcurrency,
+      embedCache: options.embedCache,
+      embedTemplate,
+      force: options.force,
+      dedupThreshold,
+      signal: options.signal,
+      progress,
     };
 
     try {
-      const { getLastIndexedCommit, updateLastIndexedCommit, createSettingsIndex } = await import(
-        '../utils/elasticsearch'
-      );
-      const lastCommitHashAtStart = await getLastIndexedCommit(gitBranch, config.indexName);
+      if (options.dryRun) {
+        // Stops after parsing: the queue and the store are not opened
+        const report = await dryRunIndex(repoPath, {
+          repoName: config.repoName,
+          branch: gitBranch,
+          languages,
+          gitignore: options.gitignore,
+          include: producerOptions.include,
+          exclude: producerOptions.exclude,
+          strict: options.strict,
+          embedTemplate,
+          signal: options.signal,
+          progress,
+        });
+        dryRunReports.push({ repoName: config.repoName, report });
+        logger.info(`--- Finished dry run for: ${config.repoName} ---`);
+        continue;
+      }
+
+      const { createChunkStore } = await import('../utils/chunk_store');
+      const store = createChunkStore(config.indexName);
+      // Repositories sharing an index each record their own commits
+      const commitKey = getCommitKey(gitBranch, config.repoName);
+      const lastCommitHashAtStart = await store.getLastIndexedCommit(commitKey);
       let isResumingQueue = false;
       let enqueueCommitHashFromQueue: string | null = null;
 
-      // Step 5: Decide what to do based on flags and queue state
+      // Step 6: Decide what to do based on flags and queue state
       if (options.clean) {
         // Full clean reindex
         logger.info(`Running clean reindex for ${config.repoName}...`);
-        await indexRepo(config.repoPath, true, producerOptions);
+        await indexRepo(repoPath, true, producerOptions);
+      } else if (options.force) {
+        // Full reindex that re-parses every file, ignoring recorded content hashes
+        logger.info(`Running forced full index for ${config.repoName}...`);
+        await indexRepo(repoPath, false, { ...producerOptions, force: true });
       } else if (hasQueueItems(config.repoName)) {
         // Queue has items - check if enqueue was completed
         const queueDbPath = path.join(appConfig.queueBaseDir, config.repoName, 'queue.db');
@@ -366,7 +484,7 @@ async function indexRepos(
           logger.info(`Queue has pending items but enqueue was not completed for ${config.repoName}.`);
           logger.info(`Clearing partial queue and re-enqueueing from scratch...`);
           await queue.clear();
-          await indexRepo(config.repoPath, false, producerOptions);
+          await indexRepo(repoPath, false, producerOptions);
         } else {
           // Normal resume - enqueue completed, just process the queue
           logger.info(`Queue has pending items for ${config.repoName}. Resuming...`);
@@ -377,15 +495,15 @@ async function indexRepos(
         if (lastCommitHashAtStart) {
           // Previous index exists - do incremental
           logger.info(`Running incremental index for ${config.repoName}...`);
-          await incrementalIndex(config.repoPath, incrementalOptions);
+          await incrementalIndex(repoPath, incrementalOptions);
         } else {
           // No previous index - do full index
           logger.info(`No previous index found for ${config.repoName}. Running full index...`);
-          await indexRepo(config.repoPath, false, producerOptions);
+          await indexRepo(repoPath, false, producerOptions);
         }
       }
 
-      // Step 6: Run worker
+      // Step 7: Run worker
       if (shouldWatch) {
         logger.info(`Running worker for ${config.repoName} with concurrency ${concurrency} (watch mode enabled)...`);
         logger.info(`Watching queue for ${config.repoName}. Worker will continue running...`);
@@ -395,12 +513,12 @@ async function indexRepos(
       await worker(concurrency, shouldWatch, workerOptions);
 
       if (!shouldWatch) {
-        // Step 7: If we resumed an existing queue, ensure we catch up to current HEAD before
+        // Step 8: If we resumed an existing queue, ensure we catch up to current HEAD before
         // advancing the settings commit hash. Otherwise incremental diffing can be skipped on
         // subsequent runs (settings would incorrectly claim we've indexed to HEAD).
         let currentHead: string | null = null;
         try {
-          currentHead = execFileSync('git', ['rev-parse', 'HEAD'], { cwd: config.repoPath }).toString().trim();
+          currentHead = execFileSync('git', ['rev-parse', 'HEAD'], { cwd: repoPath }).toString().trim();
         } catch (error) {
           logger.warn(`Failed to read git HEAD for ${config.repoName}; skipping settings commit update.`, {
             error: error instanceof Error ? error.message : String(error),
@@ -409,6 +527,7 @@ async function indexRepos(
 
         if (!currentHead) {
           // Nothing more to do if we cannot identify the commit hash to persist.
+          await store.close();
           logger.info(`--- Finished processing for: ${config.repoName} ---`);
           continue;
         }
@@ -426,30 +545,34 @@ async function indexRepos(
           } else if (baselineCommit !== currentHead) {
             // If settings commit was missing but we have a queue baseline, persist it so incrementalIndex can run.
             if (!lastCommitHashAtStart && enqueueCommitHashFromQueue) {
-              await createSettingsIndex(config.indexName);
-              await updateLastIndexedCommit(gitBranch, enqueueCommitHashFromQueue, config.indexName);
+              await store.updateLastIndexedCommit(commitKey, enqueueCommitHashFromQueue);
             }
 
             logger.info(
               `Detected HEAD advanced since last indexed commit (${baselineCommit} -> ${currentHead}). Running incremental catch-up...`
             );
-            await incrementalIndex(config.repoPath, incrementalOptions);
+            await incrementalIndex(repoPath, incrementalOptions);
             await worker(concurrency, false, workerOptions);
           }
         }
 
-        // Step 8: Update last indexed commit after all indexing work completes successfully.
+        // Step 9: Update last indexed commit after all indexing work completes successfully.
         try {
-          await createSettingsIndex(config.indexName);
-          await updateLastIndexedCommit(gitBranch, currentHead, config.indexName);
+          await store.updateLastIndexedCommit(commitKey, currentHead);
           logger.info(`Updated last indexed commit to ${currentHead} for branch ${gitBranch}`);
         } catch (error) {
           logger.warn(`Failed to update last indexed commit: ${error instanceof Error ? error.message : error}`);
         }
       }
 
+      await store.close();
       logger.info(`--- Finished processing for: ${config.repoName} ---`);
     } catch (error: unknown) {
+      if (error instanceof IndexingCancelledError) {
+        // The last indexed commit was not advanced, so the next run resumes the queue or re-diffs.
+        logger.warn(`Indexing of ${config.repoName} was cancelled before it completed.`);
+        throw error;
+      }
       const errorMessage = error instanceof Error ? error.message : 'An unknown error occurred';
       const errorStack = error instanceof Error ? error.stack : undefined;
       logger.error(`Failed to process repository ${config.repoName}`, {
@@ -460,10 +583,16 @@ async function indexRepos(
         throw error;
       }
       failedRepos.push(config.repoName);
+    } finally {
+      consoleProgress.stop();
+      checkout?.remove();
     }
   }
 
   logger.info('All repositories processed.');
+  for (const { repoName, report } of dryRunReports) {
+    printDryRunReport(repoName, report);
+  }
 
   // Flush OpenTelemetry logs before exiting
   await shutdown();
@@ -475,10 +604,22 @@ async function indexRepos(
   }
 }
 
+/**
+ * Accumulates a repeatable, comma-separated pattern option into a list.
+ */
+export function collectPatterns(value: string, previous: string[] | undefined): string[] {
+  const patterns = value
+    .split(',')
+    .map((pattern) => pattern.trim())
+    .filter((pattern) => pattern.length > 0);
+  return [...(previous ?? []), ...patterns];
+}
+
 export const indexCommand = new Command('index')
   .description('Index one or more repositories')
   .argument('[repos...]', 'Repository names, paths, or URLs (format: repo[:index]).')
   .addOption(new Option('--clean', 'Delete index and reindex all files (full rebuild)'))
+  .addOption(new Option('--force', 'Re-parse all files, ignoring content hashes recorded in the index'))
   .addOption(new Option('--pull', 'Git pull before indexing'))
   .addOption(
     new Option(
@@ -491,6 +632,12 @@ export const indexCommand = new Command('index')
     new Option('--concurrency <number>', 'Number of concurrent Elasticsearch indexing worker threads').default('2')
   )
   .addOption(new Option('--batch-size <number>', 'Number of chunks per Elasticsearch bulk request').default('100'))
+  .addOption(
+    new Option(
+      '--max-in-flight-chunks <number>',
+      'Most chunks held in memory between parsing and storing (default: SCS_IDXR_MAX_IN_FLIGHT_CHUNKS or 1000)'
+    )
+  )
   .addOption(
     new Option(
       '--delete-documents-page-size <number>',
@@ -502,18 +649,69 @@ export const indexCommand = new Command('index')
       `${DEFAULT_PARSE_CONCURRENCY}`
     )
   )
+  .addOption(
+    new Option(
+      '--embedding-batch-size <number>',
+      'Number of chunks per embedding request when a client-side embedder is configured (default: 64)'
+    )
+  )
+  .addOption(
+    new Option(
+      '--embedding-concurrency <number>',
+      'Number of parallel embedding requests when a client-side embedder is configured (default: 2)'
+    )
+  )
+  .addOption(new Option('--no-embed-cache', 'Embed every chunk instead of reusing vectors from the embedding cache'))
   .addOption(
     new Option(
       '--languages <names>',
       'Comma-separated list of languages to index (default: SCS_IDXR_LANGUAGES if set, otherwise all languages)'
     )
   )
-  .addOption(new Option('--branch <branch>', 'Branch name for logging/metadata (default: auto-detect)'))
+  .addOption(new Option('--no-gitignore', 'Index files even if they are matched by .gitignore files'))
+  .addOption(
+    new Option(
+      '--include <patterns>',
+      'Only index files matching these comma-separated .gitignore-style patterns (repeatable, or SCS_IDXR_INCLUDE)'
+    ).argParser(collectPatterns)
+  )
+  .addOption(
+    new Option(
+      '--exclude <patterns>',
+      'Skip files matching these comma-separated .gitignore-style patterns (repeatable, or SCS_IDXR_EXCLUDE)'
+    ).argParser(collectPatterns)
+  )
+  .addOption(
+    new Option('--strict', 'Fail at the first file that cannot be parsed cleanly instead of skipping or degrading it')
+  )
+  .addOption(
+    new Option(
+      '--ref <ref>',
+      'Index this branch, tag, or commit via a temporary worktree, leaving the working tree untouched'
+    )
+  )
+  .addOption(
+    new Option('--dedup', 'Fold duplicate and near-duplicate chunks into one canonical chunk before embedding')
+  )
+  .addOption(
+    new Option('--dry-run', 'Walk and parse, then report the files, chunks, and tokens that would be embedded')
+  )
+  .addOption(
+    new Option('--branch <branch>', 'Branch name for logging/metadata (default: auto-detect, or the --ref commit SHA)')
+  )
+  // Options after a subcommand such as `delete` or `reindex` belong to it, e.g. its own --branch
+  .enablePositionalOptions()
+  .addCommand(deletePathCommand)
+  .addCommand(reindexPathCommand)
+  .addCommand(exportArchiveCommand)
+  .addCommand(importArchiveCommand)
   .action(async (repos, options) => {
     try {
-      await indexRepos(repos, options);
+      await indexRepos(repos, { ...options, signal: startCancellableRun() });
     } catch (error) {
-      logger.error('Fatal error in index command', { error });
+      if (!(error instanceof IndexingCancelledError)) {
+        logger.error('Fatal error in index command', { error });
+      }
       await shutdown();
       throw error;
     }
@@ -1,13 +1,231 @@
 import { Command, Option } from 'commander';
-import { getLocationsForChunkIds, indexHasSemanticTextField, searchCodeChunks } from '../utils/elasticsearch';
+import fs from 'fs';
+import path from 'path';
+import {
+  DEFAULT_HYBRID_ALPHA,
+  FUSION_METHODS,
+  FusionMethod,
+  SEARCH_MODES,
+  SearchMode,
+  SearchSignal,
+} from '../utils/hybrid_search';
+import { languageConfigurations } from '../languages';
+import { SearchFilters } from '../utils/search_filters';
+import {
+  SEARCH_SORTS,
+  ScoreExplanation,
+  SearchHit,
+  SearchHitLocation,
+  SearchSort,
+  trimSnippet,
+} from '../utils/search';
+import { SymbolHit } from '../utils/symbol_search';
+import { consoleLogSink } from '../utils/logger';
+import { createIndex } from '../lib';
+
+export { gitBlobHash, trimSnippet } from '../utils/search';
+export type { ScoreExplanation, SearchHit } from '../utils/search';
+export type { SymbolHit } from '../utils/symbol_search';
+
+const PRETTY_SNIPPET_MAX_LINES = 12;
+
+/** What the raw score of each signal is, for `--explain`. */
+const SIGNAL_SCORE_NAMES: Record<SearchSignal, string> = { semantic: 'similarity', keyword: 'bm25' };
+
+export type SearchOutputFormat = 'pretty' | 'json';
+
+export interface SearchOptions {
+  index: string;
+  limit?: string;
+  minScore?: string;
+  format?: SearchOutputFormat;
+  /** Number of lines before and after each chunk to read from the working tree (default: 0). */
+  contextLines?: string;
+  /** Repository checkout that indexed paths are relative to (default: current directory). */
+  root?: string;
+  /** Retrieval signal(s) to rank by (default: semantic). */
+  mode?: SearchMode;
+  /** Weight of the semantic signal in hybrid mode, in [0, 1] (default: 0.5). */
+  alpha?: string;
+  /** How hybrid mode combines the two rankings (default: rrf). */
+  fusion?: FusionMethod;
+  /** Only return chunks of this language. */
+  lang?: string;
+  /** Only return chunks with a location under this path prefix or matching this glob. */
+  path?: string;
+  /** Only return chunks of this kind: `func`, `type`, `const`, or a tree-sitter node type. */
+  kind?: string;
+  /** Only return chunks with a location in this workspace. */
+  workspace?: string;
+  /** Append the words of compound identifiers in the query to the embedded text. */
+  expandQuery?: boolean;
+  /** Rescore the top candidates with the reranker selected via SCS_IDXR_RERANKER. */
+  rerank?: boolean;
+  /** Candidates retrieved for the reranker (default: SCS_IDXR_RERANK_CANDIDATES or 50). */
+  rerankCandidates?: string;
+  /** Order of the results: best match first, or most recently changed first (default: score). */
+  sort?: SearchSort;
+  /** Only return results whose lines were last changed on or after this date. */
+  changedSince?: string;
+  /** Candidates retrieved per result when a filter is applied after retrieval (default: 10). */
+  overfetchFactor?: string;
+  /** Look up the definitions of symbols named like this instead of searching by a query. */
+  symbol?: string;
+  /** Show how the score of each result was computed. */
+  explain?: boolean;
+  /** Find code similar to these lines, given as `<file>:<start>-<end>`, instead of searching by a query. */
+  similarTo?: string;
+}
+
+function formatLocation(hit: Pick<SearchHit, 'filePath' | 'startLine' | 'endLine'>): string {
+  if (!hit.filePath) {
+    return '(unknown location)';
+  }
+  if (hit.startLine === null) {
+    return hit.filePath;
+  }
+  if (hit.endLine === null || hit.endLine === hit.startLine) {
+    return `${hit.filePath}:${hit.startLine}`;
+  }
+  return `${hit.filePath}:${hit.startLine}-${hit.endLine}`;
+}
+
+/**
+ * Describes how a score was computed, one line per step: what each signal contributed (in hybrid mode
+ * also the signal that did not find the hit), the retrieval score, the reranker's score, and the result.
+ */
+function formatExplanation(explain: ScoreExplanation): string[] {
+  const signals: SearchSignal[] = explain.mode === 'hybrid' ? ['semantic', 'keyword'] : [explain.mode];
+  const lines = signals.map((signal) => {
+    const found = explain.signals.find((contribution) => contribution.signal === signal);
+    if (!found) {
+      return `${signal}: not found -> 0`;
+    }
+    const { rawScore, rank, weight, contribution } = found;
+    return (
+      `${signal}: ${SIGNAL_SCORE_NAMES[signal]} ${rawScore.toFixed(4)} at rank ${rank}, ` +
+      `weight ${weight.toFixed(2)} -> ${contribution.toFixed(4)}`
+    );
+  });
+  const method = explain.fusion ? `${explain.mode}, ${explain.fusion}` : explain.mode;
+  lines.push(`retrieval score: ${explain.retrievalScore.toFixed(4)} (${method})`);
+  if (explain.rerankScore !== null) {
+    lines.push(`reranker score: ${explain.rerankScore.toFixed(4)}`);
+  }
+  lines.push(`final score: ${explain.score.toFixed(4)}`);
+  return lines;
+}
 
 /**
- * Search command - performs semantic search on indexed code
+ * Reads the code `--similar-to` names: lines `<start>` to `<end>` of `<file>`, or the one line of
+ * `<file>:<line>`. A relative file is resolved against `root`, like the paths in the results.
  */
-export async function search(query: string, options: { index: string; limit?: string }) {
-  console.log(`Searching for: "${query}"`);
+function readSimilarTo(value: string, root: string): { code: string; location: SearchHitLocation } {
+  const match = value.match(/^(.+):(\d+)(?:-(\d+))?$/);
+  const startLine = match ? Number(match[2]) : NaN;
+  const endLine = match?.[3] !== undefined ? Number(match[3]) : startLine;
+  if (!match || startLine <= 0 || endLine < startLine) {
+    throw new Error(
+      `Invalid --similar-to value: ${value}. Must be <file>:<start>-<end> with 1 <= start <= end, e.g. src/a.ts:10-20.`
+    );
+  }
+  const filePath = path.resolve(root, match[1]);
+  let lines: string[];
+  try {
+    lines = fs.readFileSync(filePath, 'utf8').replace(/\r\n/g, '\n').split('\n');
+  } catch (error) {
+    throw new Error(`Cannot read --similar-to file ${match[1]}: ${(error as Error).message}`);
+  }
+  const code = lines.slice(startLine - 1, endLine).join('\n');
+  if (code.trim() === '') {
+    throw new Error(`Invalid --similar-to value: ${value}. Lines ${startLine}-${endLine} of the file are empty.`);
+  }
+  return { code, location: { filePath, startLine, endLine } };
+}
+
+function printPretty(heading: string, hits: SearchHit[], showSignals: boolean): void {
+  console.log(heading);
+  if (hits.length === 0) {
+    console.log('No results found.');
+    return;
+  }
+
+  // Name the workspace of each hit once the results come from more than one
+  const showWorkspaces = new Set(hits.map((hit) => hit.workspace)).size > 1;
+  hits.forEach((hit, i) => {
+    const location = `${showWorkspaces ? `[${hit.workspace ?? '(unlabeled)'}] ` : ''}${formatLocation(hit)}`;
+    const label = [hit.kind, hit.symbol].filter((part): part is string => Boolean(part)).join(' ');
+    const signals = showSignals ? `  [${hit.signals.join('+')}]` : '';
+    const stale = hit.stale ? '  [stale: file changed since indexing]' : '';
+    const score = hit.score.toFixed(showSignals ? 4 : 2);
+
+    console.log('');
+    console.log(`${i + 1}. ${location}  (score: ${score})${label ? `  ${label}` : ''}${signals}${stale}`);
+    const otherLocations = hit.locations.filter((l) => l.filePath !== hit.filePath || l.startLine !== hit.startLine);
+    if (otherLocations.length > 0) {
+      console.log(`   also in: ${otherLocations.map(formatLocation).join(', ')}`);
+    }
+    if (hit.blame) {
+      const date = hit.blame.date.slice(0, 10);
+      console.log(`   last changed: ${date} by ${hit.blame.author} (${hit.blame.commit.slice(0, 12)})`);
+    }
+    if (hit.explain) {
+      formatExplanation(hit.explain).forEach((line) => console.log(`   ${line}`));
+    }
+    console.log('-'.repeat(80));
+    hit.contextBefore?.forEach((line) => console.log(`  | ${line.trimEnd()}`));
+    console.log(
+      trimSnippet(hit.snippet, PRETTY_SNIPPET_MAX_LINES)
+        .split('\n')
+        .map((line) => `    ${line}`)
+        .join('\n')
+    );
+    hit.contextAfter?.forEach((line) => console.log(`  | ${line.trimEnd()}`));
+  });
+
+  console.log('');
+  console.log(`Total results: ${hits.length}`);
+}
+
+function printSymbols(name: string, hits: SymbolHit[]): void {
+  console.log(`Symbols matching: "${name}"`);
+  if (hits.length === 0) {
+    console.log('No symbols found.');
+    return;
+  }
+
+  console.log('');
+  const showWorkspaces = new Set(hits.map((hit) => hit.workspace)).size > 1;
+  hits.forEach((hit, i) => {
+    const workspace = showWorkspaces ? `[${hit.workspace ?? '(unlabeled)'}] ` : '';
+    const location = formatLocation({ filePath: hit.filePath, startLine: hit.line, endLine: hit.line });
+    const container = hit.containerPath ? `  in ${hit.containerPath}` : '';
+    console.log(
+      `${i + 1}. ${hit.symbol} (${hit.kind})${container}  ${workspace}${location}  ` +
+        `(${hit.match}, score: ${hit.score.toFixed(2)})`
+    );
+  });
 
+  console.log('');
+  console.log(`Total results: ${hits.length}`);
+}
+
+/**
+ * Search command - performs semantic search on indexed code, looks up symbols with `--symbol`, or finds
+ * code similar to a range of lines with `--similar-to`
+ */
+export async function search(query: string | undefined, options: SearchOptions) {
   const indexName = options.index;
+  const symbol = options.symbol?.trim();
+  if (symbol !== undefined && query !== undefined) {
+    throw new Error('Pass either a query or --symbol, not both.');
+  }
+  if (options.similarTo !== undefined && (symbol !== undefined || query !== undefined)) {
+    throw new Error('Pass --similar-to without a query or --symbol.');
+  }
+  if (!symbol && options.similarTo === undefined && !query?.trim()) {
+    throw new Error('Pass a query, or a symbol name with --symbol or lines with --similar-to.');
+  }
 
   const parsedLimit = options.limit ? Number(options.limit) : 10;
   if (!Number.isInteger(parsedLimit) || parsedLimit <= 0) {
@@ -15,58 +233,140 @@ export async function search(query: string, options: { index: string; limit?: st
   }
   const limit = parsedLimit;
 
-  const semanticTextEnabled = await indexHasSemanticTextField(indexName);
-  if (!semanticTextEnabled) {
+  const minScore = options.minScore !== undefined ? Number(options.minScore) : undefined;
+  if (minScore !== undefined && !Number.isFinite(minScore)) {
+    throw new Error(`Invalid --min-score value: ${options.minScore}. Must be a number.`);
+  }
+
+  const contextLines = options.contextLines !== undefined ? Number(options.contextLines) : 0;
+  if (!Number.isInteger(contextLines) || contextLines < 0) {
+    throw new Error(`Invalid --context-lines value: ${options.contextLines}. Must be a non-negative integer.`);
+  }
+  const root = path.resolve(options.root ?? process.cwd());
+  const similarTo = options.similarTo !== undefined ? readSimilarTo(options.similarTo.trim(), root) : undefined;
+
+  const mode = options.mode ?? 'semantic';
+  if (!SEARCH_MODES.includes(mode)) {
+    throw new Error(`Invalid --mode value: ${mode}. Must be one of: ${SEARCH_MODES.join(', ')}.`);
+  }
+  const fusion = options.fusion ?? 'rrf';
+  if (!FUSION_METHODS.includes(fusion)) {
+    throw new Error(`Invalid --fusion value: ${fusion}. Must be one of: ${FUSION_METHODS.join(', ')}.`);
+  }
+  const alpha = options.alpha !== undefined ? Number(options.alpha) : DEFAULT_HYBRID_ALPHA;
+  if (options.alpha !== undefined && (options.alpha.trim() === '' || !(alpha >= 0 && alpha <= 1))) {
+    throw new Error(`Invalid --alpha value: ${options.alpha}. Must be a number between 0 and 1.`);
+  }
+
+  const language = options.lang?.trim().toLowerCase();
+  if (language !== undefined && !(language in languageConfigurations)) {
     throw new Error(
-      `Index "${indexName}" does not have a "semantic_text" mapping, so semantic search cannot run. ` +
-        'This usually happens when the index was created with semantic text disabled. ' +
-        'Recreate the index with semantic text enabled and reindex your code, or use a non-semantic search command.'
+      `Invalid --lang value: ${options.lang}. Must be one of: ${Object.keys(languageConfigurations).join(', ')}.`
     );
   }
+  const filters: SearchFilters = {
+    ...(language ? { language } : {}),
+    ...(options.path?.trim() ? { path: options.path.trim() } : {}),
+    ...(options.kind?.trim() ? { kind: options.kind.trim() } : {}),
+    ...(options.workspace?.trim() ? { workspace: options.workspace.trim() } : {}),
+  };
 
-  const results = await searchCodeChunks(query, indexName, limit);
-
-  console.log(`\nSearch results (showing top ${Math.min(limit, results.length)} of ${results.length}):`);
+  const rerankCandidates = options.rerankCandidates !== undefined ? Number(options.rerankCandidates) : undefined;
+  if (rerankCandidates !== undefined && (!Number.isInteger(rerankCandidates) || rerankCandidates <= 0)) {
+    throw new Error(`Invalid --rerank-candidates value: ${options.rerankCandidates}. Must be a positive integer.`);
+  }
 
-  if (results.length === 0) {
-    console.log('No results found.');
-    return;
+  const sort = options.sort ?? 'score';
+  if (!SEARCH_SORTS.includes(sort)) {
+    throw new Error(`Invalid --sort value: ${sort}. Must be one of: ${SEARCH_SORTS.join(', ')}.`);
+  }
+  const changedSince = options.changedSince !== undefined ? new Date(options.changedSince) : undefined;
+  if (changedSince !== undefined && Number.isNaN(changedSince.getTime())) {
+    throw new Error(`Invalid --changed-since value: ${options.changedSince}. Must be a date, e.g. 2024-06-01.`);
   }
+  const overfetchFactor = options.overfetchFactor !== undefined ? Number(options.overfetchFactor) : undefined;
+  if (overfetchFactor !== undefined && !(overfetchFactor >= 1 && Number.isFinite(overfetchFactor))) {
+    throw new Error(`Invalid --overfetch-factor value: ${options.overfetchFactor}. Must be a number of at least 1.`);
+  }
+
+  const format = options.format ?? 'pretty';
 
-  const visible = results.slice(0, limit);
-  const locationsByChunkId = await getLocationsForChunkIds(
-    visible.map((r) => r.id),
-    { index: indexName, perChunkLimit: 5 }
-  );
-
-  visible.forEach((result, index) => {
-    console.log('\n' + '='.repeat(80));
-    console.log(`Result #${index + 1} (Score: ${result.score.toFixed(2)})`);
-    console.log('='.repeat(80));
-    const locations = locationsByChunkId[result.id] ?? [];
-    if (locations.length > 0) {
-      console.log(`Locations (sample): ${locations.length}`);
-      locations.forEach((p) => {
-        console.log(`- ${p.filePath}:${p.startLine}-${p.endLine}`);
-      });
+  const index = await createIndex({ index: indexName, root, logger: consoleLogSink });
+  if (symbol) {
+    let symbols: SymbolHit[];
+    try {
+      symbols = await index.findSymbols(symbol, { limit, filters });
+    } finally {
+      await index.close();
     }
-    if (result.kind) {
-      console.log(`Kind: ${result.kind}`);
+    if (format === 'json') {
+      console.log(JSON.stringify(symbols, null, 2));
+      return;
     }
-    console.log('\nContent:');
-    console.log('-'.repeat(80));
-    console.log(result.content);
-  });
+    printSymbols(symbol, symbols);
+    return;
+  }
 
-  console.log('\n' + '='.repeat(80));
-  console.log(`Total results: ${results.length}`);
+  let hits: SearchHit[];
+  try {
+    const searchOptions = {
+      limit,
+      minScore,
+      mode,
+      alpha,
+      fusion,
+      filters,
+      contextLines,
+      expandQuery: options.expandQuery ?? false,
+      rerank: options.rerank ?? false,
+      rerankCandidates,
+      sort,
+      changedSince,
+      overfetchFactor,
+      explain: options.explain ?? false,
+    };
+    hits = similarTo
+      ? await index.searchSimilar(similarTo.code, { ...searchOptions, exclude: similarTo.location })
+      : await index.search(query ?? '', searchOptions);
+  } finally {
+    await index.close();
+  }
+
+  if (format === 'json') {
+    console.log(JSON.stringify(hits, null, 2));
+    return;
+  }
+  const heading = similarTo ? `Code similar to: ${options.similarTo?.trim()}` : `Search results for: "${query ?? ''}"`;
+  printPretty(heading, hits, mode === 'hybrid');
 }
 
 export const searchCommand = new Command('search')
-  .description('Search indexed code using semantic search')
-  .argument('<query>', 'Search query (natural language)')
-  .addOption(new Option('--index <index>', 'Elasticsearch index to search (required)').makeOptionMandatory())
+  .description('Search indexed code using semantic, keyword, or hybrid search, look up symbols, or find similar code')
+  .argument('[query]', 'Search query (natural language); omit with --symbol or --similar-to')
+  .addOption(new Option('--index <index>', 'Index to search (required)').makeOptionMandatory())
   .addOption(new Option('--limit <number>', 'Maximum number of results to display').default('10'))
+  .addOption(new Option('--min-score <number>', 'Drop results scoring below this value'))
+  .addOption(new Option('--format <format>', 'Output format').choices(['pretty', 'json']).default('pretty'))
+  .addOption(new Option('--mode <mode>', 'Retrieval signal to rank by').choices(SEARCH_MODES).default('semantic'))
+  .addOption(new Option('--alpha <number>', 'Weight of the semantic signal in hybrid mode, from 0 to 1').default('0.5'))
+  .addOption(
+    new Option('--fusion <method>', 'How hybrid mode combines the two rankings').choices(FUSION_METHODS).default('rrf')
+  )
+  .addOption(new Option('--lang <language>', 'Only return results in this language (e.g. go)'))
+  .addOption(new Option('--path <pattern>', 'Only return results under this path prefix or matching this glob'))
+  .addOption(new Option('--kind <kind>', 'Only return results of this kind: func, type, const, or a node type'))
+  .addOption(new Option('--workspace <name>', 'Only return results from this workspace (see "workspaces")'))
+  .addOption(new Option('--symbol <name>', 'Look up definitions of symbols named like this (exact, prefix, fuzzy)'))
+  .addOption(new Option('--similar-to <file:start-end>', 'Find code similar to these lines instead of a query'))
+  .addOption(new Option('--expand-query', 'Also embed the words of identifiers in the query (ParseJSONConfig)'))
+  .addOption(new Option('--rerank', 'Rescore the top candidates with the reranker set by SCS_IDXR_RERANKER'))
+  .addOption(new Option('--rerank-candidates <number>', 'Candidates to rescore with --rerank (default: 50)'))
+  .addOption(new Option('--sort <order>', 'Order of the results').choices(SEARCH_SORTS).default('score'))
+  .addOption(new Option('--changed-since <date>', 'Only return results last changed on or after this date (blame)'))
+  .addOption(new Option('--overfetch-factor <number>', 'Candidates per result for filters applied after retrieval'))
+  .addOption(new Option('--explain', 'Show how each score was computed: signal scores, fusion weights, reranker'))
+  .addOption(new Option('--context-lines <number>', 'Lines of context to show before and after each result'))
+  .addOption(new Option('--root <path>', 'Repository checkout to read context lines from (default: current directory)'))
   .action(async (query, options) => {
     try {
       await search(query, options);
@@ -0,0 +1,247 @@
+import { Command, Option } from 'commander';
+import http from 'http';
+import path from 'path';
+import { timingSafeEqual } from 'crypto';
+import { SEARCH_MODES, SearchMode } from '../utils/hybrid_search';
+import { SearchFilters } from '../utils/search_filters';
+import { consoleLogSink, logger } from '../utils/logger';
+import { Index, createIndex } from '../lib';
+import { serveConfig } from '../config';
+
+/** Largest request body accepted by `POST /search`. */
+const MAX_REQUEST_BODY_BYTES = 1024 * 1024;
+
+const FILTER_FIELDS: (keyof SearchFilters)[] = ['language', 'path', 'kind', 'workspace'];
+
+export interface ServeOptions {
+  index: string;
+  /** Address to bind to (default: SCS_IDXR_SERVE_HOST or 127.0.0.1). */
+  host?: string;
+  /** Port to listen on; 0 picks a free port (default: SCS_IDXR_SERVE_PORT or 3000). */
+  port?: string;
+  /** Milliseconds a request may take (default: SCS_IDXR_SERVE_REQUEST_TIMEOUT_MS or 30000). */
+  requestTimeout?: string;
+  /** Repository checkout that indexed paths are relative to (default: current directory). */
+  root?: string;
+}
+
+export interface SearchServerOptions {
+  /** Milliseconds a request may take; a search still running then is answered with 503. */
+  requestTimeoutMs: number;
+  /** Bearer token `POST /search` requires; unset accepts every request. */
+  authToken?: string;
+}
+
+/** Body of `POST /search`. */
+export interface SearchRequestBody {
+  query: string;
+  limit?: number;
+  mode?: SearchMode;
+  filters?: SearchFilters;
+}
+
+class HttpError extends Error {
+  constructor(
+    readonly status: number,
+    message: string
+  ) {
+    super(message);
+  }
+}
+
+function sendJson(
+  response: http.ServerResponse,
+  status: number,
+  body: unknown,
+  headers: http.OutgoingHttpHeaders = {}
+): void {
+  if (response.headersSent || response.writableEnded) {
+    return;
+  }
+  response.writeHead(status, { 'Content-Type': 'application/json', ...headers });
+  response.end(JSON.stringify(body));
+}
+
+function isAuthorized(request: http.IncomingMessage, authToken: string): boolean {
+  const match = /^Bearer (.+)$/.exec(request.headers.authorization ?? '');
+  const given = Buffer.from(match?.[1] ?? '');
+  const expected = Buffer.from(authToken);
+  return given.length === expected.length && timingSafeEqual(given, expected);
+}
+
+function readBody(request: http.IncomingMessage): Promise<string> {
+  return new Promise((resolve, reject) => {
+    const chunks: Buffer[] = [];
+    let size = 0;
+    request.on('data', (chunk: Buffer) => {
+      size += chunk.length;
+      if (size > MAX_REQUEST_BODY_BYTES) {
+        reject(new HttpError(413, `Request body exceeds ${MAX_REQUEST_BODY_BYTES} bytes.`));
+        request.destroy();
+        return;
+      }
+      chunks.push(chunk);
+    });
+    request.on('end', () => resolve(Buffer.concat(chunks).toString('utf8')));
+    request.on('error', reject);
+  });
+}
+
+/**
+ * Validates a `POST /search` body.
+ *
+ * @throws HttpError (400) if the body is not a JSON object with a non-empty `query` and valid options.
+ */
+function parseSearchRequestBody(text: string): SearchRequestBody {
+  let body: unknown;
+  try {
+    body = JSON.parse(text);
+  } catch {
+    throw new HttpError(400, 'Request body must be valid JSON.');
+  }
+  if (typeof body !== 'object' || body === null || Array.isArray(body)) {
+    throw new HttpError(400, 'Request body must be a JSON object.');
+  }
+  const { query, limit, mode, filters } = body as Record<string, unknown>;
+  if (typeof query !== 'string' || query.trim() === '') {
+    throw new HttpError(400, '"query" must be a non-empty string.');
+  }
+  if (limit !== undefined && !(typeof limit === 'number' && Number.isInteger(limit) && limit > 0)) {
+    throw new HttpError(400, '"limit" must be a positive integer.');
+  }
+  if (mode !== undefined && !SEARCH_MODES.includes(mode as SearchMode)) {
+    throw new HttpError(400, `"mode" must be one of: ${SEARCH_MODES.join(', ')}.`);
+  }
+  if (filters !== undefined) {
+    if (typeof filters !== 'object' || filters === null || Array.isArray(filters)) {
+      throw new HttpError(400, '"filters" must be an object.');
+    }
+    for (const [field, value] of Object.entries(filters)) {
+      if (!FILTER_FIELDS.includes(field as keyof SearchFilters)) {
+        throw new HttpError(400, `Unknown filter "${field}". Filters are: ${FILTER_FIELDS.join(', ')}.`);
+      }
+      if (typeof value !== 'string') {
+        throw new HttpError(400, `Filter "${field}" must be a string.`);
+      }
+    }
+  }
+  return {
+    query,
+    ...(limit !== undefined && { limit: limit as number }),
+    ...(mode !== undefined && { mode: mode as SearchMode }),
+    ...(filters !== undefined && { filters: filters as SearchFilters }),
+  };
+}
+
+function withTimeout<T>(promise: Promise<T>, timeoutMs: number): Promise<T> {
+  let timer: NodeJS.Timeout | undefined;
+  const timeout = new Promise<never>((_, reject) => {
+    timer = setTimeout(() => reject(new HttpError(503, `Search did not finish within ${timeoutMs} ms.`)), timeoutMs);
+  });
+  return Promise.race([promise, timeout]).finally(() => clearTimeout(timer));
+}
+
+/**
+ * Creates an HTTP server answering `POST /search` from `index` and `GET /healthz`.
+ *
+ * Requests are served concurrently; `Index.search` is safe to call concurrently. `GET /healthz` does
+ * not require the auth token, so load balancers can probe it.
+ */
+export function createSearchServer(index: Pick<Index, 'search'>, options: SearchServerOptions): http.Server {
+  const server = http.createServer(async (request, response) => {
+    const url = new URL(request.url ?? '/', 'http://localhost');
+    try {
+      if (url.pathname === '/healthz') {
+        if (request.method !== 'GET') {
+          throw new HttpError(405, 'Use GET for /healthz.');
+        }
+        sendJson(response, 200, { status: 'ok' });
+        return;
+      }
+      if (url.pathname !== '/search') {
+        throw new HttpError(404, `Not found: ${url.pathname}`);
+      }
+      if (request.method !== 'POST') {
+        throw new HttpError(405, 'Use POST for /search.');
+      }
+      if (options.authToken !== undefined && !isAuthorized(request, options.authToken)) {
+        sendJson(response, 401, { error: 'Missing or invalid bearer token.' }, { 'WWW-Authenticate': 'Bearer' });
+        return;
+      }
+
+      const { query, limit, mode, filters } = parseSearchRequestBody(await readBody(request));
+      const results = await withTimeout(index.search(query, { limit, mode, filters }), options.requestTimeoutMs);
+      sendJson(response, 200, { results });
+    } catch (error) {
+      const status = error instanceof HttpError ? error.status : 500;
+      const message = error instanceof Error ? error.message : String(error);
+      if (status >= 500) {
+        logger.error('Search request failed', { path: url.pathname, status, error: message });
+      }
+      sendJson(response, status, { error: message });
+    }
+  });
+  // Also bounds the time a client may take to send its request
+  server.requestTimeout = options.requestTimeoutMs;
+  return server;
+}
+
+function parsePort(value: string | undefined): number {
+  if (value === undefined) {
+    return serveConfig.port;
+  }
+  const port = Number(value);
+  if (!Number.isInteger(port) || port < 0 || port > 65535) {
+    throw new Error(`Invalid --port value: ${value}. Must be an integer between 0 and 65535.`);
+  }
+  return port;
+}
+
+/**
+ * Serve command - answers search requests over HTTP until the process is stopped
+ */
+export async function serve(options: ServeOptions) {
+  const host = options.host ?? serveConfig.host;
+  const port = parsePort(options.port);
+  const requestTimeoutMs =
+    options.requestTimeout !== undefined ? Number(options.requestTimeout) : serveConfig.requestTimeoutMs;
+  if (!Number.isInteger(requestTimeoutMs) || requestTimeoutMs <= 0) {
+    throw new Error(`Invalid --request-timeout value: ${options.requestTimeout}. Must be a positive integer.`);
+  }
+  const root = path.resolve(options.root ?? process.cwd());
+
+  // Opened once; queries are embedded with the embedder configured for indexing (SCS_IDXR_EMBEDDER)
+  const index = await createIndex({ index: options.index, root, logger: consoleLogSink });
+  const server = createSearchServer(index, { requestTimeoutMs, authToken: serveConfig.authToken });
+  try {
+    await new Promise<void>((resolve, reject) => {
+      server.once('error', reject);
+      server.listen(port, host, resolve);
+    });
+    const address = server.address();
+    logger.info('Serving search requests', {
+      index: options.index,
+      address: typeof address === 'object' && address ? `http://${host}:${address.port}` : host,
+      auth: serveConfig.authToken !== undefined,
+    });
+    await new Promise<void>((resolve) => server.once('close', resolve));
+  } finally {
+    await index.close();
+  }
+}
+
+export const serveCommand = new Command('serve')
+  .description('Serve search requests over HTTP: POST /search and GET /healthz')
+  .addOption(new Option('--index <index>', 'Index to search (required)').makeOptionMandatory())
+  .addOption(new Option('--host <address>', 'Address to bind to (default: SCS_IDXR_SERVE_HOST or 127.0.0.1)'))
+  .addOption(new Option('--port <number>', 'Port to listen on (default: SCS_IDXR_SERVE_PORT or 3000)'))
+  .addOption(new Option('--request-timeout <ms>', 'Time a request may take (default: 30000)'))
+  .addOption(new Option('--root <path>', 'Repository checkout that indexed paths are relative to'))
+  .action(async (options) => {
+    try {
+      await serve(options);
+    } catch (error) {
+      console.error('Serve failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
@@ -0,0 +1,81 @@
+import { Command, Option } from 'commander';
+import { consoleLogSink } from '../utils/logger';
+import { IndexStats, createIndex } from '../lib';
+
+export type StatsOutputFormat = 'pretty' | 'json';
+
+export interface StatsOptions {
+  index: string;
+  format?: StatsOutputFormat;
+}
+
+function formatSize(bytes: number | null): string {
+  if (bytes === null) {
+    return 'unknown';
+  }
+  const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  const i = bytes > 0 ? Math.min(units.length - 1, Math.floor(Math.log(bytes) / Math.log(1024))) : 0;
+  return `${parseFloat((bytes / Math.pow(1024, i)).toFixed(1))} ${units[i]}`;
+}
+
+/** Orders counts by count, largest first, then by name. */
+function sortCounts(counts: Record<string, number>): Record<string, number> {
+  return Object.fromEntries(Object.entries(counts).sort(([a, x], [b, y]) => y - x || a.localeCompare(b)));
+}
+
+function printCounts(title: string, counts: Record<string, number>): void {
+  console.log('');
+  console.log(`${title}:`);
+  const entries = Object.entries(counts);
+  if (entries.length === 0) {
+    console.log('  (none)');
+    return;
+  }
+  const width = Math.max(...entries.map(([name]) => name.length));
+  entries.forEach(([name, count]) => console.log(`  ${name.padEnd(width)}  ${count}`));
+}
+
+function printPretty(indexName: string, stats: IndexStats): void {
+  console.log(`Index: ${indexName}`);
+  console.log(`Store backend:      ${stats.backend}`);
+  console.log(`Files:              ${stats.files}`);
+  console.log(`Chunks:             ${stats.chunks}`);
+  console.log(`Vector dimensions:  ${stats.vectorDimensions ?? 'none'}`);
+  console.log(`Embedder:           ${stats.embedder ?? 'none'}`);
+  console.log(`Size on disk:       ${formatSize(stats.sizeBytes)}`);
+  printCounts('Chunks per language', stats.languages);
+  printCounts('Chunks per kind', stats.kinds);
+}
+
+/**
+ * Stats command - reports what an index holds
+ */
+export async function stats(options: StatsOptions) {
+  const index = await createIndex({ index: options.index, logger: consoleLogSink });
+  let result: IndexStats;
+  try {
+    result = await index.stats();
+  } finally {
+    await index.close();
+  }
+  result = { ...result, languages: sortCounts(result.languages), kinds: sortCounts(result.kinds) };
+
+  if (options.format === 'json') {
+    console.log(JSON.stringify({ index: options.index, ...result }, null, 2));
+    return;
+  }
+  printPretty(options.index, result);
+}
+
+export const statsCommand = new Command('stats')
+  .description('Report the files, chunks per language and kind, vector dimensions, and size of an index')
+  .addOption(new Option('--index <index>', 'Index to report on (required)').makeOptionMandatory())
+  .addOption(new Option('--format <format>', 'Output format').choices(['pretty', 'json']).default('pretty'))
+  .action(async (options) => {
+    try {
+      await stats(options);
+    } catch (error) {
+      console.error('Stats failed:', error);
+      process.exit(1);
+    }
+  });
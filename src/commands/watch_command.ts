@@ -0,0 +1,188 @@
+import { Command, Option } from 'commander';
+import fs from 'fs';
+import path from 'path';
+import simpleGit from 'simple-git';
+import { collectPatterns, parseRepoArg } from './index_command';
+import { parseAndEnqueueFiles } from './incremental_index_command';
+import { worker } from './worker_command';
+import { appConfig } from '../config';
+import { parseLanguageNames } from '../languages';
+import { createChunkStore } from '../utils/chunk_store';
+import { DEFAULT_WATCH_DEBOUNCE_MS, FileChanges, FileChangeWatcher } from '../utils/file_watcher';
+import { createFileFilter, walkFiles } from '../utils/file_walker';
+import { reportIndexErrors } from '../utils/index_errors';
+import { createLanguageFileMatcher } from '../utils/language_detection';
+import { createLogger } from '../utils/logger';
+import { createMetrics } from '../utils/metrics';
+import { SqliteQueue } from '../utils/sqlite_queue';
+import { getCommitKey } from '../utils/workspace';
+
+export interface WatchOptions {
+  debounce?: string;
+  concurrency?: string;
+  batchSize?: string;
+  parseConcurrency?: string;
+  languages?: string;
+  branch?: string;
+  gitignore?: boolean;
+  include?: string[];
+  exclude?: string[];
+}
+
+function parsePositiveInt(optionName: string, value: string | undefined, fallback: number): number {
+  if (value === undefined) {
+    return fallback;
+  }
+  const parsed = Number(value);
+  if (!Number.isInteger(parsed) || parsed <= 0) {
+    throw new Error(`Invalid --${optionName} value: ${value}. Must be a positive integer.`);
+  }
+  return parsed;
+}
+
+/**
+ * Keeps an index up to date with the working tree of a local repository.
+ *
+ * Runs the indexer worker in watch mode and, for every debounced batch of file changes, removes the
+ * stale locations of changed and deleted files and re-parses the changed ones through the same
+ * producer path the incremental index uses. The last indexed commit is left alone, so the next
+ * `index` run still diffs from it. Runs until the process is stopped.
+ */
+export async function watch(repoArg: string, options: WatchOptions = {}): Promise<void> {
+  const config = parseRepoArg(repoArg, options.branch);
+  if (!fs.existsSync(config.repoPath)) {
+    throw new Error(`Repository not found at ${config.repoPath}`);
+  }
+
+  const debounceMs = parsePositiveInt('debounce', options.debounce, DEFAULT_WATCH_DEBOUNCE_MS);
+  const concurrency = parsePositiveInt('concurrency', options.concurrency, 2);
+  const batchSize = parsePositiveInt('batch-size', options.batchSize, 100);
+  const parseConcurrency = parsePositiveInt('parse-concurrency', options.parseConcurrency, 1);
+  const languages = options.languages ?? appConfig.languages;
+
+  const git = simpleGit(config.repoPath);
+  const gitRoot = await git.revparse(['--show-toplevel']);
+  const gitBranch = config.branch ?? (await git.revparse(['--abbrev-ref', 'HEAD']));
+  const logger = createLogger({ name: config.repoName, branch: gitBranch });
+  const metrics = createMetrics({ name: config.repoName, branch: gitBranch });
+
+  const store = createChunkStore(config.indexName);
+  try {
+    if (!(await store.getLastIndexedCommit(getCommitKey(gitBranch, config.repoName)))) {
+      throw new Error(`No index found for ${config.repoName} on branch ${gitBranch}. Run "index" first.`);
+    }
+  } finally {
+    await store.close();
+  }
+
+  const isLanguageFile = createLanguageFileMatcher(parseLanguageNames(languages));
+  const filter = createFileFilter(gitRoot, {
+    gitignore: options.gitignore,
+    include: options.include,
+    exclude: options.exclude,
+  });
+  const knownFiles = (await walkFiles(gitRoot, '**/*', filter)).filter(isLanguageFile);
+
+  const queueDir = path.join(appConfig.queueBaseDir, config.repoName);
+  const queue = new SqliteQueue({
+    dbPath: path.join(queueDir, 'queue.db'),
+    repoName: config.repoName,
+    branch: gitBranch,
+  });
+  await queue.initialize();
+
+  const reindex = async ({ changed, deleted }: FileChanges): Promise<void> => {
+    logger.info('Re-indexing changed files', { changed: changed.length, deleted: deleted.length });
+    const batchStore = createChunkStore(config.indexName);
+    try {
+      if (deleted.length > 0) {
+        await batchStore.deleteDocumentsByFilePaths(deleted, { workspace: config.repoName });
+      }
+      if (changed.length > 0) {
+        // Only the symbols an edit touched are embedded again, see `deleteChangedFile`
+        const { successCount, failureCount, errors } = await parseAndEnqueueFiles(changed, {
+          gitRoot,
+          repoName: config.repoName,
+          gitBranch,
+          queue,
+          parseConcurrency,
+          languages,
+          logger,
+          metrics,
+          changedFiles: { store: batchStore, paths: new Set(changed) },
+        });
+        logger.info('Enqueued changed files', { succeeded: successCount, failed: failureCount });
+        reportIndexErrors(errors, logger);
+      }
+    } finally {
+      await batchStore.close();
+    }
+  };
+
+  const watcher = new FileChangeWatcher({
+    root: gitRoot,
+    filter,
+    isLanguageFile,
+    knownFiles,
+    debounceMs,
+    logger,
+    onChanges: reindex,
+  });
+  watcher.start();
+
+  try {
+    await worker(concurrency, true, {
+      queueDir,
+      elasticsearchIndex: config.indexName,
+      repoName: config.repoName,
+      branch: gitBranch,
+      batchSize,
+    });
+  } finally {
+    await watcher.close();
+  }
+}
+
+export const watchCommand = new Command('watch')
+  .description('Watch a local repository and re-index files as they change')
+  .argument('<repo>', 'Repository name or path (format: repo[:index]); it must have been indexed with "index" before')
+  .addOption(
+    new Option('--debounce <ms>', 'Wait this long after the last change before re-indexing').default(
+      `${DEFAULT_WATCH_DEBOUNCE_MS}`
+    )
+  )
+  .addOption(
+    new Option('--concurrency <number>', 'Number of concurrent Elasticsearch indexing worker threads').default('2')
+  )
+  .addOption(new Option('--batch-size <number>', 'Number of chunks per Elasticsearch bulk request').default('100'))
+  .addOption(
+    new Option('--parse-concurrency <number>', 'Number of concurrent file-parsing worker threads').default('1')
+  )
+  .addOption(
+    new Option(
+      '--languages <names>',
+      'Comma-separated list of languages to index (default: SCS_IDXR_LANGUAGES if set, otherwise all languages)'
+    )
+  )
+  .addOption(new Option('--no-gitignore', 'Index files even if they are matched by .gitignore files'))
+  .addOption(
+    new Option(
+      '--include <patterns>',
+      'Only index files matching these comma-separated .gitignore-style patterns (repeatable)'
+    ).argParser(collectPatterns)
+  )
+  .addOption(
+    new Option(
+      '--exclude <patterns>',
+      'Skip files matching these comma-separated .gitignore-style patterns (repeatable)'
+    ).argParser(collectPatterns)
+  )
+  .addOption(new Option('--branch <branch>', 'Branch name for logging/metadata (default: auto-detect)'))
+  .action(async (repo, options) => {
+    try {
+      await watch(repo, options);
+    } catch (error) {
+      console.error('Watch failed:', error instanceof Error ? error.message : error);
+      process.exit(1);
+    }
+  });
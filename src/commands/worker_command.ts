@@ -1,15 +1,42 @@
 import { IndexerWorker } from '../utils/indexer_worker';
 import { createLogger } from '../utils/logger';
 import { SqliteQueue } from '../utils/sqlite_queue';
-import { createIndex, createLocationsIndex } from '../utils/elasticsearch';
+import { canReuseStoredVectors, createChunkStore } from '../utils/chunk_store';
+import { Embedder, getConfiguredEmbedder, validateEmbedderDimensions } from '../utils/embedder';
+import { CachedEmbedder, EmbeddingCache } from '../utils/embedding_cache';
+import { EmbedTemplate, parseEmbedTemplate } from '../utils/embed_template';
+import { embeddingConfig, indexingConfig } from '../config';
+import { ChunkDeduplicator } from '../utils/chunk_dedup';
+import { ProgressTracker } from '../utils/progress';
 import path from 'path';
 
 export interface WorkerOptions {
   queueDir: string;
   elasticsearchIndex: string;
   batchSize?: number;
+  /** Most chunks the batches in flight hold together (default: `SCS_IDXR_MAX_IN_FLIGHT_CHUNKS`). */
+  maxInFlightChunks?: number;
   repoName?: string;
   branch?: string;
+  /** Number of chunks per embedding request (client-side embedder only). */
+  embeddingBatchSize?: number;
+  /** Number of embedding requests run in parallel (client-side embedder only). */
+  embeddingConcurrency?: number;
+  /** Set to false to skip the on-disk embedding cache (`SCS_IDXR_EMBED_CACHE` also disables it). */
+  embedCache?: boolean;
+  /** Renders the text embedded per chunk (default: `SCS_IDXR_EMBED_TEMPLATE`). */
+  embedTemplate?: EmbedTemplate;
+  /** Embeds every chunk again instead of reusing the vectors stored for it (`index --force`). */
+  force?: boolean;
+  /**
+   * Folds chunks at least this similar into one canonical chunk before embedding (see `ChunkDeduplicator`);
+   * unset stores every chunk. Chunks are compared within one worker run.
+   */
+  dedupThreshold?: number;
+  /** Receives the embedding progress, continuing the counts of the producer run that filled the queue. */
+  progress?: ProgressTracker;
+  /** Stops dequeuing when aborted; batches in flight are finished and committed first. */
+  signal?: AbortSignal;
 }
 
 export async function worker(concurrency: number = 1, watch: boolean = false, options: WorkerOptions) {
@@ -20,10 +47,41 @@ export async function worker(concurrency: number = 1, watch: boolean = false, op
 
   logger.info('Starting indexer worker process', { concurrency, batchSize, ...options });
 
-  // The worker can be run standalone (without going through the index command). Ensure the new
-  // locations index exists so `indexCodeChunks` doesn't fail and leave rows stuck in processing.
-  await createIndex(options.elasticsearchIndex);
-  await createLocationsIndex(options.elasticsearchIndex);
+  const embedTemplate = options.embedTemplate ?? parseEmbedTemplate(embeddingConfig.template);
+
+  // The worker can be run standalone (without going through the index command). Ensure the store
+  // (including the locations index) exists so indexing doesn't fail and leave rows stuck in processing.
+  const store = createChunkStore(options.elasticsearchIndex);
+  await store.setup();
+
+  // Fail fast before dequeuing anything if the embedder cannot write into this index.
+  let embedder: Embedder | undefined = getConfiguredEmbedder();
+  let embeddingCache: EmbeddingCache | undefined;
+  let reuseStoredVectors = false;
+  if (embedder) {
+    const indexDimensions = await store.getVectorDimensions();
+    validateEmbedderDimensions(embedder, indexDimensions, options.elasticsearchIndex);
+    reuseStoredVectors = await canReuseStoredVectors(
+      store,
+      { embedder: embedder.name, template: embeddingConfig.template },
+      { force: options.force, logger }
+    );
+    const useCache = options.embedCache !== false && embeddingConfig.cacheEnabled;
+    logger.info('Using client-side embedder', {
+      embedder: embedder.name,
+      dimensions: embedder.dimensions(),
+      batchSize: options.embeddingBatchSize ?? embeddingConfig.batchSize,
+      concurrency: options.embeddingConcurrency ?? embeddingConfig.concurrency,
+      cache: useCache ? embeddingConfig.cachePath : false,
+    });
+    if (useCache) {
+      embeddingCache = new EmbeddingCache({
+        dbPath: embeddingConfig.cachePath,
+        maxEntries: embeddingConfig.cacheMaxEntries,
+      });
+      embedder = new CachedEmbedder(embedder, embeddingCache);
+    }
+  }
 
   const queuePath = path.join(options.queueDir, 'queue.db');
   const queue = new SqliteQueue({
@@ -37,11 +95,31 @@ export async function worker(concurrency: number = 1, watch: boolean = false, op
     queue,
     batchSize,
     concurrency,
+    maxInFlightDocuments: options.maxInFlightChunks ?? indexingConfig.maxInFlightChunks,
     watch,
     logger,
     elasticsearchIndex: options.elasticsearchIndex,
+    store,
     repoInfo,
+    embedder,
+    embedding: {
+      batchSize: options.embeddingBatchSize,
+      concurrency: options.embeddingConcurrency,
+    },
+    embedTemplate,
+    reuseStoredVectors,
+    deduplicator: options.dedupThreshold !== undefined ? new ChunkDeduplicator(options.dedupThreshold) : undefined,
+    progress: options.progress,
+    signal: options.signal,
   });
 
-  await indexerWorker.start();
+  try {
+    await indexerWorker.start();
+  } finally {
+    if (embedder instanceof CachedEmbedder) {
+      logger.info('Embedding cache usage', embedder.getStats());
+    }
+    embeddingCache?.close();
+    await store.close();
+  }
 }
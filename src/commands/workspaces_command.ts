@@ -0,0 +1,58 @@
+import { Command, Option } from 'commander';
+import { consoleLogSink } from '../utils/logger';
+import { WorkspaceStats, createIndex } from '../lib';
+
+export type WorkspacesOutputFormat = 'pretty' | 'json';
+
+export interface WorkspacesOptions {
+  index: string;
+  format?: WorkspacesOutputFormat;
+}
+
+/** Shown for locations indexed before workspaces were recorded. */
+const UNLABELED_WORKSPACE = '(unlabeled)';
+
+function printPretty(indexName: string, workspaces: WorkspaceStats[]): void {
+  console.log(`Workspaces in ${indexName}:`);
+  if (workspaces.length === 0) {
+    console.log('  (none)');
+    return;
+  }
+  const names = workspaces.map(({ workspace }) => workspace ?? UNLABELED_WORKSPACE);
+  const width = Math.max(...names.map((name) => name.length));
+  workspaces.forEach(({ files, chunks }, i) =>
+    console.log(`  ${names[i].padEnd(width)}  ${files} file(s), ${chunks} chunk(s)`)
+  );
+}
+
+/**
+ * Workspaces command - lists the workspaces of an index with their file and chunk counts
+ */
+export async function workspaces(options: WorkspacesOptions) {
+  const index = await createIndex({ index: options.index, logger: consoleLogSink });
+  let result: WorkspaceStats[];
+  try {
+    result = await index.workspaces();
+  } finally {
+    await index.close();
+  }
+
+  if (options.format === 'json') {
+    console.log(JSON.stringify({ index: options.index, workspaces: result }, null, 2));
+    return;
+  }
+  printPretty(options.index, result);
+}
+
+export const workspacesCommand = new Command('workspaces')
+  .description('List the workspaces (repositories) of an index with their file and chunk counts')
+  .addOption(new Option('--index <index>', 'Index to report on (required)').makeOptionMandatory())
+  .addOption(new Option('--format <format>', 'Output format').choices(['pretty', 'json']).default('pretty'))
+  .action(async (options) => {
+    try {
+      await workspaces(options);
+    } catch (error) {
+      console.error('Workspaces failed:', error);
+      process.exit(1);
+    }
+  });
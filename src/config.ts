@@ -1,6 +1,7 @@
 import dotenv from 'dotenv';
 import path from 'path';
 import fs from 'fs';
+import { ConfigFileSetting, applyConfigFile, findConfigFile, readConfigFile } from './utils/config_file';
 
 // Helper to find the project root by looking for package.json
 function findProjectRoot(startPath: string): string {
@@ -66,6 +67,21 @@ function parseEnvBoolean(envVarName: string, fallback: boolean): boolean {
   throw new Error(`Invalid configuration: ${envVarName} must be a boolean (true/false/1/0), got "${value}"`);
 }
 
+/**
+ * Parses a comma-separated environment variable into a list.
+ *
+ * @param envVarName The name of the environment variable.
+ * @returns The non-empty entries, or undefined if the environment variable is not set.
+ */
+function parseEnvList(envVarName: string): string[] | undefined {
+  const value = process.env[envVarName];
+  if (value === undefined || value.trim() === '') return undefined;
+  return value
+    .split(',')
+    .map((entry) => entry.trim())
+    .filter((entry) => entry.length > 0);
+}
+
 // Don't override existing environment variables (important for tests).
 // In test mode, load .env.test instead of .env. If the file doesn't exist,
 // dotenv silently skips it (quiet: true).
@@ -147,6 +163,22 @@ export const indexingConfig = {
     process.env.SCS_IDXR_MAX_CHUNK_SIZE_BYTES = v.toString();
   },
 
+  /** Chunks with more tokens than this are split, see `ChunkOptions.maxTokens`; 0 means no limit. */
+  get maxChunkTokens() {
+    return parseEnvNonNegativeInt('SCS_IDXR_MAX_CHUNK_TOKENS', 8192);
+  },
+  set maxChunkTokens(v: number) {
+    process.env.SCS_IDXR_MAX_CHUNK_TOKENS = v.toString();
+  },
+
+  /** Files larger than this are skipped without being read, see `ChunkOptions.maxFileBytes`. */
+  get maxFileBytes() {
+    return parseEnvPositiveInt('SCS_IDXR_MAX_FILE_BYTES', 5242880);
+  },
+  set maxFileBytes(v: number) {
+    process.env.SCS_IDXR_MAX_FILE_BYTES = v.toString();
+  },
+
   get enableDenseVectors() {
     return parseEnvBoolean('SCS_IDXR_ENABLE_DENSE_VECTORS', false);
   },
@@ -168,11 +200,113 @@ export const indexingConfig = {
     process.env.SCS_IDXR_CHUNK_OVERLAP_LINES = v.toString();
   },
 
-  get markdownChunkDelimiter() {
-    return process.env.SCS_IDXR_MARKDOWN_CHUNK_DELIMITER || '\\n\\s*\\n';
+  get symbolChunkMaxLines() {
+    return parseEnvNonNegativeInt('SCS_IDXR_SYMBOL_CHUNK_MAX_LINES', 40);
+  },
+  set symbolChunkMaxLines(v: number) {
+    process.env.SCS_IDXR_SYMBOL_CHUNK_MAX_LINES = v.toString();
+  },
+
+  get symbolChunkOverlapLines() {
+    return parseEnvNonNegativeInt('SCS_IDXR_SYMBOL_CHUNK_OVERLAP_LINES', 10);
+  },
+  set symbolChunkOverlapLines(v: number) {
+    process.env.SCS_IDXR_SYMBOL_CHUNK_OVERLAP_LINES = v.toString();
+  },
+
+  /** Whether code chunks carry their file's imports, see `ChunkOptions.includeImports`. */
+  get includeImports() {
+    return parseEnvBoolean('SCS_IDXR_CHUNK_INCLUDE_IMPORTS', false);
+  },
+  set includeImports(v: boolean) {
+    process.env.SCS_IDXR_CHUNK_INCLUDE_IMPORTS = v.toString();
+  },
+
+  /** Whether SQL queries in string literals get chunks of their own, see `ChunkOptions.extractEmbeddedSql`. */
+  get extractEmbeddedSql() {
+    return parseEnvBoolean('SCS_IDXR_EXTRACT_EMBEDDED_SQL', false);
+  },
+  set extractEmbeddedSql(v: boolean) {
+    process.env.SCS_IDXR_EXTRACT_EMBEDDED_SQL = v.toString();
+  },
+
+  /** `language:strategy` entries choosing how each language is chunked, see `CHUNK_STRATEGIES`. */
+  get chunkStrategies(): string[] | undefined {
+    return parseEnvList('SCS_IDXR_CHUNK_STRATEGY');
+  },
+  set chunkStrategies(v: string[] | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_CHUNK_STRATEGY;
+    else process.env.SCS_IDXR_CHUNK_STRATEGY = v.join(',');
+  },
+
+  /** Whether chunks record the last commit of their lines, see `ChunkOptions.includeBlame`. */
+  get includeBlame() {
+    return parseEnvBoolean('SCS_IDXR_INCLUDE_BLAME', false);
+  },
+  set includeBlame(v: boolean) {
+    process.env.SCS_IDXR_INCLUDE_BLAME = v.toString();
+  },
+
+  /** Whether duplicate and near-duplicate chunks are folded before embedding, see `ChunkDeduplicator`. */
+  get dedup() {
+    return parseEnvBoolean('SCS_IDXR_DEDUP', false);
+  },
+  set dedup(v: boolean) {
+    process.env.SCS_IDXR_DEDUP = v.toString();
+  },
+
+  /** SimHash similarity in (0, 1] from which chunks are folded when `dedup` is enabled. */
+  get dedupThreshold() {
+    const value = process.env.SCS_IDXR_DEDUP_THRESHOLD;
+    if (value === undefined || value.trim() === '') return 0.9;
+    const parsed = Number(value);
+    if (!(parsed > 0 && parsed <= 1)) {
+      throw new Error(
+        `Invalid configuration: SCS_IDXR_DEDUP_THRESHOLD must be a number greater than 0 and at most 1, got "${value}"`
+      );
+    }
+    return parsed;
+  },
+  set dedupThreshold(v: number) {
+    process.env.SCS_IDXR_DEDUP_THRESHOLD = v.toString();
+  },
+
+  /**
+   * Most parsed chunks a run holds in memory before they are stored: the chunks being embedded and
+   * written by the indexer worker's batches together, and by the library per file.
+   */
+  get maxInFlightChunks() {
+    return parseEnvPositiveInt('SCS_IDXR_MAX_IN_FLIGHT_CHUNKS', 1000);
+  },
+  set maxInFlightChunks(v: number) {
+    process.env.SCS_IDXR_MAX_IN_FLIGHT_CHUNKS = v.toString();
+  },
+
+  /** Regex that Markdown files are split by; unset means Markdown is chunked by headings. */
+  get markdownChunkDelimiter(): string | undefined {
+    return process.env.SCS_IDXR_MARKDOWN_CHUNK_DELIMITER || undefined;
+  },
+  set markdownChunkDelimiter(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_MARKDOWN_CHUNK_DELIMITER;
+    else process.env.SCS_IDXR_MARKDOWN_CHUNK_DELIMITER = v;
+  },
+
+  /** `.gitignore`-style patterns that files must match to be indexed, see `FileFilterOptions.include`. */
+  get include(): string[] | undefined {
+    return parseEnvList('SCS_IDXR_INCLUDE');
   },
-  set markdownChunkDelimiter(v: string) {
-    process.env.SCS_IDXR_MARKDOWN_CHUNK_DELIMITER = v;
+  set include(v: string[] | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_INCLUDE;
+    else process.env.SCS_IDXR_INCLUDE = v.join(',');
+  },
+
+  /** `.gitignore`-style patterns of files that are not indexed, see `FileFilterOptions.exclude`. */
+  get exclude(): string[] | undefined {
+    return parseEnvList('SCS_IDXR_EXCLUDE');
+  },
+  set exclude(v: string[] | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EXCLUDE;
+    else process.env.SCS_IDXR_EXCLUDE = v.join(',');
   },
 
   get testThrowOnFilePath() {
@@ -191,6 +325,251 @@ export const indexingConfig = {
   },
 };
 
+export const embeddingConfig = {
+  get embedder() {
+    return process.env.SCS_IDXR_EMBEDDER?.trim() || undefined;
+  },
+  set embedder(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EMBEDDER;
+    else process.env.SCS_IDXR_EMBEDDER = v;
+  },
+
+  get batchSize() {
+    return parseEnvPositiveInt('SCS_IDXR_EMBEDDING_BATCH_SIZE', 64);
+  },
+  set batchSize(v: number) {
+    process.env.SCS_IDXR_EMBEDDING_BATCH_SIZE = v.toString();
+  },
+
+  get concurrency() {
+    return parseEnvPositiveInt('SCS_IDXR_EMBEDDING_CONCURRENCY', 2);
+  },
+  set concurrency(v: number) {
+    process.env.SCS_IDXR_EMBEDDING_CONCURRENCY = v.toString();
+  },
+
+  get maxRetries() {
+    return parseEnvNonNegativeInt('SCS_IDXR_EMBEDDING_MAX_RETRIES', 3);
+  },
+  set maxRetries(v: number) {
+    process.env.SCS_IDXR_EMBEDDING_MAX_RETRIES = v.toString();
+  },
+
+  /** Base URL of the embeddings API used by the `http` embedder. */
+  get url() {
+    return process.env.SCS_IDXR_EMBEDDER_URL?.trim() || undefined;
+  },
+  set url(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EMBEDDER_URL;
+    else process.env.SCS_IDXR_EMBEDDER_URL = v;
+  },
+
+  get apiKey() {
+    return process.env.SCS_IDXR_EMBEDDER_API_KEY || undefined;
+  },
+  set apiKey(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EMBEDDER_API_KEY;
+    else process.env.SCS_IDXR_EMBEDDER_API_KEY = v;
+  },
+
+  /** Model sent with every request of the `http` embedder. */
+  get model() {
+    return process.env.SCS_IDXR_EMBEDDER_MODEL?.trim() || undefined;
+  },
+  set model(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EMBEDDER_MODEL;
+    else process.env.SCS_IDXR_EMBEDDER_MODEL = v;
+  },
+
+  /** Dimensions of the vectors the `http` embedder's model returns; required by it. */
+  get dimensions() {
+    return process.env.SCS_IDXR_EMBEDDER_DIMENSIONS?.trim()
+      ? parseEnvPositiveInt('SCS_IDXR_EMBEDDER_DIMENSIONS', 0)
+      : undefined;
+  },
+  set dimensions(v: number | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_EMBEDDER_DIMENSIONS;
+    else process.env.SCS_IDXR_EMBEDDER_DIMENSIONS = v.toString();
+  },
+
+  /** Requests per minute the `http` embedder may send; 0 means no limit. */
+  get rateLimit() {
+    return parseEnvNonNegativeInt('SCS_IDXR_EMBEDDER_RATE_LIMIT', 0);
+  },
+  set rateLimit(v: number) {
+    process.env.SCS_IDXR_EMBEDDER_RATE_LIMIT = v.toString();
+  },
+
+  get timeoutMs() {
+    return parseEnvPositiveInt('SCS_IDXR_EMBEDDER_TIMEOUT_MS', 60000);
+  },
+  set timeoutMs(v: number) {
+    process.env.SCS_IDXR_EMBEDDER_TIMEOUT_MS = v.toString();
+  },
+
+  /** Tokens the `http` embedder's model accepts per input; longer inputs are truncated. 0 means no limit. */
+  get maxInputTokens() {
+    return parseEnvNonNegativeInt('SCS_IDXR_EMBEDDER_MAX_INPUT_TOKENS', 8192);
+  },
+  set maxInputTokens(v: number) {
+    process.env.SCS_IDXR_EMBEDDER_MAX_INPUT_TOKENS = v.toString();
+  },
+
+  /** Tokens the `http` embedder sends per request; larger batches are split. 0 means no limit. */
+  get maxBatchTokens() {
+    return parseEnvNonNegativeInt('SCS_IDXR_EMBEDDER_MAX_BATCH_TOKENS', 0);
+  },
+  set maxBatchTokens(v: number) {
+    process.env.SCS_IDXR_EMBEDDER_MAX_BATCH_TOKENS = v.toString();
+  },
+
+  /** Text embedded per chunk by the client-side embedder, see `parseEmbedTemplate`. */
+  get template() {
+    return process.env.SCS_IDXR_EMBED_TEMPLATE || '{text}';
+  },
+  set template(v: string) {
+    process.env.SCS_IDXR_EMBED_TEMPLATE = v;
+  },
+
+  get cacheEnabled() {
+    return parseEnvBoolean('SCS_IDXR_EMBED_CACHE', true);
+  },
+  set cacheEnabled(v: boolean) {
+    process.env.SCS_IDXR_EMBED_CACHE = v.toString();
+  },
+
+  get cachePath() {
+    return path.resolve(projectRoot, process.env.SCS_IDXR_EMBED_CACHE_PATH || '.cache/embeddings.db');
+  },
+  set cachePath(v: string) {
+    process.env.SCS_IDXR_EMBED_CACHE_PATH = v;
+  },
+
+  get cacheMaxEntries() {
+    return parseEnvPositiveInt('SCS_IDXR_EMBED_CACHE_MAX_ENTRIES', 200000);
+  },
+  set cacheMaxEntries(v: number) {
+    process.env.SCS_IDXR_EMBED_CACHE_MAX_ENTRIES = v.toString();
+  },
+};
+
+export const rerankConfig = {
+  get reranker() {
+    return process.env.SCS_IDXR_RERANKER?.trim() || undefined;
+  },
+  set reranker(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_RERANKER;
+    else process.env.SCS_IDXR_RERANKER = v;
+  },
+
+  /** Base URL of the rerank endpoint used by the `http` reranker. */
+  get url() {
+    return process.env.SCS_IDXR_RERANKER_URL?.trim() || undefined;
+  },
+  set url(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_RERANKER_URL;
+    else process.env.SCS_IDXR_RERANKER_URL = v;
+  },
+
+  get apiKey() {
+    return process.env.SCS_IDXR_RERANKER_API_KEY || undefined;
+  },
+  set apiKey(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_RERANKER_API_KEY;
+    else process.env.SCS_IDXR_RERANKER_API_KEY = v;
+  },
+
+  /** Candidates fetched from the store and rescored per reranked search. */
+  get candidates() {
+    return parseEnvPositiveInt('SCS_IDXR_RERANK_CANDIDATES', 50);
+  },
+  set candidates(v: number) {
+    process.env.SCS_IDXR_RERANK_CANDIDATES = v.toString();
+  },
+};
+
+export const storeConfig = {
+  get backend() {
+    return process.env.SCS_IDXR_STORE?.trim().toLowerCase() || 'elasticsearch';
+  },
+  set backend(v: string) {
+    process.env.SCS_IDXR_STORE = v;
+  },
+
+  get sqliteDir() {
+    return path.resolve(projectRoot, process.env.SCS_IDXR_SQLITE_STORE_DIR || '.stores');
+  },
+  set sqliteDir(v: string) {
+    process.env.SCS_IDXR_SQLITE_STORE_DIR = v;
+  },
+
+  get qdrantUrl() {
+    return process.env.SCS_IDXR_QDRANT_URL || 'http://localhost:6333';
+  },
+  set qdrantUrl(v: string) {
+    process.env.SCS_IDXR_QDRANT_URL = v;
+  },
+
+  get qdrantApiKey() {
+    return process.env.SCS_IDXR_QDRANT_API_KEY || undefined;
+  },
+  set qdrantApiKey(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_QDRANT_API_KEY;
+    else process.env.SCS_IDXR_QDRANT_API_KEY = v;
+  },
+
+  /** How vectors are compared: `cosine`, `dot_product`, or `euclidean` (see `VECTOR_METRICS`). */
+  get metric() {
+    return process.env.SCS_IDXR_VECTOR_METRIC?.trim().toLowerCase() || 'cosine';
+  },
+  set metric(v: string) {
+    process.env.SCS_IDXR_VECTOR_METRIC = v;
+  },
+
+  /** Qdrant collection for chunks; unset means one collection per index, named after it. */
+  get qdrantCollection() {
+    return process.env.SCS_IDXR_QDRANT_COLLECTION || undefined;
+  },
+  set qdrantCollection(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_QDRANT_COLLECTION;
+    else process.env.SCS_IDXR_QDRANT_COLLECTION = v;
+  },
+};
+
+export const serveConfig = {
+  /** Address the `serve` HTTP server binds to. */
+  get host() {
+    return process.env.SCS_IDXR_SERVE_HOST?.trim() || '127.0.0.1';
+  },
+  set host(v: string) {
+    process.env.SCS_IDXR_SERVE_HOST = v;
+  },
+
+  get port() {
+    return parseEnvNonNegativeInt('SCS_IDXR_SERVE_PORT', 3000);
+  },
+  set port(v: number) {
+    process.env.SCS_IDXR_SERVE_PORT = v.toString();
+  },
+
+  /** Time a request may take, from receiving it to sending the response. */
+  get requestTimeoutMs() {
+    return parseEnvPositiveInt('SCS_IDXR_SERVE_REQUEST_TIMEOUT_MS', 30000);
+  },
+  set requestTimeoutMs(v: number) {
+    process.env.SCS_IDXR_SERVE_REQUEST_TIMEOUT_MS = v.toString();
+  },
+
+  /** Bearer token `POST /search` requests must send; unset accepts all requests. */
+  get authToken() {
+    return process.env.SCS_IDXR_SERVE_AUTH_TOKEN || undefined;
+  },
+  set authToken(v: string | undefined) {
+    if (v === undefined) delete process.env.SCS_IDXR_SERVE_AUTH_TOKEN;
+    else process.env.SCS_IDXR_SERVE_AUTH_TOKEN = v;
+  },
+};
+
 export const appConfig = {
   get queueBaseDir() {
     return path.resolve(projectRoot, process.env.SCS_IDXR_QUEUE_BASE_DIR || '.queues');
@@ -230,3 +609,136 @@ export const appConfig = {
     process.env.SCS_IDXR_FORCE_LOGGING = v ? 'true' : 'false';
   },
 };
+
+/** A setting of a `.scsi.yaml` file, with the effective value `config print` reports for it. */
+export interface ConfigSetting extends ConfigFileSetting {
+  resolve: () => unknown;
+}
+
+/**
+ * The settings a config file may hold. Credentials (API keys, passwords, tokens) are left out, so they
+ * stay in the environment rather than in a file that may be committed.
+ */
+export const configSettings: ConfigSetting[] = [
+  { key: 'store', env: 'SCS_IDXR_STORE', resolve: () => storeConfig.backend },
+  { key: 'embedder', env: 'SCS_IDXR_EMBEDDER', resolve: () => embeddingConfig.embedder },
+  { key: 'reranker', env: 'SCS_IDXR_RERANKER', resolve: () => rerankConfig.reranker },
+  { key: 'metric', env: 'SCS_IDXR_VECTOR_METRIC', resolve: () => storeConfig.metric },
+  { key: 'languages', env: 'SCS_IDXR_LANGUAGES', list: true, resolve: () => appConfig.languages },
+  { key: 'include', env: 'SCS_IDXR_INCLUDE', list: true, resolve: () => indexingConfig.include },
+  { key: 'exclude', env: 'SCS_IDXR_EXCLUDE', list: true, resolve: () => indexingConfig.exclude },
+  { key: 'maxFileBytes', env: 'SCS_IDXR_MAX_FILE_BYTES', resolve: () => indexingConfig.maxFileBytes },
+  { key: 'blame', env: 'SCS_IDXR_INCLUDE_BLAME', resolve: () => indexingConfig.includeBlame },
+  { key: 'dedup', env: 'SCS_IDXR_DEDUP', resolve: () => indexingConfig.dedup },
+  { key: 'dedupThreshold', env: 'SCS_IDXR_DEDUP_THRESHOLD', resolve: () => indexingConfig.dedupThreshold },
+  { key: 'maxInFlightChunks', env: 'SCS_IDXR_MAX_IN_FLIGHT_CHUNKS', resolve: () => indexingConfig.maxInFlightChunks },
+  { key: 'queueDir', env: 'SCS_IDXR_QUEUE_BASE_DIR', path: true, resolve: () => appConfig.queueBaseDir },
+  { key: 'chunk.maxBytes', env: 'SCS_IDXR_MAX_CHUNK_SIZE_BYTES', resolve: () => indexingConfig.maxChunkSizeBytes },
+  { key: 'chunk.maxTokens', env: 'SCS_IDXR_MAX_CHUNK_TOKENS', resolve: () => indexingConfig.maxChunkTokens },
+  { key: 'chunk.lines', env: 'SCS_IDXR_DEFAULT_CHUNK_LINES', resolve: () => indexingConfig.defaultChunkLines },
+  { key: 'chunk.overlapLines', env: 'SCS_IDXR_CHUNK_OVERLAP_LINES', resolve: () => indexingConfig.chunkOverlapLines },
+  {
+    key: 'chunk.symbolMaxLines',
+    env: 'SCS_IDXR_SYMBOL_CHUNK_MAX_LINES',
+    resolve: () => indexingConfig.symbolChunkMaxLines,
+  },
+  {
+    key: 'chunk.symbolOverlapLines',
+    env: 'SCS_IDXR_SYMBOL_CHUNK_OVERLAP_LINES',
+    resolve: () => indexingConfig.symbolChunkOverlapLines,
+  },
+  { key: 'chunk.includeImports', env: 'SCS_IDXR_CHUNK_INCLUDE_IMPORTS', resolve: () => indexingConfig.includeImports },
+  {
+    key: 'chunk.extractEmbeddedSql',
+    env: 'SCS_IDXR_EXTRACT_EMBEDDED_SQL',
+    resolve: () => indexingConfig.extractEmbeddedSql,
+  },
+  {
+    key: 'chunk.strategy',
+    env: 'SCS_IDXR_CHUNK_STRATEGY',
+    list: true,
+    resolve: () => indexingConfig.chunkStrategies,
+  },
+  {
+    key: 'chunk.markdownDelimiter',
+    env: 'SCS_IDXR_MARKDOWN_CHUNK_DELIMITER',
+    resolve: () => indexingConfig.markdownChunkDelimiter,
+  },
+  { key: 'embedding.batchSize', env: 'SCS_IDXR_EMBEDDING_BATCH_SIZE', resolve: () => embeddingConfig.batchSize },
+  { key: 'embedding.concurrency', env: 'SCS_IDXR_EMBEDDING_CONCURRENCY', resolve: () => embeddingConfig.concurrency },
+  { key: 'embedding.maxRetries', env: 'SCS_IDXR_EMBEDDING_MAX_RETRIES', resolve: () => embeddingConfig.maxRetries },
+  { key: 'embedding.url', env: 'SCS_IDXR_EMBEDDER_URL', resolve: () => embeddingConfig.url },
+  { key: 'embedding.model', env: 'SCS_IDXR_EMBEDDER_MODEL', resolve: () => embeddingConfig.model },
+  { key: 'embedding.dimensions', env: 'SCS_IDXR_EMBEDDER_DIMENSIONS', resolve: () => embeddingConfig.dimensions },
+  { key: 'embedding.rateLimit', env: 'SCS_IDXR_EMBEDDER_RATE_LIMIT', resolve: () => embeddingConfig.rateLimit },
+  { key: 'embedding.timeoutMs', env: 'SCS_IDXR_EMBEDDER_TIMEOUT_MS', resolve: () => embeddingConfig.timeoutMs },
+  {
+    key: 'embedding.maxInputTokens',
+    env: 'SCS_IDXR_EMBEDDER_MAX_INPUT_TOKENS',
+    resolve: () => embeddingConfig.maxInputTokens,
+  },
+  {
+    key: 'embedding.maxBatchTokens',
+    env: 'SCS_IDXR_EMBEDDER_MAX_BATCH_TOKENS',
+    resolve: () => embeddingConfig.maxBatchTokens,
+  },
+  { key: 'embedding.template', env: 'SCS_IDXR_EMBED_TEMPLATE', resolve: () => embeddingConfig.template },
+  { key: 'embedding.cache', env: 'SCS_IDXR_EMBED_CACHE', resolve: () => embeddingConfig.cacheEnabled },
+  {
+    key: 'embedding.cachePath',
+    env: 'SCS_IDXR_EMBED_CACHE_PATH',
+    path: true,
+    resolve: () => embeddingConfig.cachePath,
+  },
+  {
+    key: 'embedding.cacheMaxEntries',
+    env: 'SCS_IDXR_EMBED_CACHE_MAX_ENTRIES',
+    resolve: () => embeddingConfig.cacheMaxEntries,
+  },
+  { key: 'rerank.url', env: 'SCS_IDXR_RERANKER_URL', resolve: () => rerankConfig.url },
+  { key: 'rerank.candidates', env: 'SCS_IDXR_RERANK_CANDIDATES', resolve: () => rerankConfig.candidates },
+  { key: 'elasticsearch.endpoint', env: 'ELASTICSEARCH_ENDPOINT', resolve: () => elasticsearchConfig.endpoint },
+  { key: 'elasticsearch.cloudId', env: 'ELASTICSEARCH_CLOUD_ID', resolve: () => elasticsearchConfig.cloudId },
+  {
+    key: 'elasticsearch.inferenceId',
+    env: 'SCS_IDXR_ELASTICSEARCH_INFERENCE_ID',
+    resolve: () => elasticsearchConfig.inferenceId,
+  },
+  {
+    key: 'elasticsearch.requestTimeout',
+    env: 'SCS_IDXR_ELASTICSEARCH_REQUEST_TIMEOUT',
+    resolve: () => elasticsearchConfig.requestTimeout,
+  },
+  {
+    key: 'elasticsearch.disableSemanticText',
+    env: 'SCS_IDXR_DISABLE_SEMANTIC_TEXT',
+    resolve: () => elasticsearchConfig.disableSemanticText,
+  },
+  { key: 'sqlite.dir', env: 'SCS_IDXR_SQLITE_STORE_DIR', path: true, resolve: () => storeConfig.sqliteDir },
+  { key: 'qdrant.url', env: 'SCS_IDXR_QDRANT_URL', resolve: () => storeConfig.qdrantUrl },
+  { key: 'qdrant.collection', env: 'SCS_IDXR_QDRANT_COLLECTION', resolve: () => storeConfig.qdrantCollection },
+  { key: 'serve.host', env: 'SCS_IDXR_SERVE_HOST', resolve: () => serveConfig.host },
+  { key: 'serve.port', env: 'SCS_IDXR_SERVE_PORT', resolve: () => serveConfig.port },
+  {
+    key: 'serve.requestTimeoutMs',
+    env: 'SCS_IDXR_SERVE_REQUEST_TIMEOUT_MS',
+    resolve: () => serveConfig.requestTimeoutMs,
+  },
+];
+
+/**
+ * Loads the `.scsi.yaml` closest to the working directory, below the environment: a setting of the
+ * file only applies if its environment variable is not set, in the shell or in `.env`.
+ */
+function loadConfigFile(): { path: string; applied: string[]; unknownKeys: string[] } | undefined {
+  const filePath = findConfigFile(process.cwd());
+  if (filePath === undefined) return undefined;
+  const file = readConfigFile(filePath, configSettings);
+  return { path: filePath, applied: applyConfigFile(file), unknownKeys: file.unknownKeys };
+}
+
+/**
+ * The config file in use, if any, the environment variables it set, and the keys it has that are not
+ * settings. Those are left for the CLI to warn about, so the library never writes to stderr.
+ */
+export const configFile = loadConfigFile();
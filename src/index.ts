@@ -1,8 +1,9 @@
-import './config'; // Must be the first import
+import { configFile } from './config'; // Must be the first import
 import { Command } from 'commander';
 import { indexCommand } from './commands/index_command';
 import { setupCommand } from './commands/setup_command';
 import { clearQueueCommand } from './commands/clear_queue_command';
+import { configCommand } from './commands/config_command';
 import { dumpTreeCommand } from './commands/dump_tree_command';
 import { listFailedCommand } from './commands/list_failed_command';
 import { monitorQueueCommand } from './commands/monitor_queue_command';
@@ -10,23 +11,34 @@ import { referencesCommand } from './commands/references_command';
 import { retryFailedCommand } from './commands/retry_failed_command';
 import { scaffoldLanguageCommand } from './commands/scaffold_language_command';
 import { searchCommand } from './commands/search_command';
+import { serveCommand } from './commands/serve_command';
+import { statsCommand } from './commands/stats_command';
+import { watchCommand } from './commands/watch_command';
+import { workspacesCommand } from './commands/workspaces_command';
 import { shutdown } from './utils/otel_provider';
+import { IndexingCancelledError, cancelActiveRun } from './utils/cancellation';
 import { validateAllLanguageConfigurations } from './languages';
 
 async function main() {
   // Validate all language configurations at startup
   validateAllLanguageConfigurations();
 
+  for (const key of configFile?.unknownKeys ?? []) {
+    console.warn(`Unknown setting "${key}" in ${configFile?.path} is ignored.`);
+  }
+
   const program = new Command();
 
   program.name('code-indexer').version('1.0.0').description('A CLI for indexing codebases into Elasticsearch');
 
   // Main command
   program.addCommand(indexCommand);
+  program.addCommand(watchCommand);
 
   // Utility commands
   program.addCommand(setupCommand);
   program.addCommand(clearQueueCommand);
+  program.addCommand(configCommand);
   program.addCommand(dumpTreeCommand);
   program.addCommand(listFailedCommand);
   program.addCommand(monitorQueueCommand);
@@ -34,6 +46,9 @@ async function main() {
   program.addCommand(retryFailedCommand);
   program.addCommand(scaffoldLanguageCommand);
   program.addCommand(searchCommand);
+  program.addCommand(serveCommand);
+  program.addCommand(statsCommand);
+  program.addCommand(workspacesCommand);
 
   await program.parseAsync(process.argv);
 }
@@ -44,10 +59,16 @@ async function main() {
  *
  * Flushes any pending OpenTelemetry logs to the collector before exiting.
  * Called on SIGTERM and SIGINT signals to ensure clean application termination.
+ * While an index run is in progress, the first signal cancels it instead, so the batches in flight
+ * are committed before the process exits; a second signal exits immediately.
  *
  * @param signal - The signal name that triggered the shutdown (e.g., 'SIGTERM', 'SIGINT').
  */
 async function handleShutdown(signal: string) {
+  if (cancelActiveRun()) {
+    console.log(`\nReceived ${signal}, cancelling indexing after the batches in flight (repeat to exit now)...`);
+    return;
+  }
   console.log(`\nReceived ${signal}, shutting down gracefully...`);
   try {
     await shutdown();
@@ -67,6 +88,11 @@ main()
     process.exit(0);
   })
   .catch(async (error) => {
+    if (error instanceof IndexingCancelledError) {
+      console.error('Indexing cancelled. Chunks committed so far are kept; run the index command again to resume.');
+      await shutdown();
+      process.exit(130);
+    }
     console.error('An error occurred:', error);
     await shutdown();
     process.exit(1);
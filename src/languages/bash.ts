@@ -10,6 +10,7 @@ import { LanguageConfiguration } from '../utils/parser';
 export const bashConfig: LanguageConfiguration = {
   name: 'bash',
   fileSuffixes: ['.sh', '.bash', '.zsh', '.ksh', '.bats'],
+  interpreters: ['sh', 'bash', 'zsh', 'ksh', 'dash', 'ash'],
   parser: bash,
 
   queries: [
@@ -18,18 +18,20 @@ export const cConfig: LanguageConfiguration = {
     '(union_specifier) @union',
     '(enum_specifier) @enum',
     '(type_definition) @type',
-    '(comment) @comment',
+    // Doc comments are part of the declaration they document (see leadingDocs)
+    '((comment) @comment (#not-match? @comment "^(///|/[*][*])"))',
     '(function_definition) @function',
     '(call_expression) @call',
     '(return_statement) @return',
     '(if_statement) @if',
     '(expression_statement) @expression',
-    '(_ (comment)+ @doc)',
+    '((_ (comment)+ @doc) (#not-match? @doc "^(///|/[*][*])"))',
     `
     (
       (comment)+ @doc
       .
       (function_definition) @function
+      (#not-match? @doc "^(///|/[*][*])")
     ) @function_with_doc
     `,
     `
@@ -37,6 +39,7 @@ export const cConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (struct_specifier) @struct
+      (#not-match? @doc "^(///|/[*][*])")
     ) @struct_with_doc
     `,
     `
@@ -44,6 +47,7 @@ export const cConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (union_specifier) @union
+      (#not-match? @doc "^(///|/[*][*])")
     ) @union_with_doc
     `,
     `
@@ -51,6 +55,7 @@ export const cConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (enum_specifier) @enum
+      (#not-match? @doc "^(///|/[*][*])")
     ) @enum_with_doc
     `,
     `
@@ -58,6 +63,7 @@ export const cConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (declaration) @variable
+      (#not-match? @doc "^(///|/[*][*])")
     ) @variable_with_doc
     `,
     `
@@ -65,15 +71,21 @@ export const cConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (type_definition) @type
+      (#not-match? @doc "^(///|/[*][*])")
     ) @type_with_doc
     `,
   ],
+  leadingDocs: { commentPrefixes: ['///', '/**'] },
   importQueries: [
     '(preproc_include path: (system_lib_string) @import.path)',
     '(preproc_include path: (string_literal) @import.path)',
   ],
   symbolQueries: [
     '(function_definition declarator: (function_declarator declarator: (identifier) @function.name))',
+    '(function_definition declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @function.name)))',
+    // Prototypes, e.g. in headers: declared here but defined elsewhere
+    '(declaration type: (_) declarator: (function_declarator declarator: (identifier) @function.declaration))',
+    '(declaration type: (_) declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @function.declaration)))',
     '(declaration declarator: (init_declarator declarator: (identifier) @variable.name))',
     '(declaration declarator: (identifier) @variable.name)',
     '(struct_specifier name: (type_identifier) @struct.name)',
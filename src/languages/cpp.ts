@@ -28,14 +28,15 @@ export const cppConfig: LanguageConfiguration = {
     '(type_definition) @type',
 
     // Statements
-    '(comment) @comment',
+    // Doc comments are part of the declaration they document (see leadingDocs)
+    '((comment) @comment (#not-match? @comment "^(///|/[*][*])"))',
     '(call_expression) @call',
     '(return_statement) @return',
     '(if_statement) @if',
     '(expression_statement) @expression',
 
     // Documentation patterns
-    '(_ (comment)+ @doc)',
+    '((_ (comment)+ @doc) (#not-match? @doc "^(///|/[*][*])"))',
 
     // Function with documentation
     `
@@ -43,6 +44,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (function_definition) @function
+      (#not-match? @doc "^(///|/[*][*])")
     ) @function_with_doc
     `,
 
@@ -52,6 +54,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (class_specifier) @class
+      (#not-match? @doc "^(///|/[*][*])")
     ) @class_with_doc
     `,
 
@@ -61,6 +64,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (struct_specifier) @struct
+      (#not-match? @doc "^(///|/[*][*])")
     ) @struct_with_doc
     `,
 
@@ -70,6 +74,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (namespace_definition) @namespace
+      (#not-match? @doc "^(///|/[*][*])")
     ) @namespace_with_doc
     `,
 
@@ -79,6 +84,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (template_declaration) @template
+      (#not-match? @doc "^(///|/[*][*])")
     ) @template_with_doc
     `,
 
@@ -88,6 +94,7 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (declaration) @variable
+      (#not-match? @doc "^(///|/[*][*])")
     ) @variable_with_doc
     `,
 
@@ -97,10 +104,13 @@ export const cppConfig: LanguageConfiguration = {
       (comment)+ @doc
       .
       (type_definition) @type
+      (#not-match? @doc "^(///|/[*][*])")
     ) @type_with_doc
     `,
   ],
 
+  leadingDocs: { commentPrefixes: ['///', '/**'] },
+
   importQueries: [
     // System includes: #include <iostream>
     '(preproc_include path: (system_lib_string) @import.path)',
@@ -112,10 +122,18 @@ export const cppConfig: LanguageConfiguration = {
     // Function definitions
     '(function_definition declarator: (function_declarator declarator: (identifier) @function.name))',
     '(function_definition declarator: (function_declarator declarator: (qualified_identifier (identifier) @function.name)))',
+    '(function_definition declarator: (function_declarator declarator: (qualified_identifier (qualified_identifier (identifier) @function.name))))',
+    '(function_definition declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @function.name)))',
 
     // Method definitions (within classes)
     '(function_definition declarator: (function_declarator declarator: (field_identifier) @method.name))',
 
+    // Declarations without a body, e.g. in headers: defined elsewhere
+    '(declaration type: (_) declarator: (function_declarator declarator: (identifier) @function.declaration))',
+    '(declaration type: (_) declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @function.declaration)))',
+    '(field_declaration declarator: (function_declarator declarator: (field_identifier) @method.declaration))',
+    '(field_declaration declarator: (pointer_declarator declarator: (function_declarator declarator: (field_identifier) @method.declaration)))',
+
     // Variable declarations
     '(declaration declarator: (init_declarator declarator: (identifier) @variable.name))',
     '(declaration declarator: (identifier) @variable.name)',
@@ -0,0 +1,9 @@
+import { LanguageConfiguration } from '../utils/parser';
+
+export const dockerfileConfig: LanguageConfiguration = {
+  name: 'dockerfile',
+  fileSuffixes: ['.dockerfile'],
+  fileNames: ['Dockerfile', 'Containerfile'],
+  parser: null,
+  queries: [],
+};
@@ -70,4 +70,5 @@ export const goConfig: LanguageConfiguration = {
     '(const_spec name: (identifier) @export.name (#match? @export.name "^[A-Z]"))',
     '(var_spec name: (identifier) @export.name (#match? @export.name "^[A-Z]"))',
   ],
+  stringLiteralTypes: ['interpreted_string_literal', 'raw_string_literal'],
 };
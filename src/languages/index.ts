@@ -4,6 +4,7 @@ import { javascript } from './javascript';
 import { markdown } from './markdown';
 import { yamlConfig } from './yaml';
 import { javaConfig } from './java';
+import { kotlinConfig } from './kotlin';
 import { goConfig } from './go';
 import { pythonConfig } from './python';
 import { jsonConfig } from './json';
@@ -16,6 +17,10 @@ import { cppConfig } from './cpp';
 import { bashConfig } from './bash';
 import { scalaConfig } from './scala';
 import { hclConfig } from './hcl';
+import { dockerfileConfig } from './dockerfile';
+import { makefileConfig } from './makefile';
+import { rustConfig } from './rust';
+import { sqlConfig } from './sql';
 import { LanguageConfiguration } from '../utils/parser';
 import {
   validateLanguageConfiguration,
@@ -29,6 +34,7 @@ export const languageConfigurations = {
   markdown,
   yaml: yamlConfig,
   java: javaConfig,
+  kotlin: kotlinConfig,
   go: goConfig,
   python: pythonConfig,
   json: jsonConfig,
@@ -41,6 +47,10 @@ export const languageConfigurations = {
   bash: bashConfig,
   scala: scalaConfig,
   hcl: hclConfig,
+  dockerfile: dockerfileConfig,
+  makefile: makefileConfig,
+  rust: rustConfig,
+  sql: sqlConfig,
 } as const;
 
 /**
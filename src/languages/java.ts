@@ -10,46 +10,40 @@ export const javaConfig: LanguageConfiguration = {
     '(if_statement) @if',
     '(return_statement) @return',
     '(method_declaration) @method',
+    '(constructor_declaration) @method',
     '(class_declaration) @class',
+    '(interface_declaration) @interface',
+    '(enum_declaration) @enum',
+    '(record_declaration) @record',
+    '(field_declaration) @variable',
     '(line_comment) @comment',
-    '(block_comment) @comment',
+    // Javadoc is part of the declaration it documents (see leadingDocs)
+    '((block_comment) @comment (#not-match? @comment "^/[*][*]"))',
     '(marker_annotation) @annotation',
     '(annotation) @annotation',
-    `
-    (
-      (block_comment) @doc
-      .
-      (class_declaration) @class
-    )
-    `,
-    `
-    (
-      (block_comment) @doc
-      .
-      (method_declaration) @method
-    )
-    `,
-    `
-    (
-      (block_comment) @doc
-      .
-      (field_declaration) @variable
-    )
-    `,
   ],
+  leadingDocs: { commentPrefixes: ['/**'] },
   importQueries: ['(import_declaration (scoped_identifier (identifier) @import.symbol) @import.path)'],
   symbolQueries: [
     '(class_declaration name: (identifier) @class.name)',
+    '(interface_declaration name: (identifier) @interface.name)',
+    '(enum_declaration name: (identifier) @enum.name)',
+    '(record_declaration name: (identifier) @class.name)',
     '(method_declaration name: (identifier) @method.name)',
-    '(variable_declarator (identifier) @variable.name)',
+    '(constructor_declaration name: (identifier) @method.name)',
+    '(field_declaration declarator: (variable_declarator name: (identifier) @field.name))',
+    '(local_variable_declaration declarator: (variable_declarator name: (identifier) @variable.name))',
     '(method_invocation name: (identifier) @method.call)',
     '(object_creation_expression type: (type_identifier) @class.instantiation)',
     '(variable_declarator value: (identifier) @variable.usage)',
   ],
+  // The modifiers are captured first so that annotated declarations record their export on the line they start
   exportQueries: [
-    '(class_declaration (modifiers "public") name: (identifier) @export.name)',
-    '(interface_declaration (modifiers "public") name: (identifier) @export.name)',
-    '(enum_declaration (modifiers "public") name: (identifier) @export.name)',
-    '(method_declaration (modifiers "public") name: (identifier) @export.name)',
+    '(class_declaration (modifiers "public") @modifiers name: (identifier) @export.name)',
+    '(interface_declaration (modifiers "public") @modifiers name: (identifier) @export.name)',
+    '(enum_declaration (modifiers "public") @modifiers name: (identifier) @export.name)',
+    '(record_declaration (modifiers "public") @modifiers name: (identifier) @export.name)',
+    '(method_declaration (modifiers "public") @modifiers name: (identifier) @export.name)',
   ],
+  stringLiteralTypes: ['string_literal'],
 };
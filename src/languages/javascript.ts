@@ -5,6 +5,7 @@ import { LanguageConfiguration } from '../utils/parser';
 export const javascript: LanguageConfiguration = {
   name: 'javascript',
   fileSuffixes: ['.js', '.jsx'],
+  interpreters: ['node', 'nodejs', 'bun'],
   parser: js,
   queries: [
     '(import_statement) @import',
@@ -18,6 +19,18 @@ export const javascript: LanguageConfiguration = {
     '(call_expression) @call',
     '(comment) @comment',
     '(function_declaration) @function',
+    // Each function assigned in a multi-declarator statement ("const a = () => {}, b = () => {}") gets its own
+    // chunk; single declarations are already covered by the lexical_declaration chunk.
+    `
+    (lexical_declaration
+      (variable_declarator value: [(arrow_function) (function_expression)]) @function
+      ",")
+    `,
+    `
+    (lexical_declaration
+      ","
+      (variable_declarator value: [(arrow_function) (function_expression)]) @function)
+    `,
     `
     (
       (comment)+ @doc
@@ -84,4 +97,5 @@ export const javascript: LanguageConfiguration = {
     '(export_statement "*" @export.namespace (string) @export.source)',
     '(export_statement (export_clause) (string) @export.source)',
   ],
+  stringLiteralTypes: ['string', 'template_string'],
 };
@@ -0,0 +1,49 @@
+import kotlin from '@tree-sitter-grammars/tree-sitter-kotlin';
+import { LanguageConfiguration } from '../utils/parser';
+
+const PUBLIC = '(#not-match? @modifiers "private|internal")';
+
+export const kotlinConfig: LanguageConfiguration = {
+  name: 'kotlin',
+  fileSuffixes: ['.kt'],
+  parser: kotlin,
+  queries: [
+    '(import_header) @import',
+    '(class_declaration) @class',
+    '(object_declaration) @object',
+    '(companion_object) @object',
+    '(function_declaration) @function',
+    '(secondary_constructor) @function',
+    '(property_declaration) @variable',
+    '(type_alias) @type',
+    // KDoc is part of the declaration it documents (see leadingDocs)
+    '(line_comment) @comment',
+    '((multiline_comment) @comment (#not-match? @comment "^/[*][*]"))',
+  ],
+  leadingDocs: { commentPrefixes: ['/**'] },
+  importQueries: ['(import_header (identifier (simple_identifier) @import.symbol .) @import.path)'],
+  symbolQueries: [
+    '(class_declaration "interface" (type_identifier) @interface.name)',
+    '(class_declaration "class" (type_identifier) @class.name)',
+    '(object_declaration (type_identifier) @object.name)',
+    '(source_file (function_declaration (simple_identifier) @function.name))',
+    '(class_body (function_declaration (simple_identifier) @method.name))',
+    '(source_file (property_declaration (variable_declaration (simple_identifier) @variable.name)))',
+    '(class_body (property_declaration (variable_declaration (simple_identifier) @field.name)))',
+    '(class_parameter (simple_identifier) @field.name)',
+    '(call_expression (simple_identifier) @function.call)',
+    '(call_expression (navigation_expression (navigation_suffix (simple_identifier) @method.call)))',
+  ],
+  // Top-level declarations are public unless marked `private` or `internal`. Unmodified declarations
+  // start with their name or, for generic and extension functions, its type parameters and receiver;
+  // modifiers are captured first so that annotated declarations record their export on the line they start
+  exportQueries: [
+    '(source_file (class_declaration . (type_identifier) @export.name))',
+    '(source_file (object_declaration . (type_identifier) @export.name))',
+    '(source_file (function_declaration . (simple_identifier) @export.name))',
+    '(source_file (function_declaration . [(type_parameters) (user_type) (nullable_type)] (simple_identifier) @export.name))',
+    `(source_file (class_declaration (modifiers) @modifiers (type_identifier) @export.name ${PUBLIC}))`,
+    `(source_file (object_declaration (modifiers) @modifiers (type_identifier) @export.name ${PUBLIC}))`,
+    `(source_file (function_declaration (modifiers) @modifiers (simple_identifier) @export.name ${PUBLIC}))`,
+  ],
+};
@@ -0,0 +1,9 @@
+import { LanguageConfiguration } from '../utils/parser';
+
+export const makefileConfig: LanguageConfiguration = {
+  name: 'makefile',
+  fileSuffixes: ['.mk'],
+  fileNames: ['Makefile', 'GNUmakefile', 'makefile'],
+  parser: null,
+  queries: [],
+};
@@ -4,6 +4,7 @@ import python from 'tree-sitter-python';
 export const pythonConfig: LanguageConfiguration = {
   name: 'python',
   fileSuffixes: ['.py'],
+  interpreters: ['python'],
   parser: python,
   queries: [
     '(import_statement) @import',
@@ -13,6 +14,7 @@ export const pythonConfig: LanguageConfiguration = {
     '(return_statement) @return',
     '(function_definition) @function',
     '(class_definition) @class',
+    '(decorated_definition) @decorated',
     '(call) @call',
     '(comment) @comment',
     `
@@ -52,6 +54,9 @@ export const pythonConfig: LanguageConfiguration = {
   exportQueries: [
     '(module (function_definition name: (identifier) @export.name))',
     '(module (class_definition name: (identifier) @export.name))',
+    '(module (decorated_definition definition: (function_definition name: (identifier) @export.name)))',
+    '(module (decorated_definition definition: (class_definition name: (identifier) @export.name)))',
     '(module (expression_statement (assignment left: (identifier) @export.name (#match? @export.name "^[A-Z_][A-Z0-9_]*$"))))',
   ],
+  stringLiteralTypes: ['string'],
 };
@@ -0,0 +1,59 @@
+import rust from 'tree-sitter-rust';
+import { LanguageConfiguration } from '../utils/parser';
+
+export const rustConfig: LanguageConfiguration = {
+  name: 'rust',
+  fileSuffixes: ['.rs'],
+  parser: rust,
+  queries: [
+    '(use_declaration) @import',
+    '(function_item) @function',
+    '(function_signature_item) @function',
+    '(struct_item) @struct',
+    '(enum_item) @enum',
+    '(union_item) @union',
+    '(trait_item) @trait',
+    '(impl_item) @impl',
+    '(type_item) @type',
+    '(const_item) @const',
+    '(static_item) @static',
+    '(macro_definition) @macro',
+    // Doc comments are part of the item they document (see leadingDocs)
+    '((line_comment) @comment (#not-match? @comment "^///"))',
+    '((block_comment) @comment (#not-match? @comment "^/[*][*]"))',
+  ],
+  leadingDocs: { commentPrefixes: ['///', '/**'], attributeTypes: ['attribute_item'] },
+  importQueries: ['(use_declaration argument: (_) @import.path)'],
+  symbolQueries: [
+    '(source_file (function_item name: (identifier) @function.name))',
+    '(mod_item body: (declaration_list (function_item name: (identifier) @function.name)))',
+    '(impl_item body: (declaration_list (function_item name: (identifier) @method.name)))',
+    '(trait_item body: (declaration_list (function_item name: (identifier) @method.name)))',
+    '(function_signature_item name: (identifier) @method.name)',
+    '(struct_item name: (type_identifier) @struct.name)',
+    '(enum_item name: (type_identifier) @enum.name)',
+    '(union_item name: (type_identifier) @union.name)',
+    '(trait_item name: (type_identifier) @trait.name)',
+    '(type_item name: (type_identifier) @type.name)',
+    '(const_item name: (identifier) @variable.name)',
+    '(static_item name: (identifier) @variable.name)',
+    '(macro_definition name: (identifier) @macro.name)',
+    '(impl_item trait: (_) @trait.implementation)',
+    '(call_expression function: (identifier) @function.call)',
+    '(call_expression function: (scoped_identifier name: (identifier) @function.call))',
+    '(call_expression function: (field_expression field: (field_identifier) @method.call))',
+    '(macro_invocation macro: (identifier) @macro.call)',
+    '(struct_expression name: (type_identifier) @struct.instantiation)',
+  ],
+  // `pub` items; restricted visibility such as `pub(crate)` is not public API
+  exportQueries: [
+    '(function_item (visibility_modifier) @visibility name: (identifier) @export.name (#eq? @visibility "pub"))',
+    '(struct_item (visibility_modifier) @visibility name: (type_identifier) @export.name (#eq? @visibility "pub"))',
+    '(enum_item (visibility_modifier) @visibility name: (type_identifier) @export.name (#eq? @visibility "pub"))',
+    '(union_item (visibility_modifier) @visibility name: (type_identifier) @export.name (#eq? @visibility "pub"))',
+    '(trait_item (visibility_modifier) @visibility name: (type_identifier) @export.name (#eq? @visibility "pub"))',
+    '(type_item (visibility_modifier) @visibility name: (type_identifier) @export.name (#eq? @visibility "pub"))',
+    '(const_item (visibility_modifier) @visibility name: (identifier) @export.name (#eq? @visibility "pub"))',
+    '(static_item (visibility_modifier) @visibility name: (identifier) @export.name (#eq? @visibility "pub"))',
+  ],
+};
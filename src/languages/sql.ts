@@ -0,0 +1,8 @@
+import { LanguageConfiguration } from '../utils/parser';
+
+export const sqlConfig: LanguageConfiguration = {
+  name: 'sql',
+  fileSuffixes: ['.sql'],
+  parser: null,
+  queries: [],
+};
@@ -5,7 +5,10 @@ import { LanguageConfiguration } from '../utils/parser';
 export const typescript: LanguageConfiguration = {
   name: 'typescript',
   fileSuffixes: ['.ts', '.tsx'],
+  interpreters: ['ts-node', 'tsx', 'deno'],
   parser: ts.typescript,
+  // JSX only parses with the TSX dialect of the grammar
+  suffixParsers: { '.tsx': ts.tsx },
   queries: [
     '(import_statement) @import',
     '(lexical_declaration) @variable',
@@ -14,8 +17,21 @@ export const typescript: LanguageConfiguration = {
     '(export_statement) @export',
     '(comment) @comment',
     '(function_declaration) @function',
+    '(method_definition) @method',
     '(type_alias_declaration) @type',
     '(call_expression) @call',
+    // Each function assigned in a multi-declarator statement ("const a = () => {}, b = () => {}") gets its own
+    // chunk; single declarations are already covered by the lexical_declaration chunk.
+    `
+    (lexical_declaration
+      (variable_declarator value: [(arrow_function) (function_expression)]) @function
+      ",")
+    `,
+    `
+    (lexical_declaration
+      ","
+      (variable_declarator value: [(arrow_function) (function_expression)]) @function)
+    `,
     '(_ (comment)+ @doc)',
     `
     (
@@ -105,4 +121,5 @@ export const typescript: LanguageConfiguration = {
     '(export_statement "*" @export.namespace (string) @export.source)',
     '(export_statement (export_clause) (string) @export.source)',
   ],
+  stringLiteralTypes: ['string', 'template_string'],
 };
@@ -0,0 +1,918 @@
+/**
+ * Library API for embedding the indexer into other tools.
+ *
+ * ```ts
+ * const index = await createIndex({ index: 'my-repo', store: 'sqlite', embedder: 'noop', root: '/src/my-repo' });
+ * await index.addPath('src');
+ * const hits = await index.search('parse the queue', { limit: 5 });
+ * await index.close();
+ * ```
+ *
+ * Nothing here exits the process or writes to stdout/stderr: failures are thrown (or reported in
+ * `AddPathResult.errors`), and log entries go to the `logger` option.
+ */
+import fs from 'fs';
+import path from 'path';
+import { ChunkDeduplicator, validateDedupThreshold } from './utils/chunk_dedup';
+import { ChunkStrategies, validateChunkStrategies } from './utils/chunk_strategy';
+import {
+  ChunkStore,
+  canReuseStoredVectors,
+  createChunkStore,
+  deleteChangedFile,
+  getStoredVectors,
+} from './utils/chunk_store';
+import { CodeChunk, StoreStats } from './utils/elasticsearch';
+import { EmbedTemplate, parseEmbedTemplate } from './utils/embed_template';
+import {
+  Embedder,
+  embedMissing,
+  getConfiguredEmbedder,
+  getEmbedder,
+  validateEmbedderDimensions,
+} from './utils/embedder';
+import { CachedEmbedder, EmbeddingCache } from './utils/embedding_cache';
+import { detectFileChanges } from './utils/file_changes';
+import { FileHashCache } from './utils/file_hash_cache';
+import { FileFilterOptions, createFileFilter, walkFiles } from './utils/file_walker';
+import { checkoutRef } from './utils/git_ref';
+import { DEFAULT_HYBRID_ALPHA, FUSION_METHODS, FusionMethod, SEARCH_MODES, SearchMode } from './utils/hybrid_search';
+import { IndexArchiveManifest, exportIndexArchive, importIndexArchive } from './utils/index_archive';
+import { IndexError, getParseErrors } from './utils/index_errors';
+import { createLanguageFileMatcher } from './utils/language_detection';
+import { LogSink, withLogSink, logger } from './utils/logger';
+import { LanguageParser } from './utils/parser';
+import { ProgressCallback, ProgressTracker } from './utils/progress';
+import { Reranker, getConfiguredReranker, getReranker, listRerankers } from './utils/reranker';
+import { SEARCH_SORTS, SearchHit, SearchHitLocation, SearchSort, searchIndex } from './utils/search';
+import { POST_FILTER_CANDIDATE_FACTOR, SearchFilters, createPathMatcher } from './utils/search_filters';
+import { SymbolHit, searchSymbols } from './utils/symbol_search';
+import { TokenCounter } from './utils/token_counter';
+import { WorkspaceStats, getDefaultWorkspace } from './utils/workspace';
+import { LanguageName, languageConfigurations } from './languages';
+import { embeddingConfig, indexingConfig, rerankConfig } from './config';
+
+export type { ChunkStore } from './utils/chunk_store';
+export type { ChunkStrategies, ChunkStrategy } from './utils/chunk_strategy';
+export type { ChunkBlame, StoreStats } from './utils/elasticsearch';
+export type { Embedder, EmbedderOptions, HttpEmbedderOptions } from './utils/embedder';
+export { EmbedderError, HttpEmbedder, registerEmbedder } from './utils/embedder';
+export type { IndexArchiveManifest } from './utils/index_archive';
+export type { IndexError } from './utils/index_errors';
+export type { LogSink } from './utils/logger';
+export type { SkipReason } from './utils/parser';
+export type { ProgressCallback, ProgressEvent, ProgressPhase } from './utils/progress';
+export type { Reranker } from './utils/reranker';
+export { registerReranker } from './utils/reranker';
+export type { SearchHit, SearchHitLocation, SearchSort } from './utils/search';
+export type { SearchFilters } from './utils/search_filters';
+export type { SymbolHit, SymbolMatch } from './utils/symbol_search';
+export type { TokenCounter } from './utils/token_counter';
+export { estimateTokens } from './utils/token_counter';
+export type { WorkspaceStats } from './utils/workspace';
+
+/** Chunks written to the store per request. */
+const STORE_BATCH_SIZE = 100;
+
+export interface IndexOptions extends FileFilterOptions {
+  /** Index name: the Elasticsearch index, the SQLite database `<index>.db`, or the Qdrant collection. */
+  index: string;
+  /**
+   * Store backend name (`elasticsearch`, `sqlite`, `qdrant`) or a store instance (default: `SCS_IDXR_STORE`).
+   * A store instance is owned by the index from then on and closed by `close()`.
+   */
+  store?: string | ChunkStore;
+  /**
+   * Registered embedder name or an embedder instance (default: `SCS_IDXR_EMBEDDER`). `null` disables
+   * client-side embedding, leaving vectors to Elasticsearch `semantic_text`.
+   */
+  embedder?: string | Embedder | null;
+  /**
+   * Text the embedder embeds per chunk, with fields such as `{symbol}` and `{body}` (default:
+   * `SCS_IDXR_EMBED_TEMPLATE`, else the chunk's `semantic_text`). See `parseEmbedTemplate`.
+   */
+  embedTemplate?: string;
+  /**
+   * Reuses vectors from the on-disk embedding cache at `SCS_IDXR_EMBED_CACHE_PATH` and caches the ones
+   * embedded, like the `index` and `worker` commands (default: `SCS_IDXR_EMBED_CACHE`). `false` embeds
+   * every chunk, like `--no-embed-cache`.
+   */
+  embedCache?: boolean;
+  /**
+   * Registered reranker name or a reranker instance used by searches with `rerank` (default:
+   * `SCS_IDXR_RERANKER`). It is only created once a search asks for reranking.
+   */
+  reranker?: string | Reranker | null;
+  /** Languages to index (default: all supported languages). */
+  languages?: string[];
+  /** Directory that indexed paths are relative to (default: the current working directory). */
+  root?: string;
+  /** Branch recorded on indexed locations (default: `main`). */
+  branch?: string;
+  /**
+   * Workspace recorded on indexed locations, so several checkouts can share one index (default: the name
+   * of the `root` directory). Indexing, `deletePath`, and `reindexPath` only touch files of this workspace.
+   */
+  workspace?: string;
+  /**
+   * Folds duplicate and near-duplicate chunks into one canonical chunk before embedding, see
+   * `ChunkDeduplicator` (default: `SCS_IDXR_DEDUP`). Chunks are compared within one `addPath` or `addRef` call.
+   */
+  dedup?: boolean;
+  /** SimHash similarity in (0, 1] from which `dedup` folds two chunks (default: `SCS_IDXR_DEDUP_THRESHOLD`). */
+  dedupThreshold?: number;
+  /**
+   * Records the commit, author, and date that last changed each chunk's lines, from `git blame`
+   * (default: `SCS_IDXR_INCLUDE_BLAME`). Each file is blamed once per `addPath` or `addRef`, which is
+   * still much slower than parsing it. Searches return it as `SearchHit.blame`.
+   */
+  includeBlame?: boolean;
+  /**
+   * Files larger than this many bytes are skipped and reported in `AddPathResult.errors` (default:
+   * `SCS_IDXR_MAX_FILE_BYTES`, 5 MiB). Binary files are always skipped.
+   */
+  maxFileBytes?: number;
+  /**
+   * Indexes SQL queries found in the string literals of Go, Python, Java, JavaScript, and TypeScript code
+   * as `sql` chunks linked to their function (default: `SCS_IDXR_EXTRACT_EMBEDDED_SQL`).
+   */
+  extractEmbeddedSql?: boolean;
+  /**
+   * How each language is chunked, e.g. `{ go: 'symbol', json: 'whole-file', yaml: 'whole-file' }`
+   * (default: `SCS_IDXR_CHUNK_STRATEGY`). Languages left out are chunked the way their language does.
+   */
+  chunkStrategy?: ChunkStrategies;
+  /**
+   * Chunks with more tokens than this are split at line breaks (default: `SCS_IDXR_MAX_CHUNK_TOKENS`, 8192);
+   * 0 disables the check.
+   */
+  maxChunkTokens?: number;
+  /**
+   * Counts the tokens `maxChunkTokens` limits (default: a length-based estimate, see `estimateTokens`).
+   * Pass the embedding model's tokenizer for an exact budget; an `HttpEmbedder` takes one of its own.
+   */
+  tokenCounter?: TokenCounter;
+  /**
+   * Most chunks of a file held in memory with their vectors at a time: larger files are embedded and
+   * stored that many chunks at a time (default: `SCS_IDXR_MAX_IN_FLIGHT_CHUNKS`, 1000).
+   */
+  maxInFlightChunks?: number;
+  /** Receives the log entries of this index; without one, nothing is logged. */
+  logger?: LogSink;
+  /**
+   * Called as `addPath` and `addRef` walk, parse, embed, and store files. The file total is reported
+   * before the first chunk is embedded; counts start over with every call.
+   */
+  progress?: ProgressCallback;
+}
+
+export interface AddPathOptions {
+  /** Aborts the run between files and embedding requests; the returned promise then rejects. */
+  signal?: AbortSignal;
+  /**
+   * Re-index files even if their content hash matches the indexed copy, and embed all their chunks again
+   * instead of reusing stored vectors.
+   */
+  force?: boolean;
+}
+
+export interface AddPathResult {
+  /** Files that were parsed and written to the store. */
+  indexedFiles: number;
+  /** Files skipped because the index already holds the same content. */
+  unchangedFiles: number;
+  /** Indexed files under the path that no longer exist or are now left out by the filters, removed from the index. */
+  deletedFiles: number;
+  /** Chunks written to the store. */
+  chunks: number;
+  /**
+   * Files that could not be indexed or were indexed in a degraded form. Files left out for their size or
+   * content are among them, with `skipped` set.
+   */
+  errors: IndexError[];
+}
+
+export interface DeletePathResult {
+  /** Files whose locations were removed, on every branch. */
+  deletedFiles: number;
+  /** Locations removed, one per occurrence of a chunk in one of the files. */
+  deletedLocations: number;
+  /** Chunks removed because none of their locations was left; chunks also found in other files are kept. */
+  deletedChunks: number;
+}
+
+export interface ReindexPathResult extends AddPathResult {
+  /** What was removed from the index before the path was indexed again. */
+  removed: DeletePathResult;
+}
+
+export interface AddRefResult extends AddPathResult {
+  /** SHA of the commit the ref resolved to; the indexed locations are recorded under it as their branch. */
+  commit: string;
+}
+
+export interface SearchOptions {
+  /** Maximum number of hits (default: 10). */
+  limit?: number;
+  /** Retrieval signal(s) to rank by (default: `semantic`). */
+  mode?: SearchMode;
+  /** Weight of the semantic signal in hybrid mode, in [0, 1] (default: 0.5). */
+  alpha?: number;
+  /** How hybrid mode combines the two rankings (default: `rrf`). */
+  fusion?: FusionMethod;
+  filters?: SearchFilters;
+  /** Hits scoring below this value are dropped; with `rerank`, this applies to the reranker's scores. */
+  minScore?: number;
+  /** Append the words of compound identifiers (`ParseJSONConfig`) to the embedded query (default: false). */
+  expandQuery?: boolean;
+  /** Rescore the top candidates with the reranker before the best `limit` are returned (default: false). */
+  rerank?: boolean;
+  /** Candidates retrieved for the reranker (default: `SCS_IDXR_RERANK_CANDIDATES` or 50). */
+  rerankCandidates?: number;
+  /** Lines before and after each hit to read from the files under `root` (default: 0). */
+  contextLines?: number;
+  /** `score` ranks best match first; `recency` orders the same hits newest last commit first (default: `score`). */
+  sort?: SearchSort;
+  /** Only return hits whose lines were last changed at or after this date; needs an index built with blame. */
+  changedSince?: string | Date;
+  /**
+   * Candidates retrieved per hit when a filter can only be checked after retrieval, at least 1: `changedSince`,
+   * and `filters.path` and `filters.workspace` on Elasticsearch and Qdrant (default: 10). While fewer hits than
+   * `limit` pass, more candidates are retrieved, up to 10,000.
+   */
+  overfetchFactor?: number;
+  /** Add `explain` to every hit: each signal's score and fusion weight, and the reranker score (default: false). */
+  explain?: boolean;
+}
+
+export interface SearchSimilarOptions extends SearchOptions {
+  /**
+   * Where the code comes from, with `filePath` relative to the index root or absolute. Hits at locations
+   * overlapping these lines are left out, so the code does not find itself; a chunk with copies elsewhere
+   * is returned at one of those.
+   */
+  exclude?: SearchHitLocation;
+}
+
+export interface FindSymbolsOptions {
+  /** Maximum number of hits (default: 10). */
+  limit?: number;
+  filters?: SearchFilters;
+}
+
+export interface IndexStats extends StoreStats {
+  /** Chunk store backend, e.g. `sqlite`. */
+  backend: string;
+  /** Dimensions of the stored vectors, or null if the store holds none. */
+  vectorDimensions: number | null;
+  /** Name of the embedder queries are embedded with, or null without one. */
+  embedder: string | null;
+}
+
+function toErrorMessage(error: unknown): string {
+  if (error instanceof Error) {
+    return error.message;
+  }
+  return typeof error === 'string' ? error : JSON.stringify(error);
+}
+
+function resolveEmbedder(embedder: IndexOptions['embedder']): Embedder | undefined {
+  if (embedder === undefined) {
+    return getConfiguredEmbedder();
+  }
+  if (typeof embedder === 'string') {
+    return getEmbedder(embedder);
+  }
+  return embedder ?? undefined;
+}
+
+function resolveReranker(reranker: IndexOptions['reranker']): Reranker | undefined {
+  if (reranker === undefined) {
+    return getConfiguredReranker();
+  }
+  if (typeof reranker === 'string') {
+    return getReranker(reranker);
+  }
+  return reranker ?? undefined;
+}
+
+function resolveLanguages(languages: string[] | undefined): LanguageName[] {
+  if (languages === undefined) {
+    return Object.keys(languageConfigurations) as LanguageName[];
+  }
+  const names = languages.map((name) => name.trim().toLowerCase());
+  const unknown = names.filter((name) => !(name in languageConfigurations));
+  if (names.length === 0 || unknown.length > 0) {
+    throw new Error(
+      `Unknown languages: ${unknown.join(', ') || '(none given)'}. ` +
+        `Supported languages: ${Object.keys(languageConfigurations).join(', ')}.`
+    );
+  }
+  return names as LanguageName[];
+}
+
+/**
+ * Matches a repository-relative path and every file under it, or, with `*` or `?`, a glob over the
+ * whole path (see `createPathMatcher`).
+ *
+ * @throws If the pattern is empty or names the whole repository.
+ */
+function createSubtreeMatcher(pattern: string): (filePath: string) => boolean {
+  const normalized = pattern.trim().replace(/^\.\//, '').replace(/\/+$/, '');
+  if (normalized === '' || normalized === '.' || normalized === '**') {
+    throw new Error(`Path "${pattern}" names the whole repository; recreate the index instead.`);
+  }
+  if (/[*?]/.test(normalized)) {
+    return createPathMatcher(normalized);
+  }
+  return (filePath) => filePath === normalized || filePath.startsWith(`${normalized}/`);
+}
+
+/**
+ * An index of one repository checkout, backed by a chunk store that other checkouts may share as
+ * other workspaces. Searches cover every workspace unless `filters.workspace` is set.
+ *
+ * Concurrency: `search`, `findSymbols`, `stats`, and `workspaces` are safe to call concurrently, also while
+ * `addPath` runs. Concurrent `addPath`, `addRef`, `deletePath`, `reindexPath`, `exportArchive`, and
+ * `importArchive` calls are safe but run one at a time, in call order.
+ * `close` waits for pending calls; no method may be called once `close` was called.
+ */
+export class Index {
+  private readonly store: ChunkStore;
+  private readonly embedder: Embedder | undefined;
+  private readonly embeddingCache: EmbeddingCache | undefined;
+  private readonly embedTemplate: EmbedTemplate;
+  /** Source of `embedTemplate`, recorded on the store with the embedder, see `canReuseStoredVectors`. */
+  private readonly embedTemplateSource: string;
+  private readonly languages: LanguageName[];
+  private parser?: LanguageParser;
+  private reranker?: Reranker;
+  private readonly isLanguageFile: (filePath: string) => boolean;
+  private readonly root: string;
+  private readonly branch: string;
+  private readonly workspace: string;
+  private readonly dedupThreshold: number | undefined;
+  private readonly maxInFlightChunks: number;
+  private readonly options: IndexOptions;
+  /** Content hashes of the files seen by earlier calls, so unchanged files are not hashed again. */
+  private readonly hashCache = new FileHashCache();
+  private isSetUp = false;
+  private closed = false;
+  private writes: Promise<unknown> = Promise.resolve();
+
+  /** Use `createIndex`. */
+  private constructor(
+    options: IndexOptions,
+    store: ChunkStore,
+    embedder: Embedder | undefined,
+    embeddingCache: EmbeddingCache | undefined
+  ) {
+    this.languages = resolveLanguages(options.languages);
+    this.options = options;
+    this.store = store;
+    this.embeddingCache = embeddingCache;
+    this.embedder = embedder && embeddingCache ? new CachedEmbedder(embedder, embeddingCache) : embedder;
+    this.embedTemplateSource = options.embedTemplate ?? embeddingConfig.template;
+    this.embedTemplate = parseEmbedTemplate(this.embedTemplateSource);
+    this.isLanguageFile = createLanguageFileMatcher(this.languages);
+    this.root = path.resolve(options.root ?? process.cwd());
+    this.branch = options.branch ?? 'main';
+    this.workspace = options.workspace ?? getDefaultWorkspace(this.root);
+    if (!this.workspace.trim()) {
+      throw new Error('Workspace name must be a non-empty string.');
+    }
+    this.dedupThreshold =
+      (options.dedup ?? indexingConfig.dedup) ? (options.dedupThreshold ?? indexingConfig.dedupThreshold) : undefined;
+    if (this.dedupThreshold !== undefined) {
+      validateDedupThreshold(this.dedupThreshold);
+    }
+    if (options.maxFileBytes !== undefined && !(Number.isInteger(options.maxFileBytes) && options.maxFileBytes > 0)) {
+      throw new Error(`Invalid maxFileBytes: ${options.maxFileBytes}. Must be a positive integer.`);
+    }
+    if (
+      options.maxChunkTokens !== undefined &&
+      !(Number.isInteger(options.maxChunkTokens) && options.maxChunkTokens >= 0)
+    ) {
+      throw new Error(`Invalid maxChunkTokens: ${options.maxChunkTokens}. Must be a non-negative integer.`);
+    }
+    this.maxInFlightChunks = options.maxInFlightChunks ?? indexingConfig.maxInFlightChunks;
+    if (!(Number.isInteger(this.maxInFlightChunks) && this.maxInFlightChunks > 0)) {
+      throw new Error(`Invalid maxInFlightChunks: ${this.maxInFlightChunks}. Must be a positive integer.`);
+    }
+    if (options.chunkStrategy !== undefined) {
+      validateChunkStrategies(options.chunkStrategy);
+    }
+  }
+
+  /** @internal Implements `createIndex`. */
+  static async open(options: IndexOptions): Promise<Index> {
+    if (!options.index?.trim()) {
+      throw new Error('Index name must be a non-empty string.');
+    }
+    return withLogSink(options.logger, async () => {
+      const embedder = resolveEmbedder(options.embedder);
+      const store = typeof options.store === 'object' ? options.store : createChunkStore(options.index, options.store);
+      let embeddingCache: EmbeddingCache | undefined;
+      try {
+        if (embedder && (options.embedCache ?? embeddingConfig.cacheEnabled)) {
+          embeddingCache = new EmbeddingCache({
+            dbPath: embeddingConfig.cachePath,
+            maxEntries: embeddingConfig.cacheMaxEntries,
+          });
+        }
+        const index = new Index(options, store, embedder, embeddingCache);
+        if (embedder) {
+          validateEmbedderDimensions(embedder, await store.getVectorDimensions(), options.index);
+        }
+        return index;
+      } catch (error) {
+        embeddingCache?.close();
+        await store.close();
+        throw error;
+      }
+    });
+  }
+
+  /**
+   * Indexes a file, or every file of the enabled languages under a directory.
+   *
+   * Files whose content is already indexed are skipped unless `force` is set, and indexed files under
+   * the path that no longer exist, or that `include`, `exclude`, or the ignore files now leave out, are
+   * removed. A file that fails to parse, embed, or store does not stop the run; it is reported in `errors`.
+   *
+   * @param target A file or directory, absolute or relative to `root`; it must be inside `root`.
+   * @throws If the path does not exist or is outside `root`, the store is unavailable, or `signal` aborts.
+   */
+  async addPath(target: string, options: AddPathOptions = {}): Promise<AddPathResult> {
+    this.assertOpen();
+    const run = this.writes.then(() => withLogSink(this.options.logger, () => this.indexPath(target, options)));
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Indexes every file of the enabled languages as of a git ref, without touching the working tree of
+   * `root`, which may also be a bare repository.
+   *
+   * The commit is checked out in a temporary worktree that is removed afterwards, and its locations are
+   * recorded under the commit SHA instead of `branch`, so one index can hold several releases side by side.
+   * Runs one at a time with `addPath` calls.
+   *
+   * @param ref A branch, tag, or commit of the repository at `root`.
+   * @throws If `root` is not a git repository, the ref does not name a commit, or `signal` aborts.
+   */
+  async addRef(ref: string, options: AddPathOptions = {}): Promise<AddRefResult> {
+    this.assertOpen();
+    const run = this.writes.then(() =>
+      withLogSink(this.options.logger, async () => {
+        const checkout = checkoutRef(this.root, ref);
+        try {
+          const result = await this.indexPath('', options, { root: checkout.path, branch: checkout.commit });
+          return { ...result, commit: checkout.commit };
+        } finally {
+          checkout.remove();
+        }
+      })
+    );
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Removes the files under a path, or matching a glob, from the workspace: their locations on every branch,
+   * and the chunks no other file shares. Runs one at a time with `addPath` calls.
+   *
+   * @param pattern A repository-relative path such as `src/legacy` (the file or everything under the
+   *   directory), or a glob such as `**\/*.generated.ts`.
+   * @throws If the pattern names the whole repository or the store is unavailable.
+   */
+  async deletePath(pattern: string): Promise<DeletePathResult> {
+    this.assertOpen();
+    const matches = createSubtreeMatcher(pattern);
+    const run = this.writes.then(() => withLogSink(this.options.logger, () => this.deleteFiles(matches)));
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Removes a file or directory from the index like `deletePath`, then indexes it again like `addPath`,
+   * so chunks of code that was moved or rewritten do not linger.
+   *
+   * @param target A file or directory, absolute or relative to `root`; it must exist inside `root`.
+   * @throws If the path does not exist or is outside `root`, the store is unavailable, or `signal` aborts.
+   */
+  async reindexPath(target: string, options: AddPathOptions = {}): Promise<ReindexPathResult> {
+    this.assertOpen();
+    const run = this.writes.then(() =>
+      withLogSink(this.options.logger, async () => {
+        const relativePath = path.relative(this.root, path.resolve(this.root, target)).split(path.sep).join('/');
+        if (relativePath.startsWith('..') || path.isAbsolute(relativePath)) {
+          throw new Error(`Path "${target}" is outside the index root "${this.root}".`);
+        }
+        if (!fs.existsSync(path.join(this.root, relativePath))) {
+          throw new Error(`Path "${target}" does not exist; use deletePath to remove it from the index.`);
+        }
+        const removed = await this.deleteFiles(createSubtreeMatcher(relativePath));
+        const result = await this.indexPath(relativePath, options);
+        return { ...result, removed };
+      })
+    );
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Searches the index, best match first. With `rerank`, the top candidates are rescored by the reranker.
+   *
+   * @throws If the options are invalid, or the embedder, `semantic_text`, or reranker the search needs is missing.
+   */
+  async search(query: string, options: SearchOptions = {}): Promise<SearchHit[]> {
+    return this.runSearch(query, options);
+  }
+
+  /**
+   * Finds code similar to a piece of code, such as the lines selected in an editor, best match first.
+   * The code is the query: it is embedded and searched for like `search` does, in `semantic` mode unless
+   * `mode` says otherwise.
+   *
+   * @throws If the code is empty, the options are invalid, or the embedder or `semantic_text` is missing.
+   */
+  async searchSimilar(code: string, options: SearchSimilarOptions = {}): Promise<SearchHit[]> {
+    if (code.trim() === '') {
+      throw new Error('Invalid code: it is empty. Must be the code to find similar code to.');
+    }
+    const { exclude } = options;
+    if (exclude === undefined) {
+      return this.runSearch(code, options);
+    }
+    if (
+      !Number.isInteger(exclude.startLine) ||
+      exclude.startLine <= 0 ||
+      !Number.isInteger(exclude.endLine) ||
+      exclude.endLine < exclude.startLine
+    ) {
+      throw new Error(
+        `Invalid exclude lines: ${exclude.startLine}-${exclude.endLine}. Must be positive integers, start first.`
+      );
+    }
+    const filePath = path.relative(this.root, path.resolve(this.root, exclude.filePath)).split(path.sep).join('/');
+    return this.runSearch(code, options, { ...exclude, filePath });
+  }
+
+  /**
+   * Looks up the definitions of symbols named like `name` (`ParseConfig`, `InvoiceService.total`): exact
+   * names first, then names starting with it, names containing its words, and names a few typos away.
+   * Needs no embedder, so it works on indices built without vectors.
+   *
+   * @throws If the limit is invalid.
+   */
+  async findSymbols(name: string, options: FindSymbolsOptions = {}): Promise<SymbolHit[]> {
+    this.assertOpen();
+    const limit = options.limit ?? 10;
+    if (!Number.isInteger(limit) || limit <= 0) {
+      throw new Error(`Invalid limit: ${limit}. Must be a positive integer.`);
+    }
+    return withLogSink(this.options.logger, () => searchSymbols(this.store, name, limit, options.filters ?? {}));
+  }
+
+  /**
+   * Reports what the index holds: files, chunks per language and kind, vector dimensions, and size on disk.
+   */
+  async stats(): Promise<IndexStats> {
+    this.assertOpen();
+    return withLogSink(this.options.logger, async () => ({
+      backend: this.store.backend,
+      ...(await this.store.getStats()),
+      vectorDimensions: await this.store.getVectorDimensions(),
+      embedder: this.embedder?.name ?? null,
+    }));
+  }
+
+  /**
+   * Lists the workspaces of the index with their files and chunks, ordered by name. Locations indexed
+   * before workspaces were recorded are listed first, with a `null` workspace.
+   */
+  async workspaces(): Promise<WorkspaceStats[]> {
+    this.assertOpen();
+    return withLogSink(this.options.logger, () => this.store.getWorkspaces());
+  }
+
+  /**
+   * Writes every chunk of the index, with its vectors, locations, and last indexed commits, to a `.tar.gz`
+   * archive that `importArchive` loads into another index, on any store backend. The embedder name and
+   * dimensions are recorded with them. Runs one at a time with `addPath` calls.
+   *
+   * @throws If the archive cannot be written.
+   */
+  async exportArchive(file: string): Promise<IndexArchiveManifest> {
+    this.assertOpen();
+    const run = this.writes.then(() =>
+      withLogSink(this.options.logger, () =>
+        exportIndexArchive(this.store, path.resolve(file), { embedder: this.embedder, index: this.options.index })
+      )
+    );
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Loads an archive written by `exportArchive` into this index, which must be empty, without embedding
+   * anything again. Runs one at a time with `addPath` calls.
+   *
+   * @throws If the archive was built with another embedder or dimensions than this index's, the index
+   *   already holds chunks, or the archive cannot be read.
+   */
+  async importArchive(file: string): Promise<IndexArchiveManifest> {
+    this.assertOpen();
+    const run = this.writes.then(() =>
+      withLogSink(this.options.logger, async () => {
+        const manifest = await importIndexArchive(this.store, path.resolve(file), {
+          embedder: this.embedder,
+          index: this.options.index,
+        });
+        this.isSetUp = true;
+        return manifest;
+      })
+    );
+    this.writes = run.catch(() => undefined);
+    return await run;
+  }
+
+  /**
+   * Waits for pending `addPath` calls, then releases the store and the embedding cache.
+   */
+  async close(): Promise<void> {
+    if (this.closed) {
+      return;
+    }
+    this.closed = true;
+    await this.writes;
+    this.embeddingCache?.close();
+    await withLogSink(this.options.logger, () => this.store.close());
+  }
+
+  private async runSearch(query: string, options: SearchOptions, exclude?: SearchHitLocation): Promise<SearchHit[]> {
+    this.assertOpen();
+    const limit = options.limit ?? 10;
+    if (!Number.isInteger(limit) || limit <= 0) {
+      throw new Error(`Invalid limit: ${limit}. Must be a positive integer.`);
+    }
+    const mode = options.mode ?? 'semantic';
+    if (!SEARCH_MODES.includes(mode)) {
+      throw new Error(`Invalid mode: ${mode}. Must be one of: ${SEARCH_MODES.join(', ')}.`);
+    }
+    const fusion = options.fusion ?? 'rrf';
+    if (!FUSION_METHODS.includes(fusion)) {
+      throw new Error(`Invalid fusion method: ${fusion}. Must be one of: ${FUSION_METHODS.join(', ')}.`);
+    }
+    const alpha = options.alpha ?? DEFAULT_HYBRID_ALPHA;
+    if (!(alpha >= 0 && alpha <= 1)) {
+      throw new Error(`Invalid alpha: ${alpha}. Must be a number between 0 and 1.`);
+    }
+    const contextLines = options.contextLines ?? 0;
+    if (!Number.isInteger(contextLines) || contextLines < 0) {
+      throw new Error(`Invalid contextLines: ${contextLines}. Must be a non-negative integer.`);
+    }
+    const rerankCandidates = options.rerank ? (options.rerankCandidates ?? rerankConfig.candidates) : undefined;
+    if (rerankCandidates !== undefined && (!Number.isInteger(rerankCandidates) || rerankCandidates <= 0)) {
+      throw new Error(`Invalid rerankCandidates: ${rerankCandidates}. Must be a positive integer.`);
+    }
+    const sort = options.sort ?? 'score';
+    if (!SEARCH_SORTS.includes(sort)) {
+      throw new Error(`Invalid sort: ${sort}. Must be one of: ${SEARCH_SORTS.join(', ')}.`);
+    }
+    const changedSince = options.changedSince !== undefined ? new Date(options.changedSince) : undefined;
+    if (changedSince !== undefined && Number.isNaN(changedSince.getTime())) {
+      throw new Error(`Invalid changedSince: ${options.changedSince}. Must be a date, e.g. 2024-06-01.`);
+    }
+    const overfetchFactor = options.overfetchFactor ?? POST_FILTER_CANDIDATE_FACTOR;
+    if (!(overfetchFactor >= 1 && Number.isFinite(overfetchFactor))) {
+      throw new Error(`Invalid overfetchFactor: ${overfetchFactor}. Must be a number of at least 1.`);
+    }
+
+    return withLogSink(this.options.logger, () =>
+      searchIndex(this.store, this.embedder, this.options.index, query, {
+        limit,
+        mode,
+        alpha,
+        fusion,
+        filters: options.filters ?? {},
+        minScore: options.minScore,
+        expandQuery: options.expandQuery ?? false,
+        ...(options.rerank ? { reranker: this.getReranker(), rerankCandidates } : {}),
+        contextLines,
+        root: this.root,
+        sort,
+        ...(changedSince && { changedSince: changedSince.toISOString() }),
+        overfetchFactor,
+        explain: options.explain ?? false,
+        ...(exclude && { exclude }),
+      })
+    );
+  }
+
+  private getReranker(): Reranker {
+    this.reranker ??= resolveReranker(this.options.reranker);
+    if (!this.reranker) {
+      throw new Error(
+        `Reranking needs a reranker. Set SCS_IDXR_RERANKER to one of: ${listRerankers().join(', ') || '(none)'}.`
+      );
+    }
+    return this.reranker;
+  }
+
+  private assertOpen(): void {
+    if (this.closed) {
+      throw new Error(`Index "${this.options.index}" is closed.`);
+    }
+  }
+
+  private async deleteFiles(matches: (filePath: string) => boolean): Promise<DeletePathResult> {
+    const files = (await this.store.getIndexedFilePaths(this.workspace)).filter(matches);
+    const { locations, chunks } =
+      files.length > 0
+        ? await this.store.deleteDocumentsByFilePaths(files, { workspace: this.workspace })
+        : { locations: 0, chunks: 0 };
+    const result = { deletedFiles: files.length, deletedLocations: locations, deletedChunks: chunks };
+    logger.info('Deleted files from the index', result);
+    return result;
+  }
+
+  /**
+   * @param source The checkout to read files from and the branch to record; the index's `root` and
+   *   `branch` unless a ref is indexed.
+   */
+  private async indexPath(
+    target: string,
+    { signal, force }: AddPathOptions,
+    { root, branch }: { root: string; branch: string } = { root: this.root, branch: this.branch }
+  ): Promise<AddPathResult> {
+    signal?.throwIfAborted();
+    const absolutePath = path.resolve(root, target);
+    const relativePath = path.relative(root, absolutePath).split(path.sep).join('/');
+    if (relativePath.startsWith('..') || path.isAbsolute(relativePath)) {
+      throw new Error(`Path "${target}" is outside the index root "${root}".`);
+    }
+    const isDirectory = fs.statSync(absolutePath).isDirectory();
+    const progress = new ProgressTracker(this.options.progress);
+
+    if (!this.isSetUp) {
+      await this.store.setup();
+      this.isSetUp = true;
+    }
+
+    const pattern = relativePath ? `${relativePath}/**/*` : '**/*';
+    progress.setPhase('walking');
+    const files = isDirectory
+      ? (await walkFiles(root, pattern, createFileFilter(root, this.options))).filter(this.isLanguageFile)
+      : [relativePath];
+
+    const isUnder = (file: string) => !relativePath || file === relativePath || file.startsWith(`${relativePath}/`);
+    const {
+      files: changed,
+      changedFiles: reindexed,
+      unchangedFiles,
+      deletedFiles,
+    } = await detectFileChanges(this.store, files, {
+      root,
+      branch,
+      workspace: this.workspace,
+      isInScope: (file) => isUnder(file) && this.isLanguageFile(file),
+      hashCache: this.hashCache,
+      force,
+    });
+    const result: AddPathResult = {
+      indexedFiles: 0,
+      unchangedFiles,
+      deletedFiles: deletedFiles.length,
+      chunks: 0,
+      errors: [],
+    };
+    progress.setFilesTotal(changed.length);
+    const reuseVectors =
+      this.embedder !== undefined &&
+      changed.length > 0 &&
+      (await canReuseStoredVectors(
+        this.store,
+        { embedder: this.embedder.name, template: this.embedTemplateSource },
+        { force }
+      ));
+
+    // Grammars are loaded on first use, so an index that only searches never pays for them
+    this.parser ??= new LanguageParser(this.languages.join(','), {
+      ...(this.options.includeBlame !== undefined && { includeBlame: this.options.includeBlame }),
+      ...(this.options.maxFileBytes !== undefined && { maxFileBytes: this.options.maxFileBytes }),
+      ...(this.options.extractEmbeddedSql !== undefined && { extractEmbeddedSql: this.options.extractEmbeddedSql }),
+      ...(this.options.chunkStrategy !== undefined && { perLanguage: this.options.chunkStrategy }),
+      ...(this.options.maxChunkTokens !== undefined && { maxTokens: this.options.maxChunkTokens }),
+      ...(this.options.tokenCounter !== undefined && { countTokens: this.options.tokenCounter }),
+    });
+    const deduplicator = this.dedupThreshold !== undefined ? new ChunkDeduplicator(this.dedupThreshold) : undefined;
+    for (const file of changed) {
+      signal?.throwIfAborted();
+      // Unset if the file is skipped or fails to parse; its stale locations are removed all the same
+      let chunks: CodeChunk[] | undefined;
+      try {
+        const parsed = this.parser.parseFile(path.join(root, file), branch, file);
+        result.errors.push(...getParseErrors(file, parsed.fallback, parsed.metrics.chunksSkipped, parsed.skipped));
+        if (!parsed.skipped) {
+          const labeled = parsed.chunks.map((chunk) => ({ ...chunk, workspace: this.workspace }));
+          chunks = deduplicator ? labeled.map((chunk) => deduplicator.fold(chunk)) : labeled;
+        }
+      } catch (error) {
+        logger.warn('Failed to parse file', { file, error: toErrorMessage(error) });
+        result.errors.push({ path: file, error: toErrorMessage(error), fatal: true });
+      }
+      if (reindexed.has(file)) {
+        await deleteChangedFile(this.store, file, chunks ?? [], { workspace: this.workspace });
+      }
+      progress.addFileDone(chunks?.length);
+      if (!chunks) {
+        continue;
+      }
+      const stored = await this.writeChunks(file, chunks, result.errors, signal, progress, reuseVectors);
+      result.chunks += stored;
+      if (chunks.length === 0 || stored > 0) {
+        result.indexedFiles++;
+      }
+    }
+
+    logger.info('Indexed path', {
+      path: relativePath || '.',
+      ...result,
+      errors: result.errors.length,
+      ...(deduplicator && { deduplicated: deduplicator.foldedCount }),
+    });
+    return result;
+  }
+
+  /**
+   * Embeds and stores the chunks of one file, recording failures in `errors`. With `reuseVectors`, chunks
+   * whose vector is already stored keep it instead of being embedded again.
+   *
+   * @returns The number of chunks stored.
+   */
+  private async writeChunks(
+    file: string,
+    chunks: CodeChunk[],
+    errors: IndexError[],
+    signal: AbortSignal | undefined,
+    progress: ProgressTracker,
+    reuseVectors: boolean
+  ): Promise<number> {
+    // A slice of the chunks is embedded and stored at a time, so a huge file never holds all its vectors
+    const embeddingFailures: string[] = [];
+    let stored = 0;
+    for (let offset = 0; offset < chunks.length; offset += this.maxInFlightChunks) {
+      const slice = chunks.slice(offset, offset + this.maxInFlightChunks);
+      let embedded = slice;
+      if (this.embedder) {
+        progress.setPhase('embedding');
+        // Chunks already stored, e.g. the unchanged functions of an edited file, keep their vectors
+        const { vectors, failed } = await embedMissing(
+          this.embedder,
+          slice.map((chunk) => this.embedTemplate(chunk)),
+          reuseVectors ? await getStoredVectors(this.store, slice) : new Map(),
+          { signal }
+        );
+        signal?.throwIfAborted();
+        embeddingFailures.push(...failed.map(({ error }) => error));
+        embedded = slice.flatMap((chunk, i) => {
+          const vector = vectors.get(i);
+          return vector ? [{ ...chunk, code_vector: vector }] : [];
+        });
+      }
+
+      for (let start = 0; start < embedded.length; start += STORE_BATCH_SIZE) {
+        progress.setPhase('storing');
+        const { succeeded, failed } = await this.store.indexChunks(embedded.slice(start, start + STORE_BATCH_SIZE));
+        stored += succeeded.length;
+        progress.addChunksEmbedded(succeeded.length);
+        if (failed.length > 0) {
+          errors.push({
+            path: file,
+            error: `Failed to store ${failed.length} chunk(s): ${toErrorMessage(failed[0].error)}`,
+            fatal: false,
+          });
+        }
+      }
+    }
+    if (embeddingFailures.length > 0) {
+      errors.push({
+        path: file,
+        error: `Failed to embed ${embeddingFailures.length} chunk(s): ${embeddingFailures[0]}`,
+        fatal: false,
+      });
+    }
+    return stored;
+  }
+}
+
+/**
+ * Opens an index. Nothing is created in the store until the first `addPath`.
+ *
+ * @throws If the options are invalid, or the embedder does not match the dimensions of the stored vectors.
+ */
+export function createIndex(options: IndexOptions): Promise<Index> {
+  return Index.open(options);
+}
@@ -0,0 +1,107 @@
+/** Matches a conditional directive line: `#if`, `#ifdef`, `#ifndef`, `#elif…`, `#else`, `#endif`. */
+const CONDITIONAL_DIRECTIVE = /^\s*#\s*(ifdef|ifndef|if|elifdef|elifndef|elif|else|endif)\b(.*)$/;
+
+interface ConditionalFrame {
+  /** Whether the enclosing code is compiled. */
+  parentActive: boolean;
+  /** Whether the current branch is compiled. */
+  active: boolean;
+  /** Whether an earlier (or the current) branch was taken. */
+  taken: boolean;
+}
+
+/**
+ * Returns whether a condition holds, as far as it can be told without a build: `0` and `1`, and
+ * `__cplusplus`, which is defined for C++ only. Other conditions are unknown.
+ */
+function evaluateCondition(directive: string, condition: string, language: string): boolean | undefined {
+  const isCpp = language === 'cpp';
+  const expression = condition
+    .replace(/\/\*.*?\*\/|\/\/.*$/g, '')
+    .trim()
+    .replace(/\s+/g, ' ');
+  if (directive.endsWith('ifdef') || directive.endsWith('ifndef')) {
+    if (expression !== '__cplusplus') {
+      return undefined;
+    }
+    return directive.endsWith('ifdef') ? isCpp : !isCpp;
+  }
+  if (expression === '0' || expression === '1') {
+    return expression === '1';
+  }
+  if (/^defined ?\(? ?__cplusplus ?\)?$/.test(expression)) {
+    return isCpp;
+  }
+  if (/^! ?defined ?\(? ?__cplusplus ?\)?$/.test(expression)) {
+    return !isCpp;
+  }
+  return undefined;
+}
+
+function endsWithBackslash(line: string): boolean {
+  return /\\\r?$/.test(line);
+}
+
+function blank(line: string): string {
+  return line.replace(/[^\n]/g, ' ');
+}
+
+/**
+ * Returns whether `source` contains preprocessor conditionals (`#if`, `#ifdef`, ...).
+ */
+export function hasPreprocessorConditionals(source: string): boolean {
+  return /^\s*#\s*if/m.test(source);
+}
+
+/**
+ * Resolves the preprocessor conditionals of a C or C++ file to one variant of the code, so code whose
+ * braces only balance per branch (`#ifdef __cplusplus` / `extern "C" {`, a signature that differs per
+ * platform) parses without errors.
+ *
+ * The directive lines and the lines of branches not taken are replaced by spaces. A branch is taken if
+ * its condition is known to hold (`#if 1`, `#ifdef __cplusplus` in C++), and for conditions that cannot
+ * be evaluated the first branch is taken. Every other character is kept in place, so positions in the
+ * result are positions in `source`.
+ */
+export function maskInactiveBranches(source: string, language: string): string {
+  const lines = source.split('\n');
+  const frames: ConditionalFrame[] = [];
+  let continuesDirective = false;
+  let continuationActive = true;
+
+  const masked = lines.map((line) => {
+    const isActive = frames.length === 0 || frames[frames.length - 1].active;
+    if (continuesDirective) {
+      // A directive continued with a trailing backslash
+      continuesDirective = endsWithBackslash(line);
+      return continuationActive ? line : blank(line);
+    }
+
+    const match = CONDITIONAL_DIRECTIVE.exec(line);
+    if (!match) {
+      continuesDirective = /^\s*#/.test(line) && endsWithBackslash(line);
+      continuationActive = isActive;
+      return isActive ? line : blank(line);
+    }
+
+    const [, directive, condition] = match;
+    const top = frames[frames.length - 1];
+    if (directive.startsWith('if')) {
+      const holds = evaluateCondition(directive, condition, language) ?? true;
+      frames.push({ parentActive: isActive, active: isActive && holds, taken: holds });
+    } else if (directive.startsWith('elif') && top) {
+      const holds = !top.taken && (evaluateCondition(directive, condition, language) ?? true);
+      top.active = top.parentActive && holds;
+      top.taken ||= holds;
+    } else if (directive === 'else' && top) {
+      top.active = top.parentActive && !top.taken;
+      top.taken = true;
+    } else if (directive === 'endif') {
+      frames.pop();
+    }
+    continuesDirective = endsWithBackslash(line);
+    continuationActive = false;
+    return blank(line);
+  });
+  return masked.join('\n');
+}
@@ -0,0 +1,67 @@
+/**
+ * Thrown when an indexing run stops early because its signal was aborted, e.g. on Ctrl-C.
+ *
+ * Work committed before the cancellation stays in the store; a queue left behind is resumed by the
+ * next `index` run.
+ */
+export class IndexingCancelledError extends Error {
+  constructor() {
+    super('Indexing cancelled');
+    this.name = 'IndexingCancelledError';
+  }
+}
+
+/**
+ * Throws `IndexingCancelledError` if the signal was aborted. Called between files and batches.
+ */
+export function throwIfCancelled(signal?: AbortSignal): void {
+  if (signal?.aborted) {
+    throw new IndexingCancelledError();
+  }
+}
+
+/**
+ * Resolves after `ms` milliseconds, or as soon as the signal is aborted.
+ */
+export function sleepUnlessCancelled(ms: number, signal?: AbortSignal): Promise<void> {
+  return new Promise((resolve) => {
+    if (signal?.aborted) {
+      resolve();
+      return;
+    }
+    const onAbort = () => {
+      clearTimeout(timer);
+      resolve();
+    };
+    const timer = setTimeout(() => {
+      signal?.removeEventListener('abort', onAbort);
+      resolve();
+    }, ms);
+    signal?.addEventListener('abort', onAbort, { once: true });
+  });
+}
+
+let activeRun: AbortController | undefined;
+
+/**
+ * Starts a run that SIGINT/SIGTERM cancel instead of exiting the process, see `cancelActiveRun`.
+ *
+ * @returns The signal to pass through the run.
+ */
+export function startCancellableRun(): AbortSignal {
+  activeRun = new AbortController();
+  return activeRun.signal;
+}
+
+/**
+ * Cancels the run started by `startCancellableRun`.
+ *
+ * @returns false if there is no such run or it was already cancelled, in which case the caller should exit.
+ */
+export function cancelActiveRun(): boolean {
+  if (!activeRun || activeRun.signal.aborted) {
+    return false;
+  }
+  activeRun.abort(new IndexingCancelledError());
+  return true;
+}
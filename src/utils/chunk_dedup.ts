@@ -0,0 +1,200 @@
+import { createHash } from 'crypto';
+import { CodeChunk } from './elasticsearch';
+
+/** Default similarity above which two chunks are folded into one, see `ChunkDeduplicator`. */
+export const DEFAULT_DEDUP_THRESHOLD = 0.9;
+
+const SIMHASH_BITS = 64;
+/** Tokens per shingle hashed into the SimHash. */
+const SHINGLE_SIZE = 3;
+/**
+ * Chunks with fewer shingles are only folded when their content is identical: a few tokens of
+ * boilerplate (`return nil`, a getter) look alike without being the same code.
+ */
+const MIN_NEAR_DUPLICATE_SHINGLES = 16;
+
+/** Fields that describe where a chunk occurs rather than what it contains. */
+type LocationFields = Pick<
+  CodeChunk,
+  | 'filePath'
+  | 'directoryPath'
+  | 'directoryName'
+  | 'directoryDepth'
+  | 'git_file_hash'
+  | 'git_branch'
+  | 'workspace'
+  | 'blame'
+  | 'startLine'
+  | 'endLine'
+  | 'created_at'
+  | 'updated_at'
+>;
+
+interface Canonical {
+  chunk: CodeChunk;
+  fingerprint: bigint;
+}
+
+function shingles(text: string): string[] {
+  const tokens = text.match(/[\p{L}\p{N}_$]+|[^\s\p{L}\p{N}_$]/gu) ?? [];
+  if (tokens.length < SHINGLE_SIZE) {
+    return tokens.length > 0 ? [tokens.join(' ')] : [];
+  }
+  const result: string[] = [];
+  for (let i = 0; i + SHINGLE_SIZE <= tokens.length; i++) {
+    result.push(tokens.slice(i, i + SHINGLE_SIZE).join(' '));
+  }
+  return result;
+}
+
+/**
+ * Computes the 64-bit SimHash of a text over its shingles of three tokens. Texts that share most of
+ * their shingles get fingerprints that differ in few bits, so `1 - hammingDistance / 64` estimates
+ * how similar they are.
+ */
+export function simHash(text: string): bigint {
+  const weights = new Array<number>(SIMHASH_BITS).fill(0);
+  for (const shingle of shingles(text)) {
+    const digest = createHash('md5').update(shingle).digest();
+    const hash = digest.readBigUInt64BE(0);
+    for (let bit = 0; bit < SIMHASH_BITS; bit++) {
+      weights[bit] += (hash >> BigInt(bit)) & 1n ? 1 : -1;
+    }
+  }
+  let fingerprint = 0n;
+  for (let bit = 0; bit < SIMHASH_BITS; bit++) {
+    if (weights[bit] > 0) {
+      fingerprint |= 1n << BigInt(bit);
+    }
+  }
+  return fingerprint;
+}
+
+/** Counts the bits in which two fingerprints differ. */
+export function hammingDistance(a: bigint, b: bigint): number {
+  let diff = a ^ b;
+  let count = 0;
+  while (diff > 0n) {
+    diff &= diff - 1n;
+    count++;
+  }
+  return count;
+}
+
+/**
+ * @throws If `threshold` is not a similarity in (0, 1].
+ */
+export function validateDedupThreshold(threshold: number): void {
+  if (!(threshold > 0 && threshold <= 1)) {
+    throw new Error(`Invalid dedup threshold: ${threshold}. Must be a number greater than 0 and at most 1.`);
+  }
+}
+
+/** Returns the canonical chunk's content and metadata at the location of `chunk`. */
+function toAlias(canonical: CodeChunk, chunk: CodeChunk): CodeChunk {
+  const location: LocationFields = {
+    filePath: chunk.filePath,
+    directoryPath: chunk.directoryPath,
+    directoryName: chunk.directoryName,
+    directoryDepth: chunk.directoryDepth,
+    git_file_hash: chunk.git_file_hash,
+    git_branch: chunk.git_branch,
+    workspace: chunk.workspace,
+    blame: chunk.blame,
+    startLine: chunk.startLine,
+    endLine: chunk.endLine,
+    created_at: chunk.created_at,
+    updated_at: chunk.updated_at,
+  };
+  return { ...canonical, ...location };
+}
+
+/**
+ * Folds duplicate and near-duplicate chunks into one canonical chunk before they are embedded.
+ *
+ * The first chunk seen with some content becomes canonical. A later chunk with the same content hash,
+ * or whose SimHash similarity to a canonical chunk of the same language and type is at least
+ * `threshold`, is replaced by the canonical chunk at its own location. It then gets the canonical
+ * chunk's document id, so the store records its location as another location of that chunk instead
+ * of embedding and storing a second copy. The alias's own content, symbols, and imports are dropped.
+ *
+ * Canonical chunks are only remembered for the lifetime of the deduplicator, i.e. one indexing run;
+ * a near-duplicate of a chunk indexed by an earlier run is stored on its own.
+ */
+export class ChunkDeduplicator {
+  readonly threshold: number;
+  private readonly maxDistance: number;
+  private readonly bandBits: number;
+  private readonly byHash = new Map<string, CodeChunk>();
+  /** Canonical chunks by `language:type:band:bits`; see `bandKeys`. */
+  private readonly byBand = new Map<string, Canonical[]>();
+  private folded = 0;
+
+  /**
+   * @param threshold Similarity in (0, 1] from which chunks are folded; 1 only folds chunks whose
+   *   fingerprints are equal.
+   */
+  constructor(threshold: number = DEFAULT_DEDUP_THRESHOLD) {
+    validateDedupThreshold(threshold);
+    this.threshold = threshold;
+    this.maxDistance = Math.floor((1 - threshold) * SIMHASH_BITS + 1e-9);
+    // Two fingerprints within maxDistance bits agree on at least one of maxDistance + 1 bands
+    this.bandBits = Math.ceil(SIMHASH_BITS / (this.maxDistance + 1));
+  }
+
+  /** Number of chunks folded into a canonical chunk so far. */
+  get foldedCount(): number {
+    return this.folded;
+  }
+
+  /**
+   * Returns the chunk to store for `chunk`: the chunk itself if it is the first of its kind, or the
+   * canonical chunk it duplicates, carrying `chunk`'s location.
+   */
+  fold(chunk: CodeChunk): CodeChunk {
+    const exact = this.byHash.get(chunk.chunk_hash);
+    if (exact) {
+      return this.alias(exact, chunk);
+    }
+
+    if (shingles(chunk.content).length >= MIN_NEAR_DUPLICATE_SHINGLES) {
+      const fingerprint = simHash(chunk.content);
+      const keys = this.bandKeys(chunk, fingerprint);
+      const near = keys
+        .flatMap((key) => this.byBand.get(key) ?? [])
+        .find((candidate) => hammingDistance(candidate.fingerprint, fingerprint) <= this.maxDistance);
+      if (near) {
+        return this.alias(near.chunk, chunk);
+      }
+      const canonical = { chunk, fingerprint };
+      for (const key of keys) {
+        const bucket = this.byBand.get(key);
+        if (bucket) {
+          bucket.push(canonical);
+        } else {
+          this.byBand.set(key, [canonical]);
+        }
+      }
+    }
+    this.byHash.set(chunk.chunk_hash, chunk);
+    return chunk;
+  }
+
+  private alias(canonical: CodeChunk, chunk: CodeChunk): CodeChunk {
+    // A requeued canonical chunk is folded into itself
+    if (canonical.filePath !== chunk.filePath || canonical.startLine !== chunk.startLine) {
+      this.folded++;
+    }
+    return toAlias(canonical, chunk);
+  }
+
+  private bandKeys(chunk: CodeChunk, fingerprint: bigint): string[] {
+    const keys: string[] = [];
+    const mask = (1n << BigInt(this.bandBits)) - 1n;
+    for (let band = 0; band * this.bandBits < SIMHASH_BITS; band++) {
+      const bits = (fingerprint >> BigInt(band * this.bandBits)) & mask;
+      keys.push(`${chunk.language}:${chunk.type}:${band}:${bits.toString(16)}`);
+    }
+    return keys;
+  }
+}
@@ -0,0 +1,201 @@
+import path from 'path';
+import { storeConfig } from '../config';
+import {
+  BulkIndexResult,
+  ChunkLocationSummary,
+  CodeChunk,
+  DeleteDocumentsResult,
+  EmbeddingModel,
+  SearchResult,
+  StoreStats,
+  getChunkDocumentId,
+} from './elasticsearch';
+import { ElasticsearchStore } from './elasticsearch_store';
+import { getConfiguredEmbedder } from './embedder';
+import { createLogger, logger as defaultLogger } from './logger';
+import { QdrantStore } from './qdrant_store';
+import { PostFilterOptions, SearchFilters } from './search_filters';
+import { SqliteStore } from './sqlite_store';
+import { SymbolName } from './symbol_search';
+import { parseVectorMetric } from './vector_metric';
+import { WorkspaceStats } from './workspace';
+
+/**
+ * Persists indexed chunks, their per-file locations, and per-branch indexing state.
+ *
+ * Producers and the worker talk to a `ChunkStore` instead of a specific backend, so the
+ * set of chunks written by one run can be kept in Elasticsearch, in a local SQLite file, or in Qdrant.
+ */
+export interface ChunkStore {
+  /** Backend name, as selected via `SCS_IDXR_STORE`. */
+  readonly backend: string;
+  /** Creates the backing indices/tables if they do not exist yet. */
+  setup(): Promise<void>;
+  /** Removes all chunks and locations (used by `--clean`). */
+  clean(): Promise<void>;
+  /** Returns the dimensions of stored vectors, or null if unknown. */
+  getVectorDimensions(): Promise<number | null>;
+  /** Returns the embedder and embed template the stored vectors were made with, or null if none was recorded. */
+  getEmbeddingModel(): Promise<EmbeddingModel | null>;
+  /** Records the embedder and embed template the stored vectors are made with; `clean` forgets it. */
+  setEmbeddingModel(model: EmbeddingModel): Promise<void>;
+  /** Upserts chunks by chunk id and records their locations. */
+  indexChunks(chunks: CodeChunk[]): Promise<BulkIndexResult>;
+  /**
+   * Removes locations for the given files on every branch, and chunks that no longer have any location.
+   * With `options.workspace`, only locations of that workspace (see `isInWorkspace`) are removed. Chunks in
+   * `options.keepChunkIds` are kept even without a location, so a changed file that is re-indexed keeps the
+   * embeddings of the chunks it still has.
+   */
+  deleteDocumentsByFilePaths(
+    filePaths: string[],
+    options?: { deleteDocumentsPageSize?: number; workspace?: string; keepChunkIds?: Set<string> }
+  ): Promise<DeleteDocumentsResult>;
+  /** Returns the stored vectors of the given chunks. Chunks that are not stored or have no vector are missing. */
+  getChunkVectors(chunkIds: string[]): Promise<Map<string, number[]>>;
+  /** Returns the git blob hashes recorded for each file path on a branch, optionally of one workspace. */
+  getIndexedFileHashes(branch: string, workspace?: string): Promise<Map<string, Set<string>>>;
+  /** Returns the paths of all files with locations, on any branch, sorted, optionally of one workspace. */
+  getIndexedFilePaths(workspace?: string): Promise<string[]>;
+  /**
+   * Returns the `k` chunks closest to `queryVector`, best match first. With `filters`, only matching
+   * chunks are returned, and with a path or workspace filter each result carries a matching location.
+   * Stores that check path and workspace filters after retrieval fetch `options.overfetchFactor` times
+   * as many candidates, and more while too few match (see `fetchPostFiltered`).
+   */
+  search(
+    queryVector: number[],
+    k: number,
+    filters?: SearchFilters,
+    options?: PostFilterOptions
+  ): Promise<SearchResult[]>;
+  /**
+   * Returns the `k` chunks that best match `query` by BM25 over content and symbol names, best match first.
+   * Filters and `options` apply like for `search`.
+   */
+  keywordSearch(
+    query: string,
+    k: number,
+    filters?: SearchFilters,
+    options?: PostFilterOptions
+  ): Promise<SearchResult[]>;
+  /** Returns the distinct names and kinds of the symbols recorded on stored chunks, for `searchSymbols`. */
+  getSymbolNames(): Promise<SymbolName[]>;
+  /**
+   * Returns up to `k` chunks with a symbol named `name`, by file path. Filters apply like for `search`, and
+   * with a path or workspace filter each result carries a matching location.
+   */
+  findChunksBySymbol(name: string, k: number, filters?: SearchFilters): Promise<SearchResult[]>;
+  /**
+   * Returns up to `perChunkLimit` locations of each chunk, by file path and start line. Chunks without
+   * locations are missing from the result.
+   */
+  getChunkLocations(chunkIds: string[], perChunkLimit: number): Promise<Record<string, ChunkLocationSummary[]>>;
+  /** Counts the stored files and chunks, per language and kind, and the size of the store. */
+  getStats(): Promise<StoreStats>;
+  /** Counts the files and chunks of each workspace, ordered by name, with unlabeled locations first. */
+  getWorkspaces(): Promise<WorkspaceStats[]>;
+  /**
+   * Reads every stored chunk with its vector, a page of about `pageSize` chunks at a time. A chunk is
+   * yielded once per location, like the chunks `indexChunks` takes, and all its locations are in the
+   * same page; chunks without locations are skipped. Used by `index export`.
+   */
+  exportChunks(pageSize?: number): AsyncIterable<CodeChunk[]>;
+  getLastIndexedCommit(branch: string): Promise<string | null>;
+  updateLastIndexedCommit(branch: string, commitHash: string): Promise<void>;
+  /** Releases any resources held by the store. */
+  close(): Promise<void>;
+}
+
+/**
+ * Removes the locations a changed file had before it was re-parsed into `chunks`, keeping the chunks it
+ * still has. Chunk ids hash a chunk's symbol path and content, not its lines, so a function that only
+ * moved keeps its id; storing `chunks` then reuses the kept vectors (see `getChunkVectors`), and only
+ * added and edited chunks are embedded again.
+ */
+export function deleteChangedFile(
+  store: ChunkStore,
+  filePath: string,
+  chunks: CodeChunk[],
+  options?: { deleteDocumentsPageSize?: number; workspace?: string }
+): Promise<DeleteDocumentsResult> {
+  return store.deleteDocumentsByFilePaths([filePath], {
+    ...options,
+    keepChunkIds: new Set(chunks.map((chunk) => getChunkDocumentId(chunk))),
+  });
+}
+
+/** Returns the stored vectors of `chunks` by their index in `chunks`, see `ChunkStore.getChunkVectors`. */
+export async function getStoredVectors(
+  store: Pick<ChunkStore, 'getChunkVectors'>,
+  chunks: CodeChunk[]
+): Promise<Map<number, number[]>> {
+  const ids = chunks.map((chunk) => getChunkDocumentId(chunk));
+  const stored = await store.getChunkVectors(ids);
+  const vectors = new Map<number, number[]>();
+  ids.forEach((id, i) => {
+    const vector = stored.get(id);
+    if (vector) {
+      vectors.set(i, vector);
+    }
+  });
+  return vectors;
+}
+
+/**
+ * Whether the stored vectors of unchanged chunks may be reused by a run that embeds with `model`: only if
+ * the store recorded the same embedder and embed template. A store without a record (new, cleaned, or
+ * built before the model was recorded) takes `model` as its own. With `force`, nothing is reused and
+ * `model` is recorded, since every chunk the run writes is embedded again.
+ */
+export async function canReuseStoredVectors(
+  store: Pick<ChunkStore, 'getEmbeddingModel' | 'setEmbeddingModel'>,
+  model: EmbeddingModel,
+  options: { force?: boolean; logger?: ReturnType<typeof createLogger> } = {}
+): Promise<boolean> {
+  const { force = false, logger = defaultLogger } = options;
+  const stored = await store.getEmbeddingModel();
+  if (force || stored === null) {
+    await store.setEmbeddingModel(model);
+    return !force;
+  }
+  if (stored.embedder === model.embedder && stored.template === model.template) {
+    return true;
+  }
+  logger.warn(
+    'The stored vectors were made with another embedder or embed template, so none are reused. ' +
+      'Re-index with --force (or --clean) to embed all chunks the same way.',
+    { stored, current: model }
+  );
+  return false;
+}
+
+export const STORE_BACKENDS = ['elasticsearch', 'sqlite', 'qdrant'] as const;
+
+/**
+ * Creates the chunk store selected via `SCS_IDXR_STORE` for an index.
+ *
+ * @param index The index name. For SQLite, the database lives at `SCS_IDXR_SQLITE_STORE_DIR/<index>.db`; for
+ *   Qdrant, it names the collection unless `SCS_IDXR_QDRANT_COLLECTION` is set.
+ * @param backend Overrides the configured backend.
+ * @throws If the backend or the vector metric (`SCS_IDXR_VECTOR_METRIC`) is unknown.
+ */
+export function createChunkStore(index: string, backend: string = storeConfig.backend): ChunkStore {
+  const metric = parseVectorMetric(storeConfig.metric);
+  switch (backend) {
+    case 'elasticsearch':
+      return new ElasticsearchStore(index, { metric });
+    case 'sqlite':
+      return new SqliteStore({ dbPath: path.join(storeConfig.sqliteDir, `${index}.db`), metric });
+    case 'qdrant':
+      return new QdrantStore({
+        url: storeConfig.qdrantUrl,
+        apiKey: storeConfig.qdrantApiKey,
+        collection: storeConfig.qdrantCollection ?? index,
+        dimensions: getConfiguredEmbedder()?.dimensions(),
+        metric,
+      });
+    default:
+      throw new Error(`Unknown store backend "${backend}". Supported backends: ${STORE_BACKENDS.join(', ')}.`);
+  }
+}
@@ -0,0 +1,53 @@
+import { LanguageName, languageConfigurations } from '../languages';
+
+/**
+ * How the files of a language are cut into chunks, selected per language via `SCS_IDXR_CHUNK_STRATEGY`:
+ * - `symbol`: the language's own chunking, the default. Code gets a chunk per function, class, and other
+ *   symbol, Markdown one per section, SQL one per statement, and JSON, YAML, and text line windows.
+ * - `whole-file`: one chunk holding the whole file. A file larger than `maxChunkSizeBytes` gets no chunk.
+ * - `fixed-window`: windows of `SCS_IDXR_DEFAULT_CHUNK_LINES` lines overlapping by
+ *   `SCS_IDXR_CHUNK_OVERLAP_LINES`, whatever the language.
+ */
+export const CHUNK_STRATEGIES = ['symbol', 'whole-file', 'fixed-window'] as const;
+export type ChunkStrategy = (typeof CHUNK_STRATEGIES)[number];
+
+/** The chunk strategy of each language; languages left out use `symbol`. */
+export type ChunkStrategies = Partial<Record<LanguageName, ChunkStrategy>>;
+
+/**
+ * @throws If a language of `strategies` is not supported, or its strategy is not one of `CHUNK_STRATEGIES`.
+ */
+export function validateChunkStrategies(strategies: Record<string, string>): ChunkStrategies {
+  for (const [language, strategy] of Object.entries(strategies)) {
+    if (!(language in languageConfigurations)) {
+      throw new Error(
+        `Unknown language "${language}" in chunk strategies. ` +
+          `Supported languages: ${Object.keys(languageConfigurations).join(', ')}.`
+      );
+    }
+    if (!(CHUNK_STRATEGIES as readonly string[]).includes(strategy)) {
+      throw new Error(
+        `Unknown chunk strategy "${strategy}" for ${language}. Supported strategies: ${CHUNK_STRATEGIES.join(', ')}.`
+      );
+    }
+  }
+  return strategies as ChunkStrategies;
+}
+
+/**
+ * Parses `language:strategy` entries, such as `json:whole-file`, into the strategy of each language.
+ * Names are case-insensitive; a later entry for a language replaces an earlier one.
+ *
+ * @throws If an entry is not `language:strategy`, or names an unknown language or strategy.
+ */
+export function parseChunkStrategies(entries: string[]): ChunkStrategies {
+  const strategies: Record<string, string> = {};
+  for (const entry of entries) {
+    const match = entry.match(/^\s*([^:\s]+)\s*:\s*(\S+)\s*$/);
+    if (!match) {
+      throw new Error(`Invalid chunk strategy "${entry}". Must be language:strategy, e.g. json:whole-file.`);
+    }
+    strategies[match[1].toLowerCase()] = match[2].toLowerCase();
+  }
+  return validateChunkStrategies(strategies);
+}
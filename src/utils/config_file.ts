@@ -0,0 +1,136 @@
+import fs from 'fs';
+import path from 'path';
+import yaml from 'js-yaml';
+
+/** Names of the config file, looked up in the working directory and each of its parents. */
+export const CONFIG_FILE_NAMES = ['.scsi.yaml', '.scsi.yml'];
+
+/** A setting a config file may hold, and the environment variable it stands for. */
+export interface ConfigFileSetting {
+  /** Dotted path of the setting in the file, e.g. `chunk.lines` for `chunk: { lines: 20 }`. */
+  key: string;
+  env: string;
+  /** Whether the value is a list, given as a YAML sequence or a comma-separated string. */
+  list?: boolean;
+  /** Whether the value is a path, resolved against the directory of the file. */
+  path?: boolean;
+}
+
+export interface ConfigFile {
+  path: string;
+  /** Environment variable values given by the file, by variable name. */
+  env: Record<string, string>;
+  /** Keys of the file that are not settings, e.g. misspelled ones. */
+  unknownKeys: string[];
+}
+
+/**
+ * Finds the config file closest to a directory, looking in it and then in each parent directory.
+ *
+ * @returns The path of the file, or undefined if there is none up to the filesystem root.
+ */
+export function findConfigFile(startDir: string): string | undefined {
+  let dir = path.resolve(startDir);
+  for (;;) {
+    for (const name of CONFIG_FILE_NAMES) {
+      const candidate = path.join(dir, name);
+      if (fs.existsSync(candidate) && fs.statSync(candidate).isFile()) {
+        return candidate;
+      }
+    }
+    const parent = path.dirname(dir);
+    if (parent === dir) {
+      return undefined;
+    }
+    dir = parent;
+  }
+}
+
+function isPlainObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
+
+function isScalar(value: unknown): value is string | number | boolean {
+  return typeof value === 'string' || typeof value === 'number' || typeof value === 'boolean';
+}
+
+/** Flattens nested mappings into dotted keys, e.g. `{ chunk: { lines: 20 } }` into `chunk.lines`. */
+function flatten(value: Record<string, unknown>, prefix: string, out: Map<string, unknown>): void {
+  for (const [name, child] of Object.entries(value)) {
+    const key = prefix ? `${prefix}.${name}` : name;
+    if (isPlainObject(child)) {
+      flatten(child, key, out);
+    } else {
+      out.set(key, child);
+    }
+  }
+}
+
+/**
+ * Reads a config file into the environment variables its settings stand for.
+ *
+ * Settings left empty (`embedder:`) are skipped. Keys that are not settings are collected in
+ * `unknownKeys` instead of failing, while a value of the wrong shape throws.
+ *
+ * @param filePath The YAML file to read.
+ * @param settings The settings the file may hold.
+ */
+export function readConfigFile(filePath: string, settings: readonly ConfigFileSetting[]): ConfigFile {
+  let parsed: unknown;
+  try {
+    parsed = yaml.load(fs.readFileSync(filePath, 'utf8'), { schema: yaml.JSON_SCHEMA });
+  } catch (error) {
+    throw new Error(`Invalid configuration: cannot read ${filePath}: ${(error as Error).message}`);
+  }
+  if (parsed === undefined || parsed === null) {
+    return { path: filePath, env: {}, unknownKeys: [] };
+  }
+  if (!isPlainObject(parsed)) {
+    throw new Error(`Invalid configuration: ${filePath} must hold a mapping of settings`);
+  }
+
+  const values = new Map<string, unknown>();
+  flatten(parsed, '', values);
+  const byKey = new Map(settings.map((setting) => [setting.key, setting]));
+  const env: Record<string, string> = {};
+  const unknownKeys: string[] = [];
+  for (const [key, value] of values) {
+    const setting = byKey.get(key);
+    if (!setting) {
+      unknownKeys.push(key);
+      continue;
+    }
+    if (value === null) {
+      continue;
+    }
+    let text: string;
+    if (setting.list && Array.isArray(value) && value.every(isScalar)) {
+      text = value.join(',');
+    } else if (isScalar(value)) {
+      text = String(value);
+    } else {
+      const expected = setting.list ? 'a list or a comma-separated string' : 'a string, number, or boolean';
+      throw new Error(`Invalid configuration: ${key} in ${filePath} must be ${expected}`);
+    }
+    env[setting.env] = setting.path ? path.resolve(path.dirname(filePath), text) : text;
+  }
+  return { path: filePath, env, unknownKeys };
+}
+
+/**
+ * Sets the environment variables of a config file that are not set already, so the environment
+ * (and the command-line flags that override it) takes precedence over the file. Empty variables
+ * count as unset, as they do for the settings in `config.ts`.
+ *
+ * @returns The names of the variables that were set.
+ */
+export function applyConfigFile(file: ConfigFile, env: NodeJS.ProcessEnv = process.env): string[] {
+  const applied: string[] = [];
+  for (const [name, value] of Object.entries(file.env)) {
+    if (!env[name]?.trim()) {
+      env[name] = value;
+      applied.push(name);
+    }
+  }
+  return applied;
+}
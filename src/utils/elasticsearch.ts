@@ -12,6 +12,20 @@ import { createHash } from 'crypto';
 import { elasticsearchConfig, indexingConfig, appConfig } from '../config';
 export { elasticsearchConfig };
 import { logger } from './logger';
+import { getConfiguredEmbedder } from './embedder';
+import { extractKeywordTerms, getSymbolTokens, tokenizeIdentifiers } from './hybrid_search';
+import {
+  POST_FILTER_CANDIDATE_FACTOR,
+  PostFilterOptions,
+  SearchFilters,
+  createLocationMatcher,
+  fetchPostFiltered,
+  expandKindFilter,
+  hasSearchFilters,
+} from './search_filters';
+import { DEFAULT_VECTOR_METRIC, VectorMetric } from './vector_metric';
+import { SymbolName } from './symbol_search';
+import { WorkspaceStats } from './workspace';
 
 /**
  * The Elasticsearch client instance.
@@ -181,18 +195,32 @@ function summarizeElasticsearchError(error: unknown): ElasticsearchErrorSummary
   return summary;
 }
 
+/** Default `code_vector` dimensions (based on microsoft/codebert-base). */
+const DEFAULT_VECTOR_DIMENSIONS = 768;
+
+/** `dense_vector` similarity of each metric; `max_inner_product` is the dot product without unit-length vectors. */
+export const ELASTICSEARCH_SIMILARITIES: Record<VectorMetric, string> = {
+  cosine: 'cosine',
+  dot_product: 'max_inner_product',
+  euclidean: 'l2_norm',
+};
+
 /**
  * Creates the Elasticsearch index for storing code chunks.
  *
  * This function checks if the index already exists. If it doesn't, it creates
  * the index with the correct mappings for the code chunk documents.
+ *
+ * @param options.metric How `code_vector` is compared (default: `cosine`).
  */
-export async function createIndex(index: string): Promise<void> {
+export async function createIndex(index: string, options: { metric?: VectorMetric } = {}): Promise<void> {
   const indexName = index;
   const client = getClient();
 
   const semanticTextEnabled = !elasticsearchConfig.disableSemanticText;
   const semanticTextInferenceId = semanticTextEnabled ? getElserInferenceIdOrThrow() : undefined;
+  // A client-side embedder dictates the vector size; otherwise keep the ingest pipeline default.
+  const vectorDimensions = getConfiguredEmbedder()?.dimensions() ?? DEFAULT_VECTOR_DIMENSIONS;
 
   const indexExists = await client.indices.exists({ index: indexName });
   if (!indexExists) {
@@ -229,6 +257,11 @@ export async function createIndex(index: string): Promise<void> {
             },
           },
           containerPath: { type: 'text' },
+          parentSymbol: { type: 'keyword' },
+          // Words of the symbol names, so "parse json" matches `ParseJSONConfig`
+          symbolTokens: { type: 'text' },
+          // Front matter keys differ between files; flattened avoids a mapping per key
+          frontMatter: { type: 'flattened' },
           chunk_hash: { type: 'keyword' },
           content: { type: 'text' },
           ...(semanticTextEnabled
@@ -241,9 +274,9 @@ export async function createIndex(index: string): Promise<void> {
             : {}),
           code_vector: {
             type: 'dense_vector',
-            dims: 768, // Based on microsoft/codebert-base
+            dims: vectorDimensions,
             index: true,
-            similarity: 'cosine',
+            similarity: ELASTICSEARCH_SIMILARITIES[options.metric ?? DEFAULT_VECTOR_METRIC],
           },
           created_at: { type: 'date' },
           updated_at: { type: 'date' },
@@ -274,6 +307,9 @@ export interface ChunkLocation {
   directoryDepth?: number;
   git_file_hash?: string;
   git_branch?: string;
+  /** Workspace the location was indexed from; missing on locations stored before workspaces were recorded. */
+  workspace?: string;
+  blame?: ChunkBlame;
   updated_at: string;
 }
 
@@ -302,12 +338,25 @@ export async function createLocationsIndex(index: string): Promise<void> {
           directoryDepth: { type: 'integer' },
           git_file_hash: { type: 'keyword' },
           git_branch: { type: 'keyword' },
+          workspace: { type: 'keyword' },
+          blame: {
+            properties: {
+              commit: { type: 'keyword' },
+              author: { type: 'keyword' },
+              date: { type: 'date' },
+            },
+          },
           updated_at: { type: 'date' },
         },
       },
     });
   } else {
     logger.info(`Index "${locationsIndexName}" already exists.`);
+    // Indices created before workspaces were recorded would otherwise map the field as text
+    await getClient().indices.putMapping({
+      index: locationsIndexName,
+      properties: { workspace: { type: 'keyword' } },
+    });
   }
 }
 
@@ -328,6 +377,8 @@ export async function createSettingsIndex(index: string): Promise<void> {
         properties: {
           branch: { type: 'keyword' },
           commit_hash: { type: 'keyword' },
+          embedder: { type: 'keyword' },
+          embed_template: { type: 'keyword', index: false },
           updated_at: { type: 'date' },
         },
       },
@@ -382,6 +433,69 @@ export async function updateLastIndexedCommit(branch: string, commitHash: string
   });
 }
 
+/** Settings document of the embedding model; git forbids `:` in branch names, so no branch collides with it. */
+const EMBEDDING_MODEL_SETTING_ID = 'setting:embedding_model';
+
+/**
+ * Retrieves the embedder and embed template the stored vectors were made with.
+ *
+ * @param index The base name of the Elasticsearch index.
+ * @returns A promise that resolves to the embedding model or null if none was recorded.
+ */
+export async function getEmbeddingModel(index: string): Promise<EmbeddingModel | null> {
+  try {
+    const response = await getClient().get<{ embedder: string; embed_template: string }>({
+      index: `${index}_settings`,
+      id: EMBEDDING_MODEL_SETTING_ID,
+    });
+    return response._source ? { embedder: response._source.embedder, template: response._source.embed_template } : null;
+  } catch (error: unknown) {
+    if (error instanceof Error && 'meta' in error && (error.meta as { statusCode?: number }).statusCode === 404) {
+      return null;
+    }
+    throw error;
+  }
+}
+
+/**
+ * Records the embedder and embed template the stored vectors are made with, or forgets them.
+ *
+ * @param model The embedding model, or null to remove the recorded one (used by `--clean`).
+ * @param index The base name of the Elasticsearch index.
+ * @returns A promise that resolves when the update is complete.
+ */
+export async function updateEmbeddingModel(model: EmbeddingModel | null, index: string): Promise<void> {
+  const settingsIndexName = `${index}_settings`;
+  if (model === null) {
+    try {
+      await getClient().delete({ index: settingsIndexName, id: EMBEDDING_MODEL_SETTING_ID, refresh: true });
+    } catch (error: unknown) {
+      if (!(error instanceof Error && 'meta' in error && (error.meta as { statusCode?: number }).statusCode === 404)) {
+        throw error;
+      }
+    }
+    return;
+  }
+  await getClient().index({
+    index: settingsIndexName,
+    id: EMBEDDING_MODEL_SETTING_ID,
+    document: {
+      embedder: model.embedder,
+      embed_template: model.template,
+      updated_at: new Date().toISOString(),
+    },
+    refresh: true,
+  });
+}
+
+/** The embedder and embed template that made a store's vectors, see `canReuseStoredVectors`. */
+export interface EmbeddingModel {
+  /** `Embedder.name`, which names the model for embedders that take one (e.g. `http:text-embedding-3-small`). */
+  embedder: string;
+  /** Embed template the embedded texts were rendered with (`SCS_IDXR_EMBED_TEMPLATE`). */
+  template: string;
+}
+
 export interface SymbolInfo {
   name: string;
   kind: string;
@@ -394,6 +508,15 @@ export interface ExportInfo {
   target?: string;
 }
 
+/** The commit that last changed the lines of a chunk occurrence, from `git blame`. */
+export interface ChunkBlame {
+  /** SHA of the commit. */
+  commit: string;
+  author: string;
+  /** Author date of the commit (ISO 8601). */
+  date: string;
+}
+
 export interface CodeChunk {
   type: 'code' | 'doc';
   language: string;
@@ -402,6 +525,28 @@ export interface CodeChunk {
   symbols?: SymbolInfo[];
   exports?: ExportInfo[];
   containerPath?: string;
+  /**
+   * Name of the function or method this chunk is a window of, when an oversized symbol body was split
+   * into overlapping windows. All windows of the same symbol share it. For a SQL query extracted from a
+   * string literal, the function the query is in.
+   */
+  parentSymbol?: string;
+  /**
+   * First line of the symbol (usually its signature) that a window after the first is prefixed with.
+   * `content` starts with it, but `startLine` and `endLine` only count the lines below it. Only set on
+   * chunks from the parser; the stores do not keep it.
+   */
+  header?: string;
+  /**
+   * Imports (and Go package) of the file the chunk was cut from, added to `semantic_text` when
+   * `ChunkOptions.includeImports` is set. Unlike `imports`, which lists the imports a chunk declares,
+   * it is part of the document id: identical code under different imports is stored once per context.
+   */
+  importContext?: { packageName?: string; imports: string[] };
+  /** Words of the symbol names, added by the stores for keyword search (see `getSymbolTokens`). */
+  symbolTokens?: string[];
+  /** YAML front matter of the Markdown file the chunk belongs to. */
+  frontMatter?: Record<string, unknown>;
   /**
    * File path for this chunk occurrence.
    *
@@ -415,6 +560,13 @@ export interface CodeChunk {
   directoryDepth?: number;
   git_file_hash?: string;
   git_branch?: string;
+  /**
+   * Workspace (repository or checkout) the occurrence was indexed from, so that one index can hold
+   * several of them side by side. Like `git_branch`, it is part of the location id.
+   */
+  workspace?: string;
+  /** Last commit of the lines of this occurrence, set when `ChunkOptions.includeBlame` is on. */
+  blame?: ChunkBlame;
   chunk_hash: string;
   startLine?: number;
   endLine?: number;
@@ -431,28 +583,39 @@ export interface CodeChunk {
  * Uses SHA256(content + language + type + kind + containerPath) to ensure identical code
  * from different files maps to the same document.
  */
-function getChunkDocumentId(chunk: CodeChunk): string {
+export function getChunkDocumentId(chunk: CodeChunk): string {
   // IMPORTANT: Do NOT include file-specific metadata (path, branch, line numbers)
   // in the hash input. This ensures identical content shares the same ID.
-  const stable = [chunk.type, chunk.language, chunk.kind ?? '', chunk.containerPath ?? '', chunk.content].join(':');
+  const parts = [chunk.type, chunk.language, chunk.kind ?? '', chunk.containerPath ?? '', chunk.content];
+  if (chunk.importContext) {
+    // Only chunks indexed with imports carry one, so ids of the others are unchanged
+    parts.push(JSON.stringify(chunk.importContext));
+  }
+  const stable = parts.join(':');
 
   return createHash('sha256').update(stable).digest('hex');
 }
 
-function getChunkLocationDocumentId(location: {
+export function getChunkLocationDocumentId(location: {
   chunk_id: string;
   filePath: string;
   startLine: number;
   endLine: number;
   git_branch?: string;
+  workspace?: string;
 }): string {
-  const stable = [
+  const parts = [
     location.chunk_id,
     location.filePath,
     String(location.startLine),
     String(location.endLine),
     location.git_branch ?? '',
-  ].join(':');
+  ];
+  if (location.workspace !== undefined) {
+    // Only locations of a workspace carry one, so ids of the others are unchanged
+    parts.push(location.workspace);
+  }
+  const stable = parts.join(':');
 
   return createHash('sha256').update(stable).digest('hex');
 }
@@ -483,6 +646,14 @@ export interface BulkIndexResult {
   failed: BulkIndexFailed[];
 }
 
+/** What deleting the documents of some files removed from a store. */
+export interface DeleteDocumentsResult {
+  /** Locations removed, one per occurrence of a chunk in one of the files. */
+  locations: number;
+  /** Chunks removed because none of their locations was left. */
+  chunks: number;
+}
+
 /**
  * Indexes an array of code chunks into Elasticsearch.
  *
@@ -583,6 +754,9 @@ export async function indexCodeChunks(chunks: CodeChunk[], index: string): Promi
         symbols: base.symbols,
         exports: base.exports,
         containerPath: base.containerPath,
+        parentSymbol: base.parentSymbol,
+        symbolTokens: getSymbolTokens(base),
+        frontMatter: base.frontMatter,
         chunk_hash: base.chunk_hash,
         content: base.content,
         ...(semanticTextEnabled ? { semantic_text: base.semantic_text } : {}),
@@ -673,6 +847,7 @@ export async function indexCodeChunks(chunks: CodeChunk[], index: string): Promi
       startLine: chunk.startLine,
       endLine: chunk.endLine,
       git_branch: chunk.git_branch,
+      workspace: chunk.workspace,
     });
 
     const locationDoc: Record<string, unknown> = {
@@ -685,6 +860,8 @@ export async function indexCodeChunks(chunks: CodeChunk[], index: string): Promi
       directoryDepth: chunk.directoryDepth,
       git_file_hash: chunk.git_file_hash,
       git_branch: chunk.git_branch,
+      workspace: chunk.workspace,
+      blame: chunk.blame,
       updated_at: now,
     };
 
@@ -825,25 +1002,344 @@ export async function indexHasSemanticTextField(index: string): Promise<boolean>
   return false;
 }
 
+/**
+ * Reads the `dims` of the `code_vector` field from the index mapping.
+ *
+ * @param index The name of the Elasticsearch index to inspect.
+ * @returns The vector dimensions, or null if the index or field does not exist.
+ */
+export async function getVectorDimensions(index: string): Promise<number | null> {
+  const client = getClient();
+  const exists = await client.indices.exists({ index });
+  if (!exists) {
+    return null;
+  }
+
+  const response = (await client.indices.getMapping({ index })) as unknown as Record<string, unknown>;
+  for (const entry of Object.values(response)) {
+    const codeVector = (entry as { mappings?: { properties?: Record<string, { dims?: unknown }> } })?.mappings
+      ?.properties?.code_vector;
+    if (codeVector && typeof codeVector.dims === 'number') {
+      return codeVector.dims;
+    }
+  }
+
+  return null;
+}
+
+/**
+ * Reads the `similarity` of the `code_vector` field from the index mapping.
+ *
+ * @returns The similarity, or null if the index or field does not exist.
+ */
+export async function getVectorSimilarity(index: string): Promise<string | null> {
+  const client = getClient();
+  const exists = await client.indices.exists({ index });
+  if (!exists) {
+    return null;
+  }
+
+  const response = (await client.indices.getMapping({ index })) as unknown as Record<string, unknown>;
+  for (const entry of Object.values(response)) {
+    const codeVector = (entry as { mappings?: { properties?: Record<string, { similarity?: unknown }> } })?.mappings
+      ?.properties?.code_vector;
+    if (codeVector && typeof codeVector.similarity === 'string') {
+      return codeVector.similarity;
+    }
+  }
+
+  return null;
+}
+
+/**
+ * Composition of a chunk store, as reported by `ChunkStore.getStats`.
+ */
+export interface StoreStats {
+  /** Distinct file paths with at least one indexed chunk, across branches. */
+  files: number;
+  /** Stored chunks. Identical content in several files is stored, and counted, once. */
+  chunks: number;
+  /** Chunks per language. */
+  languages: Record<string, number>;
+  /** Chunks per kind (tree-sitter node type, or `section` for Markdown); chunks without a kind are not counted. */
+  kinds: Record<string, number>;
+  /** Size of the store on disk in bytes, or null if the backend does not report it. */
+  sizeBytes: number | null;
+}
+
+/** Buckets requested per terms aggregation; more languages or kinds than this are not expected. */
+const STATS_TERMS_SIZE = 1000;
+
+/**
+ * Counts the files, chunks, languages, and kinds of an index, and its size on disk.
+ *
+ * The file count is a `cardinality` aggregation, which is exact up to 40,000 files and approximate beyond.
+ * The size includes replicas and the `_locations` and `_settings` indices.
+ *
+ * @param index The base name of the Elasticsearch index.
+ * @returns The stats; all zero if the index does not exist.
+ */
+export async function getIndexStats(index: string): Promise<StoreStats> {
+  const client = getClient();
+  const locationsIndexName = getLocationsIndexName(index);
+  const stats: StoreStats = { files: 0, chunks: 0, languages: {}, kinds: {}, sizeBytes: 0 };
+
+  if (!(await client.indices.exists({ index }))) {
+    return stats;
+  }
+
+  const response = await client.search({
+    index,
+    size: 0,
+    track_total_hits: true,
+    aggs: {
+      languages: { terms: { field: 'language', size: STATS_TERMS_SIZE } },
+      kinds: { terms: { field: 'kind', size: STATS_TERMS_SIZE } },
+    },
+  });
+  const total = response.hits.total;
+  stats.chunks = typeof total === 'number' ? total : (total?.value ?? 0);
+  const aggregations = response.aggregations as unknown as Record<
+    'languages' | 'kinds',
+    { buckets?: Array<{ key: string; doc_count: number }> } | undefined
+  >;
+  for (const bucket of aggregations?.languages?.buckets ?? []) {
+    stats.languages[bucket.key] = bucket.doc_count;
+  }
+  for (const bucket of aggregations?.kinds?.buckets ?? []) {
+    stats.kinds[bucket.key] = bucket.doc_count;
+  }
+
+  const statsIndices = [index];
+  if (await client.indices.exists({ index: locationsIndexName })) {
+    statsIndices.push(locationsIndexName);
+    const files = await client.search({
+      index: locationsIndexName,
+      size: 0,
+      aggs: { files: { cardinality: { field: 'filePath', precision_threshold: 40000 } } },
+    });
+    stats.files = (files.aggregations as unknown as { files?: { value?: number } })?.files?.value ?? 0;
+  }
+
+  if (await client.indices.exists({ index: `${index}_settings` })) {
+    statsIndices.push(`${index}_settings`);
+  }
+  const storeStats = await client.indices.stats({ index: statsIndices, metric: 'store' });
+  stats.sizeBytes = storeStats._all?.total?.store?.size_in_bytes ?? null;
+
+  return stats;
+}
+
 /**
  * Performs a semantic search on the code chunks in the index.
  *
  * @param query The natural language query to search for.
  * @param index The name of the Elasticsearch index to search.
  * @param size The number of results to return (default: 10).
+ * @param filters Optional language, path, kind, and workspace filters.
+ * @param options How many candidates path and workspace filters fetch per result.
  * @returns A promise that resolves to an array of search results.
  */
-export async function searchCodeChunks(query: string, index: string, size: number = 10): Promise<SearchResult[]> {
+export async function searchCodeChunks(
+  query: string,
+  index: string,
+  size: number = 10,
+  filters?: SearchFilters,
+  options?: PostFilterOptions
+): Promise<SearchResult[]> {
   const indexName = index;
-  const response = await getClient().search<CodeChunk>({
-    index: indexName,
-    size,
-    query: {
+  const filter = toChunkFilterClauses(filters);
+  return searchWithLocationFilters(index, size, filters, options, async (candidates) => {
+    const semantic: QueryDslQueryContainer = {
       semantic: {
         field: 'semantic_text',
         query: query,
       },
+    };
+    const response = await getClient().search<CodeChunk>({
+      index: indexName,
+      size: candidates,
+      query: filter.length > 0 ? { bool: { must: [semantic], filter } } : semantic,
+    });
+    return response.hits.hits
+      .filter((hit): hit is SearchHit<CodeChunk> & { _id: string } => typeof hit._id === 'string' && hit._id.length > 0)
+      .map((hit) => ({
+        id: hit._id,
+        ...(hit._source as CodeChunk),
+        score: hit._score ?? 0,
+      }));
+  });
+}
+
+/** Most locations checked per chunk when a path or workspace filter is applied after retrieval. */
+const LOCATION_FILTER_LOCATIONS_PER_CHUNK = 50;
+
+/**
+ * Returns the filter clauses for the language and kind filters. Chunk documents carry no file paths
+ * or workspaces, so those filters are applied by `searchWithLocationFilters` instead.
+ */
+function toChunkFilterClauses(filters: SearchFilters | undefined): QueryDslQueryContainer[] {
+  if (!hasSearchFilters(filters)) {
+    return [];
+  }
+  return [
+    ...(filters.language ? [{ term: { language: filters.language } }] : []),
+    ...(filters.kind ? [{ terms: { kind: expandKindFilter(filters.kind) } }] : []),
+  ];
+}
+
+/**
+ * Runs a chunk search and, with a path or workspace filter, keeps only chunks with a location that
+ * matches both.
+ *
+ * Locations live in `<index>_locations`, so `run` is asked for `options.overfetchFactor` times as many
+ * candidates, which are then checked against their locations; see `fetchPostFiltered` for how more are
+ * fetched when too few match. Kept results carry their first matching location.
+ *
+ * @param run Searches the chunk index for the given number of results.
+ */
+async function searchWithLocationFilters(
+  index: string,
+  size: number,
+  filters: SearchFilters | undefined,
+  options: PostFilterOptions | undefined,
+  run: (size: number) => Promise<SearchResult[]>
+): Promise<SearchResult[]> {
+  const matchesLocation = createLocationMatcher(filters);
+  if (!matchesLocation) {
+    return run(size);
+  }
+  return fetchPostFiltered(size, options?.overfetchFactor ?? POST_FILTER_CANDIDATE_FACTOR, async (count) => {
+    const candidates = await run(count);
+    const locationsByChunkId = await getLocationsForChunkIds(
+      candidates.map((result) => result.id),
+      { index, perChunkLimit: LOCATION_FILTER_LOCATIONS_PER_CHUNK }
+    );
+    const results = candidates.flatMap((result) => {
+      const location = locationsByChunkId[result.id]?.find(matchesLocation);
+      if (!location) {
+        return [];
+      }
+      return [
+        {
+          ...result,
+          filePath: location.filePath,
+          startLine: location.startLine,
+          endLine: location.endLine,
+          ...(location.gitFileHash !== undefined ? { git_file_hash: location.gitFileHash } : {}),
+          ...(location.workspace !== undefined ? { workspace: location.workspace } : {}),
+          ...(location.blame ? { blame: location.blame } : {}),
+        },
+      ];
+    });
+    return { results, exhausted: candidates.length < count };
+  });
+}
+
+/**
+ * Performs a kNN search over the `code_vector` field.
+ *
+ * @param queryVector The query embedding; must match the index vector dimensions.
+ * @param index The name of the Elasticsearch index to search.
+ * @param k The number of results to return.
+ * @param filters Optional language, path, kind, and workspace filters; language and kind are applied inside the
+ *   kNN search.
+ * @param options How many candidates path and workspace filters fetch per result.
+ * @returns A promise that resolves to the top-k chunks, best match first.
+ */
+export async function searchByVector(
+  queryVector: number[],
+  index: string,
+  k: number,
+  filters?: SearchFilters,
+  options?: PostFilterOptions
+): Promise<SearchResult[]> {
+  const filter = toChunkFilterClauses(filters);
+  return searchWithLocationFilters(index, k, filters, options, async (candidates) => {
+    const response = await getClient().search<CodeChunk>({
+      index,
+      size: candidates,
+      knn: {
+        field: 'code_vector',
+        query_vector: queryVector,
+        k: candidates,
+        num_candidates: Math.max(100, candidates * 10),
+        ...(filter.length > 0 ? { filter } : {}),
+      },
+      _source: { excludes: ['code_vector'] },
+    });
+    return response.hits.hits
+      .filter((hit): hit is SearchHit<CodeChunk> & { _id: string } => typeof hit._id === 'string' && hit._id.length > 0)
+      .map((hit) => ({
+        id: hit._id,
+        ...(hit._source as CodeChunk),
+        score: hit._score ?? 0,
+      }));
+  });
+}
+
+/**
+ * Performs a BM25 keyword search over chunk content and symbol names.
+ *
+ * Exact matches of a term against a defined symbol or the parent symbol of a window are boosted, so
+ * searching for an identifier ranks its definition above chunks that merely mention it. The words of
+ * the terms are also matched against the words of the symbol names (`symbolTokens`), so `parse json`
+ * finds `ParseJSONConfig`.
+ *
+ * @param query The keyword query.
+ * @param index The name of the Elasticsearch index to search.
+ * @param size The number of results to return.
+ * @param filters Optional language, path, kind, and workspace filters.
+ * @param options How many candidates path and workspace filters fetch per result.
+ * @returns A promise that resolves to the top matching chunks, best match first.
+ */
+export async function searchByKeyword(
+  query: string,
+  index: string,
+  size: number,
+  filters?: SearchFilters,
+  options?: PostFilterOptions
+): Promise<SearchResult[]> {
+  const terms = extractKeywordTerms(query);
+  if (terms.length === 0) {
+    return [];
+  }
+  const filter = toChunkFilterClauses(filters);
+  return searchWithLocationFilters(index, size, filters, options, (candidates) =>
+    searchByKeywordTerms(terms, index, candidates, filter)
+  );
+}
+
+async function searchByKeywordTerms(
+  terms: string[],
+  index: string,
+  size: number,
+  filter: QueryDslQueryContainer[]
+): Promise<SearchResult[]> {
+  const words = tokenizeIdentifiers(terms);
+  const response = await getClient().search<CodeChunk>({
+    index,
+    size,
+    query: {
+      bool: {
+        ...(filter.length > 0 ? { filter } : {}),
+        should: [
+          { match: { content: { query: terms.join(' ') } } },
+          {
+            nested: {
+              path: 'symbols',
+              query: { terms: { 'symbols.name': terms } },
+              score_mode: 'max',
+              boost: 2,
+            },
+          },
+          { terms: { parentSymbol: terms, boost: 2 } },
+          ...(words.length > 0 ? [{ match: { symbolTokens: { query: words.join(' '), boost: 2 } } }] : []),
+        ],
+        minimum_should_match: 1,
+      },
     },
+    _source: { excludes: ['code_vector'] },
   });
   return response.hits.hits
     .filter((hit): hit is SearchHit<CodeChunk> & { _id: string } => typeof hit._id === 'string' && hit._id.length > 0)
@@ -854,12 +1350,154 @@ export async function searchCodeChunks(query: string, index: string, size: numbe
     }));
 }
 
+/**
+ * Returns the distinct names and kinds of the symbols recorded on the chunks of an index.
+ *
+ * Pages through a composite aggregation over the nested `symbols`, so every name is listed however
+ * many there are.
+ */
+export async function getSymbolNames(index: string): Promise<SymbolName[]> {
+  const client = getClient();
+  const names: SymbolName[] = [];
+  let after: Record<string, FieldValue> | undefined;
+  while (true) {
+    const response = await client.search({
+      index,
+      size: 0,
+      aggs: {
+        symbols: {
+          nested: { path: 'symbols' },
+          aggs: {
+            names: {
+              composite: {
+                size: 1000,
+                sources: [
+                  { name: { terms: { field: 'symbols.name' } } },
+                  { kind: { terms: { field: 'symbols.kind' } } },
+                ],
+                ...(after ? { after } : {}),
+              },
+            },
+          },
+        },
+      },
+    });
+
+    const aggregation = (
+      response.aggregations as unknown as {
+        symbols?: {
+          names?: { after_key?: Record<string, FieldValue>; buckets?: Array<{ key?: Record<string, unknown> }> };
+        };
+      }
+    )?.symbols?.names;
+    const buckets = aggregation?.buckets ?? [];
+    for (const { key } of buckets) {
+      if (typeof key?.name === 'string' && typeof key.kind === 'string') {
+        names.push({ name: key.name, kind: key.kind });
+      }
+    }
+
+    if (buckets.length === 0 || !aggregation?.after_key) {
+      break;
+    }
+    after = aggregation.after_key;
+  }
+  return names;
+}
+
+/**
+ * Returns up to `size` chunks with a symbol named `name`, each with its first location, by file path.
+ *
+ * @param name The exact symbol name.
+ * @param index The name of the Elasticsearch index to search.
+ * @param size The number of results to return.
+ * @param filters Optional language, path, kind, and workspace filters.
+ */
+export async function searchBySymbolName(
+  name: string,
+  index: string,
+  size: number,
+  filters?: SearchFilters
+): Promise<SearchResult[]> {
+  const filter = toChunkFilterClauses(filters);
+  const results = await searchWithLocationFilters(index, size, filters, {}, async (candidates) => {
+    const response = await getClient().search<CodeChunk>({
+      index,
+      size: candidates,
+      query: {
+        bool: { filter: [...filter, { nested: { path: 'symbols', query: { term: { 'symbols.name': name } } } }] },
+      },
+      _source: { excludes: ['code_vector'] },
+    });
+    return response.hits.hits
+      .filter((hit): hit is SearchHit<CodeChunk> & { _id: string } => typeof hit._id === 'string' && hit._id.length > 0)
+      .map((hit) => ({ id: hit._id, ...(hit._source as CodeChunk), score: hit._score ?? 0 }));
+  });
+
+  // Chunk documents do not carry locations; look them up in `<index>_locations`.
+  const withoutLocation = results.filter((result) => !result.filePath).map((result) => result.id);
+  const locationsByChunkId =
+    withoutLocation.length > 0 ? await getLocationsForChunkIds(withoutLocation, { index, perChunkLimit: 1 }) : {};
+  return results
+    .map((result) => {
+      const location = result.filePath ? undefined : locationsByChunkId[result.id]?.[0];
+      if (!location) {
+        return result;
+      }
+      return {
+        ...result,
+        filePath: location.filePath,
+        startLine: location.startLine,
+        endLine: location.endLine,
+        ...(location.gitFileHash !== undefined ? { git_file_hash: location.gitFileHash } : {}),
+        ...(location.workspace !== undefined ? { workspace: location.workspace } : {}),
+        ...(location.blame ? { blame: location.blame } : {}),
+      };
+    })
+    .sort((a, b) => (a.filePath ?? '').localeCompare(b.filePath ?? '') || (a.startLine ?? 0) - (b.startLine ?? 0));
+}
+
 export type ChunkLocationSummary = {
   filePath: string;
   startLine: number;
   endLine: number;
+  /** Git blob hash of the file when the location was indexed. */
+  gitFileHash?: string;
+  /** Workspace the location was indexed from, if recorded. */
+  workspace?: string;
+  /** Last commit of the location's lines, if blame was recorded. */
+  blame?: ChunkBlame;
 };
 
+/**
+ * Reads the stored `code_vector` of chunk documents by id.
+ *
+ * @returns The vectors by chunk id; chunks that are not indexed or have no vector are missing.
+ */
+export async function getChunkVectors(chunkIds: string[], index: string): Promise<Map<string, number[]>> {
+  const vectors = new Map<string, number[]>();
+  const uniqueChunkIds = Array.from(new Set(chunkIds)).filter((id) => typeof id === 'string' && id.length > 0);
+  if (uniqueChunkIds.length === 0) {
+    return vectors;
+  }
+
+  const client = getClient();
+  for (const ids of chunkArray(uniqueChunkIds, ES_TERMS_QUERY_BATCH_SIZE)) {
+    const response = await client.mget<{ code_vector?: number[] }>({
+      index,
+      ids,
+      _source_includes: ['code_vector'],
+    });
+    for (const doc of response.docs) {
+      const vector = 'found' in doc && doc.found ? doc._source?.code_vector : undefined;
+      if (Array.isArray(vector) && vector.length > 0) {
+        vectors.set(doc._id, vector);
+      }
+    }
+  }
+  return vectors;
+}
+
 export async function getLocationsForChunkIds(
   chunkIds: string[],
   options: { index: string; perChunkLimit?: number }
@@ -897,7 +1535,7 @@ export async function getLocationsForChunkIds(
           locations: {
             top_hits: {
               size: perChunkLimit,
-              _source: ['filePath', 'startLine', 'endLine'],
+              _source: ['filePath', 'startLine', 'endLine', 'git_file_hash', 'workspace', 'blame'],
               sort: [{ filePath: { order: 'asc' } }, { startLine: { order: 'asc' } }],
             },
           },
@@ -921,12 +1559,28 @@ export async function getLocationsForChunkIds(
     const hits = bucket.locations?.hits?.hits ?? [];
     const locations: ChunkLocationSummary[] = [];
     for (const h of hits) {
-      const s = h._source as { filePath?: unknown; startLine?: unknown; endLine?: unknown } | undefined;
+      const s = h._source as
+        | {
+            filePath?: unknown;
+            startLine?: unknown;
+            endLine?: unknown;
+            git_file_hash?: unknown;
+            workspace?: unknown;
+            blame?: ChunkBlame;
+          }
+        | undefined;
       if (!s) continue;
       if (typeof s.filePath !== 'string') continue;
       if (typeof s.startLine !== 'number') continue;
       if (typeof s.endLine !== 'number') continue;
-      locations.push({ filePath: s.filePath, startLine: s.startLine, endLine: s.endLine });
+      locations.push({
+        filePath: s.filePath,
+        startLine: s.startLine,
+        endLine: s.endLine,
+        ...(typeof s.git_file_hash === 'string' ? { gitFileHash: s.git_file_hash } : {}),
+        ...(typeof s.workspace === 'string' ? { workspace: s.workspace } : {}),
+        ...(s.blame ? { blame: s.blame } : {}),
+      });
     }
     result[chunkId] = locations;
   }
@@ -934,6 +1588,334 @@ export async function getLocationsForChunkIds(
   return result;
 }
 
+/**
+ * Matches the location documents of a workspace, and those without one (see `isInWorkspace`).
+ */
+function toWorkspaceQuery(workspace: string): QueryDslQueryContainer {
+  return {
+    bool: {
+      should: [{ term: { workspace } }, { bool: { must_not: { exists: { field: 'workspace' } } } }],
+      minimum_should_match: 1,
+    },
+  };
+}
+
+/**
+ * Lists the paths of all files with locations in the index, on any branch, sorted.
+ *
+ * @param index The base name of the Elasticsearch index.
+ * @param workspace If set, only files of this workspace are listed.
+ */
+export async function getIndexedFilePaths(index: string, workspace?: string): Promise<string[]> {
+  const client = getClient();
+  const locationsIndexName = getLocationsIndexName(index);
+  const filePaths: string[] = [];
+
+  const exists = await client.indices.exists({ index: locationsIndexName });
+  if (!exists) {
+    return filePaths;
+  }
+
+  let after: Record<string, FieldValue> | undefined;
+  while (true) {
+    const response = await client.search({
+      index: locationsIndexName,
+      size: 0,
+      ...(workspace !== undefined ? { query: toWorkspaceQuery(workspace) } : {}),
+      aggs: {
+        files: {
+          composite: {
+            size: 1000,
+            sources: [{ filePath: { terms: { field: 'filePath' } } }],
+            ...(after ? { after } : {}),
+          },
+        },
+      },
+    });
+
+    const files = (
+      response.aggregations as unknown as {
+        files?: { after_key?: Record<string, FieldValue>; buckets?: Array<{ key?: Record<string, unknown> }> };
+      }
+    )?.files;
+    const buckets = files?.buckets ?? [];
+    for (const bucket of buckets) {
+      if (typeof bucket.key?.filePath === 'string') {
+        filePaths.push(bucket.key.filePath);
+      }
+    }
+
+    if (buckets.length === 0 || !files?.after_key) {
+      break;
+    }
+    after = files.after_key;
+  }
+
+  return filePaths;
+}
+
+/**
+ * Counts the files and chunks of each workspace of an index, ordered by name.
+ *
+ * Locations stored before workspaces were recorded are counted under a `null` workspace, listed first.
+ * Both counts are `cardinality` aggregations, exact up to 40,000 and approximate beyond.
+ *
+ * @param index The base name of the Elasticsearch index.
+ */
+export async function getIndexWorkspaces(index: string): Promise<WorkspaceStats[]> {
+  const client = getClient();
+  const locationsIndexName = getLocationsIndexName(index);
+  const workspaces: WorkspaceStats[] = [];
+
+  const exists = await client.indices.exists({ index: locationsIndexName });
+  if (!exists) {
+    return workspaces;
+  }
+
+  let after: Record<string, FieldValue> | undefined;
+  while (true) {
+    const response = await client.search({
+      index: locationsIndexName,
+      size: 0,
+      aggs: {
+        workspaces: {
+          composite: {
+            size: 1000,
+            sources: [{ workspace: { terms: { field: 'workspace', missing_bucket: true } } }],
+            ...(after ? { after } : {}),
+          },
+          aggs: {
+            files: { cardinality: { field: 'filePath', precision_threshold: 40000 } },
+            chunks: { cardinality: { field: 'chunk_id', precision_threshold: 40000 } },
+          },
+        },
+      },
+    });
+
+    const aggregation = (
+      response.aggregations as unknown as {
+        workspaces?: {
+          after_key?: Record<string, FieldValue>;
+          buckets?: Array<{ key?: Record<string, unknown>; files?: { value?: number }; chunks?: { value?: number } }>;
+        };
+      }
+    )?.workspaces;
+    const buckets = aggregation?.buckets ?? [];
+    for (const bucket of buckets) {
+      const workspace = bucket.key?.workspace;
+      workspaces.push({
+        workspace: typeof workspace === 'string' ? workspace : null,
+        files: bucket.files?.value ?? 0,
+        chunks: bucket.chunks?.value ?? 0,
+      });
+    }
+
+    if (buckets.length === 0 || !aggregation?.after_key) {
+      break;
+    }
+    after = aggregation.after_key;
+  }
+
+  return workspaces;
+}
+
+/** Fields of a chunk document that `exportCodeChunks` copies onto the exported chunks. */
+const EXPORTED_CHUNK_FIELDS = [
+  'kind',
+  'imports',
+  'symbols',
+  'exports',
+  'containerPath',
+  'parentSymbol',
+  'frontMatter',
+  'code_vector',
+] as const;
+
+/** Location documents read per request while exporting a page of chunks. */
+const EXPORT_LOCATIONS_PAGE_SIZE = 5000;
+
+/** Fields of a location document that `exportCodeChunks` copies onto the exported chunks. */
+const EXPORTED_LOCATION_FIELDS = [
+  'directoryPath',
+  'directoryName',
+  'directoryDepth',
+  'git_file_hash',
+  'git_branch',
+  'workspace',
+  'blame',
+] as const;
+
+/**
+ * Reads every chunk document of the index with its vector, once per location, a page of chunks at a time.
+ *
+ * Chunks and locations are both scanned under a point in time, so concurrent writes do not shift pages.
+ * `semantic_text` is read as the text it was created from; its inference results are not exported, and
+ * importing the chunks into an index with `semantic_text` infers them again.
+ *
+ * @param index The base name of the Elasticsearch index.
+ * @param pageSize Chunk documents per page, at most 1000.
+ */
+export async function* exportCodeChunks(index: string, pageSize = 500): AsyncGenerator<CodeChunk[]> {
+  const client = getClient();
+  const locationsIndexName = getLocationsIndexName(index);
+  if (!(await client.indices.exists({ index })) || !(await client.indices.exists({ index: locationsIndexName }))) {
+    return;
+  }
+
+  const size = Math.max(1, Math.min(ES_TERMS_QUERY_BATCH_SIZE, Math.floor(pageSize)));
+  const keepAlive = '5m';
+  const chunksPit = await client.openPointInTime({ index, keep_alive: keepAlive });
+  const locationsPit = await client.openPointInTime({ index: locationsIndexName, keep_alive: keepAlive });
+  try {
+    let searchAfter: FieldValue[] | undefined;
+    while (true) {
+      const response = await client.search<Record<string, unknown>>({
+        pit: { id: chunksPit.id, keep_alive: keepAlive },
+        sort: ['_shard_doc'],
+        search_after: searchAfter,
+        track_total_hits: false,
+        size,
+      });
+      const hits = response.hits.hits;
+      if (hits.length === 0) {
+        return;
+      }
+
+      const locationsByChunkId = new Map<string, Array<Record<string, unknown>>>();
+      let locationsAfter: FieldValue[] | undefined;
+      while (true) {
+        const locations = await client.search<Record<string, unknown>>({
+          pit: { id: locationsPit.id, keep_alive: keepAlive },
+          query: { terms: { chunk_id: hits.map((hit) => hit._id as string) } },
+          sort: ['_shard_doc'],
+          search_after: locationsAfter,
+          track_total_hits: false,
+          size: EXPORT_LOCATIONS_PAGE_SIZE,
+        });
+        const locationHits = locations.hits.hits;
+        for (const hit of locationHits) {
+          const chunkId = hit._source?.chunk_id;
+          if (typeof chunkId !== 'string') continue;
+          const forChunk = locationsByChunkId.get(chunkId) ?? [];
+          forChunk.push(hit._source ?? {});
+          locationsByChunkId.set(chunkId, forChunk);
+        }
+        locationsAfter = locationHits[locationHits.length - 1]?.sort as FieldValue[] | undefined;
+        if (locationHits.length < EXPORT_LOCATIONS_PAGE_SIZE || !locationsAfter) {
+          break;
+        }
+      }
+
+      yield hits.flatMap((hit) => {
+        const source = hit._source ?? {};
+        const semanticText = source.semantic_text as string | { text?: string } | undefined;
+        const chunk = {
+          type: source.type,
+          language: source.language,
+          ...Object.fromEntries(EXPORTED_CHUNK_FIELDS.filter((f) => source[f] != null).map((f) => [f, source[f]])),
+          chunk_hash: source.chunk_hash,
+          content: source.content,
+          semantic_text: typeof semanticText === 'object' ? (semanticText.text ?? '') : (semanticText ?? ''),
+          created_at: source.created_at,
+          updated_at: source.updated_at,
+        } as CodeChunk;
+        return (locationsByChunkId.get(hit._id as string) ?? [])
+          .sort(
+            (a, b) =>
+              String(a.filePath).localeCompare(String(b.filePath)) || Number(a.startLine) - Number(b.startLine)
+          )
+          .map((location) => ({
+            ...chunk,
+            filePath: location.filePath as string,
+            startLine: location.startLine as number,
+            endLine: location.endLine as number,
+            ...Object.fromEntries(
+              EXPORTED_LOCATION_FIELDS.filter((f) => location[f] != null).map((f) => [f, location[f]])
+            ),
+          }));
+      });
+
+      searchAfter = hits[hits.length - 1].sort as FieldValue[] | undefined;
+      if (!searchAfter) {
+        return;
+      }
+    }
+  } finally {
+    await client.closePointInTime({ id: chunksPit.id });
+    await client.closePointInTime({ id: locationsPit.id });
+  }
+}
+
+/**
+ * Retrieves the content hashes currently recorded for every indexed file on a branch.
+ *
+ * The `git_file_hash` stored on each location doc is the git blob hash of the file bytes at
+ * parse time, so it doubles as the per-file content record used to skip unchanged files.
+ * A file can map to more than one hash if stale locations from an older version survived.
+ *
+ * @param index The base name of the Elasticsearch index.
+ * @param branch The branch whose locations should be inspected.
+ * @param workspace If set, only locations of this workspace are inspected.
+ * @returns A promise that resolves to a map of file path to the set of recorded hashes.
+ */
+export async function getIndexedFileHashes(
+  index: string,
+  branch: string,
+  workspace?: string
+): Promise<Map<string, Set<string>>> {
+  const client = getClient();
+  const locationsIndexName = getLocationsIndexName(index);
+  const result = new Map<string, Set<string>>();
+
+  const exists = await client.indices.exists({ index: locationsIndexName });
+  if (!exists) {
+    return result;
+  }
+
+  let after: Record<string, FieldValue> | undefined;
+  while (true) {
+    const response = await client.search({
+      index: locationsIndexName,
+      size: 0,
+      query:
+        workspace !== undefined
+          ? { bool: { filter: [{ term: { git_branch: branch } }, toWorkspaceQuery(workspace)] } }
+          : { term: { git_branch: branch } },
+      aggs: {
+        files: {
+          composite: {
+            size: 1000,
+            sources: [{ filePath: { terms: { field: 'filePath' } } }, { hash: { terms: { field: 'git_file_hash' } } }],
+            ...(after ? { after } : {}),
+          },
+        },
+      },
+    });
+
+    const files = (
+      response.aggregations as unknown as {
+        files?: { after_key?: Record<string, FieldValue>; buckets?: Array<{ key?: Record<string, unknown> }> };
+      }
+    )?.files;
+    const buckets = files?.buckets ?? [];
+    for (const bucket of buckets) {
+      const filePath = bucket.key?.filePath;
+      const hash = bucket.key?.hash;
+      if (typeof filePath !== 'string' || typeof hash !== 'string') continue;
+      const hashes = result.get(filePath) ?? new Set<string>();
+      hashes.add(hash);
+      result.set(filePath, hashes);
+    }
+
+    if (buckets.length === 0 || !files?.after_key) {
+      break;
+    }
+    after = files.after_key;
+  }
+
+  return result;
+}
+
 /**
  * Aggregates symbols by file path.
  *
@@ -1108,14 +2090,15 @@ function chunkArray<T>(items: T[], chunkSize: number): T[][] {
 async function deleteLocationsByFilePathsAndCollectChunkIds(
   filePaths: string[],
   indexName: string,
-  deletePageSizeOverride?: number
-): Promise<Set<string>> {
+  deletePageSizeOverride?: number,
+  workspace?: string
+): Promise<{ chunkIds: Set<string>; deletedDocs: number }> {
   const client = getClient();
   const locationsIndexName = getLocationsIndexName(indexName);
 
   const exists = await client.indices.exists({ index: locationsIndexName });
   if (!exists) {
-    return new Set();
+    return { chunkIds: new Set(), deletedDocs: 0 };
   }
 
   const deletePageSize = Math.max(1, Math.min(5000, Math.floor(deletePageSizeOverride ?? 500)));
@@ -1158,6 +2141,7 @@ async function deleteLocationsByFilePathsAndCollectChunkIds(
           bool: {
             should,
             minimum_should_match: 1,
+            ...(workspace !== undefined ? { filter: [toWorkspaceQuery(workspace)] } : {}),
           },
         },
         sort: ['_shard_doc'],
@@ -1245,16 +2229,22 @@ async function deleteLocationsByFilePathsAndCollectChunkIds(
     durationMs: Date.now() - startedAt,
   });
 
-  return chunkIds;
+  return { chunkIds, deletedDocs };
 }
 
-async function deleteOrphanChunkDocuments(chunkIds: string[], indexName: string): Promise<void> {
+/**
+ * Deletes the chunk documents among `chunkIds` that have no location left.
+ *
+ * @returns The number of chunk documents deleted.
+ */
+async function deleteOrphanChunkDocuments(chunkIds: string[], indexName: string): Promise<number> {
   if (chunkIds.length === 0) {
-    return;
+    return 0;
   }
 
   const client = getClient();
   const locationsIndexName = getLocationsIndexName(indexName);
+  let deleted = 0;
 
   for (const chunk of chunkArray(chunkIds, ES_TERMS_QUERY_BATCH_SIZE)) {
     const response = await client.search({
@@ -1299,7 +2289,10 @@ async function deleteOrphanChunkDocuments(chunkIds: string[], indexName: string)
         errors: JSON.stringify(bulkResponse.items.slice(0, 50), null, 2),
       });
     }
+    deleted += bulkResponse.items.filter((item) => !item.delete?.error).length;
   }
+
+  return deleted;
 }
 
 /**
@@ -1307,14 +2300,15 @@ async function deleteOrphanChunkDocuments(chunkIds: string[], indexName: string)
  *
  * @param filePaths An array of file paths to delete documents for.
  * @param index The base name of the Elasticsearch index.
- * @param options Optional settings for deletion, such as pagination size.
- * @returns A promise that resolves when the documents are deleted.
+ * @param options Optional settings for deletion, such as pagination size, the workspace whose
+ *   files are deleted (default: the files of every workspace), and chunk ids kept even without a location.
+ * @returns A promise that resolves to the number of locations and chunk documents deleted.
  */
 export async function deleteDocumentsByFilePaths(
   filePaths: string[],
   index: string,
-  options?: { deleteDocumentsPageSize?: number }
-): Promise<void> {
+  options?: { deleteDocumentsPageSize?: number; workspace?: string; keepChunkIds?: Set<string> }
+): Promise<DeleteDocumentsResult> {
   const indexName = index;
   // Locations are authoritative in `<index>_locations`. The primary chunk documents do not store
   // per-file locations; we delete orphan chunk docs when their last location is removed.
@@ -1323,14 +2317,17 @@ export async function deleteDocumentsByFilePaths(
     (p): p is string => typeof p === 'string' && p.length > 0
   );
   if (uniqueFilePaths.length === 0) {
-    return;
+    return { locations: 0, chunks: 0 };
   }
-  const affectedChunkIds = await deleteLocationsByFilePathsAndCollectChunkIds(
+  const { chunkIds, deletedDocs } = await deleteLocationsByFilePathsAndCollectChunkIds(
     uniqueFilePaths,
     indexName,
-    options?.deleteDocumentsPageSize
+    options?.deleteDocumentsPageSize,
+    options?.workspace
   );
-  await deleteOrphanChunkDocuments(Array.from(affectedChunkIds), indexName);
+  const orphanCandidates = Array.from(chunkIds).filter((id) => !options?.keepChunkIds?.has(id));
+  const deletedChunks = await deleteOrphanChunkDocuments(orphanCandidates, indexName);
+  return { locations: deletedDocs, chunks: deletedChunks };
 }
 
 /**
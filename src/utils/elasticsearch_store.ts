@@ -0,0 +1,185 @@
+import {
+  BulkIndexResult,
+  ChunkLocationSummary,
+  CodeChunk,
+  DeleteDocumentsResult,
+  ELASTICSEARCH_SIMILARITIES,
+  EmbeddingModel,
+  SearchResult,
+  StoreStats,
+  createIndex,
+  createLocationsIndex,
+  createSettingsIndex,
+  deleteDocumentsByFilePaths,
+  deleteIndex,
+  deleteLocationsIndex,
+  exportCodeChunks,
+  getChunkVectors,
+  getEmbeddingModel,
+  getIndexStats,
+  getIndexedFileHashes,
+  getIndexedFilePaths,
+  getIndexWorkspaces,
+  getLocationsForChunkIds,
+  getLastIndexedCommit,
+  getSymbolNames,
+  getVectorDimensions,
+  getVectorSimilarity,
+  indexCodeChunks,
+  searchByKeyword,
+  searchBySymbolName,
+  searchByVector,
+  updateEmbeddingModel,
+  updateLastIndexedCommit,
+} from './elasticsearch';
+import { ChunkStore } from './chunk_store';
+import { PostFilterOptions, SearchFilters } from './search_filters';
+import { SymbolName } from './symbol_search';
+import { WorkspaceStats } from './workspace';
+import { DEFAULT_VECTOR_METRIC, VectorMetric, prepareChunkVectors, prepareVector } from './vector_metric';
+
+/**
+ * Converts an Elasticsearch kNN `_score` back into the score documented on `VECTOR_METRICS`:
+ * `cosine` scores `(1 + cos) / 2`, `max_inner_product` scores `dot + 1` (or `1 / (1 - dot)` below
+ * zero), and `l2_norm` already scores `1 / (1 + d²)`.
+ */
+function fromKnnScore(score: number, metric: VectorMetric): number {
+  switch (metric) {
+    case 'cosine':
+      return 2 * score - 1;
+    case 'dot_product':
+      return score >= 1 ? score - 1 : 1 - 1 / score;
+    case 'euclidean':
+      return score;
+  }
+}
+
+/**
+ * The default chunk store: `<index>`, `<index>_locations`, and `<index>_settings` in Elasticsearch.
+ */
+export class ElasticsearchStore implements ChunkStore {
+  readonly backend = 'elasticsearch';
+  private readonly index: string;
+  private readonly metric: VectorMetric;
+
+  /**
+   * @param options.metric How `code_vector` is compared (default: `cosine`); an existing index must use
+   *   the matching similarity.
+   */
+  constructor(index: string, options: { metric?: VectorMetric } = {}) {
+    this.index = index;
+    this.metric = options.metric ?? DEFAULT_VECTOR_METRIC;
+  }
+
+  async setup(): Promise<void> {
+    await createIndex(this.index, { metric: this.metric });
+    await createSettingsIndex(this.index);
+    await createLocationsIndex(this.index);
+    const similarity = await getVectorSimilarity(this.index);
+    const expected = ELASTICSEARCH_SIMILARITIES[this.metric];
+    if (similarity !== null && similarity !== expected) {
+      throw new Error(
+        `Elasticsearch index "${this.index}" compares code_vector by ${similarity}, but the ${this.metric} metric ` +
+          `(SCS_IDXR_VECTOR_METRIC) requires ${expected}. Recreate the index with --clean to change it.`
+      );
+    }
+  }
+
+  async clean(): Promise<void> {
+    await deleteIndex(this.index);
+    await deleteLocationsIndex(this.index);
+    await updateEmbeddingModel(null, this.index);
+  }
+
+  getVectorDimensions(): Promise<number | null> {
+    return getVectorDimensions(this.index);
+  }
+
+  getEmbeddingModel(): Promise<EmbeddingModel | null> {
+    return getEmbeddingModel(this.index);
+  }
+
+  setEmbeddingModel(model: EmbeddingModel): Promise<void> {
+    return updateEmbeddingModel(model, this.index);
+  }
+
+  indexChunks(chunks: CodeChunk[]): Promise<BulkIndexResult> {
+    return indexCodeChunks(prepareChunkVectors(chunks, this.metric), this.index);
+  }
+
+  deleteDocumentsByFilePaths(
+    filePaths: string[],
+    options?: { deleteDocumentsPageSize?: number; workspace?: string; keepChunkIds?: Set<string> }
+  ): Promise<DeleteDocumentsResult> {
+    return deleteDocumentsByFilePaths(filePaths, this.index, options);
+  }
+
+  getChunkVectors(chunkIds: string[]): Promise<Map<string, number[]>> {
+    return getChunkVectors(chunkIds, this.index);
+  }
+
+  getIndexedFileHashes(branch: string, workspace?: string): Promise<Map<string, Set<string>>> {
+    return getIndexedFileHashes(this.index, branch, workspace);
+  }
+
+  getIndexedFilePaths(workspace?: string): Promise<string[]> {
+    return getIndexedFilePaths(this.index, workspace);
+  }
+
+  /** Scores as documented on `VECTOR_METRICS`, converted from the kNN `_score`. */
+  async search(
+    queryVector: number[],
+    k: number,
+    filters?: SearchFilters,
+    options?: PostFilterOptions
+  ): Promise<SearchResult[]> {
+    const results = await searchByVector(prepareVector(queryVector, this.metric), this.index, k, filters, options);
+    return results.map((result) => ({ ...result, score: fromKnnScore(result.score, this.metric) }));
+  }
+
+  keywordSearch(
+    query: string,
+    k: number,
+    filters?: SearchFilters,
+    options?: PostFilterOptions
+  ): Promise<SearchResult[]> {
+    return searchByKeyword(query, this.index, k, filters, options);
+  }
+
+  getSymbolNames(): Promise<SymbolName[]> {
+    return getSymbolNames(this.index);
+  }
+
+  findChunksBySymbol(name: string, k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    return searchBySymbolName(name, this.index, k, filters);
+  }
+
+  getChunkLocations(chunkIds: string[], perChunkLimit: number): Promise<Record<string, ChunkLocationSummary[]>> {
+    return getLocationsForChunkIds(chunkIds, { index: this.index, perChunkLimit });
+  }
+
+  getStats(): Promise<StoreStats> {
+    return getIndexStats(this.index);
+  }
+
+  getWorkspaces(): Promise<WorkspaceStats[]> {
+    return getIndexWorkspaces(this.index);
+  }
+
+  exportChunks(pageSize?: number): AsyncIterable<CodeChunk[]> {
+    return exportCodeChunks(this.index, pageSize);
+  }
+
+  getLastIndexedCommit(branch: string): Promise<string | null> {
+    return getLastIndexedCommit(branch, this.index);
+  }
+
+  async updateLastIndexedCommit(branch: string, commitHash: string): Promise<void> {
+    await createSettingsIndex(this.index);
+    await updateLastIndexedCommit(branch, commitHash, this.index);
+  }
+
+  async close(): Promise<void> {
+    // The Elasticsearch client is shared across the process.
+  }
+}
@@ -0,0 +1,64 @@
+import { CodeChunk } from './elasticsearch';
+
+/**
+ * The fields an embed template can reference as `{name}`, and how each is read from a chunk.
+ * Fields a chunk does not have render as empty strings.
+ *
+ * Every field is derived from the chunk's content: a chunk that occurs in several files is stored and
+ * embedded once under its content-derived id, so a per-file field such as the path would embed
+ * whichever file came first.
+ */
+const EMBED_TEMPLATE_FIELDS: Record<string, (chunk: CodeChunk) => string> = {
+  /** Language name, e.g. `go`. */
+  lang: (chunk) => chunk.language,
+  /** Tree-sitter node type of the chunk, e.g. `function_declaration`. */
+  kind: (chunk) => chunk.kind ?? '',
+  /** Name of the symbol the chunk defines, the same as `SearchHit.symbol`. */
+  symbol: (chunk) => chunk.parentSymbol ?? chunk.symbols?.[0]?.name ?? '',
+  /** Enclosing classes, modules, or headings, e.g. `com.acme.InvoiceService`. */
+  container: (chunk) => chunk.containerPath ?? '',
+  /** Source text of the chunk. */
+  body: (chunk) => chunk.content,
+  /** The chunk's `semantic_text`: a language, kind, and container header above the body. */
+  text: (chunk) => chunk.semantic_text,
+};
+
+export const EMBED_TEMPLATE_FIELD_NAMES = Object.keys(EMBED_TEMPLATE_FIELDS);
+
+/** Embeds `semantic_text`, the same text Elasticsearch `semantic_text` inference embeds. */
+export const DEFAULT_EMBED_TEMPLATE = '{text}';
+
+/** Renders the text the client-side embedder embeds for a chunk. */
+export type EmbedTemplate = (chunk: CodeChunk) => string;
+
+const FIELD_PATTERN = /\{([^{}]*)\}/g;
+
+/**
+ * Compiles an embed template such as `"{lang} {kind} {container}.{symbol}\n{body}"`, selected via
+ * `SCS_IDXR_EMBED_TEMPLATE`. Text outside braces is kept as is.
+ *
+ * @throws If the template references no field, or one that is not in `EMBED_TEMPLATE_FIELD_NAMES`.
+ */
+export function parseEmbedTemplate(template: string): EmbedTemplate {
+  const parts: EmbedTemplate[] = [];
+  let last = 0;
+  for (const match of template.matchAll(FIELD_PATTERN)) {
+    const name = match[1].trim();
+    if (!EMBED_TEMPLATE_FIELD_NAMES.includes(name)) {
+      throw new Error(
+        `Unknown field "{${match[1]}}" in embed template "${template}". ` +
+          `Supported fields: ${EMBED_TEMPLATE_FIELD_NAMES.map((name) => `{${name}}`).join(', ')}.`
+      );
+    }
+    const literal = template.slice(last, match.index);
+    parts.push(() => literal, EMBED_TEMPLATE_FIELDS[name]);
+    last = match.index + match[0].length;
+  }
+  if (parts.length === 0) {
+    throw new Error(`Embed template "${template}" references no field, so every chunk would embed the same text.`);
+  }
+  const rest = template.slice(last);
+  parts.push(() => rest);
+
+  return (chunk) => parts.map((part) => part(chunk)).join('');
+}
@@ -0,0 +1,605 @@
+import { createHash } from 'crypto';
+import PQueue from 'p-queue';
+import { embeddingConfig } from '../config';
+import { logger } from './logger';
+import { TokenCounter, estimateTokens, truncateToTokens } from './token_counter';
+
+/**
+ * Produces dense vectors for chunk text on the client side.
+ *
+ * Implementations fill `code_vector` before chunks are sent to the store, which lets the
+ * embedding model be swapped (e.g. a local ONNX model) without changing the indexer.
+ */
+export interface Embedder {
+  /** Registry name of this embedder (also recorded as the model identifier). */
+  readonly name: string;
+  /** Number of dimensions of every vector returned by `embed`. */
+  dimensions(): number;
+  /**
+   * Embeds a list of texts, returning one vector per input in the same order.
+   *
+   * @param texts The texts to embed.
+   * @param signal Optional signal used to abort in-flight work.
+   */
+  embed(texts: string[], signal?: AbortSignal): Promise<number[][]>;
+}
+
+export type EmbedderFactory = () => Embedder;
+
+const registry = new Map<string, EmbedderFactory>();
+
+/**
+ * Registers an embedder factory under a name so it can be selected via `SCS_IDXR_EMBEDDER`.
+ *
+ * Registering an existing name replaces the previous factory.
+ */
+export function registerEmbedder(name: string, factory: EmbedderFactory): void {
+  const key = name.trim().toLowerCase();
+  if (key.length === 0) {
+    throw new Error('Embedder name must be a non-empty string.');
+  }
+  registry.set(key, factory);
+}
+
+/**
+ * Returns the names of all registered embedders, sorted alphabetically.
+ */
+export function listEmbedders(): string[] {
+  return Array.from(registry.keys()).sort();
+}
+
+/**
+ * Creates an embedder instance by registry name.
+ *
+ * @throws If no embedder is registered under the given name.
+ */
+export function getEmbedder(name: string): Embedder {
+  const key = name.trim().toLowerCase();
+  const factory = registry.get(key);
+  if (!factory) {
+    throw new Error(`Unknown embedder "${name}". Registered embedders: ${listEmbedders().join(', ') || '(none)'}.`);
+  }
+  return factory();
+}
+
+/**
+ * Creates the embedder selected via `SCS_IDXR_EMBEDDER`, or `undefined` when none is configured.
+ *
+ * Without a client-side embedder, vectors are left to Elasticsearch (`semantic_text` inference
+ * and the optional dense vector ingest pipeline).
+ */
+export function getConfiguredEmbedder(): Embedder | undefined {
+  const name = embeddingConfig.embedder;
+  return name ? getEmbedder(name) : undefined;
+}
+
+/**
+ * Checks that an embedder produces vectors matching the dimensions stored in the vector index.
+ *
+ * @param embedder The configured embedder.
+ * @param indexDimensions The `dims` of the index vector field, or `null` if the index has none.
+ * @param index The index name, used in the error message.
+ * @throws If the dimensions differ.
+ */
+export function validateEmbedderDimensions(embedder: Embedder, indexDimensions: number | null, index: string): void {
+  if (indexDimensions === null) {
+    return;
+  }
+  const dims = embedder.dimensions();
+  if (dims !== indexDimensions) {
+    throw new Error(
+      `Embedder "${embedder.name}" produces ${dims}-dimensional vectors, but index "${index}" stores ` +
+        `${indexDimensions}-dimensional code_vector fields. Use an embedder with matching dimensions or ` +
+        'recreate the index with --clean.'
+    );
+  }
+}
+
+/**
+ * A failed call to a remote embedding API, thrown once the embedder's retry policy is spent.
+ *
+ * `embedInBatches` reports it without retrying again, so an embedder that retries on its own is
+ * not retried twice over.
+ */
+export class EmbedderError extends Error {
+  /** HTTP status of the failed response, if the API answered. */
+  readonly status?: number;
+  /** Whether the request may succeed if sent again later (429, 5xx, timeouts) rather than being rejected. */
+  readonly retriable: boolean;
+  /** Delay the API asked for via `Retry-After`, in milliseconds. */
+  readonly retryAfterMs?: number;
+
+  constructor(message: string, options: { status?: number; retriable: boolean; retryAfterMs?: number }) {
+    super(message);
+    this.name = 'EmbedderError';
+    this.status = options.status;
+    this.retriable = options.retriable;
+    this.retryAfterMs = options.retryAfterMs;
+  }
+}
+
+export interface EmbedBatchOptions {
+  /** Number of texts sent per `embed` call (default: `SCS_IDXR_EMBEDDING_BATCH_SIZE`). */
+  batchSize?: number;
+  /** Number of `embed` calls allowed in flight at once (default: `SCS_IDXR_EMBEDDING_CONCURRENCY`). */
+  concurrency?: number;
+  /** Retries per batch after the first attempt (default: `SCS_IDXR_EMBEDDING_MAX_RETRIES`). */
+  maxRetries?: number;
+  /** Delay before the first retry; doubled on every subsequent retry (default: 500ms). */
+  retryBaseDelayMs?: number;
+  signal?: AbortSignal;
+}
+
+export interface EmbedBatchResult {
+  /** Vectors by input index; inputs whose batch failed are absent. */
+  vectors: Map<number, number[]>;
+  /** Inputs whose batch still failed after all retries. */
+  failed: Array<{ inputIndex: number; error: string }>;
+}
+
+function sleep(ms: number, signal?: AbortSignal): Promise<void> {
+  return new Promise((resolve, reject) => {
+    const timer = setTimeout(() => {
+      signal?.removeEventListener('abort', onAbort);
+      resolve();
+    }, ms);
+    const onAbort = () => {
+      clearTimeout(timer);
+      reject(signal?.reason);
+    };
+    signal?.addEventListener('abort', onAbort, { once: true });
+  });
+}
+
+/**
+ * Embeds texts in fixed-size batches using a bounded pool of concurrent `embed` calls.
+ *
+ * A failing batch is retried with exponential backoff, unless the embedder threw an `EmbedderError`
+ * after its own retries. Once it runs out of retries its inputs are reported in `failed` and the
+ * remaining batches carry on, so one bad batch never aborts the run.
+ */
+export async function embedInBatches(
+  embedder: Embedder,
+  texts: string[],
+  options: EmbedBatchOptions = {}
+): Promise<EmbedBatchResult> {
+  const batchSize = Math.max(1, Math.floor(options.batchSize ?? embeddingConfig.batchSize));
+  const concurrency = Math.max(1, Math.floor(options.concurrency ?? embeddingConfig.concurrency));
+  const maxRetries = Math.max(0, Math.floor(options.maxRetries ?? embeddingConfig.maxRetries));
+  const retryBaseDelayMs = Math.max(0, options.retryBaseDelayMs ?? 500);
+  const dims = embedder.dimensions();
+
+  const vectors = new Map<number, number[]>();
+  const failed: EmbedBatchResult['failed'] = [];
+  const pool = new PQueue({ concurrency });
+
+  for (let start = 0; start < texts.length; start += batchSize) {
+    const batch = texts.slice(start, start + batchSize);
+    pool.add(async () => {
+      if (options.signal?.aborted) {
+        batch.forEach((_, i) => failed.push({ inputIndex: start + i, error: 'aborted' }));
+        return;
+      }
+      for (let attempt = 0; ; attempt++) {
+        try {
+          const batchVectors = await embedder.embed(batch, options.signal);
+          if (batchVectors.length !== batch.length) {
+            throw new Error(`returned ${batchVectors.length} vectors for ${batch.length} texts`);
+          }
+          const wrongSize = batchVectors.find((vector) => vector.length !== dims);
+          if (wrongSize) {
+            throw new Error(`returned a ${wrongSize.length}-dimensional vector, expected ${dims}`);
+          }
+          batchVectors.forEach((vector, i) => vectors.set(start + i, vector));
+          return;
+        } catch (error) {
+          const message = error instanceof Error ? error.message : String(error);
+          if (options.signal?.aborted || attempt >= maxRetries || error instanceof EmbedderError) {
+            logger.error(`Embedder "${embedder.name}" failed for a batch of ${batch.length} texts`, {
+              attempts: attempt + 1,
+              error: message,
+            });
+            batch.forEach((_, i) => failed.push({ inputIndex: start + i, error: message }));
+            return;
+          }
+          const delayMs = retryBaseDelayMs * 2 ** attempt;
+          logger.warn(`Embedder "${embedder.name}" batch failed, retrying in ${delayMs}ms`, {
+            attempt: attempt + 1,
+            maxRetries,
+            error: message,
+          });
+          try {
+            await sleep(delayMs, options.signal);
+          } catch {
+            batch.forEach((_, i) => failed.push({ inputIndex: start + i, error: message }));
+            return;
+          }
+        }
+      }
+    });
+  }
+
+  await pool.onIdle();
+  failed.sort((a, b) => a.inputIndex - b.inputIndex);
+  return { vectors, failed };
+}
+
+/**
+ * Embeds texts with `embedInBatches`, except those with a vector in `known` of the embedder's dimensions,
+ * whose vector is returned as it is. Used to keep the stored vectors of chunks that did not change.
+ *
+ * @returns The vectors and failures by index in `texts`, and how many vectors were taken from `known`.
+ */
+export async function embedMissing(
+  embedder: Embedder,
+  texts: string[],
+  known: Map<number, number[]>,
+  options: EmbedBatchOptions = {}
+): Promise<EmbedBatchResult & { reused: number }> {
+  const dims = embedder.dimensions();
+  const vectors = new Map<number, number[]>();
+  const pending: number[] = [];
+  texts.forEach((_, i) => {
+    const vector = known.get(i);
+    if (vector?.length === dims) {
+      vectors.set(i, vector);
+    } else {
+      pending.push(i);
+    }
+  });
+  const reused = vectors.size;
+  if (pending.length === 0) {
+    return { vectors, failed: [], reused };
+  }
+
+  const result = await embedInBatches(embedder, pending.map((i) => texts[i]), options);
+  result.vectors.forEach((vector, j) => vectors.set(pending[j], vector));
+  return { vectors, failed: result.failed.map((f) => ({ ...f, inputIndex: pending[f.inputIndex] })), reused };
+}
+
+/**
+ * An embedder that derives deterministic unit vectors from a SHA-256 of the text.
+ *
+ * Intended for tests and local runs without network access. Identical texts always map to
+ * identical vectors; the vectors carry no semantic meaning.
+ */
+export class NoopEmbedder implements Embedder {
+  readonly name = 'noop';
+  private readonly dims: number;
+
+  constructor(dims: number = 768) {
+    if (!Number.isInteger(dims) || dims <= 0) {
+      throw new Error(`NoopEmbedder dimensions must be a positive integer, got ${dims}`);
+    }
+    this.dims = dims;
+  }
+
+  dimensions(): number {
+    return this.dims;
+  }
+
+  async embed(texts: string[], signal?: AbortSignal): Promise<number[][]> {
+    signal?.throwIfAborted();
+    return texts.map((text) => this.vectorFor(text));
+  }
+
+  private vectorFor(text: string): number[] {
+    const vector: number[] = [];
+    let block = 0;
+    while (vector.length < this.dims) {
+      const digest = createHash('sha256').update(`${block}:${text}`).digest();
+      for (let i = 0; i + 1 < digest.length && vector.length < this.dims; i += 2) {
+        // Map each 16-bit word into [-1, 1).
+        vector.push(digest.readUInt16BE(i) / 32768 - 1);
+      }
+      block++;
+    }
+
+    const norm = Math.sqrt(vector.reduce((sum, v) => sum + v * v, 0)) || 1;
+    return vector.map((v) => v / norm);
+  }
+}
+
+/**
+ * A token bucket that spaces out requests to at most `requestsPerMinute`.
+ *
+ * The bucket holds one second's worth of requests, so short bursts go out at once and longer runs
+ * settle at the configured rate. Callers are served in the order they call `take`.
+ */
+export class RateLimiter {
+  private readonly capacity: number;
+  private readonly tokensPerMs: number;
+  private tokens: number;
+  private refilledAt = Date.now();
+  private queue: Promise<void> = Promise.resolve();
+
+  constructor(requestsPerMinute: number) {
+    if (!Number.isFinite(requestsPerMinute) || requestsPerMinute <= 0) {
+      throw new Error(`Rate limit must be a positive number of requests per minute, got ${requestsPerMinute}`);
+    }
+    this.capacity = Math.max(1, Math.ceil(requestsPerMinute / 60));
+    this.tokensPerMs = requestsPerMinute / 60000;
+    this.tokens = this.capacity;
+  }
+
+  /** Waits until a request may be sent and takes its token. */
+  take(signal?: AbortSignal): Promise<void> {
+    const turn = this.queue.then(async () => {
+      signal?.throwIfAborted();
+      this.refill();
+      if (this.tokens < 1) {
+        await sleep(Math.ceil((1 - this.tokens) / this.tokensPerMs), signal);
+        this.refill();
+      }
+      this.tokens -= 1;
+    });
+    this.queue = turn.catch(() => undefined);
+    return turn;
+  }
+
+  private refill(): void {
+    const now = Date.now();
+    this.tokens = Math.min(this.capacity, this.tokens + (now - this.refilledAt) * this.tokensPerMs);
+    this.refilledAt = now;
+  }
+}
+
+/** Retry and rate-limit policy of a remote embedder. */
+export interface EmbedderOptions {
+  /** Retries per request after the first attempt (default: `SCS_IDXR_EMBEDDING_MAX_RETRIES`). */
+  maxRetries?: number;
+  /** Requests per minute; 0 sends requests as fast as they come (default: `SCS_IDXR_EMBEDDER_RATE_LIMIT`). */
+  rateLimit?: number;
+  /** Delay before the first retry, doubled on every subsequent retry and jittered (default: 500ms). */
+  retryBaseDelayMs?: number;
+  /** Time a request may take before it is abandoned and retried (default: `SCS_IDXR_EMBEDDER_TIMEOUT_MS`). */
+  timeoutMs?: number;
+}
+
+export interface HttpEmbedderOptions extends EmbedderOptions {
+  /** Base URL of the API; texts are posted to `<url>/embeddings`. */
+  url: string;
+  /** Dimensions of the vectors the model returns. */
+  dimensions: number;
+  /** Model sent with every request, for APIs that serve several. */
+  model?: string;
+  /** Sent as a bearer token when set. */
+  apiKey?: string;
+  /**
+   * Tokens the model accepts per input (default: `SCS_IDXR_EMBEDDER_MAX_INPUT_TOKENS`); longer inputs
+   * are truncated with a warning instead of failing the request. 0 means no limit.
+   */
+  maxInputTokens?: number;
+  /**
+   * Tokens sent per request (default: `SCS_IDXR_EMBEDDER_MAX_BATCH_TOKENS`); a batch over it is sent as
+   * several requests. 0 means no limit.
+   */
+  maxBatchTokens?: number;
+  /** Counts the tokens of an input, `estimateTokens` by default. */
+  countTokens?: TokenCounter;
+}
+
+/** Statuses worth retrying: the request was fine, but the API could not answer it right now. */
+const RETRIABLE_STATUSES = new Set([408, 429, 500, 502, 503, 504]);
+
+/** Characters of an unparseable response body quoted in the error. */
+const EMBEDDER_BODY_PREFIX_LENGTH = 200;
+
+/**
+ * Parses a `Retry-After` header, given in seconds or as an HTTP date, into milliseconds.
+ */
+export function parseRetryAfterMs(value: string | null, now: number = Date.now()): number | undefined {
+  if (!value?.trim()) {
+    return undefined;
+  }
+  const seconds = Number(value);
+  if (Number.isFinite(seconds)) {
+    return Math.max(0, seconds * 1000);
+  }
+  const date = Date.parse(value);
+  return Number.isNaN(date) ? undefined : Math.max(0, date - now);
+}
+
+/**
+ * An embedder backed by a hosted embeddings API.
+ *
+ * Speaks the OpenAI-compatible `/embeddings` API: the body is `{ model, input }` and the response
+ * lists `{ index, embedding }` per input, in any order. Requests are spaced out by `rateLimit`.
+ * Rate limiting (429), server errors (500, 502, 503, 504), and timeouts are retried with exponential
+ * backoff and jitter, waiting at least as long as `Retry-After` asks; other errors, such as a bad
+ * request (400) or a wrong API key (401), fail at once. Inputs over the model's token limit are
+ * truncated and batches over `maxBatchTokens` are split before anything is sent. Its name includes
+ * the model, so cached vectors and archives of different models never mix.
+ */
+export class HttpEmbedder implements Embedder {
+  readonly name: string;
+  private readonly url: string;
+  private readonly dims: number;
+  private readonly model?: string;
+  private readonly apiKey?: string;
+  private readonly maxRetries: number;
+  private readonly retryBaseDelayMs: number;
+  private readonly timeoutMs: number;
+  private readonly limiter?: RateLimiter;
+  private readonly maxInputTokens: number;
+  private readonly maxBatchTokens: number;
+  private readonly countTokens: TokenCounter;
+
+  constructor(options: HttpEmbedderOptions) {
+    if (!Number.isInteger(options.dimensions) || options.dimensions <= 0) {
+      throw new Error(`HttpEmbedder dimensions must be a positive integer, got ${options.dimensions}`);
+    }
+    this.name = options.model ? `http:${options.model}` : 'http';
+    this.url = options.url.replace(/\/+$/, '');
+    this.dims = options.dimensions;
+    this.model = options.model;
+    this.apiKey = options.apiKey;
+    this.maxRetries = Math.max(0, Math.floor(options.maxRetries ?? embeddingConfig.maxRetries));
+    this.retryBaseDelayMs = Math.max(0, options.retryBaseDelayMs ?? 500);
+    this.timeoutMs = options.timeoutMs ?? embeddingConfig.timeoutMs;
+    const rateLimit = options.rateLimit ?? embeddingConfig.rateLimit;
+    this.limiter = rateLimit > 0 ? new RateLimiter(rateLimit) : undefined;
+    this.maxInputTokens = options.maxInputTokens ?? embeddingConfig.maxInputTokens;
+    this.maxBatchTokens = options.maxBatchTokens ?? embeddingConfig.maxBatchTokens;
+    this.countTokens = options.countTokens ?? estimateTokens;
+  }
+
+  dimensions(): number {
+    return this.dims;
+  }
+
+  async embed(texts: string[], signal?: AbortSignal): Promise<number[][]> {
+    const inputs = texts.map((text, index) => this.fitInput(text, index));
+    const vectors: number[][] = [];
+    for (const batch of this.splitByBatchTokens(inputs)) {
+      vectors.push(...(await this.embedBatch(batch, signal)));
+    }
+    return vectors;
+  }
+
+  /** Truncates an input over `maxInputTokens`, which the API would reject along with its whole batch. */
+  private fitInput(text: string, index: number): string {
+    if (this.maxInputTokens === 0) {
+      return text;
+    }
+    const tokens = this.countTokens(text);
+    if (tokens <= this.maxInputTokens) {
+      return text;
+    }
+    logger.warn(`Embedder "${this.name}" truncated an input longer than its token limit`, {
+      input: index,
+      tokens,
+      maxInputTokens: this.maxInputTokens,
+      start: text.slice(0, 80),
+    });
+    return truncateToTokens(text, this.maxInputTokens, this.countTokens);
+  }
+
+  /** Groups inputs, in order, into requests of at most `maxBatchTokens` tokens each. */
+  private splitByBatchTokens(inputs: string[]): string[][] {
+    if (this.maxBatchTokens === 0) {
+      return inputs.length > 0 ? [inputs] : [];
+    }
+    const batches: string[][] = [];
+    let batch: string[] = [];
+    let tokens = 0;
+    for (const input of inputs) {
+      const inputTokens = this.countTokens(input);
+      if (batch.length > 0 && tokens + inputTokens > this.maxBatchTokens) {
+        batches.push(batch);
+        batch = [];
+        tokens = 0;
+      }
+      batch.push(input);
+      tokens += inputTokens;
+    }
+    if (batch.length > 0) {
+      batches.push(batch);
+    }
+    return batches;
+  }
+
+  private async embedBatch(texts: string[], signal?: AbortSignal): Promise<number[][]> {
+    for (let attempt = 0; ; attempt++) {
+      await this.limiter?.take(signal);
+      let error: EmbedderError;
+      try {
+        return await this.request(texts, signal);
+      } catch (caught) {
+        if (!(caught instanceof EmbedderError) || !caught.retriable) {
+          throw caught;
+        }
+        error = caught;
+      }
+      if (attempt >= this.maxRetries) {
+        throw new EmbedderError(`${error.message} (gave up after ${attempt + 1} attempts)`, error);
+      }
+      const backoffMs = this.retryBaseDelayMs * 2 ** attempt;
+      const delayMs = Math.max(error.retryAfterMs ?? 0, Math.round(backoffMs / 2 + (Math.random() * backoffMs) / 2));
+      logger.warn(`Embedder "${this.name}" request failed, retrying in ${delayMs}ms`, {
+        attempt: attempt + 1,
+        maxRetries: this.maxRetries,
+        error: error.message,
+      });
+      await sleep(delayMs, signal);
+    }
+  }
+
+  private async request(texts: string[], signal?: AbortSignal): Promise<number[][]> {
+    const controller = new AbortController();
+    const onAbort = () => controller.abort(signal?.reason);
+    signal?.addEventListener('abort', onAbort, { once: true });
+    let timedOut = false;
+    const timer = setTimeout(() => {
+      timedOut = true;
+      controller.abort();
+    }, this.timeoutMs);
+
+    let response: Response;
+    let text: string;
+    try {
+      response = await fetch(`${this.url}/embeddings`, {
+        method: 'POST',
+        headers: {
+          'content-type': 'application/json',
+          ...(this.apiKey ? { authorization: `Bearer ${this.apiKey}` } : {}),
+        },
+        body: JSON.stringify({ ...(this.model ? { model: this.model } : {}), input: texts }),
+        signal: controller.signal,
+      });
+      text = await response.text();
+    } catch (error) {
+      signal?.throwIfAborted();
+      if (timedOut) {
+        throw new EmbedderError(`Embedding request timed out after ${this.timeoutMs}ms`, { retriable: true });
+      }
+      const message = error instanceof Error ? error.message : String(error);
+      throw new EmbedderError(
+        `Could not reach the embedder at ${this.url} (${message}). Check SCS_IDXR_EMBEDDER_URL.`,
+        { retriable: true }
+      );
+    } finally {
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', onAbort);
+    }
+
+    if (!response.ok) {
+      throw new EmbedderError(`Embedding request failed (${response.status}): ${text || response.statusText}`, {
+        status: response.status,
+        retriable: RETRIABLE_STATUSES.has(response.status),
+        retryAfterMs: parseRetryAfterMs(response.headers.get('retry-after')),
+      });
+    }
+    let data: Array<{ index: number; embedding: number[] }>;
+    try {
+      ({ data = [] } = JSON.parse(text) as { data?: Array<{ index: number; embedding: number[] }> });
+    } catch {
+      // A proxy or gateway answering with HTML would fail the same way on every retry
+      const body = text.slice(0, EMBEDDER_BODY_PREFIX_LENGTH);
+      throw new EmbedderError(`Embedder returned a response that is not JSON (${response.status}): ${body}`, {
+        status: response.status,
+        retriable: false,
+      });
+    }
+    const vectors = new Array<number[] | undefined>(texts.length).fill(undefined);
+    for (const { index, embedding } of data) {
+      vectors[index] = embedding;
+    }
+    if (vectors.some((vector) => vector === undefined)) {
+      throw new EmbedderError(`Embedder returned ${data.length} embeddings for ${texts.length} texts`, {
+        retriable: false,
+      });
+    }
+    return vectors as number[][];
+  }
+}
+
+registerEmbedder('noop', () => new NoopEmbedder());
+
+registerEmbedder('http', () => {
+  const { url, dimensions } = embeddingConfig;
+  if (!url || dimensions === undefined) {
+    throw new Error('The "http" embedder needs SCS_IDXR_EMBEDDER_URL and SCS_IDXR_EMBEDDER_DIMENSIONS to be set.');
+  }
+  return new HttpEmbedder({ url, dimensions, model: embeddingConfig.model, apiKey: embeddingConfig.apiKey });
+});
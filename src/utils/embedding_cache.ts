@@ -0,0 +1,216 @@
+import path from 'path';
+import fs from 'fs';
+import { createHash } from 'crypto';
+import Database from 'better-sqlite3';
+import { Embedder } from './embedder';
+import { logger } from './logger';
+
+const SCHEMA = `
+  CREATE TABLE IF NOT EXISTS embeddings (
+    key TEXT PRIMARY KEY,
+    vector BLOB NOT NULL,
+    last_used INTEGER NOT NULL
+  );
+  CREATE INDEX IF NOT EXISTS idx_embeddings_last_used ON embeddings (last_used);
+`;
+
+export interface EmbeddingCacheOptions {
+  /** Path of the database file; created (with its directory) on first use. */
+  dbPath: string;
+  /** Entries kept before the least recently used ones are evicted. */
+  maxEntries: number;
+}
+
+/**
+ * Normalizes chunk text before it is hashed, so line-ending and trailing-whitespace differences
+ * between checkouts do not defeat the cache.
+ */
+export function normalizeEmbeddingText(text: string): string {
+  return text
+    .replace(/\r\n?/g, '\n')
+    .split('\n')
+    .map((line) => line.trimEnd())
+    .join('\n')
+    .trim();
+}
+
+/**
+ * Returns the cache key of a text embedded by a model: `sha256(model + normalized text)`.
+ */
+export function getEmbeddingCacheKey(model: string, text: string): string {
+  return createHash('sha256').update(model).update('\0').update(normalizeEmbeddingText(text)).digest('hex');
+}
+
+function toBlob(vector: number[]): Buffer {
+  const floats = Float32Array.from(vector);
+  return Buffer.from(floats.buffer, floats.byteOffset, floats.byteLength);
+}
+
+function fromBlob(blob: Buffer): number[] {
+  // Copy into an aligned buffer; SQLite blobs are not guaranteed to be 4-byte aligned.
+  const copy = new Uint8Array(blob.byteLength);
+  copy.set(blob);
+  return Array.from(new Float32Array(copy.buffer));
+}
+
+/**
+ * An on-disk, size-capped LRU cache of embedding vectors in a SQLite database.
+ *
+ * The cache is shared by all repositories and branches; keys carry the model identifier (see
+ * `getEmbeddingCacheKey`), so one database can hold vectors of several models.
+ */
+export class EmbeddingCache {
+  private readonly dbPath: string;
+  private readonly maxEntries: number;
+  private db?: Database.Database;
+
+  constructor(options: EmbeddingCacheOptions) {
+    if (!Number.isInteger(options.maxEntries) || options.maxEntries <= 0) {
+      throw new Error(`Embedding cache max entries must be a positive integer, got ${options.maxEntries}`);
+    }
+    this.dbPath = options.dbPath;
+    this.maxEntries = options.maxEntries;
+  }
+
+  /**
+   * Returns the cached vectors for the given keys and marks them as recently used.
+   */
+  get(keys: string[]): Map<string, number[]> {
+    const db = this.open();
+    const select = db.prepare('SELECT vector FROM embeddings WHERE key = ?');
+    const touch = db.prepare('UPDATE embeddings SET last_used = ? WHERE key = ?');
+    const now = Date.now();
+
+    const found = new Map<string, number[]>();
+    db.transaction(() => {
+      for (const key of new Set(keys)) {
+        const row = select.get(key) as { vector: Buffer } | undefined;
+        if (row) {
+          found.set(key, fromBlob(row.vector));
+          touch.run(now, key);
+        }
+      }
+    })();
+    return found;
+  }
+
+  /**
+   * Stores vectors by key, then evicts the least recently used entries beyond `maxEntries`.
+   */
+  set(entries: Map<string, number[]>): void {
+    if (entries.size === 0) {
+      return;
+    }
+    const db = this.open();
+    const upsert = db.prepare(
+      'INSERT INTO embeddings (key, vector, last_used) VALUES (?, ?, ?) ' +
+        'ON CONFLICT(key) DO UPDATE SET vector = excluded.vector, last_used = excluded.last_used'
+    );
+    const now = Date.now();
+
+    db.transaction(() => {
+      for (const [key, vector] of entries) {
+        upsert.run(key, toBlob(vector), now);
+      }
+      const { count } = db.prepare('SELECT COUNT(*) AS count FROM embeddings').get() as { count: number };
+      if (count > this.maxEntries) {
+        db.prepare(
+          'DELETE FROM embeddings WHERE key IN (SELECT key FROM embeddings ORDER BY last_used ASC, rowid ASC LIMIT ?)'
+        ).run(count - this.maxEntries);
+      }
+    })();
+  }
+
+  /** Number of cached vectors. */
+  size(): number {
+    const { count } = this.open().prepare('SELECT COUNT(*) AS count FROM embeddings').get() as { count: number };
+    return count;
+  }
+
+  close(): void {
+    this.db?.close();
+    this.db = undefined;
+  }
+
+  private open(): Database.Database {
+    if (this.db) {
+      return this.db;
+    }
+    fs.mkdirSync(path.dirname(this.dbPath), { recursive: true });
+    const db = new Database(this.dbPath);
+    try {
+      db.pragma('journal_mode = WAL');
+      // Several workers may share the cache; wait for a writer instead of failing
+      db.pragma('busy_timeout = 5000');
+      db.exec(SCHEMA);
+    } catch (error) {
+      db.close();
+      throw error;
+    }
+    this.db = db;
+    logger.info(`Opened embedding cache at "${this.dbPath}"`, { maxEntries: this.maxEntries });
+    return db;
+  }
+}
+
+/**
+ * An embedder that consults an `EmbeddingCache` before calling the wrapped embedder.
+ *
+ * Only texts without a cached vector reach the wrapped embedder, and texts repeated within one
+ * call are embedded once. The model identifier in the cache key is the embedder name plus its
+ * dimensions, so switching models never returns stale vectors.
+ */
+export class CachedEmbedder implements Embedder {
+  readonly name: string;
+  private readonly model: string;
+  private stats = { hits: 0, misses: 0 };
+
+  constructor(
+    private readonly embedder: Embedder,
+    private readonly cache: EmbeddingCache
+  ) {
+    this.name = embedder.name;
+    this.model = `${embedder.name}:${embedder.dimensions()}`;
+  }
+
+  dimensions(): number {
+    return this.embedder.dimensions();
+  }
+
+  async embed(texts: string[], signal?: AbortSignal): Promise<number[][]> {
+    const keys = texts.map((text) => getEmbeddingCacheKey(this.model, text));
+    const vectors = this.cache.get(keys);
+
+    const missing = new Map<string, string>();
+    keys.forEach((key, i) => {
+      if (!vectors.has(key)) {
+        missing.set(key, texts[i]);
+      }
+    });
+    this.stats.hits += texts.length - missing.size;
+    this.stats.misses += missing.size;
+
+    if (missing.size > 0) {
+      const embedded = await this.embedder.embed(Array.from(missing.values()), signal);
+      // Never cache vectors that are misaligned with their texts or of the wrong size
+      if (embedded.length !== missing.size) {
+        throw new Error(`returned ${embedded.length} vectors for ${missing.size} texts`);
+      }
+      const wrongSize = embedded.find((vector) => vector.length !== this.dimensions());
+      if (wrongSize) {
+        throw new Error(`returned a ${wrongSize.length}-dimensional vector, expected ${this.dimensions()}`);
+      }
+      const fresh = new Map<string, number[]>();
+      Array.from(missing.keys()).forEach((key, i) => fresh.set(key, embedded[i]));
+      this.cache.set(fresh);
+      fresh.forEach((vector, key) => vectors.set(key, vector));
+    }
+
+    return keys.map((key) => vectors.get(key) as number[]);
+  }
+
+  /** Texts served from the cache and texts sent to the wrapped embedder so far. */
+  getStats(): { hits: number; misses: number } {
+    return { ...this.stats };
+  }
+}
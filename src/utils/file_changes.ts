@@ -0,0 +1,91 @@
+import { ChunkStore } from './chunk_store';
+import { FileHashCache } from './file_hash_cache';
+import { createLogger, logger as defaultLogger } from './logger';
+
+export interface FileChangeOptions {
+  /** Directory the file paths are relative to. */
+  root: string;
+  branch: string;
+  workspace: string;
+  /** Whether an indexed file is one the walk covered, so its absence means it is gone. */
+  isInScope: (file: string) => boolean;
+  hashCache: FileHashCache;
+  /** Parse every file, even the ones whose content is already indexed. */
+  force?: boolean;
+  logger?: ReturnType<typeof createLogger>;
+}
+
+export interface FileChanges {
+  /** The files to parse: new files, files whose content changed, and with `force` every file. */
+  files: string[];
+  /** The files among `files` that have locations to replace once they are parsed, see `deleteChangedFile`. */
+  changedFiles: Set<string>;
+  /** Files skipped because the index holds the same content. */
+  unchangedFiles: number;
+  /** Indexed files in scope that were not found, removed from the index. */
+  deletedFiles: string[];
+}
+
+/**
+ * Compares the files a run found with the ones indexed on its branch and workspace: drops files whose
+ * content hash matches the indexed copy, and purges the indexed files in scope that were not found,
+ * because they were deleted from disk or are now left out by the ignore files or the include and exclude
+ * patterns. Files whose size and mtime did not change since they were last hashed are not hashed again
+ * (see `FileHashCache`).
+ *
+ * Files whose content changed keep their previous locations until they are re-parsed (see
+ * `deleteChangedFile`), so the chunks an edit left alone keep their embeddings. A renamed file with
+ * identical content resolves to the same chunk ids, so the existing chunk documents (and their
+ * embeddings) are reused and only the locations move.
+ *
+ * Used by the `index` command and `Index.addPath`, so both skip and purge the same files.
+ */
+export async function detectFileChanges(
+  store: ChunkStore,
+  files: string[],
+  options: FileChangeOptions
+): Promise<FileChanges> {
+  const { root, branch, workspace, isInScope, hashCache, force = false, logger = defaultLogger } = options;
+
+  const indexedHashes = await store.getIndexedFileHashes(branch, workspace);
+  const changedFiles = new Set<string>();
+  if (indexedHashes.size === 0) {
+    return { files, changedFiles, unchangedFiles: 0, deletedFiles: [] };
+  }
+
+  const currentHashes = force ? new Map<string, string>() : hashCache.hashFiles(root, files);
+  const filesToProcess: string[] = [];
+  for (const file of files) {
+    const indexed = indexedHashes.get(file);
+    const current = currentHashes.get(file);
+    if (indexed && current && indexed.size === 1 && indexed.has(current)) {
+      continue;
+    }
+    if (indexed) {
+      changedFiles.add(file);
+    }
+    filesToProcess.push(file);
+  }
+
+  const found = new Set(files);
+  const deletedFiles = Array.from(indexedHashes.keys()).filter((file) => isInScope(file) && !found.has(file));
+
+  logger.info('Compared files against indexed content hashes', {
+    unchanged: files.length - filesToProcess.length,
+    changed: changedFiles.size,
+    added: filesToProcess.length - changedFiles.size,
+    deleted: deletedFiles.length,
+    force,
+  });
+
+  if (deletedFiles.length > 0) {
+    await store.deleteDocumentsByFilePaths(deletedFiles, { workspace });
+  }
+
+  return {
+    files: filesToProcess,
+    changedFiles,
+    unchangedFiles: files.length - filesToProcess.length,
+    deletedFiles,
+  };
+}
@@ -0,0 +1,119 @@
+import fs from 'fs';
+import path from 'path';
+import { execFileSync } from 'child_process';
+import { logger } from './logger';
+
+interface FileHashEntry {
+  size: number;
+  mtimeMs: number;
+  hash: string;
+}
+
+/**
+ * Computes git blob hashes for files relative to `root`.
+ *
+ * Uses a single `git hash-object --stdin-paths` call so the cost stays flat regardless of
+ * repository size. The hashes match the `git_file_hash` recorded by the parser.
+ */
+function hashFiles(root: string, files: string[]): Map<string, string> {
+  const hashes = new Map<string, string>();
+  if (files.length === 0) {
+    return hashes;
+  }
+
+  const output = execFileSync('git', ['hash-object', '--stdin-paths'], {
+    cwd: root,
+    input: files.join('\n') + '\n',
+    maxBuffer: Math.max(1024 * 1024, files.length * 64),
+  })
+    .toString()
+    .trim()
+    .split('\n');
+
+  files.forEach((file, i) => {
+    const hash = output[i]?.trim();
+    if (hash) {
+      hashes.set(file, hash);
+    }
+  });
+  return hashes;
+}
+
+/**
+ * Remembers the size, modification time, and git blob hash of files, so a file whose size and mtime
+ * are the same as when it was last hashed is not read and hashed again.
+ *
+ * With a `cachePath`, the entries are loaded from that JSON file and `save` writes back the entries of
+ * the files hashed since, so the files that no longer exist drop out. Without one, the entries only last
+ * as long as the cache.
+ */
+export class FileHashCache {
+  private readonly entries = new Map<string, FileHashEntry>();
+  private readonly seen = new Set<string>();
+
+  constructor(private readonly cachePath?: string) {
+    if (cachePath === undefined || !fs.existsSync(cachePath)) {
+      return;
+    }
+    try {
+      const stored = JSON.parse(fs.readFileSync(cachePath, 'utf8')) as Record<string, FileHashEntry>;
+      Object.entries(stored).forEach(([file, entry]) => this.entries.set(file, entry));
+    } catch (error) {
+      // A corrupt cache only costs a rehash of every file
+      logger.warn('Ignoring an unreadable file hash cache', {
+        cachePath,
+        error: error instanceof Error ? error.message : String(error),
+      });
+    }
+  }
+
+  /**
+   * Returns the git blob hash of each file, relative to `root`. Files that cannot be read are missing.
+   */
+  hashFiles(root: string, files: string[]): Map<string, string> {
+    const hashes = new Map<string, string>();
+    const stale: Array<{ file: string; key: string; size: number; mtimeMs: number }> = [];
+    for (const file of files) {
+      const key = path.resolve(root, file);
+      let stat: fs.Stats;
+      try {
+        stat = fs.statSync(key);
+      } catch {
+        continue;
+      }
+      this.seen.add(key);
+      const entry = this.entries.get(key);
+      if (entry && entry.size === stat.size && entry.mtimeMs === stat.mtimeMs) {
+        hashes.set(file, entry.hash);
+      } else {
+        stale.push({ file, key, size: stat.size, mtimeMs: stat.mtimeMs });
+      }
+    }
+
+    const computed = hashFiles(root, stale.map(({ file }) => file));
+    for (const { file, key, size, mtimeMs } of stale) {
+      const hash = computed.get(file);
+      if (hash) {
+        hashes.set(file, hash);
+        this.entries.set(key, { size, mtimeMs, hash });
+      }
+    }
+    return hashes;
+  }
+
+  /** Writes the entries of the files hashed since the cache was loaded to `cachePath`, if set. */
+  save(): void {
+    if (this.cachePath === undefined) {
+      return;
+    }
+    const kept: Record<string, FileHashEntry> = {};
+    for (const key of this.seen) {
+      const entry = this.entries.get(key);
+      if (entry) {
+        kept[key] = entry;
+      }
+    }
+    fs.mkdirSync(path.dirname(this.cachePath), { recursive: true });
+    fs.writeFileSync(this.cachePath, JSON.stringify(kept));
+  }
+}
@@ -0,0 +1,190 @@
+import fs from 'fs';
+import path from 'path';
+import { glob, Path } from 'glob';
+import ignore, { Ignore } from 'ignore';
+import { throwIfCancelled } from './cancellation';
+
+/** Directories that are never indexed, regardless of ignore rules. */
+const ALWAYS_SKIPPED_DIRECTORIES = new Set(['.git']);
+
+export interface FileFilterOptions {
+  /** Honor `.gitignore` files, including nested ones (default: true). */
+  gitignore?: boolean;
+  /** If non-empty, only files matching at least one of these patterns are indexed. */
+  include?: string[];
+  /** Files matching any of these patterns are not indexed, even if `include` matches. */
+  exclude?: string[];
+}
+
+export interface FileFilter {
+  /** Whether a file (POSIX path relative to the git root) should be indexed. */
+  accepts(relativePath: string): boolean;
+  /** Whether nothing below a directory can be indexed, so the walker can skip it entirely. */
+  skipsDirectory(relativePath: string): boolean;
+}
+
+/**
+ * Evaluates every `.gitignore` between the repository root and a path, the way git does.
+ *
+ * Rules in deeper `.gitignore` files take precedence, negations (`!important.log`) re-include
+ * matches of earlier rules, and a file can never be re-included once one of its parent
+ * directories is excluded.
+ */
+class NestedGitignore {
+  private readonly root: string;
+  private readonly rulesByDirectory = new Map<string, Ignore | null>();
+  private readonly ignoredDirectories = new Map<string, boolean>();
+
+  constructor(root: string) {
+    this.root = root;
+  }
+
+  ignores(relativePath: string, isDirectory: boolean): boolean {
+    const parts = relativePath.split('/').filter((part) => part.length > 0);
+    for (let depth = 1; depth < parts.length; depth++) {
+      if (this.directoryIgnored(parts.slice(0, depth))) {
+        return true;
+      }
+    }
+    return isDirectory ? this.directoryIgnored(parts) : this.evaluate(parts, false);
+  }
+
+  private directoryIgnored(parts: string[]): boolean {
+    const key = parts.join('/');
+    let ignored = this.ignoredDirectories.get(key);
+    if (ignored === undefined) {
+      ignored = this.evaluate(parts, true);
+      this.ignoredDirectories.set(key, ignored);
+    }
+    return ignored;
+  }
+
+  private evaluate(parts: string[], isDirectory: boolean): boolean {
+    let ignored = false;
+    for (let level = 0; level < parts.length; level++) {
+      const rules = this.rulesFor(parts.slice(0, level).join('/'));
+      if (!rules) {
+        continue;
+      }
+      const result = rules.test(parts.slice(level).join('/') + (isDirectory ? '/' : ''));
+      if (result.ignored) {
+        ignored = true;
+      } else if (result.unignored) {
+        ignored = false;
+      }
+    }
+    return ignored;
+  }
+
+  private rulesFor(directory: string): Ignore | null {
+    let rules = this.rulesByDirectory.get(directory);
+    if (rules === undefined) {
+      const gitignorePath = path.join(this.root, directory, '.gitignore');
+      rules =
+        fs.existsSync(gitignorePath) && fs.statSync(gitignorePath).isFile()
+          ? ignore().add(fs.readFileSync(gitignorePath, 'utf8'))
+          : null;
+      this.rulesByDirectory.set(directory, rules);
+    }
+    return rules;
+  }
+}
+
+/**
+ * Builds the filter that decides which files of a repository are walked and indexed.
+ *
+ * `include` and `exclude` use `.gitignore` pattern syntax relative to the git root: a pattern
+ * without a slash (`*.test.ts`) matches at any depth, `src/**` is anchored to the root.
+ *
+ * @param gitRoot Absolute path of the repository root.
+ * @param options Ignore and glob settings.
+ */
+export function createFileFilter(gitRoot: string, options: FileFilterOptions = {}): FileFilter {
+  const gitignore = options.gitignore === false ? undefined : new NestedGitignore(gitRoot);
+  const include = options.include && options.include.length > 0 ? ignore().add(options.include) : undefined;
+  const exclude = options.exclude && options.exclude.length > 0 ? ignore().add(options.exclude) : undefined;
+
+  const inSkippedDirectory = (relativePath: string, isDirectory: boolean): boolean => {
+    const parts = relativePath.split('/');
+    const directories = isDirectory ? parts : parts.slice(0, -1);
+    return directories.some((part) => ALWAYS_SKIPPED_DIRECTORIES.has(part));
+  };
+
+  return {
+    accepts(relativePath: string): boolean {
+      if (inSkippedDirectory(relativePath, false)) {
+        return false;
+      }
+      if (gitignore?.ignores(relativePath, false)) {
+        return false;
+      }
+      if (include && !include.ignores(relativePath)) {
+        return false;
+      }
+      return !exclude?.ignores(relativePath);
+    },
+    skipsDirectory(relativePath: string): boolean {
+      if (relativePath === '') {
+        return false;
+      }
+      return (
+        inSkippedDirectory(relativePath, true) ||
+        gitignore?.ignores(relativePath, true) === true ||
+        exclude?.ignores(`${relativePath}/`) === true
+      );
+    },
+  };
+}
+
+/**
+ * Lists the files under `gitRoot` that match `pattern` and pass `filter`.
+ *
+ * Directories rejected by the filter are pruned during the walk, so ignored trees such as
+ * `node_modules` are never read. Symlinked directories are not followed when expanding `**`,
+ * which keeps symlink cycles from looping.
+ *
+ * @param gitRoot Absolute path of the repository root; the pattern and results are relative to it.
+ * @param pattern Glob pattern of candidate files.
+ * @param filter Filter from `createFileFilter`.
+ * @param signal Stops the walk when aborted.
+ * @returns Unique POSIX paths relative to `gitRoot`, sorted.
+ * @throws IndexingCancelledError if `signal` is aborted.
+ */
+export async function walkFiles(
+  gitRoot: string,
+  pattern: string,
+  filter: FileFilter,
+  signal?: AbortSignal
+): Promise<string[]> {
+  throwIfCancelled(signal);
+  let matches: string[];
+  try {
+    matches = await glob(pattern, {
+      cwd: gitRoot,
+      follow: false,
+      nodir: true,
+      signal,
+      ignore: {
+        childrenIgnored: (p: Path) => filter.skipsDirectory(p.relativePosix()),
+      },
+    });
+  } catch (error) {
+    throwIfCancelled(signal);
+    throw error;
+  }
+
+  // Normalize to relative paths - glob may return absolute paths despite cwd
+  // Use fs.realpathSync to resolve symlinks (e.g., /tmp -> /private/tmp on macOS)
+  const realGitRoot = fs.realpathSync(gitRoot);
+  const relativeFiles = matches.map((f) => {
+    if (path.isAbsolute(f)) {
+      const realPath = fs.realpathSync(f);
+      return path.relative(realGitRoot, realPath);
+    }
+    return f;
+  });
+
+  return Array.from(new Set(relativeFiles.map((f) => f.split(path.sep).join('/'))))
+    .filter((f) => filter.accepts(f))
+    .sort();
+}
@@ -0,0 +1,215 @@
+import fs from 'fs';
+import path from 'path';
+import { escape } from 'glob';
+import { FileFilter, walkFiles } from './file_walker';
+import { logger as defaultLogger, createLogger } from './logger';
+
+type Logger = ReturnType<typeof createLogger>;
+
+/** Quiet period after the last file event before a batch of changes is re-indexed. */
+export const DEFAULT_WATCH_DEBOUNCE_MS = 300;
+const DEFAULT_RETRY_DELAY_MS = 1000;
+const MAX_RETRY_DELAY_MS = 30000;
+
+/** The files affected by a burst of file events, relative to the watched root. */
+export interface FileChanges {
+  /** Files that were created or modified and should be (re)indexed. */
+  changed: string[];
+  /** Files that no longer exist and should be removed from the index. */
+  deleted: string[];
+}
+
+/** Starts a recursive watch on `root`, like `fs.watch(root, { recursive: true }, listener)`. */
+export type WatchFunction = (
+  root: string,
+  listener: (eventType: string, filename: string | Buffer | null) => void
+) => fs.FSWatcher;
+
+export interface FileChangeWatcherOptions {
+  /** Absolute path of the repository root. */
+  root: string;
+  /** Decides which files are indexed, see `createFileFilter`. */
+  filter: FileFilter;
+  /** Whether a path belongs to an enabled language, see `createLanguageFileMatcher`. */
+  isLanguageFile: (relativePath: string) => boolean;
+  /** Called once per debounced batch; batches never overlap. */
+  onChanges: (changes: FileChanges) => Promise<void>;
+  /** Files indexed when the watch starts, so deleting a directory can remove the files it contained. */
+  knownFiles?: Iterable<string>;
+  debounceMs?: number;
+  /** Initial delay before re-establishing a failed watch; doubles up to 30s on repeated failures. */
+  retryDelayMs?: number;
+  logger?: Logger;
+  watch?: WatchFunction;
+}
+
+const recursiveWatch: WatchFunction = (root, listener) => fs.watch(root, { recursive: true }, listener);
+
+/**
+ * Watches a repository and reports changed and deleted files in debounced batches.
+ *
+ * Events only mark paths as dirty; what a path means is decided when the batch is flushed, by
+ * looking at the file system. That makes editor atomic saves (write a temp file, rename it over the
+ * original) show up as a single change of the original, and temp files that are gone by then are
+ * ignored. If the watch itself fails it is logged and re-established instead of stopping.
+ */
+export class FileChangeWatcher {
+  private readonly options: FileChangeWatcherOptions;
+  private readonly logger: Logger;
+  private readonly debounceMs: number;
+  private readonly knownFiles: Set<string>;
+  private readonly pending = new Set<string>();
+  private watcher: fs.FSWatcher | undefined;
+  private debounceTimer: NodeJS.Timeout | undefined;
+  private retryTimer: NodeJS.Timeout | undefined;
+  private retryDelayMs: number;
+  private flushing: Promise<void> = Promise.resolve();
+  private closed = false;
+
+  constructor(options: FileChangeWatcherOptions) {
+    this.options = options;
+    this.logger = options.logger ?? defaultLogger;
+    this.debounceMs = options.debounceMs ?? DEFAULT_WATCH_DEBOUNCE_MS;
+    this.retryDelayMs = options.retryDelayMs ?? DEFAULT_RETRY_DELAY_MS;
+    this.knownFiles = new Set(options.knownFiles ?? []);
+  }
+
+  start(): void {
+    this.closed = false;
+    const watch = this.options.watch ?? recursiveWatch;
+    let watcher: fs.FSWatcher;
+    try {
+      watcher = watch(this.options.root, (_eventType, filename) => {
+        if (filename) {
+          this.record(filename.toString());
+        }
+      });
+    } catch (error) {
+      this.handleWatchError(error);
+      return;
+    }
+    watcher.on('error', (error) => this.handleWatchError(error));
+    this.watcher = watcher;
+    this.retryDelayMs = this.options.retryDelayMs ?? DEFAULT_RETRY_DELAY_MS;
+    this.logger.info('Watching for file changes', { root: this.options.root, debounceMs: this.debounceMs });
+  }
+
+  /** Stops watching and waits for the batch in progress, if any. Pending events are dropped. */
+  async close(): Promise<void> {
+    this.closed = true;
+    clearTimeout(this.debounceTimer);
+    clearTimeout(this.retryTimer);
+    this.watcher?.close();
+    this.watcher = undefined;
+    this.pending.clear();
+    await this.flushing;
+  }
+
+  /** Processes pending events now instead of waiting for the debounce to expire. */
+  flush(): Promise<void> {
+    clearTimeout(this.debounceTimer);
+    this.debounceTimer = undefined;
+    const paths = Array.from(this.pending);
+    this.pending.clear();
+    if (paths.length > 0) {
+      this.flushing = this.flushing
+        .then(() => this.processBatch(paths))
+        .catch((error) => {
+          this.logger.error('Failed to re-index changed files', {
+            paths: paths.length,
+            error: error instanceof Error ? error.message : String(error),
+          });
+        });
+    }
+    return this.flushing;
+  }
+
+  private record(filename: string): void {
+    const relativePath = filename.split(path.sep).join('/');
+    if (this.inSkippedDirectory(relativePath)) {
+      return;
+    }
+    this.pending.add(relativePath);
+    clearTimeout(this.debounceTimer);
+    this.debounceTimer = setTimeout(() => void this.flush(), this.debounceMs);
+  }
+
+  private inSkippedDirectory(relativePath: string): boolean {
+    const parts = relativePath.split('/');
+    for (let depth = 1; depth < parts.length; depth++) {
+      if (this.options.filter.skipsDirectory(parts.slice(0, depth).join('/'))) {
+        return true;
+      }
+    }
+    return false;
+  }
+
+  private handleWatchError(error: unknown): void {
+    this.watcher?.close();
+    this.watcher = undefined;
+    if (this.closed) {
+      return;
+    }
+    const delay = this.retryDelayMs;
+    this.retryDelayMs = Math.min(delay * 2, MAX_RETRY_DELAY_MS);
+    this.logger.error(`File watcher failed; re-establishing the watch in ${delay}ms`, {
+      root: this.options.root,
+      error: error instanceof Error ? error.message : String(error),
+    });
+    this.retryTimer = setTimeout(() => this.start(), delay);
+  }
+
+  private isIndexable(relativePath: string): boolean {
+    return this.options.isLanguageFile(relativePath) && this.options.filter.accepts(relativePath);
+  }
+
+  private async processBatch(paths: string[]): Promise<void> {
+    const changed = new Set<string>();
+    const deleted = new Set<string>();
+
+    const markDeleted = (relativePath: string) => {
+      if (this.knownFiles.delete(relativePath) || this.options.isLanguageFile(relativePath)) {
+        deleted.add(relativePath);
+      }
+    };
+
+    for (const relativePath of paths) {
+      const stats = fs.statSync(path.join(this.options.root, relativePath), { throwIfNoEntry: false });
+      if (stats?.isFile()) {
+        if (this.isIndexable(relativePath)) {
+          changed.add(relativePath);
+          this.knownFiles.add(relativePath);
+        } else if (this.knownFiles.has(relativePath)) {
+          // e.g. a newly added ignore rule now matches it
+          markDeleted(relativePath);
+        }
+      } else if (stats?.isDirectory()) {
+        // A directory created or moved into place may only produce an event for itself
+        if (!this.options.filter.skipsDirectory(relativePath)) {
+          const files = await walkFiles(this.options.root, `${escape(relativePath)}/**/*`, this.options.filter);
+          for (const file of files.filter(this.options.isLanguageFile)) {
+            changed.add(file);
+            this.knownFiles.add(file);
+          }
+        }
+      } else {
+        markDeleted(relativePath);
+        // A removed directory takes every indexed file below it along
+        for (const known of Array.from(this.knownFiles)) {
+          if (known.startsWith(`${relativePath}/`)) {
+            markDeleted(known);
+          }
+        }
+      }
+    }
+
+    for (const file of changed) {
+      deleted.delete(file);
+    }
+    if (changed.size === 0 && deleted.size === 0) {
+      return;
+    }
+
+    await this.options.onChanges({ changed: Array.from(changed).sort(), deleted: Array.from(deleted).sort() });
+  }
+}
@@ -0,0 +1,136 @@
+import { execFileSync } from 'child_process';
+import path from 'path';
+import { ChunkBlame, CodeChunk } from './elasticsearch';
+import { logger } from './logger';
+
+/** Largest `git blame` output read for one file. */
+const MAX_BLAME_OUTPUT_BYTES = 256 * 1024 * 1024;
+
+/** Header of a line in `git blame --porcelain` output: `<sha> <original line> <final line> [<lines in group>]`. */
+const PORCELAIN_HEADER = /^([0-9a-f]{40}) \d+ (\d+)(?: \d+)?$/;
+/** Lines changed in the working tree are attributed to this commit. */
+const UNCOMMITTED = /^0+$/;
+
+interface BlameCommit {
+  author: string;
+  /** Author time in seconds since the epoch. */
+  time: number;
+}
+
+/**
+ * The commit of every line of one file, from `git blame --porcelain`.
+ */
+export class FileBlame {
+  /**
+   * @param lineCommits Commit SHA of each line, by 1-based line number minus one; undefined for lines
+   *   not committed yet.
+   */
+  constructor(
+    private readonly lineCommits: Array<string | undefined>,
+    private readonly commits: Map<string, BlameCommit>
+  ) {}
+
+  /**
+   * Parses `git blame --porcelain` output. Commit details are only printed for the first line of each
+   * commit, so they are kept by SHA.
+   */
+  static parse(output: string): FileBlame {
+    const lineCommits: Array<string | undefined> = [];
+    const commits = new Map<string, BlameCommit>();
+    let sha: string | undefined;
+    let line = 0;
+    for (const text of output.split('\n')) {
+      if (text.startsWith('\t')) {
+        if (sha !== undefined && !UNCOMMITTED.test(sha)) {
+          lineCommits[line - 1] = sha;
+        }
+        continue;
+      }
+      const header = PORCELAIN_HEADER.exec(text);
+      if (header) {
+        sha = header[1];
+        line = Number(header[2]);
+        if (!commits.has(sha)) {
+          commits.set(sha, { author: '', time: 0 });
+        }
+        continue;
+      }
+      const commit = sha !== undefined ? commits.get(sha) : undefined;
+      if (commit && text.startsWith('author ')) {
+        commit.author = text.slice('author '.length);
+      } else if (commit && text.startsWith('author-time ')) {
+        commit.time = Number(text.slice('author-time '.length));
+      }
+    }
+    return new FileBlame(lineCommits, commits);
+  }
+
+  /**
+   * Returns the most recent commit among the lines `startLine` to `endLine` (1-based, inclusive), or
+   * undefined if none of them is committed.
+   */
+  getLastCommit(startLine: number, endLine: number): ChunkBlame | undefined {
+    let latest: { sha: string; commit: BlameCommit } | undefined;
+    for (let line = startLine; line <= endLine; line++) {
+      const sha = this.lineCommits[line - 1];
+      const commit = sha !== undefined ? this.commits.get(sha) : undefined;
+      if (sha !== undefined && commit && (!latest || commit.time > latest.commit.time)) {
+        latest = { sha, commit };
+      }
+    }
+    if (!latest) {
+      return undefined;
+    }
+    return {
+      commit: latest.sha,
+      author: latest.commit.author,
+      date: new Date(latest.commit.time * 1000).toISOString(),
+    };
+  }
+}
+
+/**
+ * Runs `git blame` on a file, or returns undefined if it is not tracked by git.
+ *
+ * @param filePath Absolute path of the file; the repository is found from its directory.
+ */
+export function blameFile(filePath: string): FileBlame | undefined {
+  try {
+    // Use execFileSync to prevent shell injection from special characters in file paths
+    const output = execFileSync('git', ['blame', '--porcelain', '--', path.basename(filePath)], {
+      cwd: path.dirname(filePath),
+      maxBuffer: MAX_BLAME_OUTPUT_BYTES,
+      stdio: ['ignore', 'pipe', 'ignore'],
+    }).toString('utf8');
+    return FileBlame.parse(output);
+  } catch (error) {
+    logger.debug('Skipping blame for a file git cannot blame', {
+      file: filePath,
+      error: error instanceof Error ? error.message : String(error),
+    });
+    return undefined;
+  }
+}
+
+/**
+ * Sets `blame` on the chunks of one file to the last commit of their lines. The file is blamed once for
+ * all of its chunks, since blaming is far slower than parsing.
+ *
+ * @param filePath Absolute path of the file the chunks were cut from.
+ */
+export function addBlame(chunks: CodeChunk[], filePath: string): CodeChunk[] {
+  if (chunks.length === 0) {
+    return chunks;
+  }
+  const blame = blameFile(filePath);
+  if (!blame) {
+    return chunks;
+  }
+  return chunks.map((chunk) => {
+    const lastCommit =
+      chunk.startLine !== undefined && chunk.endLine !== undefined
+        ? blame.getLastCommit(chunk.startLine, chunk.endLine)
+        : undefined;
+    return lastCommit ? { ...chunk, blame: lastCommit } : chunk;
+  });
+}
@@ -0,0 +1,108 @@
+import { execFileSync } from 'child_process';
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { logger } from './logger';
+
+/** A commit checked out in a temporary worktree, see `checkoutRef`. */
+export interface RefCheckout {
+  /** The ref as given, e.g. `v1.2.0`. */
+  ref: string;
+  /** SHA of the commit the ref resolved to. */
+  commit: string;
+  /** Root of the temporary worktree holding the files at `commit`. */
+  path: string;
+  /** Removes the worktree again. Safe to call more than once. */
+  remove: () => void;
+}
+
+function git(repoPath: string, args: string[]): string {
+  // Use execFileSync to prevent shell injection from special characters in refs and paths
+  return execFileSync('git', args, { cwd: repoPath, stdio: ['ignore', 'pipe', 'pipe'] })
+    .toString()
+    .trim();
+}
+
+/**
+ * Returns whether `repoPath` is a bare repository, i.e. one without a working tree to index. A
+ * directory that is not a git repository is not bare.
+ */
+export function isBareRepository(repoPath: string): boolean {
+  try {
+    return git(repoPath, ['rev-parse', '--is-bare-repository']) === 'true';
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Resolves a branch, tag, or commit SHA to the SHA of its commit.
+ *
+ * @throws If `repoPath` is not a git repository or `ref` does not name a commit in it.
+ */
+export function resolveRef(repoPath: string, ref: string): string {
+  try {
+    git(repoPath, ['rev-parse', '--git-dir']);
+  } catch {
+    throw new Error(`"${repoPath}" is not a git repository.`);
+  }
+  // A leading '-' would be read as an option by git
+  if (ref.trim() === '' || ref.startsWith('-')) {
+    throw new Error(`Invalid git ref: "${ref}".`);
+  }
+  try {
+    return git(repoPath, ['rev-parse', '--verify', '--quiet', `${ref}^{commit}`]);
+  } catch {
+    throw new Error(
+      `Git ref "${ref}" does not name a commit in "${repoPath}". ` +
+        'Use an existing branch, tag, or commit SHA, and fetch it first if it only exists on a remote.'
+    );
+  }
+}
+
+/**
+ * Checks out the commit a ref points to in a temporary linked worktree (`git worktree add --detach`).
+ *
+ * The repository's own working tree, index, and HEAD are not touched, and bare repositories work too;
+ * git only records the worktree under `.git/worktrees` until `remove` is called.
+ *
+ * @throws If the ref cannot be resolved, see `resolveRef`.
+ */
+export function checkoutRef(repoPath: string, ref: string): RefCheckout {
+  const commit = resolveRef(repoPath, ref);
+  const worktreePath = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-ref-'));
+  try {
+    git(repoPath, ['worktree', 'add', '--detach', worktreePath, commit]);
+  } catch (error) {
+    fs.rmSync(worktreePath, { recursive: true, force: true });
+    const stderr = (error as { stderr?: Buffer }).stderr?.toString().trim();
+    throw new Error(`Failed to check out "${ref}" (${commit}) from "${repoPath}": ${stderr || String(error)}`);
+  }
+  logger.info(`Checked out ${ref} (${commit}) in temporary worktree ${worktreePath}`);
+
+  let removed = false;
+  return {
+    ref,
+    commit,
+    path: worktreePath,
+    remove: () => {
+      if (removed) {
+        return;
+      }
+      removed = true;
+      try {
+        git(repoPath, ['worktree', 'remove', '--force', worktreePath]);
+      } catch (error) {
+        logger.warn(`Failed to remove temporary worktree ${worktreePath}`, {
+          error: error instanceof Error ? error.message : String(error),
+        });
+        fs.rmSync(worktreePath, { recursive: true, force: true });
+        try {
+          git(repoPath, ['worktree', 'prune']);
+        } catch {
+          // git prunes the stale worktree record on its own later
+        }
+      }
+    },
+  };
+}
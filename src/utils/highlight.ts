@@ -0,0 +1,109 @@
+import { extractKeywordTerms, splitIdentifier } from './hybrid_search';
+
+/**
+ * A highlighted part of a search hit's snippet, see `SearchHit.highlights`.
+ *
+ * `start` and `end` are offsets into the snippet (JavaScript string indices, `end` exclusive); a span
+ * never crosses a line break.
+ */
+export interface HighlightSpan {
+  start: number;
+  end: number;
+  /** File line the span is on (1-based); null when the hit has no known location. */
+  line: number | null;
+}
+
+/** Identifier-like runs of the snippet, the same as the terms `extractKeywordTerms` takes from a query. */
+const TOKEN_PATTERN = /[\p{L}\p{N}_$]+/gu;
+
+/** The words of an identifier, the way `splitIdentifier` splits it. */
+const WORD_PATTERN = /\p{Lu}+(?=\p{Lu}\p{Ll})|\p{Lu}?\p{Ll}+|\p{Lu}+|\p{L}+|\p{N}+/gu;
+
+/** Sorts spans and joins the ones that overlap or touch, so `parse` and `Queue` become `parseQueue`. */
+function mergeSpans(spans: Array<[number, number]>): Array<[number, number]> {
+  const merged: Array<[number, number]> = [];
+  for (const [start, end] of [...spans].sort((a, b) => a[0] - b[0])) {
+    const last = merged[merged.length - 1];
+    if (last && start <= last[1]) {
+      last[1] = Math.max(last[1], end);
+    } else {
+      merged.push([start, end]);
+    }
+  }
+  return merged;
+}
+
+/**
+ * Finds the parts of a snippet matching the terms of a query: identifiers equal to a term (ignoring
+ * case), and the words of compound identifiers equal to a word of the query, so `parse queue` and
+ * `ParseQueue` both highlight `parseQueue` and `parse_queue`.
+ */
+function findTermSpans(snippet: string, query: string): Array<[number, number]> {
+  const terms = extractKeywordTerms(query);
+  const lowerTerms = new Set(terms.map((term) => term.toLowerCase()));
+  const words = new Set(terms.flatMap(splitIdentifier));
+  const spans: Array<[number, number]> = [];
+  for (const token of snippet.matchAll(TOKEN_PATTERN)) {
+    const start = token.index;
+    if (lowerTerms.has(token[0].toLowerCase())) {
+      spans.push([start, start + token[0].length]);
+      continue;
+    }
+    for (const word of token[0].matchAll(WORD_PATTERN)) {
+      if (words.has(word[0].toLowerCase())) {
+        spans.push([start + word.index, start + word.index + word[0].length]);
+      }
+    }
+  }
+  return mergeSpans(spans);
+}
+
+/**
+ * Finds the signature line of a snippet: the first line naming its symbol, or its first non-blank line.
+ * The span leaves out the indentation.
+ */
+function findSignatureSpan(snippet: string, symbol: string | null): Array<[number, number]> {
+  const lines = snippet.split('\n');
+  const names = (line: string) => symbol !== null && (line.match(TOKEN_PATTERN) ?? []).includes(symbol);
+  const index = lines.findIndex(names);
+  const lineIndex = index >= 0 ? index : lines.findIndex((line) => line.trim() !== '');
+  if (lineIndex < 0) {
+    return [];
+  }
+  const offset = lines.slice(0, lineIndex).reduce((total, line) => total + line.length + 1, 0);
+  const line = lines[lineIndex];
+  return [[offset + line.length - line.trimStart().length, offset + line.length]];
+}
+
+/**
+ * Computes the spans of a snippet to highlight for a query.
+ *
+ * These are the parts matching the query's terms, as keyword search matches them. When nothing in the
+ * snippet matches literally, which is common for semantic hits, the signature line of the snippet's
+ * symbol is highlighted instead.
+ *
+ * @param snippet The trimmed chunk content, see `trimSnippet`.
+ * @param query The search query.
+ * @param symbol Name of the symbol the chunk defines, if known.
+ * @param firstLine File line of the snippet's first line, or null if the hit has no known location.
+ */
+export function highlightSnippet(
+  snippet: string,
+  query: string,
+  symbol: string | null,
+  firstLine: number | null
+): HighlightSpan[] {
+  const terms = findTermSpans(snippet, query);
+  const spans = terms.length > 0 ? terms : findSignatureSpan(snippet, symbol);
+  const lineStarts = [0];
+  for (let i = snippet.indexOf('\n'); i >= 0; i = snippet.indexOf('\n', i + 1)) {
+    lineStarts.push(i + 1);
+  }
+  return spans.map(([start, end]) => {
+    let lineIndex = 0;
+    while (lineIndex + 1 < lineStarts.length && lineStarts[lineIndex + 1] <= start) {
+      lineIndex++;
+    }
+    return { start, end, line: firstLine === null ? null : firstLine + lineIndex };
+  });
+}
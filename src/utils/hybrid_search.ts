@@ -0,0 +1,152 @@
+import type { CodeChunk, SearchResult } from './elasticsearch';
+
+export const SEARCH_MODES = ['semantic', 'keyword', 'hybrid'] as const;
+export type SearchMode = (typeof SEARCH_MODES)[number];
+
+export const FUSION_METHODS = ['rrf', 'linear'] as const;
+export type FusionMethod = (typeof FUSION_METHODS)[number];
+
+/** A retrieval signal that can contribute to a hit. */
+export type SearchSignal = 'semantic' | 'keyword';
+
+/** Rank offset of reciprocal rank fusion; 60 is the value from the original RRF paper. */
+export const RRF_K = 60;
+
+export const DEFAULT_HYBRID_ALPHA = 0.5;
+
+export interface FusionOptions {
+  /** Weight of the semantic signal in [0, 1]; the keyword signal gets `1 - alpha`. */
+  alpha?: number;
+  method?: FusionMethod;
+}
+
+/** What one signal added to the score of a result, see `FusedResult.contributions`. */
+export interface SignalContribution {
+  signal: SearchSignal;
+  /** Score the store gave the chunk: vector similarity for `semantic`, BM25 for `keyword`. */
+  rawScore: number;
+  /** 1-based position of the chunk in the signal's results. */
+  rank: number;
+  /** Weight of the signal: `alpha` for `semantic` and `1 - alpha` for `keyword` in hybrid mode, else 1. */
+  weight: number;
+  /** Part of the fused score from this signal: the weighted reciprocal rank or normalized score. */
+  contribution: number;
+}
+
+/** A result of hybrid retrieval: `result.score` is the fused score. */
+export interface FusedResult {
+  result: SearchResult;
+  /** The signals whose result lists contained this chunk, semantic first. */
+  signals: SearchSignal[];
+  /** What each of `signals` added to the fused score, in the same order; they sum up to it. */
+  contributions: SignalContribution[];
+}
+
+/**
+ * Splits a query into the terms used for keyword (BM25) matching.
+ *
+ * Terms are runs of letters, digits, `_`, and `$`, so identifiers such as `parse_queue` or `$scope`
+ * stay whole and punctuation never reaches the query syntax of the store.
+ */
+export function extractKeywordTerms(query: string): string[] {
+  return Array.from(new Set(query.match(/[\p{L}\p{N}_$]+/gu) ?? []));
+}
+
+/**
+ * Splits an identifier into lowercase words at `_`, `$`, and `-`, at camelCase humps, after acronyms,
+ * and around digits: `ParseJSONConfig`, `parseJsonConfig`, and `parse_json_config` all become
+ * `['parse', 'json', 'config']`.
+ */
+export function splitIdentifier(identifier: string): string[] {
+  return (identifier.match(/\p{Lu}+(?=\p{Lu}\p{Ll})|\p{Lu}?\p{Ll}+|\p{Lu}+|\p{L}+|\p{N}+/gu) ?? []).map((word) =>
+    word.toLowerCase()
+  );
+}
+
+/**
+ * Returns the distinct words of the given identifiers, see `splitIdentifier`.
+ *
+ * Stores keep these next to a chunk's raw symbol names, and keyword search matches the words of the
+ * query against them, so `parse json` finds `ParseJSONConfig` and `ParseJSONConfig` finds `parse_json_config`.
+ */
+export function tokenizeIdentifiers(identifiers: string[]): string[] {
+  return Array.from(new Set(identifiers.flatMap(splitIdentifier)));
+}
+
+/** The words of a chunk's symbol names and parent symbol, for keyword matching. */
+export function getSymbolTokens(chunk: Pick<CodeChunk, 'symbols' | 'parentSymbol'>): string[] {
+  return tokenizeIdentifiers([
+    ...(chunk.symbols ?? []).map((symbol) => symbol.name),
+    ...(chunk.parentSymbol ? [chunk.parentSymbol] : []),
+  ]);
+}
+
+/**
+ * Appends the words of the query's compound identifiers to it, so an embedding of `ParseJSONConfig`
+ * also sees `parse json config`. Queries without compound identifiers are returned unchanged.
+ */
+export function expandQueryIdentifiers(query: string): string {
+  const compound = extractKeywordTerms(query).filter((term) => splitIdentifier(term).length > 1);
+  return compound.length > 0 ? `${query} (${tokenizeIdentifiers(compound).join(' ')})` : query;
+}
+
+function normalizeScores(results: SearchResult[]): Map<string, number> {
+  const scores = results.map((result) => result.score);
+  const min = Math.min(...scores);
+  const range = Math.max(...scores) - min;
+  return new Map(results.map((result) => [result.id, range === 0 ? 1 : (result.score - min) / range]));
+}
+
+/**
+ * Combines semantic and keyword results into one ranking.
+ *
+ * `rrf` (the default) scores a chunk by `alpha / (RRF_K + semanticRank) + (1 - alpha) / (RRF_K + keywordRank)`,
+ * which only looks at ranks, so the unrelated score scales of vector similarity and BM25 never need to be
+ * reconciled. `linear` min-max normalizes each list to [0, 1] and takes the weighted sum instead. A chunk
+ * missing from one list gets nothing from that signal.
+ *
+ * @param semantic Semantic results, best match first.
+ * @param keyword Keyword results, best match first.
+ * @returns Every chunk from either list, highest fused score first.
+ */
+export function fuseResults(
+  semantic: SearchResult[],
+  keyword: SearchResult[],
+  options: FusionOptions = {}
+): FusedResult[] {
+  const alpha = options.alpha ?? DEFAULT_HYBRID_ALPHA;
+  const method = options.method ?? 'rrf';
+  const lists: Array<{ signal: SearchSignal; weight: number; results: SearchResult[] }> = [
+    { signal: 'semantic', weight: alpha, results: semantic },
+    { signal: 'keyword', weight: 1 - alpha, results: keyword },
+  ];
+
+  const fused = new Map<string, { result: SearchResult; score: number; contributions: SignalContribution[] }>();
+  for (const { signal, weight, results } of lists) {
+    const normalized = method === 'linear' ? normalizeScores(results) : undefined;
+    results.forEach((result, rank) => {
+      const contribution = weight * (normalized ? (normalized.get(result.id) ?? 0) : 1 / (RRF_K + rank + 1));
+      const entry = fused.get(result.id);
+      const explained = { signal, rawScore: result.score, rank: rank + 1, weight, contribution };
+      if (entry) {
+        entry.score += contribution;
+        const previous = entry.contributions.find((existing) => existing.signal === signal);
+        if (previous) {
+          previous.contribution += contribution;
+        } else {
+          entry.contributions.push(explained);
+        }
+      } else {
+        fused.set(result.id, { result, score: contribution, contributions: [explained] });
+      }
+    });
+  }
+
+  return Array.from(fused.values())
+    .sort((a, b) => b.score - a.score)
+    .map(({ result, score, contributions }) => ({
+      result: { ...result, score },
+      signals: contributions.map(({ signal }) => signal),
+      contributions,
+    }));
+}
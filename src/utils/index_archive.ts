@@ -0,0 +1,398 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { StringDecoder } from 'string_decoder';
+import { pipeline } from 'stream/promises';
+import zlib from 'zlib';
+import { ChunkStore } from './chunk_store';
+import { CodeChunk, getChunkDocumentId } from './elasticsearch';
+import { Embedder, validateEmbedderDimensions } from './embedder';
+import { logger } from './logger';
+import { getCommitKey } from './workspace';
+
+/** Version of the archive layout; archives of another version are refused. */
+export const INDEX_ARCHIVE_FORMAT = 1;
+
+const MANIFEST_FILE = 'manifest.json';
+const CHUNKS_FILE = 'chunks.jsonl';
+const TAR_BLOCK_SIZE = 512;
+/** Chunk occurrences passed to `indexChunks` per call on import. */
+const IMPORT_BATCH_SIZE = 500;
+
+/** What an index archive holds, stored as `manifest.json` ahead of the chunks. */
+export interface IndexArchiveManifest {
+  format: number;
+  /** Name of the embedder that embedded the chunks, or null if the index has no client-side vectors. */
+  embedder: string | null;
+  /** Dimensions of the archived vectors, or null without an embedder. */
+  dimensions: number | null;
+  /** Archived chunks; identical content in several files is one chunk. */
+  chunks: number;
+  /** Archived locations, one per occurrence of a chunk in a file. */
+  locations: number;
+  /**
+   * Last indexed commit of each branch with locations, as recorded by incremental indexing. Keys are
+   * the branch, or `<workspace>:<branch>` for the branches of a workspace (see `getCommitKey`).
+   */
+  commits: Record<string, string>;
+  created_at: string;
+}
+
+type ArchivedLocation = Pick<
+  CodeChunk,
+  | 'filePath'
+  | 'startLine'
+  | 'endLine'
+  | 'directoryPath'
+  | 'directoryName'
+  | 'directoryDepth'
+  | 'git_file_hash'
+  | 'git_branch'
+  | 'workspace'
+  | 'blame'
+>;
+
+/** A line of `chunks.jsonl`: a chunk with its vector, and all of its locations. */
+interface ArchivedChunk extends Omit<CodeChunk, keyof ArchivedLocation> {
+  locations: ArchivedLocation[];
+}
+
+function describeEmbedder(name: string | null, dimensions: number | null): string {
+  return name !== null ? `embedder "${name}" (${dimensions} dimensions)` : 'no client-side embedder';
+}
+
+function toErrorMessage(error: unknown): string {
+  if (error instanceof Error) {
+    return error.message;
+  }
+  return typeof error === 'string' ? error : JSON.stringify(error);
+}
+
+/** Groups the occurrences of a page of `exportChunks` by chunk, one archived chunk per id. */
+function toArchivedChunks(occurrences: CodeChunk[]): ArchivedChunk[] {
+  const byId = new Map<string, ArchivedChunk>();
+  for (const occurrence of occurrences) {
+    const {
+      filePath,
+      startLine,
+      endLine,
+      directoryPath,
+      directoryName,
+      directoryDepth,
+      git_file_hash,
+      git_branch,
+      workspace,
+      blame,
+      ...chunk
+    } = occurrence;
+    const location = {
+      filePath,
+      startLine,
+      endLine,
+      directoryPath,
+      directoryName,
+      directoryDepth,
+      git_file_hash,
+      git_branch,
+      workspace,
+      blame,
+    };
+    const id = getChunkDocumentId(occurrence);
+    const archived = byId.get(id) ?? { ...chunk, locations: [] };
+    archived.locations.push(location);
+    byId.set(id, archived);
+  }
+  return Array.from(byId.values());
+}
+
+/** Builds the ustar header of a regular file. */
+function tarHeader(name: string, size: number): Buffer {
+  const header = Buffer.alloc(TAR_BLOCK_SIZE);
+  const write = (value: string, offset: number, length: number) => header.write(value, offset, length, 'ascii');
+  const octal = (value: number, length: number) => value.toString(8).padStart(length - 1, '0');
+  write(name, 0, 100);
+  write(octal(0o644, 8), 100, 8);
+  write(octal(0, 8), 108, 8);
+  write(octal(0, 8), 116, 8);
+  write(octal(size, 12), 124, 12);
+  write(octal(Math.floor(Date.now() / 1000), 12), 136, 12);
+  write(' '.repeat(8), 148, 8);
+  write('0', 156, 1);
+  write('ustar\u000000', 257, 8);
+  const checksum = header.reduce((sum, byte) => sum + byte, 0);
+  write(`${octal(checksum, 7)}\u0000 `, 148, 8);
+  return header;
+}
+
+async function* tarFile(name: string, size: number, data: AsyncIterable<Buffer> | Buffer[]): AsyncGenerator<Buffer> {
+  yield tarHeader(name, size);
+  yield* data;
+  yield Buffer.alloc((TAR_BLOCK_SIZE - (size % TAR_BLOCK_SIZE)) % TAR_BLOCK_SIZE);
+}
+
+/**
+ * Reads the regular files of a tar stream, yielding their contents piece by piece in archive order.
+ *
+ * @throws If the stream is not a ustar archive or ends inside a file.
+ */
+async function* readTarFiles(source: AsyncIterable<Buffer>): AsyncGenerator<{ name: string; data: Buffer }> {
+  let buffer = Buffer.alloc(0);
+  let entry: { name: string; remaining: number; padding: number; skip: boolean } | undefined;
+  for await (const piece of source) {
+    buffer = buffer.length > 0 ? Buffer.concat([buffer, piece]) : piece;
+    while (true) {
+      if (entry && entry.remaining > 0) {
+        if (buffer.length === 0) {
+          break;
+        }
+        const data = buffer.subarray(0, Math.min(entry.remaining, buffer.length));
+        buffer = buffer.subarray(data.length);
+        entry.remaining -= data.length;
+        if (!entry.skip) {
+          yield { name: entry.name, data };
+        }
+        continue;
+      }
+      if (entry) {
+        if (buffer.length < entry.padding) {
+          break;
+        }
+        buffer = buffer.subarray(entry.padding);
+        entry = undefined;
+      }
+      if (buffer.length < TAR_BLOCK_SIZE) {
+        break;
+      }
+      const header = buffer.subarray(0, TAR_BLOCK_SIZE);
+      buffer = buffer.subarray(TAR_BLOCK_SIZE);
+      if (header.every((byte) => byte === 0)) {
+        return;
+      }
+      if (header.toString('ascii', 257, 262) !== 'ustar') {
+        throw new Error('not a tar archive');
+      }
+      const size = parseInt(header.toString('ascii', 124, 136).replace(/\0.*$/, '').trim() || '0', 8);
+      const type = header.toString('ascii', 156, 157);
+      entry = {
+        name: header.toString('utf8', 0, 100).replace(/\0.*$/s, ''),
+        remaining: size,
+        padding: (TAR_BLOCK_SIZE - (size % TAR_BLOCK_SIZE)) % TAR_BLOCK_SIZE,
+        skip: type !== '0' && type !== '\0',
+      };
+    }
+  }
+  if (entry) {
+    throw new Error(`the archive ends inside ${entry.name}`);
+  }
+}
+
+/** Reads the non-empty lines of the files in a `.tar.gz` archive, in archive order. */
+async function* readArchiveLines(file: string): AsyncGenerator<{ name: string; line: string }> {
+  const source = fs.createReadStream(file);
+  const gunzip = zlib.createGunzip();
+  source.on('error', (error) => gunzip.destroy(error));
+  let current: { name: string; decoder: StringDecoder; partial: string } | undefined;
+  try {
+    for await (const { name, data } of readTarFiles(source.pipe(gunzip))) {
+      if (current?.name !== name) {
+        if (current?.partial) {
+          yield { name: current.name, line: current.partial };
+        }
+        current = { name, decoder: new StringDecoder('utf8'), partial: '' };
+      }
+      const lines = (current.partial + current.decoder.write(data)).split('\n');
+      current.partial = lines.pop() ?? '';
+      for (const line of lines.filter((line) => line.trim() !== '')) {
+        yield { name, line };
+      }
+    }
+    if (current?.partial.trim()) {
+      yield { name: current.name, line: current.partial };
+    }
+  } finally {
+    source.destroy();
+  }
+}
+
+/**
+ * Reads the manifest and then the chunks of an index archive.
+ *
+ * @throws If the archive is unreadable, is not an index archive, or is of another format.
+ */
+async function* readIndexArchive(
+  file: string
+): AsyncGenerator<{ manifest: IndexArchiveManifest } | { chunk: ArchivedChunk }> {
+  try {
+    let hasManifest = false;
+    for await (const { name, line } of readArchiveLines(file)) {
+      if (!hasManifest) {
+        if (name !== MANIFEST_FILE) {
+          throw new Error(`it does not start with ${MANIFEST_FILE}`);
+        }
+        const manifest = JSON.parse(line) as IndexArchiveManifest;
+        if (manifest.format !== INDEX_ARCHIVE_FORMAT) {
+          throw new Error(`format ${manifest.format} is not supported; expected format ${INDEX_ARCHIVE_FORMAT}`);
+        }
+        hasManifest = true;
+        yield { manifest };
+      } else if (name === CHUNKS_FILE) {
+        yield { chunk: JSON.parse(line) as ArchivedChunk };
+      }
+    }
+    if (!hasManifest) {
+      throw new Error(`it has no ${MANIFEST_FILE}`);
+    }
+  } catch (error) {
+    throw new Error(`Could not read archive "${file}": ${toErrorMessage(error)}`, { cause: error });
+  }
+}
+
+/**
+ * Writes every chunk of a store, with its vectors, locations, and the last indexed commit of each branch,
+ * to a `.tar.gz` archive that `importIndexArchive` loads into another store of any backend.
+ *
+ * The archive holds `manifest.json`, then `chunks.jsonl` with one chunk and all its locations per line.
+ * The chunks are staged in a temporary file, since tar records the size of a file ahead of it.
+ *
+ * @param options.embedder The embedder the index was built with, recorded so that imports can verify it.
+ *   Without one, it can only be imported into an index without one, e.g. one using `semantic_text`.
+ * @param options.index Index name used in error messages.
+ * @throws If the embedder does not match the dimensions of the stored vectors.
+ */
+export async function exportIndexArchive(
+  store: ChunkStore,
+  file: string,
+  options: { embedder?: Embedder; index: string }
+): Promise<IndexArchiveManifest> {
+  const { embedder, index } = options;
+  if (embedder) {
+    validateEmbedderDimensions(embedder, await store.getVectorDimensions(), index);
+  }
+
+  const manifest: IndexArchiveManifest = {
+    format: INDEX_ARCHIVE_FORMAT,
+    embedder: embedder?.name ?? null,
+    dimensions: embedder?.dimensions() ?? null,
+    chunks: 0,
+    locations: 0,
+    commits: {},
+    created_at: new Date().toISOString(),
+  };
+  const commitKeys = new Set<string>();
+  const stagingDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scsi-export-'));
+  const chunksPath = path.join(stagingDir, CHUNKS_FILE);
+  try {
+    await pipeline(async function* () {
+      for await (const page of store.exportChunks()) {
+        for (const chunk of toArchivedChunks(page)) {
+          manifest.chunks++;
+          manifest.locations += chunk.locations.length;
+          for (const { git_branch, workspace } of chunk.locations) {
+            if (git_branch) {
+              commitKeys.add(getCommitKey(git_branch, workspace));
+            }
+          }
+          yield `${JSON.stringify(chunk)}\n`;
+        }
+      }
+    }, fs.createWriteStream(chunksPath));
+
+    for (const key of Array.from(commitKeys).sort()) {
+      const commit = await store.getLastIndexedCommit(key);
+      if (commit) {
+        manifest.commits[key] = commit;
+      }
+    }
+
+    const manifestData = Buffer.from(`${JSON.stringify(manifest)}\n`);
+    try {
+      await pipeline(
+        async function* () {
+          yield* tarFile(MANIFEST_FILE, manifestData.length, [manifestData]);
+          yield* tarFile(CHUNKS_FILE, fs.statSync(chunksPath).size, fs.createReadStream(chunksPath));
+          yield Buffer.alloc(TAR_BLOCK_SIZE * 2);
+        },
+        zlib.createGzip(),
+        fs.createWriteStream(file)
+      );
+    } catch (error) {
+      fs.rmSync(file, { force: true });
+      throw error;
+    }
+  } finally {
+    fs.rmSync(stagingDir, { recursive: true, force: true });
+  }
+
+  logger.info('Exported index archive', { index, file, chunks: manifest.chunks, locations: manifest.locations });
+  return manifest;
+}
+
+/**
+ * Loads an archive written by `exportIndexArchive` into an empty store, keeping the archived vectors,
+ * and records the archived last indexed commits so that incremental indexing continues from them.
+ * The manifest is checked before anything is written.
+ *
+ * @param options.embedder The configured embedder; it must be the one the archive was built with.
+ * @param options.index Index name used in error messages.
+ * @throws If the archive is unreadable or of another format, was built with another embedder or
+ *   dimensions, the store already holds chunks, or chunks fail to store.
+ */
+export async function importIndexArchive(
+  store: ChunkStore,
+  file: string,
+  options: { embedder?: Embedder; index: string }
+): Promise<IndexArchiveManifest> {
+  const { embedder, index } = options;
+  if (!fs.existsSync(file)) {
+    throw new Error(`Archive "${file}" does not exist.`);
+  }
+
+  let manifest: IndexArchiveManifest | undefined;
+  let batch: CodeChunk[] = [];
+  const flush = async () => {
+    const { failed } = await store.indexChunks(batch);
+    if (failed.length > 0) {
+      throw new Error(`Failed to store ${failed.length} chunk(s): ${toErrorMessage(failed[0].error)}`);
+    }
+    batch = [];
+  };
+
+  for await (const entry of readIndexArchive(file)) {
+    if ('manifest' in entry) {
+      manifest = entry.manifest;
+      const configured = embedder?.name ?? null;
+      const dimensions = embedder?.dimensions() ?? null;
+      if (manifest.embedder !== configured || manifest.dimensions !== dimensions) {
+        throw new Error(
+          `Archive "${file}" was built with ${describeEmbedder(manifest.embedder, manifest.dimensions)}, but ` +
+            `${describeEmbedder(configured, dimensions)} is configured (SCS_IDXR_EMBEDDER). Import it with the ` +
+            'same embedder, since queries must be embedded by the model that embedded the chunks.'
+        );
+      }
+      await store.setup();
+      const { chunks } = await store.getStats();
+      if (chunks > 0) {
+        throw new Error(
+          `Index "${index}" already holds ${chunks} chunk(s). Import into a new index, or clean this one first.`
+        );
+      }
+      continue;
+    }
+    const { locations, ...chunk } = entry.chunk;
+    batch.push(...locations.map((location) => ({ ...chunk, ...location }) as CodeChunk));
+    if (batch.length >= IMPORT_BATCH_SIZE) {
+      await flush();
+    }
+  }
+  if (batch.length > 0) {
+    await flush();
+  }
+  // readIndexArchive throws unless the manifest came first
+  const { commits, chunks, locations } = manifest as IndexArchiveManifest;
+  for (const [branch, commit] of Object.entries(commits)) {
+    await store.updateLastIndexedCommit(branch, commit);
+  }
+
+  logger.info('Imported index archive', { index, file, chunks, locations });
+  return manifest as IndexArchiveManifest;
+}
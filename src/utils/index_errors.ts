@@ -0,0 +1,79 @@
+import type { ParseFallback, ParseSkip, SkipReason } from './parser';
+import { createLogger } from './logger';
+
+type Logger = ReturnType<typeof createLogger>;
+
+/**
+ * A problem with a single file during an indexing run.
+ */
+export interface IndexError {
+  /** Repository-relative path of the file. */
+  path: string;
+  error: string;
+  /** 1-based line the error points at, when known. */
+  line?: number;
+  /** True if the file was left out of the index; false if it was indexed in a degraded form. */
+  fatal: boolean;
+  /** Set when the file was left out on purpose (too large, binary, or minified); `--strict` runs go on. */
+  skipped?: SkipReason;
+}
+
+/**
+ * Thrown by `--strict` runs at the first file that cannot be indexed cleanly.
+ */
+export class StrictIndexError extends Error {
+  constructor(readonly indexError: IndexError) {
+    super(`Failed to index ${formatIndexErrorLocation(indexError)}: ${indexError.error}`);
+    this.name = 'StrictIndexError';
+  }
+}
+
+function formatIndexErrorLocation({ path, line }: IndexError): string {
+  return line === undefined ? path : `${path}:${line}`;
+}
+
+/**
+ * Returns the errors of a file that parsed: a fallback to text chunking and dropped oversized chunks, or
+ * the reason the parser skipped it.
+ */
+export function getParseErrors(
+  path: string,
+  fallback: ParseFallback | undefined,
+  chunksSkipped: number,
+  skipped?: ParseSkip
+): IndexError[] {
+  if (skipped) {
+    return [{ path, error: skipped.message, fatal: true, skipped: skipped.reason }];
+  }
+  const errors: IndexError[] = [];
+  if (fallback) {
+    errors.push({
+      path,
+      error: `Tree-sitter failed (${fallback.error}); indexed as plain text`,
+      line: fallback.line,
+      fatal: false,
+    });
+  }
+  if (chunksSkipped > 0) {
+    errors.push({ path, error: `Skipped ${chunksSkipped} chunk(s) larger than maxChunkSizeBytes`, fatal: false });
+  }
+  return errors;
+}
+
+/**
+ * Logs the files that were skipped or indexed in a degraded form, so none of them go unnoticed.
+ */
+export function reportIndexErrors(errors: IndexError[], logger: Logger): void {
+  if (errors.length === 0) {
+    return;
+  }
+  const fatal = errors.filter((error) => error.fatal);
+  const degraded = errors.filter((error) => !error.fatal);
+  logger.warn(`--- Index Error Report: ${fatal.length} file(s) skipped, ${degraded.length} degraded ---`);
+  for (const error of fatal) {
+    logger.warn(`Skipped ${formatIndexErrorLocation(error)}: ${error.error}`);
+  }
+  for (const error of degraded) {
+    logger.warn(`Degraded ${formatIndexErrorLocation(error)}: ${error.error}`);
+  }
+}
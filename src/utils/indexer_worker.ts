@@ -1,8 +1,14 @@
 import { IQueue, QueuedDocument } from './queue';
-import { indexCodeChunks } from './elasticsearch';
+import { BulkIndexResult, getChunkVectors, indexCodeChunks } from './elasticsearch';
+import { ChunkStore, getStoredVectors } from './chunk_store';
+import { EmbedBatchOptions, Embedder, embedMissing } from './embedder';
+import { DEFAULT_EMBED_TEMPLATE, EmbedTemplate, parseEmbedTemplate } from './embed_template';
 import { logger as defaultLogger, createLogger } from './logger';
 import PQueue from 'p-queue';
 import { SqliteQueue } from './sqlite_queue';
+import { sleepUnlessCancelled, throwIfCancelled } from './cancellation';
+import { ChunkDeduplicator } from './chunk_dedup';
+import { ProgressTracker } from './progress';
 import { createMetrics, Metrics, createAttributes } from './metrics';
 
 const POLLING_INTERVAL_MS = 1000; // 1 second
@@ -13,39 +19,93 @@ export interface IndexerWorkerOptions {
   queue: IQueue;
   batchSize: number;
   concurrency?: number;
+  /**
+   * Most documents the batches in flight hold together, with their vectors (default: `batchSize` times
+   * `concurrency`). Smaller batches are dequeued while the batches in flight are close to the limit.
+   */
+  maxInFlightDocuments?: number;
   watch?: boolean;
   logger?: Logger;
   elasticsearchIndex: string;
   repoInfo?: { name: string; branch: string };
+  /** Store to write chunks to (default: the Elasticsearch index named by `elasticsearchIndex`). */
+  store?: ChunkStore;
+  /** Optional client-side embedder used to fill `code_vector` before indexing. */
+  embedder?: Embedder;
+  /** Batching, concurrency, and retry settings for the embedder. */
+  embedding?: EmbedBatchOptions;
+  /** Renders the text embedded per document (default: its `semantic_text`). */
+  embedTemplate?: EmbedTemplate;
+  /**
+   * Keeps the vectors already stored for chunks instead of embedding them again (default: true). Turned
+   * off when they were made with another embedder or embed template, see `canReuseStoredVectors`.
+   */
+  reuseStoredVectors?: boolean;
+  /** Folds near-duplicate chunks into canonical ones before they are embedded; unset stores every chunk. */
+  deduplicator?: ChunkDeduplicator;
+  /** Receives the embedding and storing progress; shared with the producer of the same run. */
+  progress?: ProgressTracker;
+  /**
+   * Stops the worker when aborted: no further batches are dequeued, and batches in flight finish their
+   * store writes and are committed. Documents not yet embedded are requeued for the next run.
+   */
+  signal?: AbortSignal;
 }
 
 export class IndexerWorker {
   private queue: IQueue;
   private batchSize: number;
   private concurrency: number;
+  private maxInFlightDocuments: number;
+  private inFlightDocuments = 0;
   private watch: boolean;
   private consumerQueue: PQueue;
   private isRunning = false;
   private elasticsearchIndex: string;
+  private store?: ChunkStore;
   private logger: Logger;
   private metrics: Metrics;
+  private embedder?: Embedder;
+  private embeddingOptions: EmbedBatchOptions;
+  private embedTemplate: EmbedTemplate;
+  private reuseStoredVectors: boolean;
+  private deduplicator?: ChunkDeduplicator;
+  private progress?: ProgressTracker;
+  private signal?: AbortSignal;
+  private summary = { succeeded: 0, reused: 0, embeddingFailures: 0 };
+  private failedIds = new Set<string>();
 
   constructor(options: IndexerWorkerOptions) {
     this.queue = options.queue;
     this.batchSize = options.batchSize;
     this.concurrency = options.concurrency ?? 1;
+    this.maxInFlightDocuments = options.maxInFlightDocuments ?? this.batchSize * this.concurrency;
     this.watch = options.watch ?? false;
     this.consumerQueue = new PQueue({ concurrency: this.concurrency });
     this.elasticsearchIndex = options.elasticsearchIndex;
+    this.store = options.store;
     this.logger = options.logger ?? defaultLogger;
     this.metrics = createMetrics(options.repoInfo);
+    this.embedder = options.embedder;
+    this.deduplicator = options.deduplicator;
+    this.progress = options.progress;
+    this.signal = options.signal;
+    this.embeddingOptions = { ...options.embedding, signal: options.signal ?? options.embedding?.signal };
+    this.embedTemplate = options.embedTemplate ?? parseEmbedTemplate(DEFAULT_EMBED_TEMPLATE);
+    this.reuseStoredVectors = options.reuseStoredVectors ?? true;
   }
 
+  /**
+   * Processes the queue until it is empty, or until stopped in watch mode.
+   *
+   * @throws IndexingCancelledError if `signal` is aborted; batches in flight are finished first.
+   */
   async start(): Promise<void> {
     this.isRunning = true;
     this.logger.info('IndexerWorker started', {
       concurrency: this.concurrency,
       batchSize: this.batchSize,
+      maxInFlightDocuments: this.maxInFlightDocuments,
       watch: this.watch,
     });
 
@@ -53,27 +113,36 @@ export class IndexerWorker {
       await this.queue.requeueStaleTasks();
     }
 
-    while (this.isRunning) {
-      // Backpressure: Only dequeue a new batch if we have a free worker slot.
+    while (this.isRunning && !this.signal?.aborted) {
+      // Backpressure: Only dequeue a new batch if we have a free worker slot and room for its documents.
       // Check both pending (waiting) and active (running) tasks
       const totalActiveTasks = this.consumerQueue.size + this.consumerQueue.pending;
-      if (totalActiveTasks >= this.concurrency) {
+      if (totalActiveTasks >= this.concurrency || this.inFlightDocuments >= this.maxInFlightDocuments) {
         // Wait for the next task to complete, which signals a slot is free.
         await new Promise<void>((resolve) => this.consumerQueue.once('next', resolve));
         continue;
       }
 
-      const documentBatch = await this.queue.dequeue(this.batchSize);
+      const documentBatch = await this.queue.dequeue(
+        Math.min(this.batchSize, this.maxInFlightDocuments - this.inFlightDocuments)
+      );
 
       if (documentBatch.length > 0) {
         this.logger.info(`Dequeued batch of ${documentBatch.length} documents. Active tasks: ${totalActiveTasks + 1}`);
         // Add the task to the queue. Do not await.
         // p-queue will manage running it concurrently.
-        this.consumerQueue.add(() => this.processBatch(documentBatch));
+        this.inFlightDocuments += documentBatch.length;
+        this.consumerQueue.add(async () => {
+          try {
+            return await this.processBatch(documentBatch);
+          } finally {
+            this.inFlightDocuments -= documentBatch.length;
+          }
+        });
       } else {
         if (this.watch) {
           // If in watch mode and the queue is empty, wait before polling again.
-          await new Promise((resolve) => setTimeout(resolve, POLLING_INTERVAL_MS));
+          await sleepUnlessCancelled(POLLING_INTERVAL_MS, this.signal);
         } else {
           // If not in watch mode and dequeue returns empty:
           // - If there are still in-flight tasks, wait for a task to complete and retry.
@@ -90,7 +159,21 @@ export class IndexerWorker {
 
     // Wait for any final in-flight tasks to complete before exiting.
     await this.consumerQueue.onIdle();
+    if (this.signal?.aborted) {
+      this.stop();
+      this.logger.warn('IndexerWorker cancelled; batches in flight were committed, the rest stays queued.', {
+        succeeded: this.summary.succeeded,
+      });
+      throwIfCancelled(this.signal);
+    }
     this.logger.info('IndexerWorker finished processing all tasks.');
+    this.logger.info('--- Indexing Summary ---', {
+      succeeded: this.summary.succeeded,
+      failed: this.failedIds.size,
+      embeddingFailures: this.summary.embeddingFailures,
+      ...(this.embedder && { reusedVectors: this.summary.reused }),
+      ...(this.deduplicator && { deduplicated: this.deduplicator.foldedCount }),
+    });
     this.stop();
   }
 
@@ -112,8 +195,13 @@ export class IndexerWorker {
     let requeued: QueuedDocument[] = [];
 
     try {
-      const codeChunks = batch.map((item) => item.document);
-      const result = await indexCodeChunks(codeChunks, this.elasticsearchIndex);
+      this.progress?.setPhase('embedding');
+      const { embedded, failed: embeddingFailedDocs } = await this.embedDocuments(batch);
+      this.progress?.setPhase('storing');
+      const result: BulkIndexResult =
+        embedded.length > 0
+          ? await this.indexChunks(embedded.map((item) => item.document))
+          : { succeeded: [], failed: [] };
 
       const duration = Date.now() - startTime;
 
@@ -121,35 +209,46 @@ export class IndexerWorker {
       // Do NOT map by chunk_hash: chunk_hash is not guaranteed unique (content collisions),
       // and duplicates would leave rows stuck in 'processing'.
       const succeededDocs = result.succeeded
-        .map((s) => batch[s.inputIndex])
+        .map((s) => embedded[s.inputIndex]?.source)
         .filter((doc): doc is QueuedDocument => doc !== undefined);
 
-      const failedDocs = result.failed
-        .map((f) => batch[f.inputIndex])
-        .filter((doc): doc is QueuedDocument => doc !== undefined);
+      const failedDocs = [
+        ...embeddingFailedDocs,
+        ...result.failed
+          .map((f) => embedded[f.inputIndex]?.source)
+          .filter((doc): doc is QueuedDocument => doc !== undefined),
+      ];
 
       // Commit succeeded documents
       if (succeededDocs.length > 0) {
         await this.queue.commit(succeededDocs);
         committed = succeededDocs;
+        this.summary.succeeded += succeededDocs.length;
+        succeededDocs.forEach((doc) => this.failedIds.delete(doc.id));
+        this.progress?.addChunksEmbedded(succeededDocs.length);
       }
 
       // Requeue failed documents
       if (failedDocs.length > 0) {
         await this.queue.requeue(failedDocs);
         requeued = failedDocs;
-        this.logger.error(`Requeueing ${failedDocs.length} failed documents from batch of ${batch.length}.`);
+        if (this.signal?.aborted) {
+          this.logger.info(`Requeued ${failedDocs.length} documents not indexed before cancellation.`);
+        } else {
+          failedDocs.forEach((doc) => this.failedIds.add(doc.id));
+          this.logger.error(`Requeueing ${failedDocs.length} failed documents from batch of ${batch.length}.`);
+        }
       }
 
       // Record metrics
-      if (result.failed.length === 0) {
+      if (failedDocs.length === 0) {
         // Full success
         this.metrics.indexer?.batchProcessed.add(1, commonMetricAttributes);
         this.metrics.indexer?.batchDuration.record(duration, commonMetricAttributes);
         this.metrics.indexer?.batchSize.record(batch.length, commonMetricAttributes);
         this.logger.info(`Successfully indexed and committed batch of ${succeededDocs.length} documents.`);
         return true;
-      } else if (result.succeeded.length > 0) {
+      } else if (succeededDocs.length > 0) {
         // Partial success
         this.metrics.indexer?.batchProcessed.add(1, commonMetricAttributes);
         this.metrics.indexer?.batchDuration.record(duration, commonMetricAttributes);
@@ -181,6 +280,7 @@ export class IndexerWorker {
       if (remaining.length > 0) {
         try {
           await this.queue.requeue(remaining);
+          remaining.forEach((doc) => this.failedIds.add(doc.id));
           this.logger.warn(`Requeued ${remaining.length} documents after exception.`);
         } catch (requeueError) {
           this.logger.error('Failed to requeue documents after exception; they may remain stuck until stale recovery', {
@@ -194,6 +294,66 @@ export class IndexerWorker {
     }
   }
 
+  private indexChunks(chunks: QueuedDocument['document'][]): Promise<BulkIndexResult> {
+    return this.store ? this.store.indexChunks(chunks) : indexCodeChunks(chunks, this.elasticsearchIndex);
+  }
+
+  /** Returns the vectors already stored for documents, by their index in `documents`. */
+  private async getStoredVectors(documents: QueuedDocument['document'][]): Promise<Map<number, number[]>> {
+    if (!this.reuseStoredVectors) {
+      return new Map();
+    }
+    const store = this.store ?? { getChunkVectors: (ids: string[]) => getChunkVectors(ids, this.elasticsearchIndex) };
+    return getStoredVectors(store, documents);
+  }
+
+  /**
+   * Folds each document into its canonical chunk if deduplication is enabled, then fills `code_vector`
+   * using the configured embedder, if any. Chunks whose vector is already stored reuse it, unless
+   * `reuseStoredVectors` is off.
+   *
+   * Documents whose embedding batch failed after all retries are returned in `failed` so they can
+   * be requeued without blocking the rest of the batch.
+   */
+  private async embedDocuments(batch: QueuedDocument[]): Promise<{
+    embedded: Array<{ source: QueuedDocument; document: QueuedDocument['document'] }>;
+    failed: QueuedDocument[];
+  }> {
+    // Queue rows keep the original chunk, so a requeued alias is folded again on retry
+    const documents = batch.map((item) => this.deduplicator?.fold(item.document) ?? item.document);
+    if (!this.embedder) {
+      return { embedded: batch.map((item, i) => ({ source: item, document: documents[i] })), failed: [] };
+    }
+
+    const { vectors, failed, reused } = await embedMissing(
+      this.embedder,
+      documents.map((document) => this.embedTemplate(document)),
+      await this.getStoredVectors(documents),
+      this.embeddingOptions
+    );
+    this.summary.reused += reused;
+
+    const embedded: Array<{ source: QueuedDocument; document: QueuedDocument['document'] }> = [];
+    batch.forEach((item, i) => {
+      const vector = vectors.get(i);
+      if (vector) {
+        embedded.push({ source: item, document: { ...documents[i], code_vector: vector } });
+      }
+    });
+
+    if (failed.length > 0 && !this.signal?.aborted) {
+      this.summary.embeddingFailures += failed.length;
+      this.logger.error(`Failed to embed ${failed.length}/${batch.length} documents.`, {
+        sample: failed.slice(0, 5),
+      });
+    }
+
+    return {
+      embedded,
+      failed: failed.map((f) => batch[f.inputIndex]).filter((doc): doc is QueuedDocument => doc !== undefined),
+    };
+  }
+
   async onIdle(): Promise<void> {
     return this.consumerQueue.onIdle();
   }
@@ -0,0 +1,180 @@
+import fs from 'fs';
+import path from 'path';
+import { languageConfigurations, LanguageName } from '../languages';
+import { LANG_TEXT } from './constants';
+
+/** Number of leading bytes read from a file to detect its language. */
+export const DETECTION_SAMPLE_BYTES = 8192;
+
+/**
+ * Average line length, in characters, above which code is taken to be minified or generated on one line
+ * (bundles, `.min.js` files), see `isMinifiedContent`.
+ */
+export const MINIFIED_AVERAGE_LINE_LENGTH = 500;
+
+/**
+ * Constructs that only appear in C++, used to tell C++ headers from C headers. Standard C++ headers
+ * have no extension, so an `#include <vector>` is a marker while `#include <stdio.h>` is not.
+ */
+const CPP_HEADER_MARKERS = new RegExp(
+  [
+    String.raw`^\s*(?:namespace\s+\w+|class\s+\w+|template\s*<|using\s+namespace\b)`,
+    String.raw`^\s*(?:public|private|protected)\s*:`,
+    String.raw`\bstd::`,
+    String.raw`#include\s*<\w+>`,
+  ].join('|'),
+  'm'
+);
+
+/** Picks the language of a file whose extension is shared by several languages. */
+const AMBIGUOUS_EXTENSION_RESOLVERS: Record<string, (content: string) => LanguageName> = {
+  '.h': (content) => (CPP_HEADER_MARKERS.test(content) ? 'cpp' : 'c'),
+};
+
+interface DetectionTables {
+  bySuffix: Map<string, LanguageName>;
+  byFileName: Map<string, LanguageName>;
+  byInterpreter: Map<string, LanguageName>;
+}
+
+let detectionTables: DetectionTables | undefined;
+
+function getDetectionTables(): DetectionTables {
+  if (!detectionTables) {
+    const tables: DetectionTables = { bySuffix: new Map(), byFileName: new Map(), byInterpreter: new Map() };
+    for (const name of Object.keys(languageConfigurations) as LanguageName[]) {
+      const config = languageConfigurations[name];
+      config.fileSuffixes.forEach((suffix) => tables.bySuffix.set(suffix, name));
+      config.fileNames?.forEach((fileName) => tables.byFileName.set(fileName, name));
+      config.interpreters?.forEach((interpreter) => tables.byInterpreter.set(interpreter, name));
+    }
+    detectionTables = tables;
+  }
+  return detectionTables;
+}
+
+/**
+ * Returns the interpreter named by a `#!` line, e.g. `python` for `#!/usr/bin/env -S python3.11 -u`.
+ * `env` and its options and variable assignments are skipped, and trailing version numbers dropped.
+ */
+function getShebangInterpreter(content: string): string | undefined {
+  const match = /^#!\s*(\S+)([^\n]*)/.exec(content);
+  if (!match) {
+    return undefined;
+  }
+  let interpreter = path.posix.basename(match[1]);
+  if (interpreter === 'env') {
+    const args = match[2].trim().split(/\s+/);
+    const command = args.find((arg) => arg.length > 0 && !arg.startsWith('-') && !arg.includes('='));
+    if (!command) {
+      return undefined;
+    }
+    interpreter = path.posix.basename(command);
+  }
+  return interpreter.replace(/[\d.]+$/, '');
+}
+
+/**
+ * Reads the leading bytes of a file, enough for `detectLanguage`.
+ */
+export function readFileSample(filePath: string): Buffer {
+  const fd = fs.openSync(filePath, 'r');
+  try {
+    const buffer = Buffer.alloc(DETECTION_SAMPLE_BYTES);
+    const bytesRead = fs.readSync(fd, buffer, 0, DETECTION_SAMPLE_BYTES, 0);
+    return buffer.subarray(0, bytesRead);
+  } finally {
+    fs.closeSync(fd);
+  }
+}
+
+function toSample(content: string | Buffer): string {
+  return typeof content === 'string'
+    ? content.slice(0, DETECTION_SAMPLE_BYTES)
+    : content.subarray(0, DETECTION_SAMPLE_BYTES).toString('utf8');
+}
+
+/**
+ * Tells whether content is binary rather than text: its leading bytes contain a NUL byte, which text
+ * encodings other than UTF-16 never produce.
+ *
+ * @param content The file content, or its leading bytes (see `readFileSample`).
+ */
+export function isBinaryContent(content: string | Buffer): boolean {
+  return toSample(content).includes('\u0000');
+}
+
+/**
+ * Tells whether content looks minified: its leading lines average more than
+ * `MINIFIED_AVERAGE_LINE_LENGTH` characters. Source code written by hand rarely exceeds a tenth of that.
+ *
+ * @param content The file content, or its leading bytes (see `readFileSample`).
+ */
+export function isMinifiedContent(content: string | Buffer): boolean {
+  const sample = toSample(content);
+  return sample.length / sample.split('\n').length > MINIFIED_AVERAGE_LINE_LENGTH;
+}
+
+/**
+ * Detects the language of a file from its name and content.
+ *
+ * In order: an exact file name (`Dockerfile`, `Makefile`), the extension (a content check decides
+ * between languages sharing it, such as C and C++ for `.h`), and the interpreter of a `#!` line.
+ * Anything else is `text`, so it is still indexed as plain-text chunks.
+ *
+ * @param filePath Path of the file; only its name is used.
+ * @param content The file content, or its leading bytes (see `readFileSample`).
+ * @returns The language, or `undefined` for binary content (a NUL byte in the sample).
+ */
+export function detectLanguage(filePath: string, content: string | Buffer): LanguageName | undefined {
+  if (isBinaryContent(content)) {
+    return undefined;
+  }
+  const sample = toSample(content);
+
+  const { bySuffix, byFileName, byInterpreter } = getDetectionTables();
+  const fileName = path.basename(filePath);
+  const byName = byFileName.get(fileName);
+  if (byName) {
+    return byName;
+  }
+
+  const extension = path.extname(fileName);
+  const resolveAmbiguous = AMBIGUOUS_EXTENSION_RESOLVERS[extension];
+  if (resolveAmbiguous) {
+    return resolveAmbiguous(sample);
+  }
+  const byExtension = bySuffix.get(extension);
+  if (byExtension) {
+    return byExtension;
+  }
+
+  const interpreter = getShebangInterpreter(sample);
+  return (interpreter && byInterpreter.get(interpreter)) || LANG_TEXT;
+}
+
+/**
+ * Creates a predicate that tells whether a path can be indexed with the given languages, judging by its
+ * name only. With `text` enabled every file qualifies, since unknown files are indexed as plain text;
+ * otherwise known extensions and file names do, and so do extensionless files when a language with
+ * interpreters is enabled, since they may be scripts with a `#!` line.
+ */
+export function createLanguageFileMatcher(languageNames: LanguageName[]): (filePath: string) => boolean {
+  if (languageNames.includes(LANG_TEXT)) {
+    return () => true;
+  }
+  const suffixes = new Set<string>();
+  const fileNames = new Set<string>();
+  let scripts = false;
+  for (const name of languageNames) {
+    const config = languageConfigurations[name];
+    config.fileSuffixes.forEach((suffix) => suffixes.add(suffix));
+    config.fileNames?.forEach((fileName) => fileNames.add(fileName));
+    scripts ||= (config.interpreters?.length ?? 0) > 0;
+  }
+  return (filePath) => {
+    const fileName = path.basename(filePath);
+    const extension = path.extname(fileName);
+    return suffixes.has(extension) || fileNames.has(fileName) || (scripts && extension === '');
+  };
+}
@@ -88,6 +88,10 @@ export function validateLanguageConfiguration(
           // Test if query can be created (basic syntax validation)
           // This will throw if the query syntax is invalid
           new Parser.Query(config.parser, query);
+          // Per-suffix grammars must accept the same queries
+          for (const suffixParser of Object.values(config.suffixParsers ?? {})) {
+            new Parser.Query(suffixParser, query);
+          }
         } catch (error) {
           const errorMessage = error instanceof Error ? error.message : String(error);
           errors.push({
@@ -1,4 +1,5 @@
 // src/utils/logger.ts
+import { AsyncLocalStorage } from 'async_hooks';
 import { getLoggerProvider } from './otel_provider';
 import { SeverityNumber } from '@opentelemetry/api-logs';
 import { ATTR_REPO_NAME, ATTR_REPO_BRANCH } from './constants';
@@ -23,10 +24,98 @@ interface RepoInfo {
   branch: string;
 }
 
+/**
+ * Receives log entries in place of the console, e.g. the logger of an application embedding the indexer.
+ */
+export interface LogSink {
+  debug(message: string, metadata?: object): void;
+  info(message: string, metadata?: object): void;
+  warn(message: string, metadata?: object): void;
+  error(message: string, metadata?: object): void;
+}
+
+const LOG_LEVEL_TO_SINK_METHOD: Record<LogLevel, keyof LogSink> = {
+  [LogLevel.DEBUG]: 'debug',
+  [LogLevel.INFO]: 'info',
+  [LogLevel.WARN]: 'warn',
+  [LogLevel.ERROR]: 'error',
+};
+
+const logSinkScope = new AsyncLocalStorage<{ sink?: LogSink }>();
+
+/** Line kept below the console log output, see `setConsoleStatusLine`. */
+let consoleStatusLine: string | undefined;
+
+const CLEAR_LINE = '\r\x1b[2K';
+
+/**
+ * Shows `line` (e.g. a progress bar) as the last line of a TTY console and redraws it below each log
+ * entry written to the console; `undefined` removes it again. Silenced like the console log output.
+ */
+export function setConsoleStatusLine(line: string | undefined): void {
+  if (appConfig.nodeEnv === 'test' && !appConfig.forceLogging) {
+    return;
+  }
+  if (consoleStatusLine !== undefined) {
+    process.stdout.write(CLEAR_LINE);
+  }
+  consoleStatusLine = line;
+  if (line !== undefined) {
+    process.stdout.write(line);
+  }
+}
+
+/**
+ * Writes a log entry to the console in text format (unless NODE_ENV=test without SCS_IDXR_FORCE_LOGGING).
+ */
+function writeToConsole(level: LogLevel, message: string, metadata: object) {
+  if (appConfig.nodeEnv === 'test' && !appConfig.forceLogging) {
+    return;
+  }
+  const timestamp = new Date().toISOString();
+  let logMessage = `[${timestamp}] [${level}] ${message}`;
+  if (metadata && Object.keys(metadata).length > 0) {
+    try {
+      logMessage += ` ${JSON.stringify(metadata)}`;
+    } catch {
+      logMessage += ' [Metadata serialization failed]';
+    }
+  }
+  if (consoleStatusLine !== undefined) {
+    process.stdout.write(CLEAR_LINE);
+  }
+  console.log(logMessage);
+  if (consoleStatusLine !== undefined) {
+    process.stdout.write(consoleStatusLine);
+  }
+}
+
+/**
+ * The sink that writes log entries to the console, as logging outside `withLogSink` does.
+ */
+export const consoleLogSink: LogSink = {
+  debug: (message, metadata = {}) => writeToConsole(LogLevel.DEBUG, message, metadata),
+  info: (message, metadata = {}) => writeToConsole(LogLevel.INFO, message, metadata),
+  warn: (message, metadata = {}) => writeToConsole(LogLevel.WARN, message, metadata),
+  error: (message, metadata = {}) => writeToConsole(LogLevel.ERROR, message, metadata),
+};
+
+/**
+ * Runs `fn` with console output replaced by `sink` for every log entry it writes, including from
+ * asynchronous work it starts. Without a sink, those entries are dropped. OpenTelemetry export is
+ * not affected.
+ *
+ * @param sink Receives the log entries; `undefined` silences them.
+ * @param fn The function to run.
+ */
+export function withLogSink<T>(sink: LogSink | undefined, fn: () => T): T {
+  return logSinkScope.run({ sink }, fn);
+}
+
 /**
  * Internal logging function that handles both console and OpenTelemetry output.
  *
- * - Outputs text format logs to console (unless NODE_ENV=test)
+ * - Outputs text format logs to console (unless NODE_ENV=test), or to the sink of an enclosing `withLogSink`
  * - Sends structured logs to OpenTelemetry collector if enabled
  * - Attaches repository context and custom metadata to OTel logs
  *
@@ -36,19 +125,11 @@ interface RepoInfo {
  * @param repoInfo - Optional repository context (name and branch).
  */
 function log(level: LogLevel, message: string, metadata: object = {}, repoInfo?: RepoInfo) {
-  // Silent mode: skip console output in test environment
-  if (appConfig.nodeEnv !== 'test' || appConfig.forceLogging) {
-    // Always output text to console (unless in test mode without SCS_IDXR_FORCE_LOGGING)
-    const timestamp = new Date().toISOString();
-    let logMessage = `[${timestamp}] [${level}] ${message}`;
-    if (metadata && Object.keys(metadata).length > 0) {
-      try {
-        logMessage += ` ${JSON.stringify(metadata)}`;
-      } catch {
-        logMessage += ' [Metadata serialization failed]';
-      }
-    }
-    console.log(logMessage);
+  const scope = logSinkScope.getStore();
+  if (scope) {
+    scope.sink?.[LOG_LEVEL_TO_SINK_METHOD[level]](message, metadata);
+  } else {
+    writeToConsole(level, message, metadata);
   }
 
   // Send to OTel if enabled
@@ -0,0 +1,150 @@
+import yaml from 'js-yaml';
+import { logger } from './logger';
+
+/** Joins the headings of a section path, e.g. `Architecture > Storage > Indexing`. */
+export const HEADING_PATH_SEPARATOR = ' > ';
+
+export interface MarkdownCodeFence {
+  /** Language from the fence info string, e.g. `ts` for a fence opened with ```` ```ts title="a.ts" ````. */
+  language: string;
+  /** 0-based line of the opening fence. */
+  line: number;
+}
+
+export interface MarkdownSection {
+  /** Headings from the top-level heading down to the section's own; empty for text before the first heading. */
+  headingPath: string[];
+  /** 0-based line of the heading, or of the first non-blank line before the first heading. */
+  startLine: number;
+  /** 0-based last non-blank line of the section. */
+  endLine: number;
+  /** Fences with a language inside the section. */
+  codeFences: MarkdownCodeFence[];
+}
+
+export interface MarkdownDocument {
+  /** The YAML front matter, when the document starts with a `---` block that parses to a mapping. */
+  frontMatter?: Record<string, unknown>;
+  sections: MarkdownSection[];
+}
+
+const FRONT_MATTER_OPEN = /^---[ \t]*$/;
+const FRONT_MATTER_CLOSE = /^(?:---|\.\.\.)[ \t]*$/;
+const ATX_HEADING = /^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$/;
+const SETEXT_UNDERLINE = /^ {0,3}(=+|-+)[ \t]*$/;
+const FENCE_OPEN = /^ {0,3}(`{3,}|~{3,})(.*)$/;
+// Lines that cannot be the text of a setext heading: list items, block quotes, tables, headings, and fences
+const NOT_SETEXT_TEXT = /^ {0,3}(?:[-*+>|#`~]|\d+[.)])/;
+
+/**
+ * Splits off YAML front matter (a `---` line, YAML, and a closing `---` or `...` line at the very start).
+ * A block that is not valid YAML or not a mapping is left in the document.
+ *
+ * @returns The front matter and the 0-based line the document body starts at.
+ */
+function parseFrontMatter(lines: string[]): { frontMatter?: Record<string, unknown>; bodyStart: number } {
+  if (lines.length === 0 || !FRONT_MATTER_OPEN.test(lines[0].replace(/^\uFEFF/, ''))) {
+    return { bodyStart: 0 };
+  }
+  const close = lines.findIndex((line, i) => i > 0 && FRONT_MATTER_CLOSE.test(line));
+  if (close === -1) {
+    return { bodyStart: 0 };
+  }
+  try {
+    // JSON_SCHEMA keeps dates as strings, so the values can be stored as-is
+    const parsed = yaml.load(lines.slice(1, close).join('\n'), { schema: yaml.JSON_SCHEMA });
+    if (parsed === null || parsed === undefined) {
+      return { bodyStart: close + 1 };
+    }
+    if (typeof parsed === 'object' && !Array.isArray(parsed)) {
+      return { frontMatter: parsed as Record<string, unknown>, bodyStart: close + 1 };
+    }
+  } catch (error) {
+    logger.debug('Markdown front matter is not valid YAML, indexing it as text', {
+      error: error instanceof Error ? error.message : String(error),
+    });
+  }
+  return { bodyStart: 0 };
+}
+
+function getFenceLanguage(info: string): string | undefined {
+  // Accepts `ts`, `ts title="a.ts"`, `{.python}`, and `{python}`
+  const match = /^\{?\.?([\w#+.-]+)/.exec(info.trim());
+  return match ? match[1].toLowerCase() : undefined;
+}
+
+/**
+ * Splits a Markdown document into sections by its ATX headings (`## Title`) and setext headings (`====` or
+ * `----` under a one-line paragraph). Each section runs from its heading to the next heading of any level;
+ * headings inside code fences are ignored. Text before the first heading is a section with an empty heading path.
+ */
+export function parseMarkdownDocument(content: string): MarkdownDocument {
+  const lines = content.split('\n').map((line) => line.replace(/\r$/, ''));
+  const { frontMatter, bodyStart } = parseFrontMatter(lines);
+
+  const sections: MarkdownSection[] = [];
+  const headings: { level: number; text: string }[] = [];
+  let current: MarkdownSection = { headingPath: [], startLine: bodyStart, endLine: -1, codeFences: [] };
+  let fence: { marker: string } | undefined;
+
+  const startSection = (line: number, level: number, text: string) => {
+    if (current.endLine >= current.startLine) {
+      sections.push(current);
+    }
+    while (headings.length > 0 && headings[headings.length - 1].level >= level) {
+      headings.pop();
+    }
+    headings.push({ level, text });
+    current = { headingPath: headings.map((h) => h.text), startLine: line, endLine: line, codeFences: [] };
+  };
+
+  for (let i = bodyStart; i < lines.length; i++) {
+    const line = lines[i];
+
+    if (fence) {
+      const trimmed = line.trim();
+      if (trimmed.startsWith(fence.marker) && /^(`+|~+)$/.test(trimmed)) {
+        fence = undefined;
+      }
+    } else {
+      const fenceOpen = FENCE_OPEN.exec(line);
+      const atx = ATX_HEADING.exec(line);
+      const setext = SETEXT_UNDERLINE.exec(line);
+      const previous = i > bodyStart ? lines[i - 1] : '';
+      const beforePrevious = i - 1 > bodyStart ? lines[i - 2] : '';
+
+      // A backtick fence's info string cannot contain backticks (that is inline code)
+      if (fenceOpen && !(fenceOpen[1][0] === '`' && fenceOpen[2].includes('`'))) {
+        fence = { marker: fenceOpen[1] };
+        const language = getFenceLanguage(fenceOpen[2]);
+        if (language) {
+          current.codeFences.push({ language, line: i });
+        }
+      } else if (atx && atx[2]?.trim()) {
+        startSection(i, atx[1].length, atx[2].trim());
+        continue;
+      } else if (setext && previous.trim() && !beforePrevious.trim() && !NOT_SETEXT_TEXT.test(previous)) {
+        // The heading text was counted as body of the previous section; move it to the new one
+        current.endLine = i - 2;
+        while (current.endLine >= current.startLine && !lines[current.endLine].trim()) {
+          current.endLine--;
+        }
+        startSection(i - 1, setext[1][0] === '=' ? 1 : 2, previous.trim());
+        current.endLine = i;
+        continue;
+      }
+    }
+
+    if (line.trim()) {
+      if (current.endLine < current.startLine) {
+        current.startLine = i;
+      }
+      current.endLine = i;
+    }
+  }
+  if (current.endLine >= current.startLine) {
+    sections.push(current);
+  }
+
+  return { ...(frontMatter && { frontMatter }), sections };
+}
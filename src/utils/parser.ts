@@ -4,7 +4,7 @@ import fs from 'fs';
 import path from 'path';
 import { createHash } from 'crypto';
 import { execFileSync } from 'child_process';
-import { languageConfigurations, parseLanguageNames } from '../languages';
+import { LanguageName, languageConfigurations, parseLanguageNames } from '../languages';
 import { CodeChunk, SymbolInfo, ExportInfo } from './elasticsearch';
 import { indexingConfig } from '../config';
 import { logger } from './logger';
@@ -17,14 +17,30 @@ import {
   LANG_TEXT,
   LANG_GRADLE,
   LANG_HANDLEBARS,
+  LANG_DOCKERFILE,
+  LANG_MAKEFILE,
+  LANG_RUST,
+  LANG_C,
+  LANG_CPP,
+  LANG_JAVA,
+  LANG_KOTLIN,
+  LANG_SQL,
   PARSER_TYPE_MARKDOWN,
   PARSER_TYPE_YAML,
   PARSER_TYPE_JSON,
   PARSER_TYPE_TEXT,
   PARSER_TYPE_HANDLEBARS,
+  PARSER_TYPE_SQL,
   PARSER_TYPE_TREE_SITTER,
 } from './constants';
 import { isSharedExtensionAllowed } from './shared_extensions';
+import { hasPreprocessorConditionals, maskInactiveBranches } from './c_preprocessor';
+import { addBlame } from './git_blame';
+import { detectLanguage, isBinaryContent, isMinifiedContent, readFileSample } from './language_detection';
+import { HEADING_PATH_SEPARATOR, parseMarkdownDocument } from './markdown';
+import { getSqlStatementVerb, getSqlTableSymbols, splitSqlStatements } from './sql';
+import { ChunkStrategies, parseChunkStrategies } from './chunk_strategy';
+import { TokenCounter, estimateTokens, splitByTokens } from './token_counter';
 
 const { Query } = Parser;
 
@@ -42,6 +58,217 @@ function getGitRoot(cwd: string): string {
   return execFileSync('git', ['rev-parse', '--show-toplevel'], { cwd, env }).toString().trim();
 }
 
+const PYTHON_DEFINITION_TYPES = new Set(['function_definition', 'class_definition', 'decorated_definition']);
+
+/**
+ * Builds the dotted path of classes and functions enclosing a Python definition.
+ *
+ * Python nests bodies in a `block` (and decorated definitions in a `decorated_definition`),
+ * so the immediate parent is never the class itself. A method yields `MyClass`, and a function
+ * nested inside that method yields `MyClass.my_method`.
+ */
+function getPythonContainerPath(node: Parser.SyntaxNode): string {
+  const names: string[] = [];
+  let current = node.parent;
+  while (current) {
+    if (current.type === 'class_definition' || current.type === 'function_definition') {
+      const nameNode = current.childForFieldName('name');
+      if (nameNode) {
+        names.unshift(nameNode.text);
+      }
+    }
+    current = current.parent;
+  }
+  return names.join('.');
+}
+
+/**
+ * Builds the `::`-separated path of modules, traits, impl blocks, and functions enclosing a Rust node.
+ *
+ * A method in `impl Foo` yields `Foo`, so its symbol path is `Foo::method`. A method implementing a
+ * trait yields `<Foo as Display>`, noting the trait it satisfies, and modules prefix the path (`net::Foo`).
+ */
+function getRustContainerPath(node: Parser.SyntaxNode): string {
+  const names: string[] = [];
+  for (let current = node.parent; current; current = current.parent) {
+    if (current.type === 'impl_item') {
+      const typeNode = current.childForFieldName('type');
+      // `impl<T> Foo<T>` is an impl of `Foo`
+      const typeName = (typeNode?.type === 'generic_type' ? typeNode.childForFieldName('type') : typeNode)?.text;
+      const traitName = current.childForFieldName('trait')?.text;
+      if (typeName) {
+        names.unshift(traitName ? `<${typeName} as ${traitName}>` : typeName);
+      }
+    } else if (current.type === 'mod_item' || current.type === 'trait_item' || current.type === 'function_item') {
+      const nameNode = current.childForFieldName('name');
+      if (nameNode) {
+        names.unshift(nameNode.text);
+      }
+    }
+  }
+  return names.join('::');
+}
+
+const C_CONTAINER_TYPES = new Set([
+  'namespace_definition',
+  'class_specifier',
+  'struct_specifier',
+  'union_specifier',
+  'function_definition',
+]);
+
+/**
+ * Returns the name a C or C++ container declares. Function names are found below the declarators they
+ * are wrapped in (`char *name(...)`) and keep their qualification, e.g. `net::Socket::open` for an
+ * out-of-line method. Anonymous namespaces and structs have no name.
+ */
+function getCContainerName(node: Parser.SyntaxNode): string | undefined {
+  if (node.type !== 'function_definition') {
+    return node.childForFieldName('name')?.text;
+  }
+  let declarator = node.childForFieldName('declarator');
+  while (declarator && declarator.type.endsWith('declarator')) {
+    declarator = declarator.childForFieldName('declarator') ?? declarator.namedChildren[0];
+  }
+  return declarator?.text;
+}
+
+/**
+ * Builds the `::`-separated path of namespaces, classes, structs, unions, and functions enclosing a C
+ * or C++ node.
+ *
+ * A method in `class Socket` inside `namespace net` yields `net::Socket`, and so does the out-of-line
+ * definition `void net::Socket::open() {}`, whose qualification names its class.
+ */
+function getCContainerPath(node: Parser.SyntaxNode): string {
+  const names: string[] = [];
+  for (let current = node.parent; current; current = current.parent) {
+    const name = C_CONTAINER_TYPES.has(current.type) ? getCContainerName(current) : undefined;
+    if (name) {
+      names.unshift(name);
+    }
+  }
+  const ownName = C_CONTAINER_TYPES.has(node.type) ? getCContainerName(node) : undefined;
+  const scopeEnd = ownName?.lastIndexOf('::') ?? -1;
+  if (ownName && scopeEnd > 0) {
+    names.push(ownName.slice(0, scopeEnd));
+  }
+  return names.join('::');
+}
+
+const JAVA_CONTAINER_TYPES = new Set([
+  'class_declaration',
+  'interface_declaration',
+  'enum_declaration',
+  'record_declaration',
+  'annotation_type_declaration',
+  'method_declaration',
+  'constructor_declaration',
+]);
+
+/**
+ * Builds the dotted path of the package, types, and methods enclosing a Java node.
+ *
+ * A method in `class Service` of `package com.acme` yields `com.acme.Service`, so its symbol path is
+ * `com.acme.Service.handle`; a top-level class yields the package alone.
+ */
+function getJavaContainerPath(node: Parser.SyntaxNode): string {
+  const names: string[] = [];
+  for (let current = node.parent; current; current = current.parent) {
+    const nameNode = JAVA_CONTAINER_TYPES.has(current.type) ? current.childForFieldName('name') : null;
+    if (nameNode) {
+      names.unshift(nameNode.text);
+    }
+  }
+  const packageName = node.tree.rootNode.namedChildren
+    .find((child) => child.type === 'package_declaration')
+    ?.namedChildren.find((child) => child.type === 'scoped_identifier' || child.type === 'identifier')?.text;
+  if (packageName) {
+    names.unshift(packageName);
+  }
+  return names.join('.');
+}
+
+/**
+ * Returns the name a Kotlin class, object, or function declares. The Kotlin grammar has no `name`
+ * fields: the name is the first `type_identifier` (types) or `simple_identifier` (functions) child,
+ * and companion objects are named `Companion` unless they say otherwise.
+ */
+function getKotlinDeclarationName(node: Parser.SyntaxNode): string | undefined {
+  switch (node.type) {
+    case 'class_declaration':
+    case 'object_declaration':
+      return node.namedChildren.find((child) => child.type === 'type_identifier')?.text;
+    case 'companion_object':
+      return node.namedChildren.find((child) => child.type === 'type_identifier')?.text ?? 'Companion';
+    case 'function_declaration':
+      return node.namedChildren.find((child) => child.type === 'simple_identifier')?.text;
+    default:
+      return undefined;
+  }
+}
+
+/**
+ * Returns the receiver type of a Kotlin extension function (`String` for `fun String.shout()`).
+ */
+function getKotlinReceiverType(node: Parser.SyntaxNode): string | undefined {
+  if (node.type !== 'function_declaration') {
+    return undefined;
+  }
+  for (const child of node.children) {
+    if (child.type === 'simple_identifier' || child.type === 'function_value_parameters') {
+      return undefined;
+    }
+    if (child.type === '.') {
+      return child.previousNamedSibling?.text;
+    }
+  }
+  return undefined;
+}
+
+/**
+ * Builds the dotted path of the package, classes, objects, and functions enclosing a Kotlin node,
+ * like `getJavaContainerPath`. A member of a companion object yields `com.acme.Service.Companion`.
+ */
+function getKotlinContainerPath(node: Parser.SyntaxNode): string {
+  const names: string[] = [];
+  for (let current = node.parent; current; current = current.parent) {
+    const name = getKotlinDeclarationName(current);
+    if (name) {
+      names.unshift(name);
+    }
+  }
+  const packageName = node.tree.rootNode.namedChildren
+    .find((child) => child.type === 'package_header')
+    ?.namedChildren.find((child) => child.type === 'identifier')?.text;
+  if (packageName) {
+    names.unshift(packageName);
+  }
+  return names.join('.');
+}
+
+/**
+ * Returns the earliest of the doc comments and attributes directly above `node` (see
+ * `LanguageConfiguration.leadingDocs`), or `node` itself if there are none.
+ */
+function getLeadingDocsStart(
+  node: Parser.SyntaxNode,
+  leadingDocs: NonNullable<LanguageConfiguration['leadingDocs']>
+): Parser.SyntaxNode {
+  const isLeadingDoc = (sibling: Parser.SyntaxNode) =>
+    leadingDocs.attributeTypes?.includes(sibling.type) ||
+    (sibling.type.includes('comment') && leadingDocs.commentPrefixes.some((prefix) => sibling.text.startsWith(prefix)));
+
+  let start = node;
+  let sibling = node.previousNamedSibling;
+  // A blank line separates a comment from the item below it
+  while (sibling && sibling.endPosition.row >= start.startPosition.row - 1 && isLeadingDoc(sibling)) {
+    start = sibling;
+    sibling = sibling.previousNamedSibling;
+  }
+  return start;
+}
+
 /**
  * Creates a stable identifier for a chunk's content.
  *
@@ -110,14 +337,348 @@ export interface LanguageConfiguration {
   // for the language parser object, making it impractical to type this map statically.
   // eslint-disable-next-line @typescript-eslint/no-explicit-any
   parser: any; // This can be a tree-sitter parser or null for custom parsers
+  /** Exact file names (e.g. `Dockerfile`) that belong to this language whatever their extension. */
+  fileNames?: string[];
+  /** Interpreters (e.g. `python3`) whose shebang line marks an extensionless script as this language. */
+  interpreters?: string[];
+  /**
+   * Grammars that replace `parser` for specific file suffixes, e.g. the TSX dialect for `.tsx`.
+   * The same queries are compiled against them, so each must be a superset of `parser`.
+   */
+  // eslint-disable-next-line @typescript-eslint/no-explicit-any
+  suffixParsers?: Record<string, any>;
   queries: string[];
+  /**
+   * Doc comments (starting with one of `commentPrefixes`) and attributes directly above a captured
+   * node, such as Rust `///` docs and `#[derive]` attributes. They become part of that node's chunk,
+   * so the docs are found together with the code they describe.
+   */
+  leadingDocs?: { commentPrefixes: string[]; attributeTypes?: string[] };
   importQueries?: string[];
   symbolQueries?: string[];
   exportQueries?: string[];
+  /** Node types of string literals, searched for SQL queries when `ChunkOptions.extractEmbeddedSql` is set. */
+  stringLiteralTypes?: string[];
+}
+
+/**
+ * Returns the tree-sitter grammar used to parse a file, honoring per-suffix overrides.
+ */
+// eslint-disable-next-line @typescript-eslint/no-explicit-any
+export function getTreeSitterLanguage(langConfig: LanguageConfiguration, filePath: string): any {
+  return langConfig.suffixParsers?.[path.extname(filePath)] ?? langConfig.parser;
+}
+
+/**
+ * Controls how code chunks are cut: how oversized functions and methods are split into overlapping
+ * windows, and which file context is added to each chunk.
+ */
+export interface ChunkOptions {
+  /** Symbols longer than this many lines are split into windows of this size; 0 disables splitting. */
+  maxLines: number;
+  /** Number of lines shared by consecutive windows. */
+  overlapLines: number;
+  /**
+   * Adds the file's imports (and Go package name) to the `semantic_text` of each code chunk, see
+   * `CodeChunk.importContext`. Off by default since it makes every chunk larger to embed.
+   */
+  includeImports: boolean;
+  /**
+   * Records the last commit of each chunk's lines in `CodeChunk.blame`, from one `git blame` per file.
+   * Off by default since blaming a file takes far longer than parsing it.
+   */
+  includeBlame: boolean;
+  /**
+   * Files larger than this many bytes are skipped without being read, so generated code and committed
+   * artifacts do not slow indexing down.
+   */
+  maxFileBytes: number;
+  /**
+   * Indexes SQL queries in string literals as `sql` chunks of their own, linked to the function they are
+   * in, for the languages that list their `stringLiteralTypes`. Off by default since the queries are also
+   * indexed as part of their function.
+   */
+  extractEmbeddedSql: boolean;
+  /**
+   * The chunk strategy of each language, e.g. `{ json: 'whole-file' }`; languages left out are chunked
+   * the way their language does, see `CHUNK_STRATEGIES`.
+   */
+  perLanguage: ChunkStrategies;
+  /**
+   * Chunks whose `semantic_text` has more tokens than this are split at line breaks, so that no chunk is
+   * cut off by the embedding model's input limit; 0 disables the check. A single line over the budget is
+   * truncated, with a warning naming its file and line.
+   */
+  maxTokens: number;
+  /** Counts the tokens `maxTokens` limits, `estimateTokens` by default. */
+  countTokens: TokenCounter;
+}
+
+/**
+ * Returns the name Go code refers to an import by: its alias, else the last path element without a
+ * major version (`github.com/go-yaml/yaml/v3` and `gopkg.in/yaml.v3` are both `yaml`).
+ */
+export function getGoImportName(importPath: string, alias?: string): string {
+  if (alias) {
+    return alias;
+  }
+  const elements = importPath.split('/');
+  let name = elements[elements.length - 1];
+  if (/^v\d+$/.test(name) && elements.length > 1) {
+    name = elements[elements.length - 2];
+  }
+  return name.replace(/\.v\d+$/, '');
+}
+
+interface FileImportContext {
+  packageName?: string;
+  /** Import paths, with the name they are referred to by for Go. */
+  imports: { path: string; name?: string }[];
+}
+
+function getFileImportContext(
+  langConfig: LanguageConfiguration,
+  root: Parser.SyntaxNode,
+  importsByLine: { [line: number]: { path: string }[] }
+): FileImportContext {
+  if (langConfig.name !== 'go') {
+    const paths = new Set(Object.values(importsByLine).flatMap((entries) => entries.map((entry) => entry.path)));
+    return { imports: Array.from(paths, (importPath) => ({ path: importPath })) };
+  }
+  const packageName = root.descendantsOfType('package_clause')[0]?.namedChildren[0]?.text;
+  const imports = root.descendantsOfType('import_spec').flatMap((spec) => {
+    const importPath = spec.childForFieldName('path')?.text.replace(/["`]/g, '');
+    const alias = spec.childForFieldName('name')?.text;
+    // Blank imports are only there for their side effects
+    if (!importPath || alias === '_') {
+      return [];
+    }
+    return [{ path: importPath, name: getGoImportName(importPath, alias) }];
+  });
+  return { ...(packageName && { packageName }), imports };
+}
+
+/**
+ * Picks the imports relevant to one chunk. Go imports are narrowed to the packages the chunk
+ * references (`http.Get` keeps `http=net/http`) so the header resolves them; other languages keep
+ * all of the file's imports.
+ */
+function getChunkImportContext(
+  fileContext: FileImportContext,
+  content: string
+): NonNullable<CodeChunk['importContext']> | undefined {
+  const imports = fileContext.imports.flatMap(({ path: importPath, name }) => {
+    // Dot imports are used unqualified
+    if (name === undefined || name === '.') {
+      return [importPath];
+    }
+    if (!new RegExp(`\\b${name}\\.`).test(content)) {
+      return [];
+    }
+    return [name === importPath ? importPath : `${name}=${importPath}`];
+  });
+  if (imports.length === 0 && !fileContext.packageName) {
+    return undefined;
+  }
+  return { ...(fileContext.packageName && { packageName: fileContext.packageName }), imports };
+}
+
+interface ChunkWindow {
+  content: string;
+  /** Line `content` starts with that is not part of the lines the window covers, see `splitIntoWindows`. */
+  header?: string;
+  startLine: number;
+  endLine: number;
+  startIndex: number;
+  endIndex: number;
+}
+
+/** Function-like node kinds whose bodies are split into windows when they exceed `ChunkOptions.maxLines`. */
+const WINDOWED_SYMBOL_TYPES = new Set([
+  'function_declaration',
+  'function_item',
+  'generator_function_declaration',
+  'function_definition',
+  'method_definition',
+  'method_declaration',
+  'constructor_declaration',
+  'variable_declarator',
+]);
+
+const FUNCTION_VALUE_TYPES = new Set(['arrow_function', 'function_expression']);
+
+/**
+ * Counts the ERROR and MISSING nodes below `node`.
+ */
+function countSyntaxErrors(node: Parser.SyntaxNode): number {
+  if (node.type === 'ERROR' || node.isMissing) {
+    return 1;
+  }
+  return node.hasError ? node.children.reduce((count, child) => count + countSyntaxErrors(child), 0) : 0;
+}
+
+/**
+ * Returns the 1-based line of the first ERROR or MISSING node below `node`, in document order.
+ */
+function findSyntaxError(node: Parser.SyntaxNode): number | undefined {
+  if (node.type === 'ERROR' || node.isMissing) {
+    return node.startPosition.row + 1;
+  }
+  if (node.hasError) {
+    for (const child of node.children) {
+      const line = findSyntaxError(child);
+      if (line !== undefined) {
+        return line;
+      }
+    }
+  }
+  return undefined;
+}
+
+function isWindowedSymbol(node: Parser.SyntaxNode): boolean {
+  if (WINDOWED_SYMBOL_TYPES.has(node.type)) {
+    return node.type !== 'variable_declarator' || FUNCTION_VALUE_TYPES.has(node.childForFieldName('value')?.type ?? '');
+  }
+  if (node.type === 'lexical_declaration') {
+    // `const handler = async () => { ... }`
+    return node.namedChildren.some(
+      (child) =>
+        child.type === 'variable_declarator' && FUNCTION_VALUE_TYPES.has(child.childForFieldName('value')?.type ?? '')
+    );
+  }
+  if (node.type === 'decorated_definition') {
+    return node.childForFieldName('definition')?.type === 'function_definition';
+  }
+  return false;
+}
+
+/**
+ * Finds the name of a function-like node, following the declarators C and C++ wrap names in
+ * (`function_definition > function_declarator > identifier`). Kotlin names are unfielded
+ * `simple_identifier` children.
+ */
+function getSymbolName(node: Parser.SyntaxNode): string | undefined {
+  let current: Parser.SyntaxNode | null | undefined = node;
+  while (current) {
+    const name = current.childForFieldName('name');
+    if (name) {
+      return name.text;
+    }
+    if (current.namedChildCount === 0) {
+      return current.text;
+    }
+    current =
+      current.childForFieldName('declarator') ??
+      current.childForFieldName('definition') ??
+      current.namedChildren.find((child) => child.type === 'variable_declarator' || child.type === 'simple_identifier');
+  }
+  return undefined;
+}
+
+/** Finds the function or method a node is in, the innermost one for nested functions. */
+function findEnclosingFunction(node: Parser.SyntaxNode): Parser.SyntaxNode | undefined {
+  for (let current = node.parent; current; current = current.parent) {
+    if (isWindowedSymbol(current)) {
+      return current;
+    }
+  }
+  return undefined;
+}
+
+/**
+ * Returns the value of a string literal without its prefix and quotes (`r"""…"""`, `` `…` ``), and the
+ * offset of the value in the literal. Escape sequences are kept as they are written.
+ */
+function getStringLiteralValue(literal: string): { value: string; offset: number } {
+  const quote = literal.match(/^\w*("""|'''|["'`])/);
+  if (!quote) {
+    return { value: literal, offset: 0 };
+  }
+  const offset = quote[0].length;
+  const closed = literal.length >= offset + quote[1].length && literal.endsWith(quote[1]);
+  return { value: literal.slice(offset, closed ? literal.length - quote[1].length : literal.length), offset };
+}
+
+function wholeNodeWindow(content: string, startLine: number, startIndex: number): ChunkWindow {
+  return {
+    content,
+    startLine,
+    endLine: startLine + content.split('\n').length - 1,
+    startIndex,
+    endIndex: startIndex + content.length,
+  };
+}
+
+/**
+ * Splits a symbol longer than `options.maxLines` into windows of that many lines, with
+ * `options.overlapLines` lines shared between consecutive windows.
+ *
+ * Every window after the first is prefixed with the symbol's first line (usually its signature), so
+ * each window still says which function it belongs to. Line numbers refer to the source lines a window
+ * covers, not counting the prefixed header.
+ */
+function splitIntoWindows(
+  content: string,
+  startLine: number,
+  startIndex: number,
+  options: ChunkOptions
+): ChunkWindow[] {
+  const lines = content.split('\n');
+  if (options.maxLines === 0 || lines.length <= options.maxLines) {
+    return [wholeNodeWindow(content, startLine, startIndex)];
+  }
+
+  const step = Math.max(1, options.maxLines - options.overlapLines); // Prevent negative or zero steps
+  const lineOffsets: number[] = [];
+  let offset = 0;
+  for (const line of lines) {
+    lineOffsets.push(offset);
+    offset += line.length + 1;
+  }
+
+  const windows: ChunkWindow[] = [];
+  for (let start = 0; start < lines.length; start += step) {
+    const end = Math.min(start + options.maxLines, lines.length);
+    const body = lines.slice(start, end).join('\n');
+    windows.push({
+      content: start === 0 ? body : `${lines[0]}\n${body}`,
+      ...(start > 0 && { header: lines[0] }),
+      startLine: startLine + start,
+      endLine: startLine + end - 1,
+      startIndex: startIndex + lineOffsets[start],
+      endIndex: startIndex + lineOffsets[start] + body.length,
+    });
+    if (end === lines.length) {
+      break;
+    }
+  }
+  return windows;
+}
+
+/**
+ * Why a file was chunked as plain text instead of with its tree-sitter grammar.
+ */
+export interface ParseFallback {
+  error: string;
+  /** 1-based line of the first syntax error, when tree-sitter reported one. */
+  line?: number;
+}
+
+/** Why a file was left out of the index without being parsed. */
+export type SkipReason = 'too-large' | 'binary' | 'minified';
+
+export interface ParseSkip {
+  reason: SkipReason;
+  /** Human-readable explanation, e.g. the size and the limit it exceeds. */
+  message: string;
 }
 
 export interface ParseResult {
   chunks: CodeChunk[];
+  /** Set when tree-sitter failed on the file and it was chunked as plain text instead. */
+  fallback?: ParseFallback;
+  /** Set when the file was left out on purpose; `chunks` is then empty. */
+  skipped?: ParseSkip;
   metrics: {
     filesProcessed: number;
     filesFailed: number;
@@ -136,6 +697,8 @@ interface FileMetadata {
 }
 
 interface ChunkParams {
+  /** Defaults to `doc`. */
+  type?: CodeChunk['type'];
   content: string;
   language: string;
   relativePath: string;
@@ -146,6 +709,10 @@ interface ChunkParams {
   startIndex: number;
   endIndex: number;
   timestamp: string;
+  kind?: string;
+  containerPath?: string;
+  symbols?: SymbolInfo[];
+  frontMatter?: Record<string, unknown>;
 }
 
 /**
@@ -165,7 +732,16 @@ export class LanguageParser {
   private languages: Map<string, LanguageConfiguration>;
   public fileSuffixMap: Map<string, LanguageConfiguration>;
 
-  constructor(languages?: string) {
+  private readonly chunkOptions: Partial<ChunkOptions>;
+
+  /**
+   * @param languages Comma-separated language names (defaults to all supported languages).
+   * @param chunkOptions Overrides for symbol windowing, import context, blame, the file size limit,
+   *   embedded SQL, the chunk strategy of each language, and the token budget; unset values come from
+   *   `indexingConfig`.
+   */
+  constructor(languages?: string, chunkOptions: Partial<ChunkOptions> = {}) {
+    this.chunkOptions = chunkOptions;
     this.languages = new Map();
     this.fileSuffixMap = new Map();
     const languageNames = parseLanguageNames(languages);
@@ -186,9 +762,37 @@ export class LanguageParser {
     }
   }
 
-  private getLanguageConfigForFile(filePath: string): LanguageConfiguration | undefined {
-    const fileExt = path.extname(filePath);
-    return this.fileSuffixMap.get(fileExt);
+  private getChunkOptions(): ChunkOptions {
+    return {
+      maxLines: this.chunkOptions.maxLines ?? indexingConfig.symbolChunkMaxLines,
+      overlapLines: this.chunkOptions.overlapLines ?? indexingConfig.symbolChunkOverlapLines,
+      includeImports: this.chunkOptions.includeImports ?? indexingConfig.includeImports,
+      includeBlame: this.chunkOptions.includeBlame ?? indexingConfig.includeBlame,
+      maxFileBytes: this.chunkOptions.maxFileBytes ?? indexingConfig.maxFileBytes,
+      extractEmbeddedSql: this.chunkOptions.extractEmbeddedSql ?? indexingConfig.extractEmbeddedSql,
+      perLanguage: this.chunkOptions.perLanguage ?? parseChunkStrategies(indexingConfig.chunkStrategies ?? []),
+      maxTokens: this.chunkOptions.maxTokens ?? indexingConfig.maxChunkTokens,
+      countTokens: this.chunkOptions.countTokens ?? estimateTokens,
+    };
+  }
+
+  /**
+   * Returns the enabled language of a file, see `detectLanguage`. A detected language that is not
+   * enabled falls back to the language registered for the extension, then to `text`.
+   * @param filePath - Absolute path to the file; its first bytes are read unless `sample` holds them
+   * @returns The language configuration, or undefined for binary and unsupported files
+   */
+  public getLanguageConfigForFile(
+    filePath: string,
+    sample: Buffer = readFileSample(filePath)
+  ): LanguageConfiguration | undefined {
+    const detected = detectLanguage(filePath, sample);
+    if (!detected) {
+      return undefined;
+    }
+    return (
+      this.languages.get(detected) ?? this.fileSuffixMap.get(path.extname(filePath)) ?? this.languages.get(LANG_TEXT)
+    );
   }
 
   /**
@@ -228,8 +832,9 @@ export class LanguageParser {
    * @returns Complete CodeChunk object with semantic_text
    */
   private createChunk(params: ChunkParams): CodeChunk {
+    const type = params.type ?? CHUNK_TYPE_DOC;
     const chunkHash = createChunkHash({
-      type: CHUNK_TYPE_DOC,
+      type,
       language: params.language,
       relativePath: params.relativePath,
       gitBranch: params.gitBranch,
@@ -243,8 +848,12 @@ export class LanguageParser {
     const directoryInfo = extractDirectoryInfo(params.relativePath);
 
     const baseChunk: Omit<CodeChunk, 'semantic_text' | 'code_vector'> = {
-      type: CHUNK_TYPE_DOC,
+      type,
       language: params.language,
+      ...(params.kind !== undefined && { kind: params.kind }),
+      ...(params.containerPath !== undefined && { containerPath: params.containerPath }),
+      ...(params.symbols !== undefined && { symbols: params.symbols }),
+      ...(params.frontMatter !== undefined && { frontMatter: params.frontMatter }),
       filePath: params.relativePath,
       ...directoryInfo,
       git_file_hash: params.gitFileHash,
@@ -360,10 +969,41 @@ export class LanguageParser {
     return { chunks, chunksSkipped };
   }
 
+  /**
+   * Logs why a file is left out of the index and returns the result reporting it.
+   */
+  private skipFile(filePath: string, skipped: ParseSkip, language: string = ''): ParseResult {
+    logger.warn(`Skipping ${filePath}: ${skipped.message}`);
+    return { chunks: [], skipped, metrics: { ...BASE_PARSER_METRIC_DATA, language } };
+  }
+
+  /**
+   * Parses a file into chunks with the parser of its language.
+   *
+   * Files larger than `maxFileBytes` and binary files (a NUL byte in the first bytes) are skipped and
+   * reported in `skipped`. Minified code (see `isMinifiedContent`) is indexed as one whole-file chunk
+   * instead of being parsed, or skipped when that chunk would be larger than `maxChunkSizeBytes` or have
+   * more tokens than `maxTokens`.
+   * Languages given a `whole-file` or `fixed-window` strategy in `perLanguage` are chunked that way
+   * instead of by their parser.
+   */
   public parseFile(filePath: string, gitBranch: string, relativePath: string): ParseResult {
-    const langConfig = this.getLanguageConfigForFile(filePath);
+    const size = fs.statSync(filePath).size;
+    const { maxFileBytes, perLanguage } = this.getChunkOptions();
+    if (size > maxFileBytes) {
+      return this.skipFile(filePath, {
+        reason: 'too-large',
+        message: `larger than maxFileBytes (${size} > ${maxFileBytes})`,
+      });
+    }
+    const sample = readFileSample(filePath);
+    if (isBinaryContent(sample)) {
+      return this.skipFile(filePath, { reason: 'binary', message: 'binary content' });
+    }
+
+    const langConfig = this.getLanguageConfigForFile(filePath, sample);
     if (!langConfig) {
-      console.warn(`Unsupported file type: ${path.extname(filePath)}`);
+      logger.warn(`Unsupported file type: ${path.extname(filePath) || path.basename(filePath)}`);
       return {
         chunks: [],
         metrics: { ...BASE_PARSER_METRIC_DATA },
@@ -374,11 +1014,50 @@ export class LanguageParser {
       ...BASE_PARSER_METRIC_DATA,
       language: langConfig.name,
     };
+    const strategy = perLanguage[langConfig.name as LanguageName] ?? 'symbol';
 
     try {
       let chunks: CodeChunk[];
-
-      if (langConfig.parser === null) {
+      let fallback: ParseFallback | undefined;
+
+      if (langConfig.parser !== null && isMinifiedContent(sample)) {
+        // Tree-sitter and line windows would cut a bundle into a few huge, meaningless lines
+        if (size > indexingConfig.maxChunkSizeBytes) {
+          return this.skipFile(
+            filePath,
+            {
+              reason: 'minified',
+              message: `minified and larger than maxChunkSizeBytes (${size} > ${indexingConfig.maxChunkSizeBytes})`,
+            },
+            langConfig.name
+          );
+        }
+        const result = this.parseWholeFile(filePath, gitBranch, relativePath, langConfig.name);
+        // A bundle is one line, which the token budget could only truncate to its first tokens
+        const { maxTokens, countTokens } = this.getChunkOptions();
+        const tokens = Math.max(0, ...result.chunks.map((chunk) => countTokens(chunk.semantic_text)));
+        if (maxTokens !== 0 && tokens > maxTokens) {
+          return this.skipFile(
+            filePath,
+            {
+              reason: 'minified',
+              message: `minified and longer than maxChunkTokens (${tokens} > ${maxTokens} tokens)`,
+            },
+            langConfig.name
+          );
+        }
+        chunks = result.chunks;
+        metricData.chunksSkipped += result.chunksSkipped;
+        metricData.parserType = PARSER_TYPE_TEXT;
+      } else if (strategy === 'whole-file' || strategy === 'fixed-window') {
+        const result =
+          strategy === 'whole-file'
+            ? this.parseWholeFile(filePath, gitBranch, relativePath, langConfig.name)
+            : this.parseByLines(filePath, gitBranch, relativePath, langConfig.name);
+        chunks = result.chunks;
+        metricData.chunksSkipped += result.chunksSkipped;
+        metricData.parserType = PARSER_TYPE_TEXT;
+      } else if (langConfig.parser === null) {
         if (langConfig.name === LANG_MARKDOWN) {
           const result = this.parseMarkdown(filePath, gitBranch, relativePath);
           chunks = result.chunks;
@@ -404,21 +1083,49 @@ export class LanguageParser {
           chunks = result.chunks;
           metricData.chunksSkipped += result.chunksSkipped;
           metricData.parserType = PARSER_TYPE_TEXT;
+        } else if (langConfig.name === LANG_DOCKERFILE || langConfig.name === LANG_MAKEFILE) {
+          const result = this.parseText(filePath, gitBranch, relativePath, langConfig.name);
+          chunks = result.chunks;
+          metricData.chunksSkipped += result.chunksSkipped;
+          metricData.parserType = PARSER_TYPE_TEXT;
+        } else if (langConfig.name === LANG_SQL) {
+          const result = this.parseSql(filePath, gitBranch, relativePath);
+          chunks = result.chunks;
+          metricData.chunksSkipped += result.chunksSkipped;
+          metricData.parserType = PARSER_TYPE_SQL;
         } else {
           chunks = [];
         }
       } else {
-        const result = this.parseWithTreeSitter(filePath, gitBranch, relativePath, langConfig);
-        chunks = result.chunks;
-        metricData.chunksSkipped += result.chunksSkipped;
-        metricData.parserType = PARSER_TYPE_TREE_SITTER;
+        try {
+          const result = this.parseWithTreeSitter(filePath, gitBranch, relativePath, langConfig);
+          chunks = result.chunks;
+          metricData.chunksSkipped += result.chunksSkipped;
+          metricData.parserType = PARSER_TYPE_TREE_SITTER;
+        } catch (error) {
+          // A file the grammar cannot handle is still worth indexing, just without symbol-level chunks
+          fallback = {
+            error: error instanceof Error ? error.message : String(error),
+            line: this.findSyntaxErrorLine(filePath, langConfig),
+          };
+          logger.warn(`Tree-sitter failed to parse ${filePath}; falling back to text chunking`, { ...fallback });
+          const result = this.parseText(filePath, gitBranch, relativePath, langConfig.name);
+          chunks = result.chunks;
+          metricData.chunksSkipped += result.chunksSkipped;
+          metricData.parserType = PARSER_TYPE_TEXT;
+        }
+      }
+
+      chunks = this.enforceTokenBudget(chunks, relativePath);
+      if (this.getChunkOptions().includeBlame) {
+        chunks = addBlame(chunks, filePath);
       }
 
       metricData.filesProcessed = 1;
       metricData.chunksCreated = chunks.length;
       metricData.chunkSizes = chunks.map((c) => Buffer.byteLength(c.content, 'utf8'));
 
-      return { chunks, metrics: metricData };
+      return fallback ? { chunks, fallback, metrics: metricData } : { chunks, metrics: metricData };
     } catch (error) {
       logger.error(`Failed to parse file ${filePath}:`, error instanceof Error ? error : new Error(String(error)));
       metricData.filesFailed = 1;
@@ -494,12 +1201,14 @@ export class LanguageParser {
    * @param filePath - Absolute path to the file
    * @param gitBranch - Git branch name
    * @param relativePath - Relative path from repository root
+   * @param language - Language name for the chunks
    * @returns Object with chunks array and chunksSkipped count
    */
   private parseText(
     filePath: string,
     gitBranch: string,
-    relativePath: string
+    relativePath: string,
+    language: string = LANG_TEXT
   ): { chunks: CodeChunk[]; chunksSkipped: number } {
     const { content } = this.readFileWithMetadata(filePath);
 
@@ -507,7 +1216,7 @@ export class LanguageParser {
     const hasParagraphs = /\n\s*\n/.test(content);
 
     if (hasParagraphs) {
-      const result = this.parseParagraphs(filePath, gitBranch, relativePath, LANG_TEXT);
+      const result = this.parseParagraphs(filePath, gitBranch, relativePath, language);
       // If paragraphs produced valid chunks, use them
       if (result.chunks.length > 0) {
         return result;
@@ -515,13 +1224,15 @@ export class LanguageParser {
     }
 
     // Fallback to line-based
-    return this.parseByLines(filePath, gitBranch, relativePath, LANG_TEXT);
+    return this.parseByLines(filePath, gitBranch, relativePath, language);
   }
 
   /**
-   * Parses Markdown files by splitting content into chunks based on configured delimiter.
-   * Each chunk represents a logical section separated by the delimiter.
-   * The delimiter can be configured via SCS_IDXR_MARKDOWN_CHUNK_DELIMITER environment variable.
+   * Parses Markdown files into one chunk per section, see `parseMarkdownDocument`.
+   * A section chunk records its heading path (`Architecture > Storage`) as a `section.name` symbol and the
+   * path of its parent headings as `containerPath`; fenced code keeps its text and is tagged with a
+   * `code.language` symbol. YAML front matter is stored in `frontMatter` of every chunk instead of being
+   * embedded. When SCS_IDXR_MARKDOWN_CHUNK_DELIMITER is set, files are split by that delimiter instead.
    *
    * @param filePath - Absolute path to the file
    * @param gitBranch - Git branch name
@@ -533,13 +1244,65 @@ export class LanguageParser {
     gitBranch: string,
     relativePath: string
   ): { chunks: CodeChunk[]; chunksSkipped: number } {
-    return this.parseParagraphs(
-      filePath,
-      gitBranch,
-      relativePath,
-      LANG_MARKDOWN,
-      indexingConfig.markdownChunkDelimiter
-    );
+    const delimiter = indexingConfig.markdownChunkDelimiter;
+    if (delimiter !== undefined) {
+      return this.parseParagraphs(filePath, gitBranch, relativePath, LANG_MARKDOWN, delimiter);
+    }
+
+    const { content, gitFileHash, timestamp } = this.readFileWithMetadata(filePath);
+    const { frontMatter, sections } = parseMarkdownDocument(content);
+    const lines = content.split('\n');
+    const lineOffsets: number[] = [];
+    lines.reduce((offset, line) => {
+      lineOffsets.push(offset);
+      return offset + line.length + 1;
+    }, 0);
+
+    const chunks: CodeChunk[] = [];
+    let chunksSkipped = 0;
+    for (const section of sections) {
+      const sectionContent = lines.slice(section.startLine, section.endLine + 1).join('\n');
+      if (!this.validateChunkSize(sectionContent, filePath)) {
+        chunksSkipped++;
+        continue;
+      }
+      if (!/[a-zA-Z0-9]/.test(sectionContent)) {
+        continue;
+      }
+
+      const symbols: SymbolInfo[] = section.codeFences.map(({ language, line }) => ({
+        name: language,
+        kind: 'code.language',
+        line: line + 1,
+      }));
+      if (section.headingPath.length > 0) {
+        const name = section.headingPath.join(HEADING_PATH_SEPARATOR);
+        symbols.unshift({ name, kind: 'section.name', line: section.startLine + 1 });
+      }
+
+      chunks.push(
+        this.createChunk({
+          content: sectionContent,
+          language: LANG_MARKDOWN,
+          relativePath,
+          gitFileHash,
+          gitBranch,
+          startLine: section.startLine + 1,
+          endLine: section.endLine + 1,
+          startIndex: lineOffsets[section.startLine],
+          endIndex: lineOffsets[section.startLine] + sectionContent.length,
+          timestamp,
+          kind: 'section',
+          ...(section.headingPath.length > 1 && {
+            containerPath: section.headingPath.slice(0, -1).join(HEADING_PATH_SEPARATOR),
+          }),
+          ...(symbols.length > 0 && { symbols }),
+          ...(frontMatter && { frontMatter }),
+        })
+      );
+    }
+
+    return { chunks, chunksSkipped };
   }
 
   /**
@@ -593,6 +1356,68 @@ export class LanguageParser {
     return this.parseByLines(filePath, gitBranch, relativePath, LANG_JSON);
   }
 
+  /**
+   * Parses SQL scripts into one code chunk per statement, see `splitSqlStatements`. A chunk's kind is
+   * the statement's first keyword (`create_statement`, `update_statement`), and the tables it names are
+   * recorded as `table.name` and `table.reference` symbols.
+   *
+   * @param filePath - Absolute path to the file
+   * @param gitBranch - Git branch name
+   * @param relativePath - Relative path from repository root
+   * @returns Object with chunks array and chunksSkipped count
+   */
+  private parseSql(
+    filePath: string,
+    gitBranch: string,
+    relativePath: string
+  ): { chunks: CodeChunk[]; chunksSkipped: number } {
+    const { content, gitFileHash, timestamp } = this.readFileWithMetadata(filePath);
+    const chunks: CodeChunk[] = [];
+    let chunksSkipped = 0;
+    for (const statement of splitSqlStatements(content)) {
+      if (!this.validateChunkSize(statement.text, filePath)) {
+        chunksSkipped++;
+        continue;
+      }
+      const startLine = (content.slice(0, statement.start).match(/\n/g) ?? []).length + 1;
+      const symbols = getSqlTableSymbols(statement.text, startLine);
+      chunks.push(
+        this.createChunk({
+          type: CHUNK_TYPE_CODE,
+          content: statement.text,
+          language: LANG_SQL,
+          relativePath,
+          gitFileHash,
+          gitBranch,
+          startLine,
+          endLine: startLine + (statement.text.match(/\n/g) ?? []).length,
+          startIndex: statement.start,
+          endIndex: statement.start + statement.text.length,
+          timestamp,
+          kind: `${statement.keyword}_statement`,
+          ...(symbols.length > 0 && { symbols }),
+        })
+      );
+    }
+    return { chunks, chunksSkipped };
+  }
+
+  /**
+   * Finds the first syntax error tree-sitter reports for a file, to point at the likely cause of a failed parse.
+   * @returns 1-based line number, or undefined if the file parses cleanly or cannot be parsed at all
+   */
+  private findSyntaxErrorLine(filePath: string, langConfig: LanguageConfiguration): number | undefined {
+    try {
+      const parser = new Parser();
+      parser.setLanguage(getTreeSitterLanguage(langConfig, filePath));
+      const tree = parser.parse(fs.readFileSync(filePath, 'utf8'));
+      return findSyntaxError(tree.rootNode);
+    } catch {
+      // The parse itself failed, so there is no tree to inspect
+    }
+    return undefined;
+  }
+
   private parseWithTreeSitter(
     filePath: string,
     gitBranch: string,
@@ -600,12 +1425,29 @@ export class LanguageParser {
     langConfig: LanguageConfiguration
   ): { chunks: CodeChunk[]; chunksSkipped: number } {
     const now = new Date().toISOString();
+    const language = getTreeSitterLanguage(langConfig, filePath);
     const parser = new Parser();
-    parser.setLanguage(langConfig.parser);
+    parser.setLanguage(language);
 
     const sourceCode = fs.readFileSync(filePath, 'utf8');
-    const tree = parser.parse(sourceCode);
-    const query = new Query(langConfig.parser, langConfig.queries.join('\n'));
+    let tree = parser.parse(sourceCode);
+    let masked = false;
+    if (
+      (langConfig.name === LANG_C || langConfig.name === LANG_CPP) &&
+      tree.rootNode.hasError &&
+      hasPreprocessorConditionals(sourceCode)
+    ) {
+      // Braces that only balance per #if branch break the parse; parse one variant of the code instead
+      const maskedTree = parser.parse(maskInactiveBranches(sourceCode, langConfig.name));
+      if (countSyntaxErrors(maskedTree.rootNode) < countSyntaxErrors(tree.rootNode)) {
+        tree = maskedTree;
+        masked = true;
+      }
+    }
+    // Positions are the same in the masked variant, so chunk content is read from the original source
+    const nodeText = (node: Parser.SyntaxNode) =>
+      masked ? sourceCode.slice(node.startIndex, node.endIndex) : node.text;
+    const query = new Query(language, langConfig.queries.join('\n'));
     const matches = query.matches(tree.rootNode);
     // Use execFileSync to prevent shell injection from special characters in file paths
     const gitFileHash = execFileSync('git', ['hash-object', filePath]).toString().trim();
@@ -625,7 +1467,7 @@ export class LanguageParser {
 
     const importsByLine: { [line: number]: { path: string; type: 'module' | 'file'; symbols?: string[] }[] } = {};
     if (langConfig.importQueries) {
-      const importQuery = new Query(langConfig.parser, langConfig.importQueries.join('\n'));
+      const importQuery = new Query(language, langConfig.importQueries.join('\n'));
       const importMatches = importQuery.matches(tree.rootNode);
 
       for (const match of importMatches) {
@@ -680,7 +1522,7 @@ export class LanguageParser {
 
     const symbolsByLine: { [line: number]: SymbolInfo[] } = {};
     if (langConfig.symbolQueries) {
-      const symbolQuery = new Query(langConfig.parser, langConfig.symbolQueries.join('\n'));
+      const symbolQuery = new Query(language, langConfig.symbolQueries.join('\n'));
       const symbolMatches = symbolQuery.matches(tree.rootNode);
       for (const m of symbolMatches) {
         const capture = m.captures[0];
@@ -702,7 +1544,7 @@ export class LanguageParser {
     if (langConfig.name === 'python') {
       try {
         const allQuery = new Query(
-          langConfig.parser,
+          language,
           '(assignment left: (identifier) @all_name (#eq? @all_name "__all__") right: (list) @all_list)'
         );
         const allMatches = allQuery.matches(tree.rootNode);
@@ -743,7 +1585,7 @@ export class LanguageParser {
 
     const exportsByLine: { [line: number]: ExportInfo[] } = {};
     if (langConfig.exportQueries) {
-      const exportQuery = new Query(langConfig.parser, langConfig.exportQueries.join('\n'));
+      const exportQuery = new Query(language, langConfig.exportQueries.join('\n'));
       const exportMatches = exportQuery.matches(tree.rootNode);
 
       for (const match of exportMatches) {
@@ -756,15 +1598,16 @@ export class LanguageParser {
             exportName = capture.node.text;
           } else if (capture.name === EXPORT_CAPTURE_NAMES.DEFAULT) {
             exportType = 'default';
-            // For default exports like "export default MyClass", traverse AST to find the identifier being exported
+            // For default exports like "export default MyClass", traverse AST to find the identifier being exported.
+            // "export default function App() {}" names its declaration instead, and anonymous default exports
+            // ("export default () => {}") are recorded under the name "default".
             const parent = capture.node.parent;
             if (parent) {
               const identifierNode = parent.children.find(
                 (child) => child.type === 'identifier' || child.type === 'type_identifier'
               );
-              if (identifierNode) {
-                exportName = identifierNode.text;
-              }
+              const declarationName = parent.childForFieldName('declaration')?.childForFieldName('name');
+              exportName = identifierNode?.text ?? declarationName?.text ?? 'default';
             }
           } else if (capture.name === EXPORT_CAPTURE_NAMES.NAMESPACE) {
             exportType = 'namespace';
@@ -849,26 +1692,96 @@ export class LanguageParser {
 
     const uniqueMatches = Array.from(
       new Map(
-        matches.map((match) => {
-          const node = match.captures[0].node;
-          return [`${node.startIndex}-${node.endIndex}`, match];
-        })
+        matches
+          // A decorated definition is chunked whole, decorators included, so the definition inside it is not
+          .filter((match) => match.captures[0].node.parent?.type !== 'decorated_definition')
+          .map((match) => {
+            const node = match.captures[0].node;
+            return [`${node.startIndex}-${node.endIndex}`, match];
+          })
       ).values()
     );
 
+    const getContainerPath = (node: Parser.SyntaxNode): string => {
+      if (langConfig.name === 'python' && PYTHON_DEFINITION_TYPES.has(node.type)) {
+        return getPythonContainerPath(node);
+      } else if (langConfig.name === LANG_RUST) {
+        return getRustContainerPath(node);
+      } else if (langConfig.name === LANG_C || langConfig.name === LANG_CPP) {
+        return getCContainerPath(node);
+      } else if (langConfig.name === LANG_JAVA) {
+        return getJavaContainerPath(node);
+      } else if (langConfig.name === LANG_KOTLIN) {
+        return getKotlinContainerPath(node);
+      }
+      let parent = node.parent;
+      if (parent?.type === 'class_body') {
+        parent = parent.parent;
+      }
+      if (
+        parent &&
+        (parent.type === 'class_declaration' ||
+          parent.type === 'function_declaration' ||
+          parent.type === 'class_definition')
+      ) {
+        const nameNode = parent.namedChildren.find(
+          (child) => child.type === 'identifier' || child.type === 'type_identifier'
+        );
+        if (nameNode) {
+          return nameNode.text;
+        }
+      }
+      return '';
+    };
+
+    const chunkOptions = this.getChunkOptions();
+    const fileImportContext = chunkOptions.includeImports
+      ? getFileImportContext(langConfig, tree.rootNode, importsByLine)
+      : undefined;
     let chunksSkipped = 0;
-    const chunks = uniqueMatches
-      .map(({ captures }): CodeChunk | null => {
-        const node = captures[0].node;
-        const content = node.text;
+    const chunks = uniqueMatches.flatMap(({ captures }): CodeChunk[] => {
+      const node = captures[0].node;
+      const nodeStartLine = node.startPosition.row + 1;
+
+      const containerPath = getContainerPath(node);
+
+      // The name of a decorated definition, and so its export, is on the line below its decorators
+      const definition = node.type === 'decorated_definition' ? node.childForFieldName('definition') : null;
+      let chunkExports = exportsByLine[definition ? definition.startPosition.row + 1 : nodeStartLine] || [];
+      if (node.type === 'variable_declarator') {
+        // One of several declarators on a line ("export const a = () => {}, b = () => {}") only owns its own export
+        const declaredName = node.childForFieldName('name')?.text;
+        chunkExports = chunkExports.filter((e) => e.name === declaredName);
+      }
+
+      const windows = isWindowedSymbol(node)
+        ? splitIntoWindows(nodeText(node), nodeStartLine, node.startIndex, chunkOptions)
+        : [wholeNodeWindow(nodeText(node), nodeStartLine, node.startIndex)];
+      const docsStart = langConfig.leadingDocs ? getLeadingDocsStart(node, langConfig.leadingDocs) : node;
+      if (docsStart !== node) {
+        // Docs go into the first window only; later windows keep the signature as their header
+        const docs = sourceCode.slice(docsStart.startIndex, node.startIndex);
+        windows[0] = {
+          ...windows[0],
+          content: docs + windows[0].content,
+          startLine: docsStart.startPosition.row + 1,
+          startIndex: docsStart.startIndex,
+        };
+      }
+      const parentSymbol = windows.length > 1 ? getSymbolName(node) : undefined;
+      const receiverType = langConfig.name === LANG_KOTLIN ? getKotlinReceiverType(node) : undefined;
+
+      const directoryInfo = extractDirectoryInfo(relativePath);
+
+      return windows.flatMap((chunkWindow): CodeChunk[] => {
+        const content = chunkWindow.content;
         const contentSize = Buffer.byteLength(content, 'utf8');
         if (contentSize > indexingConfig.maxChunkSizeBytes) {
           logger.warn(`Skipping chunk in ${filePath} because it is larger than maxChunkSizeBytes`);
           chunksSkipped++;
-          return null;
+          return [];
         }
-        const startLine = node.startPosition.row + 1;
-        const endLine = node.endPosition.row + 1;
+        const { startLine, endLine } = chunkWindow;
         const chunkHash = createChunkHash({
           type: CHUNK_TYPE_CODE,
           language: langConfig.name,
@@ -877,43 +1790,25 @@ export class LanguageParser {
           gitFileHash,
           startLine,
           endLine,
-          startIndex: node.startIndex,
-          endIndex: node.endIndex,
+          startIndex: chunkWindow.startIndex,
+          endIndex: chunkWindow.endIndex,
           content: content,
         });
 
-        let containerPath = '';
-        let parent = node.parent;
-        if (parent) {
-          if (parent.type === 'class_body') {
-            parent = parent.parent;
-          }
-
-          if (
-            parent &&
-            (parent.type === 'class_declaration' ||
-              parent.type === 'function_declaration' ||
-              parent.type === 'class_definition')
-          ) {
-            const nameNode = parent.namedChildren.find(
-              (child) => child.type === 'identifier' || child.type === 'type_identifier'
-            );
-            if (nameNode) {
-              containerPath = nameNode.text;
-            }
-          }
-        }
-
         const chunkImports = importsByLine[startLine] || [];
+        // Import and package statements are the context themselves
+        const isImportChunk = node.type.startsWith('import') || node.type === 'package_clause';
+        const importContext =
+          fileImportContext && !isImportChunk ? getChunkImportContext(fileImportContext, content) : undefined;
         const chunkSymbols: SymbolInfo[] = [];
         for (let i = startLine; i <= endLine; i++) {
           if (symbolsByLine[i]) {
             chunkSymbols.push(...symbolsByLine[i]);
           }
         }
-        const chunkExports = exportsByLine[startLine] || [];
-
-        const directoryInfo = extractDirectoryInfo(relativePath);
+        if (receiverType) {
+          chunkSymbols.push({ name: receiverType, kind: 'extension.receiver', line: nodeStartLine });
+        }
 
         const baseChunk: Omit<CodeChunk, 'semantic_text' | 'code_vector'> = {
           type: CHUNK_TYPE_CODE,
@@ -923,6 +1818,9 @@ export class LanguageParser {
           symbols: chunkSymbols,
           exports: chunkExports,
           containerPath,
+          ...(parentSymbol !== undefined && { parentSymbol }),
+          ...(chunkWindow.header !== undefined && { header: chunkWindow.header }),
+          ...(importContext && { importContext }),
           filePath: relativePath,
           ...directoryInfo,
           git_file_hash: gitFileHash,
@@ -935,16 +1833,127 @@ export class LanguageParser {
           updated_at: now,
         };
 
-        return {
-          ...baseChunk,
-          semantic_text: this.prepareSemanticText(baseChunk),
+        return [
+          {
+            ...baseChunk,
+            semantic_text: this.prepareSemanticText(baseChunk),
+          },
+        ];
+      });
+    });
+
+    if (chunkOptions.extractEmbeddedSql && langConfig.stringLiteralTypes) {
+      for (const literal of tree.rootNode.descendantsOfType(langConfig.stringLiteralTypes)) {
+        const { value, offset } = getStringLiteralValue(nodeText(literal));
+        const verb = getSqlStatementVerb(value);
+        if (!verb) {
+          continue;
+        }
+        const content = value.trim();
+        const leading = value.slice(0, value.length - value.trimStart().length);
+        const startLine = literal.startPosition.row + 1 + (leading.match(/\n/g) ?? []).length;
+        const endLine = startLine + (content.match(/\n/g) ?? []).length;
+        if (Buffer.byteLength(content, 'utf8') > indexingConfig.maxChunkSizeBytes) {
+          logger.warn(`Skipping SQL query in ${filePath} because it is larger than maxChunkSizeBytes`);
+          chunksSkipped++;
+          continue;
+        }
+        const startIndex = literal.startIndex + offset + leading.length;
+        const enclosingFunction = findEnclosingFunction(literal);
+        const parentSymbol = enclosingFunction ? getSymbolName(enclosingFunction) : undefined;
+        const symbols = getSqlTableSymbols(content, startLine);
+        const baseChunk: Omit<CodeChunk, 'semantic_text' | 'code_vector'> = {
+          type: CHUNK_TYPE_CODE,
+          language: LANG_SQL,
+          kind: `${verb}_statement`,
+          symbols,
+          containerPath: enclosingFunction ? getContainerPath(enclosingFunction) : '',
+          ...(parentSymbol !== undefined && { parentSymbol }),
+          filePath: relativePath,
+          ...extractDirectoryInfo(relativePath),
+          git_file_hash: gitFileHash,
+          git_branch: gitBranch,
+          chunk_hash: createChunkHash({
+            type: CHUNK_TYPE_CODE,
+            language: LANG_SQL,
+            relativePath,
+            gitBranch,
+            gitFileHash,
+            startLine,
+            endLine,
+            startIndex,
+            endIndex: startIndex + content.length,
+            content,
+          }),
+          startLine,
+          endLine,
+          content,
+          created_at: now,
+          updated_at: now,
         };
-      })
-      .filter((chunk): chunk is CodeChunk => chunk !== null);
+        chunks.push({ ...baseChunk, semantic_text: this.prepareSemanticText(baseChunk) });
+      }
+    }
 
     return { chunks, chunksSkipped };
   }
 
+  /**
+   * Splits the chunks whose `semantic_text` exceeds `ChunkOptions.maxTokens` at line breaks. The pieces
+   * keep the chunk's kind, container, and file context; each one's header counts against its budget.
+   * Only the body below a chunk's `header` is split; every piece keeps the header above its lines.
+   */
+  private enforceTokenBudget(chunks: CodeChunk[], relativePath: string): CodeChunk[] {
+    const { maxTokens, countTokens } = this.getChunkOptions();
+    if (maxTokens === 0) {
+      return chunks;
+    }
+    return chunks.flatMap((chunk) => {
+      if (countTokens(chunk.semantic_text) <= maxTokens) {
+        return [chunk];
+      }
+      const startLine = chunk.startLine ?? 1;
+      const endLine = chunk.endLine ?? startLine;
+      const { header } = chunk;
+      const body = header === undefined ? chunk.content : chunk.content.slice(header.length + 1);
+      const context = this.prepareSemanticText({ ...chunk, content: header === undefined ? '' : `${header}\n` });
+      // A header that leaves no room for code would never fit; keep at least one token per piece
+      const budget = Math.max(1, maxTokens - countTokens(context));
+      return splitByTokens(body, budget, countTokens).map((piece) => {
+        const pieceStart = Math.min(endLine, startLine + piece.startLine);
+        const pieceEnd = Math.min(endLine, startLine + piece.endLine);
+        if (piece.truncated) {
+          logger.warn(`Truncated a line of ${relativePath} that is longer than the chunk token budget`, {
+            line: pieceStart,
+            maxTokens,
+          });
+        }
+        const symbols = chunk.symbols?.filter((symbol) => symbol.line >= pieceStart && symbol.line <= pieceEnd);
+        const content = header === undefined ? piece.text : `${header}\n${piece.text}`;
+        const base = {
+          ...chunk,
+          ...(symbols && { symbols }),
+          content,
+          startLine: pieceStart,
+          endLine: pieceEnd,
+          chunk_hash: createChunkHash({
+            type: chunk.type,
+            language: chunk.language,
+            relativePath,
+            gitBranch: chunk.git_branch ?? '',
+            gitFileHash: chunk.git_file_hash ?? '',
+            startLine: pieceStart,
+            endLine: pieceEnd,
+            startIndex: 0,
+            endIndex: content.length,
+            content,
+          }),
+        };
+        return { ...base, semantic_text: this.prepareSemanticText(base) };
+      });
+    });
+  }
+
   private prepareSemanticText(
     chunk: Omit<
       CodeChunk,
@@ -963,6 +1972,16 @@ export class LanguageParser {
     if (chunk.containerPath) {
       header.push(`containerPath: ${chunk.containerPath}`);
     }
+    if (chunk.parentSymbol) {
+      header.push(`parentSymbol: ${chunk.parentSymbol}`);
+    }
+    // File context, but the import context is part of the chunk's document id (see `getChunkDocumentId`)
+    if (chunk.importContext?.packageName) {
+      header.push(`package: ${chunk.importContext.packageName}`);
+    }
+    if (chunk.importContext?.imports.length) {
+      header.push(`imports: ${chunk.importContext.imports.join(', ')}`);
+    }
 
     return `${header.join('\n')}\n\n${chunk.content}`;
   }
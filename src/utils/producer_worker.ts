@@ -10,10 +10,16 @@ import { LanguageParser, type ParseResult } from './parser';
 import { createLogger } from './logger';
 import { MESSAGE_STATUS_SUCCESS, MESSAGE_STATUS_FAILURE } from './constants';
 
-const workerContext = workerData as { repoName?: unknown; gitBranch?: unknown; languages?: unknown };
+const workerContext = workerData as {
+  repoName?: unknown;
+  gitBranch?: unknown;
+  languages?: unknown;
+  workspace?: unknown;
+};
 const repoName = typeof workerContext.repoName === 'string' ? workerContext.repoName : undefined;
 const repoBranch = typeof workerContext.gitBranch === 'string' ? workerContext.gitBranch : undefined;
 const languages = typeof workerContext.languages === 'string' ? workerContext.languages : undefined;
+const workspace = typeof workerContext.workspace === 'string' ? workerContext.workspace : undefined;
 const logger = repoName && repoBranch ? createLogger({ name: repoName, branch: repoBranch }) : createLogger();
 
 const languageParser = new LanguageParser(languages);
@@ -30,8 +36,10 @@ parentPort?.on(
       const result = languageParser.parseFile(filePath, gitBranch, relativePath);
       parentPort?.postMessage({
         status: MESSAGE_STATUS_SUCCESS,
-        data: result.chunks,
+        data: workspace !== undefined ? result.chunks.map((chunk) => ({ ...chunk, workspace })) : result.chunks,
         filePath,
+        fallback: result.fallback,
+        skipped: result.skipped,
         metrics: result.metrics,
       });
     } catch (error) {
@@ -0,0 +1,165 @@
+import { logger, setConsoleStatusLine } from './logger';
+
+export const PROGRESS_PHASES = ['walking', 'parsing', 'embedding', 'storing'] as const;
+export type ProgressPhase = (typeof PROGRESS_PHASES)[number];
+
+/** A snapshot of an indexing run, passed to the `progress` callback after every step. */
+export interface ProgressEvent {
+  /** What the run is doing: listing files, parsing them, embedding chunks, or writing them to the store. */
+  phase: ProgressPhase;
+  /** Files parsed, failed to parse, or skipped as unchanged so far. */
+  filesDone: number;
+  /** Files to index, known once walking finished; 0 while walking. */
+  filesTotal: number;
+  /** Chunks produced by parsing so far. */
+  chunksTotal: number;
+  /** Chunks embedded and written to the store so far. */
+  chunksEmbedded: number;
+}
+
+export type ProgressCallback = (event: ProgressEvent) => void;
+
+/** Minimum time between redraws of the TTY progress bar. */
+const TTY_REDRAW_INTERVAL_MS = 100;
+/** Default time between progress log lines when stdout is not a TTY. */
+const DEFAULT_LOG_INTERVAL_MS = 10_000;
+const BAR_WIDTH = 30;
+
+/**
+ * Accumulates the counts of one indexing run and reports a snapshot on every update.
+ *
+ * Shared by the producer and the indexer worker of a run, so the embedding phase knows the file
+ * totals of the parsing phase.
+ */
+export class ProgressTracker {
+  private readonly event: ProgressEvent = {
+    phase: 'walking',
+    filesDone: 0,
+    filesTotal: 0,
+    chunksTotal: 0,
+    chunksEmbedded: 0,
+  };
+
+  constructor(private readonly onProgress?: ProgressCallback) {}
+
+  /** The counts so far. */
+  get snapshot(): ProgressEvent {
+    return { ...this.event };
+  }
+
+  setPhase(phase: ProgressPhase): void {
+    this.event.phase = phase;
+    this.emit();
+  }
+
+  /** Records the outcome of walking and starts the parsing phase. */
+  setFilesTotal(filesTotal: number, filesDone = 0): void {
+    this.event.filesTotal = filesTotal;
+    this.event.filesDone = filesDone;
+    this.setPhase('parsing');
+  }
+
+  /** Records a file as parsed (or failed) with the number of chunks it produced. */
+  addFileDone(chunks = 0): void {
+    this.event.filesDone++;
+    this.event.chunksTotal += chunks;
+    this.setPhase('parsing');
+  }
+
+  addChunksEmbedded(chunks: number): void {
+    this.event.chunksEmbedded += chunks;
+    this.emit();
+  }
+
+  private emit(): void {
+    this.onProgress?.({ ...this.event });
+  }
+}
+
+/**
+ * Returns the completion of the current phase in percent, or null if it is unknown: while walking, or
+ * while embedding chunks of a queue resumed from an earlier run.
+ */
+export function getProgressPercent(event: ProgressEvent): number | null {
+  if (event.phase === 'parsing') {
+    return event.filesTotal > 0 ? Math.floor((100 * event.filesDone) / event.filesTotal) : null;
+  }
+  if (event.phase === 'embedding' || event.phase === 'storing') {
+    return event.chunksTotal > 0 && event.chunksEmbedded <= event.chunksTotal
+      ? Math.floor((100 * event.chunksEmbedded) / event.chunksTotal)
+      : null;
+  }
+  return null;
+}
+
+function describeCounts(event: ProgressEvent): string {
+  if (event.phase === 'walking') {
+    return 'listing files';
+  }
+  if (event.phase === 'parsing') {
+    return `${event.filesDone}/${event.filesTotal} files, ${event.chunksTotal} chunks`;
+  }
+  const chunks = event.chunksTotal > 0 ? `${event.chunksEmbedded}/${event.chunksTotal}` : `${event.chunksEmbedded}`;
+  return `${chunks} chunks embedded, ${event.filesDone}/${event.filesTotal} files parsed`;
+}
+
+/** Formats an event as a log line, e.g. `Progress: parsing 52% (520/1000 files, 3400 chunks)`. */
+export function formatProgressLine(event: ProgressEvent): string {
+  const percent = getProgressPercent(event);
+  return `Progress: ${event.phase}${percent !== null ? ` ${percent}%` : ''} (${describeCounts(event)})`;
+}
+
+/** Formats an event as a progress bar, e.g. `parsing   [#########.....]  52%  520/1000 files, 3400 chunks`. */
+export function formatProgressBar(event: ProgressEvent, width: number = BAR_WIDTH): string {
+  const percent = getProgressPercent(event);
+  const filled = percent !== null ? Math.round((width * percent) / 100) : 0;
+  const bar = percent !== null ? `[${'#'.repeat(filled)}${'.'.repeat(width - filled)}]` : `[${' '.repeat(width)}]`;
+  const percentText = percent !== null ? `${percent}%`.padStart(4) : '    ';
+  return `${event.phase.padEnd(9)} ${bar} ${percentText}  ${describeCounts(event)}`;
+}
+
+export interface ConsoleProgress {
+  onProgress: ProgressCallback;
+  /** Removes the progress bar, or logs the last counts when logging lines. */
+  stop(): void;
+}
+
+/**
+ * Renders progress on the console: a progress bar below the log output when stdout is a TTY, and
+ * otherwise a log line every `logIntervalMs` and whenever a new phase starts, so CI logs stay readable.
+ */
+export function createConsoleProgress(
+  options: { tty?: boolean; logIntervalMs?: number; now?: () => number } = {}
+): ConsoleProgress {
+  const tty = options.tty ?? process.stdout.isTTY === true;
+  const logIntervalMs = options.logIntervalMs ?? DEFAULT_LOG_INTERVAL_MS;
+  const now = options.now ?? Date.now;
+  let last: ProgressEvent | undefined;
+  let lastOutputAt = -Infinity;
+  // Embedding and storing alternate per batch, so they count as one stage for logging
+  const stage = (event: ProgressEvent) => (event.phase === 'storing' ? 'embedding' : event.phase);
+
+  return {
+    onProgress: (event) => {
+      const newStage = last === undefined || stage(last) !== stage(event);
+      last = event;
+      const elapsed = now() - lastOutputAt;
+      if (tty) {
+        if (newStage || elapsed >= TTY_REDRAW_INTERVAL_MS) {
+          setConsoleStatusLine(formatProgressBar(event));
+          lastOutputAt = now();
+        }
+      } else if (newStage || elapsed >= logIntervalMs) {
+        logger.info(formatProgressLine(event));
+        lastOutputAt = now();
+      }
+    },
+    stop: () => {
+      if (tty) {
+        setConsoleStatusLine(undefined);
+      } else if (last) {
+        logger.info(formatProgressLine(last));
+      }
+    },
+  };
+}
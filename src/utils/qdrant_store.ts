@@ -0,0 +1,1018 @@
+import { createHash } from 'crypto';
+import {
+  BulkIndexFailed,
+  BulkIndexResult,
+  BulkIndexSucceeded,
+  ChunkBlame,
+  ChunkLocationSummary,
+  CodeChunk,
+  DeleteDocumentsResult,
+  EmbeddingModel,
+  SearchResult,
+  StoreStats,
+  getChunkDocumentId,
+  getChunkLocationDocumentId,
+} from './elasticsearch';
+import { ChunkStore } from './chunk_store';
+import {
+  DEFAULT_VECTOR_METRIC,
+  VectorMetric,
+  euclideanScore,
+  prepareChunkVectors,
+  prepareVector,
+} from './vector_metric';
+import { extractKeywordTerms, getSymbolTokens, tokenizeIdentifiers } from './hybrid_search';
+import { logger } from './logger';
+import {
+  MAX_POST_FILTER_CANDIDATES,
+  POST_FILTER_CANDIDATE_FACTOR,
+  PostFilterOptions,
+  SearchFilters,
+  createLocationMatcher,
+  expandKindFilter,
+  fetchPostFiltered,
+} from './search_filters';
+import { SymbolName } from './symbol_search';
+import { WorkspaceStats, isInWorkspace } from './workspace';
+
+const SCROLL_PAGE_SIZE = 256;
+/**
+ * Most keyword matches scrolled and ranked client-side. A query matching more is ranked among the first
+ * this many Qdrant returns, which are in no particular order.
+ */
+const MAX_KEYWORD_CANDIDATES = MAX_POST_FILTER_CANDIDATES;
+
+export interface QdrantStoreOptions {
+  /** Base URL of the Qdrant HTTP API, e.g. `http://localhost:6333`. */
+  url: string;
+  /** Sent as the `api-key` header when set. */
+  apiKey?: string;
+  /** Collection holding the chunks; per-branch state lives in `<collection>_settings`. */
+  collection: string;
+  /**
+   * Dimensions of the configured embedder. When set, `setup` creates the collection up front and
+   * rejects an existing collection of a different size; otherwise it is created on the first write.
+   */
+  dimensions?: number;
+  /** How vectors are compared (default: `cosine`); an existing collection must use the matching distance. */
+  metric?: VectorMetric;
+}
+
+/** Qdrant distance of each metric. */
+const QDRANT_DISTANCES: Record<VectorMetric, string> = {
+  cosine: 'Cosine',
+  dot_product: 'Dot',
+  euclidean: 'Euclid',
+};
+
+/** Payload conditions: each key must match, a list matches any of its values. */
+type PayloadConditions = Record<string, string | number | boolean | Array<string | number>>;
+
+interface LocationPayload {
+  id: string;
+  filePath: string;
+  startLine: number;
+  endLine: number;
+  directoryPath?: string;
+  directoryName?: string;
+  directoryDepth?: number;
+  gitFileHash?: string;
+  gitBranch?: string;
+  workspace?: string;
+  blame?: ChunkBlame;
+}
+
+interface ChunkPayload {
+  chunk_id: string;
+  type: CodeChunk['type'];
+  language: string;
+  kind?: string;
+  containerPath?: string;
+  imports?: CodeChunk['imports'];
+  symbols?: CodeChunk['symbols'];
+  exports?: CodeChunk['exports'];
+  parentSymbol?: string;
+  frontMatter?: Record<string, unknown>;
+  chunk_hash: string;
+  content: string;
+  semantic_text: string;
+  /** Symbol names and the parent symbol, for keyword matching. */
+  symbol_names: string[];
+  /** Lowercase words of `symbol_names`; missing on points written before they were recorded. */
+  symbol_tokens?: string[];
+  locations: LocationPayload[];
+  /** Distinct `locations[].filePath`, indexed so deletes by file can filter on it. */
+  file_paths: string[];
+  created_at: string;
+  updated_at: string;
+}
+
+interface QdrantPoint<P> {
+  id: string;
+  score?: number;
+  payload?: P;
+  vector?: number[];
+}
+
+interface CollectionInfo {
+  config: { params: { vectors: { size?: number; distance?: string } } };
+}
+
+class QdrantRequestError extends Error {
+  constructor(
+    message: string,
+    readonly status: number
+  ) {
+    super(message);
+    this.name = 'QdrantRequestError';
+  }
+}
+
+/**
+ * Maps a hex digest to the UUID form Qdrant accepts as a point id.
+ */
+function toPointId(hexDigest: string): string {
+  const hex = hexDigest.slice(0, 32);
+  return `${hex.slice(0, 8)}-${hex.slice(8, 12)}-${hex.slice(12, 16)}-${hex.slice(16, 20)}-${hex.slice(20, 32)}`;
+}
+
+function settingPointId(key: string): string {
+  return toPointId(createHash('sha256').update(key).digest('hex'));
+}
+
+/** Settings key of the embedder and embed template the stored vectors were made with. */
+const EMBEDDING_MODEL_SETTING = 'embedding_model';
+
+function toQdrantFilter(filter: PayloadConditions): { must: unknown[] } {
+  return {
+    must: Object.entries(filter).map(([key, value]) => ({
+      key,
+      match: Array.isArray(value) ? { any: value } : { value },
+    })),
+  };
+}
+
+/**
+ * Returns the payload conditions for the language and kind filters. Qdrant cannot match keyword
+ * prefixes or globs, so the path filter is checked against the locations of the returned points.
+ */
+function toChunkConditions(filters: SearchFilters | undefined): PayloadConditions {
+  return {
+    ...(filters?.language ? { language: filters.language } : {}),
+    ...(filters?.kind ? { kind: expandKindFilter(filters.kind) } : {}),
+  };
+}
+
+function countOccurrences(text: string, term: string): number {
+  let count = 0;
+  for (let index = text.indexOf(term); index !== -1; index = text.indexOf(term, index + term.length)) {
+    count++;
+  }
+  return count;
+}
+
+/**
+ * A chunk store backed by a Qdrant collection, for deployments that share one horizontally scalable index.
+ *
+ * Each chunk is one point, keyed by the same content-derived id as the other stores, with its vector
+ * compared by the distance of the configured metric and its metadata and file locations as payload. The
+ * last indexed commit of each branch is kept in a `<collection>_settings` side collection, since Qdrant
+ * has no key-value API.
+ * All calls go through the Qdrant HTTP API.
+ */
+export class QdrantStore implements ChunkStore {
+  readonly backend = 'qdrant';
+  private readonly url: string;
+  private readonly apiKey?: string;
+  private readonly collection: string;
+  private readonly settingsCollection: string;
+  private readonly dimensions?: number;
+  private readonly metric: VectorMetric;
+  private collectionDimensions?: number;
+  private hasSettingsCollection = false;
+
+  constructor(options: QdrantStoreOptions) {
+    this.url = options.url.replace(/\/+$/, '');
+    this.apiKey = options.apiKey;
+    this.collection = options.collection;
+    this.settingsCollection = `${options.collection}_settings`;
+    this.dimensions = options.dimensions;
+    this.metric = options.metric ?? DEFAULT_VECTOR_METRIC;
+  }
+
+  async setup(): Promise<void> {
+    await this.ensureSettingsCollection();
+    if (this.dimensions !== undefined) {
+      await this.ensureCollection(this.dimensions);
+    }
+  }
+
+  async clean(): Promise<void> {
+    await this.request('DELETE', `/collections/${encodeURIComponent(this.collection)}`, undefined, {
+      allowNotFound: true,
+    });
+    this.collectionDimensions = undefined;
+    if (await this.ensureSettingsCollection(false)) {
+      await this.request('POST', `/collections/${encodeURIComponent(this.settingsCollection)}/points/batch?wait=true`, {
+        operations: [{ delete: { points: [settingPointId(EMBEDDING_MODEL_SETTING)] } }],
+      });
+    }
+  }
+
+  async getVectorDimensions(): Promise<number | null> {
+    const info = await this.getCollectionInfo(this.collection);
+    return info?.config.params.vectors.size ?? null;
+  }
+
+  async indexChunks(chunks: CodeChunk[]): Promise<BulkIndexResult> {
+    if (chunks.length === 0) {
+      return { succeeded: [], failed: [] };
+    }
+
+    let dims = this.collectionDimensions ?? (await this.getVectorDimensions()) ?? this.dimensions ?? null;
+    const valid: BulkIndexSucceeded[] = [];
+    const failed: BulkIndexFailed[] = [];
+
+    prepareChunkVectors(chunks, this.metric).forEach((chunk, inputIndex) => {
+      if (!chunk.filePath || chunk.startLine == null || chunk.endLine == null) {
+        failed.push({ chunk, inputIndex, error: { message: 'missing file metadata (filePath/startLine/endLine)' } });
+        return;
+      }
+      if (!chunk.code_vector) {
+        failed.push({
+          chunk,
+          inputIndex,
+          error: { message: 'missing code_vector; the Qdrant store needs a client-side embedder (SCS_IDXR_EMBEDDER)' },
+        });
+        return;
+      }
+      dims ??= chunk.code_vector.length;
+      if (chunk.code_vector.length !== dims) {
+        failed.push({
+          chunk,
+          inputIndex,
+          error: { message: `code_vector has ${chunk.code_vector.length} dimensions, store expects ${dims}` },
+        });
+        return;
+      }
+      valid.push({ chunk, inputIndex });
+    });
+
+    if (valid.length > 0 && dims !== null) {
+      try {
+        await this.ensureCollection(dims);
+        await this.upsertChunks(valid.map(({ chunk }) => chunk));
+      } catch (error) {
+        const message = error instanceof Error ? error.message : String(error);
+        logger.error('Exception while writing chunks to the Qdrant store', { error: message });
+        valid.forEach(({ chunk, inputIndex }) => failed.push({ chunk, inputIndex, error: { message } }));
+        valid.length = 0;
+      }
+    }
+
+    if (failed.length > 0) {
+      logger.error(`Partial Qdrant store failure: ${failed.length}/${chunks.length} documents failed`, {
+        sample: failed.slice(0, 5).map((f) => ({ chunk_hash: f.chunk.chunk_hash, error: f.error })),
+      });
+    }
+    failed.sort((a, b) => a.inputIndex - b.inputIndex);
+    return { succeeded: valid, failed };
+  }
+
+  async deleteDocumentsByFilePaths(
+    filePaths: string[],
+    options?: { workspace?: string; keepChunkIds?: Set<string> }
+  ): Promise<DeleteDocumentsResult> {
+    const uniqueFilePaths = Array.from(new Set(filePaths)).filter((p) => typeof p === 'string' && p.length > 0);
+    const result: DeleteDocumentsResult = { locations: 0, chunks: 0 };
+    if (uniqueFilePaths.length === 0 || (await this.getCollectionInfo(this.collection)) === null) {
+      return result;
+    }
+
+    const removed = new Set(uniqueFilePaths);
+    const points = await this.scroll<Pick<ChunkPayload, 'locations'>>(this.collection, {
+      filter: toQdrantFilter({ file_paths: uniqueFilePaths }),
+      with_payload: ['locations'],
+    });
+
+    const kept = new Set(Array.from(options?.keepChunkIds ?? [], toPointId));
+    const orphans: string[] = [];
+    const operations: unknown[] = [];
+    for (const point of points) {
+      const allLocations = point.payload?.locations ?? [];
+      const locations = allLocations.filter(
+        (location) => !removed.has(location.filePath) || !isInWorkspace(location.workspace, options?.workspace)
+      );
+      result.locations += allLocations.length - locations.length;
+      if (locations.length === 0 && !kept.has(point.id)) {
+        orphans.push(point.id);
+      } else {
+        operations.push({
+          set_payload: {
+            payload: { locations, file_paths: Array.from(new Set(locations.map((l) => l.filePath))) },
+            points: [point.id],
+          },
+        });
+      }
+    }
+    if (orphans.length > 0) {
+      operations.push({ delete: { points: orphans } });
+    }
+    if (operations.length > 0) {
+      await this.request('POST', `/collections/${encodeURIComponent(this.collection)}/points/batch?wait=true`, {
+        operations,
+      });
+    }
+    result.chunks = orphans.length;
+    return result;
+  }
+
+  async getChunkVectors(chunkIds: string[]): Promise<Map<string, number[]>> {
+    const ids = Array.from(new Set(chunkIds));
+    const vectors = new Map<string, number[]>();
+    if (ids.length === 0 || (await this.getCollectionInfo(this.collection)) === null) {
+      return vectors;
+    }
+    const points = await this.request<Array<QdrantPoint<Pick<ChunkPayload, 'chunk_id'>>>>(
+      'POST',
+      `/collections/${encodeURIComponent(this.collection)}/points`,
+      { ids: ids.map(toPointId), with_payload: ['chunk_id'], with_vector: true }
+    );
+    for (const { payload, vector } of points) {
+      if (payload && Array.isArray(vector) && vector.length > 0) {
+        vectors.set(payload.chunk_id, vector);
+      }
+    }
+    return vectors;
+  }
+
+  async getIndexedFileHashes(branch: string, workspace?: string): Promise<Map<string, Set<string>>> {
+    const hashes = new Map<string, Set<string>>();
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return hashes;
+    }
+    const points = await this.scroll<Pick<ChunkPayload, 'locations'>>(this.collection, {
+      with_payload: ['locations'],
+    });
+    for (const point of points) {
+      for (const location of point.payload?.locations ?? []) {
+        if (location.gitBranch !== branch || !location.gitFileHash || !isInWorkspace(location.workspace, workspace)) {
+          continue;
+        }
+        const set = hashes.get(location.filePath) ?? new Set<string>();
+        set.add(location.gitFileHash);
+        hashes.set(location.filePath, set);
+      }
+    }
+    return hashes;
+  }
+
+  async getIndexedFilePaths(workspace?: string): Promise<string[]> {
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return [];
+    }
+    if (workspace !== undefined) {
+      const points = await this.scroll<Pick<ChunkPayload, 'locations'>>(this.collection, {
+        with_payload: ['locations'],
+      });
+      const filePaths = points.flatMap((point) =>
+        (point.payload?.locations ?? []).filter((l) => isInWorkspace(l.workspace, workspace)).map((l) => l.filePath)
+      );
+      return Array.from(new Set(filePaths)).sort();
+    }
+    const points = await this.scroll<Pick<ChunkPayload, 'file_paths'>>(this.collection, {
+      with_payload: ['file_paths'],
+    });
+    return Array.from(new Set(points.flatMap((point) => point.payload?.file_paths ?? []))).sort();
+  }
+
+  /**
+   * Returns the top-k chunks by similarity to `queryVector` under the store's metric.
+   *
+   * `score` is as documented on `VECTOR_METRICS`: Qdrant's cosine similarity or dot product, or for
+   * `euclidean` the distance Qdrant reports converted to `1 / (1 + d²)`. Each result carries the first location of the
+   * chunk (by file path) in `filePath`, `startLine`, and `endLine`. Language and kind filters are
+   * payload conditions of the search; path and workspace filters over-fetch and keep chunks with a matching
+   * location.
+   */
+  async search(
+    queryVector: number[],
+    k: number,
+    filters?: SearchFilters,
+    options?: PostFilterOptions
+  ): Promise<SearchResult[]> {
+    const limit = Math.max(0, Math.floor(k));
+    if (limit === 0) {
+      return [];
+    }
+    const vectors = (await this.getCollectionInfo(this.collection))?.config.params.vectors;
+    const dims = vectors?.size ?? null;
+    if (dims === null) {
+      return [];
+    }
+    if (queryVector.length !== dims) {
+      throw new Error(
+        `Query vector has ${queryVector.length} dimensions, but Qdrant collection "${this.collection}" holds ${dims}.`
+      );
+    }
+    this.assertDistance(vectors?.distance);
+
+    const conditions = toChunkConditions(filters);
+    const matchesLocation = createLocationMatcher(filters);
+    return fetchPostFiltered(limit, this.getOverfetchFactor(matchesLocation, options), async (candidates) => {
+      const points = await this.request<Array<QdrantPoint<ChunkPayload>>>(
+        'POST',
+        `/collections/${encodeURIComponent(this.collection)}/points/search`,
+        {
+          vector: prepareVector(queryVector, this.metric),
+          limit: candidates,
+          with_payload: true,
+          ...(Object.keys(conditions).length > 0 ? { filter: toQdrantFilter(conditions) } : {}),
+        }
+      );
+      const results = points.flatMap((point) => {
+        const score = this.metric === 'euclidean' ? euclideanScore((point.score ?? 0) ** 2) : (point.score ?? 0);
+        const result = point.payload && this.toSearchResult(point.payload, score, matchesLocation);
+        return result ? [result] : [];
+      });
+      return { results, exhausted: points.length < candidates };
+    });
+  }
+
+  /** Candidates fetched per result: without a path or workspace filter, every candidate is kept. */
+  private getOverfetchFactor(
+    matchesLocation: ReturnType<typeof createLocationMatcher>,
+    options?: PostFilterOptions
+  ): number {
+    return matchesLocation ? (options?.overfetchFactor ?? POST_FILTER_CANDIDATE_FACTOR) : 1;
+  }
+
+  /**
+   * Returns the top-k chunks that contain the query terms in their content or symbol names.
+   *
+   * Qdrant's full-text payload index filters but does not score, so candidates are ranked here by
+   * how often the terms occur, with a symbol name match weighing twice as much as a content match. Each
+   * word of the terms that is also a word of a symbol name adds one, so `parse json` finds `ParseJSONConfig`.
+   *
+   * Every match is scrolled and ranked, up to `MAX_KEYWORD_CANDIDATES`, so no over-fetch factor applies.
+   */
+  async keywordSearch(query: string, k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    const limit = Math.max(0, Math.floor(k));
+    const terms = extractKeywordTerms(query);
+    if (limit === 0 || terms.length === 0 || (await this.getCollectionInfo(this.collection)) === null) {
+      return [];
+    }
+
+    const words = tokenizeIdentifiers(terms);
+    const conditions = toChunkConditions(filters);
+    const matchesLocation = createLocationMatcher(filters);
+    const lowerTerms = terms.map((term) => term.toLowerCase());
+    const results: SearchResult[] = [];
+    let scrolled = 0;
+    for await (const page of this.scrollPages<ChunkPayload>(this.collection, {
+      filter: {
+        ...toQdrantFilter(conditions),
+        should: [
+          ...terms.flatMap((term) => [
+            { key: 'content', match: { text: term } },
+            { key: 'symbol_names', match: { any: [term] } },
+          ]),
+          ...(words.length > 0 ? [{ key: 'symbol_tokens', match: { any: words } }] : []),
+        ],
+      },
+      with_payload: true,
+      with_vector: false,
+    })) {
+      for (const point of page) {
+        if (!point.payload) {
+          continue;
+        }
+        const content = point.payload.content.toLowerCase();
+        const symbols = new Set(point.payload.symbol_names.map((name) => name.toLowerCase()));
+        const symbolTokens = new Set(point.payload.symbol_tokens ?? []);
+        const score =
+          lowerTerms.reduce((sum, term) => sum + countOccurrences(content, term) + (symbols.has(term) ? 2 : 0), 0) +
+          words.filter((word) => symbolTokens.has(word)).length;
+        const result = score > 0 ? this.toSearchResult(point.payload, score, matchesLocation) : undefined;
+        if (result) {
+          results.push(result);
+        }
+      }
+      scrolled += page.length;
+      if (scrolled >= MAX_KEYWORD_CANDIDATES) {
+        break;
+      }
+    }
+    return results.sort((a, b) => b.score - a.score).slice(0, limit);
+  }
+
+  /** Scrolls the symbols of every point; Qdrant has no aggregations to list distinct values. */
+  async getSymbolNames(): Promise<SymbolName[]> {
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return [];
+    }
+    const names = new Map<string, SymbolName>();
+    for await (const page of this.scrollPages<Pick<ChunkPayload, 'symbols'>>(this.collection, {
+      with_payload: ['symbols'],
+      with_vector: false,
+    })) {
+      for (const { name, kind } of page.flatMap((point) => point.payload?.symbols ?? [])) {
+        names.set(`${kind}:${name}`, { name, kind });
+      }
+    }
+    return Array.from(names.values());
+  }
+
+  /** Matches `symbol_names` as a payload condition; path and workspace filters are checked like in `search`. */
+  async findChunksBySymbol(name: string, k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    const limit = Math.max(0, Math.floor(k));
+    if (limit === 0 || (await this.getCollectionInfo(this.collection)) === null) {
+      return [];
+    }
+    const matchesLocation = createLocationMatcher(filters);
+    const results = await fetchPostFiltered(limit, this.getOverfetchFactor(matchesLocation), async (candidates) => {
+      const { points, next_page_offset } = await this.request<{
+        points: Array<QdrantPoint<ChunkPayload>>;
+        next_page_offset?: unknown;
+      }>('POST', `/collections/${encodeURIComponent(this.collection)}/points/scroll`, {
+        filter: toQdrantFilter({ ...toChunkConditions(filters), symbol_names: [name] }),
+        limit: candidates,
+        with_payload: true,
+      });
+      const kept = points.flatMap((point) => {
+        const result = point.payload && this.toSearchResult(point.payload, 1, matchesLocation);
+        return result ? [result] : [];
+      });
+      return { results: kept, exhausted: next_page_offset == null };
+    });
+    return results.sort(
+      (a, b) => (a.filePath ?? '').localeCompare(b.filePath ?? '') || (a.startLine ?? 0) - (b.startLine ?? 0)
+    );
+  }
+
+  async getChunkLocations(chunkIds: string[], perChunkLimit: number): Promise<Record<string, ChunkLocationSummary[]>> {
+    const ids = Array.from(new Set(chunkIds));
+    if (ids.length === 0 || (await this.getCollectionInfo(this.collection)) === null) {
+      return {};
+    }
+    const points = await this.request<Array<QdrantPoint<Pick<ChunkPayload, 'chunk_id' | 'locations'>>>>(
+      'POST',
+      `/collections/${encodeURIComponent(this.collection)}/points`,
+      { ids: ids.map(toPointId), with_payload: ['chunk_id', 'locations'] }
+    );
+    const result: Record<string, ChunkLocationSummary[]> = {};
+    for (const { payload } of points) {
+      if (!payload || payload.locations.length === 0) {
+        continue;
+      }
+      result[payload.chunk_id] = [...payload.locations]
+        .sort((a, b) => a.filePath.localeCompare(b.filePath) || a.startLine - b.startLine)
+        .slice(0, perChunkLimit)
+        .map((location) => ({
+          filePath: location.filePath,
+          startLine: location.startLine,
+          endLine: location.endLine,
+          ...(location.gitFileHash !== undefined ? { gitFileHash: location.gitFileHash } : {}),
+          ...(location.workspace !== undefined ? { workspace: location.workspace } : {}),
+          ...(location.blame !== undefined ? { blame: location.blame } : {}),
+        }));
+    }
+    return result;
+  }
+
+  /**
+   * Counts files and chunks by reading the payload of every point. Qdrant does not report the size of a
+   * collection, so `sizeBytes` is null.
+   */
+  async getStats(): Promise<StoreStats> {
+    const stats: StoreStats = { files: 0, chunks: 0, languages: {}, kinds: {}, sizeBytes: null };
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return stats;
+    }
+    const points = await this.scroll<Pick<ChunkPayload, 'language' | 'kind' | 'file_paths'>>(this.collection, {
+      with_payload: ['language', 'kind', 'file_paths'],
+    });
+    const files = new Set<string>();
+    for (const { payload } of points) {
+      if (!payload) {
+        continue;
+      }
+      stats.languages[payload.language] = (stats.languages[payload.language] ?? 0) + 1;
+      if (payload.kind) {
+        stats.kinds[payload.kind] = (stats.kinds[payload.kind] ?? 0) + 1;
+      }
+      payload.file_paths?.forEach((filePath) => files.add(filePath));
+    }
+    stats.chunks = points.length;
+    stats.files = files.size;
+    return stats;
+  }
+
+  /** Counts files and chunks per workspace by reading the locations of every point. */
+  async getWorkspaces(): Promise<WorkspaceStats[]> {
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return [];
+    }
+    const points = await this.scroll<Pick<ChunkPayload, 'locations'>>(this.collection, {
+      with_payload: ['locations'],
+    });
+    const byWorkspace = new Map<string | null, { files: Set<string>; chunks: Set<string> }>();
+    for (const point of points) {
+      for (const location of point.payload?.locations ?? []) {
+        const workspace = location.workspace ?? null;
+        const entry = byWorkspace.get(workspace) ?? { files: new Set<string>(), chunks: new Set<string>() };
+        entry.files.add(location.filePath);
+        entry.chunks.add(point.id);
+        byWorkspace.set(workspace, entry);
+      }
+    }
+    // Unlabeled locations first, like SQL orders NULL
+    return Array.from(byWorkspace, ([workspace, { files, chunks }]) => ({
+      workspace,
+      files: files.size,
+      chunks: chunks.size,
+    })).sort((a, b) => (a.workspace ?? '').localeCompare(b.workspace ?? ''));
+  }
+
+  async *exportChunks(pageSize = SCROLL_PAGE_SIZE): AsyncIterable<CodeChunk[]> {
+    if ((await this.getCollectionInfo(this.collection)) === null) {
+      return;
+    }
+    const pages = this.scrollPages<ChunkPayload>(
+      this.collection,
+      { with_payload: true, with_vector: true },
+      Math.max(1, Math.floor(pageSize))
+    );
+    for await (const points of pages) {
+      yield points.flatMap(({ payload, vector }) => {
+        if (!payload) {
+          return [];
+        }
+        const chunk: CodeChunk = {
+          type: payload.type,
+          language: payload.language,
+          ...(payload.kind !== undefined ? { kind: payload.kind } : {}),
+          ...(payload.containerPath !== undefined ? { containerPath: payload.containerPath } : {}),
+          imports: payload.imports,
+          symbols: payload.symbols,
+          exports: payload.exports,
+          parentSymbol: payload.parentSymbol,
+          frontMatter: payload.frontMatter,
+          chunk_hash: payload.chunk_hash,
+          content: payload.content,
+          semantic_text: payload.semantic_text,
+          ...(vector ? { code_vector: vector } : {}),
+          created_at: payload.created_at,
+          updated_at: payload.updated_at,
+        };
+        return payload.locations.map((location) => ({
+          ...chunk,
+          filePath: location.filePath,
+          startLine: location.startLine,
+          endLine: location.endLine,
+          directoryPath: location.directoryPath,
+          directoryName: location.directoryName,
+          directoryDepth: location.directoryDepth,
+          git_file_hash: location.gitFileHash,
+          git_branch: location.gitBranch,
+          workspace: location.workspace,
+          blame: location.blame,
+        }));
+      });
+    }
+  }
+
+  async getLastIndexedCommit(branch: string): Promise<string | null> {
+    if (!(await this.ensureSettingsCollection(false))) {
+      return null;
+    }
+    const points = await this.request<Array<QdrantPoint<{ value: string }>>>(
+      'POST',
+      `/collections/${encodeURIComponent(this.settingsCollection)}/points`,
+      { ids: [settingPointId(`commit:${branch}`)], with_payload: true }
+    );
+    return points[0]?.payload?.value ?? null;
+  }
+
+  async updateLastIndexedCommit(branch: string, commitHash: string): Promise<void> {
+    await this.ensureSettingsCollection();
+    const key = `commit:${branch}`;
+    await this.request('PUT', `/collections/${encodeURIComponent(this.settingsCollection)}/points?wait=true`, {
+      points: [{ id: settingPointId(key), vector: [1], payload: { key, value: commitHash } }],
+    });
+  }
+
+  async getEmbeddingModel(): Promise<EmbeddingModel | null> {
+    if (!(await this.ensureSettingsCollection(false))) {
+      return null;
+    }
+    const points = await this.request<Array<QdrantPoint<{ value: string }>>>(
+      'POST',
+      `/collections/${encodeURIComponent(this.settingsCollection)}/points`,
+      { ids: [settingPointId(EMBEDDING_MODEL_SETTING)], with_payload: true }
+    );
+    const value = points[0]?.payload?.value;
+    return value !== undefined ? (JSON.parse(value) as EmbeddingModel) : null;
+  }
+
+  async setEmbeddingModel(model: EmbeddingModel): Promise<void> {
+    await this.ensureSettingsCollection();
+    const key = EMBEDDING_MODEL_SETTING;
+    await this.request('PUT', `/collections/${encodeURIComponent(this.settingsCollection)}/points?wait=true`, {
+      points: [{ id: settingPointId(key), vector: [1], payload: { key, value: JSON.stringify(model) } }],
+    });
+  }
+
+  async close(): Promise<void> {
+    // Nothing to release: every call is a standalone HTTP request
+  }
+
+  /**
+   * Creates the chunk collection with `dims` dimensions and cosine distance unless it exists.
+   *
+   * @throws If an existing collection has a different size or distance, which would corrupt search.
+   */
+  private async ensureCollection(dims: number): Promise<void> {
+    if (this.collectionDimensions === dims) {
+      return;
+    }
+    let info = await this.getCollectionInfo(this.collection);
+    if (!info) {
+      try {
+        await this.request('PUT', `/collections/${encodeURIComponent(this.collection)}`, {
+          vectors: { size: dims, distance: QDRANT_DISTANCES[this.metric] },
+        });
+        logger.info(`Created Qdrant collection "${this.collection}"`, { dimensions: dims });
+        await this.createPayloadIndexes();
+      } catch (error) {
+        // Another worker may have created it in the meantime; the checks below still apply
+        if (!(error instanceof QdrantRequestError) || (error.status !== 409 && error.status !== 400)) {
+          throw error;
+        }
+      }
+      info = await this.getCollectionInfo(this.collection);
+    }
+
+    const { size, distance } = info?.config.params.vectors ?? {};
+    if (size !== dims) {
+      const stored = size === undefined ? 'named' : `${size}-dimensional`;
+      throw new Error(
+        `Qdrant collection "${this.collection}" stores ${stored} vectors, not ${dims}-dimensional ones. ` +
+          'Use an embedder with matching dimensions or recreate the collection with --clean.'
+      );
+    }
+    this.assertDistance(distance);
+    this.collectionDimensions = dims;
+  }
+
+  /**
+   * @throws If the collection compares vectors by another distance than the configured metric.
+   */
+  private assertDistance(distance: string | undefined): void {
+    const expected = QDRANT_DISTANCES[this.metric];
+    if (distance !== expected) {
+      throw new Error(
+        `Qdrant collection "${this.collection}" uses ${distance} distance, but the ${this.metric} metric ` +
+          `(SCS_IDXR_VECTOR_METRIC) requires ${expected}. Recreate the collection with --clean to change it.`
+      );
+    }
+  }
+
+  private async createPayloadIndexes(): Promise<void> {
+    const indexes: Array<[string, unknown]> = [
+      ['file_paths', 'keyword'],
+      ['language', 'keyword'],
+      ['type', 'keyword'],
+      ['kind', 'keyword'],
+      ['symbol_names', 'keyword'],
+      ['symbol_tokens', 'keyword'],
+      ['content', { type: 'text', tokenizer: 'word', lowercase: true }],
+    ];
+    for (const [fieldName, fieldSchema] of indexes) {
+      await this.request('PUT', `/collections/${encodeURIComponent(this.collection)}/index?wait=true`, {
+        field_name: fieldName,
+        field_schema: fieldSchema,
+      });
+    }
+  }
+
+  /**
+   * Makes sure the settings collection exists.
+   *
+   * @param create Create it when missing; otherwise only report whether it exists.
+   */
+  private async ensureSettingsCollection(create = true): Promise<boolean> {
+    if (this.hasSettingsCollection) {
+      return true;
+    }
+    if ((await this.getCollectionInfo(this.settingsCollection)) === null) {
+      if (!create) {
+        return false;
+      }
+      try {
+        await this.request('PUT', `/collections/${encodeURIComponent(this.settingsCollection)}`, {
+          vectors: { size: 1, distance: 'Dot' },
+        });
+      } catch (error) {
+        if (!(error instanceof QdrantRequestError) || (error.status !== 409 && error.status !== 400)) {
+          throw error;
+        }
+      }
+    }
+    this.hasSettingsCollection = true;
+    return true;
+  }
+
+  /** Upserts chunk points, merging new locations into those already stored for the same chunk. */
+  private async upsertChunks(chunks: CodeChunk[]): Promise<void> {
+    const byId = new Map<string, { chunk: CodeChunk; locations: Map<string, LocationPayload> }>();
+    for (const chunk of chunks) {
+      const chunkId = getChunkDocumentId(chunk);
+      const entry = byId.get(chunkId) ?? { chunk, locations: new Map<string, LocationPayload>() };
+      // The last occurrence wins, like successive upserts would
+      entry.chunk = chunk;
+      const location: LocationPayload = {
+        id: getChunkLocationDocumentId({
+          chunk_id: chunkId,
+          filePath: chunk.filePath as string,
+          startLine: chunk.startLine as number,
+          endLine: chunk.endLine as number,
+          git_branch: chunk.git_branch,
+          workspace: chunk.workspace,
+        }),
+        filePath: chunk.filePath as string,
+        startLine: chunk.startLine as number,
+        endLine: chunk.endLine as number,
+        directoryPath: chunk.directoryPath,
+        directoryName: chunk.directoryName,
+        directoryDepth: chunk.directoryDepth,
+        gitFileHash: chunk.git_file_hash,
+        gitBranch: chunk.git_branch,
+        workspace: chunk.workspace,
+        blame: chunk.blame,
+      };
+      entry.locations.set(location.id, location);
+      byId.set(chunkId, entry);
+    }
+
+    const existing = await this.request<Array<QdrantPoint<Pick<ChunkPayload, 'locations' | 'created_at'>>>>(
+      'POST',
+      `/collections/${encodeURIComponent(this.collection)}/points`,
+      { ids: Array.from(byId.keys(), toPointId), with_payload: ['locations', 'created_at'] }
+    );
+    const existingById = new Map(existing.map((point) => [point.id, point.payload]));
+
+    const now = new Date().toISOString();
+    const points = Array.from(byId, ([chunkId, { chunk, locations }]) => {
+      const pointId = toPointId(chunkId);
+      const stored = existingById.get(pointId);
+      const merged = new Map((stored?.locations ?? []).map((location) => [location.id, location]));
+      locations.forEach((location, id) => merged.set(id, location));
+      const mergedLocations = Array.from(merged.values());
+      const payload: ChunkPayload = {
+        chunk_id: chunkId,
+        type: chunk.type,
+        language: chunk.language,
+        kind: chunk.kind,
+        containerPath: chunk.containerPath,
+        imports: chunk.imports,
+        symbols: chunk.symbols,
+        exports: chunk.exports,
+        parentSymbol: chunk.parentSymbol,
+        frontMatter: chunk.frontMatter,
+        chunk_hash: chunk.chunk_hash,
+        content: chunk.content,
+        semantic_text: chunk.semantic_text,
+        symbol_names: [
+          ...(chunk.symbols ?? []).map((symbol) => symbol.name),
+          ...(chunk.parentSymbol ? [chunk.parentSymbol] : []),
+        ],
+        symbol_tokens: getSymbolTokens(chunk),
+        locations: mergedLocations,
+        file_paths: Array.from(new Set(mergedLocations.map((location) => location.filePath))),
+        created_at: stored?.created_at ?? now,
+        updated_at: now,
+      };
+      return { id: pointId, vector: chunk.code_vector, payload };
+    });
+
+    await this.request('PUT', `/collections/${encodeURIComponent(this.collection)}/points?wait=true`, { points });
+  }
+
+  /**
+   * Converts a chunk point to a search result with its first location.
+   *
+   * @param matchesLocation If set, only matching locations are considered, and a chunk without one yields undefined.
+   */
+  private toSearchResult(
+    payload: ChunkPayload,
+    score: number,
+    matchesLocation?: (location: LocationPayload) => boolean
+  ): SearchResult | undefined {
+    const [location] = payload.locations
+      .filter((l) => !matchesLocation || matchesLocation(l))
+      .sort((a, b) => a.filePath.localeCompare(b.filePath) || a.startLine - b.startLine);
+    if (matchesLocation && !location) {
+      return undefined;
+    }
+    return {
+      id: payload.chunk_id,
+      score,
+      type: payload.type,
+      language: payload.language,
+      ...(payload.kind !== undefined ? { kind: payload.kind } : {}),
+      ...(payload.containerPath !== undefined ? { containerPath: payload.containerPath } : {}),
+      imports: payload.imports,
+      symbols: payload.symbols,
+      exports: payload.exports,
+      parentSymbol: payload.parentSymbol,
+      frontMatter: payload.frontMatter,
+      ...(location
+        ? {
+            filePath: location.filePath,
+            startLine: location.startLine,
+            endLine: location.endLine,
+            ...(location.gitFileHash !== undefined ? { git_file_hash: location.gitFileHash } : {}),
+            ...(location.workspace !== undefined ? { workspace: location.workspace } : {}),
+            ...(location.blame !== undefined ? { blame: location.blame } : {}),
+          }
+        : {}),
+      chunk_hash: payload.chunk_hash,
+      content: payload.content,
+      semantic_text: payload.semantic_text,
+      created_at: payload.created_at,
+      updated_at: payload.updated_at,
+    };
+  }
+
+  private async getCollectionInfo(collection: string): Promise<CollectionInfo | null> {
+    return this.request<CollectionInfo | null>('GET', `/collections/${encodeURIComponent(collection)}`, undefined, {
+      allowNotFound: true,
+    });
+  }
+
+  /** Reads every point matching a scroll request, following `next_page_offset`. */
+  private async scroll<P>(collection: string, body: Record<string, unknown>): Promise<Array<QdrantPoint<P>>> {
+    const points: Array<QdrantPoint<P>> = [];
+    for await (const page of this.scrollPages<P>(collection, { ...body, with_vector: false })) {
+      points.push(...page);
+    }
+    return points;
+  }
+
+  /** Reads the points matching a scroll request a page at a time, following `next_page_offset`. */
+  private async *scrollPages<P>(
+    collection: string,
+    body: Record<string, unknown>,
+    pageSize = SCROLL_PAGE_SIZE
+  ): AsyncIterable<Array<QdrantPoint<P>>> {
+    let offset: unknown;
+    do {
+      const page: { points: Array<QdrantPoint<P>>; next_page_offset?: unknown } = await this.request(
+        'POST',
+        `/collections/${encodeURIComponent(collection)}/points/scroll`,
+        { ...body, limit: pageSize, ...(offset != null ? { offset } : {}) }
+      );
+      yield page.points;
+      offset = page.next_page_offset;
+    } while (offset != null);
+  }
+
+  /**
+   * Calls the Qdrant HTTP API and returns the `result` of the response.
+   *
+   * @throws QdrantRequestError with Qdrant's error message for non-2xx responses (404 yields null if allowed).
+   */
+  private async request<T>(
+    method: string,
+    path: string,
+    body?: unknown,
+    options: { allowNotFound?: boolean } = {}
+  ): Promise<T> {
+    let response: Response;
+    try {
+      response = await fetch(`${this.url}${path}`, {
+        method,
+        headers: {
+          'content-type': 'application/json',
+          ...(this.apiKey ? { 'api-key': this.apiKey } : {}),
+        },
+        ...(body !== undefined ? { body: JSON.stringify(body) } : {}),
+      });
+    } catch (error) {
+      const message = error instanceof Error ? error.message : String(error);
+      throw new Error(`Could not reach Qdrant at ${this.url} (${message}). Check SCS_IDXR_QDRANT_URL.`);
+    }
+
+    if (response.status === 404 && options.allowNotFound) {
+      return null as T;
+    }
+    const text = await response.text();
+    const parsed = text.length > 0 ? (JSON.parse(text) as { result?: T; status?: { error?: string } }) : {};
+    if (!response.ok) {
+      const reason = parsed.status?.error ?? (text || response.statusText);
+      throw new QdrantRequestError(`Qdrant ${method} ${path} failed (${response.status}): ${reason}`, response.status);
+    }
+    return parsed.result as T;
+  }
+}
@@ -0,0 +1,155 @@
+import { rerankConfig } from '../config';
+import { SearchResult } from './elasticsearch';
+
+/**
+ * Rescores search candidates against the query, e.g. with a cross-encoder.
+ *
+ * Retrieval ranks chunks by vector or BM25 similarity; a reranker sees the query and each candidate
+ * together, which orders the top results better at the cost of one extra call per search.
+ */
+export interface Reranker {
+  /** Registry name of this reranker. */
+  readonly name: string;
+  /**
+   * Scores each candidate for the query, returning one score per candidate in the same order.
+   * Higher scores rank first; the scale is up to the reranker.
+   *
+   * @param query The search query.
+   * @param candidates The retrieved chunks to rescore.
+   * @param signal Optional signal used to abort in-flight work.
+   */
+  rerank(query: string, candidates: SearchResult[], signal?: AbortSignal): Promise<number[]>;
+}
+
+export type RerankerFactory = () => Reranker;
+
+const registry = new Map<string, RerankerFactory>();
+
+/**
+ * Registers a reranker factory under a name so it can be selected via `SCS_IDXR_RERANKER`.
+ *
+ * Registering an existing name replaces the previous factory.
+ */
+export function registerReranker(name: string, factory: RerankerFactory): void {
+  const key = name.trim().toLowerCase();
+  if (key.length === 0) {
+    throw new Error('Reranker name must be a non-empty string.');
+  }
+  registry.set(key, factory);
+}
+
+/**
+ * Returns the names of all registered rerankers, sorted alphabetically.
+ */
+export function listRerankers(): string[] {
+  return Array.from(registry.keys()).sort();
+}
+
+/**
+ * Creates a reranker instance by registry name.
+ *
+ * @throws If no reranker is registered under the given name.
+ */
+export function getReranker(name: string): Reranker {
+  const key = name.trim().toLowerCase();
+  const factory = registry.get(key);
+  if (!factory) {
+    throw new Error(`Unknown reranker "${name}". Registered rerankers: ${listRerankers().join(', ') || '(none)'}.`);
+  }
+  return factory();
+}
+
+/**
+ * Creates the reranker selected via `SCS_IDXR_RERANKER`, or `undefined` when none is configured.
+ */
+export function getConfiguredReranker(): Reranker | undefined {
+  const name = rerankConfig.reranker;
+  return name ? getReranker(name) : undefined;
+}
+
+/**
+ * Rescores candidates and returns them best first, with the reranker's score as their score.
+ *
+ * @throws If the reranker does not return one finite score per candidate.
+ */
+export async function rerankResults(
+  reranker: Reranker,
+  query: string,
+  candidates: SearchResult[],
+  signal?: AbortSignal
+): Promise<SearchResult[]> {
+  if (candidates.length === 0) {
+    return [];
+  }
+  const scores = await reranker.rerank(query, candidates, signal);
+  if (scores.length !== candidates.length || !scores.every(Number.isFinite)) {
+    throw new Error(
+      `Reranker "${reranker.name}" returned ${scores.length} scores for ${candidates.length} candidates; ` +
+        'expected one finite score per candidate.'
+    );
+  }
+  // Array.prototype.sort is stable, so ties keep their retrieval order.
+  return candidates.map((result, i) => ({ ...result, score: scores[i] })).sort((a, b) => b.score - a.score);
+}
+
+export interface HttpRerankerOptions {
+  /** Base URL of the service; candidates are posted to `<url>/rerank`. */
+  url: string;
+  /** Sent as a bearer token when set. */
+  apiKey?: string;
+}
+
+/**
+ * A reranker backed by a cross-encoder served over HTTP.
+ *
+ * Speaks the `/rerank` API of Hugging Face text-embeddings-inference: the body is `{ query, texts }` and
+ * the response lists `{ index, score }` per text, in any order.
+ */
+export class HttpReranker implements Reranker {
+  readonly name = 'http';
+  private readonly url: string;
+  private readonly apiKey?: string;
+
+  constructor(options: HttpRerankerOptions) {
+    this.url = options.url.replace(/\/+$/, '');
+    this.apiKey = options.apiKey;
+  }
+
+  async rerank(query: string, candidates: SearchResult[], signal?: AbortSignal): Promise<number[]> {
+    let response: Response;
+    try {
+      response = await fetch(`${this.url}/rerank`, {
+        method: 'POST',
+        headers: {
+          'content-type': 'application/json',
+          ...(this.apiKey ? { authorization: `Bearer ${this.apiKey}` } : {}),
+        },
+        body: JSON.stringify({ query, texts: candidates.map((candidate) => candidate.content) }),
+        signal,
+      });
+    } catch (error) {
+      signal?.throwIfAborted();
+      const message = error instanceof Error ? error.message : String(error);
+      throw new Error(`Could not reach the reranker at ${this.url} (${message}). Check SCS_IDXR_RERANKER_URL.`);
+    }
+
+    const text = await response.text();
+    if (!response.ok) {
+      throw new Error(`Reranker request failed (${response.status}): ${text || response.statusText}`);
+    }
+    const ranked = JSON.parse(text) as Array<{ index: number; score: number }>;
+    const scores = new Array<number>(candidates.length).fill(Number.NaN);
+    for (const { index, score } of ranked) {
+      scores[index] = score;
+    }
+    return scores;
+  }
+}
+
+registerReranker('http', () => {
+  const url = rerankConfig.url;
+  if (!url) {
+    throw new Error('The "http" reranker needs SCS_IDXR_RERANKER_URL to be set.');
+  }
+  return new HttpReranker({ url, apiKey: rerankConfig.apiKey });
+});
@@ -0,0 +1,519 @@
+import { createHash } from 'crypto';
+import fs from 'fs';
+import path from 'path';
+import {
+  ChunkBlame,
+  ChunkLocationSummary,
+  SearchResult,
+  getLocationsForChunkIds,
+  indexHasSemanticTextField,
+  searchCodeChunks,
+} from './elasticsearch';
+import { ChunkStore } from './chunk_store';
+import { Embedder } from './embedder';
+import { Reranker, rerankResults } from './reranker';
+import {
+  FusedResult,
+  FusionMethod,
+  SearchMode,
+  SearchSignal,
+  SignalContribution,
+  expandQueryIdentifiers,
+  fuseResults,
+} from './hybrid_search';
+import { HighlightSpan, highlightSnippet } from './highlight';
+import { POST_FILTER_CANDIDATE_FACTOR, PostFilterOptions, SearchFilters, fetchPostFiltered } from './search_filters';
+
+/** Most locations listed per hit in `SearchHit.locations`. */
+const MAX_HIT_LOCATIONS = 50;
+
+/** Orders of search hits: best match first, or most recently changed first (see `SearchHit.blame`). */
+export const SEARCH_SORTS = ['score', 'recency'] as const;
+export type SearchSort = (typeof SEARCH_SORTS)[number];
+
+/** Where a chunk occurs, see `SearchHit.locations`. */
+export interface SearchHitLocation {
+  filePath: string;
+  startLine: number;
+  endLine: number;
+}
+
+/** How the score of a hit came about, see `SearchRequest.explain`. */
+export interface ScoreExplanation {
+  mode: SearchMode;
+  /** How the signals were combined; null outside hybrid mode. */
+  fusion: FusionMethod | null;
+  /**
+   * What each signal whose results contained the hit added to `retrievalScore`. Outside hybrid mode this
+   * is the one signal, with weight 1, contributing its raw score.
+   */
+  signals: SignalContribution[];
+  /** Score after retrieval and fusion, before reranking. */
+  retrievalScore: number;
+  /** Score the reranker gave the hit; null without reranking. */
+  rerankScore: number | null;
+  /** The hit's `score`: `rerankScore` with reranking, else `retrievalScore`. */
+  score: number;
+}
+
+/**
+ * One search result as printed by `search --format json`.
+ *
+ * This shape is a public contract for editor integrations: fields are always present (null when
+ * unknown) and appear in this order. See "JSON output" in the README.
+ */
+export interface SearchHit {
+  filePath: string | null;
+  startLine: number | null;
+  endLine: number | null;
+  symbol: string | null;
+  kind: string | null;
+  language: string;
+  score: number;
+  snippet: string;
+  /** Up to `contextLines` lines preceding the chunk, read from the working tree; null unless requested. */
+  contextBefore: string[] | null;
+  /** Up to `contextLines` lines following the chunk, read from the working tree; null unless requested. */
+  contextAfter: string[] | null;
+  /**
+   * Whether the file changed since it was indexed, so the location and context may be off. Only checked
+   * when context lines are read; null when not checked or no content hash was recorded.
+   */
+  stale: boolean | null;
+  /** The retrieval signals whose results contained this chunk; both for a hybrid hit found by each. */
+  signals: SearchSignal[];
+  /**
+   * Every location of the chunk (up to 50), by file path and start line: identical code in several files,
+   * and the copies folded into it by deduplication. `filePath`, `startLine`, and `endLine` are one of them.
+   */
+  locations: SearchHitLocation[];
+  /** The commit that last changed the hit's lines; null unless the index was built with blame. */
+  blame: ChunkBlame | null;
+  /** Workspace the hit's location was indexed from; null for locations indexed before workspaces were recorded. */
+  workspace: string | null;
+  /**
+   * Parts of `snippet` matching the query's terms, in order; the signature line of `symbol` when none
+   * match literally, as for most semantic hits. See `highlightSnippet`.
+   */
+  highlights: HighlightSpan[];
+  /** How `score` was computed; only present when the search was asked to explain its hits. */
+  explain?: ScoreExplanation;
+}
+
+export interface SearchRequest {
+  /** Maximum number of hits returned. */
+  limit: number;
+  /** Retrieval signal(s) to rank by. */
+  mode: SearchMode;
+  /** Weight of the semantic signal in hybrid mode, in [0, 1]. */
+  alpha: number;
+  /** How hybrid mode combines the two rankings. */
+  fusion: FusionMethod;
+  filters: SearchFilters;
+  /** Hits scoring below this value are dropped; with a reranker, this applies to the reranker's scores. */
+  minScore?: number;
+  /** Appends the words of compound identifiers in the query to the text that is embedded. */
+  expandQuery?: boolean;
+  /** Rescores the retrieved candidates before the best `limit` are kept; unset skips this stage. */
+  reranker?: Reranker;
+  /** Candidates retrieved and passed to the reranker (at least `limit`). */
+  rerankCandidates?: number;
+  /** Number of lines before and after each chunk to read from the working tree; 0 reads none. */
+  contextLines: number;
+  /** Orders the hits kept by best match (default) or by the date of their last commit, newest first. */
+  sort?: SearchSort;
+  /**
+   * Keeps only hits whose lines were last changed at or after this ISO 8601 date. Hits without blame
+   * never match; more candidates are retrieved to make up for the ones dropped.
+   */
+  changedSince?: string;
+  /**
+   * Candidates retrieved per hit when a filter is applied after retrieval: `changedSince`, `exclude`, and
+   * the path and workspace filters on Elasticsearch and Qdrant (default: `POST_FILTER_CANDIDATE_FACTOR`).
+   */
+  overfetchFactor?: number;
+  /** Repository checkout that indexed paths are relative to, for context lines. */
+  root: string;
+  /** Adds `SearchHit.explain` to every hit. */
+  explain?: boolean;
+  /**
+   * Leaves out the chunk locations overlapping these lines of this file, such as the code a similarity
+   * search starts from. A chunk stored at other locations too is reported at the first of those instead.
+   */
+  exclude?: SearchHitLocation;
+}
+
+/** A search hit together with its chunk id and the content hash of its file at indexing time. */
+interface RetrievedHit {
+  chunkId: string;
+  hit: SearchHit;
+  gitFileHash: string | null;
+}
+
+interface SourceFile {
+  lines: string[];
+  gitFileHash: string;
+}
+
+/**
+ * Trims a chunk for display: drops leading/trailing blank lines and trailing whitespace, and removes
+ * the indentation shared by all non-blank lines.
+ *
+ * @param content The chunk content.
+ * @param maxLines If set, keeps at most this many lines and appends a marker with the number cut.
+ */
+export function trimSnippet(content: string, maxLines?: number): string {
+  const lines = content
+    .replace(/\r\n/g, '\n')
+    .split('\n')
+    .map((line) => line.trimEnd());
+  while (lines.length > 0 && lines[0] === '') {
+    lines.shift();
+  }
+  while (lines.length > 0 && lines[lines.length - 1] === '') {
+    lines.pop();
+  }
+
+  const indents = lines.filter((line) => line !== '').map((line) => line.match(/^[ \t]*/)?.[0].length ?? 0);
+  const indent = indents.length > 0 ? Math.min(...indents) : 0;
+  const dedented = lines.map((line) => line.slice(indent));
+
+  if (maxLines !== undefined && dedented.length > maxLines) {
+    const hidden = dedented.length - maxLines;
+    return [...dedented.slice(0, maxLines), `... (${hidden} more line${hidden === 1 ? '' : 's'})`].join('\n');
+  }
+  return dedented.join('\n');
+}
+
+/**
+ * Computes the git blob hash of file contents, the same value `git hash-object` records at indexing time.
+ */
+export function gitBlobHash(content: Buffer): string {
+  return createHash('sha1').update(`blob ${content.length}\0`).update(content).digest('hex');
+}
+
+function readSourceFile(root: string, filePath: string, cache: Map<string, SourceFile | null>): SourceFile | null {
+  if (!cache.has(filePath)) {
+    let file: SourceFile | null = null;
+    try {
+      const content = fs.readFileSync(path.join(root, filePath));
+      const lines = content.toString('utf8').replace(/\r\n/g, '\n').split('\n');
+      if (lines.length > 0 && lines[lines.length - 1] === '') {
+        lines.pop();
+      }
+      file = { lines, gitFileHash: gitBlobHash(content) };
+    } catch {
+      // Deleted or unreadable since indexing
+    }
+    cache.set(filePath, file);
+  }
+  return cache.get(filePath) ?? null;
+}
+
+/**
+ * Reads the lines around a hit from the working tree and flags it as stale if the file no longer has
+ * the content hash recorded at indexing time.
+ *
+ * @param cache Files already read during this search, keyed by path.
+ */
+function withContext(
+  { hit, gitFileHash }: RetrievedHit,
+  contextLines: number,
+  root: string,
+  cache: Map<string, SourceFile | null>
+): SearchHit {
+  if (!hit.filePath || hit.startLine === null || hit.endLine === null) {
+    return hit;
+  }
+  const file = readSourceFile(root, hit.filePath, cache);
+  if (!file) {
+    return { ...hit, stale: true };
+  }
+  return {
+    ...hit,
+    contextBefore: file.lines.slice(Math.max(0, hit.startLine - 1 - contextLines), hit.startLine - 1),
+    contextAfter: file.lines.slice(hit.endLine, hit.endLine + contextLines),
+    stale: gitFileHash ? file.gitFileHash !== gitFileHash : null,
+  };
+}
+
+/** Counts the blank lines `trimSnippet` drops from the start of a chunk. */
+function countLeadingBlankLines(content: string): number {
+  return (content.match(/^(?:[ \t]*\r?\n)*/)?.[0] ?? '').split('\n').length - 1;
+}
+
+function toSearchHit(
+  result: SearchResult,
+  signals: SearchSignal[],
+  query: string,
+  location?: ChunkLocationSummary,
+  explain?: ScoreExplanation
+): RetrievedHit {
+  const filePath = result.filePath ?? location?.filePath ?? null;
+  const startLine = (result.filePath ? result.startLine : location?.startLine) ?? null;
+  const symbol = result.parentSymbol ?? result.symbols?.[0]?.name ?? null;
+  const snippet = trimSnippet(result.content);
+  const firstLine = startLine === null ? null : startLine + countLeadingBlankLines(result.content);
+  const hit: SearchHit = {
+    filePath,
+    startLine,
+    endLine: (result.filePath ? result.endLine : location?.endLine) ?? null,
+    symbol,
+    kind: result.kind ?? null,
+    language: result.language,
+    score: result.score,
+    snippet,
+    contextBefore: null,
+    contextAfter: null,
+    stale: null,
+    signals,
+    locations: [],
+    blame: (result.filePath ? result.blame : location?.blame) ?? null,
+    workspace: (result.filePath ? result.workspace : location?.workspace) ?? null,
+    highlights: highlightSnippet(snippet, query, symbol, firstLine),
+    ...(explain && { explain }),
+  };
+  return {
+    chunkId: result.id,
+    hit,
+    gitFileHash: (result.filePath ? result.git_file_hash : location?.gitFileHash) ?? null,
+  };
+}
+
+/** Lists the stored locations of a hit, falling back to its own location if the store returned none. */
+function getHitLocations(hit: SearchHit, stored: ChunkLocationSummary[] | undefined): SearchHitLocation[] {
+  if (stored && stored.length > 0) {
+    return stored.map(({ filePath, startLine, endLine }) => ({ filePath, startLine, endLine }));
+  }
+  if (hit.filePath === null || hit.startLine === null || hit.endLine === null) {
+    return [];
+  }
+  return [{ filePath: hit.filePath, startLine: hit.startLine, endLine: hit.endLine }];
+}
+
+/** Whether a location is in the file of `excluded` and shares at least one line with it. */
+function overlapsLocation(
+  location: { filePath: string | null; startLine: number | null; endLine: number | null },
+  excluded: SearchHitLocation
+): boolean {
+  return (
+    location.filePath === excluded.filePath &&
+    location.startLine !== null &&
+    location.endLine !== null &&
+    location.startLine <= excluded.endLine &&
+    location.endLine >= excluded.startLine
+  );
+}
+
+/** Reports a hit at another location of its chunk, moving its highlights along with its lines. */
+function moveHit({ chunkId, hit }: RetrievedHit, location: ChunkLocationSummary): RetrievedHit {
+  const shift = location.startLine - (hit.startLine ?? location.startLine);
+  return {
+    chunkId,
+    gitFileHash: location.gitFileHash ?? null,
+    hit: {
+      ...hit,
+      filePath: location.filePath,
+      startLine: location.startLine,
+      endLine: location.endLine,
+      blame: location.blame ?? null,
+      workspace: location.workspace ?? null,
+      highlights: hit.highlights.map((span) => ({ ...span, line: span.line === null ? null : span.line + shift })),
+    },
+  };
+}
+
+/**
+ * Leaves out the hits at locations overlapping `excluded`. A chunk with another location that does not
+ * overlap, such as a copy of the code in another file, is kept and moved there.
+ */
+async function excludeLocation(
+  store: ChunkStore,
+  retrieved: RetrievedHit[],
+  excluded: SearchHitLocation
+): Promise<RetrievedHit[]> {
+  const overlapping = retrieved.filter(({ hit }) => overlapsLocation(hit, excluded)).map(({ chunkId }) => chunkId);
+  if (overlapping.length === 0) {
+    return retrieved;
+  }
+  const locationsByChunkId = await store.getChunkLocations(overlapping, MAX_HIT_LOCATIONS);
+  return retrieved.flatMap((entry) => {
+    if (!overlapsLocation(entry.hit, excluded)) {
+      return [entry];
+    }
+    const other = locationsByChunkId[entry.chunkId]?.find((location) => !overlapsLocation(location, excluded));
+    return other ? [moveHit(entry, other)] : [];
+  });
+}
+
+/**
+ * Runs top-k semantic retrieval for a query.
+ *
+ * With a client-side embedder the query is embedded locally and the store is searched by vector.
+ * Otherwise the query goes to Elasticsearch `semantic_text` inference.
+ */
+async function semanticSearch(
+  store: ChunkStore,
+  embedder: Embedder | undefined,
+  query: string,
+  index: string,
+  limit: number,
+  filters: SearchFilters,
+  options: PostFilterOptions
+): Promise<SearchResult[]> {
+  if (embedder) {
+    const [queryVector] = await embedder.embed([query]);
+    return store.search(queryVector, limit, filters, options);
+  }
+  if (store.backend === 'elasticsearch') {
+    const semanticTextEnabled = await indexHasSemanticTextField(index);
+    if (!semanticTextEnabled) {
+      throw new Error(
+        `Index "${index}" does not have a "semantic_text" mapping, so semantic search cannot run. ` +
+          'This usually happens when the index was created with semantic text disabled. ' +
+          'Recreate the index with semantic text enabled and reindex your code, or use --mode keyword.'
+      );
+    }
+    return searchCodeChunks(query, index, limit, filters, options);
+  }
+  throw new Error(
+    `The "${store.backend}" store cannot embed queries. Set SCS_IDXR_EMBEDDER to the embedder used for indexing.`
+  );
+}
+
+/**
+ * Runs top-k retrieval for a query with the semantic signal, the keyword (BM25) signal, or both fused.
+ *
+ * Returns the hits along with the number of chunks `retrieved`, counted before the windows of a split
+ * function are collapsed into one hit, so it tells whether the store ran out of matches.
+ *
+ * @param wanted Number of chunks to retrieve, before reranking candidates are added.
+ */
+async function retrieve(
+  store: ChunkStore,
+  embedder: Embedder | undefined,
+  index: string,
+  query: string,
+  request: SearchRequest,
+  wanted: number
+): Promise<{ hits: RetrievedHit[]; retrieved: number }> {
+  const { mode, filters, reranker } = request;
+  const limit = reranker ? Math.max(wanted, request.rerankCandidates ?? wanted) : wanted;
+  const options = { overfetchFactor: request.overfetchFactor };
+
+  const semanticQuery = request.expandQuery ? expandQueryIdentifiers(query) : query;
+  const semantic =
+    mode !== 'keyword' ? await semanticSearch(store, embedder, semanticQuery, index, limit, filters, options) : [];
+  const keyword = mode !== 'semantic' ? await store.keywordSearch(query, limit, filters, options) : [];
+  let fused: FusedResult[] =
+    mode === 'hybrid'
+      ? fuseResults(semantic, keyword, { alpha: request.alpha, method: request.fusion })
+      : (mode === 'semantic' ? semantic : keyword).map((result, rank) => ({
+          result,
+          signals: [mode],
+          contributions: [
+            { signal: mode, rawScore: result.score, rank: rank + 1, weight: 1, contribution: result.score },
+          ],
+        }));
+  const retrievedById = new Map(fused.map((entry) => [entry.result.id, entry]));
+  if (reranker) {
+    const candidates = fused.slice(0, limit).map(({ result }) => result);
+    fused = (await rerankResults(reranker, query, candidates)).map((result) => ({
+      result,
+      signals: retrievedById.get(result.id)?.signals ?? [],
+      contributions: retrievedById.get(result.id)?.contributions ?? [],
+    }));
+  }
+  const explain = (result: SearchResult, contributions: SignalContribution[]): ScoreExplanation => ({
+    mode,
+    fusion: mode === 'hybrid' ? request.fusion : null,
+    signals: contributions,
+    retrievalScore: retrievedById.get(result.id)?.result.score ?? result.score,
+    rerankScore: reranker ? result.score : null,
+    score: result.score,
+  });
+  const results = fused.map(({ result }) => result);
+
+  // Elasticsearch chunk documents do not carry locations; look them up in `<index>_locations`.
+  const withoutLocation = results.filter((result) => !result.filePath).map((result) => result.id);
+  const locationsByChunkId =
+    withoutLocation.length > 0 && store.backend === 'elasticsearch'
+      ? await getLocationsForChunkIds(withoutLocation, { index, perChunkLimit: 1 })
+      : {};
+
+  // A long function split into windows can match in several of them; keep only its best-scoring window.
+  const seenWindows = new Set<string>();
+  const hits = fused.flatMap(({ result, signals, contributions }) => {
+    const location = locationsByChunkId[result.id]?.[0];
+    const retrieved = toSearchHit(
+      result,
+      signals,
+      query,
+      location,
+      request.explain ? explain(result, contributions) : undefined
+    );
+    if (result.parentSymbol) {
+      const key = `${retrieved.hit.filePath ?? ''}:${result.containerPath ?? ''}:${result.parentSymbol}`;
+      if (seenWindows.has(key)) {
+        return [];
+      }
+      seenWindows.add(key);
+    }
+    return [retrieved];
+  });
+  return { hits, retrieved: fused.length };
+}
+
+/**
+ * Searches an index and returns at most `request.limit` hits, best match first.
+ *
+ * With `request.reranker`, `request.rerankCandidates` chunks are retrieved and rescored by the reranker
+ * first; without one, retrieval fetches only `request.limit` chunks and no reranking cost is incurred.
+ * More are fetched only when windows of the same function, shown as one hit, leave fewer than that.
+ *
+ * @param store The store holding the index.
+ * @param embedder Embeds the query for semantic search; without one, Elasticsearch `semantic_text` is used.
+ * @param index The index name.
+ * @param query The search query.
+ * @param request Ranking, filters, and context settings.
+ */
+export async function searchIndex(
+  store: ChunkStore,
+  embedder: Embedder | undefined,
+  index: string,
+  query: string,
+  request: SearchRequest
+): Promise<SearchHit[]> {
+  const { limit, minScore, contextLines, changedSince, exclude } = request;
+  // Without a filter only the windows of split functions, collapsed into one hit each, can leave fewer
+  // than `limit` hits, so the first batch asks for no more candidates than that.
+  const postFiltered = changedSince !== undefined || exclude !== undefined;
+  const overfetchFactor = postFiltered ? (request.overfetchFactor ?? POST_FILTER_CANDIDATE_FACTOR) : 1;
+  const retrieved = (
+    await fetchPostFiltered(limit, overfetchFactor, async (candidates) => {
+      const { hits, retrieved: fetched } = await retrieve(store, embedder, index, query, request, candidates);
+      const changed =
+        changedSince === undefined
+          ? hits
+          : hits.filter(({ hit }) => hit.blame !== null && hit.blame.date >= changedSince);
+      const results = exclude === undefined ? changed : await excludeLocation(store, changed, exclude);
+      return { results, exhausted: fetched < candidates };
+    })
+  )
+    .filter(({ hit }) => minScore === undefined || hit.score >= minScore)
+    .slice(0, limit);
+  if (request.sort === 'recency') {
+    // Stable, so hits changed in the same commit keep their ranking
+    retrieved.sort((a, b) => (b.hit.blame?.date ?? '').localeCompare(a.hit.blame?.date ?? ''));
+  }
+  const chunkIds = retrieved.map(({ chunkId }) => chunkId);
+  const locationsByChunkId = chunkIds.length > 0 ? await store.getChunkLocations(chunkIds, MAX_HIT_LOCATIONS) : {};
+  const files = new Map<string, SourceFile | null>();
+  return retrieved.map(({ chunkId, hit, gitFileHash }) => {
+    const locations = getHitLocations(hit, locationsByChunkId[chunkId]).filter(
+      (location) => exclude === undefined || !overlapsLocation(location, exclude)
+    );
+    const located = { chunkId, gitFileHash, hit: { ...hit, locations } };
+    return contextLines > 0 ? withContext(located, contextLines, request.root, files) : located.hit;
+  });
+}
@@ -0,0 +1,181 @@
+import { isInWorkspace } from './workspace';
+
+/**
+ * Restricts search results to chunks of one language, under one path, of one symbol kind, or of one
+ * workspace. Filters that are set must all match.
+ */
+export interface SearchFilters {
+  /** Language name, e.g. `go`. */
+  language?: string;
+  /** Path prefix such as `internal/`, or a glob such as `cmd/**` or `src/*.ts` (see `createPathMatcher`). */
+  path?: string;
+  /** A category from `SYMBOL_KIND_CATEGORIES` (`func`, `type`, `const`), or a tree-sitter node type. */
+  kind?: string;
+  /** Workspace name; locations stored before workspaces were recorded match any (see `isInWorkspace`). */
+  workspace?: string;
+}
+
+/**
+ * Candidates fetched per requested result when a filter can only be applied after retrieval, unless
+ * `PostFilterOptions.overfetchFactor` says otherwise.
+ */
+export const POST_FILTER_CANDIDATE_FACTOR = 10;
+
+/**
+ * Most candidates a post-filtered search retrieves before it settles for fewer results than asked for.
+ * Matches the default `index.max_result_window` of Elasticsearch.
+ */
+export const MAX_POST_FILTER_CANDIDATES = 10000;
+
+/** Tunes searches whose filters are applied after retrieval. */
+export interface PostFilterOptions {
+  /** Candidates fetched per requested result, at least 1 (default: `POST_FILTER_CANDIDATE_FACTOR`). */
+  overfetchFactor?: number;
+}
+
+/**
+ * Retrieves up to `k` results of a search whose filter is applied after retrieval.
+ *
+ * `fetch` is first asked for `k * overfetchFactor` candidates. While fewer than `k` of them pass the
+ * filter and the store has more, the search is run again for `overfetchFactor` (at least twice) as many,
+ * up to `MAX_POST_FILTER_CANDIDATES`. A filter that matches nothing therefore costs a few searches,
+ * never an unbounded scan.
+ *
+ * @param fetch Retrieves the given number of candidates, best first, and returns those that pass the
+ *   filter, in order, and whether the store had no more than were asked for.
+ */
+export async function fetchPostFiltered<T>(
+  k: number,
+  overfetchFactor: number,
+  fetch: (candidates: number) => Promise<{ results: T[]; exhausted: boolean }>
+): Promise<T[]> {
+  const maxCandidates = Math.max(k, MAX_POST_FILTER_CANDIDATES);
+  let candidates = Math.min(Math.ceil(k * overfetchFactor), maxCandidates);
+  for (;;) {
+    const { results, exhausted } = await fetch(candidates);
+    if (results.length >= k || exhausted || candidates >= maxCandidates) {
+      return results.slice(0, k);
+    }
+    candidates = Math.min(Math.ceil(candidates * Math.max(2, overfetchFactor)), maxCandidates);
+  }
+}
+
+/**
+ * The chunk kinds (tree-sitter node types) that `--kind` categories stand for, across languages.
+ */
+export const SYMBOL_KIND_CATEGORIES: Record<string, string[]> = {
+  func: [
+    'function_declaration',
+    'function_definition',
+    'function_item',
+    'function_expression',
+    'generator_function_declaration',
+    'arrow_function',
+    'method_declaration',
+    'method_definition',
+    'constructor_declaration',
+    'secondary_constructor',
+    'decorated_definition',
+  ],
+  type: [
+    'class_declaration',
+    'class_definition',
+    'class_specifier',
+    'interface_declaration',
+    'type_alias_declaration',
+    'type_declaration',
+    'type_definition',
+    'type_spec',
+    'struct_specifier',
+    'union_specifier',
+    'enum_declaration',
+    'enum_definition',
+    'enum_specifier',
+    'trait_definition',
+    'object_definition',
+    'record_declaration',
+    'object_declaration',
+    'companion_object',
+    'type_alias',
+    'struct_item',
+    'enum_item',
+    'union_item',
+    'trait_item',
+    'type_item',
+  ],
+  const: [
+    'const_declaration',
+    'const_spec',
+    'const_item',
+    'static_item',
+    'lexical_declaration',
+    'var_declaration',
+    'variable_declaration',
+  ],
+};
+
+/**
+ * Returns the chunk kinds a kind filter matches: the members of a category, or the kind itself.
+ */
+export function expandKindFilter(kind: string): string[] {
+  return SYMBOL_KIND_CATEGORIES[kind] ?? [kind];
+}
+
+/** Whether any filter is set. */
+export function hasSearchFilters(filters: SearchFilters | undefined): filters is SearchFilters {
+  return Boolean(filters?.language || filters?.path || filters?.kind || filters?.workspace);
+}
+
+function globToRegExp(glob: string): RegExp {
+  let source = '';
+  for (let i = 0; i < glob.length; i++) {
+    const char = glob[i];
+    if (char === '*' && glob[i + 1] === '*') {
+      i++;
+      if (glob[i + 1] === '/') {
+        // `**/` also matches no directory at all
+        i++;
+        source += '(?:.*/)?';
+      } else {
+        source += '.*';
+      }
+    } else if (char === '*') {
+      source += '[^/]*';
+    } else if (char === '?') {
+      source += '[^/]';
+    } else {
+      source += char.replace(/[.+^${}()|[\]\\]/g, '\\$&');
+    }
+  }
+  return new RegExp(`^${source}$`);
+}
+
+/**
+ * Creates a predicate for repository-relative file paths.
+ *
+ * A pattern containing `*` or `?` is a glob matched against the whole path: `*` and `?` stay within
+ * one directory, `**` spans directories. Any other pattern is a plain path prefix, so `internal/`
+ * matches everything under that directory.
+ */
+export function createPathMatcher(pattern: string): (filePath: string) => boolean {
+  const normalized = pattern.replace(/^\.\//, '');
+  if (!/[*?]/.test(normalized)) {
+    return (filePath) => filePath.startsWith(normalized);
+  }
+  const regExp = globToRegExp(normalized);
+  return (filePath) => regExp.test(filePath);
+}
+
+/**
+ * Creates a predicate for the locations that pass the path and workspace filters, which stores
+ * without per-location queries check after retrieval. Returns undefined if neither filter is set.
+ */
+export function createLocationMatcher(
+  filters: SearchFilters | undefined
+): ((location: { filePath: string; workspace?: string | null }) => boolean) | undefined {
+  if (!filters?.path && !filters?.workspace) {
+    return undefined;
+  }
+  const matchesPath = filters.path ? createPathMatcher(filters.path) : () => true;
+  return (location) => matchesPath(location.filePath) && isInWorkspace(location.workspace, filters.workspace);
+}
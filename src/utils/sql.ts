@@ -0,0 +1,161 @@
+import { SymbolInfo } from './elasticsearch';
+
+/**
+ * Statement shapes a string literal must have to be taken for SQL, by statement verb. A verb alone is
+ * not enough (`Update the cache`, `Delete this file?`): each shape also needs what follows the verb in
+ * a real statement, such as `UPDATE <table> SET <column> =`.
+ */
+const STATEMENT_SHAPES: Record<string, RegExp> = {
+  select: /^select\s+(?:distinct\s+)?[\s\S]+?\sfrom\s+[\w."`[]/i,
+  insert: /^insert\s+(?:or\s+\w+\s+)?into\s+[\w."`[]/i,
+  update: /^update\s+[\w."`[\]]+\s+set\s+[\w."`[\]]+\s*=/i,
+  delete: /^delete\s+from\s+[\w."`[]/i,
+  create:
+    /^create\s+(?:or\s+replace\s+)?(?:(?:temp|temporary|unique|materialized)\s+)?(?:table|view|index|trigger|function|procedure|schema|sequence|type)\s/i,
+  alter: /^alter\s+(?:table|view|index|sequence|schema|type)\s+[\w."`[]/i,
+  drop: /^drop\s+(?:table|view|index|trigger|function|procedure|schema|sequence|type)\s/i,
+  with: /^with\s+(?:recursive\s+)?\w+\s*(?:\([^)]*\)\s*)?as\s*\(/i,
+};
+
+/** Verbs a statement is recognized by, in the order they are tried. */
+const STATEMENT_VERBS = Object.keys(STATEMENT_SHAPES);
+
+/** Clause keywords (`where`, `join`, `values`, …) that prose rarely has after a statement verb. */
+const CLAUSE_PATTERN = /\b(?:where|join|group\s+by|order\s+by|limit|values|returning|on\s+conflict|primary\s+key)\b/i;
+
+/** Placeholders of the common drivers: `?`, `$1`, `:name`, `%s`, `%(name)s`, and `@name`. */
+const PLACEHOLDER_PATTERN = /\?|\$\d+|(?<![:\w]):[a-z_]\w*|%(?:\(\w+\))?s|@[a-z_]\w*/i;
+
+/** Leading whitespace, `-- line` comments, and `/* block *\/` comments. */
+const LEADING_COMMENTS_PATTERN = /^(?:\s+|--[^\n]*(?:\n|$)|\/\*[\s\S]*?\*\/)*/;
+
+/** Returns the SQL of a statement without its leading whitespace and comments. */
+function stripLeadingComments(text: string): string {
+  return text.replace(LEADING_COMMENTS_PATTERN, '');
+}
+
+/**
+ * Returns the verb of a string that has the shape of a SQL statement (`select`, `update`, …), or
+ * undefined if it does not look like SQL.
+ *
+ * Beyond the statement shape, a lowercase statement must also have a clause keyword, a `*`, or a
+ * driver placeholder, and must not end like a sentence, so `Select a file from the list.` is not SQL
+ * while `select id from users where id = ?` is.
+ */
+export function getSqlStatementVerb(text: string): string | undefined {
+  const statement = stripLeadingComments(text).trim();
+  const verb = STATEMENT_VERBS.find((candidate) => STATEMENT_SHAPES[candidate].test(statement));
+  if (!verb) {
+    return undefined;
+  }
+  if (statement.startsWith(verb.toUpperCase())) {
+    return verb;
+  }
+  if (/[.!]$/.test(statement)) {
+    return undefined;
+  }
+  const hasSqlSyntax =
+    CLAUSE_PATTERN.test(statement) || statement.includes('*') || PLACEHOLDER_PATTERN.test(statement);
+  return hasSqlSyntax ? verb : undefined;
+}
+
+/** A statement of a SQL script, see `splitSqlStatements`. */
+export interface SqlStatement {
+  /** The statement with the comments directly above it, and its closing `;` if it has one. */
+  text: string;
+  /** Offset of `text` in the script. */
+  start: number;
+  /** Lowercased first keyword of the statement, e.g. `create` or `grant`. */
+  keyword: string;
+}
+
+/**
+ * Splits a SQL script into its statements at each `;` that is not inside a string, a quoted name, a
+ * comment, or a dollar-quoted (`$$ … $$`) function body.
+ *
+ * Comments directly above a statement belong to it. Parts holding nothing but comments and whitespace
+ * are left out.
+ */
+export function splitSqlStatements(script: string): SqlStatement[] {
+  const statements: SqlStatement[] = [];
+  let start = 0;
+  const pushStatement = (end: number) => {
+    const raw = script.slice(start, end);
+    const leading = raw.length - raw.trimStart().length;
+    const text = raw.trim();
+    const keyword = stripLeadingComments(text).match(/^\w+/)?.[0].toLowerCase();
+    if (keyword) {
+      statements.push({ text, start: start + leading, keyword });
+    }
+    start = end;
+  };
+
+  let i = 0;
+  while (i < script.length) {
+    const char = script[i];
+    if (char === "'" || char === '"' || char === '`') {
+      // Doubled quotes (`'it''s'`) close and reopen the string, which comes out the same
+      const close = script.indexOf(char, i + 1);
+      i = close < 0 ? script.length : close + 1;
+    } else if (char === '-' && script[i + 1] === '-') {
+      const close = script.indexOf('\n', i);
+      i = close < 0 ? script.length : close + 1;
+    } else if (char === '/' && script[i + 1] === '*') {
+      const close = script.indexOf('*/', i + 2);
+      i = close < 0 ? script.length : close + 2;
+    } else if (char === '$') {
+      const tag = script.slice(i).match(/^\$(?:[a-z_]\w*)?\$/i)?.[0];
+      const close = tag ? script.indexOf(tag, i + tag.length) : -1;
+      i = tag ? (close < 0 ? script.length : close + tag.length) : i + 1;
+    } else if (char === ';') {
+      i++;
+      pushStatement(i);
+    } else {
+      i++;
+    }
+  }
+  pushStatement(script.length);
+  return statements;
+}
+
+/** Table names following the keywords that name the tables a statement reads or writes. */
+const TABLE_REFERENCE_PATTERN = /\b(?:from|join|into|update|table(?:\s+if\s+(?:not\s+)?exists)?)\s+([\w."`[\]]+)/gi;
+
+const NOT_TABLE_NAMES = /^(?:select|set|values|skip|nowait|of|lateral|only)$/i;
+
+const CREATE_TABLE_PATTERN = /^create\s+(?:(?:temp|temporary)\s+)?table\s+(?:if\s+not\s+exists\s+)?([\w."`[\]]+)/i;
+
+/** Removes the quotes of a quoted name, e.g. `"public"."orders"` becomes `public.orders`. */
+function unquoteName(name: string): string {
+  return name.replace(/["`[\]]/g, '');
+}
+
+/**
+ * Finds the tables a statement names: the table a `CREATE TABLE` defines as `table.name`, and the
+ * tables it reads or writes (`FROM`, `JOIN`, `INTO`, `UPDATE`, `ALTER TABLE`, …) as `table.reference`.
+ *
+ * @param statement The SQL of the statement.
+ * @param firstLine File line of the statement's first line.
+ */
+export function getSqlTableSymbols(statement: string, firstLine: number): SymbolInfo[] {
+  const sql = stripLeadingComments(statement);
+  const offset = statement.length - sql.length;
+  const lineOf = (index: number) => firstLine + (statement.slice(0, offset + index).match(/\n/g) ?? []).length;
+  const defined = sql.match(CREATE_TABLE_PATTERN)?.[1];
+  const symbols: SymbolInfo[] = [];
+  const seen = new Set<string>();
+  if (defined) {
+    symbols.push({ name: unquoteName(defined), kind: 'table.name', line: lineOf(0) });
+    seen.add(unquoteName(defined).toLowerCase());
+  }
+  for (const match of sql.matchAll(TABLE_REFERENCE_PATTERN)) {
+    const name = unquoteName(match[1]);
+    // Keywords after `UPDATE` in `DO UPDATE SET` and `FOR UPDATE SKIP LOCKED` are not tables
+    if (!/^[a-z_]/i.test(name) || seen.has(name.toLowerCase()) || NOT_TABLE_NAMES.test(name)) {
+      continue;
+    }
+    seen.add(name.toLowerCase());
+    symbols.push({ name, kind: 'table.reference', line: lineOf(match.index) });
+  }
+  return symbols;
+}
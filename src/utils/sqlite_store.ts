@@ -0,0 +1,930 @@
+import path from 'path';
+import fs from 'fs';
+import Database from 'better-sqlite3';
+import {
+  BulkIndexFailed,
+  BulkIndexResult,
+  BulkIndexSucceeded,
+  ChunkBlame,
+  ChunkLocationSummary,
+  CodeChunk,
+  DeleteDocumentsResult,
+  EmbeddingModel,
+  SearchResult,
+  StoreStats,
+  getChunkDocumentId,
+  getChunkLocationDocumentId,
+} from './elasticsearch';
+import { ChunkStore } from './chunk_store';
+import { extractKeywordTerms, getSymbolTokens, tokenizeIdentifiers } from './hybrid_search';
+import { logger } from './logger';
+import { SearchFilters, createPathMatcher, expandKindFilter } from './search_filters';
+import {
+  DEFAULT_VECTOR_METRIC,
+  VectorMetric,
+  euclideanScore,
+  prepareChunkVectors,
+  prepareVector,
+  scoreVectors,
+} from './vector_metric';
+import { SymbolName } from './symbol_search';
+import { WorkspaceStats } from './workspace';
+
+const SETTING_VECTOR_DIMENSIONS = 'vector_dimensions';
+/** Metric the stored vectors were prepared for; stores written before it was recorded used cosine. */
+const SETTING_VECTOR_METRIC = 'vector_metric';
+/** Embedder and embed template the stored vectors were made with, see `canReuseStoredVectors`. */
+const SETTING_EMBEDDER = 'embedder';
+const SETTING_EMBED_TEMPLATE = 'embed_template';
+
+/** Columns added to `chunk_locations` after its first release, with their types. */
+const ADDED_LOCATION_COLUMNS = [
+  ['blame_commit', 'TEXT'],
+  ['blame_author', 'TEXT'],
+  ['blame_date', 'TEXT'],
+  ['workspace', 'TEXT'],
+] as const;
+
+const SCHEMA = `
+  CREATE TABLE IF NOT EXISTS chunks (
+    id TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    language TEXT NOT NULL,
+    kind TEXT,
+    container_path TEXT,
+    chunk_hash TEXT NOT NULL,
+    content TEXT NOT NULL,
+    semantic_text TEXT NOT NULL,
+    metadata TEXT NOT NULL,
+    embedding BLOB,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+  );
+  CREATE TABLE IF NOT EXISTS chunk_locations (
+    id TEXT PRIMARY KEY,
+    chunk_id TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    directory_path TEXT,
+    directory_name TEXT,
+    directory_depth INTEGER,
+    git_file_hash TEXT,
+    git_branch TEXT,
+    workspace TEXT,
+    blame_commit TEXT,
+    blame_author TEXT,
+    blame_date TEXT,
+    updated_at TEXT NOT NULL
+  );
+  CREATE INDEX IF NOT EXISTS idx_chunk_locations_file_path ON chunk_locations (file_path);
+  CREATE INDEX IF NOT EXISTS idx_chunk_locations_chunk_id ON chunk_locations (chunk_id);
+  CREATE TABLE IF NOT EXISTS store_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+  );
+`;
+
+// Full-text index for keyword search. '_' and '$' are token characters so identifiers stay whole.
+const KEYWORD_SCHEMA = `
+  CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
+    id UNINDEXED,
+    content,
+    symbols,
+    tokenize = "unicode61 tokenchars '_$'"
+  );
+`;
+
+// Symbol names (and the parent symbol of a window) of a chunk row and their words, from its metadata JSON.
+const SYMBOL_NAMES_SQL = `
+  trim(
+    COALESCE(
+      (SELECT group_concat(json_extract(value, '$.name'), ' ') FROM json_each(chunks.metadata, '$.symbols')),
+      ''
+    ) || ' ' || COALESCE(json_extract(chunks.metadata, '$.parentSymbol'), '')
+    || ' ' || COALESCE((SELECT group_concat(value, ' ') FROM json_each(chunks.metadata, '$.symbolTokens')), '')
+  )
+`;
+
+/** SQL function registered on each connection: whether a file path matches a `--path` pattern. */
+const PATH_MATCHES_FUNCTION = 'scs_path_matches';
+
+const pathMatchers = new Map<string, (filePath: string) => boolean>();
+
+function pathMatches(pattern: string, filePath: string): number {
+  let matcher = pathMatchers.get(pattern);
+  if (!matcher) {
+    matcher = createPathMatcher(pattern);
+    pathMatchers.set(pattern, matcher);
+  }
+  return matcher(filePath) ? 1 : 0;
+}
+
+/**
+ * Builds the conditions on `chunk_locations` for the path and workspace filters, with their parameters.
+ */
+function toLocationFilterSql(filters: SearchFilters | undefined): { conditions: string[]; params: string[] } {
+  const conditions: string[] = [];
+  const params: string[] = [];
+  if (filters?.path) {
+    conditions.push(`${PATH_MATCHES_FUNCTION}(?, chunk_locations.file_path)`);
+    params.push(filters.path);
+  }
+  if (filters?.workspace) {
+    // Locations stored before workspaces were recorded belong to every workspace
+    conditions.push('(chunk_locations.workspace = ? OR chunk_locations.workspace IS NULL)');
+    params.push(filters.workspace);
+  }
+  return { conditions, params };
+}
+
+/**
+ * Builds the `AND ...` conditions on the `chunks` table for search filters, with their parameters.
+ */
+function toFilterSql(filters: SearchFilters | undefined): { sql: string; params: string[] } {
+  const conditions: string[] = [];
+  const params: string[] = [];
+  if (filters?.language) {
+    conditions.push('chunks.language = ?');
+    params.push(filters.language);
+  }
+  if (filters?.kind) {
+    const kinds = expandKindFilter(filters.kind);
+    conditions.push(`chunks.kind IN (${kinds.map(() => '?').join(', ')})`);
+    params.push(...kinds);
+  }
+  const location = toLocationFilterSql(filters);
+  if (location.conditions.length > 0) {
+    conditions.push(
+      `EXISTS (SELECT 1 FROM chunk_locations WHERE chunk_locations.chunk_id = chunks.id
+       AND ${location.conditions.join(' AND ')})`
+    );
+    params.push(...location.params);
+  }
+  return { sql: conditions.map((condition) => ` AND ${condition}`).join(''), params };
+}
+
+interface ChunkRow {
+  id: string;
+  type: CodeChunk['type'];
+  language: string;
+  kind: string | null;
+  container_path: string | null;
+  chunk_hash: string;
+  content: string;
+  semantic_text: string;
+  metadata: string;
+  created_at: string;
+  updated_at: string;
+}
+
+interface LocationRow {
+  file_path: string;
+  start_line: number;
+  end_line: number;
+  git_file_hash: string | null;
+  workspace: string | null;
+  blame_commit: string | null;
+  blame_author: string | null;
+  blame_date: string | null;
+}
+
+const LOCATION_COLUMNS =
+  'file_path, start_line, end_line, git_file_hash, workspace, blame_commit, blame_author, blame_date';
+
+/** A location row with the columns `exportChunks` restores on top of those search results carry. */
+interface ExportedLocationRow extends LocationRow {
+  directory_path: string | null;
+  directory_name: string | null;
+  directory_depth: number | null;
+  git_branch: string | null;
+}
+
+/** Reads the blame columns of a location row. */
+function toBlame(row: LocationRow): { blame?: ChunkBlame } {
+  return row.blame_commit !== null
+    ? { blame: { commit: row.blame_commit, author: row.blame_author ?? '', date: row.blame_date ?? '' } }
+    : {};
+}
+
+export interface SqliteStoreOptions {
+  /** Path of the database file; created (with its directory) on first use. */
+  dbPath: string;
+  /** How vectors are compared (default: `cosine`); a store keeps the metric its first vectors were stored with. */
+  metric?: VectorMetric;
+}
+
+function toBlob(vector: number[]): Buffer {
+  const floats = Float32Array.from(vector);
+  return Buffer.from(floats.buffer, floats.byteOffset, floats.byteLength);
+}
+
+function fromBlob(blob: Buffer): Float32Array {
+  // Copy into an aligned buffer; SQLite blobs are not guaranteed to be 4-byte aligned.
+  const copy = new Uint8Array(blob.byteLength);
+  copy.set(blob);
+  return new Float32Array(copy.buffer);
+}
+
+function isNotWritableError(error: unknown): boolean {
+  const code = error && typeof error === 'object' ? (error as { code?: unknown }).code : undefined;
+  if (typeof code !== 'string') {
+    return false;
+  }
+  return (
+    code.startsWith('SQLITE_READONLY') ||
+    code.startsWith('SQLITE_CANTOPEN') ||
+    code === 'EROFS' ||
+    code === 'EACCES' ||
+    code === 'EPERM'
+  );
+}
+
+/**
+ * Tries to load the sqlite-vec extension so cosine and Euclidean distances are computed inside SQLite.
+ *
+ * The package is optional. Without it, and for `dot_product`, `search` falls back to a brute-force scan
+ * in JavaScript.
+ */
+function loadVectorExtension(db: Database.Database): boolean {
+  try {
+    // eslint-disable-next-line @typescript-eslint/no-require-imports
+    const sqliteVec = require('sqlite-vec') as { load(db: Database.Database): void };
+    sqliteVec.load(db);
+    return true;
+  } catch {
+    logger.debug('sqlite-vec is not available; using brute-force vector search.');
+    return false;
+  }
+}
+
+/**
+ * A chunk store backed by a single local SQLite file.
+ *
+ * Chunks are upserted by the same content-derived id as the Elasticsearch store, with their
+ * embeddings stored as float32 blobs next to the chunk metadata.
+ */
+export class SqliteStore implements ChunkStore {
+  readonly backend = 'sqlite';
+  private readonly dbPath: string;
+  private readonly metric: VectorMetric;
+  private db?: Database.Database;
+  private hasVectorExtension = false;
+
+  constructor(options: SqliteStoreOptions) {
+    this.dbPath = options.dbPath;
+    this.metric = options.metric ?? DEFAULT_VECTOR_METRIC;
+  }
+
+  /** Whether sqlite-vec was loaded for this store (false until the database is opened). */
+  get usesVectorExtension(): boolean {
+    return this.hasVectorExtension;
+  }
+
+  async setup(): Promise<void> {
+    this.open();
+  }
+
+  async clean(): Promise<void> {
+    this.write((db) => {
+      db.exec('DELETE FROM chunk_locations; DELETE FROM chunks; DELETE FROM chunks_fts;');
+      db.prepare('DELETE FROM store_settings WHERE key IN (?, ?, ?, ?)').run(
+        SETTING_VECTOR_DIMENSIONS,
+        SETTING_VECTOR_METRIC,
+        SETTING_EMBEDDER,
+        SETTING_EMBED_TEMPLATE
+      );
+    });
+  }
+
+  async getVectorDimensions(): Promise<number | null> {
+    const value = this.getSetting(SETTING_VECTOR_DIMENSIONS);
+    return value !== null ? Number(value) : null;
+  }
+
+  async getEmbeddingModel(): Promise<EmbeddingModel | null> {
+    const embedder = this.getSetting(SETTING_EMBEDDER);
+    const template = this.getSetting(SETTING_EMBED_TEMPLATE);
+    return embedder !== null && template !== null ? { embedder, template } : null;
+  }
+
+  async setEmbeddingModel(model: EmbeddingModel): Promise<void> {
+    this.write((db) => {
+      const upsertSetting = db.prepare(
+        'INSERT INTO store_settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value'
+      );
+      db.transaction(() => {
+        upsertSetting.run(SETTING_EMBEDDER, model.embedder);
+        upsertSetting.run(SETTING_EMBED_TEMPLATE, model.template);
+      })();
+    });
+  }
+
+  async indexChunks(chunks: CodeChunk[]): Promise<BulkIndexResult> {
+    if (chunks.length === 0) {
+      return { succeeded: [], failed: [] };
+    }
+
+    let dims = await this.getVectorDimensions();
+    if (dims !== null) {
+      this.assertStoredMetric();
+    }
+    const valid: BulkIndexSucceeded[] = [];
+    const failed: BulkIndexFailed[] = [];
+
+    prepareChunkVectors(chunks, this.metric).forEach((chunk, inputIndex) => {
+      if (!chunk.filePath || chunk.startLine == null || chunk.endLine == null) {
+        failed.push({ chunk, inputIndex, error: { message: 'missing file metadata (filePath/startLine/endLine)' } });
+        return;
+      }
+      if (chunk.code_vector) {
+        dims ??= chunk.code_vector.length;
+        if (chunk.code_vector.length !== dims) {
+          failed.push({
+            chunk,
+            inputIndex,
+            error: { message: `code_vector has ${chunk.code_vector.length} dimensions, store expects ${dims}` },
+          });
+          return;
+        }
+      }
+      valid.push({ chunk, inputIndex });
+    });
+
+    const now = new Date().toISOString();
+    try {
+      this.write((db) => {
+        const upsertChunk = db.prepare(`
+          INSERT INTO chunks (id, type, language, kind, container_path, chunk_hash, content, semantic_text, metadata,
+            embedding, created_at, updated_at)
+          VALUES (@id, @type, @language, @kind, @containerPath, @chunkHash, @content, @semanticText, @metadata,
+            @embedding, @now, @now)
+          ON CONFLICT(id) DO UPDATE SET
+            chunk_hash = excluded.chunk_hash,
+            semantic_text = excluded.semantic_text,
+            metadata = excluded.metadata,
+            embedding = COALESCE(excluded.embedding, chunks.embedding),
+            updated_at = excluded.updated_at
+        `);
+        const upsertLocation = db.prepare(`
+          INSERT INTO chunk_locations (id, chunk_id, file_path, start_line, end_line, directory_path, directory_name,
+            directory_depth, git_file_hash, git_branch, workspace, blame_commit, blame_author, blame_date, updated_at)
+          VALUES (@id, @chunkId, @filePath, @startLine, @endLine, @directoryPath, @directoryName, @directoryDepth,
+            @gitFileHash, @gitBranch, @workspace, @blameCommit, @blameAuthor, @blameDate, @now)
+          ON CONFLICT(id) DO UPDATE SET
+            git_file_hash = excluded.git_file_hash,
+            blame_commit = excluded.blame_commit,
+            blame_author = excluded.blame_author,
+            blame_date = excluded.blame_date,
+            directory_path = excluded.directory_path,
+            directory_name = excluded.directory_name,
+            directory_depth = excluded.directory_depth,
+            updated_at = excluded.updated_at
+        `);
+
+        const deleteKeywords = db.prepare('DELETE FROM chunks_fts WHERE id = ?');
+        const insertKeywords = db.prepare(
+          `INSERT INTO chunks_fts (id, content, symbols)
+           SELECT id, content, ${SYMBOL_NAMES_SQL} FROM chunks WHERE id = ?`
+        );
+
+        db.transaction(() => {
+          for (const { chunk } of valid) {
+            const chunkId = getChunkDocumentId(chunk);
+            upsertChunk.run({
+              id: chunkId,
+              type: chunk.type,
+              language: chunk.language,
+              kind: chunk.kind ?? null,
+              containerPath: chunk.containerPath ?? null,
+              chunkHash: chunk.chunk_hash,
+              content: chunk.content,
+              semanticText: chunk.semantic_text,
+              metadata: JSON.stringify({
+                imports: chunk.imports,
+                symbols: chunk.symbols,
+                exports: chunk.exports,
+                parentSymbol: chunk.parentSymbol,
+                symbolTokens: getSymbolTokens(chunk),
+                frontMatter: chunk.frontMatter,
+              }),
+              embedding: chunk.code_vector ? toBlob(chunk.code_vector) : null,
+              now,
+            });
+            deleteKeywords.run(chunkId);
+            insertKeywords.run(chunkId);
+            upsertLocation.run({
+              id: getChunkLocationDocumentId({
+                chunk_id: chunkId,
+                filePath: chunk.filePath as string,
+                startLine: chunk.startLine as number,
+                endLine: chunk.endLine as number,
+                git_branch: chunk.git_branch,
+                workspace: chunk.workspace,
+              }),
+              chunkId,
+              filePath: chunk.filePath,
+              startLine: chunk.startLine,
+              endLine: chunk.endLine,
+              directoryPath: chunk.directoryPath ?? null,
+              directoryName: chunk.directoryName ?? null,
+              directoryDepth: chunk.directoryDepth ?? null,
+              gitFileHash: chunk.git_file_hash ?? null,
+              gitBranch: chunk.git_branch ?? null,
+              workspace: chunk.workspace ?? null,
+              blameCommit: chunk.blame?.commit ?? null,
+              blameAuthor: chunk.blame?.author ?? null,
+              blameDate: chunk.blame?.date ?? null,
+              now,
+            });
+          }
+          if (dims !== null) {
+            const insertSetting = db.prepare('INSERT OR IGNORE INTO store_settings (key, value) VALUES (?, ?)');
+            insertSetting.run(SETTING_VECTOR_DIMENSIONS, String(dims));
+            insertSetting.run(SETTING_VECTOR_METRIC, this.metric);
+          }
+        })();
+      });
+    } catch (error) {
+      if (isNotWritableError(error)) {
+        throw error;
+      }
+      const message = error instanceof Error ? error.message : String(error);
+      logger.error('Exception while writing chunks to the SQLite store', { error: message });
+      valid.forEach(({ chunk, inputIndex }) => failed.push({ chunk, inputIndex, error: { message } }));
+      valid.length = 0;
+    }
+
+    if (failed.length > 0) {
+      logger.error(`Partial SQLite store failure: ${failed.length}/${chunks.length} documents failed`, {
+        sample: failed.slice(0, 5).map((f) => ({ chunk_hash: f.chunk.chunk_hash, error: f.error })),
+      });
+    }
+    failed.sort((a, b) => a.inputIndex - b.inputIndex);
+    return { succeeded: valid, failed };
+  }
+
+  async deleteDocumentsByFilePaths(
+    filePaths: string[],
+    options?: { workspace?: string; keepChunkIds?: Set<string> }
+  ): Promise<DeleteDocumentsResult> {
+    const uniqueFilePaths = Array.from(new Set(filePaths)).filter((p) => typeof p === 'string' && p.length > 0);
+    const result: DeleteDocumentsResult = { locations: 0, chunks: 0 };
+    if (uniqueFilePaths.length === 0) {
+      return result;
+    }
+    this.write((db) => {
+      const workspace = toLocationFilterSql({ workspace: options?.workspace });
+      const deleteLocations = db.prepare(
+        `DELETE FROM chunk_locations WHERE file_path = ?${workspace.conditions.map((c) => ` AND ${c}`).join('')}`
+      );
+      const deleteOrphans = db.prepare(
+        `DELETE FROM chunks WHERE id NOT IN (SELECT chunk_id FROM chunk_locations)
+         AND id NOT IN (SELECT value FROM json_each(?))`
+      );
+      db.transaction(() => {
+        for (const filePath of uniqueFilePaths) {
+          result.locations += deleteLocations.run(filePath, ...workspace.params).changes;
+        }
+        result.chunks = deleteOrphans.run(JSON.stringify(Array.from(options?.keepChunkIds ?? []))).changes;
+        db.exec('DELETE FROM chunks_fts WHERE id NOT IN (SELECT id FROM chunks)');
+      })();
+    });
+    return result;
+  }
+
+  async getChunkVectors(chunkIds: string[]): Promise<Map<string, number[]>> {
+    const getEmbedding = this.open().prepare('SELECT embedding FROM chunks WHERE id = ? AND embedding IS NOT NULL');
+    const vectors = new Map<string, number[]>();
+    for (const chunkId of new Set(chunkIds)) {
+      const row = getEmbedding.get(chunkId) as { embedding: Buffer } | undefined;
+      if (row) {
+        vectors.set(chunkId, Array.from(fromBlob(row.embedding)));
+      }
+    }
+    return vectors;
+  }
+
+  async getIndexedFilePaths(workspace?: string): Promise<string[]> {
+    const filter = toLocationFilterSql({ workspace });
+    const rows = this.open()
+      .prepare(
+        `SELECT DISTINCT file_path FROM chunk_locations
+         ${filter.conditions.map((c) => `WHERE ${c}`).join('')} ORDER BY file_path`
+      )
+      .all(...filter.params) as Array<{ file_path: string }>;
+    return rows.map((row) => row.file_path);
+  }
+
+  async getIndexedFileHashes(branch: string, workspace?: string): Promise<Map<string, Set<string>>> {
+    const filter = toLocationFilterSql({ workspace });
+    const rows = this.open()
+      .prepare(
+        `SELECT DISTINCT file_path, git_file_hash FROM chunk_locations
+         WHERE git_branch = ? AND git_file_hash IS NOT NULL${filter.conditions.map((c) => ` AND ${c}`).join('')}`
+      )
+      .all(branch, ...filter.params) as Array<{ file_path: string; git_file_hash: string }>;
+
+    const hashes = new Map<string, Set<string>>();
+    for (const row of rows) {
+      const set = hashes.get(row.file_path) ?? new Set<string>();
+      set.add(row.git_file_hash);
+      hashes.set(row.file_path, set);
+    }
+    return hashes;
+  }
+
+  /**
+   * Returns the top-k chunks by similarity to `queryVector` under the store's metric.
+   *
+   * `score` is as documented on `VECTOR_METRICS`, e.g. the cosine similarity in [-1, 1]. Each result
+   * carries the first location of the chunk (by file path) in `filePath`, `startLine`, and `endLine`.
+   * Filters are part of the SQL that reads candidates, so only matching chunks are scored.
+   */
+  async search(queryVector: number[], k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    const db = this.open();
+    const limit = Math.max(0, Math.floor(k));
+    if (limit === 0) {
+      return [];
+    }
+
+    const dims = await this.getVectorDimensions();
+    if (dims === null) {
+      return [];
+    }
+    if (queryVector.length !== dims) {
+      throw new Error(`Query vector has ${queryVector.length} dimensions, but the SQLite store holds ${dims}.`);
+    }
+    this.assertStoredMetric();
+
+    const filter = toFilterSql(filters);
+    const prepared = prepareVector(queryVector, this.metric);
+    let top: Array<{ id: string; score: number }>;
+    if (this.hasVectorExtension && this.metric !== 'dot_product') {
+      const distance = this.metric === 'cosine' ? 'vec_distance_cosine' : 'vec_distance_l2';
+      top = (
+        db
+          .prepare(
+            `SELECT id, ${distance}(embedding, ?) AS distance FROM chunks
+             WHERE embedding IS NOT NULL${filter.sql} ORDER BY distance ASC LIMIT ?`
+          )
+          .all(toBlob(prepared), ...filter.params, limit) as Array<{ id: string; distance: number }>
+      ).map((row) => ({
+        id: row.id,
+        score: this.metric === 'cosine' ? 1 - row.distance : euclideanScore(row.distance ** 2),
+      }));
+    } else {
+      const query = Float32Array.from(prepared);
+      top = [];
+      const rows = db
+        .prepare(`SELECT id, embedding FROM chunks WHERE embedding IS NOT NULL${filter.sql}`)
+        .iterate(...filter.params) as Iterable<{ id: string; embedding: Buffer }>;
+      for (const row of rows) {
+        const score = scoreVectors(fromBlob(row.embedding), query, this.metric);
+        if (top.length < limit || score > top[top.length - 1].score) {
+          top.push({ id: row.id, score });
+          top.sort((a, b) => b.score - a.score);
+          if (top.length > limit) {
+            top.pop();
+          }
+        }
+      }
+    }
+
+    return this.loadResults(db, top, filters);
+  }
+
+  /**
+   * Returns the top-k chunks by BM25 over chunk content and symbol names. The words of compound terms
+   * are matched too, against content and the words of symbol names, so `ParseJSONConfig` finds `parse_json`
+   * helpers and `parse json` finds `ParseJSONConfig`.
+   *
+   * `score` is the negated FTS5 `bm25()` rank, so higher is better; a symbol name match weighs twice
+   * as much as a content match. Results carry the first location like `search`.
+   */
+  async keywordSearch(query: string, k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    const db = this.open();
+    const limit = Math.max(0, Math.floor(k));
+    const terms = extractKeywordTerms(query);
+    if (limit === 0 || terms.length === 0) {
+      return [];
+    }
+
+    // The words of compound identifiers match the symbol name words stored with each chunk
+    const tokens = Array.from(new Set([...terms, ...tokenizeIdentifiers(terms)]));
+    const match = tokens.map((term) => `"${term}"`).join(' OR ');
+    const filter = toFilterSql(filters);
+    const top = (
+      db
+        .prepare(
+          `SELECT chunks_fts.id AS id, bm25(chunks_fts, 0.0, 1.0, 2.0) AS rank FROM chunks_fts
+           JOIN chunks ON chunks.id = chunks_fts.id
+           WHERE chunks_fts MATCH ?${filter.sql} ORDER BY rank LIMIT ?`
+        )
+        .all(match, ...filter.params, limit) as Array<{ id: string; rank: number }>
+    ).map((row) => ({ id: row.id, score: -row.rank }));
+    return this.loadResults(db, top, filters);
+  }
+
+  async getSymbolNames(): Promise<SymbolName[]> {
+    return this.open()
+      .prepare(
+        `SELECT DISTINCT json_extract(value, '$.name') AS name, json_extract(value, '$.kind') AS kind
+         FROM chunks, json_each(chunks.metadata, '$.symbols') WHERE name IS NOT NULL AND kind IS NOT NULL`
+      )
+      .all() as SymbolName[];
+  }
+
+  /** Matches the names in the metadata JSON of each chunk; results carry the first location like `search`. */
+  async findChunksBySymbol(name: string, k: number, filters?: SearchFilters): Promise<SearchResult[]> {
+    const db = this.open();
+    const limit = Math.max(0, Math.floor(k));
+    if (limit === 0) {
+      return [];
+    }
+    const filter = toFilterSql(filters);
+    const top = (
+      db
+        .prepare(
+          `SELECT id FROM chunks
+           WHERE EXISTS (SELECT 1 FROM json_each(chunks.metadata, '$.symbols') WHERE json_extract(value, '$.name') = ?)
+           ${filter.sql} ORDER BY id LIMIT ?`
+        )
+        .all(name, ...filter.params, limit) as Array<{ id: string }>
+    ).map((row) => ({ id: row.id, score: 1 }));
+    return this.loadResults(db, top, filters).sort(
+      (a, b) => (a.filePath ?? '').localeCompare(b.filePath ?? '') || (a.startLine ?? 0) - (b.startLine ?? 0)
+    );
+  }
+
+  async getChunkLocations(chunkIds: string[], perChunkLimit: number): Promise<Record<string, ChunkLocationSummary[]>> {
+    const db = this.open();
+    const getLocations = db.prepare(
+      `SELECT ${LOCATION_COLUMNS} FROM chunk_locations
+       WHERE chunk_id = ? ORDER BY file_path, start_line LIMIT ?`
+    );
+    const result: Record<string, ChunkLocationSummary[]> = {};
+    for (const chunkId of new Set(chunkIds)) {
+      const rows = getLocations.all(chunkId, perChunkLimit) as LocationRow[];
+      if (rows.length > 0) {
+        result[chunkId] = rows.map((row) => ({
+          filePath: row.file_path,
+          startLine: row.start_line,
+          endLine: row.end_line,
+          ...(row.git_file_hash !== null ? { gitFileHash: row.git_file_hash } : {}),
+          ...(row.workspace !== null ? { workspace: row.workspace } : {}),
+          ...toBlame(row),
+        }));
+      }
+    }
+    return result;
+  }
+
+  /** Counts files and chunks with SQL; the size covers the database file and its WAL files. */
+  async getStats(): Promise<StoreStats> {
+    const db = this.open();
+    const countBy = (sql: string) =>
+      Object.fromEntries(
+        (db.prepare(sql).all() as Array<{ key: string; count: number }>).map((row) => [row.key, row.count])
+      );
+
+    const { chunks } = db.prepare('SELECT COUNT(*) AS chunks FROM chunks').get() as { chunks: number };
+    const { files } = db.prepare('SELECT COUNT(DISTINCT file_path) AS files FROM chunk_locations').get() as {
+      files: number;
+    };
+    const sizeBytes = [this.dbPath, `${this.dbPath}-wal`, `${this.dbPath}-shm`]
+      .filter((file) => fs.existsSync(file))
+      .reduce((sum, file) => sum + fs.statSync(file).size, 0);
+
+    return {
+      files,
+      chunks,
+      languages: countBy('SELECT language AS key, COUNT(*) AS count FROM chunks GROUP BY language ORDER BY count DESC'),
+      kinds: countBy(
+        'SELECT kind AS key, COUNT(*) AS count FROM chunks WHERE kind IS NOT NULL GROUP BY kind ORDER BY count DESC'
+      ),
+      sizeBytes,
+    };
+  }
+
+  async getWorkspaces(): Promise<WorkspaceStats[]> {
+    // NULL sorts first, so locations stored before workspaces were recorded are listed first
+    return this.open()
+      .prepare(
+        `SELECT workspace, COUNT(DISTINCT file_path) AS files, COUNT(DISTINCT chunk_id) AS chunks
+         FROM chunk_locations GROUP BY workspace ORDER BY workspace`
+      )
+      .all() as WorkspaceStats[];
+  }
+
+  /** Pages through chunks in id order. */
+  async *exportChunks(pageSize = 500): AsyncIterable<CodeChunk[]> {
+    const db = this.open();
+    const getChunks = db.prepare('SELECT * FROM chunks WHERE id > ? ORDER BY id LIMIT ?');
+    const getLocations = db.prepare(
+      `SELECT ${LOCATION_COLUMNS}, directory_path, directory_name, directory_depth, git_branch FROM chunk_locations
+       WHERE chunk_id = ? ORDER BY file_path, start_line`
+    );
+    let after = '';
+    while (true) {
+      const rows = getChunks.all(after, Math.max(1, Math.floor(pageSize))) as Array<
+        ChunkRow & { embedding: Buffer | null }
+      >;
+      if (rows.length === 0) {
+        return;
+      }
+      after = rows[rows.length - 1].id;
+      yield rows.flatMap((row) => {
+        const metadata = JSON.parse(row.metadata) as Partial<CodeChunk>;
+        // Derived from the symbols whenever a chunk is stored
+        delete metadata.symbolTokens;
+        const chunk: CodeChunk = {
+          type: row.type,
+          language: row.language,
+          ...(row.kind !== null ? { kind: row.kind } : {}),
+          ...(row.container_path !== null ? { containerPath: row.container_path } : {}),
+          ...metadata,
+          chunk_hash: row.chunk_hash,
+          content: row.content,
+          semantic_text: row.semantic_text,
+          ...(row.embedding !== null ? { code_vector: Array.from(fromBlob(row.embedding)) } : {}),
+          created_at: row.created_at,
+          updated_at: row.updated_at,
+        };
+        return (getLocations.all(row.id) as ExportedLocationRow[]).map((location) => ({
+          ...chunk,
+          filePath: location.file_path,
+          startLine: location.start_line,
+          endLine: location.end_line,
+          ...(location.directory_path !== null ? { directoryPath: location.directory_path } : {}),
+          ...(location.directory_name !== null ? { directoryName: location.directory_name } : {}),
+          ...(location.directory_depth !== null ? { directoryDepth: location.directory_depth } : {}),
+          ...(location.git_file_hash !== null ? { git_file_hash: location.git_file_hash } : {}),
+          ...(location.git_branch !== null ? { git_branch: location.git_branch } : {}),
+          ...(location.workspace !== null ? { workspace: location.workspace } : {}),
+          ...toBlame(location),
+        }));
+      });
+    }
+  }
+
+  async getLastIndexedCommit(branch: string): Promise<string | null> {
+    return this.getSetting(`commit:${branch}`);
+  }
+
+  async updateLastIndexedCommit(branch: string, commitHash: string): Promise<void> {
+    this.write((db) => {
+      db.prepare(
+        'INSERT INTO store_settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value'
+      ).run(`commit:${branch}`, commitHash);
+    });
+  }
+
+  async close(): Promise<void> {
+    this.db?.close();
+    this.db = undefined;
+  }
+
+  /**
+   * Opens the database and creates the schema on first use.
+   *
+   * @throws A descriptive error if the database cannot be created or written, e.g. on a read-only filesystem.
+   */
+  private open(): Database.Database {
+    if (this.db) {
+      return this.db;
+    }
+
+    let db: Database.Database | undefined;
+    try {
+      fs.mkdirSync(path.dirname(this.dbPath), { recursive: true });
+      db = new Database(this.dbPath);
+      db.pragma('journal_mode = WAL');
+      db.exec(SCHEMA);
+      const locationColumns = new Set(
+        (db.prepare('PRAGMA table_info(chunk_locations)').all() as Array<{ name: string }>).map((c) => c.name)
+      );
+      for (const [column, type] of ADDED_LOCATION_COLUMNS) {
+        if (!locationColumns.has(column)) {
+          // Stores created before the column existed
+          db.exec(`ALTER TABLE chunk_locations ADD COLUMN ${column} ${type}`);
+        }
+      }
+      const hasKeywordIndex = db.prepare("SELECT 1 FROM sqlite_master WHERE name = 'chunks_fts'").get() !== undefined;
+      db.exec(KEYWORD_SCHEMA);
+      if (!hasKeywordIndex) {
+        // Stores created before keyword search existed: index the chunks they already hold
+        db.exec(`INSERT INTO chunks_fts (id, content, symbols) SELECT id, content, ${SYMBOL_NAMES_SQL} FROM chunks`);
+      }
+    } catch (error) {
+      db?.close();
+      throw this.describeError(error);
+    }
+
+    db.function(PATH_MATCHES_FUNCTION, { deterministic: true }, (pattern, filePath) =>
+      pathMatches(String(pattern), String(filePath))
+    );
+    this.hasVectorExtension = loadVectorExtension(db);
+    this.db = db;
+    logger.info(`Opened SQLite store at "${this.dbPath}"`, { vectorExtension: this.hasVectorExtension });
+    return db;
+  }
+
+  /**
+   * Loads the chunks for ranked ids, each with its first location, keeping the order of `top`.
+   *
+   * @param filters With a path or workspace filter, the first location matching it is used instead.
+   */
+  private loadResults(
+    db: Database.Database,
+    top: Array<{ id: string; score: number }>,
+    filters?: SearchFilters
+  ): SearchResult[] {
+    const filter = toLocationFilterSql(filters);
+    const getChunk = db.prepare('SELECT * FROM chunks WHERE id = ?');
+    const getLocation = db.prepare(
+      `SELECT ${LOCATION_COLUMNS} FROM chunk_locations
+       WHERE chunk_id = ?${filter.conditions.map((c) => ` AND ${c}`).join('')}
+       ORDER BY file_path, start_line LIMIT 1`
+    );
+    return top.flatMap(({ id, score }) => {
+      const row = getChunk.get(id) as ChunkRow | undefined;
+      if (!row) {
+        return [];
+      }
+      const location = getLocation.get(id, ...filter.params) as LocationRow | undefined;
+      const metadata = JSON.parse(row.metadata) as Pick<
+        CodeChunk,
+        'imports' | 'symbols' | 'exports' | 'parentSymbol' | 'symbolTokens' | 'frontMatter'
+      >;
+      const result: SearchResult = {
+        id,
+        score,
+        type: row.type,
+        language: row.language,
+        ...(row.kind !== null ? { kind: row.kind } : {}),
+        ...(row.container_path !== null ? { containerPath: row.container_path } : {}),
+        ...metadata,
+        ...(location
+          ? {
+              filePath: location.file_path,
+              startLine: location.start_line,
+              endLine: location.end_line,
+              ...(location.git_file_hash !== null ? { git_file_hash: location.git_file_hash } : {}),
+              ...(location.workspace !== null ? { workspace: location.workspace } : {}),
+              ...toBlame(location),
+            }
+          : {}),
+        chunk_hash: row.chunk_hash,
+        content: row.content,
+        semantic_text: row.semantic_text,
+        created_at: row.created_at,
+        updated_at: row.updated_at,
+      };
+      return [result];
+    });
+  }
+
+  private getSetting(key: string): string | null {
+    const row = this.open().prepare('SELECT value FROM store_settings WHERE key = ?').get(key) as
+      | { value: string }
+      | undefined;
+    return row?.value ?? null;
+  }
+
+  /**
+   * @throws If the stored vectors were prepared for another metric, which would rank them wrongly.
+   */
+  private assertStoredMetric(): void {
+    const stored = this.getSetting(SETTING_VECTOR_METRIC) ?? 'cosine';
+    if (stored !== this.metric) {
+      throw new Error(
+        `SQLite store "${this.dbPath}" holds vectors compared by ${stored}, but the ${this.metric} metric is ` +
+          'configured (SCS_IDXR_VECTOR_METRIC). Recreate the store to change the metric.'
+      );
+    }
+  }
+
+  private write(fn: (db: Database.Database) => void): void {
+    const db = this.open();
+    try {
+      fn(db);
+    } catch (error) {
+      throw this.describeError(error);
+    }
+  }
+
+  private describeError(error: unknown): Error {
+    const message = error instanceof Error ? error.message : String(error);
+    if (!isNotWritableError(error)) {
+      return error instanceof Error ? error : new Error(message);
+    }
+    return Object.assign(
+      new Error(
+        `SQLite store "${this.dbPath}" is not writable (${message}). The database file and its directory ` +
+          'must be on a writable filesystem; point SCS_IDXR_SQLITE_STORE_DIR at a writable location.'
+      ),
+      { code: (error as { code?: unknown }).code, cause: error }
+    );
+  }
+}
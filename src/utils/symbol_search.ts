@@ -0,0 +1,213 @@
+import { ChunkStore } from './chunk_store';
+import { SearchResult, SymbolInfo } from './elasticsearch';
+import { splitIdentifier } from './hybrid_search';
+import { POST_FILTER_CANDIDATE_FACTOR, SearchFilters } from './search_filters';
+
+/** A symbol name recorded on a stored chunk, as listed by `ChunkStore.getSymbolNames`. */
+export interface SymbolName {
+  name: string;
+  /** Capture kind of the symbol, e.g. `function.name` or `function.call`. */
+  kind: string;
+}
+
+/** How a symbol name matched the query, best first. */
+export const SYMBOL_MATCHES = ['exact', 'prefix', 'words', 'fuzzy'] as const;
+export type SymbolMatch = (typeof SYMBOL_MATCHES)[number];
+
+/**
+ * One symbol found by `search --symbol`, as printed by `--format json`.
+ *
+ * Like `SearchHit`, fields are always present (null when unknown) and appear in this order.
+ */
+export interface SymbolHit {
+  symbol: string;
+  kind: string;
+  /** Enclosing classes, modules, or namespaces of the symbol's chunk, e.g. `com.acme.InvoiceService`. */
+  containerPath: string | null;
+  filePath: string | null;
+  /** Line the symbol is defined on. */
+  line: number | null;
+  /** Lines of the chunk defining the symbol. */
+  startLine: number | null;
+  endLine: number | null;
+  language: string;
+  /** Similarity of the name to the query, in (0, 1]; 1 for an exact match. */
+  score: number;
+  match: SymbolMatch;
+  workspace: string | null;
+}
+
+/**
+ * Whether a symbol kind names a definition rather than a use. Calls, usages, imports, exports, and
+ * parameters are left out, so looking up a function finds where it is defined.
+ */
+export function isDefinitionKind(kind: string): boolean {
+  return /\.(name|declaration)$/.test(kind) && !/^(import|export|parameter|attribute)\./.test(kind);
+}
+
+/**
+ * Computes the edit (Levenshtein) distance between two strings, or `maxDistance + 1` as soon as it
+ * is known to exceed `maxDistance`.
+ */
+export function editDistance(a: string, b: string, maxDistance: number = Infinity): number {
+  if (Math.abs(a.length - b.length) > maxDistance) {
+    return maxDistance + 1;
+  }
+  let previous = Array.from({ length: b.length + 1 }, (_, j) => j);
+  for (let i = 1; i <= a.length; i++) {
+    const current = [i];
+    let rowMin = i;
+    for (let j = 1; j <= b.length; j++) {
+      const cost = a[i - 1] === b[j - 1] ? 0 : 1;
+      current[j] = Math.min(previous[j] + 1, current[j - 1] + 1, previous[j - 1] + cost);
+      rowMin = Math.min(rowMin, current[j]);
+    }
+    if (rowMin > maxDistance) {
+      return maxDistance + 1;
+    }
+    previous = current;
+  }
+  return previous[b.length];
+}
+
+/** Typos tolerated by a fuzzy match: one for short names, up to three for long ones. */
+function getMaxTypos(length: number): number {
+  return length <= 4 ? 1 : length <= 8 ? 2 : 3;
+}
+
+/**
+ * Scores how well a symbol name matches a query identifier, or returns undefined if it does not.
+ *
+ * In order of preference: the same name (ignoring case), a name starting with the query, a name
+ * containing every word of the query (`parse config` or `parseConfig` finds `ParseJSONConfig`), and a
+ * name within a few typos of the query. Within each kind of match, closer names score higher.
+ */
+export function scoreSymbolName(query: string, name: string): { score: number; match: SymbolMatch } | undefined {
+  const lowerQuery = query.toLowerCase();
+  const lowerName = name.toLowerCase();
+  if (lowerName === lowerQuery) {
+    return { score: name === query ? 1 : 0.95, match: 'exact' };
+  }
+  if (lowerName.startsWith(lowerQuery)) {
+    return { score: 0.7 + 0.2 * (query.length / name.length), match: 'prefix' };
+  }
+  const queryWords = splitIdentifier(query);
+  const nameWords = splitIdentifier(name);
+  if (queryWords.length > 0 && queryWords.every((word) => nameWords.includes(word))) {
+    return { score: 0.5 + 0.2 * (queryWords.length / nameWords.length), match: 'words' };
+  }
+  const maxTypos = getMaxTypos(lowerQuery.length);
+  const distance = editDistance(lowerQuery, lowerName, maxTypos);
+  if (distance <= maxTypos) {
+    return { score: 0.5 * (1 - distance / Math.max(lowerQuery.length, lowerName.length)), match: 'fuzzy' };
+  }
+  return undefined;
+}
+
+/**
+ * Splits a query such as `InvoiceService.total`, `net::Socket::open`, or `ParseConfig` into the symbol
+ * name and the containers it is qualified with.
+ */
+function parseSymbolQuery(query: string): { name: string; container: string | null } {
+  const parts = query
+    .trim()
+    .split(/::|[.#]/)
+    .filter((part) => part !== '');
+  const name = parts.pop() ?? '';
+  return { name, container: parts.length > 0 ? parts.join('.') : null };
+}
+
+/** Whether a chunk's container path ends with the containers a query is qualified with. */
+function matchesContainer(containerPath: string | undefined, container: string): boolean {
+  const path = (containerPath ?? '').split(/::|[.#]/).join('.');
+  return path === container || path.endsWith(`.${container}`);
+}
+
+function toSymbolHit(result: SearchResult, symbol: SymbolInfo, score: number, match: SymbolMatch): SymbolHit {
+  const startLine = result.startLine ?? null;
+  const endLine = result.endLine ?? null;
+  // The line was recorded for the copy of the chunk indexed first, which may sit elsewhere in another file
+  const inChunk = startLine !== null && endLine !== null && symbol.line >= startLine && symbol.line <= endLine;
+  return {
+    symbol: symbol.name,
+    kind: symbol.kind,
+    containerPath: result.containerPath ?? null,
+    filePath: result.filePath ?? null,
+    line: inChunk ? symbol.line : startLine,
+    startLine,
+    endLine,
+    language: result.language,
+    score,
+    match,
+    workspace: result.workspace ?? null,
+  };
+}
+
+function getLineCount(hit: SymbolHit): number {
+  return (hit.endLine ?? 0) - (hit.startLine ?? 0);
+}
+
+/**
+ * Looks up the definitions of symbols named like a code identifier, without embeddings.
+ *
+ * The query is matched against the distinct symbol names of the store with `scoreSymbolName`, and the
+ * chunks defining the best names are fetched one name at a time until `limit` hits are found. A query
+ * qualified with its containers (`InvoiceService.total`) prefers definitions inside them.
+ *
+ * @param store The store holding the index.
+ * @param query A symbol name, optionally qualified.
+ * @param limit Maximum number of hits returned.
+ * @param filters Language, path, kind, and workspace filters, applied to the chunks defining the symbols.
+ * @returns The hits, best match first.
+ */
+export async function searchSymbols(
+  store: ChunkStore,
+  query: string,
+  limit: number,
+  filters: SearchFilters = {}
+): Promise<SymbolHit[]> {
+  const { name, container } = parseSymbolQuery(query);
+  if (name === '' || limit <= 0) {
+    return [];
+  }
+
+  const candidates = new Map<string, { score: number; match: SymbolMatch }>();
+  for (const symbol of await store.getSymbolNames()) {
+    const scored = isDefinitionKind(symbol.kind) ? scoreSymbolName(name, symbol.name) : undefined;
+    if (scored && scored.score > (candidates.get(symbol.name)?.score ?? 0)) {
+      candidates.set(symbol.name, scored);
+    }
+  }
+  const names = Array.from(candidates.entries())
+    .sort(([a, x], [b, y]) => y.score - x.score || a.localeCompare(b))
+    .slice(0, limit * POST_FILTER_CANDIDATE_FACTOR);
+
+  // A symbol is recorded on its own chunk and on enclosing ones (a method on its class); keep the smallest
+  const hits = new Map<string, SymbolHit>();
+  for (const [symbolName, { score, match }] of names) {
+    if (hits.size >= limit) {
+      break;
+    }
+    for (const result of await store.findChunksBySymbol(symbolName, limit, filters)) {
+      for (const symbol of result.symbols ?? []) {
+        if (symbol.name !== symbolName || !isDefinitionKind(symbol.kind)) {
+          continue;
+        }
+        // A qualified query ranks definitions in other containers below every one in the named containers
+        const qualified = container === null || matchesContainer(result.containerPath, container);
+        const hit = toSymbolHit(result, symbol, qualified ? score : score / 2, match);
+        const key = `${hit.workspace ?? ''}:${hit.filePath ?? result.id}:${hit.line}:${hit.symbol}`;
+        const existing = hits.get(key);
+        if (!existing || getLineCount(hit) < getLineCount(existing)) {
+          hits.set(key, hit);
+        }
+      }
+    }
+  }
+
+  return Array.from(hits.values())
+    .sort(
+      (a, b) => b.score - a.score || (a.filePath ?? '').localeCompare(b.filePath ?? '') || (a.line ?? 0) - (b.line ?? 0)
+    )
+    .slice(0, limit);
+}
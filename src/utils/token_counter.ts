@@ -0,0 +1,87 @@
+/**
+ * Counts the tokens of a text the way an embedding model's tokenizer would.
+ *
+ * The default, `estimateTokens`, only approximates it from the text's length; pass a real tokenizer
+ * (e.g. `(text) => encoding.encode(text).length`) where the budget must be exact.
+ */
+export type TokenCounter = (text: string) => number;
+
+/** Rough number of characters per token of the common embedding tokenizers, for code and prose alike. */
+export const CHARS_PER_TOKEN = 4;
+
+/** Estimates the tokens of a text from its length, see `CHARS_PER_TOKEN`. */
+export const estimateTokens: TokenCounter = (text) => Math.ceil(text.length / CHARS_PER_TOKEN);
+
+/**
+ * Returns the longest prefix of `text` that has at most `maxTokens` tokens.
+ *
+ * Searches prefix lengths, so any counter that never counts a prefix as more tokens than the whole
+ * text works, tokenizers included.
+ */
+export function truncateToTokens(text: string, maxTokens: number, countTokens: TokenCounter = estimateTokens): string {
+  if (countTokens(text) <= maxTokens) {
+    return text;
+  }
+  let low = 0;
+  let high = text.length;
+  while (low < high) {
+    const middle = Math.ceil((low + high) / 2);
+    if (countTokens(text.slice(0, middle)) <= maxTokens) {
+      low = middle;
+    } else {
+      high = middle - 1;
+    }
+  }
+  return text.slice(0, low);
+}
+
+export interface TokenWindow {
+  text: string;
+  /** 0-based index of the first and last line of `text` it covers. */
+  startLine: number;
+  endLine: number;
+  /** Set when a single line had more than the budget and was cut to fit. */
+  truncated: boolean;
+}
+
+/**
+ * Splits a text at line breaks into consecutive windows of at most `maxTokens` tokens each. A line
+ * that has more tokens than that on its own is truncated to a window of its own.
+ *
+ * Tokens are counted per line, which may count a few more tokens than the tokenizer would for the
+ * joined window, never fewer for the estimate.
+ */
+export function splitByTokens(
+  text: string,
+  maxTokens: number,
+  countTokens: TokenCounter = estimateTokens
+): TokenWindow[] {
+  const lines = text.split('\n');
+  const windows: TokenWindow[] = [];
+  let start = 0;
+  let tokens = 0;
+  const flush = (end: number) => {
+    if (end > start) {
+      windows.push({ text: lines.slice(start, end).join('\n'), startLine: start, endLine: end - 1, truncated: false });
+    }
+    start = end;
+    tokens = 0;
+  };
+  for (let i = 0; i < lines.length; i++) {
+    // Every line but the last also carries its line break
+    const lineTokens = countTokens(i < lines.length - 1 ? `${lines[i]}\n` : lines[i]);
+    if (lineTokens > maxTokens) {
+      flush(i);
+      const truncated = truncateToTokens(lines[i], maxTokens, countTokens);
+      windows.push({ text: truncated, startLine: i, endLine: i, truncated: true });
+      start = i + 1;
+      continue;
+    }
+    if (tokens + lineTokens > maxTokens) {
+      flush(i);
+    }
+    tokens += lineTokens;
+  }
+  flush(lines.length);
+  return windows;
+}
@@ -0,0 +1,79 @@
+import { CodeChunk } from './elasticsearch';
+
+/**
+ * How stored vectors are compared to query vectors, selected via `SCS_IDXR_VECTOR_METRIC`.
+ *
+ * Scores are higher-is-better in every store:
+ * - `cosine`: the cosine similarity, in [-1, 1]. Vectors are normalized to unit length before they are
+ *   stored and queried, so every backend and the brute-force scan rank alike.
+ * - `dot_product`: the dot product of the vectors as the embedder returned them, unbounded.
+ * - `euclidean`: `1 / (1 + d²)` for the Euclidean distance `d`, in (0, 1].
+ */
+export const VECTOR_METRICS = ['cosine', 'dot_product', 'euclidean'] as const;
+export type VectorMetric = (typeof VECTOR_METRICS)[number];
+
+export const DEFAULT_VECTOR_METRIC: VectorMetric = 'cosine';
+
+/**
+ * @throws If `value` is not one of `VECTOR_METRICS`.
+ */
+export function parseVectorMetric(value: string): VectorMetric {
+  const metric = value.trim().toLowerCase();
+  if (!(VECTOR_METRICS as readonly string[]).includes(metric)) {
+    throw new Error(`Unknown vector metric "${value}". Supported metrics: ${VECTOR_METRICS.join(', ')}.`);
+  }
+  return metric as VectorMetric;
+}
+
+/** Scales a vector to unit length; the zero vector is returned as is. */
+export function normalizeVector(vector: number[]): number[] {
+  const norm = Math.sqrt(vector.reduce((sum, v) => sum + v * v, 0));
+  return norm === 0 || norm === 1 ? vector : vector.map((v) => v / norm);
+}
+
+/** The vector to store or query with: normalized for `cosine`, unchanged otherwise. */
+export function prepareVector(vector: number[], metric: VectorMetric): number[] {
+  return metric === 'cosine' ? normalizeVector(vector) : vector;
+}
+
+/** Prepares the `code_vector` of each chunk with `prepareVector`. */
+export function prepareChunkVectors(chunks: CodeChunk[], metric: VectorMetric): CodeChunk[] {
+  if (metric !== 'cosine') {
+    return chunks;
+  }
+  return chunks.map((chunk) =>
+    chunk.code_vector ? { ...chunk, code_vector: normalizeVector(chunk.code_vector) } : chunk
+  );
+}
+
+/** Converts a squared Euclidean distance into the `euclidean` score. */
+export function euclideanScore(squaredDistance: number): number {
+  return 1 / (1 + squaredDistance);
+}
+
+/**
+ * Scores a stored vector against a query vector with `metric`, as documented on `VECTOR_METRICS`.
+ * `cosine` divides by both norms, so vectors stored before normalization was introduced score the same.
+ */
+export function scoreVectors(stored: ArrayLike<number>, query: ArrayLike<number>, metric: VectorMetric): number {
+  let dot = 0;
+  let storedNorm = 0;
+  let queryNorm = 0;
+  let squaredDistance = 0;
+  for (let i = 0; i < stored.length; i++) {
+    dot += stored[i] * query[i];
+    storedNorm += stored[i] * stored[i];
+    queryNorm += query[i] * query[i];
+    squaredDistance += (stored[i] - query[i]) ** 2;
+  }
+  switch (metric) {
+    case 'cosine': {
+      const denominator = Math.sqrt(storedNorm) * Math.sqrt(queryNorm);
+      return denominator === 0 ? 0 : dot / denominator;
+    }
+    case 'dot_product':
+      return dot;
+    case 'euclidean':
+      return euclideanScore(squaredDistance);
+  }
+}
@@ -0,0 +1,36 @@
+import path from 'path';
+
+/** Files and chunks of one workspace of an index, as reported by `ChunkStore.getWorkspaces`. */
+export interface WorkspaceStats {
+  /** Workspace name, or null for locations stored before workspaces were recorded. */
+  workspace: string | null;
+  /** Distinct file paths with a location in the workspace, across branches. */
+  files: number;
+  /** Chunks with a location in the workspace; a chunk found in several workspaces counts in each. */
+  chunks: number;
+}
+
+/**
+ * Returns the workspace of a checkout that was not given one: the name of its directory.
+ */
+export function getDefaultWorkspace(root: string): string {
+  return path.basename(path.resolve(root));
+}
+
+/**
+ * Whether a location belongs to a workspace; without a workspace, every location does.
+ *
+ * Locations stored before workspaces were recorded have none and belong to every workspace, so an
+ * index built before then is still found, skipped when unchanged, and cleaned up by the next run.
+ */
+export function isInWorkspace(locationWorkspace: string | null | undefined, workspace: string | undefined): boolean {
+  return workspace === undefined || locationWorkspace == null || locationWorkspace === workspace;
+}
+
+/**
+ * Returns the key the last indexed commit of a branch is recorded under: the branch itself, or
+ * `<workspace>:<branch>` for a workspace. Branch names cannot contain `:`, so keys never collide.
+ */
+export function getCommitKey(branch: string, workspace?: string): string {
+  return workspace !== undefined ? `${workspace}:${branch}` : branch;
+}
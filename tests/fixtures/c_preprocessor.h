@@ -0,0 +1,27 @@
+#ifndef BUFFER_H
+#define BUFFER_H
+
+#include <stddef.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/** Allocates a buffer of `size` bytes. */
+char *buffer_alloc(size_t size);
+
+void buffer_free(char *buffer);
+
+#ifdef _WIN32
+int buffer_write(char *buffer, const wchar_t *text) {
+#else
+int buffer_write(char *buffer, const char *text) {
+#endif
+    return 0;
+}
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
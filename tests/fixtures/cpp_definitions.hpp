@@ -0,0 +1,20 @@
+#include <string>
+
+namespace net {
+
+/// A TCP connection.
+class Socket {
+public:
+    /// Opens the connection.
+    bool open(const std::string &host);
+    void close();
+};
+
+} // namespace net
+
+// Not a doc comment.
+bool net::Socket::open(const std::string &host) {
+    return !host.empty();
+}
+
+int connect_all();
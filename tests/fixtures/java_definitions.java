@@ -0,0 +1,34 @@
+package com.acme.billing;
+
+import java.util.List;
+
+/**
+ * Computes invoice totals.
+ */
+@Service
+public class InvoiceService {
+    private final List<String> lines;
+
+    public InvoiceService(List<String> lines) {
+        this.lines = lines;
+    }
+
+    /** Sums the invoice lines. */
+    @Override
+    public int total() {
+        return lines.size();
+    }
+
+    enum Status {
+        OPEN,
+        PAID;
+
+        boolean isFinal() {
+            return this == PAID;
+        }
+    }
+}
+
+interface Repository {
+    List<String> findAll();
+}
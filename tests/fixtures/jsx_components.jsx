@@ -0,0 +1,3 @@
+export const Header = ({ title }) => <h1>{title}</h1>;
+
+export default () => <Header title="Home" />;
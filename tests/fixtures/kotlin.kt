@@ -0,0 +1,31 @@
+package com.acme.billing
+
+import kotlin.math.max
+
+/**
+ * A line of an invoice.
+ */
+data class InvoiceLine(val description: String, val amount: Int)
+
+@Service
+class InvoiceService(private val repository: Repository) {
+    /** Sums the invoice lines. */
+    fun total(lines: List<InvoiceLine>): Int = lines.sumOf { it.amount }
+
+    companion object {
+        fun create(): InvoiceService = InvoiceService(Repository())
+    }
+}
+
+interface Repository {
+    fun findAll(): List<InvoiceLine>
+}
+
+object Formatter {
+    fun format(amount: Int): String = max(amount, 0).toString()
+}
+
+// Not a doc comment.
+fun String.shout(): String = uppercase()
+
+private fun helper() = Unit
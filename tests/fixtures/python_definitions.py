@@ -0,0 +1,28 @@
+import functools
+
+MAX_RETRIES = 3
+
+
+class Service:
+    @property
+    def name(self):
+        return "service"
+
+    @staticmethod
+    def create():
+        return Service()
+
+    async def fetch(self, url):
+        def build_headers():
+            return {"accept": "json"}
+
+        return await request(url, build_headers())
+
+
+@functools.lru_cache(maxsize=None)
+def cached_lookup(key):
+    return key
+
+
+async def run():
+    await Service().fetch("https://example.com")
@@ -0,0 +1,47 @@
+use std::collections::HashMap;
+use std::fmt;
+
+/// A named counter.
+#[derive(Debug, Clone)]
+pub struct Counter {
+    name: String,
+    counts: HashMap<String, u32>,
+}
+
+pub enum Level {
+    Low,
+    High,
+}
+
+pub trait Describe {
+    fn describe(&self) -> String;
+}
+
+// Not a doc comment.
+
+impl Counter {
+    /// Creates an empty counter.
+    pub fn new(name: &str) -> Self {
+        Counter { name: name.to_string(), counts: HashMap::new() }
+    }
+
+    fn bump(&mut self, key: &str) {
+        *self.counts.entry(key.to_string()).or_insert(0) += 1;
+    }
+}
+
+impl fmt::Display for Counter {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
+        write!(f, "{}", self.name)
+    }
+}
+
+macro_rules! square {
+    ($x:expr) => {
+        $x * $x
+    };
+}
+
+pub(crate) fn helper() -> u32 {
+    square!(3)
+}
@@ -0,0 +1,23 @@
+import React from 'react';
+
+interface ButtonProps {
+  label: string;
+}
+
+type Size = 'small' | 'large';
+
+export const Button = ({ label }: ButtonProps) => {
+  return <button className="btn">{label}</button>;
+};
+
+export const add = (a: number, b: number) => { return a + b; }, subtract = (a: number, b: number) => { return a - b; };
+
+export class Counter extends React.Component {
+  render() {
+    return <span>{this.props.children}</span>;
+  }
+}
+
+export default function () {
+  return <Button label="Anonymous" />;
+}
@@ -0,0 +1,83 @@
+import { describe, it, expect } from 'vitest';
+import { hasPreprocessorConditionals, maskInactiveBranches } from '../../src/utils/c_preprocessor';
+
+const lines = (...source: string[]) => source.join('\n');
+
+describe('maskInactiveBranches', () => {
+  it('SHOULD keep positions and blank directive lines', () => {
+    const source = lines('#ifdef DEBUG', 'int x = 1;', '#endif');
+    const masked = maskInactiveBranches(source, 'c');
+
+    expect(masked).toHaveLength(source.length);
+    expect(masked.split('\n')).toEqual(['            ', 'int x = 1;', '      ']);
+  });
+
+  it('SHOULD take the first branch of conditions it cannot evaluate', () => {
+    const source = lines(
+      '#if defined(_WIN32)',
+      'int a(void) {',
+      '#elif defined(__APPLE__)',
+      'int b(void) {',
+      '#else',
+      'int c(void) {',
+      '#endif',
+      '}'
+    );
+    const masked = maskInactiveBranches(source, 'c');
+
+    expect(masked).toContain('int a(void) {');
+    expect(masked).not.toContain('int b');
+    expect(masked).not.toContain('int c');
+    expect(masked.trimEnd().endsWith('}')).toBe(true);
+  });
+
+  it('SHOULD resolve __cplusplus per language', () => {
+    const source = lines(
+      '#ifdef __cplusplus',
+      'extern "C" {',
+      '#endif',
+      'void f(void);',
+      '#ifdef __cplusplus',
+      '}',
+      '#endif'
+    );
+
+    expect(maskInactiveBranches(source, 'c')).not.toContain('extern');
+    expect(maskInactiveBranches(source, 'cpp')).toContain('extern "C" {');
+    expect(maskInactiveBranches(lines('#if !defined(__cplusplus)', 'int c_only;', '#endif'), 'cpp')).not.toContain(
+      'c_only'
+    );
+  });
+
+  it('SHOULD evaluate #if 0 and #if 1 and nested conditionals', () => {
+    const source = lines('#if 0', 'dead();', '#ifdef X', 'nested();', '#endif', '#else', 'live();', '#endif');
+    const masked = maskInactiveBranches(source, 'c');
+
+    expect(masked).not.toContain('dead');
+    expect(masked).not.toContain('nested');
+    expect(masked).toContain('live();');
+  });
+
+  it('SHOULD blank the continuation lines of directives', () => {
+    const source = lines(
+      '#if defined(A) && \\',
+      '    defined(B)',
+      'int x;',
+      '#endif',
+      '#if 0',
+      '#define Y \\',
+      '  1',
+      '#endif'
+    );
+    const masked = maskInactiveBranches(source, 'c');
+
+    expect(masked.trim()).toBe('int x;');
+  });
+});
+
+describe('hasPreprocessorConditionals', () => {
+  it('SHOULD detect #if, #ifdef and #ifndef lines', () => {
+    expect(hasPreprocessorConditionals('  #  ifdef X\n#endif')).toBe(true);
+    expect(hasPreprocessorConditionals('#include <stdio.h>\n#define X 1')).toBe(false);
+  });
+});
@@ -0,0 +1,39 @@
+import { describe, it, expect } from 'vitest';
+import {
+  IndexingCancelledError,
+  cancelActiveRun,
+  sleepUnlessCancelled,
+  startCancellableRun,
+  throwIfCancelled,
+} from '../../src/utils/cancellation';
+
+describe('cancellation', () => {
+  it('SHOULD throw IndexingCancelledError only once the signal is aborted', () => {
+    const controller = new AbortController();
+
+    expect(() => throwIfCancelled(controller.signal)).not.toThrow();
+    expect(() => throwIfCancelled(undefined)).not.toThrow();
+    controller.abort();
+    expect(() => throwIfCancelled(controller.signal)).toThrow(IndexingCancelledError);
+  });
+
+  it('SHOULD cancel the active run once and report later signals as unhandled', () => {
+    const signal = startCancellableRun();
+
+    expect(cancelActiveRun()).toBe(true);
+    expect(signal.aborted).toBe(true);
+    expect(signal.reason).toBeInstanceOf(IndexingCancelledError);
+    expect(cancelActiveRun()).toBe(false);
+  });
+
+  it('SHOULD wake up a sleep when the signal is aborted', async () => {
+    const controller = new AbortController();
+    const started = Date.now();
+
+    const sleep = sleepUnlessCancelled(60_000, controller.signal);
+    controller.abort();
+    await sleep;
+
+    expect(Date.now() - started).toBeLessThan(1000);
+  });
+});
@@ -0,0 +1,114 @@
+import { describe, it, expect } from 'vitest';
+import { ChunkDeduplicator, hammingDistance, simHash } from '../../src/utils/chunk_dedup';
+import { CodeChunk } from '../../src/utils/elasticsearch';
+import { makeChunk } from './utils/fixtures';
+
+const HANDLER = [
+  'export async function handleCreateUser(request, response) {',
+  '  const body = await parseJsonBody(request);',
+  '  if (!body.email || !body.name) {',
+  "    return response.status(400).json({ error: 'email and name are required' });",
+  '  }',
+  '  const user = await users.create({ email: body.email, name: body.name });',
+  '  audit.log("user.created", { id: user.id });',
+  '  return response.status(201).json(user);',
+  '}',
+].join('\n');
+
+/** A chunk of `HANDLER` as the parser cuts it from `src/a.ts`. */
+const handlerChunk = (overrides: Partial<CodeChunk>): CodeChunk =>
+  makeChunk({
+    kind: 'function_declaration',
+    directoryPath: 'src',
+    directoryName: 'src',
+    directoryDepth: 1,
+    git_file_hash: 'file-a',
+    chunk_hash: 'hash-a',
+    endLine: 9,
+    content: HANDLER,
+    semantic_text: HANDLER,
+    ...overrides,
+  });
+
+describe('simHash', () => {
+  it('SHOULD give near-identical texts close fingerprints and unrelated texts distant ones', () => {
+    const edited = HANDLER.replace('"user.created"', '"user.added"');
+    const unrelated = [
+      'class Matrix {',
+      '  multiply(other) {',
+      '    return this.rows.map((row) => dot(row, other));',
+      '  }',
+      '}',
+    ].join('\n');
+
+    expect(hammingDistance(simHash(HANDLER), simHash(HANDLER))).toBe(0);
+    expect(hammingDistance(simHash(HANDLER), simHash(edited))).toBeLessThanOrEqual(6);
+    expect(hammingDistance(simHash(HANDLER), simHash(unrelated))).toBeGreaterThan(16);
+  });
+});
+
+describe('ChunkDeduplicator', () => {
+  it('SHOULD fold a near-duplicate into the canonical chunk at its own location', () => {
+    const deduplicator = new ChunkDeduplicator(0.9);
+    const canonical = handlerChunk({});
+    const copy = handlerChunk({
+      filePath: 'vendor/b.ts',
+      directoryPath: 'vendor',
+      directoryName: 'vendor',
+      git_file_hash: 'file-b',
+      chunk_hash: 'hash-b',
+      startLine: 40,
+      endLine: 48,
+      content: HANDLER.replace('status(201)', 'status(200)'),
+      semantic_text: HANDLER.replace('status(201)', 'status(200)'),
+    });
+
+    expect(deduplicator.fold(canonical)).toBe(canonical);
+    const folded = deduplicator.fold(copy);
+
+    expect(folded).toMatchObject({
+      content: canonical.content,
+      chunk_hash: canonical.chunk_hash,
+      filePath: 'vendor/b.ts',
+      directoryPath: 'vendor',
+      git_file_hash: 'file-b',
+      startLine: 40,
+      endLine: 48,
+    });
+    expect(deduplicator.foldedCount).toBe(1);
+  });
+
+  it('SHOULD fold exact duplicates regardless of their size', () => {
+    const deduplicator = new ChunkDeduplicator();
+    const short = handlerChunk({ content: 'return nil', semantic_text: 'return nil', chunk_hash: 'short' });
+
+    deduplicator.fold(short);
+    const folded = deduplicator.fold({ ...short, kind: 'return_statement', filePath: 'src/b.ts' });
+
+    expect(folded).toMatchObject({ kind: 'function_declaration', filePath: 'src/b.ts' });
+  });
+
+  it('SHOULD keep short, different, or other-language chunks on their own', () => {
+    const deduplicator = new ChunkDeduplicator(0.9);
+    deduplicator.fold(handlerChunk({ content: 'return a + b', chunk_hash: 'sum' }));
+    deduplicator.fold(handlerChunk({}));
+
+    const short = handlerChunk({ content: 'return a - b', chunk_hash: 'difference', filePath: 'src/b.ts' });
+    const otherLanguage = handlerChunk({ language: 'javascript', chunk_hash: 'js', filePath: 'src/a.js' });
+    const unrelated = handlerChunk({
+      content: 'export function clamp(value, min, max) {\n  return Math.min(Math.max(value, min), max);\n}',
+      chunk_hash: 'clamp',
+    });
+
+    expect(deduplicator.fold(short)).toBe(short);
+    expect(deduplicator.fold(otherLanguage)).toBe(otherLanguage);
+    expect(deduplicator.fold(unrelated)).toBe(unrelated);
+    expect(deduplicator.foldedCount).toBe(0);
+  });
+
+  it('SHOULD reject thresholds outside (0, 1]', () => {
+    expect(() => new ChunkDeduplicator(0)).toThrow('Invalid dedup threshold: 0');
+    expect(() => new ChunkDeduplicator(1.5)).toThrow('Invalid dedup threshold: 1.5');
+    expect(() => new ChunkDeduplicator(1)).not.toThrow();
+  });
+});
@@ -0,0 +1,46 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+import { canReuseStoredVectors } from '../../src/utils/chunk_store';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+
+describe('canReuseStoredVectors', () => {
+  let tmpDir: string;
+  let store: SqliteStore;
+  const logger = { debug: vi.fn(), info: vi.fn(), warn: vi.fn(), error: vi.fn() };
+  const model = { embedder: 'http:small', template: '{text}' };
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-chunk-store-'));
+    store = new SqliteStore({ dbPath: path.join(tmpDir, 'store.db') });
+  });
+
+  afterEach(async () => {
+    await store.close();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD record the model of a store without one and reuse its vectors', async () => {
+    expect(await canReuseStoredVectors(store, model)).toBe(true);
+    expect(await store.getEmbeddingModel()).toEqual(model);
+  });
+
+  it('SHOULD reuse vectors only WHEN the embedder and the template match the recorded ones', async () => {
+    await store.setEmbeddingModel(model);
+
+    expect(await canReuseStoredVectors(store, model, { logger })).toBe(true);
+    expect(await canReuseStoredVectors(store, { ...model, embedder: 'http:large' }, { logger })).toBe(false);
+    expect(await canReuseStoredVectors(store, { ...model, template: '{body}' }, { logger })).toBe(false);
+    expect(logger.warn).toHaveBeenCalledTimes(2);
+    expect(await store.getEmbeddingModel()).toEqual(model);
+  });
+
+  it('SHOULD never reuse vectors WHEN forced, and record the new model', async () => {
+    await store.setEmbeddingModel(model);
+
+    expect(await canReuseStoredVectors(store, model, { force: true })).toBe(false);
+    expect(await canReuseStoredVectors(store, { ...model, template: '{body}' }, { force: true })).toBe(false);
+    expect(await store.getEmbeddingModel()).toEqual({ ...model, template: '{body}' });
+  });
+});
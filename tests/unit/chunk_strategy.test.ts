@@ -0,0 +1,24 @@
+import { describe, it, expect } from 'vitest';
+
+import { parseChunkStrategies, validateChunkStrategies } from '../../src/utils/chunk_strategy';
+
+describe('chunk strategies', () => {
+  it('SHOULD parse language:strategy entries case-insensitively', () => {
+    expect(parseChunkStrategies(['go:symbol', ' JSON : Whole-File', 'yaml:fixed-window', 'yaml:whole-file'])).toEqual({
+      go: 'symbol',
+      json: 'whole-file',
+      yaml: 'whole-file',
+    });
+    expect(parseChunkStrategies([])).toEqual({});
+  });
+
+  it('SHOULD reject malformed entries, unknown languages, and unknown strategies', () => {
+    expect(() => parseChunkStrategies(['json'])).toThrow(
+      'Invalid chunk strategy "json". Must be language:strategy, e.g. json:whole-file.'
+    );
+    expect(() => parseChunkStrategies(['jsonc:whole-file'])).toThrow('Unknown language "jsonc" in chunk strategies.');
+    expect(() => validateChunkStrategies({ json: 'paragraphs' })).toThrow(
+      'Unknown chunk strategy "paragraphs" for json. Supported strategies: symbol, whole-file, fixed-window.'
+    );
+  });
+});
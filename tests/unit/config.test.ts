@@ -1,3 +1,6 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
 import { beforeEach, afterEach, describe, it, expect, vi } from 'vitest';
 import { withTestEnv } from './utils/test_env';
 
@@ -71,3 +74,90 @@ describe('indexingConfig', () => {
       expect(() => indexingConfig.enableDenseVectors).toThrow(/must be a boolean/);
     }));
 });
+
+describe('embeddingConfig', () => {
+  const originalEnv = process.env;
+
+  beforeEach(async () => {
+    vi.resetModules();
+    process.env = { ...originalEnv };
+  });
+
+  afterEach(() => {
+    process.env = originalEnv;
+  });
+
+  it('uses sensible batching defaults', () =>
+    withTestEnv(
+      {
+        SCS_IDXR_EMBEDDING_BATCH_SIZE: undefined,
+        SCS_IDXR_EMBEDDING_CONCURRENCY: undefined,
+        SCS_IDXR_EMBEDDING_MAX_RETRIES: undefined,
+      },
+      async () => {
+        const { embeddingConfig } = await import('../../src/config');
+        expect(embeddingConfig.batchSize).toBe(64);
+        expect(embeddingConfig.concurrency).toBe(2);
+        expect(embeddingConfig.maxRetries).toBe(3);
+      }
+    ));
+
+  it('throws when SCS_IDXR_EMBEDDING_BATCH_SIZE=0 (must be positive)', () =>
+    withTestEnv({ SCS_IDXR_EMBEDDING_BATCH_SIZE: '0' }, async () => {
+      const { embeddingConfig } = await import('../../src/config');
+      expect(() => embeddingConfig.batchSize).toThrow(/must be a positive integer/);
+    }));
+
+  it('allows SCS_IDXR_EMBEDDING_MAX_RETRIES=0', () =>
+    withTestEnv({ SCS_IDXR_EMBEDDING_MAX_RETRIES: '0' }, async () => {
+      const { embeddingConfig } = await import('../../src/config');
+      expect(embeddingConfig.maxRetries).toBe(0);
+    }));
+});
+
+describe('config file', () => {
+  const originalEnv = process.env;
+  let tmpDir: string;
+
+  beforeEach(() => {
+    vi.resetModules();
+    process.env = { ...originalEnv };
+    tmpDir = fs.realpathSync(fs.mkdtempSync(path.join(os.tmpdir(), 'scs-config-')));
+    fs.writeFileSync(
+      path.join(tmpDir, '.scsi.yaml'),
+      ['store: sqlite', 'exclude: ["**/*.min.js", vendor/]', 'chunk:', '  lines: 20', 'chunk_lines: 30'].join('\n')
+    );
+    fs.mkdirSync(path.join(tmpDir, 'src'));
+    vi.spyOn(process, 'cwd').mockReturnValue(path.join(tmpDir, 'src'));
+  });
+
+  afterEach(() => {
+    process.env = originalEnv;
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  const env = { SCS_IDXR_STORE: undefined, SCS_IDXR_EXCLUDE: undefined, SCS_IDXR_DEFAULT_CHUNK_LINES: '25' };
+
+  it('applies settings from the closest .scsi.yaml below environment variables', () =>
+    withTestEnv(env, async () => {
+      const warn = vi.spyOn(console, 'warn');
+      const { configFile, indexingConfig, storeConfig } = await import('../../src/config');
+
+      expect(configFile?.path).toBe(path.join(tmpDir, '.scsi.yaml'));
+      expect(storeConfig.backend).toBe('sqlite');
+      expect(indexingConfig.exclude).toEqual(['**/*.min.js', 'vendor/']);
+      expect(indexingConfig.defaultChunkLines).toBe(25);
+      expect(configFile?.unknownKeys).toEqual(['chunk_lines']);
+      expect(warn).not.toHaveBeenCalled();
+    }));
+
+  it('reports where each effective setting comes from', () =>
+    withTestEnv({ ...env, SCS_IDXR_DEDUP: undefined }, async () => {
+      const { resolveSettings } = await import('../../src/commands/config_command');
+      const settings = new Map(resolveSettings().map((setting) => [setting.key, setting]));
+
+      expect(settings.get('store')).toMatchObject({ value: 'sqlite', source: 'file' });
+      expect(settings.get('chunk.lines')).toMatchObject({ value: 25, source: 'env' });
+      expect(settings.get('dedup')).toMatchObject({ value: false, source: 'default' });
+    }));
+});
@@ -0,0 +1,90 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+
+import { ConfigFileSetting, applyConfigFile, findConfigFile, readConfigFile } from '../../src/utils/config_file';
+
+const settings: ConfigFileSetting[] = [
+  { key: 'store', env: 'SCS_IDXR_STORE' },
+  { key: 'include', env: 'SCS_IDXR_INCLUDE', list: true },
+  { key: 'chunk.lines', env: 'SCS_IDXR_DEFAULT_CHUNK_LINES' },
+  { key: 'sqlite.dir', env: 'SCS_IDXR_SQLITE_STORE_DIR', path: true },
+];
+
+describe('config_file', () => {
+  let tmpDir: string;
+
+  beforeEach(() => {
+    tmpDir = fs.realpathSync(fs.mkdtempSync(path.join(os.tmpdir(), 'scs-config-')));
+  });
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  const write = (name: string, content: string) => {
+    const filePath = path.join(tmpDir, name);
+    fs.mkdirSync(path.dirname(filePath), { recursive: true });
+    fs.writeFileSync(filePath, content);
+    return filePath;
+  };
+
+  it('SHOULD find the closest config file in the directory or a parent', () => {
+    const outer = write('.scsi.yaml', 'store: sqlite\n');
+    const inner = write('repo/.scsi.yml', 'store: qdrant\n');
+    fs.mkdirSync(path.join(tmpDir, 'repo/src/deep'), { recursive: true });
+    fs.mkdirSync(path.join(tmpDir, 'other'));
+
+    expect(findConfigFile(path.join(tmpDir, 'repo/src/deep'))).toBe(inner);
+    expect(findConfigFile(path.join(tmpDir, 'other'))).toBe(outer);
+  });
+
+  it('SHOULD map nested settings to their environment variables', () => {
+    const filePath = write(
+      'repo/.scsi.yaml',
+      [
+        'store: sqlite',
+        'include: [src/**, lib/**]',
+        'chunk:',
+        '  lines: 20',
+        'sqlite:',
+        '  dir: .stores',
+        'embedder:',
+      ].join('\n')
+    );
+
+    expect(readConfigFile(filePath, [...settings, { key: 'embedder', env: 'SCS_IDXR_EMBEDDER' }])).toEqual({
+      path: filePath,
+      env: {
+        SCS_IDXR_STORE: 'sqlite',
+        SCS_IDXR_INCLUDE: 'src/**,lib/**',
+        SCS_IDXR_DEFAULT_CHUNK_LINES: '20',
+        SCS_IDXR_SQLITE_STORE_DIR: path.join(tmpDir, 'repo/.stores'),
+      },
+      unknownKeys: [],
+    });
+  });
+
+  it('SHOULD report unknown keys instead of failing', () => {
+    const filePath = write('.scsi.yaml', 'stroe: sqlite\nchunk:\n  line: 20\n');
+
+    expect(readConfigFile(filePath, settings)).toMatchObject({ env: {}, unknownKeys: ['stroe', 'chunk.line'] });
+  });
+
+  it('SHOULD reject values of the wrong shape and files that are not mappings', () => {
+    expect(() => readConfigFile(write('a.yaml', 'store: [sqlite]\n'), settings)).toThrow(
+      /store in .*a\.yaml must be a string, number, or boolean/
+    );
+    expect(() => readConfigFile(write('b.yaml', '- sqlite\n'), settings)).toThrow(/must hold a mapping/);
+    expect(() => readConfigFile(write('c.yaml', 'store: [\n'), settings)).toThrow(/cannot read/);
+  });
+
+  it('SHOULD leave variables that are already set alone', () => {
+    const env: NodeJS.ProcessEnv = { SCS_IDXR_STORE: 'qdrant', SCS_IDXR_INCLUDE: '' };
+    const file = { path: 'x', env: { SCS_IDXR_STORE: 'sqlite', SCS_IDXR_INCLUDE: 'src/**' }, unknownKeys: [] };
+
+    expect(applyConfigFile(file, env)).toEqual(['SCS_IDXR_INCLUDE']);
+    expect(env).toEqual({ SCS_IDXR_STORE: 'qdrant', SCS_IDXR_INCLUDE: 'src/**' });
+  });
+});
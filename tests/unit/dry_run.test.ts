@@ -0,0 +1,77 @@
+import { execFileSync } from 'child_process';
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+
+import { dryRunIndex } from '../../src/commands/dry_run';
+import { parseEmbedTemplate } from '../../src/utils/embed_template';
+import { StrictIndexError } from '../../src/utils/index_errors';
+import { withTestEnv } from './utils/test_env';
+
+function writeFile(root: string, relativePath: string, content: string): void {
+  const filePath = path.join(root, relativePath);
+  fs.mkdirSync(path.dirname(filePath), { recursive: true });
+  fs.writeFileSync(filePath, content);
+}
+
+describe('dryRunIndex', () => {
+  let root: string;
+
+  beforeEach(() => {
+    root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-dry-run-'));
+    execFileSync('git', ['init', '-q'], { cwd: root });
+    writeFile(root, '.gitignore', 'build/\n');
+    writeFile(root, 'src/queue.ts', 'export function drainQueue() {\n  return [];\n}\n');
+    writeFile(root, 'src/worker.ts', 'export function runWorker() {\n  return 1;\n}\n');
+    writeFile(root, 'config/settings.json', '{\n  "retries": 3\n}\n');
+    writeFile(root, 'build/bundle.ts', 'export function bundled() {\n  return 2;\n}\n');
+  });
+
+  afterEach(() => {
+    fs.rmSync(root, { recursive: true, force: true });
+  });
+
+  const options = {
+    repoName: 'repo',
+    branch: 'main',
+    languages: 'typescript,json',
+    embedTemplate: parseEmbedTemplate('{text}'),
+  };
+
+  it('SHOULD count the files, chunks, and tokens per language without writing anything', async () => {
+    const before = execFileSync('git', ['status', '--porcelain', '--ignored'], { cwd: root }).toString();
+
+    const report = await dryRunIndex(root, options);
+
+    expect(report).toMatchObject({ files: 3, errors: [] });
+    expect(Object.keys(report.languages)).toEqual(['typescript', 'json']);
+    const { typescript, json } = report.languages;
+    expect(typescript).toMatchObject({ files: 2 });
+    expect(typescript.chunks).toBeGreaterThanOrEqual(2);
+    expect(json).toMatchObject({ files: 1, chunks: 1 });
+    expect(json.estimatedTokens).toBeGreaterThan(0);
+    expect(report.chunks).toBe(typescript.chunks + json.chunks);
+    expect(report.estimatedTokens).toBe(typescript.estimatedTokens + json.estimatedTokens);
+    expect(execFileSync('git', ['status', '--porcelain', '--ignored'], { cwd: root }).toString()).toBe(before);
+  });
+
+  it('SHOULD apply the include and exclude patterns of an index run', async () => {
+    const report = await dryRunIndex(root, { ...options, exclude: ['*.json'] });
+
+    expect(report.files).toBe(2);
+    expect(Object.keys(report.languages)).toEqual(['typescript']);
+  });
+
+  it('SHOULD report skipped files, and stop at the first degraded one WHEN strict', async () => {
+    writeFile(root, 'src/data.ts', 'export const data = 1;\u0000\n');
+
+    const report = await dryRunIndex(root, options);
+
+    expect(report.errors).toEqual([expect.objectContaining({ path: 'src/data.ts', skipped: 'binary' })]);
+    expect(report.files).toBe(3);
+    await withTestEnv({ SCS_IDXR_MAX_CHUNK_SIZE_BYTES: '10' }, () =>
+      expect(dryRunIndex(root, { ...options, strict: true })).rejects.toThrow(StrictIndexError)
+    );
+  });
+});
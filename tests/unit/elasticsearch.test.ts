@@ -248,6 +248,500 @@ describe('deleteDocumentsByFilePath', () => {
   });
 });
 
+describe('getIndexedFileHashes', () => {
+  let mockSearch: Mock;
+  let mockIndicesExists: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    mockIndicesExists = vi.fn();
+
+    elasticsearch.setClient({
+      search: mockSearch,
+      indices: {
+        exists: mockIndicesExists,
+      },
+    } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should return an empty map when the locations index does not exist', async () => {
+    mockIndicesExists.mockResolvedValue(false);
+
+    const result = await elasticsearch.getIndexedFileHashes('idx', 'main');
+
+    expect(result.size).toBe(0);
+    expect(mockSearch).not.toHaveBeenCalled();
+  });
+
+  it('should page through composite buckets and group hashes by file path', async () => {
+    mockIndicesExists.mockResolvedValue(true);
+    mockSearch
+      .mockResolvedValueOnce({
+        aggregations: {
+          files: {
+            after_key: { filePath: 'b.ts', hash: 'h2' },
+            buckets: [{ key: { filePath: 'a.ts', hash: 'h1' } }, { key: { filePath: 'b.ts', hash: 'h2' } }],
+          },
+        },
+      })
+      .mockResolvedValueOnce({
+        aggregations: {
+          files: {
+            after_key: { filePath: 'b.ts', hash: 'h3' },
+            buckets: [{ key: { filePath: 'b.ts', hash: 'h3' } }],
+          },
+        },
+      })
+      .mockResolvedValueOnce({ aggregations: { files: { buckets: [] } } });
+
+    const result = await elasticsearch.getIndexedFileHashes('idx', 'main');
+
+    expect(mockSearch).toHaveBeenCalledTimes(3);
+    const firstArgs = mockSearch.mock.calls[0]?.[0] as { index: string; query: unknown };
+    expect(firstArgs.index).toBe('idx_locations');
+    expect(firstArgs.query).toEqual({ term: { git_branch: 'main' } });
+    const secondArgs = mockSearch.mock.calls[1]?.[0] as { aggs: { files: { composite: { after?: unknown } } } };
+    expect(secondArgs.aggs.files.composite.after).toEqual({ filePath: 'b.ts', hash: 'h2' });
+
+    expect(Array.from(result.get('a.ts') ?? [])).toEqual(['h1']);
+    expect(Array.from(result.get('b.ts') ?? [])).toEqual(['h2', 'h3']);
+  });
+
+  it('should also match unlabeled locations WHEN a workspace is given', async () => {
+    mockIndicesExists.mockResolvedValue(true);
+    mockSearch.mockResolvedValueOnce({ aggregations: { files: { buckets: [] } } });
+
+    await elasticsearch.getIndexedFileHashes('idx', 'main', 'web');
+
+    const args = mockSearch.mock.calls[0]?.[0] as { query: unknown };
+    expect(args.query).toEqual({
+      bool: {
+        filter: [
+          { term: { git_branch: 'main' } },
+          {
+            bool: {
+              should: [{ term: { workspace: 'web' } }, { bool: { must_not: { exists: { field: 'workspace' } } } }],
+              minimum_should_match: 1,
+            },
+          },
+        ],
+      },
+    });
+  });
+});
+
+describe('getIndexWorkspaces', () => {
+  let mockSearch: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    elasticsearch.setClient({
+      search: mockSearch,
+      indices: { exists: vi.fn().mockResolvedValue(true) },
+    } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should count files and chunks per workspace, with a null bucket for unlabeled locations', async () => {
+    mockSearch
+      .mockResolvedValueOnce({
+        aggregations: {
+          workspaces: {
+            after_key: { workspace: 'api' },
+            buckets: [
+              { key: { workspace: null }, files: { value: 4 }, chunks: { value: 9 } },
+              { key: { workspace: 'api' }, files: { value: 2 }, chunks: { value: 3 } },
+            ],
+          },
+        },
+      })
+      .mockResolvedValueOnce({ aggregations: { workspaces: { buckets: [] } } });
+
+    const result = await elasticsearch.getIndexWorkspaces('idx');
+
+    expect(result).toEqual([
+      { workspace: null, files: 4, chunks: 9 },
+      { workspace: 'api', files: 2, chunks: 3 },
+    ]);
+    const firstArgs = mockSearch.mock.calls[0]?.[0] as {
+      index: string;
+      aggs: { workspaces: { composite: { sources: unknown } } };
+    };
+    expect(firstArgs.index).toBe('idx_locations');
+    expect(firstArgs.aggs.workspaces.composite.sources).toEqual([
+      { workspace: { terms: { field: 'workspace', missing_bucket: true } } },
+    ]);
+    const secondArgs = mockSearch.mock.calls[1]?.[0] as { aggs: { workspaces: { composite: { after?: unknown } } } };
+    expect(secondArgs.aggs.workspaces.composite.after).toEqual({ workspace: 'api' });
+  });
+});
+
+describe('exportCodeChunks', () => {
+  let mockSearch: Mock;
+  let mockOpenPit: Mock;
+  let mockClosePit: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    mockOpenPit = vi.fn();
+    mockClosePit = vi.fn();
+
+    elasticsearch.setClient({
+      search: mockSearch,
+      openPointInTime: mockOpenPit,
+      closePointInTime: mockClosePit,
+      indices: {
+        exists: vi.fn().mockResolvedValue(true),
+      },
+    } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should yield each chunk document once per location and close both points in time', async () => {
+    mockOpenPit.mockResolvedValueOnce({ id: 'pit-chunks' }).mockResolvedValueOnce({ id: 'pit-locations' });
+    const source = {
+      type: 'code',
+      language: 'typescript',
+      chunk_hash: 'chunk_hash_1',
+      content: 'const a = 1;',
+      semantic_text: { text: 'const a = 1;' },
+      code_vector: [1, 0, 0],
+      symbolTokens: ['a'],
+      created_at: '2024-01-01T00:00:00.000Z',
+      updated_at: '2024-01-01T00:00:00.000Z',
+    };
+    mockSearch
+      .mockResolvedValueOnce({ hits: { hits: [{ _id: 'chunk-1', sort: [1], _source: source }] } })
+      .mockResolvedValueOnce({
+        hits: {
+          hits: [
+            { _id: 'loc-2', sort: [2], _source: { chunk_id: 'chunk-1', filePath: 'b.ts', startLine: 1, endLine: 1 } },
+            {
+              _id: 'loc-1',
+              sort: [3],
+              _source: { chunk_id: 'chunk-1', filePath: 'a.ts', startLine: 1, endLine: 1, git_branch: 'main' },
+            },
+          ],
+        },
+      })
+      .mockResolvedValueOnce({ hits: { hits: [] } });
+
+    const pages: CodeChunk[][] = [];
+    for await (const page of elasticsearch.exportCodeChunks('idx')) {
+      pages.push(page);
+    }
+
+    expect(pages).toHaveLength(1);
+    expect(pages[0].map((chunk) => chunk.filePath)).toEqual(['a.ts', 'b.ts']);
+    expect(pages[0][0]).toEqual({
+      type: 'code',
+      language: 'typescript',
+      chunk_hash: 'chunk_hash_1',
+      content: 'const a = 1;',
+      semantic_text: 'const a = 1;',
+      code_vector: [1, 0, 0],
+      created_at: '2024-01-01T00:00:00.000Z',
+      updated_at: '2024-01-01T00:00:00.000Z',
+      filePath: 'a.ts',
+      startLine: 1,
+      endLine: 1,
+      git_branch: 'main',
+    });
+    const locationsArgs = mockSearch.mock.calls[1]?.[0] as { pit: { id: string }; query: unknown };
+    expect(locationsArgs.pit.id).toBe('pit-locations');
+    expect(locationsArgs.query).toEqual({ terms: { chunk_id: ['chunk-1'] } });
+    expect(mockClosePit).toHaveBeenCalledWith({ id: 'pit-chunks' });
+    expect(mockClosePit).toHaveBeenCalledWith({ id: 'pit-locations' });
+  });
+});
+
+describe('getVectorDimensions', () => {
+  let mockGetMapping: Mock;
+  let mockIndicesExists: Mock;
+
+  beforeEach(() => {
+    mockGetMapping = vi.fn();
+    mockIndicesExists = vi.fn();
+
+    elasticsearch.setClient({
+      indices: {
+        exists: mockIndicesExists,
+        getMapping: mockGetMapping,
+      },
+    } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should return the code_vector dims from the mapping', async () => {
+    mockIndicesExists.mockResolvedValue(true);
+    mockGetMapping.mockResolvedValue({
+      idx: { mappings: { properties: { code_vector: { type: 'dense_vector', dims: 384 } } } },
+    });
+
+    await expect(elasticsearch.getVectorDimensions('idx')).resolves.toBe(384);
+  });
+
+  it('should return null when the index does not exist', async () => {
+    mockIndicesExists.mockResolvedValue(false);
+
+    await expect(elasticsearch.getVectorDimensions('idx')).resolves.toBeNull();
+    expect(mockGetMapping).not.toHaveBeenCalled();
+  });
+
+  it('should return null when the mapping has no code_vector field', async () => {
+    mockIndicesExists.mockResolvedValue(true);
+    mockGetMapping.mockResolvedValue({ idx: { mappings: { properties: { content: { type: 'text' } } } } });
+
+    await expect(elasticsearch.getVectorDimensions('idx')).resolves.toBeNull();
+  });
+});
+
+describe('getEmbeddingModel', () => {
+  let mockGet: Mock;
+  let mockIndex: Mock;
+  let mockDelete: Mock;
+
+  beforeEach(() => {
+    mockGet = vi.fn();
+    mockIndex = vi.fn();
+    mockDelete = vi.fn();
+    elasticsearch.setClient({ get: mockGet, index: mockIndex, delete: mockDelete } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should read the embedder and template from the settings index', async () => {
+    mockGet.mockResolvedValue({ _source: { embedder: 'http:small', embed_template: '{text}' } });
+
+    await expect(elasticsearch.getEmbeddingModel('idx')).resolves.toEqual({
+      embedder: 'http:small',
+      template: '{text}',
+    });
+    expect(mockGet).toHaveBeenCalledWith({ index: 'idx_settings', id: 'setting:embedding_model' });
+  });
+
+  it('should return null when no model was recorded', async () => {
+    mockGet.mockRejectedValue(Object.assign(new Error('not found'), { meta: { statusCode: 404 } }));
+
+    await expect(elasticsearch.getEmbeddingModel('idx')).resolves.toBeNull();
+  });
+
+  it('should write the model, and delete it when given null', async () => {
+    mockDelete.mockRejectedValue(Object.assign(new Error('not found'), { meta: { statusCode: 404 } }));
+
+    await elasticsearch.updateEmbeddingModel({ embedder: 'noop', template: '{body}' }, 'idx');
+    await elasticsearch.updateEmbeddingModel(null, 'idx');
+
+    expect(mockIndex).toHaveBeenCalledWith(
+      expect.objectContaining({
+        index: 'idx_settings',
+        id: 'setting:embedding_model',
+        document: expect.objectContaining({ embedder: 'noop', embed_template: '{body}' }),
+      })
+    );
+    expect(mockDelete).toHaveBeenCalledWith({ index: 'idx_settings', id: 'setting:embedding_model', refresh: true });
+  });
+});
+
+describe('getIndexStats', () => {
+  let mockSearch: Mock;
+  let mockIndicesExists: Mock;
+  let mockIndicesStats: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    mockIndicesExists = vi.fn();
+    mockIndicesStats = vi.fn();
+
+    elasticsearch.setClient({
+      search: mockSearch,
+      indices: {
+        exists: mockIndicesExists,
+        stats: mockIndicesStats,
+      },
+    } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should return zero stats when the index does not exist', async () => {
+    mockIndicesExists.mockResolvedValue(false);
+
+    await expect(elasticsearch.getIndexStats('idx')).resolves.toEqual({
+      files: 0,
+      chunks: 0,
+      languages: {},
+      kinds: {},
+      sizeBytes: 0,
+    });
+    expect(mockSearch).not.toHaveBeenCalled();
+  });
+
+  it('should count chunks, languages, kinds, files, and size', async () => {
+    mockIndicesExists.mockResolvedValue(true);
+    mockSearch
+      .mockResolvedValueOnce({
+        hits: { total: { value: 5, relation: 'eq' }, hits: [] },
+        aggregations: {
+          languages: { buckets: [{ key: 'typescript', doc_count: 4 }, { key: 'markdown', doc_count: 1 }] },
+          kinds: { buckets: [{ key: 'function_declaration', doc_count: 3 }] },
+        },
+      })
+      .mockResolvedValueOnce({ hits: { hits: [] }, aggregations: { files: { value: 2 } } });
+    mockIndicesStats.mockResolvedValue({ _all: { total: { store: { size_in_bytes: 2048 } } } });
+
+    await expect(elasticsearch.getIndexStats('idx')).resolves.toEqual({
+      files: 2,
+      chunks: 5,
+      languages: { typescript: 4, markdown: 1 },
+      kinds: { function_declaration: 3 },
+      sizeBytes: 2048,
+    });
+    expect(mockSearch).toHaveBeenLastCalledWith(expect.objectContaining({ index: 'idx_locations', size: 0 }));
+    expect(mockIndicesStats).toHaveBeenCalledWith({
+      index: ['idx', 'idx_locations', 'idx_settings'],
+      metric: 'store',
+    });
+  });
+});
+
+describe('searchByKeyword', () => {
+  let mockSearch: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    elasticsearch.setClient({ search: mockSearch } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should match content and boost exact symbol names', async () => {
+    mockSearch.mockResolvedValue({ hits: { hits: [{ _id: 'c1', _score: 7.5, _source: MOCK_CHUNK }] } });
+
+    const results = await elasticsearch.searchByKeyword('parse_queue()', 'idx', 5);
+
+    expect(results).toEqual([{ id: 'c1', score: 7.5, ...MOCK_CHUNK }]);
+    const request = mockSearch.mock.calls[0][0];
+    expect(request.size).toBe(5);
+    expect(request.query.bool.should).toEqual([
+      { match: { content: { query: 'parse_queue' } } },
+      {
+        nested: { path: 'symbols', query: { terms: { 'symbols.name': ['parse_queue'] } }, score_mode: 'max', boost: 2 },
+      },
+      { terms: { parentSymbol: ['parse_queue'], boost: 2 } },
+      { match: { symbolTokens: { query: 'parse queue', boost: 2 } } },
+    ]);
+  });
+
+  it('should not query Elasticsearch when the query has no terms', async () => {
+    await expect(elasticsearch.searchByKeyword('?!', 'idx', 5)).resolves.toEqual([]);
+    expect(mockSearch).not.toHaveBeenCalled();
+  });
+});
+
+describe('search filters', () => {
+  let mockSearch: Mock;
+  let mockExists: Mock;
+
+  beforeEach(() => {
+    mockSearch = vi.fn();
+    mockExists = vi.fn().mockResolvedValue(true);
+    elasticsearch.setClient({ search: mockSearch, indices: { exists: mockExists } } as unknown as Client);
+  });
+
+  afterEach(() => {
+    vi.clearAllMocks();
+    elasticsearch.setClient(undefined);
+  });
+
+  it('should pre-filter kNN search by language and kind', async () => {
+    mockSearch.mockResolvedValue({ hits: { hits: [] } });
+
+    await elasticsearch.searchByVector([0.1, 0.2], 'idx', 5, { language: 'go', kind: 'type' });
+
+    const request = mockSearch.mock.calls[0][0];
+    expect(request.knn.k).toBe(5);
+    expect(request.knn.filter).toEqual([
+      { term: { language: 'go' } },
+      { terms: { kind: expect.arrayContaining(['type_declaration', 'class_declaration']) } },
+    ]);
+  });
+
+  it('should post-filter paths against chunk locations', async () => {
+    mockSearch
+      .mockResolvedValueOnce({
+        hits: {
+          hits: [
+            { _id: 'outside', _score: 9, _source: MOCK_CHUNK },
+            { _id: 'inside', _score: 8, _source: MOCK_CHUNK },
+          ],
+        },
+      })
+      .mockResolvedValueOnce({
+        aggregations: {
+          by_chunk: {
+            buckets: [
+              {
+                key: 'outside',
+                locations: { hits: { hits: [{ _source: { filePath: 'web/a.ts', startLine: 1, endLine: 2 } }] } },
+              },
+              {
+                key: 'inside',
+                locations: {
+                  hits: {
+                    hits: [
+                      { _source: { filePath: 'cmd/a.go', startLine: 1, endLine: 2 } },
+                      { _source: { filePath: 'internal/b.go', startLine: 5, endLine: 9, git_file_hash: 'h' } },
+                    ],
+                  },
+                },
+              },
+            ],
+          },
+        },
+      });
+
+    const results = await elasticsearch.searchByKeyword('serve', 'idx', 3, { path: 'internal/' });
+
+    expect(mockSearch.mock.calls[0][0].size).toBe(30);
+    expect(mockSearch.mock.calls[0][0].query.bool.filter).toBeUndefined();
+    expect(results).toHaveLength(1);
+    expect(results[0]).toMatchObject({
+      id: 'inside',
+      filePath: 'internal/b.go',
+      startLine: 5,
+      endLine: 9,
+      git_file_hash: 'h',
+    });
+  });
+});
+
 describe('Elasticsearch Client Configuration', () => {
   describe('WHEN examining the client configuration', () => {
     it('SHOULD have a client instance', () => {
@@ -0,0 +1,51 @@
+import { describe, it, expect } from 'vitest';
+
+import { CodeChunk } from '../../src/utils/elasticsearch';
+import { DEFAULT_EMBED_TEMPLATE, parseEmbedTemplate } from '../../src/utils/embed_template';
+
+const CHUNK: CodeChunk = {
+  type: 'code',
+  language: 'go',
+  kind: 'method_declaration',
+  containerPath: 'Queue',
+  symbols: [{ name: 'Push', kind: 'method.name', line: 3 }],
+  filePath: 'internal/queue.go',
+  git_file_hash: 'hash',
+  git_branch: 'main',
+  chunk_hash: 'chunk',
+  startLine: 3,
+  endLine: 5,
+  content: 'func (q *Queue) Push(item string) {\n\tq.items = append(q.items, item)\n}',
+  semantic_text: 'language: go\nkind: method_declaration\n\nfunc (q *Queue) Push(item string) {}',
+  created_at: '2026-01-01T00:00:00.000Z',
+  updated_at: '2026-01-01T00:00:00.000Z',
+};
+
+describe('parseEmbedTemplate', () => {
+  it('SHOULD replace the named fields with the values of the chunk', () => {
+    const render = parseEmbedTemplate('{lang} {kind} {container}.{symbol}\n{body}');
+
+    expect(render(CHUNK)).toBe(
+      'go method_declaration Queue.Push\n' +
+        'func (q *Queue) Push(item string) {\n\tq.items = append(q.items, item)\n}'
+    );
+  });
+
+  it('SHOULD embed the semantic text by default', () => {
+    expect(parseEmbedTemplate(DEFAULT_EMBED_TEMPLATE)(CHUNK)).toBe(CHUNK.semantic_text);
+  });
+
+  it('SHOULD render missing fields as empty strings', () => {
+    const render = parseEmbedTemplate('[{symbol}] {body}');
+
+    expect(render({ ...CHUNK, symbols: [], content: 'import "fmt"' })).toBe('[] import "fmt"');
+  });
+
+  it('SHOULD reject unknown fields and templates without fields', () => {
+    expect(() => parseEmbedTemplate('{lang} {sybmol}\n{body}')).toThrow(
+      'Unknown field "{sybmol}" in embed template "{lang} {sybmol}\n{body}". ' +
+        'Supported fields: {lang}, {kind}, {symbol}, {container}, {body}, {text}.'
+    );
+    expect(() => parseEmbedTemplate('code')).toThrow(/references no field/);
+  });
+});
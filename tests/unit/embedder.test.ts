@@ -0,0 +1,434 @@
+import { describe, it, expect, vi, afterEach } from 'vitest';
+import {
+  Embedder,
+  EmbedderError,
+  HttpEmbedder,
+  NoopEmbedder,
+  RateLimiter,
+  embedInBatches,
+  embedMissing,
+  getConfiguredEmbedder,
+  getEmbedder,
+  listEmbedders,
+  parseRetryAfterMs,
+  registerEmbedder,
+  validateEmbedderDimensions,
+} from '../../src/utils/embedder';
+import { withTestEnv } from './utils/test_env';
+
+class FixedEmbedder implements Embedder {
+  readonly name = 'fixed';
+
+  dimensions(): number {
+    return 3;
+  }
+
+  async embed(texts: string[]): Promise<number[][]> {
+    return texts.map(() => [1, 0, 0]);
+  }
+}
+
+describe('embedder registry', () => {
+  it('SHOULD register the noop embedder by default', () => {
+    expect(listEmbedders()).toContain('noop');
+    expect(getEmbedder('noop')).toBeInstanceOf(NoopEmbedder);
+  });
+
+  it('SHOULD resolve custom embedders case-insensitively', () => {
+    registerEmbedder('Fixed', () => new FixedEmbedder());
+
+    const embedder = getEmbedder('FIXED');
+    expect(embedder.name).toBe('fixed');
+    expect(embedder.dimensions()).toBe(3);
+  });
+
+  it('SHOULD throw a helpful error for unknown embedders', () => {
+    expect(() => getEmbedder('does-not-exist')).toThrow(/Unknown embedder "does-not-exist".*noop/);
+  });
+
+  it('SHOULD reject empty names', () => {
+    expect(() => registerEmbedder('  ', () => new FixedEmbedder())).toThrow(/non-empty/);
+  });
+
+  it('SHOULD return undefined when SCS_IDXR_EMBEDDER is not set', () =>
+    withTestEnv({ SCS_IDXR_EMBEDDER: undefined }, () => {
+      expect(getConfiguredEmbedder()).toBeUndefined();
+    }));
+
+  it('SHOULD create the embedder named by SCS_IDXR_EMBEDDER', () =>
+    withTestEnv({ SCS_IDXR_EMBEDDER: 'noop' }, () => {
+      expect(getConfiguredEmbedder()?.name).toBe('noop');
+    }));
+});
+
+describe('NoopEmbedder', () => {
+  it('SHOULD return deterministic unit vectors of the configured size', async () => {
+    const embedder = new NoopEmbedder(16);
+
+    const [first, second, other] = await embedder.embed(['hello', 'hello', 'world']);
+
+    expect(first).toHaveLength(16);
+    expect(first).toEqual(second);
+    expect(first).not.toEqual(other);
+    const norm = Math.sqrt(first.reduce((sum, v) => sum + v * v, 0));
+    expect(norm).toBeCloseTo(1, 6);
+  });
+
+  it('SHOULD default to 768 dimensions', () => {
+    expect(new NoopEmbedder().dimensions()).toBe(768);
+  });
+
+  it('SHOULD reject invalid dimensions', () => {
+    expect(() => new NoopEmbedder(0)).toThrow(/positive integer/);
+  });
+
+  it('SHOULD honor an aborted signal', async () => {
+    const controller = new AbortController();
+    controller.abort();
+
+    await expect(new NoopEmbedder(4).embed(['a'], controller.signal)).rejects.toThrow();
+  });
+});
+
+describe('validateEmbedderDimensions', () => {
+  it('SHOULD pass when dimensions match', () => {
+    expect(() => validateEmbedderDimensions(new NoopEmbedder(768), 768, 'idx')).not.toThrow();
+  });
+
+  it('SHOULD pass when the index has no vector field', () => {
+    expect(() => validateEmbedderDimensions(new NoopEmbedder(8), null, 'idx')).not.toThrow();
+  });
+
+  it('SHOULD fail fast with a clear error on mismatch', () => {
+    expect(() => validateEmbedderDimensions(new NoopEmbedder(384), 768, 'idx')).toThrow(
+      'Embedder "noop" produces 384-dimensional vectors, but index "idx" stores 768-dimensional code_vector fields'
+    );
+  });
+});
+
+describe('embedInBatches', () => {
+  const texts = Array.from({ length: 5 }, (_, i) => `text-${i}`);
+
+  it('SHOULD split texts into batches of the configured size', async () => {
+    const embedder = new NoopEmbedder(4);
+    const embedSpy = vi.spyOn(embedder, 'embed');
+
+    const result = await embedInBatches(embedder, texts, { batchSize: 2, concurrency: 1 });
+
+    expect(embedSpy.mock.calls.map(([batch]) => batch)).toEqual([
+      ['text-0', 'text-1'],
+      ['text-2', 'text-3'],
+      ['text-4'],
+    ]);
+    expect(result.failed).toEqual([]);
+    expect(result.vectors.size).toBe(5);
+    const expected = await new NoopEmbedder(4).embed(['text-3']);
+    expect(result.vectors.get(3)).toEqual(expected[0]);
+  });
+
+  it('SHOULD not start batches once the signal is aborted', async () => {
+    const embedder = new NoopEmbedder(4);
+    const controller = new AbortController();
+    const embedSpy = vi.spyOn(embedder, 'embed').mockImplementation(async (batch) => {
+      controller.abort();
+      return batch.map(() => [1, 0, 0, 0]);
+    });
+
+    const result = await embedInBatches(embedder, texts, {
+      batchSize: 2,
+      concurrency: 1,
+      signal: controller.signal,
+    });
+
+    expect(embedSpy).toHaveBeenCalledTimes(1);
+    expect(result.vectors.size).toBe(2);
+    expect(result.failed.map((f) => f.inputIndex)).toEqual([2, 3, 4]);
+  });
+
+  it('SHOULD not exceed the configured concurrency', async () => {
+    const embedder = new NoopEmbedder(4);
+    let inFlight = 0;
+    let maxInFlight = 0;
+    vi.spyOn(embedder, 'embed').mockImplementation(async (batch) => {
+      inFlight++;
+      maxInFlight = Math.max(maxInFlight, inFlight);
+      await new Promise((resolve) => setTimeout(resolve, 5));
+      inFlight--;
+      return batch.map(() => [1, 0, 0, 0]);
+    });
+
+    await embedInBatches(embedder, texts, { batchSize: 1, concurrency: 2 });
+
+    expect(maxInFlight).toBe(2);
+  });
+
+  it('SHOULD retry a failing batch and succeed', async () => {
+    const embedder = new NoopEmbedder(4);
+    const embedSpy = vi.spyOn(embedder, 'embed').mockRejectedValueOnce(new Error('temporary'));
+
+    const result = await embedInBatches(embedder, texts, { batchSize: 5, maxRetries: 2, retryBaseDelayMs: 0 });
+
+    expect(embedSpy).toHaveBeenCalledTimes(2);
+    expect(result.failed).toEqual([]);
+    expect(result.vectors.size).toBe(5);
+  });
+
+  it('SHOULD record failed inputs after max retries and continue with other batches', async () => {
+    const embedder = new NoopEmbedder(4);
+    const realEmbed = embedder.embed.bind(embedder);
+    const embedSpy = vi.spyOn(embedder, 'embed').mockImplementation(async (batch) => {
+      if (batch.includes('text-2')) {
+        throw new Error('boom');
+      }
+      return realEmbed(batch);
+    });
+
+    const result = await embedInBatches(embedder, texts, { batchSize: 2, maxRetries: 2, retryBaseDelayMs: 0 });
+
+    // 1 + 2 retries for the failing batch, one call each for the other two.
+    expect(embedSpy).toHaveBeenCalledTimes(5);
+    expect(result.failed).toEqual([
+      { inputIndex: 2, error: 'boom' },
+      { inputIndex: 3, error: 'boom' },
+    ]);
+    expect(Array.from(result.vectors.keys()).sort()).toEqual([0, 1, 4]);
+  });
+
+  it('SHOULD not retry an EmbedderError, whose embedder already applied its own retries', async () => {
+    const embedder = new NoopEmbedder(4);
+    const error = new EmbedderError('Embedding request failed (401): bad key', { status: 401, retriable: false });
+    const embedSpy = vi.spyOn(embedder, 'embed').mockRejectedValue(error);
+
+    const result = await embedInBatches(embedder, ['a'], { maxRetries: 2, retryBaseDelayMs: 0 });
+
+    expect(embedSpy).toHaveBeenCalledTimes(1);
+    expect(result.failed).toEqual([{ inputIndex: 0, error: 'Embedding request failed (401): bad key' }]);
+  });
+
+  it('SHOULD treat vectors with the wrong dimensions as a failure', async () => {
+    const embedder = new NoopEmbedder(4);
+    vi.spyOn(embedder, 'embed').mockResolvedValue([[1, 2]]);
+
+    const result = await embedInBatches(embedder, ['a'], { maxRetries: 0 });
+
+    expect(result.failed).toEqual([{ inputIndex: 0, error: 'returned a 2-dimensional vector, expected 4' }]);
+  });
+});
+
+describe('embedMissing', () => {
+  const texts = ['text-0', 'text-1', 'text-2'];
+
+  it('SHOULD only embed the texts without a known vector, keeping the input indexes', async () => {
+    const embedder = new NoopEmbedder(4);
+    const embedSpy = vi.spyOn(embedder, 'embed').mockImplementation(async (batch) => batch.map(() => [0, 1, 0, 0]));
+    const known = new Map([[1, [1, 0, 0, 0]]]);
+
+    const result = await embedMissing(embedder, texts, known, { batchSize: 10 });
+
+    expect(embedSpy.mock.calls.map(([batch]) => batch)).toEqual([['text-0', 'text-2']]);
+    expect(result).toEqual({
+      vectors: new Map([
+        [0, [0, 1, 0, 0]],
+        [1, [1, 0, 0, 0]],
+        [2, [0, 1, 0, 0]],
+      ]),
+      failed: [],
+      reused: 1,
+    });
+  });
+
+  it('SHOULD embed texts again WHEN their known vector has other dimensions', async () => {
+    const embedder = new NoopEmbedder(4);
+    const embedSpy = vi.spyOn(embedder, 'embed').mockRejectedValue(new EmbedderError('down', { retriable: false }));
+
+    const result = await embedMissing(embedder, texts, new Map([[2, [1, 0]]]), { batchSize: 10 });
+
+    expect(embedSpy.mock.calls.map(([batch]) => batch)).toEqual([texts]);
+    expect(result.reused).toBe(0);
+    expect(result.failed.map((f) => f.inputIndex)).toEqual([0, 1, 2]);
+  });
+});
+
+describe('HttpEmbedder', () => {
+  const embeddings = (...vectors: number[][]) =>
+    Response.json({ data: vectors.map((embedding, index) => ({ index, embedding })).reverse() });
+
+  afterEach(() => {
+    vi.useRealTimers();
+    vi.unstubAllGlobals();
+  });
+
+  it('SHOULD post the texts and map the embeddings back by index', async () => {
+    const fetchMock = vi.fn(async () => embeddings([1, 0], [0, 1]));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api/v1/', dimensions: 2, model: 'small', apiKey: 'secret' });
+
+    expect(await embedder.embed(['a', 'b'])).toEqual([
+      [1, 0],
+      [0, 1],
+    ]);
+    expect(embedder.name).toBe('http:small');
+    expect(fetchMock).toHaveBeenCalledWith(
+      'http://api/v1/embeddings',
+      expect.objectContaining({
+        method: 'POST',
+        headers: { 'content-type': 'application/json', authorization: 'Bearer secret' },
+        body: JSON.stringify({ model: 'small', input: ['a', 'b'] }),
+      })
+    );
+  });
+
+  it('SHOULD retry rate limiting and server errors, waiting as long as Retry-After asks', async () => {
+    vi.useFakeTimers();
+    const fetchMock = vi
+      .fn()
+      .mockResolvedValueOnce(new Response('slow down', { status: 429, headers: { 'retry-after': '2' } }))
+      .mockResolvedValueOnce(new Response('unavailable', { status: 503 }))
+      .mockResolvedValueOnce(embeddings([1, 0]));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxRetries: 2, retryBaseDelayMs: 0 });
+
+    const vectors = embedder.embed(['a']);
+    await vi.advanceTimersByTimeAsync(1999);
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+    await vi.advanceTimersByTimeAsync(1);
+
+    expect(await vectors).toEqual([[1, 0]]);
+    expect(fetchMock).toHaveBeenCalledTimes(3);
+  });
+
+  it('SHOULD fail at once on errors that retrying cannot fix', async () => {
+    const fetchMock = vi.fn(async () => new Response('invalid api key', { status: 401 }));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxRetries: 3, retryBaseDelayMs: 0 });
+
+    await expect(embedder.embed(['a'])).rejects.toMatchObject({
+      message: 'Embedding request failed (401): invalid api key',
+      status: 401,
+      retriable: false,
+    });
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+  });
+
+  it('SHOULD fail at once WHEN a successful response is not JSON', async () => {
+    const page = `<html>${'x'.repeat(300)}</html>`;
+    const fetchMock = vi.fn(async () => new Response(page, { status: 200 }));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxRetries: 3, retryBaseDelayMs: 0 });
+
+    await expect(embedder.embed(['a'])).rejects.toMatchObject({
+      name: 'EmbedderError',
+      message: `Embedder returned a response that is not JSON (200): ${page.slice(0, 200)}`,
+      status: 200,
+      retriable: false,
+    });
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+  });
+
+  it('SHOULD report batches that still fail after all retries', async () => {
+    const fetchMock = vi.fn(async () => new Response('bad gateway', { status: 502 }));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxRetries: 2, retryBaseDelayMs: 0 });
+
+    const result = await embedInBatches(embedder, ['a', 'b'], { batchSize: 2, maxRetries: 2 });
+
+    expect(fetchMock).toHaveBeenCalledTimes(3);
+    expect(result.failed).toEqual([
+      { inputIndex: 0, error: 'Embedding request failed (502): bad gateway (gave up after 3 attempts)' },
+      { inputIndex: 1, error: 'Embedding request failed (502): bad gateway (gave up after 3 attempts)' },
+    ]);
+  });
+
+  it('SHOULD retry requests that time out', async () => {
+    const fetchMock = vi
+      .fn()
+      .mockImplementationOnce(
+        (_url: string, init: RequestInit) =>
+          new Promise((_, reject) => init.signal?.addEventListener('abort', () => reject(init.signal?.reason)))
+      )
+      .mockResolvedValueOnce(embeddings([0, 1]));
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, timeoutMs: 5, retryBaseDelayMs: 0 });
+
+    expect(await embedder.embed(['a'])).toEqual([[0, 1]]);
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+  });
+
+  it('SHOULD split batches over maxBatchTokens into several requests, keeping the order', async () => {
+    const fetchMock = vi.fn(async (_url: string, init: RequestInit) => {
+      const { input } = JSON.parse(init.body as string) as { input: string[] };
+      return embeddings(...input.map((text) => [text.length, 0]));
+    });
+    vi.stubGlobal('fetch', fetchMock);
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxBatchTokens: 2 });
+
+    expect(await embedder.embed(['aaaa', 'bbbbbbbb', 'cc', 'd'])).toEqual([
+      [4, 0],
+      [8, 0],
+      [2, 0],
+      [1, 0],
+    ]);
+    expect(fetchMock.mock.calls.map(([, init]) => JSON.parse(init.body as string).input)).toEqual([
+      ['aaaa'],
+      ['bbbbbbbb'],
+      ['cc', 'd'],
+    ]);
+  });
+
+  it('SHOULD truncate inputs over maxInputTokens instead of failing the request', async () => {
+    const fetchMock = vi.fn(async () => embeddings([1, 0], [0, 1]));
+    vi.stubGlobal('fetch', fetchMock);
+    const countWords = (text: string) => text.split(/\s+/).filter(Boolean).length;
+    const embedder = new HttpEmbedder({ url: 'http://api', dimensions: 2, maxInputTokens: 2, countTokens: countWords });
+
+    expect(await embedder.embed(['one two three', 'four'])).toHaveLength(2);
+    expect(fetchMock).toHaveBeenCalledWith(
+      'http://api/embeddings',
+      expect.objectContaining({ body: JSON.stringify({ input: ['one two ', 'four'] }) })
+    );
+  });
+
+  it('SHOULD be created from the SCS_IDXR_EMBEDDER_* settings', () =>
+    withTestEnv(
+      { SCS_IDXR_EMBEDDER: 'http', SCS_IDXR_EMBEDDER_URL: 'http://api', SCS_IDXR_EMBEDDER_DIMENSIONS: '1536' },
+      () => {
+        expect(getConfiguredEmbedder()?.dimensions()).toBe(1536);
+        delete process.env.SCS_IDXR_EMBEDDER_DIMENSIONS;
+        expect(() => getConfiguredEmbedder()).toThrow(/needs SCS_IDXR_EMBEDDER_URL and SCS_IDXR_EMBEDDER_DIMENSIONS/);
+      }
+    ));
+});
+
+describe('RateLimiter', () => {
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  it('SHOULD space requests out to the configured rate', async () => {
+    vi.useFakeTimers();
+    const limiter = new RateLimiter(60);
+    const taken: number[] = [];
+    const start = Date.now();
+
+    const all = Promise.all([1, 2, 3].map(() => limiter.take().then(() => taken.push(Date.now() - start))));
+    await vi.advanceTimersByTimeAsync(2000);
+    await all;
+
+    expect(taken).toEqual([0, 1000, 2000]);
+  });
+
+  it('SHOULD reject rates that are not positive', () => {
+    expect(() => new RateLimiter(0)).toThrow(/positive number of requests per minute/);
+  });
+});
+
+describe('parseRetryAfterMs', () => {
+  it('SHOULD read seconds and HTTP dates', () => {
+    const now = Date.parse('2024-01-01T00:00:00Z');
+
+    expect(parseRetryAfterMs('3', now)).toBe(3000);
+    expect(parseRetryAfterMs('Mon, 01 Jan 2024 00:00:05 GMT', now)).toBe(5000);
+    expect(parseRetryAfterMs('soon', now)).toBeUndefined();
+    expect(parseRetryAfterMs(null, now)).toBeUndefined();
+  });
+});
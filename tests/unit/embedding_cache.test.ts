@@ -0,0 +1,143 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import {
+  CachedEmbedder,
+  EmbeddingCache,
+  getEmbeddingCacheKey,
+  normalizeEmbeddingText,
+} from '../../src/utils/embedding_cache';
+import { Embedder, NoopEmbedder } from '../../src/utils/embedder';
+
+class CountingEmbedder implements Embedder {
+  calls: string[][] = [];
+
+  constructor(
+    readonly name = 'counting',
+    private readonly dims = 2
+  ) {}
+
+  dimensions(): number {
+    return this.dims;
+  }
+
+  async embed(texts: string[]): Promise<number[][]> {
+    this.calls.push(texts);
+    return texts.map((text) => [text.length, this.calls.length, 0.5].slice(0, this.dims));
+  }
+}
+
+describe('embedding cache keys', () => {
+  it('SHOULD ignore line endings and trailing whitespace', () => {
+    expect(normalizeEmbeddingText('a  \r\nb\t\n\n')).toBe('a\nb');
+    expect(getEmbeddingCacheKey('m', 'a\r\nb')).toBe(getEmbeddingCacheKey('m', 'a\nb  '));
+  });
+
+  it('SHOULD include the model in the key', () => {
+    expect(getEmbeddingCacheKey('noop:768', 'a')).not.toBe(getEmbeddingCacheKey('other:768', 'a'));
+  });
+});
+
+describe('EmbeddingCache', () => {
+  let tmpDir: string;
+  let cache: EmbeddingCache;
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-embed-cache-'));
+    cache = new EmbeddingCache({ dbPath: path.join(tmpDir, 'nested', 'embeddings.db'), maxEntries: 2 });
+  });
+
+  afterEach(() => {
+    cache.close();
+    vi.useRealTimers();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD persist vectors across instances', () => {
+    cache.set(new Map([['k1', [0.5, -0.25]]]));
+    cache.close();
+
+    const reopened = new EmbeddingCache({ dbPath: path.join(tmpDir, 'nested', 'embeddings.db'), maxEntries: 2 });
+    expect(reopened.get(['k1', 'missing'])).toEqual(new Map([['k1', [0.5, -0.25]]]));
+    reopened.close();
+  });
+
+  it('SHOULD evict the least recently used entries beyond maxEntries', () => {
+    vi.useFakeTimers();
+    vi.setSystemTime(1000);
+    cache.set(new Map([['k1', [1]]]));
+    vi.setSystemTime(2000);
+    cache.set(new Map([['k2', [2]]]));
+    vi.setSystemTime(3000);
+    cache.get(['k1']);
+    vi.setSystemTime(4000);
+    cache.set(new Map([['k3', [3]]]));
+
+    expect(cache.size()).toBe(2);
+    expect(Array.from(cache.get(['k1', 'k2', 'k3']).keys())).toEqual(['k1', 'k3']);
+  });
+
+  it('SHOULD reject a non-positive max size', () => {
+    expect(() => new EmbeddingCache({ dbPath: path.join(tmpDir, 'e.db'), maxEntries: 0 })).toThrow(/positive integer/);
+  });
+});
+
+describe('CachedEmbedder', () => {
+  let tmpDir: string;
+  let cache: EmbeddingCache;
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-cached-embedder-'));
+    cache = new EmbeddingCache({ dbPath: path.join(tmpDir, 'embeddings.db'), maxEntries: 100 });
+  });
+
+  afterEach(() => {
+    cache.close();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD only send uncached texts to the wrapped embedder', async () => {
+    const inner = new CountingEmbedder();
+    const embedder = new CachedEmbedder(inner, cache);
+
+    const first = await embedder.embed(['aa', 'bbb']);
+    const second = await embedder.embed(['bbb', 'c', 'aa', 'c']);
+
+    expect(inner.calls).toEqual([['aa', 'bbb'], ['c']]);
+    expect(second).toEqual([first[1], [1, 2], first[0], [1, 2]]);
+    expect(embedder.getStats()).toEqual({ hits: 3, misses: 3 });
+  });
+
+  it('SHOULD skip the wrapped embedder entirely on a full cache hit', async () => {
+    const noop = new NoopEmbedder(4);
+    await new CachedEmbedder(noop, cache).embed(['const a = 1;']);
+    const spy = vi.spyOn(noop, 'embed');
+
+    const [vector] = await new CachedEmbedder(noop, cache).embed(['const a = 1;\r\n']);
+
+    expect(spy).not.toHaveBeenCalled();
+    const [expected] = await new NoopEmbedder(4).embed(['const a = 1;']);
+    vector.forEach((value, i) => expect(value).toBeCloseTo(expected[i], 6));
+  });
+
+  it('SHOULD not return vectors of another model', async () => {
+    await new CachedEmbedder(new CountingEmbedder('model-a'), cache).embed(['x']);
+    const other = new CountingEmbedder('model-b');
+
+    await new CachedEmbedder(other, cache).embed(['x']);
+    await new CachedEmbedder(new CountingEmbedder('model-a', 3), cache).embed(['x']);
+
+    expect(other.calls).toEqual([['x']]);
+    expect(cache.size()).toBe(3);
+  });
+
+  it('SHOULD not cache vectors of the wrong size', async () => {
+    const inner = new CountingEmbedder();
+    vi.spyOn(inner, 'embed').mockResolvedValue([[1, 2, 3]]);
+
+    await expect(new CachedEmbedder(inner, cache).embed(['x'])).rejects.toThrow(/3-dimensional vector, expected 2/);
+    expect(cache.size()).toBe(0);
+  });
+});
@@ -0,0 +1,71 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+import { ChunkStore } from '../../src/utils/chunk_store';
+import { detectFileChanges } from '../../src/utils/file_changes';
+import { FileHashCache } from '../../src/utils/file_hash_cache';
+import { gitBlobHash } from '../../src/utils/search';
+
+describe('detectFileChanges', () => {
+  let root: string;
+
+  const storeWith = (indexed: Record<string, string>) => {
+    const hashes = new Map(Object.entries(indexed).map(([file, hash]) => [file, new Set([hash])]));
+    return {
+      getIndexedFileHashes: vi.fn().mockResolvedValue(hashes),
+      deleteDocumentsByFilePaths: vi.fn().mockResolvedValue(undefined),
+    } as unknown as ChunkStore & { deleteDocumentsByFilePaths: ReturnType<typeof vi.fn> };
+  };
+
+  const detect = (store: ChunkStore, files: string[], force = false) =>
+    detectFileChanges(store, files, {
+      root,
+      branch: 'main',
+      workspace: 'web',
+      isInScope: (file) => file.startsWith('src/') && file.endsWith('.ts'),
+      hashCache: new FileHashCache(),
+      force,
+    });
+
+  beforeEach(() => {
+    root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-file-changes-'));
+    fs.mkdirSync(path.join(root, 'src'));
+    fs.writeFileSync(path.join(root, 'src/same.ts'), 'const same = 1;\n');
+    fs.writeFileSync(path.join(root, 'src/edited.ts'), 'const edited = 2;\n');
+    fs.writeFileSync(path.join(root, 'src/new.ts'), 'const added = 3;\n');
+  });
+
+  afterEach(() => {
+    fs.rmSync(root, { recursive: true, force: true });
+  });
+
+  it('SHOULD skip unchanged files and purge the indexed files in scope that were not found', async () => {
+    const store = storeWith({
+      'src/same.ts': gitBlobHash(Buffer.from('const same = 1;\n')),
+      'src/edited.ts': gitBlobHash(Buffer.from('const edited = 1;\n')),
+      'src/ignored.ts': 'deadbeef',
+      'src/notes.md': 'deadbeef',
+    });
+
+    const changes = await detect(store, ['src/same.ts', 'src/edited.ts', 'src/new.ts']);
+
+    expect(changes).toEqual({
+      files: ['src/edited.ts', 'src/new.ts'],
+      changedFiles: new Set(['src/edited.ts']),
+      unchangedFiles: 1,
+      deletedFiles: ['src/ignored.ts'],
+    });
+    expect(store.deleteDocumentsByFilePaths).toHaveBeenCalledWith(['src/ignored.ts'], { workspace: 'web' });
+  });
+
+  it('SHOULD return every file WHEN force is set', async () => {
+    const store = storeWith({ 'src/same.ts': gitBlobHash(Buffer.from('const same = 1;\n')) });
+
+    const changes = await detect(store, ['src/same.ts', 'src/new.ts'], true);
+
+    expect(changes.files).toEqual(['src/same.ts', 'src/new.ts']);
+    expect(changes.changedFiles).toEqual(new Set(['src/same.ts']));
+    expect(changes.unchangedFiles).toBe(0);
+  });
+});
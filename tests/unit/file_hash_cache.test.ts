@@ -0,0 +1,69 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+import { FileHashCache } from '../../src/utils/file_hash_cache';
+import { gitBlobHash } from '../../src/utils/search';
+
+describe('FileHashCache', () => {
+  let root: string;
+  let cachePath: string;
+
+  beforeEach(() => {
+    root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-file-hash-cache-'));
+    cachePath = path.join(root, '.queue', 'file_hashes.json');
+    fs.writeFileSync(path.join(root, 'a.ts'), 'const a = 1;\n');
+    fs.writeFileSync(path.join(root, 'b.ts'), 'const b = 2;\n');
+  });
+
+  afterEach(() => {
+    fs.rmSync(root, { recursive: true, force: true });
+  });
+
+  it('SHOULD return the git blob hash of each file and leave out missing files', () => {
+    const hashes = new FileHashCache().hashFiles(root, ['a.ts', 'b.ts', 'missing.ts']);
+
+    expect(hashes).toEqual(
+      new Map([
+        ['a.ts', gitBlobHash(Buffer.from('const a = 1;\n'))],
+        ['b.ts', gitBlobHash(Buffer.from('const b = 2;\n'))],
+      ])
+    );
+  });
+
+  it('SHOULD not hash a file again WHEN its size and mtime did not change', () => {
+    const cache = new FileHashCache();
+    const file = path.join(root, 'a.ts');
+    const original = cache.hashFiles(root, ['a.ts']).get('a.ts');
+    const { mtime } = fs.statSync(file);
+
+    // Same size and mtime: the cached hash is trusted, even though the bytes differ
+    fs.writeFileSync(file, 'const a = 9;\n');
+    fs.utimesSync(file, mtime, mtime);
+    expect(cache.hashFiles(root, ['a.ts']).get('a.ts')).toBe(original);
+
+    fs.utimesSync(file, mtime, new Date(mtime.getTime() + 1000));
+    expect(cache.hashFiles(root, ['a.ts']).get('a.ts')).toBe(gitBlobHash(Buffer.from('const a = 9;\n')));
+  });
+
+  it('SHOULD keep the entries of the files hashed since it was loaded across runs', () => {
+    const first = new FileHashCache(cachePath);
+    first.hashFiles(root, ['a.ts', 'b.ts']);
+    first.save();
+
+    const second = new FileHashCache(cachePath);
+    second.hashFiles(root, ['a.ts']);
+    second.save();
+
+    expect(Object.keys(JSON.parse(fs.readFileSync(cachePath, 'utf8')))).toEqual([path.join(root, 'a.ts')]);
+  });
+
+  it('SHOULD hash every file again WHEN the cache file is unreadable', () => {
+    fs.mkdirSync(path.dirname(cachePath));
+    fs.writeFileSync(cachePath, '{not json');
+
+    const hashes = new FileHashCache(cachePath).hashFiles(root, ['a.ts']);
+
+    expect(hashes.get('a.ts')).toBe(gitBlobHash(Buffer.from('const a = 1;\n')));
+  });
+});
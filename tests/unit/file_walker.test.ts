@@ -0,0 +1,97 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+
+import { createFileFilter, walkFiles } from '../../src/utils/file_walker';
+import { IndexingCancelledError } from '../../src/utils/cancellation';
+
+function writeFile(root: string, relativePath: string, content = ''): void {
+  const fullPath = path.join(root, relativePath);
+  fs.mkdirSync(path.dirname(fullPath), { recursive: true });
+  fs.writeFileSync(fullPath, content);
+}
+
+describe('file walker', () => {
+  let root: string;
+
+  beforeEach(() => {
+    root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-walker-'));
+    writeFile(root, '.gitignore', 'node_modules/\nvendor/\n*.log\n!important.log\n');
+    writeFile(root, 'src/index.ts');
+    writeFile(root, 'src/debug.log');
+    writeFile(root, 'important.log');
+    writeFile(root, 'node_modules/pkg/index.ts');
+    writeFile(root, 'vendor/lib/index.ts');
+    writeFile(root, 'src/generated/.gitignore', '*.gen.ts\n');
+    writeFile(root, 'src/generated/api.gen.ts');
+    writeFile(root, 'src/generated/api.ts');
+    writeFile(root, 'src/generated/notes.log');
+    writeFile(root, '.git/hooks/pre-commit.ts');
+  });
+
+  afterEach(() => {
+    fs.rmSync(root, { recursive: true, force: true });
+  });
+
+  const pattern = '**/*.{ts,log}';
+
+  it('SHOULD honor root and nested .gitignore files, including negations', async () => {
+    const files = await walkFiles(root, pattern, createFileFilter(root));
+
+    expect(files).toEqual(['important.log', 'src/generated/api.ts', 'src/index.ts']);
+  });
+
+  it('SHOULD stop with IndexingCancelledError once the signal is aborted', async () => {
+    const controller = new AbortController();
+    controller.abort();
+
+    await expect(walkFiles(root, pattern, createFileFilter(root), controller.signal)).rejects.toBeInstanceOf(
+      IndexingCancelledError
+    );
+  });
+
+  it('SHOULD not re-include files inside an ignored directory', async () => {
+    writeFile(root, 'node_modules/.gitignore', '!*.ts\n');
+
+    const files = await walkFiles(root, pattern, createFileFilter(root));
+
+    expect(files).not.toContain('node_modules/pkg/index.ts');
+  });
+
+  it('SHOULD index ignored files with gitignore disabled, but never .git', async () => {
+    const files = await walkFiles(root, pattern, createFileFilter(root, { gitignore: false }));
+
+    expect(files).toContain('node_modules/pkg/index.ts');
+    expect(files).toContain('src/generated/api.gen.ts');
+    expect(files).toContain('src/debug.log');
+    expect(files).not.toContain('.git/hooks/pre-commit.ts');
+  });
+
+  it('SHOULD apply include and exclude patterns on top of .gitignore', async () => {
+    const filter = createFileFilter(root, { include: ['src/**'], exclude: ['generated/'] });
+
+    const files = await walkFiles(root, pattern, filter);
+
+    expect(files).toEqual(['src/index.ts']);
+  });
+
+  it('SHOULD not loop forever on symlinked directories', async () => {
+    fs.symlinkSync(root, path.join(root, 'src', 'loop'), 'dir');
+    fs.symlinkSync(path.join(root, 'src'), path.join(root, 'src', 'generated', 'back'), 'dir');
+
+    const files = await walkFiles(root, pattern, createFileFilter(root));
+
+    expect(files).toContain('src/index.ts');
+    expect(new Set(files).size).toBe(files.length);
+  });
+
+  it('SHOULD tell the walker to skip ignored directories', () => {
+    const filter = createFileFilter(root, { exclude: ['docs/'] });
+
+    expect(filter.skipsDirectory('node_modules')).toBe(true);
+    expect(filter.skipsDirectory('docs')).toBe(true);
+    expect(filter.skipsDirectory('.git')).toBe(true);
+    expect(filter.skipsDirectory('src')).toBe(false);
+  });
+});
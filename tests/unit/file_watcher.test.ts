@@ -0,0 +1,184 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { EventEmitter } from 'events';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { createFileFilter } from '../../src/utils/file_walker';
+import { FileChanges, FileChangeWatcher, WatchFunction } from '../../src/utils/file_watcher';
+import { logger } from '../../src/utils/logger';
+
+type Listener = (eventType: string, filename: string | null) => void;
+
+class FakeWatcher extends EventEmitter {
+  closed = false;
+
+  close(): void {
+    this.closed = true;
+  }
+}
+
+function writeFile(root: string, relativePath: string, content = ''): void {
+  const fullPath = path.join(root, relativePath);
+  fs.mkdirSync(path.dirname(fullPath), { recursive: true });
+  fs.writeFileSync(fullPath, content);
+}
+
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+describe('FileChangeWatcher', () => {
+  let root: string;
+  let watchers: FakeWatcher[];
+  let listener: Listener;
+  let batches: FileChanges[];
+  let watcher: FileChangeWatcher;
+
+  const fakeWatch = ((_root: string, onEvent: Listener) => {
+    const fake = new FakeWatcher();
+    watchers.push(fake);
+    listener = onEvent;
+    return fake;
+  }) as unknown as WatchFunction;
+
+  const createWatcher = (knownFiles: string[] = []) =>
+    new FileChangeWatcher({
+      root,
+      filter: createFileFilter(root),
+      isLanguageFile: (relativePath) => relativePath.endsWith('.ts'),
+      knownFiles,
+      debounceMs: 20,
+      retryDelayMs: 10,
+      watch: fakeWatch,
+      onChanges: async (changes) => {
+        batches.push(changes);
+      },
+    });
+
+  beforeEach(() => {
+    root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-watcher-'));
+    watchers = [];
+    batches = [];
+    writeFile(root, '.gitignore', 'dist/\n');
+    writeFile(root, 'src/a.ts');
+    writeFile(root, 'src/b.ts');
+  });
+
+  afterEach(async () => {
+    await watcher?.close();
+    fs.rmSync(root, { recursive: true, force: true });
+  });
+
+  it('SHOULD coalesce a burst of events into one batch after the debounce', async () => {
+    watcher = createWatcher(['src/a.ts', 'src/b.ts']);
+    watcher.start();
+
+    listener('change', 'src/a.ts');
+    await sleep(5);
+    listener('change', 'src/b.ts');
+    listener('change', 'src/a.ts');
+    expect(batches).toHaveLength(0);
+
+    await sleep(60);
+
+    expect(batches).toEqual([{ changed: ['src/a.ts', 'src/b.ts'], deleted: [] }]);
+  });
+
+  it('SHOULD report an atomic save as a single change of the original file', async () => {
+    watcher = createWatcher(['src/a.ts']);
+    watcher.start();
+
+    writeFile(root, 'src/a.ts.swp', 'new content');
+    listener('rename', 'src/a.ts.swp');
+    fs.renameSync(path.join(root, 'src/a.ts.swp'), path.join(root, 'src/a.ts'));
+    listener('rename', 'src/a.ts.swp');
+    listener('rename', 'src/a.ts');
+    await watcher.flush();
+
+    expect(batches).toEqual([{ changed: ['src/a.ts'], deleted: [] }]);
+  });
+
+  it('SHOULD report created and deleted files and skip ignored ones', async () => {
+    watcher = createWatcher(['src/a.ts', 'src/b.ts']);
+    watcher.start();
+
+    writeFile(root, 'src/c.ts');
+    writeFile(root, 'dist/c.ts');
+    fs.rmSync(path.join(root, 'src/b.ts'));
+    listener('rename', 'src/c.ts');
+    listener('rename', 'dist/c.ts');
+    listener('rename', 'src/b.ts');
+    await watcher.flush();
+
+    expect(batches).toEqual([{ changed: ['src/c.ts'], deleted: ['src/b.ts'] }]);
+  });
+
+  it('SHOULD delete every known file below a removed directory', async () => {
+    writeFile(root, 'lib/nested/d.ts');
+    watcher = createWatcher(['src/a.ts', 'src/b.ts', 'lib/nested/d.ts']);
+    watcher.start();
+
+    fs.rmSync(path.join(root, 'src'), { recursive: true });
+    listener('rename', 'src');
+    await watcher.flush();
+
+    expect(batches).toEqual([{ changed: [], deleted: ['src/a.ts', 'src/b.ts'] }]);
+  });
+
+  it('SHOULD index the files of a directory moved into the repository', async () => {
+    watcher = createWatcher();
+    watcher.start();
+
+    writeFile(root, 'moved/x.ts');
+    writeFile(root, 'moved/deep/y.ts');
+    writeFile(root, 'moved/readme.md');
+    listener('rename', 'moved');
+    await watcher.flush();
+
+    expect(batches).toEqual([{ changed: ['moved/deep/y.ts', 'moved/x.ts'], deleted: [] }]);
+  });
+
+  it('SHOULD re-establish the watch after a watcher error', async () => {
+    const errorSpy = vi.spyOn(logger, 'error').mockImplementation(() => {});
+    watcher = createWatcher(['src/a.ts']);
+    watcher.start();
+
+    watchers[0].emit('error', new Error('EMFILE: too many open files'));
+    expect(watchers[0].closed).toBe(true);
+    await sleep(30);
+
+    expect(watchers).toHaveLength(2);
+    listener('change', 'src/a.ts');
+    await watcher.flush();
+    expect(batches).toEqual([{ changed: ['src/a.ts'], deleted: [] }]);
+    expect(errorSpy).toHaveBeenCalledWith(expect.stringContaining('re-establishing the watch'), expect.any(Object));
+    errorSpy.mockRestore();
+  });
+
+  it('SHOULD keep watching when re-indexing a batch fails', async () => {
+    const errorSpy = vi.spyOn(logger, 'error').mockImplementation(() => {});
+    let calls = 0;
+    watcher = new FileChangeWatcher({
+      root,
+      filter: createFileFilter(root),
+      isLanguageFile: (relativePath) => relativePath.endsWith('.ts'),
+      debounceMs: 20,
+      watch: fakeWatch,
+      onChanges: async () => {
+        calls++;
+        throw new Error('store unavailable');
+      },
+    });
+    watcher.start();
+
+    listener('change', 'src/a.ts');
+    await watcher.flush();
+    listener('change', 'src/b.ts');
+    await watcher.flush();
+
+    expect(calls).toBe(2);
+    expect(errorSpy).toHaveBeenCalledTimes(2);
+    errorSpy.mockRestore();
+  });
+});
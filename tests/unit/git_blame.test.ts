@@ -0,0 +1,58 @@
+import { describe, it, expect } from 'vitest';
+
+import { FileBlame } from '../../src/utils/git_blame';
+
+const OLD = '1'.repeat(40);
+const NEW = '2'.repeat(40);
+const UNCOMMITTED = '0'.repeat(40);
+
+// `git blame --porcelain` output for a four-line file; details follow only the first line of a commit
+const PORCELAIN = [
+  `${OLD} 1 1 2`,
+  'author Ada Lovelace',
+  'author-mail <ada@example.com>',
+  'author-time 1700000000',
+  'author-tz +0000',
+  'summary Add parser',
+  'filename src/a.ts',
+  '\tfunction parse() {',
+  `${OLD} 2 2`,
+  '\t  return 1;',
+  `${NEW} 3 3 1`,
+  'author Grace Hopper',
+  'author-time 1710000000',
+  'summary Fix parser',
+  'filename src/a.ts',
+  '\t}',
+  `${UNCOMMITTED} 4 4 1`,
+  'author Not Committed Yet',
+  'author-time 1720000000',
+  'filename src/a.ts',
+  '\t// TODO',
+  '',
+].join('\n');
+
+describe('FileBlame', () => {
+  const blame = FileBlame.parse(PORCELAIN);
+
+  it('SHOULD attribute lines without commit details to the commit printed earlier', () => {
+    expect(blame.getLastCommit(2, 2)).toEqual({
+      commit: OLD,
+      author: 'Ada Lovelace',
+      date: '2023-11-14T22:13:20.000Z',
+    });
+  });
+
+  it('SHOULD pick the most recent commit of the line range', () => {
+    expect(blame.getLastCommit(1, 4)).toEqual({
+      commit: NEW,
+      author: 'Grace Hopper',
+      date: '2024-03-09T16:00:00.000Z',
+    });
+  });
+
+  it('SHOULD return undefined when no line of the range is committed', () => {
+    expect(blame.getLastCommit(4, 4)).toBeUndefined();
+    expect(blame.getLastCommit(10, 12)).toBeUndefined();
+  });
+});
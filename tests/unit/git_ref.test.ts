@@ -0,0 +1,77 @@
+import { execFileSync } from 'child_process';
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+import { checkoutRef, isBareRepository, resolveRef } from '../../src/utils/git_ref';
+
+function git(cwd: string, ...args: string[]): string {
+  return execFileSync('git', args, { cwd }).toString().trim();
+}
+
+describe('git_ref', () => {
+  let tmpDir: string;
+  let repoPath: string;
+  let v1: string;
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-git-ref-'));
+    repoPath = path.join(tmpDir, 'repo');
+    fs.mkdirSync(repoPath);
+    git(repoPath, 'init', '-q');
+    git(repoPath, 'config', 'user.email', 'test@example.com');
+    git(repoPath, 'config', 'user.name', 'Test');
+    fs.writeFileSync(path.join(repoPath, 'main.ts'), 'export const version = 1;\n');
+    git(repoPath, 'add', '.');
+    git(repoPath, 'commit', '-qm', 'v1');
+    git(repoPath, 'tag', 'v1');
+    v1 = git(repoPath, 'rev-parse', 'HEAD');
+    fs.writeFileSync(path.join(repoPath, 'main.ts'), 'export const version = 2;\n');
+    git(repoPath, 'commit', '-qam', 'v2');
+  });
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD resolve tags and SHAs to the commit SHA', () => {
+    expect(resolveRef(repoPath, 'v1')).toBe(v1);
+    expect(resolveRef(repoPath, v1.slice(0, 8))).toBe(v1);
+  });
+
+  it('SHOULD reject refs that do not exist, look like options, or repositories that are not git', () => {
+    expect(() => resolveRef(repoPath, 'v9')).toThrow('Git ref "v9" does not name a commit');
+    expect(() => resolveRef(repoPath, '--all')).toThrow('Invalid git ref: "--all".');
+    expect(() => resolveRef(tmpDir, 'v1')).toThrow('is not a git repository');
+  });
+
+  it('SHOULD check out the ref in a temporary worktree without touching the working tree', () => {
+    const checkout = checkoutRef(repoPath, 'v1');
+    try {
+      expect(checkout.commit).toBe(v1);
+      expect(fs.readFileSync(path.join(checkout.path, 'main.ts'), 'utf8')).toBe('export const version = 1;\n');
+      expect(fs.readFileSync(path.join(repoPath, 'main.ts'), 'utf8')).toBe('export const version = 2;\n');
+      expect(git(repoPath, 'status', '--porcelain')).toBe('');
+    } finally {
+      checkout.remove();
+    }
+
+    expect(fs.existsSync(checkout.path)).toBe(false);
+    expect(git(repoPath, 'worktree', 'list')).not.toContain(checkout.path);
+    expect(() => checkout.remove()).not.toThrow();
+  });
+
+  it('SHOULD check out refs of bare repositories', () => {
+    const barePath = path.join(tmpDir, 'bare.git');
+    execFileSync('git', ['clone', '-q', '--bare', repoPath, barePath]);
+
+    expect(isBareRepository(barePath)).toBe(true);
+    expect(isBareRepository(repoPath)).toBe(false);
+    const checkout = checkoutRef(barePath, 'v1');
+    try {
+      expect(fs.readFileSync(path.join(checkout.path, 'main.ts'), 'utf8')).toBe('export const version = 1;\n');
+    } finally {
+      checkout.remove();
+    }
+  });
+});
@@ -0,0 +1,38 @@
+import { describe, it, expect } from 'vitest';
+
+import { highlightSnippet } from '../../src/utils/highlight';
+
+const highlighted = (snippet: string, query: string, symbol: string | null = null) =>
+  highlightSnippet(snippet, query, symbol, 1).map(({ start, end }) => snippet.slice(start, end));
+
+describe('highlightSnippet', () => {
+  it('SHOULD highlight identifiers equal to a query term, ignoring case', () => {
+    expect(highlighted('const queue = new Queue();\nqueue.push(1);', 'QUEUE')).toEqual(['queue', 'Queue', 'queue']);
+  });
+
+  it('SHOULD highlight the words of compound identifiers and join adjacent ones', () => {
+    expect(highlighted('function parseQueue(raw_queue) {}', 'parse queue')).toEqual(['parseQueue', 'queue']);
+    expect(highlighted('int parse_json_config;', 'ParseJSON')).toEqual(['parse', 'json']);
+  });
+
+  it('SHOULD report the file line and offsets of each span', () => {
+    const snippet = 'func main() {\n\tstart(server)\n}';
+
+    expect(highlightSnippet(snippet, 'start the server', null, 20)).toEqual([
+      { start: 15, end: 20, line: 21 },
+      { start: 21, end: 27, line: 21 },
+    ]);
+    expect(highlightSnippet(snippet, 'server', null, null)).toEqual([{ start: 21, end: 27, line: null }]);
+  });
+
+  it('SHOULD fall back to the signature line of the symbol WHEN no term matches', () => {
+    const snippet = '// Reads the configuration.\n  export function loadSettings(path) {\n    return read(path);\n  }';
+
+    expect(highlighted(snippet, 'how are options read from disk', 'loadSettings')).toEqual(['read']);
+    expect(highlighted(snippet, 'config loader', 'loadSettings')).toEqual([
+      'export function loadSettings(path) {',
+    ]);
+    expect(highlightSnippet(snippet, 'loader', 'loadSettings', 7)).toEqual([{ start: 30, end: 66, line: 8 }]);
+    expect(highlighted('\nfoo();', 'bar', null)).toEqual(['foo();']);
+  });
+});
@@ -0,0 +1,113 @@
+import { describe, it, expect } from 'vitest';
+
+import {
+  RRF_K,
+  expandQueryIdentifiers,
+  extractKeywordTerms,
+  fuseResults,
+  getSymbolTokens,
+  splitIdentifier,
+} from '../../src/utils/hybrid_search';
+import { makeResult } from './utils/fixtures';
+
+describe('extractKeywordTerms', () => {
+  it('SHOULD keep identifiers whole and drop punctuation', () => {
+    expect(extractKeywordTerms('where is parse_queue() / $scope"?')).toEqual(['where', 'is', 'parse_queue', '$scope']);
+  });
+
+  it('SHOULD drop duplicate terms', () => {
+    expect(extractKeywordTerms('retry retry')).toEqual(['retry']);
+  });
+});
+
+describe('splitIdentifier', () => {
+  it('SHOULD split camelCase, PascalCase, snake_case, and acronyms into lowercase words', () => {
+    expect(splitIdentifier('ParseJSONConfig')).toEqual(['parse', 'json', 'config']);
+    expect(splitIdentifier('parseJsonConfig')).toEqual(['parse', 'json', 'config']);
+    expect(splitIdentifier('parse_json_config')).toEqual(['parse', 'json', 'config']);
+    expect(splitIdentifier('HTTPServer2')).toEqual(['http', 'server', '2']);
+    expect(splitIdentifier('$scope')).toEqual(['scope']);
+  });
+});
+
+describe('getSymbolTokens', () => {
+  it('SHOULD collect the distinct words of the symbol names and the parent symbol', () => {
+    const tokens = getSymbolTokens({
+      symbols: [
+        { name: 'ParseJSONConfig', kind: 'function.name', line: 1 },
+        { name: 'readConfig', kind: 'function.call', line: 2 },
+      ],
+      parentSymbol: 'load_config_file',
+    });
+
+    expect(tokens).toEqual(['parse', 'json', 'config', 'read', 'load', 'file']);
+  });
+});
+
+describe('expandQueryIdentifiers', () => {
+  it('SHOULD append the words of compound identifiers only', () => {
+    expect(expandQueryIdentifiers('where is ParseJSONConfig')).toBe('where is ParseJSONConfig (parse json config)');
+    expect(expandQueryIdentifiers('parse json config')).toBe('parse json config');
+  });
+});
+
+describe('fuseResults', () => {
+  const semantic = [
+    makeResult({ id: 'a', score: 0.91 }),
+    makeResult({ id: 'b', score: 0.9 }),
+    makeResult({ id: 'c', score: 0.2 }),
+  ];
+  const keyword = [makeResult({ id: 'c', score: 14.2 }), makeResult({ id: 'd', score: 3.1 })];
+
+  it('SHOULD use reciprocal rank fusion by default and ignore raw score scales', () => {
+    const fused = fuseResults(semantic, keyword);
+
+    expect(fused.map(({ result }) => result.id)).toEqual(['c', 'a', 'b', 'd']);
+    expect(fused[0].result.score).toBeCloseTo(0.5 / (RRF_K + 3) + 0.5 / (RRF_K + 1), 10);
+  });
+
+  it('SHOULD report which signals contributed to each result', () => {
+    const fused = fuseResults(semantic, keyword);
+
+    const signalsById = Object.fromEntries(fused.map(({ result, signals }) => [result.id, signals]));
+
+    expect(signalsById).toEqual({
+      a: ['semantic'],
+      b: ['semantic'],
+      c: ['semantic', 'keyword'],
+      d: ['keyword'],
+    });
+  });
+
+  it('SHOULD break each fused score down into the contributions of its signals', () => {
+    const [c] = fuseResults(semantic, keyword, { alpha: 0.7 });
+
+    expect(c.contributions).toEqual([
+      { signal: 'semantic', rawScore: 0.2, rank: 3, weight: 0.7, contribution: 0.7 / (RRF_K + 3) },
+      {
+        signal: 'keyword',
+        rawScore: 14.2,
+        rank: 1,
+        weight: expect.closeTo(0.3, 10),
+        contribution: expect.closeTo(0.3 / (RRF_K + 1), 10),
+      },
+    ]);
+    expect(c.contributions[0].contribution + c.contributions[1].contribution).toBe(c.result.score);
+  });
+
+  it('SHOULD follow a single signal when alpha is 0 or 1', () => {
+    expect(fuseResults(semantic, keyword, { alpha: 1 }).map(({ result }) => result.id)).toEqual(['a', 'b', 'c', 'd']);
+    expect(fuseResults(semantic, keyword, { alpha: 0 }).map(({ result }) => result.id)).toEqual(['c', 'd', 'a', 'b']);
+  });
+
+  it('SHOULD min-max normalize scores with linear fusion', () => {
+    const fused = fuseResults(semantic, keyword, { method: 'linear', alpha: 0.5 });
+
+    expect(fused.map(({ result }) => [result.id, Number(result.score.toFixed(4))])).toEqual([
+      ['a', 0.5],
+      ['c', 0.5],
+      ['b', 0.493],
+      ['d', 0],
+    ]);
+  });
+});
@@ -119,13 +119,21 @@ describe('incrementalIndex', () => {
 
     await incrementalIndex('/test/repo', { queueDir: '.test-queue', elasticsearchIndex: 'test-index' });
 
-    // Deletes are batched: old rename path, modified file, and deleted file are removed in one call.
-    expect(mockedElasticsearch.deleteDocumentsByFilePaths).toHaveBeenCalledTimes(1);
-    expect(mockedElasticsearch.deleteDocumentsByFilePaths).toHaveBeenCalledWith(
-      expect.arrayContaining(['src/old_file.ts', 'src/modified_file.ts', 'src/deleted_file.ts']),
+    // Deletes are batched: old rename path and deleted file are removed in one call. The modified file
+    // keeps its locations until it is parsed, and then keeps the chunks it still has.
+    expect(mockedElasticsearch.deleteDocumentsByFilePaths).toHaveBeenCalledTimes(2);
+    expect(mockedElasticsearch.deleteDocumentsByFilePaths).toHaveBeenNthCalledWith(
+      1,
+      expect.arrayContaining(['src/old_file.ts', 'src/deleted_file.ts']),
       'test-index',
       expect.objectContaining({ deleteDocumentsPageSize: undefined })
     );
+    expect(mockedElasticsearch.deleteDocumentsByFilePaths).toHaveBeenNthCalledWith(
+      2,
+      ['src/modified_file.ts'],
+      'test-index',
+      expect.objectContaining({ keepChunkIds: new Set() })
+    );
 
     // Ensure we didn't attempt to delete paths that should only be indexed.
     const deleteArgs = (mockedElasticsearch.deleteDocumentsByFilePaths as unknown as { mock: { calls: unknown[][] } })
@@ -134,6 +142,7 @@ describe('incrementalIndex', () => {
       expect.arrayContaining(['src/added_file.ts', 'src/new_file.ts', 'src/copied_file.ts'])
     );
     expect(deleteArgs).not.toEqual(expect.arrayContaining(['src/original_file.ts']));
+    expect(deleteArgs).not.toContain('src/modified_file.ts');
 
     // Verify that parsing workers are created (pooling may reuse workers)
     expect(mockedWorker).toHaveBeenCalled();
@@ -145,4 +154,76 @@ describe('incrementalIndex', () => {
     expect(indexedFiles).toContain('src/added_file.ts');
     expect(indexedFiles).toContain('src/modified_file.ts');
   });
+
+  describe('per-file errors', () => {
+    const gitDiffOutput = ['A\tsrc/broken.ts', 'A\tsrc/degraded.ts', 'A\tsrc/ok.ts'].join('\n');
+
+    beforeEach(() => {
+      const git = {
+        revparse: vi
+          .fn()
+          .mockResolvedValueOnce('main') // gitBranch
+          .mockResolvedValueOnce('/test/repo') // gitRoot
+          .mockResolvedValueOnce('new-commit-hash'), // newCommitHash
+        diff: vi.fn().mockResolvedValue(gitDiffOutput),
+      } as unknown as ReturnType<typeof simpleGit>;
+      mockedSimpleGit.mockReturnValue(git);
+      mockedElasticsearch.getLastIndexedCommit.mockResolvedValue('old-commit-hash');
+
+      // Answer each posted file: one fails to parse, one falls back to text chunking
+      mockedWorker.mockImplementation(function () {
+        let onMessage: ((message: unknown) => void) | undefined;
+        const worker = {
+          on: vi.fn((event, cb) => {
+            if (event === 'message') {
+              onMessage = cb;
+            }
+            return worker;
+          }),
+          postMessage: vi.fn((message: { relativePath: string }) => {
+            const reply =
+              message.relativePath === 'src/broken.ts'
+                ? { status: 'failure', error: 'Unexpected token', filePath: message.relativePath }
+                : {
+                    status: 'success',
+                    data: [{ content: message.relativePath }],
+                    fallback:
+                      message.relativePath === 'src/degraded.ts' ? { error: 'Query error', line: 3 } : undefined,
+                  };
+            setTimeout(() => onMessage?.(reply), 0);
+          }),
+          terminate: vi.fn(),
+          ref: vi.fn(),
+          unref: vi.fn(),
+        };
+        return worker;
+      });
+    });
+
+    it('SHOULD collect per-file errors and keep indexing the other files', async () => {
+      const errors = await incrementalIndex('/test/repo', {
+        queueDir: '.test-queue',
+        elasticsearchIndex: 'test-index',
+      });
+
+      expect(errors).toEqual([
+        { path: 'src/broken.ts', error: 'Unexpected token', fatal: true },
+        {
+          path: 'src/degraded.ts',
+          error: 'Tree-sitter failed (Query error); indexed as plain text',
+          line: 3,
+          fatal: false,
+        },
+      ]);
+      expect(workQueue.enqueue).toHaveBeenCalledTimes(2);
+      expect(workQueue.markEnqueueCompleted).toHaveBeenCalled();
+    });
+
+    it('SHOULD fail fast WHEN strict is set', async () => {
+      await expect(
+        incrementalIndex('/test/repo', { queueDir: '.test-queue', elasticsearchIndex: 'test-index', strict: true })
+      ).rejects.toThrow('Failed to index src/broken.ts: Unexpected token');
+      expect(workQueue.markEnqueueCompleted).not.toHaveBeenCalled();
+    });
+  });
 });
@@ -0,0 +1,113 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import zlib from 'zlib';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { NoopEmbedder } from '../../src/utils/embedder';
+import { exportIndexArchive, importIndexArchive } from '../../src/utils/index_archive';
+import { makeChunk } from './utils/fixtures';
+
+const answer = { name: 'answer', kind: 'variable.name', line: 1 };
+
+describe('index archives', () => {
+  let tmpDir: string;
+  let archive: string;
+  let source: SqliteStore;
+  let target: SqliteStore;
+  const embedder = new NoopEmbedder(3);
+
+  beforeEach(async () => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-index-archive-'));
+    archive = path.join(tmpDir, 'index.tar.gz');
+    source = new SqliteStore({ dbPath: path.join(tmpDir, 'source.db') });
+    target = new SqliteStore({ dbPath: path.join(tmpDir, 'target.db') });
+    await source.indexChunks([
+      makeChunk({ symbols: [answer], code_vector: [1, 0, 0] }),
+      makeChunk({ filePath: 'src/b.ts', git_file_hash: 'hash-b', symbols: [answer], code_vector: [1, 0, 0] }),
+      makeChunk({
+        content: 'const c = 3;',
+        chunk_hash: 'chunk-c',
+        filePath: 'src/c.ts',
+        symbols: [{ name: 'counter', kind: 'variable.name', line: 1 }],
+        code_vector: [0, 0, 1],
+      }),
+    ]);
+    await source.updateLastIndexedCommit('main', 'abc123');
+  });
+
+  afterEach(async () => {
+    await source.close();
+    await target.close();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD copy chunks, vectors, locations, and commits into another store', async () => {
+    const exported = await exportIndexArchive(source, archive, { embedder, index: 'source' });
+
+    const imported = await importIndexArchive(target, archive, { embedder, index: 'target' });
+
+    expect(exported).toMatchObject({ format: 1, embedder: 'noop', dimensions: 3, chunks: 2, locations: 3 });
+    expect(exported.commits).toEqual({ main: 'abc123' });
+    expect(imported).toEqual(exported);
+    const [sourceStats, targetStats] = await Promise.all([source.getStats(), target.getStats()]);
+    expect(targetStats).toMatchObject({ files: sourceStats.files, chunks: sourceStats.chunks });
+    const [hit] = await target.search([0, 0, 1], 1);
+    expect(hit).toMatchObject({ content: 'const c = 3;', filePath: 'src/c.ts', score: expect.closeTo(1, 6) });
+    expect(await target.getIndexedFileHashes('main')).toEqual(await source.getIndexedFileHashes('main'));
+    expect((await target.keywordSearch('answer', 1))[0]?.content).toBe('const a = 1;');
+    expect(await target.getLastIndexedCommit('main')).toBe('abc123');
+  });
+
+  it('SHOULD write a gzipped tar with the manifest ahead of the chunks', async () => {
+    await exportIndexArchive(source, archive, { embedder, index: 'source' });
+
+    const tar = zlib.gunzipSync(fs.readFileSync(archive));
+
+    expect(tar.toString('ascii', 0, 13)).toBe('manifest.json');
+    expect(tar.toString('ascii', 257, 262)).toBe('ustar');
+    expect(tar.includes('chunks.jsonl')).toBe(true);
+  });
+
+  it('SHOULD refuse archives built with another embedder or dimensions', async () => {
+    await exportIndexArchive(source, archive, { embedder, index: 'source' });
+
+    await expect(
+      importIndexArchive(target, archive, { embedder: new NoopEmbedder(8), index: 'target' })
+    ).rejects.toThrow(
+      `Archive "${archive}" was built with embedder "noop" (3 dimensions), but embedder "noop" (8 dimensions) ` +
+        'is configured'
+    );
+    await expect(importIndexArchive(target, archive, { index: 'target' })).rejects.toThrow(
+      /but no client-side embedder is configured/
+    );
+    expect((await target.getStats()).chunks).toBe(0);
+  });
+
+  it('SHOULD refuse to import into a store that already holds chunks', async () => {
+    await exportIndexArchive(source, archive, { embedder, index: 'source' });
+
+    await expect(importIndexArchive(source, archive, { embedder, index: 'source' })).rejects.toThrow(
+      'Index "source" already holds 2 chunk(s). Import into a new index, or clean this one first.'
+    );
+  });
+
+  it('SHOULD refuse to export vectors with an embedder of other dimensions', async () => {
+    await expect(
+      exportIndexArchive(source, archive, { embedder: new NoopEmbedder(8), index: 'source' })
+    ).rejects.toThrow(/produces 8-dimensional vectors/);
+    expect(fs.existsSync(archive)).toBe(false);
+  });
+
+  it('SHOULD reject files that are not index archives', async () => {
+    fs.writeFileSync(archive, zlib.gzipSync(Buffer.alloc(1024, 1)));
+
+    await expect(importIndexArchive(target, archive, { embedder, index: 'target' })).rejects.toThrow(
+      `Could not read archive "${archive}": not a tar archive`
+    );
+    await expect(importIndexArchive(target, `${archive}.missing`, { embedder, index: 'target' })).rejects.toThrow(
+      /does not exist/
+    );
+  });
+});
@@ -8,6 +8,7 @@ import { logger } from '../../src/utils/logger';
 import * as workerModule from '../../src/commands/worker_command';
 import * as fullIndexModule from '../../src/commands/full_index_producer';
 import * as incrementalModule from '../../src/commands/incremental_index_command';
+import * as dryRunModule from '../../src/commands/dry_run';
 import * as elasticsearchModule from '../../src/utils/elasticsearch';
 import { SqliteQueue } from '../../src/utils/sqlite_queue';
 import type { CodeChunk } from '../../src/utils/elasticsearch';
@@ -43,14 +44,25 @@ describe('index_command', () => {
     // Commander caches parsed options, so we need to reset them
     indexCommand.setOptionValue('pull', undefined);
     indexCommand.setOptionValue('clean', undefined);
+    indexCommand.setOptionValue('force', undefined);
     indexCommand.setOptionValue('watch', undefined);
     indexCommand.setOptionValue('branch', undefined);
     indexCommand.setOptionValue('githubToken', undefined);
     indexCommand.setOptionValue('concurrency', undefined);
     indexCommand.setOptionValue('batchSize', undefined);
+    indexCommand.setOptionValue('maxInFlightChunks', undefined);
     indexCommand.setOptionValue('deleteDocumentsPageSize', undefined);
     indexCommand.setOptionValue('parseConcurrency', undefined);
+    indexCommand.setOptionValue('embeddingBatchSize', undefined);
+    indexCommand.setOptionValue('embeddingConcurrency', undefined);
+    indexCommand.setOptionValue('embedCache', undefined);
     indexCommand.setOptionValue('languages', undefined);
+    indexCommand.setOptionValue('gitignore', undefined);
+    indexCommand.setOptionValue('include', undefined);
+    indexCommand.setOptionValue('exclude', undefined);
+    indexCommand.setOptionValue('ref', undefined);
+    indexCommand.setOptionValue('dedup', undefined);
+    indexCommand.setOptionValue('dryRun', undefined);
 
     if (fs.existsSync(testQueuesDir)) {
       fs.rmSync(testQueuesDir, { recursive: true });
@@ -425,8 +437,8 @@ describe('index_command', () => {
 
         // Mock the worker and indexing functions
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
-        vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
 
@@ -460,7 +472,7 @@ describe('index_command', () => {
         vi.spyOn(gitHelper, 'pullRepo').mockResolvedValue();
 
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
 
@@ -474,6 +486,53 @@ describe('index_command', () => {
       });
     });
 
+    describe('WHEN watch mode is combined with --ref', () => {
+      it('SHOULD reject the combination before indexing', async () => {
+        const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+
+        await expect(
+          indexCommand.parseAsync(['node', 'test', '/path/to/repo1', '--watch', '--ref', 'v1.0.0'])
+        ).rejects.toThrow('--ref cannot be combined with --watch');
+        expect(indexSpy).not.toHaveBeenCalled();
+      });
+    });
+
+    describe('WHEN --dry-run is given', () => {
+      it('SHOULD report each repository without enqueueing, running the worker, or opening the store', async () => {
+        const report = { files: 1, chunks: 2, estimatedTokens: 30, languages: {}, errors: [] };
+        const dryRunSpy = vi.spyOn(dryRunModule, 'dryRunIndex').mockResolvedValue(report);
+        const printSpy = vi.spyOn(dryRunModule, 'printDryRunReport').mockReturnValue(undefined);
+        const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        const workerSpy = vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
+        const getLastIndexedCommitSpy = vi.spyOn(elasticsearchModule, 'getLastIndexedCommit');
+        vi.spyOn(fs, 'existsSync').mockReturnValue(true);
+        vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+
+        await indexCommand.parseAsync(['node', 'test', '/path/to/repo1', '/path/to/repo2', '--dry-run']);
+
+        expect(dryRunSpy).toHaveBeenCalledTimes(2);
+        expect(dryRunSpy).toHaveBeenCalledWith('/path/to/repo1', expect.objectContaining({ repoName: 'repo1' }));
+        expect(printSpy).toHaveBeenNthCalledWith(1, 'repo1', report);
+        expect(printSpy).toHaveBeenNthCalledWith(2, 'repo2', report);
+        expect(indexSpy).not.toHaveBeenCalled();
+        expect(workerSpy).not.toHaveBeenCalled();
+        expect(getLastIndexedCommitSpy).not.toHaveBeenCalled();
+      });
+
+      it('SHOULD reject --watch and --clean, which a dry run cannot honor', async () => {
+        vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+
+        await expect(
+          indexCommand.parseAsync(['node', 'test', '/path/to/repo1', '--dry-run', '--watch'])
+        ).rejects.toThrow('--dry-run cannot be combined with --watch');
+        indexCommand.setOptionValue('watch', undefined);
+        await expect(
+          indexCommand.parseAsync(['node', 'test', '/path/to/repo1', '--dry-run', '--clean'])
+        ).rejects.toThrow('--dry-run cannot be combined with --clean');
+      });
+    });
+
     describe('WHEN processing multiple repos with watch mode', () => {
       it('SHOULD pass watch=true only to first repo worker', async () => {
         const workerSpy = vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
@@ -483,7 +542,7 @@ describe('index_command', () => {
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
         vi.spyOn(gitHelper, 'pullRepo').mockResolvedValue();
 
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
 
@@ -527,7 +586,7 @@ describe('index_command', () => {
         vi.spyOn(gitHelper, 'pullRepo').mockResolvedValue();
 
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
 
@@ -543,6 +602,107 @@ describe('index_command', () => {
     });
   });
 
+  describe('--force flag behavior', () => {
+    beforeEach(() => {
+      vi.clearAllMocks();
+      vi.mocked(execFileSync).mockReturnValue(Buffer.from('main\n'));
+    });
+
+    afterEach(() => {
+      vi.restoreAllMocks();
+    });
+
+    const mockDependencies = () => {
+      vi.spyOn(fs, 'existsSync').mockReturnValue(true);
+      vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
+      vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue('previous-commit');
+      vi.spyOn(elasticsearchModule, 'createSettingsIndex').mockResolvedValue(undefined);
+      vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
+      vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+    };
+
+    describe('WHEN --force flag is provided and a previous index exists', () => {
+      it('SHOULD run a non-clean full index with force enabled instead of incremental', async () => {
+        mockDependencies();
+        const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
+
+        await indexCommand.parseAsync(['node', 'test', '/path/to/repo', '--force']);
+
+        expect(incrementalSpy).not.toHaveBeenCalled();
+        expect(indexSpy).toHaveBeenCalledWith('/path/to/repo', false, expect.objectContaining({ force: true }));
+      });
+    });
+
+    describe('WHEN --force flag is not provided and a previous index exists', () => {
+      it('SHOULD run an incremental index', async () => {
+        mockDependencies();
+        const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
+
+        await indexCommand.parseAsync(['node', 'test', '/path/to/repo']);
+
+        expect(indexSpy).not.toHaveBeenCalled();
+        expect(incrementalSpy).toHaveBeenCalledTimes(1);
+      });
+    });
+  });
+
+  describe('file selection flags', () => {
+    beforeEach(() => {
+      vi.clearAllMocks();
+      vi.mocked(execFileSync).mockReturnValue(Buffer.from('main\n'));
+      vi.spyOn(fs, 'existsSync').mockReturnValue(true);
+      vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
+      vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
+      vi.spyOn(elasticsearchModule, 'createSettingsIndex').mockResolvedValue(undefined);
+      vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
+      vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+    });
+
+    afterEach(() => {
+      vi.restoreAllMocks();
+    });
+
+    it('SHOULD honor .gitignore and pass no globs by default', async () => {
+      const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+
+      await indexCommand.parseAsync(['node', 'test', '/path/to/repo']);
+
+      const producerOptions = indexSpy.mock.calls[0][2];
+      expect(producerOptions.gitignore).not.toBe(false);
+      expect(producerOptions.include).toBeUndefined();
+      expect(producerOptions.exclude).toBeUndefined();
+    });
+
+    it('SHOULD collect repeated and comma-separated --include/--exclude patterns and --no-gitignore', async () => {
+      const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+
+      await indexCommand.parseAsync([
+        'node',
+        'test',
+        '/path/to/repo',
+        '--no-gitignore',
+        '--include',
+        'src/**, lib/**',
+        '--include',
+        'scripts/**',
+        '--exclude',
+        '*.test.ts',
+      ]);
+
+      expect(indexSpy).toHaveBeenCalledWith(
+        '/path/to/repo',
+        false,
+        expect.objectContaining({
+          gitignore: false,
+          include: ['src/**', 'lib/**', 'scripts/**'],
+          exclude: ['*.test.ts'],
+        })
+      );
+    });
+  });
+
   describe('--pull flag behavior', () => {
     beforeEach(() => {
       vi.clearAllMocks();
@@ -560,7 +720,7 @@ describe('index_command', () => {
         vi.spyOn(fs, 'existsSync').mockReturnValue(true);
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -577,7 +737,7 @@ describe('index_command', () => {
           vi.spyOn(fs, 'existsSync').mockReturnValue(true);
           vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
           vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-          vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+          vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
           vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
           vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
           vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -595,7 +755,7 @@ describe('index_command', () => {
           vi.spyOn(fs, 'existsSync').mockReturnValue(true);
           vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
           vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-          vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+          vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
           vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
           vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
           vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -619,7 +779,7 @@ describe('index_command', () => {
         vi.spyOn(fs, 'existsSync').mockReturnValue(true);
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -630,7 +790,7 @@ describe('index_command', () => {
       });
 
       it('SHOULD NOT pass pull option to incrementalIndex (pull already done before indexing)', async () => {
-        const incrementalIndexSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue(undefined);
+        const incrementalIndexSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
 
         vi.spyOn(fs, 'existsSync').mockReturnValue(true);
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
@@ -656,7 +816,7 @@ describe('index_command', () => {
         vi.spyOn(fs, 'existsSync').mockReturnValue(true);
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -688,7 +848,7 @@ describe('index_command', () => {
 
         vi.spyOn(gitHelper, 'cloneOrPullRepo').mockResolvedValue();
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -730,7 +890,7 @@ describe('index_command', () => {
           return originalExistsSync(p);
         });
 
-        const fullIndexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        const fullIndexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -760,7 +920,7 @@ describe('index_command', () => {
           return originalExistsSync(p);
         });
 
-        const fullIndexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        const fullIndexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -802,6 +962,17 @@ describe('index_command', () => {
           'Invalid languages value: empty string.'
         );
       }));
+
+    it('SHOULD throw before indexing when SCS_IDXR_CHUNK_STRATEGY names an unknown strategy', () =>
+      withTestEnv({ SCS_IDXR_CHUNK_STRATEGY: 'json:whole-files' }, async () => {
+        const indexSpy = vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
+        vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
+
+        await expect(indexCommand.parseAsync(['node', 'test', '/path/to/my-repo'])).rejects.toThrow(
+          'Unknown chunk strategy "whole-files" for json.'
+        );
+        expect(indexSpy).not.toHaveBeenCalled();
+      }));
   });
 
   describe('clone error handling', () => {
@@ -864,7 +1035,7 @@ describe('index_command', () => {
       vi.mocked(execFileSync).mockReturnValue(Buffer.from('main\n'));
 
       vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-      vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+      vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
       vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
       vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
       vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -920,7 +1091,7 @@ describe('index_command', () => {
         });
 
         vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-        vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+        vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
         vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
         vi.spyOn(elasticsearchModule, 'updateLastIndexedCommit').mockResolvedValue(undefined);
         vi.spyOn(otelProvider, 'shutdown').mockResolvedValue(undefined);
@@ -1005,8 +1176,8 @@ describe('index_command', () => {
       mockGitBranchAndHead('new-commit');
 
       const workerSpy = vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue(undefined);
-      vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
+      vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
 
       vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue('old-commit');
       const createSettingsSpy = vi.spyOn(elasticsearchModule, 'createSettingsIndex').mockResolvedValue(undefined);
@@ -1049,8 +1220,8 @@ describe('index_command', () => {
       mockGitBranchAndHead('same-commit');
 
       const workerSpy = vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue(undefined);
-      vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
+      vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
 
       vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue('same-commit');
       vi.spyOn(elasticsearchModule, 'createSettingsIndex').mockResolvedValue(undefined);
@@ -1070,8 +1241,8 @@ describe('index_command', () => {
       mockGitBranchAndHead('new-commit');
 
       const workerSpy = vi.spyOn(workerModule, 'worker').mockResolvedValue(undefined);
-      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue(undefined);
-      vi.spyOn(fullIndexModule, 'index').mockResolvedValue(undefined);
+      const incrementalSpy = vi.spyOn(incrementalModule, 'incrementalIndex').mockResolvedValue([]);
+      vi.spyOn(fullIndexModule, 'index').mockResolvedValue([]);
 
       vi.spyOn(elasticsearchModule, 'getLastIndexedCommit').mockResolvedValue(null);
       vi.spyOn(elasticsearchModule, 'createSettingsIndex').mockResolvedValue(undefined);
@@ -0,0 +1,62 @@
+import { describe, it, expect, vi } from 'vitest';
+
+import { StrictIndexError, getParseErrors, reportIndexErrors } from '../../src/utils/index_errors';
+import { createLogger } from '../../src/utils/logger';
+
+describe('getParseErrors', () => {
+  it('SHOULD return nothing for a cleanly parsed file', () => {
+    expect(getParseErrors('src/a.ts', undefined, 0)).toEqual([]);
+  });
+
+  it('SHOULD report a text fallback and skipped chunks as non-fatal', () => {
+    expect(getParseErrors('src/a.ts', { error: 'Query error', line: 7 }, 2)).toEqual([
+      { path: 'src/a.ts', error: 'Tree-sitter failed (Query error); indexed as plain text', line: 7, fatal: false },
+      { path: 'src/a.ts', error: 'Skipped 2 chunk(s) larger than maxChunkSizeBytes', fatal: false },
+    ]);
+  });
+
+  it('SHOULD report a file the parser skipped as fatal, with the reason', () => {
+    expect(getParseErrors('logo.png', undefined, 0, { reason: 'binary', message: 'binary content' })).toEqual([
+      { path: 'logo.png', error: 'binary content', fatal: true, skipped: 'binary' },
+    ]);
+  });
+});
+
+describe('StrictIndexError', () => {
+  it('SHOULD point at the file and line', () => {
+    const error = new StrictIndexError({ path: 'src/a.ts', error: 'Unexpected token', line: 3, fatal: true });
+
+    expect(error.message).toBe('Failed to index src/a.ts:3: Unexpected token');
+    expect(error.indexError.path).toBe('src/a.ts');
+  });
+});
+
+describe('reportIndexErrors', () => {
+  it('SHOULD list skipped files before degraded ones', () => {
+    const logger = createLogger();
+    const warnSpy = vi.spyOn(logger, 'warn').mockImplementation(() => {});
+
+    reportIndexErrors(
+      [
+        { path: 'src/b.ts', error: 'Skipped 1 chunk(s) larger than maxChunkSizeBytes', fatal: false },
+        { path: 'src/a.ts', error: 'Unexpected token', fatal: true },
+      ],
+      logger
+    );
+
+    expect(warnSpy.mock.calls.map(([message]) => message)).toEqual([
+      '--- Index Error Report: 1 file(s) skipped, 1 degraded ---',
+      'Skipped src/a.ts: Unexpected token',
+      'Degraded src/b.ts: Skipped 1 chunk(s) larger than maxChunkSizeBytes',
+    ]);
+  });
+
+  it('SHOULD stay quiet WHEN there are no errors', () => {
+    const logger = createLogger();
+    const warnSpy = vi.spyOn(logger, 'warn').mockImplementation(() => {});
+
+    reportIndexErrors([], logger);
+
+    expect(warnSpy).not.toHaveBeenCalled();
+  });
+});
@@ -4,12 +4,20 @@ import { InMemoryQueue } from '../../src/utils/in_memory_queue';
 import * as elasticsearch from '../../src/utils/elasticsearch';
 import { CodeChunk, BulkIndexResult } from '../../src/utils/elasticsearch';
 import { logger } from '../../src/utils/logger';
+import { NoopEmbedder } from '../../src/utils/embedder';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { IndexingCancelledError } from '../../src/utils/cancellation';
+import { ChunkDeduplicator } from '../../src/utils/chunk_dedup';
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
 
 vi.mock('../../src/utils/elasticsearch', async () => {
   const actual = await vi.importActual('../../src/utils/elasticsearch');
   return {
     ...actual,
     indexCodeChunks: vi.fn(),
+    getChunkVectors: vi.fn(async () => new Map()),
   };
 });
 
@@ -187,6 +195,43 @@ describe('IndexerWorker', () => {
     expect(elasticsearch.indexCodeChunks).toHaveBeenCalledTimes(4);
   });
 
+  it('should keep the documents of the batches in flight within maxInFlightDocuments', async () => {
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 4,
+      concurrency: 3,
+      maxInFlightDocuments: 6,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+    });
+
+    const chunks = Array.from({ length: 20 }, (_, i) => ({
+      ...MOCK_CHUNK,
+      chunk_hash: `chunk_${i}`,
+    }));
+    await queue.enqueue(chunks);
+
+    let inFlight = 0;
+    let maxInFlight = 0;
+    const batchSizes: number[] = [];
+
+    vi.mocked(elasticsearch.indexCodeChunks).mockImplementation(async (inputChunks) => {
+      inFlight += inputChunks.length;
+      maxInFlight = Math.max(maxInFlight, inFlight);
+      batchSizes.push(inputChunks.length);
+      await new Promise((resolve) => setTimeout(resolve, 10));
+      inFlight -= inputChunks.length;
+      return successResult(inputChunks);
+    });
+
+    await concurrentWorker.start();
+
+    expect(maxInFlight).toBeLessThanOrEqual(6);
+    expect(Math.max(...batchSizes)).toBe(4);
+    expect(batchSizes.reduce((a, b) => a + b, 0)).toBe(20);
+  });
+
   // Test 3: Bulk indexing failures
   it('should requeue batch when Elasticsearch bulk indexing fails', async () => {
     concurrentWorker = new IndexerWorker({
@@ -352,4 +397,279 @@ describe('IndexerWorker', () => {
     expect(requeuedDocs).toHaveLength(1);
     expect(requeuedDocs[0].document.chunk_hash).toBe('bad_chunk');
   });
+
+  it('should fill code_vector with the configured embedder before indexing', async () => {
+    const embedder = new NoopEmbedder(8);
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      embedder,
+    });
+
+    await queue.enqueue([MOCK_CHUNK]);
+    vi.mocked(elasticsearch.indexCodeChunks).mockImplementation(async (chunks) => successResult(chunks));
+
+    await concurrentWorker.start();
+
+    const [expectedVector] = await embedder.embed([MOCK_CHUNK.semantic_text]);
+    expect(elasticsearch.indexCodeChunks).toHaveBeenCalledWith(
+      [{ ...MOCK_CHUNK, code_vector: expectedVector }],
+      testIndex
+    );
+  });
+
+  it('should requeue only the documents whose embedding batch keeps failing', async () => {
+    const embedder = new NoopEmbedder(8);
+    const realEmbed = embedder.embed.bind(embedder);
+    vi.spyOn(embedder, 'embed').mockImplementation(async (texts) => {
+      if (texts.includes('bad')) {
+        throw new Error('model unavailable');
+      }
+      return realEmbed(texts);
+    });
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      embedder,
+      embedding: { batchSize: 1, concurrency: 2, maxRetries: 1, retryBaseDelayMs: 0 },
+    });
+
+    const goodChunk = { ...MOCK_CHUNK, chunk_hash: 'good_chunk' };
+    const badChunk = { ...MOCK_CHUNK, chunk_hash: 'bad_chunk', semantic_text: 'bad' };
+    await queue.enqueue([goodChunk, badChunk]);
+    const requeueSpy = vi.spyOn(queue, 'requeue');
+    const commitSpy = vi.spyOn(queue, 'commit');
+    const infoSpy = vi.spyOn(logger, 'info');
+    vi.mocked(elasticsearch.indexCodeChunks).mockImplementation(async (chunks) => successResult(chunks));
+
+    await concurrentWorker.start();
+
+    // Only the good chunk reaches the store.
+    expect(elasticsearch.indexCodeChunks).toHaveBeenCalledTimes(1);
+    const indexed = vi.mocked(elasticsearch.indexCodeChunks).mock.calls[0][0];
+    expect(indexed.map((c) => c.chunk_hash)).toEqual(['good_chunk']);
+    expect(commitSpy.mock.calls[0][0].map((d) => d.document.chunk_hash)).toEqual(['good_chunk']);
+
+    // The bad chunk is requeued until the queue's retry limit is reached.
+    expect(requeueSpy).toHaveBeenCalled();
+    expect(requeueSpy.mock.calls[0][0].map((d) => d.document.chunk_hash)).toEqual(['bad_chunk']);
+
+    expect(infoSpy).toHaveBeenCalledWith(
+      '--- Indexing Summary ---',
+      expect.objectContaining({ succeeded: 1, failed: 1 })
+    );
+  });
+
+  it('should finish the batch in flight and leave the rest queued when cancelled', async () => {
+    const controller = new AbortController();
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 1,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      signal: controller.signal,
+    });
+
+    await queue.enqueue([
+      MOCK_CHUNK,
+      { ...MOCK_CHUNK, chunk_hash: 'chunk_hash_2' },
+      { ...MOCK_CHUNK, chunk_hash: 'chunk_hash_3' },
+    ]);
+    const commitSpy = vi.spyOn(queue, 'commit');
+    vi.mocked(elasticsearch.indexCodeChunks).mockImplementation(async (chunks) => {
+      controller.abort();
+      return successResult(chunks);
+    });
+
+    await expect(concurrentWorker.start()).rejects.toBeInstanceOf(IndexingCancelledError);
+
+    expect(elasticsearch.indexCodeChunks).toHaveBeenCalledTimes(1);
+    expect(commitSpy).toHaveBeenCalledTimes(1);
+    expect((await queue.dequeue(10)).map((doc) => doc.document.chunk_hash)).toEqual([
+      'chunk_hash_2',
+      'chunk_hash_3',
+    ]);
+  });
+
+  it('should stop polling in watch mode when cancelled', async () => {
+    const controller = new AbortController();
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      watch: true,
+      logger,
+      elasticsearchIndex: testIndex,
+      signal: controller.signal,
+    });
+
+    const started = concurrentWorker.start();
+    setTimeout(() => controller.abort(), 10);
+
+    await expect(started).rejects.toThrow('Indexing cancelled');
+  });
+
+  it('should write chunks to the configured store instead of Elasticsearch', async () => {
+    const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-worker-store-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'store.db') });
+    const embedder = new NoopEmbedder(8);
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      store,
+      embedder,
+    });
+
+    try {
+      await queue.enqueue([MOCK_CHUNK]);
+      const commitSpy = vi.spyOn(queue, 'commit');
+
+      await concurrentWorker.start();
+
+      expect(elasticsearch.indexCodeChunks).not.toHaveBeenCalled();
+      expect(commitSpy).toHaveBeenCalledTimes(1);
+      const [queryVector] = await embedder.embed([MOCK_CHUNK.semantic_text]);
+      const results = await store.search(queryVector, 1);
+      expect(results.map((r) => r.content)).toEqual([MOCK_CHUNK.content]);
+    } finally {
+      await store.close();
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    }
+  });
+
+  it('should reuse the stored vectors of chunks instead of embedding them again', async () => {
+    const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-worker-reuse-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'store.db') });
+    const embedder = new NoopEmbedder(8);
+    const storedVector = [1, 0, 0, 0, 0, 0, 0, 0];
+    await store.indexChunks([{ ...MOCK_CHUNK, code_vector: storedVector }]);
+    const embedSpy = vi.spyOn(embedder, 'embed');
+    const infoSpy = vi.spyOn(logger, 'info');
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      store,
+      embedder,
+    });
+
+    try {
+      const moved = { ...MOCK_CHUNK, startLine: 5, endLine: 5 };
+      const added = { ...MOCK_CHUNK, chunk_hash: 'hash_2', content: 'const b = 2;', semantic_text: 'const b = 2;' };
+      await queue.enqueue([moved, added]);
+
+      await concurrentWorker.start();
+
+      expect(embedSpy).toHaveBeenCalledTimes(1);
+      expect(embedSpy.mock.calls[0][0]).toEqual(['const b = 2;']);
+      const chunkId = elasticsearch.getChunkDocumentId(moved);
+      expect(await store.getChunkVectors([chunkId])).toEqual(new Map([[chunkId, storedVector]]));
+      expect(infoSpy).toHaveBeenCalledWith(
+        '--- Indexing Summary ---',
+        expect.objectContaining({ succeeded: 2, reusedVectors: 1 })
+      );
+    } finally {
+      await store.close();
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    }
+  });
+
+  it('should embed every chunk again WHEN reuseStoredVectors is off', async () => {
+    const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-worker-no-reuse-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'store.db') });
+    const embedder = new NoopEmbedder(8);
+    await store.indexChunks([{ ...MOCK_CHUNK, code_vector: [1, 0, 0, 0, 0, 0, 0, 0] }]);
+    const embedSpy = vi.spyOn(embedder, 'embed');
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      store,
+      embedder,
+      reuseStoredVectors: false,
+    });
+
+    try {
+      await queue.enqueue([{ ...MOCK_CHUNK, startLine: 5, endLine: 5 }]);
+
+      await concurrentWorker.start();
+
+      expect(embedSpy).toHaveBeenCalledTimes(1);
+      const chunkId = elasticsearch.getChunkDocumentId(MOCK_CHUNK);
+      const [embedded] = await embedder.embed([MOCK_CHUNK.semantic_text]);
+      expect((await store.getChunkVectors([chunkId])).get(chunkId)).toEqual(embedded.map((v) => expect.closeTo(v, 5)));
+    } finally {
+      await store.close();
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    }
+  });
+
+  it('should store a near-duplicate chunk as another location of its canonical chunk', async () => {
+    const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-worker-dedup-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'store.db') });
+    const content = Array.from({ length: 8 }, (_, i) => `  const value${i} = compute(input.field${i}, options);`).join(
+      '\n'
+    );
+    const canonical = { ...MOCK_CHUNK, content, semantic_text: content };
+    const copy = {
+      ...MOCK_CHUNK,
+      filePath: 'vendor/test.ts',
+      chunk_hash: 'chunk_hash_2',
+      startLine: 20,
+      endLine: 27,
+      content: content.replace('value7', 'result7'),
+      semantic_text: content.replace('value7', 'result7'),
+    };
+    const deduplicator = new ChunkDeduplicator(0.9);
+    concurrentWorker = new IndexerWorker({
+      queue,
+      batchSize: 10,
+      concurrency: 1,
+      watch: false,
+      logger,
+      elasticsearchIndex: testIndex,
+      store,
+      embedder: new NoopEmbedder(8),
+      deduplicator,
+    });
+
+    try {
+      await queue.enqueue([canonical, copy]);
+
+      await concurrentWorker.start();
+
+      const stats = await store.getStats();
+      expect(stats.chunks).toBe(1);
+      expect(deduplicator.foldedCount).toBe(1);
+      const chunkId = elasticsearch.getChunkDocumentId(canonical);
+      expect(await store.getChunkLocations([chunkId], 10)).toEqual({
+        [chunkId]: [
+          { filePath: 'test.ts', startLine: 1, endLine: 1, gitFileHash: 'hash1' },
+          { filePath: 'vendor/test.ts', startLine: 20, endLine: 27, gitFileHash: 'hash1' },
+        ],
+      });
+    } finally {
+      await store.close();
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    }
+  });
 });
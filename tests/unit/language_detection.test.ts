@@ -0,0 +1,111 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import { describe, it, expect } from 'vitest';
+
+import {
+  DETECTION_SAMPLE_BYTES,
+  MINIFIED_AVERAGE_LINE_LENGTH,
+  createLanguageFileMatcher,
+  detectLanguage,
+  isMinifiedContent,
+  readFileSample,
+} from '../../src/utils/language_detection';
+
+describe('detectLanguage', () => {
+  it('SHOULD detect the language from the extension', () => {
+    expect(detectLanguage('src/index.ts', 'export const a = 1;')).toBe('typescript');
+    expect(detectLanguage('README.md', '# Title')).toBe('markdown');
+  });
+
+  it('SHOULD prefer the extension over a shebang line', () => {
+    expect(detectLanguage('bin/cli.js', '#!/usr/bin/env python3\n')).toBe('javascript');
+  });
+
+  it('SHOULD detect extensionless scripts by their shebang interpreter', () => {
+    expect(detectLanguage('bin/deploy', '#!/bin/bash\nset -e\n')).toBe('bash');
+    expect(detectLanguage('bin/run', '#! /bin/sh\n')).toBe('bash');
+    expect(detectLanguage('bin/tool', '#!/usr/bin/env python3.11\n')).toBe('python');
+    expect(detectLanguage('bin/serve', '#!/usr/bin/env -S NODE_ENV=production node --inspect\n')).toBe('javascript');
+    expect(detectLanguage('bin/task', '#!/usr/bin/env -S deno run\n')).toBe('typescript');
+  });
+
+  it('SHOULD detect well-known file names', () => {
+    expect(detectLanguage('Dockerfile', 'FROM node:22\n')).toBe('dockerfile');
+    expect(detectLanguage('docker/Containerfile', 'FROM alpine\n')).toBe('dockerfile');
+    expect(detectLanguage('Makefile', 'all:\n\tmake build\n')).toBe('makefile');
+    expect(detectLanguage('build/rules.mk', 'CFLAGS += -O2\n')).toBe('makefile');
+  });
+
+  describe('WHEN an extension is shared by C and C++', () => {
+    it('SHOULD detect C++ headers by their content', () => {
+      expect(detectLanguage('include/widget.h', 'namespace ui {\nclass Widget {};\n}\n')).toBe('cpp');
+      expect(detectLanguage('include/list.h', '#include <vector>\nstd::vector<int> items();\n')).toBe('cpp');
+      expect(detectLanguage('include/base.h', 'class Base {\n public:\n  virtual ~Base();\n};\n')).toBe('cpp');
+    });
+
+    it('SHOULD treat other headers as C', () => {
+      expect(detectLanguage('include/list.h', '#include <stdio.h>\nstruct list { int class_id; };\n')).toBe('c');
+    });
+  });
+
+  it('SHOULD fall back to text for unknown files', () => {
+    expect(detectLanguage('styles.css', 'body { color: red; }')).toBe('text');
+    expect(detectLanguage('LICENSE', 'MIT License')).toBe('text');
+    expect(detectLanguage('bin/script', '#!/usr/bin/perl\n')).toBe('text');
+  });
+
+  it('SHOULD return undefined for binary content', () => {
+    expect(detectLanguage('logo.png', Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x00, 0x1a]))).toBeUndefined();
+    expect(detectLanguage('data.ts', 'const a = 1;\u0000')).toBeUndefined();
+  });
+});
+
+describe('isMinifiedContent', () => {
+  it('SHOULD detect content whose lines are very long on average', () => {
+    expect(isMinifiedContent('a'.repeat(MINIFIED_AVERAGE_LINE_LENGTH * 2))).toBe(true);
+    expect(isMinifiedContent(Buffer.from(`${'x=1;'.repeat(1000)}\n`))).toBe(true);
+  });
+
+  it('SHOULD accept code with the occasional long line', () => {
+    const lines = [...Array.from({ length: 20 }, (_, i) => `const a${i} = ${i};`), `const s = '${'a'.repeat(2000)}';`];
+
+    expect(isMinifiedContent(lines.join('\n'))).toBe(false);
+    expect(isMinifiedContent('')).toBe(false);
+  });
+});
+
+describe('readFileSample', () => {
+  it('SHOULD read at most the sample size from the start of the file', () => {
+    const tempFile = path.join(os.tmpdir(), `scs-sample-${process.pid}-${Date.now()}`);
+    fs.writeFileSync(tempFile, 'a'.repeat(DETECTION_SAMPLE_BYTES + 100));
+    try {
+      expect(readFileSample(tempFile)).toHaveLength(DETECTION_SAMPLE_BYTES);
+    } finally {
+      fs.unlinkSync(tempFile);
+    }
+  });
+});
+
+describe('createLanguageFileMatcher', () => {
+  it('SHOULD accept every file when text is enabled', () => {
+    const isLanguageFile = createLanguageFileMatcher(['typescript', 'text']);
+
+    expect(isLanguageFile('src/styles.css')).toBe(true);
+    expect(isLanguageFile('LICENSE')).toBe(true);
+  });
+
+  it('SHOULD match extensions and file names of the enabled languages', () => {
+    const isLanguageFile = createLanguageFileMatcher(['typescript', 'dockerfile']);
+
+    expect(isLanguageFile('src/index.ts')).toBe(true);
+    expect(isLanguageFile('deploy/Dockerfile')).toBe(true);
+    expect(isLanguageFile('src/index.js')).toBe(false);
+    expect(isLanguageFile('Makefile')).toBe(false);
+  });
+
+  it('SHOULD accept extensionless files only when a script language is enabled', () => {
+    expect(createLanguageFileMatcher(['bash'])('bin/deploy')).toBe(true);
+    expect(createLanguageFileMatcher(['markdown'])('bin/deploy')).toBe(false);
+  });
+});
@@ -151,4 +151,26 @@ describe('parseLanguageNames', () => {
     const allLanguages = Object.keys(languageConfigurations);
     expect(allLanguages).toContain('hcl');
   });
+
+  it('should parse rust language', () => {
+    const result = parseLanguageNames('rust');
+    expect(result).toEqual(['rust']);
+    expect(consoleWarnSpy).not.toHaveBeenCalled();
+  });
+
+  it('should include rust in supported languages', () => {
+    const allLanguages = Object.keys(languageConfigurations);
+    expect(allLanguages).toContain('rust');
+  });
+
+  it('should parse kotlin language', () => {
+    const result = parseLanguageNames('kotlin');
+    expect(result).toEqual(['kotlin']);
+    expect(consoleWarnSpy).not.toHaveBeenCalled();
+  });
+
+  it('should include kotlin in supported languages', () => {
+    const allLanguages = Object.keys(languageConfigurations);
+    expect(allLanguages).toContain('kotlin');
+  });
 });
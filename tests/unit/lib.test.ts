@@ -0,0 +1,491 @@
+import { execFileSync } from 'child_process';
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { Index, IndexOptions, ProgressEvent, createIndex } from '../../src/lib';
+import { SearchResult } from '../../src/utils/elasticsearch';
+import { NoopEmbedder } from '../../src/utils/embedder';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { withTestEnv } from './utils/test_env';
+
+function writeFile(root: string, relativePath: string, content: string): void {
+  const filePath = path.join(root, relativePath);
+  fs.mkdirSync(path.dirname(filePath), { recursive: true });
+  fs.writeFileSync(filePath, content);
+}
+
+describe('library API', () => {
+  let tmpDir: string;
+  let root: string;
+  let index: Index;
+  const sink = { debug: vi.fn(), info: vi.fn(), warn: vi.fn(), error: vi.fn() };
+
+  const openIndex = (options: Partial<IndexOptions> = {}) =>
+    createIndex({
+      index: 'lib',
+      store: new SqliteStore({ dbPath: path.join(tmpDir, 'store', 'lib.db') }),
+      embedder: new NoopEmbedder(8),
+      embedCache: false,
+      languages: ['typescript', 'python'],
+      root,
+      logger: sink,
+      ...options,
+    });
+
+  beforeEach(async () => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-lib-'));
+    root = path.join(tmpDir, 'repo');
+    writeFile(root, 'src/queue.ts', 'export function parseQueue(input: string) {\n  return input.split(",");\n}\n');
+    writeFile(root, 'src/util.py', 'def slugify(text):\n    return text.lower()\n');
+    writeFile(root, 'src/README.md', '# Not an enabled language\n');
+    writeFile(root, 'scripts/build.ts', 'export const build = () => 1;\n');
+    index = await openIndex();
+  });
+
+  afterEach(async () => {
+    await index.close();
+    vi.restoreAllMocks();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD index the files of the enabled languages under a directory and search them', async () => {
+    const result = await index.addPath('src');
+
+    expect(result).toMatchObject({ indexedFiles: 2, unchangedFiles: 0, deletedFiles: 0, errors: [] });
+    expect(result.chunks).toBeGreaterThan(0);
+
+    const hits = await index.search('parseQueue', { mode: 'keyword', limit: 1 });
+    expect(hits).toHaveLength(1);
+    expect(hits[0]).toMatchObject({ filePath: 'src/queue.ts', language: 'typescript', signals: ['keyword'] });
+    expect(await index.search('slugify text', { filters: { language: 'python' } })).not.toHaveLength(0);
+  });
+
+  it('SHOULD find code similar to lines of a file without returning those lines', async () => {
+    await index.addPath('src');
+    const code = 'export function parseQueue(input: string) {\n  return input.split(",");\n}';
+
+    const all = await index.searchSimilar(code, { mode: 'keyword' });
+    const similar = await index.searchSimilar(code, {
+      mode: 'keyword',
+      exclude: { filePath: path.join(root, 'src/queue.ts'), startLine: 2, endLine: 2 },
+    });
+
+    expect(all.map((hit) => hit.filePath)).toContain('src/queue.ts');
+    expect(similar.map((hit) => hit.filePath)).not.toContain('src/queue.ts');
+  });
+
+  it('SHOULD skip unchanged files and remove deleted ones', async () => {
+    await index.addPath(path.join(root, 'src'));
+
+    expect(await index.addPath('src')).toMatchObject({ indexedFiles: 0, unchangedFiles: 2 });
+
+    fs.rmSync(path.join(root, 'src/util.py'));
+    writeFile(root, 'src/queue.ts', 'export function parseQueue() {\n  return [];\n}\n');
+    expect(await index.addPath('src')).toMatchObject({ indexedFiles: 1, unchangedFiles: 0, deletedFiles: 1 });
+    expect(await index.search('slugify', { mode: 'keyword' })).toHaveLength(0);
+  });
+
+  it('SHOULD only embed the changed functions of an edited file', async () => {
+    const unchanged = 'export function drainQueue(items: string[]) {\n  return items.splice(0);\n}\n';
+    const parseQueue = 'export function parseQueue(input: string) {\n  return [input];\n}\n';
+    writeFile(root, 'src/queue.ts', `${unchanged}\n${parseQueue}`);
+    const embedder = new NoopEmbedder(8);
+    const embed = vi.spyOn(embedder, 'embed');
+    await index.close();
+    index = await openIndex({ embedder });
+    await index.addPath('src/queue.ts');
+    embed.mockClear();
+
+    // The untouched function moves down two lines
+    writeFile(root, 'src/queue.ts', `\n\n${unchanged}\nexport function parseQueue() {\n  return [];\n}\n`);
+    const result = await index.addPath('src/queue.ts');
+
+    const texts = embed.mock.calls.flatMap(([batch]) => batch);
+    expect(texts.some((text) => text.includes('return [];'))).toBe(true);
+    expect(texts.some((text) => text.includes('items.splice(0)'))).toBe(false);
+    expect(result).toMatchObject({ indexedFiles: 1, errors: [] });
+    expect(await index.search('input', { mode: 'keyword' })).toHaveLength(0);
+    const [hit] = await index.search('drainQueue', { mode: 'keyword', limit: 1 });
+    expect(hit).toMatchObject({ filePath: 'src/queue.ts', startLine: 3 });
+  });
+
+  it('SHOULD embed unchanged chunks again WHEN forced or the embed template changed', async () => {
+    const embedder = new NoopEmbedder(8);
+    const embed = vi.spyOn(embedder, 'embed');
+    await index.close();
+    index = await openIndex({ embedder });
+    await index.addPath('src/queue.ts');
+    embed.mockClear();
+    const embeddedTexts = () => embed.mock.calls.flatMap(([batch]) => batch);
+
+    await index.addPath('src/queue.ts', { force: true });
+    expect(embeddedTexts()).not.toHaveLength(0);
+    embed.mockClear();
+
+    await index.close();
+    index = await openIndex({ embedder, embedTemplate: '{lang} {body}' });
+    writeFile(root, 'src/queue.ts', 'export function parseQueue(input: string) {\n  return input.split(",");\n}\n\n');
+    await index.addPath('src/queue.ts');
+    expect(embeddedTexts().some((text) => text.startsWith('typescript ') && text.includes('input.split'))).toBe(true);
+    expect(sink.warn).toHaveBeenCalledWith(
+      expect.stringMatching(/another embedder or embed template/),
+      expect.objectContaining({ current: { embedder: 'noop', template: '{lang} {body}' } })
+    );
+  });
+
+  it('SHOULD index a git ref under its commit SHA without touching the working tree', async () => {
+    const git = (...args: string[]) => execFileSync('git', args, { cwd: root }).toString().trim();
+    git('init', '-q');
+    git('config', 'user.email', 'test@example.com');
+    git('config', 'user.name', 'Test');
+    git('add', '.');
+    git('commit', '-qm', 'v1');
+    git('tag', 'v1');
+    writeFile(root, 'src/queue.ts', 'export function drainQueue() {\n  return [];\n}\n');
+
+    const result = await index.addRef('v1');
+
+    expect(result).toMatchObject({ commit: git('rev-parse', 'v1'), indexedFiles: 3, errors: [] });
+    expect((await index.search('parseQueue', { mode: 'keyword' }))[0]?.filePath).toBe('src/queue.ts');
+    expect(await index.search('drainQueue', { mode: 'keyword' })).toHaveLength(0);
+    expect(git('status', '--porcelain')).toBe('M src/queue.ts');
+    await expect(index.addRef('v2')).rejects.toThrow('Git ref "v2" does not name a commit');
+  });
+
+  it('SHOULD record the last commit of each chunk and sort or filter hits by it WHEN blame is enabled', async () => {
+    const git = (...args: string[]) => execFileSync('git', args, { cwd: root }).toString().trim();
+    const commitAt = (date: string, message: string) =>
+      execFileSync('git', ['commit', '-qm', message], { cwd: root, env: { ...process.env, GIT_AUTHOR_DATE: date } });
+    git('init', '-q');
+    git('config', 'user.email', 'test@example.com');
+    git('config', 'user.name', 'Test');
+    git('add', 'src/queue.ts');
+    commitAt('2024-01-01T00:00:00Z', 'queue');
+    writeFile(
+      root,
+      'src/queue_helpers.ts',
+      'export function queueSize(queue: string[]) {\n  return queue.length;\n}\n'
+    );
+    git('add', 'src/queue_helpers.ts');
+    commitAt('2024-06-01T00:00:00Z', 'helpers');
+    await index.close();
+    index = await openIndex({ includeBlame: true });
+    await index.addPath('src');
+
+    const hits = await index.search('queue', { mode: 'keyword', sort: 'recency' });
+    const recent = await index.search('queue', { mode: 'keyword', changedSince: '2024-03-01' });
+
+    expect([...new Set(hits.map((hit) => hit.filePath))]).toEqual(['src/queue_helpers.ts', 'src/queue.ts']);
+    expect(hits[hits.length - 1].blame).toEqual({
+      commit: git('rev-parse', 'HEAD~1'),
+      author: 'Test',
+      date: '2024-01-01T00:00:00.000Z',
+    });
+    expect(new Set(recent.map((hit) => hit.filePath))).toEqual(new Set(['src/queue_helpers.ts']));
+  });
+
+  it('SHOULD delete the files under a path or matching a glob and report the removed chunks', async () => {
+    await index.addPath('.');
+
+    expect(await index.deletePath('src/queue')).toMatchObject({ deletedFiles: 0, deletedChunks: 0 });
+    expect(await index.deletePath('**/*.py')).toMatchObject({ deletedFiles: 1 });
+    expect(await index.search('slugify', { mode: 'keyword' })).toHaveLength(0);
+    const removed = await index.deletePath('src/');
+
+    expect(removed).toMatchObject({ deletedFiles: 1 });
+    expect(removed.deletedChunks).toBeGreaterThan(0);
+    expect(await index.search('parseQueue', { mode: 'keyword' })).toHaveLength(0);
+    expect((await index.search('build', { mode: 'keyword' }))[0]?.filePath).toBe('scripts/build.ts');
+    await expect(index.deletePath('.')).rejects.toThrow(/whole repository/);
+  });
+
+  it('SHOULD drop chunks of rewritten code WHEN a path is reindexed', async () => {
+    await index.addPath('src');
+    writeFile(root, 'src/queue.ts', 'export function drainQueue() {\n  return [];\n}\n');
+
+    const result = await index.reindexPath('src');
+
+    expect(result.removed).toMatchObject({ deletedFiles: 2 });
+    expect(result).toMatchObject({ indexedFiles: 2, unchangedFiles: 0, errors: [] });
+    expect(await index.search('parseQueue', { mode: 'keyword' })).toHaveLength(0);
+    expect((await index.search('drainQueue', { mode: 'keyword' }))[0]?.filePath).toBe('src/queue.ts');
+    await expect(index.reindexPath('src/missing')).rejects.toThrow(/does not exist/);
+  });
+
+  it('SHOULD keep the files of other workspaces WHEN two checkouts share an index', async () => {
+    const otherRoot = path.join(tmpDir, 'other');
+    writeFile(otherRoot, 'src/queue.ts', 'export function drainQueue() {\n  return [];\n}\n');
+    const other = await openIndex({ root: otherRoot });
+
+    try {
+      await index.addPath('src');
+      expect(await other.addPath('src')).toMatchObject({ indexedFiles: 1, deletedFiles: 0 });
+
+      expect((await index.search('parseQueue', { mode: 'keyword' }))[0]).toMatchObject({ filePath: 'src/queue.ts' });
+      expect(await index.search('drainQueue', { mode: 'keyword', filters: { workspace: 'repo' } })).toHaveLength(0);
+      expect(await index.search('drainQueue', { mode: 'keyword', filters: { workspace: 'other' } })).toHaveLength(1);
+      expect(await index.workspaces()).toEqual([
+        { workspace: 'other', files: 1, chunks: expect.any(Number) },
+        { workspace: 'repo', files: 2, chunks: expect.any(Number) },
+      ]);
+      expect(await other.deletePath('src/')).toMatchObject({ deletedFiles: 1 });
+      expect(await index.search('slugify', { mode: 'keyword' })).toHaveLength(1);
+    } finally {
+      await other.close();
+    }
+  });
+
+  it('SHOULD reuse vectors from the embedding cache unless embedCache is false', async () => {
+    await index.close();
+    const cachePath = path.join(tmpDir, 'cache', 'embeddings.db');
+    const embedder = new NoopEmbedder(8);
+    const embed = vi.spyOn(embedder, 'embed');
+    const store = (name: string) => new SqliteStore({ dbPath: path.join(tmpDir, 'store', `${name}.db`) });
+
+    await withTestEnv({ SCS_IDXR_EMBED_CACHE_PATH: cachePath }, async () => {
+      index = await openIndex({ embedder, embedCache: true });
+      await index.addPath('src');
+      await index.close();
+      expect(fs.existsSync(cachePath)).toBe(true);
+      const embedded = embed.mock.calls.flatMap(([texts]) => texts).length;
+      embed.mockClear();
+
+      index = await openIndex({ index: 'cached', store: store('cached'), embedder, embedCache: true });
+      await index.addPath('src');
+      expect(embed).not.toHaveBeenCalled();
+      await index.close();
+
+      index = await openIndex({ index: 'uncached', store: store('uncached'), embedder });
+      await index.addPath('src');
+      expect(embed.mock.calls.flatMap(([texts]) => texts)).toHaveLength(embedded);
+    });
+  });
+
+  it('SHOULD import an exported archive into a new index without embedding again', async () => {
+    await index.addPath('src');
+    const archive = path.join(tmpDir, 'lib.tar.gz');
+    const exported = await index.exportArchive(archive);
+    const embedder = new NoopEmbedder(8);
+    const embed = vi.spyOn(embedder, 'embed');
+    const imported = await openIndex({
+      index: 'imported',
+      store: new SqliteStore({ dbPath: path.join(tmpDir, 'store', 'imported.db') }),
+      embedder,
+    });
+
+    try {
+      expect(await imported.importArchive(archive)).toEqual(exported);
+      expect(exported).toMatchObject({ embedder: 'noop', dimensions: 8, locations: exported.chunks });
+      expect(embed).not.toHaveBeenCalled();
+      const [original] = await index.search('slugify text', { limit: 1 });
+      const [hit] = await imported.search('slugify text', { limit: 1 });
+      expect(hit).toEqual({ ...original, score: expect.closeTo(original.score, 6) });
+      expect(await imported.addPath('src')).toMatchObject({ indexedFiles: 0, unchangedFiles: 2 });
+      await expect(imported.importArchive(archive)).rejects.toThrow(/already holds/);
+    } finally {
+      await imported.close();
+    }
+  });
+
+  it('SHOULD index a single file', async () => {
+    expect(await index.addPath('scripts/build.ts')).toMatchObject({ indexedFiles: 1 });
+    expect((await index.search('build', { mode: 'keyword' }))[0]?.filePath).toBe('scripts/build.ts');
+  });
+
+  it('SHOULD skip files larger than maxFileBytes and report them in the errors', async () => {
+    await index.close();
+    writeFile(root, 'src/generated.ts', `export const table = [\n${'  1,\n'.repeat(100)}];\n`);
+    index = await openIndex({ maxFileBytes: 200 });
+
+    const result = await index.addPath('src');
+
+    expect(result).toMatchObject({ indexedFiles: 2 });
+    expect(result.errors).toEqual([
+      {
+        path: 'src/generated.ts',
+        error: expect.stringMatching(/^larger than maxFileBytes/),
+        fatal: true,
+        skipped: 'too-large',
+      },
+    ]);
+  });
+
+  it('SHOULD embed and store a file at most maxInFlightChunks chunks at a time', async () => {
+    await index.close();
+    const functions = Array.from({ length: 5 }, (_, i) => `export function step${i}() {\n  return ${i};\n}\n`);
+    writeFile(root, 'src/steps.ts', functions.join('\n'));
+    index = await openIndex({ maxInFlightChunks: 2 });
+    const embed = vi.spyOn(NoopEmbedder.prototype, 'embed');
+
+    const result = await index.addPath('src/steps.ts');
+
+    const batches = embed.mock.calls.map(([texts]) => texts.length);
+    expect(batches.length).toBeGreaterThan(1);
+    expect(Math.max(...batches)).toBeLessThanOrEqual(2);
+    expect(result.chunks).toBe(batches.reduce((total, size) => total + size, 0));
+    await expect(openIndex({ maxInFlightChunks: 0 })).rejects.toThrow(/Invalid maxInFlightChunks/);
+  });
+
+  it('SHOULD chunk each language with its chunkStrategy', async () => {
+    await index.close();
+    const functions = Array.from({ length: 3 }, (_, i) => `export function step${i}() {\n  return ${i};\n}\n`);
+    writeFile(root, 'src/steps.ts', functions.join('\n'));
+    index = await openIndex({ chunkStrategy: { typescript: 'whole-file' } });
+
+    const result = await index.addPath('src/steps.ts');
+
+    expect(result.chunks).toBe(1);
+    await expect(openIndex({ chunkStrategy: { typescript: 'sentences' as never } })).rejects.toThrow(
+      'Unknown chunk strategy "sentences" for typescript.'
+    );
+  });
+
+  it('SHOULD send log entries to the logger instead of the console', async () => {
+    const consoleSpy = vi.spyOn(console, 'log');
+
+    await index.addPath('src');
+
+    expect(sink.info).toHaveBeenCalledWith('Indexed path', expect.objectContaining({ path: 'src', indexedFiles: 2 }));
+    expect(consoleSpy).not.toHaveBeenCalled();
+  });
+
+  it('SHOULD fold near-duplicate files into one chunk listing both locations WHEN dedup is enabled', async () => {
+    await index.close();
+    index = await openIndex({ dedup: true });
+    const handler = (status: number) =>
+      [
+        'function normalizeRecords(records: Record[]) {',
+        '  const seen = new Set<string>();',
+        '  return records.filter((record) => {',
+        '    if (seen.has(record.id)) return false;',
+        '    seen.add(record.id);',
+        '    record.name = record.name.trim().toLowerCase();',
+        '    record.tags = record.tags.filter((tag) => tag.length > 0);',
+        `    return record.status === ${status};`,
+        '  });',
+        '}',
+        '',
+      ].join('\n');
+    writeFile(root, 'dup/a.ts', handler(200));
+    writeFile(root, 'dup/b.ts', handler(201));
+
+    await index.addPath('dup');
+
+    const [hit] = await index.search('normalizeRecords', { mode: 'keyword', limit: 1 });
+    expect(hit.symbol).toBe('normalizeRecords');
+    expect(hit.locations).toEqual([
+      { filePath: 'dup/a.ts', startLine: 1, endLine: 10 },
+      { filePath: 'dup/b.ts', startLine: 1, endLine: 10 },
+    ]);
+  });
+
+  it('SHOULD report progress with the file total known before chunks are embedded', async () => {
+    await index.close();
+    const events: ProgressEvent[] = [];
+    index = await openIndex({ progress: (event) => events.push(event) });
+
+    const result = await index.addPath('src');
+
+    expect(events[0]).toMatchObject({ phase: 'walking', filesTotal: 0 });
+    const firstEmbedding = events.findIndex((event) => event.phase === 'embedding');
+    expect(firstEmbedding).toBeGreaterThan(0);
+    expect(events.slice(firstEmbedding).every((event) => event.filesTotal === 2)).toBe(true);
+    expect(new Set(events.map((event) => event.phase))).toEqual(
+      new Set(['walking', 'parsing', 'embedding', 'storing'])
+    );
+    expect(events[events.length - 1]).toMatchObject({
+      filesDone: 2,
+      filesTotal: 2,
+      chunksTotal: result.chunks,
+      chunksEmbedded: result.chunks,
+    });
+  });
+
+  it('SHOULD run concurrent addPath calls one at a time', async () => {
+    const [first, second] = await Promise.all([index.addPath('src'), index.addPath('src')]);
+
+    expect(first.indexedFiles).toBe(2);
+    expect(second).toMatchObject({ indexedFiles: 0, unchangedFiles: 2 });
+  });
+
+  it('SHOULD reject paths outside the root and aborted runs', async () => {
+    await expect(index.addPath('..')).rejects.toThrow(/outside the index root/);
+
+    const controller = new AbortController();
+    controller.abort();
+    await expect(index.addPath('src', { signal: controller.signal })).rejects.toThrow();
+  });
+
+  it('SHOULD rescore the top candidates with the reranker only when asked', async () => {
+    await index.addPath('src');
+    await index.close();
+    const rerank = vi.fn(async (_query: string, candidates: SearchResult[]) =>
+      candidates.map((candidate) => (candidate.filePath === 'src/util.py' ? 1 : 0))
+    );
+    index = await openIndex({ reranker: { name: 'test', rerank } });
+
+    await index.search('parse the queue', { limit: 1 });
+    expect(rerank).not.toHaveBeenCalled();
+
+    const hits = await index.search('parse the queue', { limit: 1, rerank: true, rerankCandidates: 10 });
+    expect(rerank).toHaveBeenCalledTimes(1);
+    expect(rerank.mock.calls[0][1].length).toBeGreaterThan(1);
+    expect(hits).toHaveLength(1);
+    expect(hits[0]).toMatchObject({ filePath: 'src/util.py', score: 1, signals: ['semantic'] });
+  });
+
+  it('SHOULD refuse calls after close', async () => {
+    await index.close();
+
+    await expect(index.addPath('src')).rejects.toThrow(/closed/);
+    await expect(index.search('queue')).rejects.toThrow(/closed/);
+  });
+
+  it('SHOULD embed the text rendered by the embed template', async () => {
+    const embedder = new NoopEmbedder(8);
+    const embed = vi.spyOn(embedder, 'embed');
+    await index.close();
+    index = await openIndex({ embedder, embedTemplate: '{lang} {symbol}\n{body}' });
+
+    await index.addPath('src/util.py');
+
+    const texts = embed.mock.calls.flatMap(([batch]) => batch);
+    expect(texts).toContain('python slugify\ndef slugify(text):\n    return text.lower()');
+  });
+
+  it('SHOULD validate options', async () => {
+    await expect(createIndex({ index: '' })).rejects.toThrow(/non-empty/);
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'store', 'other.db') });
+    await expect(createIndex({ index: 'other', store, embedder: null, languages: ['cobol'] })).rejects.toThrow(
+      /Unknown languages: cobol/
+    );
+    await expect(
+      createIndex({ index: 'other', store, embedder: null, embedTemplate: '{lang} {nmae}\n{body}' })
+    ).rejects.toThrow('Unknown field "{nmae}" in embed template');
+    await expect(createIndex({ index: 'other', store, embedder: null, workspace: ' ' })).rejects.toThrow(
+      'Workspace name must be a non-empty string.'
+    );
+    await expect(createIndex({ index: 'other', store, embedder: null, maxFileBytes: 0 })).rejects.toThrow(
+      /Invalid maxFileBytes/
+    );
+    await expect(createIndex({ index: 'other', store, embedder: null, maxChunkTokens: -1 })).rejects.toThrow(
+      /Invalid maxChunkTokens/
+    );
+    await expect(index.search('queue', { limit: 0 })).rejects.toThrow(/Invalid limit/);
+    await expect(index.search('queue', { rerank: true, rerankCandidates: 0 })).rejects.toThrow(
+      /Invalid rerankCandidates/
+    );
+    await expect(index.search('queue', { sort: 'newest' as never })).rejects.toThrow(/Invalid sort/);
+    await expect(index.search('queue', { changedSince: 'yesterday' })).rejects.toThrow(/Invalid changedSince/);
+    await expect(index.search('queue', { overfetchFactor: 0.5 })).rejects.toThrow(/Invalid overfetchFactor/);
+    await expect(index.searchSimilar(' \n')).rejects.toThrow(/Invalid code/);
+    await expect(
+      index.searchSimilar('queue', { exclude: { filePath: 'src/queue.ts', startLine: 3, endLine: 2 } })
+    ).rejects.toThrow(/Invalid exclude lines/);
+    await withTestEnv({ SCS_IDXR_RERANKER: undefined }, () =>
+      expect(index.search('queue', { rerank: true })).rejects.toThrow(/Reranking needs a reranker/)
+    );
+  });
+});
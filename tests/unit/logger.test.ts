@@ -1,4 +1,4 @@
-import { createLogger, logger } from '../../src/utils/logger';
+import { createLogger, logger, setConsoleStatusLine, withLogSink } from '../../src/utils/logger';
 import { beforeEach, afterEach, describe, it, expect, vi } from 'vitest';
 import type { Mock } from 'vitest';
 
@@ -250,6 +250,65 @@ describe('Logger', () => {
     });
   });
 
+  describe('setConsoleStatusLine', () => {
+    beforeEach(() => {
+      process.env.NODE_ENV = 'production';
+      process.env.SCS_IDXR_OTEL_LOGGING_ENABLED = 'false';
+    });
+
+    it('keeps the status line below log entries until it is removed', () => {
+      const writes: string[] = [];
+      vi.spyOn(process.stdout, 'write').mockImplementation((chunk) => {
+        writes.push(String(chunk));
+        return true;
+      });
+      consoleLogSpy.mockImplementation((message: string) => writes.push(`${message}\n`));
+
+      setConsoleStatusLine('parsing 50%');
+      logger.info('entry');
+      setConsoleStatusLine(undefined);
+      logger.info('after');
+
+      expect(writes).toEqual([
+        'parsing 50%',
+        '\r\x1b[2K',
+        expect.stringContaining('entry'),
+        'parsing 50%',
+        '\r\x1b[2K',
+        expect.stringContaining('after'),
+      ]);
+    });
+  });
+
+  describe('withLogSink', () => {
+    beforeEach(() => {
+      process.env.NODE_ENV = 'production';
+      process.env.SCS_IDXR_OTEL_LOGGING_ENABLED = 'false';
+    });
+
+    it('sends entries to the sink instead of the console, also from async work', async () => {
+      const sink = { debug: vi.fn(), info: vi.fn(), warn: vi.fn(), error: vi.fn() };
+
+      await withLogSink(sink, async () => {
+        logger.info('before');
+        await new Promise((resolve) => setTimeout(resolve, 0));
+        createLogger({ name: 'repo', branch: 'main' }).warn('after', { count: 1 });
+      });
+
+      expect(sink.info).toHaveBeenCalledWith('before', {});
+      expect(sink.warn).toHaveBeenCalledWith('after', { count: 1 });
+      expect(consoleLogSpy).not.toHaveBeenCalled();
+    });
+
+    it('drops entries without a sink and restores the console afterwards', () => {
+      withLogSink(undefined, () => logger.error('dropped'));
+      expect(consoleLogSpy).not.toHaveBeenCalled();
+
+      logger.info('printed');
+      expect(consoleLogSpy).toHaveBeenCalledTimes(1);
+    });
+  });
+
   describe('API compatibility', () => {
     it('exposes an info method', () => {
       expect(logger.info).toBeDefined();
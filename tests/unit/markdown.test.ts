@@ -0,0 +1,65 @@
+import { describe, it, expect } from 'vitest';
+
+import { parseMarkdownDocument } from '../../src/utils/markdown';
+
+const headingPaths = (content: string) =>
+  parseMarkdownDocument(content).sections.map((section) => section.headingPath.join(' > '));
+
+describe('parseMarkdownDocument', () => {
+  it('should nest headings by level and pop back to the parent level', () => {
+    const content = ['# A', '## B', '### C', '## D', '# E', '### F'].join('\n\n');
+
+    expect(headingPaths(content)).toEqual(['A', 'A > B', 'A > B > C', 'A > D', 'E', 'E > F']);
+  });
+
+  it('should recognize setext headings under a one-line paragraph', () => {
+    const content = 'Title\n=====\n\nText\n\nPart\n----\n\nMore text.\n\nNot a heading\nbecause of two lines\n---\n';
+
+    expect(headingPaths(content)).toEqual(['Title', 'Title > Part']);
+  });
+
+  it('should not treat a thematic break or list item as a setext heading', () => {
+    expect(headingPaths('Intro\n\n---\n\n- item\n---\n')).toEqual(['']);
+  });
+
+  it('should ignore headings inside code fences and record fence languages', () => {
+    const { sections } = parseMarkdownDocument('# Setup\n\n~~~{.python}\n# comment\n~~~\n\n````\n```\n# x\n````\n');
+
+    expect(sections).toEqual([
+      { headingPath: ['Setup'], startLine: 0, endLine: 9, codeFences: [{ language: 'python', line: 2 }] },
+    ]);
+  });
+
+  it('should strip closing hashes and skip empty headings', () => {
+    expect(headingPaths('intro\n\n## Title ##\n\n#\n\n# C#\n')).toEqual(['', 'Title', 'C#']);
+  });
+
+  it('should keep text before the first heading without leading blank lines', () => {
+    const { sections } = parseMarkdownDocument('\n\nIntro.\n\n# A\nBody\n');
+
+    expect(sections).toEqual([
+      { headingPath: [], startLine: 2, endLine: 2, codeFences: [] },
+      { headingPath: ['A'], startLine: 4, endLine: 5, codeFences: [] },
+    ]);
+  });
+
+  describe('front matter', () => {
+    it('should parse a leading YAML mapping and start the body after it', () => {
+      const document = parseMarkdownDocument('---\ntitle: Design\nversion: 2\n---\n# Intro\n');
+
+      expect(document.frontMatter).toEqual({ title: 'Design', version: 2 });
+      expect(document.sections[0].startLine).toBe(4);
+    });
+
+    it('should leave a block that is not a YAML mapping in the document', () => {
+      expect(parseMarkdownDocument('---\n: not [yaml\n---\ntext\n')).toEqual({
+        sections: [{ headingPath: [], startLine: 0, endLine: 3, codeFences: [] }],
+      });
+      expect(parseMarkdownDocument('---\n- a list\n---\n').frontMatter).toBeUndefined();
+    });
+
+    it('should only treat a block at the very start as front matter', () => {
+      expect(parseMarkdownDocument('text\n---\ntitle: x\n---\n').frontMatter).toBeUndefined();
+    });
+  });
+});
@@ -1,9 +1,10 @@
-import { LanguageParser } from '../../src/utils/parser';
-import { CodeChunk } from '../../src/utils/elasticsearch';
+import { LanguageParser, getGoImportName } from '../../src/utils/parser';
+import { languageConfigurations } from '../../src/languages';
+import { CodeChunk, getChunkDocumentId } from '../../src/utils/elasticsearch';
 import path from 'path';
 import fs from 'fs';
 import os from 'os';
-import { describe, it, expect, beforeAll } from 'vitest';
+import { describe, it, expect, beforeAll, afterAll } from 'vitest';
 import { withTestEnv } from './utils/test_env';
 
 const MOCK_TIMESTAMP = '[TIMESTAMP]';
@@ -76,15 +77,25 @@ describe('LanguageParser', () => {
   });
 
   describe('Configurable Markdown Delimiter', () => {
-    it('should parse Markdown with default paragraph delimiter', () => {
+    it('should parse Markdown by headings when no delimiter is set', () => {
       const filePath = path.resolve(__dirname, '../fixtures/markdown.md');
       const result = parser.parseFile(filePath, 'main', 'tests/fixtures/markdown.md');
 
-      // Should create 4 chunks with paragraph-based splitting
-      expect(result.chunks.length).toBe(4);
+      expect(result.chunks.length).toBe(2);
       expect(result.metrics.parserType).toBe('markdown');
     });
 
+    it('should parse Markdown with paragraph delimiter', () =>
+      withTestEnv({ SCS_IDXR_MARKDOWN_CHUNK_DELIMITER: '\\n\\s*\\n' }, () => {
+        const filePath = path.resolve(__dirname, '../fixtures/markdown.md');
+        const result = parser.parseFile(filePath, 'main', 'tests/fixtures/markdown.md');
+
+        // Should create 4 chunks with paragraph-based splitting
+        expect(result.chunks.length).toBe(4);
+        expect(result.chunks[3].startLine).toBe(7);
+        expect(result.chunks[3].endLine).toBe(8); // Includes the newline
+      }));
+
     it('should parse Markdown with section delimiter (---)', () =>
       withTestEnv({ SCS_IDXR_MARKDOWN_CHUNK_DELIMITER: '\\n---\\n' }, () => {
         const filePath = path.resolve(__dirname, '../fixtures/markdown_sections.md');
@@ -172,6 +183,50 @@ Content 2`;
       }));
   });
 
+  describe('Markdown Sections', () => {
+    const parseDesignDoc = () => {
+      const filePath = path.resolve(__dirname, '../fixtures/markdown_design.md');
+      return parser.parseFile(filePath, 'main', 'tests/fixtures/markdown_design.md').chunks;
+    };
+
+    it('should record the heading path of each section as its symbol name', () => {
+      const chunks = parseDesignDoc();
+
+      expect(chunks.map((chunk) => chunk.symbols?.[0]?.name)).toEqual([
+        'Architecture',
+        'Architecture > Storage',
+        'Architecture > Storage > Indexing',
+        'Operations',
+      ]);
+      expect(chunks.every((chunk) => chunk.kind === 'section')).toBe(true);
+      expect(chunks[2].containerPath).toBe('Architecture > Storage');
+      expect(chunks[2].semantic_text).toContain('containerPath: Architecture > Storage');
+      expect(chunks[2]).toMatchObject({ startLine: 21, endLine: 23 });
+    });
+
+    it('should keep code fences in the section and tag their language', () => {
+      const storage = parseDesignDoc()[1];
+
+      expect(storage.content).toContain('```sql\n-- # not a heading\nSELECT id FROM chunks');
+      expect(storage.symbols).toContainEqual({ name: 'sql', kind: 'code.language', line: 16 });
+    });
+
+    it('should parse front matter into metadata instead of embedding it', () => {
+      const chunks = parseDesignDoc();
+
+      chunks.forEach((chunk) => {
+        expect(chunk.frontMatter).toEqual({
+          title: 'Indexer design',
+          status: 'accepted',
+          date: '2024-05-01',
+          tags: ['storage', 'search'],
+        });
+        expect(chunk.content).not.toContain('status: accepted');
+      });
+      expect(chunks[0].startLine).toBe(8);
+    });
+  });
+
   it('should parse YAML fixtures correctly', () => {
     const filePath = path.resolve(__dirname, '../fixtures/yaml.yml');
     const result = parser.parseFile(filePath, 'main', 'tests/fixtures/yaml.yml');
@@ -716,21 +771,13 @@ Line 18`;
       const filePath = path.resolve(__dirname, '../fixtures/markdown.md');
       const result = parser.parseFile(filePath, 'main', 'tests/fixtures/markdown.md');
 
-      // First chunk should start at line 1 (heading)
+      // First section: the heading on line 1 through its paragraph on line 3
       expect(result.chunks[0].startLine).toBe(1);
-      expect(result.chunks[0].endLine).toBe(1);
-
-      // Second chunk should start at line 3 (paragraph after empty line)
-      expect(result.chunks[1].startLine).toBe(3);
-      expect(result.chunks[1].endLine).toBe(3);
+      expect(result.chunks[0].endLine).toBe(3);
 
-      // Third chunk should start at line 5 (heading)
-      expect(result.chunks[2].startLine).toBe(5);
-      expect(result.chunks[2].endLine).toBe(5);
-
-      // Fourth chunk should start at line 7 (paragraph)
-      expect(result.chunks[3].startLine).toBe(7);
-      expect(result.chunks[3].endLine).toBe(8); // Includes the newline
+      // Second section starts at the heading on line 5; the trailing newline is not part of it
+      expect(result.chunks[1].startLine).toBe(5);
+      expect(result.chunks[1].endLine).toBe(7);
     });
 
     it('should calculate correct line numbers for YAML multi-document files', () => {
@@ -834,6 +881,333 @@ Third paragraph`;
     });
   });
 
+  describe('Python Definitions', () => {
+    const parsePythonDefinitions = () => {
+      const filePath = path.resolve(__dirname, '../fixtures/python_definitions.py');
+      return parser.parseFile(filePath, 'main', 'tests/fixtures/python_definitions.py').chunks;
+    };
+
+    const findChunk = (chunks: CodeChunk[], kind: string, contentStart: string) =>
+      chunks.find((chunk) => chunk.kind === kind && chunk.content.startsWith(contentStart));
+
+    it('should set the enclosing class as containerPath for methods', () => {
+      const chunks = parsePythonDefinitions();
+
+      const method = findChunk(chunks, 'function_definition', 'async def fetch');
+      expect(method?.containerPath).toBe('Service');
+      expect(method?.semantic_text).toContain('containerPath: Service');
+
+      const classChunk = findChunk(chunks, 'class_definition', 'class Service');
+      expect(classChunk?.containerPath).toBe('');
+    });
+
+    it('should include decorators in the chunk text of decorated definitions', () => {
+      const chunks = parsePythonDefinitions();
+
+      const property = findChunk(chunks, 'decorated_definition', '@property');
+      expect(property?.content).toContain('def name(self):');
+      expect(property?.containerPath).toBe('Service');
+
+      const staticMethod = findChunk(chunks, 'decorated_definition', '@staticmethod');
+      expect(staticMethod?.content).toContain('def create():');
+
+      const cached = findChunk(chunks, 'decorated_definition', '@functools.lru_cache');
+      expect(cached?.containerPath).toBe('');
+      expect(cached?.startLine).toBe(22);
+      expect(cached?.endLine).toBe(24);
+    });
+
+    it('should emit each decorated definition once, with its decorators', () => {
+      const chunks = parsePythonDefinitions();
+
+      for (const definition of ['def name(self):', 'def create():', 'def cached_lookup(key):']) {
+        const definitionChunks = chunks.filter(
+          (chunk) => chunk.kind !== 'class_definition' && chunk.content.includes(definition)
+        );
+        expect(definitionChunks.map((chunk) => chunk.kind)).toEqual(['decorated_definition']);
+      }
+      const cached = findChunk(chunks, 'decorated_definition', '@functools.lru_cache');
+      expect(cached?.exports).toEqual([expect.objectContaining({ name: 'cached_lookup', type: 'named' })]);
+    });
+
+    it('should handle async functions', () => {
+      const chunks = parsePythonDefinitions();
+
+      const run = findChunk(chunks, 'function_definition', 'async def run');
+      expect(run).toBeDefined();
+      expect(run?.containerPath).toBe('');
+    });
+
+    it('should emit nested functions as their own chunks', () => {
+      const chunks = parsePythonDefinitions();
+
+      const nested = findChunk(chunks, 'function_definition', 'def build_headers');
+      expect(nested?.containerPath).toBe('Service.fetch');
+      expect(nested?.startLine).toBe(16);
+      expect(nested?.endLine).toBe(17);
+    });
+
+    it('should export decorated top-level definitions and module-level constants', () => {
+      const chunks = parsePythonDefinitions();
+      const allExports = chunks.flatMap((chunk) => chunk.exports || []);
+
+      expect(allExports).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ name: 'Service', type: 'named' }),
+          expect.objectContaining({ name: 'cached_lookup', type: 'named' }),
+          expect.objectContaining({ name: 'run', type: 'named' }),
+          expect.objectContaining({ name: 'MAX_RETRIES', type: 'named' }),
+        ])
+      );
+      expect(allExports).not.toEqual(expect.arrayContaining([expect.objectContaining({ name: 'name' })]));
+      expect(allExports).not.toEqual(expect.arrayContaining([expect.objectContaining({ name: 'build_headers' })]));
+    });
+  });
+
+  describe('Rust Definitions', () => {
+    const parseRustFixture = () => {
+      const filePath = path.resolve(__dirname, '../fixtures/rust.rs');
+      return new LanguageParser('rust').parseFile(filePath, 'main', 'tests/fixtures/rust.rs').chunks;
+    };
+
+    const findChunk = (chunks: CodeChunk[], kind: string, text: string) =>
+      chunks.find((chunk) => chunk.kind === kind && chunk.content.includes(text));
+
+    it('should set the impl type as containerPath for methods', () => {
+      const chunks = parseRustFixture();
+
+      const method = findChunk(chunks, 'function_item', 'fn bump');
+      expect(method?.containerPath).toBe('Counter');
+      expect(method?.semantic_text).toContain('containerPath: Counter');
+      expect(findChunk(chunks, 'function_item', 'fn helper')?.containerPath).toBe('');
+    });
+
+    it('should note the implemented trait in the containerPath of trait methods', () => {
+      const chunks = parseRustFixture();
+
+      expect(findChunk(chunks, 'function_item', 'fn fmt')?.containerPath).toBe('<Counter as fmt::Display>');
+      expect(chunks.flatMap((chunk) => chunk.symbols)).toEqual(
+        expect.arrayContaining([expect.objectContaining({ name: 'fmt::Display', kind: 'trait.implementation' })])
+      );
+    });
+
+    it('should include doc comments and attributes in the chunk of the item below them', () => {
+      const chunks = parseRustFixture();
+
+      const struct = findChunk(chunks, 'struct_item', 'pub struct Counter');
+      expect(struct?.content.startsWith('/// A named counter.\n#[derive(Debug, Clone)]\npub struct Counter')).toBe(
+        true
+      );
+      expect(struct?.startLine).toBe(4);
+
+      const method = findChunk(chunks, 'function_item', 'pub fn new');
+      expect(method?.content.startsWith('/// Creates an empty counter.')).toBe(true);
+      expect(chunks.some((chunk) => chunk.kind === 'line_comment' && chunk.content.startsWith('///'))).toBe(false);
+      expect(chunks.some((chunk) => chunk.content === '// Not a doc comment.')).toBe(true);
+    });
+
+    it('should record macros and pub items', () => {
+      const chunks = parseRustFixture();
+
+      expect(findChunk(chunks, 'macro_definition', 'macro_rules! square')).toBeDefined();
+      expect(chunks.flatMap((chunk) => chunk.symbols)).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ name: 'square', kind: 'macro.name' }),
+          expect.objectContaining({ name: 'new', kind: 'method.name' }),
+          expect.objectContaining({ name: 'helper', kind: 'function.name' }),
+        ])
+      );
+
+      const exportNames = chunks.flatMap((chunk) => (chunk.exports ?? []).map((exp) => exp.name));
+      expect(exportNames).toEqual(expect.arrayContaining(['Counter', 'Level', 'Describe', 'new']));
+      expect(exportNames).not.toContain('helper');
+      expect(exportNames).not.toContain('bump');
+    });
+
+    it('should extract use declarations as imports', () => {
+      const imports = parseRustFixture().flatMap((chunk) => chunk.imports ?? []);
+      expect(imports).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ path: 'std::collections::HashMap' }),
+          expect.objectContaining({ path: 'std::fmt' }),
+        ])
+      );
+    });
+  });
+
+  describe('C and C++ Definitions', () => {
+    const parseFixture = (language: string, fixture: string) => {
+      const filePath = path.resolve(__dirname, `../fixtures/${fixture}`);
+      return new LanguageParser(language).parseFile(filePath, 'main', `tests/fixtures/${fixture}`).chunks;
+    };
+
+    const findChunk = (chunks: CodeChunk[], kind: string, text: string) =>
+      chunks.find((chunk) => chunk.kind === kind && chunk.content.includes(text));
+
+    it('should set namespaces and classes as containerPath, including the scope of out-of-line methods', () => {
+      const chunks = parseFixture('cpp', 'cpp_definitions.hpp');
+
+      expect(findChunk(chunks, 'class_specifier', 'class Socket')?.containerPath).toBe('net');
+      const method = findChunk(chunks, 'function_definition', 'bool net::Socket::open');
+      expect(method?.containerPath).toBe('net::Socket');
+      expect(method?.semantic_text).toContain('containerPath: net::Socket');
+      expect(method?.symbols).toEqual([expect.objectContaining({ name: 'open', kind: 'function.name' })]);
+    });
+
+    it('should record declarations separately from definitions', () => {
+      const symbols = parseFixture('cpp', 'cpp_definitions.hpp').flatMap((chunk) => chunk.symbols);
+
+      expect(symbols).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ name: 'open', kind: 'method.declaration' }),
+          expect.objectContaining({ name: 'close', kind: 'method.declaration' }),
+          expect.objectContaining({ name: 'connect_all', kind: 'function.declaration' }),
+        ])
+      );
+      expect(symbols).not.toEqual(
+        expect.arrayContaining([expect.objectContaining({ name: 'connect_all', kind: 'function.name' })])
+      );
+    });
+
+    it('should include doc comments in the chunk of the declaration below them', () => {
+      const chunks = parseFixture('cpp', 'cpp_definitions.hpp');
+
+      const classChunk = findChunk(chunks, 'class_specifier', 'class Socket');
+      expect(classChunk?.content.startsWith('/// A TCP connection.\nclass Socket')).toBe(true);
+      expect(classChunk?.startLine).toBe(5);
+      expect(chunks.some((chunk) => chunk.kind === 'comment' && chunk.content.startsWith('///'))).toBe(false);
+      expect(chunks.some((chunk) => chunk.content.startsWith('// Not a doc comment.'))).toBe(true);
+    });
+
+    it('should parse around preprocessor conditionals that split a declaration', () => {
+      const chunks = parseFixture('c', 'c_preprocessor.h');
+
+      const write = findChunk(chunks, 'function_definition', 'int buffer_write');
+      expect(write?.startLine).toBe(16);
+      expect(write?.endLine).toBe(21);
+      // The content is the original source, with every branch of the conditional
+      expect(write?.content).toContain('#else\nint buffer_write(char *buffer, const char *text) {');
+
+      const alloc = findChunk(chunks, 'declaration', 'char *buffer_alloc');
+      expect(alloc?.content.startsWith('/** Allocates a buffer of `size` bytes. */\n')).toBe(true);
+      expect(chunks.flatMap((chunk) => chunk.symbols)).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ name: 'buffer_alloc', kind: 'function.declaration' }),
+          expect.objectContaining({ name: 'buffer_free', kind: 'function.declaration' }),
+          expect.objectContaining({ name: 'buffer_write', kind: 'function.name' }),
+        ])
+      );
+    });
+  });
+
+  describe('Java and Kotlin Definitions', () => {
+    const parseFixture = (language: string, fixture: string) => {
+      const filePath = path.resolve(__dirname, `../fixtures/${fixture}`);
+      return new LanguageParser(language).parseFile(filePath, 'main', `tests/fixtures/${fixture}`).chunks;
+    };
+
+    const findChunk = (chunks: CodeChunk[], kind: string, text: string) =>
+      chunks.find((chunk) => chunk.kind === kind && chunk.content.includes(text));
+
+    it('should qualify Java members with their package and enclosing types', () => {
+      const chunks = parseFixture('java', 'java_definitions.java');
+
+      expect(findChunk(chunks, 'class_declaration', 'class InvoiceService')?.containerPath).toBe('com.acme.billing');
+      const total = findChunk(chunks, 'method_declaration', 'int total()');
+      expect(total?.containerPath).toBe('com.acme.billing.InvoiceService');
+      expect(total?.semantic_text).toContain('containerPath: com.acme.billing.InvoiceService');
+      expect(findChunk(chunks, 'method_declaration', 'boolean isFinal()')?.containerPath).toBe(
+        'com.acme.billing.InvoiceService.Status'
+      );
+      expect(findChunk(chunks, 'field_declaration', 'List<String> lines')).toBeDefined();
+      expect(findChunk(chunks, 'constructor_declaration', 'public InvoiceService(')).toBeDefined();
+      expect(findChunk(chunks, 'interface_declaration', 'interface Repository')).toBeDefined();
+      expect(findChunk(chunks, 'enum_declaration', 'enum Status')).toBeDefined();
+    });
+
+    it('should include Javadoc and annotations in the chunk of the declaration below them', () => {
+      const chunks = parseFixture('java', 'java_definitions.java');
+
+      const classChunk = findChunk(chunks, 'class_declaration', 'class InvoiceService');
+      expect(classChunk?.content).toMatch(/^\/\*\*\n \* Computes invoice totals\.\n \*\/\n@Service\npublic class/);
+      expect(classChunk?.startLine).toBe(5);
+      expect(classChunk?.exports).toEqual([{ name: 'InvoiceService', type: 'named' }]);
+
+      const total = findChunk(chunks, 'method_declaration', 'int total()');
+      expect(total?.content.startsWith('/** Sums the invoice lines. */\n    @Override\n    public int total()')).toBe(
+        true
+      );
+      expect(total?.exports).toEqual([{ name: 'total', type: 'named' }]);
+      expect(chunks.some((chunk) => chunk.kind === 'block_comment' && chunk.content.startsWith('/**'))).toBe(false);
+    });
+
+    it('should qualify Kotlin members with their package, classes, and companion objects', () => {
+      const chunks = parseFixture('kotlin', 'kotlin.kt');
+
+      expect(findChunk(chunks, 'function_declaration', 'fun total')?.containerPath).toBe(
+        'com.acme.billing.InvoiceService'
+      );
+      expect(findChunk(chunks, 'function_declaration', 'fun create')?.containerPath).toBe(
+        'com.acme.billing.InvoiceService.Companion'
+      );
+      expect(findChunk(chunks, 'function_declaration', 'fun format')?.containerPath).toBe('com.acme.billing.Formatter');
+      expect(chunks.flatMap((chunk) => chunk.symbols)).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ name: 'InvoiceLine', kind: 'class.name' }),
+          expect.objectContaining({ name: 'amount', kind: 'field.name' }),
+          expect.objectContaining({ name: 'Repository', kind: 'interface.name' }),
+          expect.objectContaining({ name: 'Formatter', kind: 'object.name' }),
+          expect.objectContaining({ name: 'total', kind: 'method.name' }),
+          expect.objectContaining({ name: 'shout', kind: 'function.name' }),
+        ])
+      );
+    });
+
+    it('should record the receiver type of Kotlin extension functions', () => {
+      const chunks = parseFixture('kotlin', 'kotlin.kt');
+
+      const shout = findChunk(chunks, 'function_declaration', 'fun String.shout');
+      expect(shout?.containerPath).toBe('com.acme.billing');
+      expect(shout?.symbols).toEqual(
+        expect.arrayContaining([expect.objectContaining({ name: 'String', kind: 'extension.receiver' })])
+      );
+      expect(findChunk(chunks, 'function_declaration', 'fun total')?.symbols).not.toEqual(
+        expect.arrayContaining([expect.objectContaining({ kind: 'extension.receiver' })])
+      );
+    });
+
+    it('should include KDoc and annotations in the chunk of the Kotlin declaration below them', () => {
+      const chunks = parseFixture('kotlin', 'kotlin.kt');
+
+      const line = findChunk(chunks, 'class_declaration', 'data class InvoiceLine');
+      expect(line?.content.startsWith('/**\n * A line of an invoice.\n */\ndata class InvoiceLine')).toBe(true);
+      expect(line?.startLine).toBe(5);
+      expect(findChunk(chunks, 'class_declaration', 'class InvoiceService')?.content.startsWith('@Service\n')).toBe(
+        true
+      );
+      expect(findChunk(chunks, 'function_declaration', 'fun total')?.content).toMatch(/^\/\*\* Sums the invoice lines/);
+      expect(chunks.some((chunk) => chunk.content === '// Not a doc comment.')).toBe(true);
+    });
+
+    it('should record public top-level Kotlin declarations as exports', () => {
+      const exportNames = parseFixture('kotlin', 'kotlin.kt').flatMap((chunk) =>
+        (chunk.exports ?? []).map((exp) => exp.name)
+      );
+
+      expect(exportNames).toEqual(
+        expect.arrayContaining(['InvoiceLine', 'InvoiceService', 'Repository', 'Formatter', 'shout'])
+      );
+      expect(exportNames).not.toContain('helper');
+      expect(exportNames).not.toContain('total');
+    });
+
+    it('should extract Kotlin imports', () => {
+      const imports = parseFixture('kotlin', 'kotlin.kt').flatMap((chunk) => chunk.imports ?? []);
+
+      expect(imports).toEqual([{ path: 'kotlin.math.max', type: 'module', symbols: ['max'] }]);
+    });
+  });
+
   describe('Export Detection', () => {
     it('should extract TypeScript exports correctly', () => {
       const filePath = path.resolve(__dirname, '../fixtures/typescript.ts');
@@ -1048,4 +1422,555 @@ Third paragraph`;
       );
     });
   });
+
+  describe('JSX and TSX', () => {
+    const tsxPath = path.resolve(__dirname, '../fixtures/tsx_components.tsx');
+    const parseTsx = () => parser.parseFile(tsxPath, 'main', 'tests/fixtures/tsx_components.tsx');
+
+    it('should capture TSX components with their JSX body', () => {
+      const result = parseTsx();
+
+      const button = result.chunks.find(
+        (chunk) => chunk.kind === 'lexical_declaration' && chunk.content.startsWith('const Button')
+      );
+      expect(button?.content).toContain('return <button className="btn">{label}</button>;');
+      expect(button?.exports).toEqual([{ name: 'Button', type: 'named' }]);
+    });
+
+    it('should extract interfaces, type aliases, and methods as separate chunks', () => {
+      const result = parseTsx();
+
+      expect(result.chunks).toEqual(
+        expect.arrayContaining([
+          expect.objectContaining({ kind: 'interface_declaration', startLine: 3, endLine: 5 }),
+          expect.objectContaining({ kind: 'type_alias_declaration', startLine: 7, endLine: 7 }),
+          expect.objectContaining({ kind: 'method_definition', containerPath: 'Counter', startLine: 16, endLine: 18 }),
+        ])
+      );
+    });
+
+    it('should split multiple function assignments on one line into separate chunks', () => {
+      const result = parseTsx();
+
+      const declarators = result.chunks.filter((chunk) => chunk.kind === 'variable_declarator');
+      expect(declarators.map((chunk) => chunk.content)).toEqual([
+        'add = (a: number, b: number) => { return a + b; }',
+        'subtract = (a: number, b: number) => { return a - b; }',
+      ]);
+      expect(declarators.map((chunk) => chunk.exports)).toEqual([
+        [{ name: 'add', type: 'named' }],
+        [{ name: 'subtract', type: 'named' }],
+      ]);
+    });
+
+    it('should record anonymous default exports', () => {
+      const tsxDefault = parseTsx().chunks.find(
+        (chunk) => chunk.kind === 'export_statement' && chunk.content.startsWith('export default function ()')
+      );
+      expect(tsxDefault?.exports).toEqual([{ name: 'default', type: 'default' }]);
+
+      const jsxPath = path.resolve(__dirname, '../fixtures/jsx_components.jsx');
+      const jsxResult = parser.parseFile(jsxPath, 'main', 'tests/fixtures/jsx_components.jsx');
+      const jsxDefault = jsxResult.chunks.find((chunk) => chunk.content.startsWith('export default () =>'));
+      expect(jsxDefault?.exports).toEqual([{ name: 'default', type: 'default' }]);
+      const header = jsxResult.chunks.find((chunk) => chunk.content.startsWith('const Header'));
+      expect(header?.content).toContain('<h1>{title}</h1>');
+    });
+  });
+
+  describe('Symbol Windowing', () => {
+    // 100 lines: the signature, 98 statements, and the closing brace
+    const longFunction = [
+      'function longFunction() {',
+      ...Array.from({ length: 98 }, (_, i) => `  const v${i + 1} = ${i + 1};`),
+      '}',
+    ].join('\n');
+
+    const parseLongFunction = (windowingParser: LanguageParser) => {
+      const tempFile = path.join(os.tmpdir(), `temp_long_function_${process.pid}_${Date.now()}.ts`);
+      fs.writeFileSync(tempFile, longFunction);
+      try {
+        return windowingParser
+          .parseFile(tempFile, 'main', 'src/long_function.ts')
+          .chunks.filter((chunk) => chunk.kind === 'function_declaration');
+      } finally {
+        fs.unlinkSync(tempFile);
+      }
+    };
+
+    it('should split oversized functions into overlapping windows', () => {
+      const windows = parseLongFunction(new LanguageParser('typescript', { maxLines: 40, overlapLines: 10 }));
+
+      expect(windows.map((chunk) => [chunk.startLine, chunk.endLine])).toEqual([
+        [1, 40],
+        [31, 70],
+        [61, 100],
+      ]);
+      windows.forEach((chunk) => expect(chunk.parentSymbol).toBe('longFunction'));
+      expect(windows[0].content.split('\n')).toHaveLength(40);
+    });
+
+    it('should prepend the signature line to every later window', () => {
+      const windows = parseLongFunction(new LanguageParser('typescript', { maxLines: 40, overlapLines: 10 }));
+
+      expect(windows[1].content.startsWith('function longFunction() {\n  const v30 = 30;')).toBe(true);
+      expect(windows[2].content.endsWith('  const v98 = 98;\n}')).toBe(true);
+      expect(windows[2].semantic_text).toContain('parentSymbol: longFunction');
+      expect(windows[0].header).toBeUndefined();
+      windows.slice(1).forEach((chunk) => expect(chunk.header).toBe('function longFunction() {'));
+    });
+
+    it('should keep functions within the limit as a single chunk', () => {
+      const [chunk] = parseLongFunction(new LanguageParser('typescript', { maxLines: 100, overlapLines: 10 }));
+
+      expect(chunk.content).toBe(longFunction);
+      expect(chunk.parentSymbol).toBeUndefined();
+    });
+
+    it('should read the limits from the environment when no options are given', () =>
+      withTestEnv({ SCS_IDXR_SYMBOL_CHUNK_MAX_LINES: '0' }, () => {
+        expect(parseLongFunction(new LanguageParser('typescript'))).toHaveLength(1);
+      }));
+  });
+
+  describe('Token Budget', () => {
+    const longFunction = [
+      'function longFunction() {',
+      ...Array.from({ length: 98 }, (_, i) => `  const v${i + 1} = ${i + 1};`),
+      '}',
+    ].join('\n');
+    const longLine = `const blob = '${'x'.repeat(400)}';`;
+
+    const parseSource = (source: string, budgetParser: LanguageParser, kind = 'function_declaration') => {
+      const tempFile = path.join(os.tmpdir(), `temp_token_budget_${process.pid}_${Date.now()}.ts`);
+      fs.writeFileSync(tempFile, source);
+      try {
+        return budgetParser
+          .parseFile(tempFile, 'main', 'src/token_budget.ts')
+          .chunks.filter((chunk) => chunk.kind === kind);
+      } finally {
+        fs.unlinkSync(tempFile);
+      }
+    };
+
+    it('should split chunks over the token budget into consecutive pieces', () => {
+      const chunks = parseSource(longFunction, new LanguageParser('typescript', { maxLines: 0, maxTokens: 200 }));
+
+      expect(chunks.length).toBeGreaterThan(1);
+      chunks.forEach((chunk) => {
+        expect(Math.ceil(chunk.semantic_text.length / 4)).toBeLessThanOrEqual(200);
+        expect(chunk.kind).toBe('function_declaration');
+        expect(chunk.semantic_text).toContain('kind: function_declaration');
+      });
+      expect(chunks[0].startLine).toBe(1);
+      expect(chunks[chunks.length - 1].endLine).toBe(100);
+      chunks.slice(1).forEach((chunk, i) => expect(chunk.startLine).toBe(chunks[i].endLine! + 1));
+      expect(chunks.map((chunk) => chunk.content).join('\n')).toBe(longFunction);
+      expect(new Set(chunks.map((chunk) => chunk.chunk_hash)).size).toBe(chunks.length);
+    });
+
+    it('should count tokens with the given counter', () => {
+      const countWords = (text: string) => text.split(/\s+/).filter(Boolean).length;
+      const chunks = parseSource(
+        longFunction,
+        new LanguageParser('typescript', { maxLines: 0, maxTokens: 100, countTokens: countWords })
+      );
+
+      expect(chunks.length).toBeGreaterThan(4);
+      chunks.forEach((chunk) => expect(countWords(chunk.semantic_text)).toBeLessThanOrEqual(100));
+    });
+
+    it('should keep the signature and source line numbers of the pieces of a later window', () => {
+      const lines = longFunction.split('\n');
+      const chunks = parseSource(
+        longFunction,
+        new LanguageParser('typescript', { maxLines: 60, overlapLines: 10, maxTokens: 150 })
+      );
+      // The second window covers lines 51-100, below the signature it is prefixed with
+      const pieces = chunks.filter((chunk) => chunk.startLine! > 1 && chunk.content.startsWith(lines[0]));
+
+      expect(pieces.length).toBeGreaterThan(1);
+      expect(pieces[0].startLine).toBe(51);
+      expect(pieces[pieces.length - 1].endLine).toBe(100);
+      pieces.slice(1).forEach((chunk, i) => expect(chunk.startLine).toBe(pieces[i].endLine! + 1));
+      pieces.forEach((chunk) =>
+        expect(chunk.content).toBe([lines[0], ...lines.slice(chunk.startLine! - 1, chunk.endLine)].join('\n'))
+      );
+    });
+
+    it('should truncate a single line over the budget instead of failing', () => {
+      const [chunk] = parseSource(longLine, new LanguageParser('typescript', { maxTokens: 50 }), 'lexical_declaration');
+
+      expect(Math.ceil(chunk.semantic_text.length / 4)).toBeLessThanOrEqual(50);
+      expect(longLine.startsWith(chunk.content)).toBe(true);
+      expect(chunk.content.length).toBeLessThan(longLine.length);
+      expect([chunk.startLine, chunk.endLine]).toEqual([1, 1]);
+    });
+
+    it('should leave chunks within the budget, and every chunk WHEN the budget is 0, as they are', () => {
+      expect(parseSource(longFunction, new LanguageParser('typescript', { maxLines: 0 }))).toHaveLength(1);
+      const [chunk] = parseSource(longLine, new LanguageParser('typescript', { maxTokens: 0 }), 'lexical_declaration');
+      expect(chunk.content).toBe(longLine);
+    });
+  });
+
+  describe('Import Context', () => {
+    const goSource = [
+      'package server',
+      '',
+      'import (',
+      '\t"fmt"',
+      '\t"net/http"',
+      '\tyaml "gopkg.in/yaml.v3"',
+      '\t_ "embed"',
+      ')',
+      '',
+      'func Serve() {',
+      '\thttp.ListenAndServe(":8080", nil)',
+      '}',
+      '',
+      'func Greet() {',
+      '\tfmt.Println("hi")',
+      '}',
+    ].join('\n');
+
+    const parseSource = (importParser: LanguageParser, extension: string, source: string) => {
+      const tempFile = path.join(os.tmpdir(), `temp_import_context_${process.pid}_${Date.now()}${extension}`);
+      fs.writeFileSync(tempFile, source);
+      try {
+        return importParser.parseFile(tempFile, 'main', `src/server${extension}`).chunks;
+      } finally {
+        fs.unlinkSync(tempFile);
+      }
+    };
+
+    const findFunction = (chunks: CodeChunk[], name: string) =>
+      chunks.find((chunk) => chunk.kind === 'function_declaration' && chunk.content.includes(name));
+
+    it('should not add import context by default', () => {
+      const chunks = parseSource(new LanguageParser('go'), '.go', goSource);
+
+      expect(findFunction(chunks, 'Serve')?.importContext).toBeUndefined();
+      expect(findFunction(chunks, 'Serve')?.semantic_text).not.toContain('imports:');
+    });
+
+    it('should resolve the Go packages a chunk references to their import paths', () => {
+      const chunks = parseSource(new LanguageParser('go', { includeImports: true }), '.go', goSource);
+      const serve = findFunction(chunks, 'Serve');
+
+      expect(serve?.importContext).toEqual({ packageName: 'server', imports: ['http=net/http'] });
+      expect(serve?.semantic_text).toContain('package: server\nimports: http=net/http\n\nfunc Serve()');
+      expect(findFunction(chunks, 'Greet')?.importContext?.imports).toEqual(['fmt']);
+    });
+
+    it('should list all of the file imports for other languages', () => {
+      const source = [
+        "import { readFile } from 'fs';",
+        "import axios from 'axios';",
+        '',
+        'function load() {',
+        '  return 1;',
+        '}',
+      ].join('\n');
+      const chunks = parseSource(new LanguageParser('typescript', { includeImports: true }), '.ts', source);
+      const importChunks = chunks.filter((chunk) => chunk.kind === 'import_statement');
+
+      expect(findFunction(chunks, 'load')?.importContext).toEqual({ imports: ['fs', 'axios'] });
+      expect(importChunks).toHaveLength(2);
+      importChunks.forEach((chunk) => expect(chunk.importContext).toBeUndefined());
+    });
+
+    it('should read the setting from the environment when no options are given', () =>
+      withTestEnv({ SCS_IDXR_CHUNK_INCLUDE_IMPORTS: 'true' }, () => {
+        const chunks = parseSource(new LanguageParser('go'), '.go', goSource);
+
+        expect(findFunction(chunks, 'Serve')?.importContext).toBeDefined();
+      }));
+
+    it('should give identical code under different imports different document ids', () => {
+      const importParser = new LanguageParser('go', { includeImports: true });
+      const serve = findFunction(parseSource(importParser, '.go', goSource), 'Serve');
+      const aliased = goSource.replace('"net/http"', 'http "example.com/http"');
+      const otherServe = findFunction(parseSource(importParser, '.go', aliased), 'Serve');
+
+      expect(serve?.content).toBe(otherServe?.content);
+      expect(getChunkDocumentId(serve!)).not.toBe(getChunkDocumentId(otherServe!));
+    });
+
+    it('should name Go imports by their alias or last path element without its major version', () => {
+      expect(getGoImportName('net/http')).toBe('http');
+      expect(getGoImportName('github.com/go-yaml/yaml/v3')).toBe('yaml');
+      expect(getGoImportName('gopkg.in/yaml.v3')).toBe('yaml');
+      expect(getGoImportName('net/http', 'nethttp')).toBe('nethttp');
+    });
+  });
+
+  describe('Embedded SQL', () => {
+    const goSource = [
+      'package orders',
+      '',
+      'const countOrders = `SELECT count(*) FROM orders`',
+      '',
+      'func (s *Store) MarkShipped(id int) error {',
+      '\t_, err := s.db.Exec(`',
+      '\t\tUPDATE orders',
+      '\t\tSET status = $1',
+      '\t\tWHERE id = $2`, "shipped", id)',
+      '\treturn err',
+      '}',
+    ].join('\n');
+
+    const pythonSource = [
+      'class OrderRepository:',
+      '    def pending(self):',
+      '        """Select the orders from the table that are not shipped yet."""',
+      '        return self.db.execute("select id, total from orders where status = %s", ("pending",))',
+    ].join('\n');
+
+    const parseSource = (sqlParser: LanguageParser, extension: string, source: string) => {
+      const tempFile = path.join(os.tmpdir(), `temp_embedded_sql_${process.pid}_${Date.now()}${extension}`);
+      fs.writeFileSync(tempFile, source);
+      try {
+        return sqlParser.parseFile(tempFile, 'main', `src/orders${extension}`).chunks;
+      } finally {
+        fs.unlinkSync(tempFile);
+      }
+    };
+
+    it('should not extract SQL by default', () => {
+      const chunks = parseSource(new LanguageParser('go'), '.go', goSource);
+
+      expect(chunks.some((chunk) => chunk.language === 'sql')).toBe(false);
+    });
+
+    it('should extract SQL queries from Go string literals, linked to their function', () => {
+      const chunks = parseSource(new LanguageParser('go', { extractEmbeddedSql: true }), '.go', goSource);
+      const queries = chunks.filter((chunk) => chunk.language === 'sql');
+
+      expect(queries.map((chunk) => [chunk.kind, chunk.startLine, chunk.endLine, chunk.parentSymbol])).toEqual([
+        ['select_statement', 3, 3, undefined],
+        ['update_statement', 7, 9, 'MarkShipped'],
+      ]);
+      expect(queries[1].content).toBe('UPDATE orders\n\t\tSET status = $1\n\t\tWHERE id = $2');
+      expect(queries[1].symbols).toEqual([{ name: 'orders', kind: 'table.reference', line: 7 }]);
+      expect(queries[1].semantic_text).toContain('parentSymbol: MarkShipped');
+    });
+
+    it('should extract SQL from Python strings but not docstrings that read like SQL', () => {
+      const chunks = parseSource(new LanguageParser('python', { extractEmbeddedSql: true }), '.py', pythonSource);
+      const queries = chunks.filter((chunk) => chunk.language === 'sql');
+
+      expect(queries).toHaveLength(1);
+      expect(queries[0].content).toBe('select id, total from orders where status = %s');
+      expect(queries[0].containerPath).toBe('OrderRepository');
+      expect(queries[0].parentSymbol).toBe('pending');
+    });
+
+    it('should read the setting from the environment when no options are given', () =>
+      withTestEnv({ SCS_IDXR_EXTRACT_EMBEDDED_SQL: 'true' }, () => {
+        const chunks = parseSource(new LanguageParser('go'), '.go', goSource);
+
+        expect(chunks.filter((chunk) => chunk.language === 'sql')).toHaveLength(2);
+      }));
+
+    it('should index .sql files by statement', () => {
+      const script = [
+        '-- Orders placed by customers',
+        'CREATE TABLE orders (',
+        '  id serial PRIMARY KEY,',
+        "  note text DEFAULT 'a;b'",
+        ');',
+        '',
+        'UPDATE orders SET note = NULL;',
+      ].join('\n');
+      const chunks = parseSource(new LanguageParser('sql'), '.sql', script);
+
+      expect(chunks.map((chunk) => [chunk.type, chunk.kind, chunk.startLine, chunk.endLine])).toEqual([
+        ['code', 'create_statement', 1, 5],
+        ['code', 'update_statement', 7, 7],
+      ]);
+      expect(chunks[0].symbols).toEqual([{ name: 'orders', kind: 'table.name', line: 2 }]);
+    });
+  });
+
+  describe('Chunk Strategies', () => {
+    const goSource = [
+      'package shapes',
+      '',
+      'func Area(w, h int) int {',
+      '\treturn w * h',
+      '}',
+      '',
+      'func Perimeter(w, h int) int {',
+      '\treturn 2 * (w + h)',
+      '}',
+    ].join('\n');
+    const jsonPath = path.resolve(__dirname, '../fixtures/json.json');
+
+    const parseGo = (goParser: LanguageParser) => {
+      const tempFile = path.join(os.tmpdir(), `temp_chunk_strategy_${process.pid}_${Date.now()}.go`);
+      fs.writeFileSync(tempFile, goSource);
+      try {
+        return goParser.parseFile(tempFile, 'main', 'src/shapes.go');
+      } finally {
+        fs.unlinkSync(tempFile);
+      }
+    };
+
+    it('should chunk Go by symbol unless told otherwise', () => {
+      const result = parseGo(new LanguageParser('go', { perLanguage: { json: 'whole-file' } }));
+
+      expect(result.metrics.parserType).toBe('tree-sitter');
+      expect(result.chunks.map((chunk) => [chunk.startLine, chunk.endLine])).toEqual(
+        expect.arrayContaining([
+          [3, 5],
+          [7, 9],
+        ])
+      );
+    });
+
+    it('should index a whole file as one chunk with the whole-file strategy', () => {
+      const jsonParser = new LanguageParser('json', { perLanguage: { json: 'whole-file' } });
+      const result = jsonParser.parseFile(jsonPath, 'main', 'tests/fixtures/json.json');
+
+      expect(result.chunks).toHaveLength(1);
+      expect(result.chunks[0].startLine).toBe(1);
+      expect(result.chunks[0].content).toBe(fs.readFileSync(jsonPath, 'utf8'));
+    });
+
+    it('should cut code into line windows with the fixed-window strategy', () =>
+      withTestEnv({ SCS_IDXR_DEFAULT_CHUNK_LINES: '4', SCS_IDXR_CHUNK_OVERLAP_LINES: '0' }, () => {
+        const result = parseGo(new LanguageParser('go', { perLanguage: { go: 'fixed-window' } }));
+
+        expect(result.metrics.parserType).toBe('text');
+        expect(result.chunks.map((chunk) => [chunk.language, chunk.startLine, chunk.endLine])).toEqual([
+          ['go', 1, 4],
+          ['go', 5, 8],
+          ['go', 9, 9],
+        ]);
+      }));
+
+    it('should read the strategies from the environment when no options are given', () =>
+      withTestEnv({ SCS_IDXR_CHUNK_STRATEGY: 'go:symbol,json:whole-file' }, () => {
+        const result = new LanguageParser('json').parseFile(jsonPath, 'main', 'tests/fixtures/json.json');
+
+        expect(result.chunks).toHaveLength(1);
+      }));
+  });
+
+  describe('Language Detection', () => {
+    let tempDir: string;
+
+    beforeAll(() => {
+      tempDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-detect-'));
+    });
+
+    afterAll(() => {
+      fs.rmSync(tempDir, { recursive: true, force: true });
+    });
+
+    const parseTempFile = (detectingParser: LanguageParser, fileName: string, content: string | Buffer) => {
+      const filePath = path.join(tempDir, fileName);
+      fs.writeFileSync(filePath, content);
+      return detectingParser.parseFile(filePath, 'main', fileName);
+    };
+
+    it('should parse an extensionless script by its shebang', () => {
+      const result = parseTempFile(
+        new LanguageParser('bash'),
+        'deploy',
+        '#!/usr/bin/env bash\ndeploy() {\n  echo hi\n}\n'
+      );
+
+      expect(result.metrics.parserType).toBe('tree-sitter');
+      expect(result.chunks.length).toBeGreaterThan(0);
+      expect(result.chunks.every((chunk) => chunk.language === 'bash')).toBe(true);
+    });
+
+    it('should index Dockerfiles and Makefiles as their own languages', () => {
+      const dockerfile = parseTempFile(new LanguageParser(), 'Dockerfile', 'FROM node:22\nRUN npm ci\n');
+      const makefile = parseTempFile(new LanguageParser(), 'Makefile', 'build:\n\tnpm run build\n');
+
+      expect(dockerfile.chunks[0].language).toBe('dockerfile');
+      expect(makefile.chunks[0].language).toBe('makefile');
+    });
+
+    it('should index files of unknown languages as plain text', () => {
+      const result = parseTempFile(new LanguageParser(), 'styles.css', 'body {\n  color: red;\n}\n');
+
+      expect(result.metrics.parserType).toBe('text');
+      expect(result.chunks[0].language).toBe('text');
+      expect(result.chunks[0].content).toContain('color: red');
+    });
+
+    it('should skip binary files', () => {
+      const result = parseTempFile(new LanguageParser(), 'logo.png', Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x00, 0x1a]));
+
+      expect(result.chunks).toEqual([]);
+      expect(result.skipped).toEqual({ reason: 'binary', message: 'binary content' });
+    });
+
+    it('should skip files larger than maxFileBytes without parsing them', () => {
+      const limited = new LanguageParser('javascript', { maxFileBytes: 16 });
+      const result = parseTempFile(limited, 'big.js', 'const a = 1;\n'.repeat(2));
+
+      expect(result.chunks).toEqual([]);
+      expect(result.skipped).toEqual({ reason: 'too-large', message: 'larger than maxFileBytes (26 > 16)' });
+    });
+
+    it('should index minified code as one whole-file chunk', () => {
+      const bundle = Array.from({ length: 200 }, (_, i) => `function f${i}(a){return a+${i}}`).join(';');
+      const result = parseTempFile(new LanguageParser('javascript'), 'bundle.min.js', bundle);
+
+      expect(result.skipped).toBeUndefined();
+      expect(result.metrics.parserType).toBe('text');
+      expect(result.chunks).toHaveLength(1);
+      expect(result.chunks[0]).toMatchObject({ language: 'javascript', startLine: 1, endLine: 1, content: bundle });
+    });
+
+    it('should skip minified code larger than maxChunkSizeBytes', () =>
+      withTestEnv({ SCS_IDXR_MAX_CHUNK_SIZE_BYTES: '1000' }, () => {
+        const bundle = 'var a=1;'.repeat(200);
+        const result = parseTempFile(new LanguageParser('javascript'), 'bundle.min.js', bundle);
+
+        expect(result.chunks).toEqual([]);
+        expect(result.skipped?.reason).toBe('minified');
+      }));
+
+    it('should skip minified code with more tokens than maxTokens instead of truncating it', () => {
+      const bundle = Array.from({ length: 200 }, (_, i) => `function f${i}(a){return a+${i}}`).join(';');
+      const result = parseTempFile(new LanguageParser('javascript', { maxTokens: 100 }), 'bundle.min.js', bundle);
+
+      expect(result.chunks).toEqual([]);
+      expect(result.skipped).toMatchObject({ reason: 'minified', message: expect.stringMatching(/> 100 tokens/) });
+    });
+  });
+
+  describe('Tree-sitter Fallback', () => {
+    it('should index a file as plain text WHEN tree-sitter fails on it', () => {
+      const scala = languageConfigurations.scala;
+      const originalQueries = scala.queries;
+      scala.queries = ['(no_such_node) @broken'];
+      const tempFile = path.join(os.tmpdir(), `temp_fallback_${process.pid}_${Date.now()}.scala`);
+      fs.writeFileSync(tempFile, 'object Main {\n  def ok = 1\n  ) ) )\n}\n');
+      try {
+        const result = new LanguageParser('scala').parseFile(tempFile, 'main', 'src/Main.scala');
+
+        expect(result.metrics.parserType).toBe('text');
+        expect(result.chunks.length).toBeGreaterThan(0);
+        expect(result.chunks[0].language).toBe('scala');
+        expect(result.fallback?.error).toBeTruthy();
+        expect(result.fallback?.line).toBe(3);
+      } finally {
+        scala.queries = originalQueries;
+        fs.unlinkSync(tempFile);
+      }
+    });
+
+    it('should not report a fallback for files tree-sitter handles', () => {
+      const filePath = path.resolve(__dirname, '../fixtures/scala.scala');
+
+      expect(parser.parseFile(filePath, 'main', 'tests/fixtures/scala.scala').fallback).toBeUndefined();
+    });
+  });
 });
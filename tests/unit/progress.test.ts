@@ -0,0 +1,116 @@
+import { describe, it, expect, vi } from 'vitest';
+import * as loggerModule from '../../src/utils/logger';
+import {
+  ProgressEvent,
+  ProgressTracker,
+  createConsoleProgress,
+  formatProgressBar,
+  formatProgressLine,
+  getProgressPercent,
+} from '../../src/utils/progress';
+
+function makeEvent(overrides: Partial<ProgressEvent>): ProgressEvent {
+  return { phase: 'parsing', filesDone: 0, filesTotal: 0, chunksTotal: 0, chunksEmbedded: 0, ...overrides };
+}
+
+describe('ProgressTracker', () => {
+  it('SHOULD report every update with the counts so far', () => {
+    const events: ProgressEvent[] = [];
+    const tracker = new ProgressTracker((event) => events.push(event));
+
+    tracker.setPhase('walking');
+    tracker.setFilesTotal(2);
+    tracker.addFileDone(3);
+    tracker.addFileDone();
+    tracker.setPhase('embedding');
+    tracker.addChunksEmbedded(3);
+
+    expect(events.map((event) => event.phase)).toEqual([
+      'walking',
+      'parsing',
+      'parsing',
+      'parsing',
+      'embedding',
+      'embedding',
+    ]);
+    expect(events[2]).toEqual(makeEvent({ filesDone: 1, filesTotal: 2, chunksTotal: 3 }));
+    expect(tracker.snapshot).toEqual(
+      makeEvent({ phase: 'embedding', filesDone: 2, filesTotal: 2, chunksTotal: 3, chunksEmbedded: 3 })
+    );
+  });
+
+  it('SHOULD work without a callback', () => {
+    const tracker = new ProgressTracker();
+    tracker.setFilesTotal(1);
+    tracker.addFileDone(2);
+    expect(tracker.snapshot).toMatchObject({ filesDone: 1, chunksTotal: 2 });
+  });
+});
+
+describe('progress formatting', () => {
+  it('SHOULD compute the percentage of files while parsing and of chunks while embedding', () => {
+    expect(getProgressPercent(makeEvent({ phase: 'walking' }))).toBeNull();
+    expect(getProgressPercent(makeEvent({ filesDone: 520, filesTotal: 1000 }))).toBe(52);
+    expect(getProgressPercent(makeEvent({ phase: 'storing', chunksTotal: 8, chunksEmbedded: 2 }))).toBe(25);
+    // A resumed queue holds chunks that this run did not parse
+    expect(getProgressPercent(makeEvent({ phase: 'embedding', chunksEmbedded: 5 }))).toBeNull();
+  });
+
+  it('SHOULD format log lines and progress bars', () => {
+    const event = makeEvent({ filesDone: 520, filesTotal: 1000, chunksTotal: 3400 });
+
+    expect(formatProgressLine(event)).toBe('Progress: parsing 52% (520/1000 files, 3400 chunks)');
+    expect(formatProgressLine(makeEvent({ phase: 'walking' }))).toBe('Progress: walking (listing files)');
+    expect(formatProgressBar(event, 10)).toBe('parsing   [#####.....]  52%  520/1000 files, 3400 chunks');
+    expect(formatProgressBar(makeEvent({ phase: 'embedding', chunksEmbedded: 5, filesTotal: 2 }), 4)).toBe(
+      'embedding [    ]       5 chunks embedded, 0/2 files parsed'
+    );
+  });
+});
+
+describe('createConsoleProgress', () => {
+  it('SHOULD log a line per stage and otherwise at most once per interval WHEN stdout is not a TTY', () => {
+    const info = vi.spyOn(loggerModule.logger, 'info').mockImplementation(() => {});
+    let time = 0;
+    const progress = createConsoleProgress({ tty: false, logIntervalMs: 1000, now: () => time });
+
+    progress.onProgress(makeEvent({ phase: 'walking' }));
+    progress.onProgress(makeEvent({ filesTotal: 3 }));
+    time = 500;
+    progress.onProgress(makeEvent({ filesDone: 1, filesTotal: 3 }));
+    time = 1600;
+    progress.onProgress(makeEvent({ filesDone: 2, filesTotal: 3 }));
+    progress.onProgress(makeEvent({ phase: 'embedding', filesDone: 3, filesTotal: 3, chunksTotal: 4 }));
+    progress.onProgress(makeEvent({ phase: 'storing', filesDone: 3, filesTotal: 3, chunksTotal: 4 }));
+    progress.stop();
+
+    expect(info.mock.calls.map(([message]) => message)).toEqual([
+      'Progress: walking (listing files)',
+      'Progress: parsing 0% (0/3 files, 0 chunks)',
+      'Progress: parsing 66% (2/3 files, 0 chunks)',
+      'Progress: embedding 0% (0/4 chunks embedded, 3/3 files parsed)',
+      'Progress: storing 0% (0/4 chunks embedded, 3/3 files parsed)',
+    ]);
+  });
+
+  it('SHOULD draw a progress bar and remove it on stop WHEN stdout is a TTY', () => {
+    const setStatusLine = vi.spyOn(loggerModule, 'setConsoleStatusLine').mockImplementation(() => {});
+    const info = vi.spyOn(loggerModule.logger, 'info').mockImplementation(() => {});
+    let time = 0;
+    const progress = createConsoleProgress({ tty: true, now: () => time });
+
+    progress.onProgress(makeEvent({ filesTotal: 2 }));
+    time = 10;
+    progress.onProgress(makeEvent({ filesDone: 1, filesTotal: 2 }));
+    time = 200;
+    progress.onProgress(makeEvent({ filesDone: 2, filesTotal: 2 }));
+    progress.stop();
+
+    expect(setStatusLine.mock.calls.map(([line]) => line)).toEqual([
+      formatProgressBar(makeEvent({ filesTotal: 2 })),
+      formatProgressBar(makeEvent({ filesDone: 2, filesTotal: 2 })),
+      undefined,
+    ]);
+    expect(info).not.toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,577 @@
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { QdrantStore } from '../../src/utils/qdrant_store';
+import { createChunkStore } from '../../src/utils/chunk_store';
+import { CodeChunk, getChunkDocumentId } from '../../src/utils/elasticsearch';
+import { withTestEnv } from './utils/test_env';
+import { makeChunk } from './utils/fixtures';
+
+interface FakePoint {
+  id: string;
+  vector: number[];
+  payload: Record<string, unknown>;
+}
+
+interface FakeCollection {
+  size: number;
+  distance: string;
+  points: Map<string, FakePoint>;
+}
+
+type Condition = { key: string; match: { value?: unknown; any?: unknown[]; text?: string } };
+
+function matches(payload: Record<string, unknown>, { key, match }: Condition): boolean {
+  const values = ([] as unknown[]).concat(payload[key] ?? []);
+  if (match.text !== undefined) {
+    return values.some((v) => String(v).toLowerCase().includes(match.text!.toLowerCase()));
+  }
+  const wanted = match.any ?? [match.value];
+  return values.some((v) => wanted.includes(v));
+}
+
+function matchesFilter(payload: Record<string, unknown>, filter?: { must?: Condition[]; should?: Condition[] }) {
+  return (
+    (filter?.must ?? []).every((c) => matches(payload, c)) &&
+    (!filter?.should || filter.should.some((c) => matches(payload, c)))
+  );
+}
+
+function cosine(a: number[], b: number[]): number {
+  const dot = a.reduce((sum, v, i) => sum + v * b[i], 0);
+  return dot / (Math.hypot(...a) * Math.hypot(...b));
+}
+
+function distance(a: number[], b: number[]): number {
+  return Math.hypot(...a.map((v, i) => v - b[i]));
+}
+
+/**
+ * An in-memory stand-in for the parts of the Qdrant HTTP API the store uses.
+ */
+function createFakeQdrant() {
+  const collections = new Map<string, FakeCollection>();
+  const requests: Array<{ method: string; path: string; headers: Record<string, string> }> = [];
+
+  const reply = (status: number, result: unknown, error?: string) =>
+    new Response(JSON.stringify({ result, status: error ? { error } : 'ok' }), { status });
+
+  const fetchMock = vi.fn(async (input: string | URL | Request, init?: RequestInit) => {
+    const url = new URL(String(input));
+    const method = init?.method ?? 'GET';
+    const body = init?.body ? JSON.parse(String(init.body)) : {};
+    requests.push({ method, path: url.pathname, headers: (init?.headers ?? {}) as Record<string, string> });
+
+    const [, , name, resource, action] = url.pathname.split('/').map(decodeURIComponent);
+    const collection = collections.get(name);
+
+    if (!resource) {
+      if (method === 'GET') {
+        return collection
+          ? reply(200, { config: { params: { vectors: { size: collection.size, distance: collection.distance } } } })
+          : reply(404, null, `Collection \`${name}\` doesn't exist!`);
+      }
+      if (method === 'PUT') {
+        if (collection) {
+          return reply(409, null, `Collection \`${name}\` already exists!`);
+        }
+        collections.set(name, { size: body.vectors.size, distance: body.vectors.distance, points: new Map() });
+        return reply(200, true);
+      }
+      collections.delete(name);
+      return reply(200, true);
+    }
+    if (!collection) {
+      return reply(404, null, `Collection \`${name}\` doesn't exist!`);
+    }
+    if (resource === 'index') {
+      return reply(200, { status: 'completed' });
+    }
+
+    const points = collection.points;
+    const toResult = (point: FakePoint, score?: number) => ({ id: point.id, score, payload: point.payload });
+    switch (method === 'PUT' ? 'upsert' : (action ?? 'retrieve')) {
+      case 'upsert':
+        for (const point of body.points as FakePoint[]) {
+          if (point.vector.length !== collection.size) {
+            return reply(400, null, `Wrong input: Vector dimension error: expected dim: ${collection.size}`);
+          }
+          points.set(point.id, point);
+        }
+        return reply(200, { status: 'completed' });
+      case 'retrieve':
+        return reply(
+          200,
+          (body.ids as string[]).flatMap((id) => {
+            const point = points.get(id);
+            return point ? [{ ...toResult(point), ...(body.with_vector ? { vector: point.vector } : {}) }] : [];
+          })
+        );
+      case 'search': {
+        // Euclid scores are distances, nearest first
+        const euclid = collection.distance === 'Euclid';
+        return reply(
+          200,
+          Array.from(points.values())
+            .filter((point) => matchesFilter(point.payload, body.filter))
+            .map((point) => toResult(point, (euclid ? distance : cosine)(body.vector, point.vector)))
+            .sort((a, b) => (euclid ? a.score! - b.score! : b.score! - a.score!))
+            .slice(0, body.limit)
+        );
+      }
+      case 'scroll': {
+        const all = Array.from(points.values()).filter((point) => matchesFilter(point.payload, body.filter));
+        const start = body.offset ?? 0;
+        const next = start + body.limit < all.length ? start + body.limit : null;
+        const page = all
+          .slice(start, start + body.limit)
+          .map((point) => ({ ...toResult(point), ...(body.with_vector ? { vector: point.vector } : {}) }));
+        return reply(200, { points: page, next_page_offset: next });
+      }
+      case 'batch':
+        for (const operation of body.operations) {
+          if (operation.set_payload) {
+            for (const id of operation.set_payload.points) {
+              Object.assign(points.get(id)!.payload, operation.set_payload.payload);
+            }
+          } else {
+            operation.delete.points.forEach((id: string) => points.delete(id));
+          }
+        }
+        return reply(200, [{ status: 'completed' }]);
+      default:
+        return reply(404, null, `Unknown route ${url.pathname}`);
+    }
+  });
+
+  return { collections, requests, fetchMock };
+}
+
+describe('QdrantStore', () => {
+  let fake: ReturnType<typeof createFakeQdrant>;
+  let store: QdrantStore;
+
+  beforeEach(() => {
+    fake = createFakeQdrant();
+    vi.stubGlobal('fetch', fake.fetchMock);
+    store = new QdrantStore({ url: 'http://qdrant:6333/', apiKey: 'secret', collection: 'code', dimensions: 3 });
+  });
+
+  afterEach(() => {
+    vi.unstubAllGlobals();
+    vi.restoreAllMocks();
+  });
+
+  it('SHOULD create the collection with cosine distance and send the API key', async () => {
+    await store.setup();
+
+    expect(fake.collections.get('code')).toMatchObject({ size: 3, distance: 'Cosine' });
+    expect(fake.collections.has('code_settings')).toBe(true);
+    expect(await store.getVectorDimensions()).toBe(3);
+    expect(fake.requests.every((r) => r.headers['api-key'] === 'secret')).toBe(true);
+  });
+
+  it('SHOULD reuse an existing collection WHEN setup runs again', async () => {
+    await store.setup();
+    await store.indexChunks([makeChunk({ code_vector: [1, 0, 0] })]);
+
+    const second = new QdrantStore({ url: 'http://qdrant:6333', collection: 'code', dimensions: 3 });
+    await second.setup();
+
+    expect(fake.collections.get('code')?.points.size).toBe(1);
+  });
+
+  it('SHOULD reject an existing collection with different dimensions', async () => {
+    await store.setup();
+
+    const mismatched = new QdrantStore({ url: 'http://qdrant:6333', collection: 'code', dimensions: 768 });
+
+    await expect(mismatched.setup()).rejects.toThrow(
+      'Qdrant collection "code" stores 3-dimensional vectors, not 768-dimensional ones.'
+    );
+  });
+
+  it('SHOULD store unit-length vectors WHEN the metric is cosine', async () => {
+    await store.setup();
+
+    await store.indexChunks([makeChunk({ code_vector: [3, 4, 0] })]);
+    const [result] = await store.search([0, 2, 0], 1);
+
+    expect(Array.from(fake.collections.get('code')!.points.values())[0].vector).toEqual([0.6, 0.8, 0]);
+    expect(result.score).toBeCloseTo(0.8, 6);
+  });
+
+  it('SHOULD compare vectors by Euclidean distance WHEN the metric is euclidean', async () => {
+    const euclidean = new QdrantStore({
+      url: 'http://qdrant:6333',
+      collection: 'l2',
+      dimensions: 2,
+      metric: 'euclidean',
+    });
+    await euclidean.setup();
+    await euclidean.indexChunks([
+      makeChunk({ chunk_hash: 'far', content: 'far', code_vector: [10, 0] }),
+      makeChunk({ chunk_hash: 'near', content: 'near', filePath: 'src/b.ts', code_vector: [2, 0] }),
+    ]);
+
+    const results = await euclidean.search([1, 0], 2);
+
+    expect(fake.collections.get('l2')?.distance).toBe('Euclid');
+    expect(results.map((r) => r.content)).toEqual(['near', 'far']);
+    expect(results[0].score).toBeCloseTo(0.5, 6);
+    const cosine = new QdrantStore({ url: 'http://qdrant:6333', collection: 'l2', dimensions: 2 });
+    await expect(cosine.setup()).rejects.toThrow('Qdrant collection "l2" uses Euclid distance, but the cosine metric');
+  });
+
+  it('SHOULD create the collection on the first write WHEN dimensions are not configured', async () => {
+    const lazy = new QdrantStore({ url: 'http://qdrant:6333', collection: 'lazy' });
+    await lazy.setup();
+    expect(fake.collections.has('lazy')).toBe(false);
+
+    await lazy.indexChunks([makeChunk({ code_vector: [1, 0, 0, 0] })]);
+
+    expect(fake.collections.get('lazy')?.size).toBe(4);
+  });
+
+  it('SHOULD fail chunks without a vector or with mismatched dimensions', async () => {
+    await store.setup();
+
+    const result = await store.indexChunks([
+      makeChunk({ code_vector: [1, 0, 0] }),
+      makeChunk({ chunk_hash: 'no-vector' }),
+      makeChunk({ chunk_hash: 'wrong-size', code_vector: [1, 0] }),
+    ]);
+
+    expect(result.succeeded.map((s) => s.inputIndex)).toEqual([0]);
+    expect(result.failed.map((f) => f.inputIndex)).toEqual([1, 2]);
+    expect(result.failed[0].error).toEqual({
+      message: 'missing code_vector; the Qdrant store needs a client-side embedder (SCS_IDXR_EMBEDDER)',
+    });
+    expect(result.failed[1].error).toEqual({ message: 'code_vector has 2 dimensions, store expects 3' });
+  });
+
+  it('SHOULD merge locations of the same chunk across upserts', async () => {
+    await store.setup();
+    const chunk = makeChunk({ code_vector: [1, 0, 0] });
+
+    await store.indexChunks([chunk]);
+    await store.indexChunks([{ ...chunk, filePath: 'src/b.ts', git_file_hash: 'hash-b' }]);
+
+    const [point] = fake.collections.get('code')!.points.values();
+    expect(fake.collections.get('code')?.points.size).toBe(1);
+    expect(point.payload.file_paths).toEqual(['src/a.ts', 'src/b.ts']);
+
+    const hashes = await store.getIndexedFileHashes('main');
+    expect(hashes.get('src/a.ts')).toEqual(new Set(['hash-a']));
+    expect(hashes.get('src/b.ts')).toEqual(new Set(['hash-b']));
+  });
+
+  it('SHOULD export each chunk with its vector once per location, a page at a time', async () => {
+    await store.setup();
+    const chunk = makeChunk({ code_vector: [1, 0, 0] });
+    const other = makeChunk({ content: 'const c = 3;', chunk_hash: 'chunk-c', code_vector: [0, 0, 1] });
+    await store.indexChunks([chunk, { ...chunk, filePath: 'src/b.ts', git_file_hash: 'hash-b' }, other]);
+
+    const pages: CodeChunk[][] = [];
+    for await (const page of store.exportChunks(1)) {
+      pages.push(page);
+    }
+
+    expect(pages.map((page) => page.length).sort()).toEqual([1, 2]);
+    expect(pages.flat().map((c) => [c.filePath, c.git_file_hash, c.code_vector])).toEqual(
+      expect.arrayContaining([
+        ['src/a.ts', 'hash-a', [1, 0, 0]],
+        ['src/b.ts', 'hash-b', [1, 0, 0]],
+        ['src/a.ts', 'hash-a', [0, 0, 1]],
+      ])
+    );
+  });
+
+  it('SHOULD return the top-k chunks by cosine similarity', async () => {
+    await store.setup();
+    await store.indexChunks([
+      makeChunk({ chunk_hash: 'x', content: 'x', code_vector: [1, 0, 0] }),
+      makeChunk({ chunk_hash: 'y', content: 'y', filePath: 'src/y.ts', code_vector: [0, 1, 0] }),
+      makeChunk({ chunk_hash: 'xy', content: 'xy', filePath: 'src/xy.ts', code_vector: [1, 1, 0] }),
+    ]);
+
+    const results = await store.search([1, 0.1, 0], 2);
+
+    expect(results.map((r) => r.content)).toEqual(['x', 'xy']);
+    expect(results[0].score).toBeCloseTo(cosine([1, 0.1, 0], [1, 0, 0]));
+    expect(results[0]).toMatchObject({ filePath: 'src/a.ts', startLine: 1, endLine: 3 });
+  });
+
+  it('SHOULD apply payload filters to search', async () => {
+    await store.setup();
+    await store.indexChunks([
+      makeChunk({ chunk_hash: 'ts', content: 'ts', code_vector: [1, 0, 0] }),
+      makeChunk({ chunk_hash: 'py', content: 'py', language: 'python', filePath: 'a.py', code_vector: [1, 0.1, 0] }),
+    ]);
+
+    const results = await store.search([1, 0, 0], 10, { language: 'python' });
+
+    expect(results.map((r) => r.content)).toEqual(['py']);
+  });
+
+  it('SHOULD keep only chunks with a location under the filtered path', async () => {
+    await store.setup();
+    const shared = makeChunk({ chunk_hash: 'shared', content: 'shared', code_vector: [1, 0, 0] });
+    await store.indexChunks([
+      shared,
+      { ...shared, filePath: 'internal/b.ts' },
+      makeChunk({ chunk_hash: 'web', content: 'web', filePath: 'web/c.ts', code_vector: [1, 0.1, 0] }),
+    ]);
+
+    const results = await store.search([1, 0, 0], 10, { path: 'internal/', kind: 'func' });
+    const unfiltered = await store.search([1, 0, 0], 10, { path: 'internal/' });
+
+    expect(results).toEqual([]);
+    expect(unfiltered.map((r) => [r.content, r.filePath])).toEqual([['shared', 'internal/b.ts']]);
+  });
+
+  it('SHOULD search again for more candidates WHEN too few pass the path filter', async () => {
+    await store.setup();
+    await store.indexChunks([
+      makeChunk({ chunk_hash: 'a', content: 'a', filePath: 'web/a.ts', code_vector: [1, 0, 0] }),
+      makeChunk({ chunk_hash: 'b', content: 'b', filePath: 'web/b.ts', code_vector: [1, 0.1, 0] }),
+      makeChunk({ chunk_hash: 'c', content: 'c', filePath: 'internal/c.ts', code_vector: [1, 0.5, 0] }),
+    ]);
+    fake.requests.length = 0;
+
+    const results = await store.search([1, 0, 0], 1, { path: 'internal/' }, { overfetchFactor: 1 });
+
+    expect(results.map((r) => r.filePath)).toEqual(['internal/c.ts']);
+    expect(fake.requests.filter((r) => r.path.endsWith('/points/search'))).toHaveLength(3);
+  });
+
+  it('SHOULD reject query vectors of the wrong size', async () => {
+    await store.setup();
+    await store.indexChunks([makeChunk({ code_vector: [1, 0, 0] })]);
+
+    await expect(store.search([1, 0], 5)).rejects.toThrow(
+      'Query vector has 2 dimensions, but Qdrant collection "code" holds 3.'
+    );
+  });
+
+  it('SHOULD rank keyword matches by term frequency and symbol names', async () => {
+    await store.setup();
+    await store.indexChunks([
+      makeChunk({ chunk_hash: 'body', content: 'parse();', code_vector: [1, 0, 0] }),
+      makeChunk({
+        chunk_hash: 'decl',
+        content: 'function parse() {}',
+        filePath: 'src/parser.ts',
+        symbols: [{ name: 'parse', kind: 'function.name', line: 1 }],
+        code_vector: [0, 1, 0],
+      }),
+      makeChunk({ chunk_hash: 'other', content: 'const b = 2;', filePath: 'src/b.ts', code_vector: [0, 0, 1] }),
+    ]);
+
+    const results = await store.keywordSearch('parse', 5);
+
+    expect(results.map((r) => r.filePath)).toEqual(['src/parser.ts', 'src/a.ts']);
+  });
+
+  it('SHOULD rank every keyword match WHEN the best one is scrolled last', async () => {
+    await store.setup();
+    await store.indexChunks([
+      ...Array.from({ length: 300 }, (_, i) =>
+        makeChunk({ chunk_hash: `call-${i}`, content: `parse(${i});`, code_vector: [1, 0, 0] })
+      ),
+      makeChunk({
+        chunk_hash: 'decl',
+        content: 'function parse() {}',
+        filePath: 'src/parser.ts',
+        symbols: [{ name: 'parse', kind: 'function.name', line: 1 }],
+        code_vector: [0, 1, 0],
+      }),
+    ]);
+
+    const [best] = await store.keywordSearch('parse', 1);
+
+    expect(best.filePath).toBe('src/parser.ts');
+  });
+
+  it('SHOULD delete locations by file path and drop chunks without locations', async () => {
+    await store.setup();
+    const shared = makeChunk({ code_vector: [1, 0, 0] });
+    await store.indexChunks([
+      shared,
+      { ...shared, filePath: 'src/b.ts' },
+      makeChunk({ chunk_hash: 'only-a', content: 'only a', code_vector: [0, 1, 0] }),
+    ]);
+
+    expect(await store.getIndexedFilePaths()).toEqual(['src/a.ts', 'src/b.ts']);
+
+    const result = await store.deleteDocumentsByFilePaths(['src/a.ts']);
+
+    const points = Array.from(fake.collections.get('code')!.points.values());
+    expect(result).toEqual({ locations: 2, chunks: 1 });
+    expect(points).toHaveLength(1);
+    expect(points[0].payload.file_paths).toEqual(['src/b.ts']);
+    expect(await store.getIndexedFilePaths()).toEqual(['src/b.ts']);
+  });
+
+  it('SHOULD keep the chunks in keepChunkIds with their vectors WHEN their file is deleted', async () => {
+    await store.setup();
+    const kept = makeChunk({ chunk_hash: 'kept', content: 'unchanged', code_vector: [0, 0, 1] });
+    await store.indexChunks([kept, makeChunk({ chunk_hash: 'edited', content: 'edited', code_vector: [0, 1, 0] })]);
+    const keptId = getChunkDocumentId(kept);
+
+    const result = await store.deleteDocumentsByFilePaths(['src/a.ts'], { keepChunkIds: new Set([keptId]) });
+
+    expect(result).toEqual({ locations: 2, chunks: 1 });
+    expect(await store.getIndexedFilePaths()).toEqual([]);
+    expect(await store.getChunkVectors([keptId, getChunkDocumentId(makeChunk({ content: 'edited' }))])).toEqual(
+      new Map([[keptId, [0, 0, 1]]])
+    );
+  });
+
+  it('SHOULD scope deletes, hashes, and search filters to one workspace', async () => {
+    await store.setup();
+    const shared = makeChunk({ code_vector: [1, 0, 0] });
+    await store.indexChunks([
+      { ...shared, workspace: 'api' },
+      { ...shared, workspace: 'web', git_file_hash: 'hash-web' },
+      makeChunk({ chunk_hash: 'old', content: 'old', filePath: 'src/old.ts', code_vector: [0, 1, 0] }),
+    ]);
+
+    const result = await store.deleteDocumentsByFilePaths(['src/a.ts', 'src/old.ts'], { workspace: 'web' });
+
+    expect(result).toEqual({ locations: 2, chunks: 1 });
+    expect(await store.getIndexedFileHashes('main', 'api')).toEqual(new Map([['src/a.ts', new Set(['hash-a'])]]));
+    expect(await store.getIndexedFilePaths('web')).toEqual([]);
+    expect((await store.search([1, 0, 0], 10, { workspace: 'web' })).map((r) => r.content)).toEqual([]);
+    expect((await store.search([1, 0, 0], 10, { workspace: 'api' }))[0]).toMatchObject({ workspace: 'api' });
+  });
+
+  it('SHOULD count the files and chunks of each workspace', async () => {
+    await store.setup();
+    const shared = makeChunk({ code_vector: [1, 0, 0] });
+    await store.indexChunks([
+      { ...shared, workspace: 'web' },
+      { ...shared, workspace: 'api' },
+      makeChunk({ chunk_hash: 'b', content: 'b', filePath: 'src/b.ts', workspace: 'web', code_vector: [0, 1, 0] }),
+      makeChunk({ chunk_hash: 'old', content: 'old', filePath: 'src/old.ts', code_vector: [0, 0, 1] }),
+    ]);
+
+    expect(await store.getWorkspaces()).toEqual([
+      { workspace: null, files: 1, chunks: 1 },
+      { workspace: 'api', files: 1, chunks: 1 },
+      { workspace: 'web', files: 2, chunks: 2 },
+    ]);
+  });
+
+  it('SHOULD list symbol names and find the chunks recording one', async () => {
+    await store.setup();
+    await store.indexChunks([
+      makeChunk({
+        chunk_hash: 'decl',
+        content: 'function parse() { read(); }',
+        symbols: [
+          { name: 'parse', kind: 'function.name', line: 1 },
+          { name: 'read', kind: 'function.call', line: 1 },
+        ],
+        code_vector: [1, 0, 0],
+      }),
+      makeChunk({
+        chunk_hash: 'other',
+        content: 'function read() {}',
+        filePath: 'src/b.ts',
+        symbols: [{ name: 'read', kind: 'function.name', line: 1 }],
+        code_vector: [0, 1, 0],
+      }),
+    ]);
+
+    expect(await store.getSymbolNames()).toEqual(
+      expect.arrayContaining([
+        { name: 'parse', kind: 'function.name' },
+        { name: 'read', kind: 'function.call' },
+        { name: 'read', kind: 'function.name' },
+      ])
+    );
+    expect((await store.getSymbolNames()).length).toBe(3);
+    expect((await store.findChunksBySymbol('read', 5)).map((r) => r.filePath)).toEqual(['src/a.ts', 'src/b.ts']);
+    expect((await store.findChunksBySymbol('read', 5, { path: 'src/b.ts' })).map((r) => r.filePath)).toEqual([
+      'src/b.ts',
+    ]);
+    expect(await store.findChunksBySymbol('missing', 5)).toEqual([]);
+  });
+
+  it('SHOULD count files, chunks, languages, and kinds from the payloads', async () => {
+    expect(await store.getStats()).toEqual({ files: 0, chunks: 0, languages: {}, kinds: {}, sizeBytes: null });
+
+    await store.setup();
+    const shared = makeChunk({ kind: 'function_declaration', code_vector: [1, 0, 0] });
+    await store.indexChunks([
+      shared,
+      { ...shared, filePath: 'src/b.ts' },
+      makeChunk({ chunk_hash: 'py', content: 'py', language: 'python', filePath: 'a.py', code_vector: [0, 1, 0] }),
+    ]);
+
+    expect(await store.getStats()).toEqual({
+      files: 3,
+      chunks: 2,
+      languages: { typescript: 1, python: 1 },
+      kinds: { function_declaration: 1 },
+      sizeBytes: null,
+    });
+  });
+
+  it('SHOULD remove the chunk collection on clean', async () => {
+    await store.setup();
+    await store.updateLastIndexedCommit('main', 'abc');
+
+    await store.clean();
+
+    expect(fake.collections.has('code')).toBe(false);
+    expect(await store.getLastIndexedCommit('main')).toBe('abc');
+  });
+
+  it('SHOULD record the embedding model in the settings collection until clean', async () => {
+    expect(await store.getEmbeddingModel()).toBeNull();
+
+    await store.setEmbeddingModel({ embedder: 'noop', template: '{text}' });
+    expect(await store.getEmbeddingModel()).toEqual({ embedder: 'noop', template: '{text}' });
+
+    await store.clean();
+    expect(await store.getEmbeddingModel()).toBeNull();
+  });
+
+  it('SHOULD store the last indexed commit per branch', async () => {
+    expect(await store.getLastIndexedCommit('main')).toBeNull();
+    expect(fake.collections.has('code_settings')).toBe(false);
+
+    await store.updateLastIndexedCommit('main', 'abc');
+    await store.updateLastIndexedCommit('feature', 'def');
+    await store.updateLastIndexedCommit('main', 'ghi');
+
+    expect(await store.getLastIndexedCommit('main')).toBe('ghi');
+    expect(await store.getLastIndexedCommit('feature')).toBe('def');
+  });
+
+  it('SHOULD name an unreachable server in the error', async () => {
+    fake.fetchMock.mockRejectedValueOnce(new TypeError('fetch failed'));
+
+    await expect(store.getVectorDimensions()).rejects.toThrow(
+      'Could not reach Qdrant at http://qdrant:6333 (fetch failed). Check SCS_IDXR_QDRANT_URL.'
+    );
+  });
+});
+
+describe('createChunkStore qdrant backend', () => {
+  it('SHOULD use the Qdrant settings from the environment', async () => {
+    await withTestEnv(
+      {
+        SCS_IDXR_STORE: 'qdrant',
+        SCS_IDXR_QDRANT_URL: 'http://qdrant:6333',
+        SCS_IDXR_QDRANT_COLLECTION: 'shared',
+      },
+      () => {
+        const store = createChunkStore('my-index');
+        expect(store).toBeInstanceOf(QdrantStore);
+        expect(store.backend).toBe('qdrant');
+      }
+    );
+  });
+});
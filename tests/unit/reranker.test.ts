@@ -0,0 +1,126 @@
+import { describe, it, expect, afterEach, vi } from 'vitest';
+import { SearchResult } from '../../src/utils/elasticsearch';
+import {
+  HttpReranker,
+  Reranker,
+  getConfiguredReranker,
+  getReranker,
+  listRerankers,
+  registerReranker,
+  rerankResults,
+} from '../../src/utils/reranker';
+import { withTestEnv } from './utils/test_env';
+import { makeResult } from './utils/fixtures';
+
+/** A candidate whose content ends with its id, for `FixedReranker` to score. */
+const candidate = (id: string, score: number) => makeResult({ id, score, chunk_hash: id, content: `content of ${id}` });
+
+/** Scores a candidate by the number that ends its content. */
+class FixedReranker implements Reranker {
+  readonly name = 'fixed';
+
+  async rerank(_query: string, candidates: SearchResult[]): Promise<number[]> {
+    return candidates.map((candidate) => Number(candidate.content.match(/(\d+)$/)?.[1] ?? 0));
+  }
+}
+
+describe('reranker registry', () => {
+  it('SHOULD register the http reranker by default', () => {
+    expect(listRerankers()).toContain('http');
+  });
+
+  it('SHOULD resolve custom rerankers case-insensitively', () => {
+    registerReranker('Fixed', () => new FixedReranker());
+
+    expect(getReranker('FIXED').name).toBe('fixed');
+  });
+
+  it('SHOULD throw a helpful error for unknown rerankers', () => {
+    expect(() => getReranker('does-not-exist')).toThrow(/Unknown reranker "does-not-exist".*http/);
+  });
+
+  it('SHOULD return undefined when SCS_IDXR_RERANKER is not set', () =>
+    withTestEnv({ SCS_IDXR_RERANKER: undefined }, () => {
+      expect(getConfiguredReranker()).toBeUndefined();
+    }));
+
+  it('SHOULD require SCS_IDXR_RERANKER_URL for the http reranker', () =>
+    withTestEnv({ SCS_IDXR_RERANKER: 'http', SCS_IDXR_RERANKER_URL: undefined }, () => {
+      expect(() => getConfiguredReranker()).toThrow('SCS_IDXR_RERANKER_URL');
+    }));
+});
+
+describe('rerankResults', () => {
+  it('SHOULD order candidates by the reranker scores', async () => {
+    const candidates = [candidate('c1', 0.9), candidate('c3', 0.8), candidate('c2', 0.7)];
+
+    const reranked = await rerankResults(new FixedReranker(), 'query', candidates);
+
+    expect(reranked.map(({ id, score }) => [id, score])).toEqual([
+      ['c3', 3],
+      ['c2', 2],
+      ['c1', 1],
+    ]);
+  });
+
+  it('SHOULD not call the reranker without candidates', async () => {
+    const reranker = new FixedReranker();
+    const rerankSpy = vi.spyOn(reranker, 'rerank');
+
+    await expect(rerankResults(reranker, 'query', [])).resolves.toEqual([]);
+    expect(rerankSpy).not.toHaveBeenCalled();
+  });
+
+  it('SHOULD reject a score list that does not match the candidates', async () => {
+    const reranker: Reranker = { name: 'short', rerank: async () => [1] };
+
+    await expect(rerankResults(reranker, 'query', [candidate('a', 1), candidate('b', 1)])).rejects.toThrow(
+      'Reranker "short" returned 1 scores for 2 candidates'
+    );
+  });
+});
+
+describe('HttpReranker', () => {
+  afterEach(() => {
+    vi.unstubAllGlobals();
+  });
+
+  it('SHOULD post the query and contents and map the scores back by index', async () => {
+    const fetchMock = vi.fn(async () =>
+      Response.json([
+        { index: 1, score: 0.9 },
+        { index: 0, score: 0.1 },
+      ])
+    );
+    vi.stubGlobal('fetch', fetchMock);
+    const reranker = new HttpReranker({ url: 'http://reranker:8080/', apiKey: 'secret' });
+
+    const scores = await reranker.rerank('retry', [candidate('a', 1), candidate('b', 1)]);
+
+    expect(scores).toEqual([0.1, 0.9]);
+    expect(fetchMock).toHaveBeenCalledWith(
+      'http://reranker:8080/rerank',
+      expect.objectContaining({
+        method: 'POST',
+        headers: { 'content-type': 'application/json', authorization: 'Bearer secret' },
+        body: JSON.stringify({ query: 'retry', texts: ['content of a', 'content of b'] }),
+      })
+    );
+  });
+
+  it('SHOULD report failed requests with the status and body', async () => {
+    vi.stubGlobal('fetch', vi.fn(async () => new Response('model not loaded', { status: 503 })));
+
+    await expect(new HttpReranker({ url: 'http://reranker' }).rerank('q', [candidate('a', 1)])).rejects.toThrow(
+      'Reranker request failed (503): model not loaded'
+    );
+  });
+
+  it('SHOULD name the URL setting when the service is unreachable', async () => {
+    vi.stubGlobal('fetch', vi.fn().mockRejectedValue(new TypeError('fetch failed')));
+
+    await expect(new HttpReranker({ url: 'http://reranker' }).rerank('q', [candidate('a', 1)])).rejects.toThrow(
+      'Could not reach the reranker at http://reranker (fetch failed). Check SCS_IDXR_RERANKER_URL.'
+    );
+  });
+});
@@ -0,0 +1,623 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { gitBlobHash, search, trimSnippet } from '../../src/commands/search_command';
+import * as elasticsearch from '../../src/utils/elasticsearch';
+import { CodeChunk } from '../../src/utils/elasticsearch';
+import { NoopEmbedder } from '../../src/utils/embedder';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { withTestEnv } from './utils/test_env';
+import { makeResult, captureStdout } from './utils/fixtures';
+
+describe('trimSnippet', () => {
+  it('SHOULD drop blank edges and shared indentation', () => {
+    expect(trimSnippet('\n\n    if (a) {\n      b();\n    }   \n\n')).toBe('if (a) {\n  b();\n}');
+  });
+
+  it('SHOULD cap the number of lines when requested', () => {
+    expect(trimSnippet('a\nb\nc\nd', 2)).toBe('a\nb\n... (2 more lines)');
+  });
+});
+
+describe('search command', () => {
+  beforeEach(() => {
+    vi.restoreAllMocks();
+  });
+
+  afterEach(() => {
+    vi.restoreAllMocks();
+  });
+
+  describe('WHEN no client-side embedder is configured', () => {
+    beforeEach(() => {
+      vi.spyOn(elasticsearch, 'indexHasSemanticTextField').mockResolvedValue(true);
+      vi.spyOn(elasticsearch, 'getLocationsForChunkIds').mockResolvedValue({
+        'chunk-1': [{ filePath: 'src/queue.ts', startLine: 10, endLine: 12 }],
+      });
+    });
+
+    it('SHOULD print stable JSON objects with location, symbol, score, and snippet', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code', format: 'json' });
+
+        const parsed = JSON.parse(stdout.output());
+        expect(parsed).toEqual([
+          {
+            filePath: 'src/queue.ts',
+            startLine: 10,
+            endLine: 12,
+            symbol: 'parseQueue',
+            kind: 'function_declaration',
+            language: 'typescript',
+            score: 0.9,
+            snippet: 'function parseQueue() {\n  return 1;\n}',
+            contextBefore: null,
+            contextAfter: null,
+            stale: null,
+            signals: ['semantic'],
+            locations: [{ filePath: 'src/queue.ts', startLine: 10, endLine: 12 }],
+            blame: null,
+            workspace: null,
+            highlights: [{ start: 9, end: 19, line: 10 }],
+          },
+        ]);
+        expect(Object.keys(parsed[0])).toEqual([
+          'filePath',
+          'startLine',
+          'endLine',
+          'symbol',
+          'kind',
+          'language',
+          'score',
+          'snippet',
+          'contextBefore',
+          'contextAfter',
+          'stale',
+          'signals',
+          'locations',
+          'blame',
+          'workspace',
+          'highlights',
+        ]);
+      }));
+
+    it('SHOULD list every location of a chunk that occurs in several files', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+        vi.spyOn(elasticsearch, 'getLocationsForChunkIds').mockResolvedValue({
+          'chunk-1': [
+            { filePath: 'src/queue.ts', startLine: 10, endLine: 12, gitFileHash: 'a' },
+            { filePath: 'vendor/queue.ts', startLine: 3, endLine: 5, gitFileHash: 'b' },
+          ],
+        });
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code', format: 'json' });
+
+        const [hit] = JSON.parse(stdout.output());
+        expect(hit.filePath).toBe('src/queue.ts');
+        expect(hit.locations).toEqual([
+          { filePath: 'src/queue.ts', startLine: 10, endLine: 12 },
+          { filePath: 'vendor/queue.ts', startLine: 3, endLine: 5 },
+        ]);
+      }));
+
+    it('SHOULD drop results below --min-score and honor --limit', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        const searchSpy = vi
+          .spyOn(elasticsearch, 'searchCodeChunks')
+          .mockResolvedValue([makeResult({ score: 0.9 }), makeResult({ id: 'chunk-2', score: 0.2 })]);
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code', format: 'json', limit: '2', minScore: '0.5' });
+
+        expect(searchSpy).toHaveBeenCalledWith('parse the queue', 'code', 2, {}, { overfetchFactor: 10 });
+        expect(JSON.parse(stdout.output()).map((hit: { score: number }) => hit.score)).toEqual([0.9]);
+      }));
+
+    it('SHOULD print file:line and a trimmed snippet by default', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code' });
+
+        expect(stdout.output()).toContain('1. src/queue.ts:10-12  (score: 0.90)  function_declaration parseQueue');
+        expect(stdout.output()).toContain('    function parseQueue() {\n      return 1;\n    }');
+      }));
+
+    it('SHOULD show a split function once, using its best-scoring window', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        const split = { kind: 'function_declaration', parentSymbol: 'parseQueue', filePath: 'src/queue.ts' };
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([
+          makeResult({ ...split, id: 'window-2', score: 0.9, startLine: 31, endLine: 70 }),
+          makeResult({ id: 'chunk-1', score: 0.8 }),
+          makeResult({ ...split, id: 'window-1', score: 0.7, startLine: 1, endLine: 40 }),
+        ]);
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code', format: 'json' });
+
+        const hits = JSON.parse(stdout.output());
+        expect(hits.map((hit: { startLine: number }) => hit.startLine)).toEqual([31, 10]);
+        expect(hits[0].symbol).toBe('parseQueue');
+      }));
+
+    it('SHOULD still return --limit hits WHEN windows of a split function are collapsed', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        const split = { parentSymbol: 'parseQueue', filePath: 'src/queue.ts' };
+        const candidates = [
+          makeResult({ ...split, id: 'window-2', score: 0.9, startLine: 31, endLine: 70 }),
+          makeResult({ ...split, id: 'window-1', score: 0.8, startLine: 1, endLine: 40 }),
+          makeResult({ id: 'chunk-2', filePath: 'src/stack.ts', score: 0.7, startLine: 5, endLine: 9 }),
+        ];
+        const searchSpy = vi
+          .spyOn(elasticsearch, 'searchCodeChunks')
+          .mockImplementation(async (_query, _index, limit) => candidates.slice(0, limit));
+        const stdout = captureStdout();
+
+        await search('parse the queue', { index: 'code', format: 'json', limit: '2' });
+
+        expect(searchSpy.mock.calls.map(([, , limit]) => limit)).toEqual([2, 4]);
+        const hits = JSON.parse(stdout.output());
+        expect(hits.map((hit: { filePath: string }) => hit.filePath)).toEqual(['src/queue.ts', 'src/stack.ts']);
+      }));
+
+    describe('AND context lines are requested', () => {
+      let root: string;
+      const source = ['// queue', 'import x;', '', 'function parseQueue() {', '  return 1;', '}', '', 'export {};', ''];
+
+      beforeEach(() => {
+        root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-context-'));
+        fs.mkdirSync(path.join(root, 'src'));
+        fs.writeFileSync(path.join(root, 'src/queue.ts'), source.join('\n'));
+      });
+
+      afterEach(() => {
+        fs.rmSync(root, { recursive: true, force: true });
+      });
+
+      const mockLocation = (gitFileHash?: string) =>
+        vi.spyOn(elasticsearch, 'getLocationsForChunkIds').mockResolvedValue({
+          'chunk-1': [{ filePath: 'src/queue.ts', startLine: 4, endLine: 6, gitFileHash }],
+        });
+
+      it('SHOULD read the surrounding lines from the working tree', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocation(gitBlobHash(fs.readFileSync(path.join(root, 'src/queue.ts'))));
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          const stdout = captureStdout();
+
+          await search('parse the queue', { index: 'code', format: 'json', contextLines: '2', root });
+
+          const [hit] = JSON.parse(stdout.output());
+          expect(hit).toMatchObject({
+            contextBefore: ['import x;', ''],
+            contextAfter: ['', 'export {};'],
+            stale: false,
+          });
+        }));
+
+      it('SHOULD clamp the context to the start and end of the file', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocation();
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          const stdout = captureStdout();
+
+          await search('parse the queue', { index: 'code', format: 'json', contextLines: '10', root });
+
+          const [hit] = JSON.parse(stdout.output());
+          expect(hit.contextBefore).toEqual(['// queue', 'import x;', '']);
+          expect(hit.contextAfter).toEqual(['', 'export {};']);
+          expect(hit.stale).toBeNull();
+        }));
+
+      it('SHOULD mark results stale when the file changed since indexing', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocation(gitBlobHash(Buffer.from('old content')));
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          const stdout = captureStdout();
+
+          await search('parse the queue', { index: 'code', contextLines: '1', root });
+
+          expect(stdout.output()).toContain('[stale: file changed since indexing]');
+          expect(stdout.output()).toContain('  | \n    function parseQueue() {');
+        }));
+
+      it('SHOULD mark results stale when the file no longer exists', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocation(gitBlobHash(Buffer.from('old content')));
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          fs.rmSync(path.join(root, 'src/queue.ts'));
+          const stdout = captureStdout();
+
+          await search('parse the queue', { index: 'code', format: 'json', contextLines: '1', root });
+
+          const [hit] = JSON.parse(stdout.output());
+          expect(hit).toMatchObject({ contextBefore: null, contextAfter: null, stale: true });
+        }));
+    });
+
+    describe('AND --similar-to names lines of a file', () => {
+      let root: string;
+      const source = ['// queue', 'import x;', '', 'function parseQueue() {', '  return 1;', '}', ''];
+
+      beforeEach(() => {
+        root = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-similar-'));
+        fs.mkdirSync(path.join(root, 'src'));
+        fs.writeFileSync(path.join(root, 'src/queue.ts'), source.join('\n'));
+      });
+
+      afterEach(() => {
+        fs.rmSync(root, { recursive: true, force: true });
+      });
+
+      const mockLocations = (locations: Record<string, elasticsearch.ChunkLocationSummary[]>) =>
+        vi
+          .spyOn(elasticsearch, 'getLocationsForChunkIds')
+          .mockImplementation(async (chunkIds, { perChunkLimit }) =>
+            Object.fromEntries(chunkIds.map((id) => [id, (locations[id] ?? []).slice(0, perChunkLimit)]))
+          );
+
+      it('SHOULD search by the code of the lines and leave out the chunk they are in', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocations({
+            'chunk-1': [{ filePath: 'src/queue.ts', startLine: 4, endLine: 6 }],
+            'chunk-2': [{ filePath: 'src/stack.ts', startLine: 20, endLine: 22 }],
+          });
+          const searchSpy = vi
+            .spyOn(elasticsearch, 'searchCodeChunks')
+            .mockResolvedValue([makeResult({ score: 0.99 }), makeResult({ id: 'chunk-2', score: 0.8 })]);
+          const stdout = captureStdout();
+
+          const similarTo = `${path.join(root, 'src/queue.ts')}:5-6`;
+          await search(undefined, { index: 'code', format: 'json', similarTo, root });
+
+          expect(searchSpy).toHaveBeenCalledWith('  return 1;\n}', 'code', 100, {}, { overfetchFactor: 10 });
+          const hits = JSON.parse(stdout.output());
+          expect(hits.map((hit: { filePath: string }) => hit.filePath)).toEqual(['src/stack.ts']);
+        }));
+
+      it('SHOULD report a chunk that is also elsewhere at its other location', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocations({
+            'chunk-1': [
+              { filePath: 'src/queue.ts', startLine: 4, endLine: 6 },
+              { filePath: 'vendor/queue.ts', startLine: 11, endLine: 13 },
+            ],
+          });
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          const stdout = captureStdout();
+
+          await search(undefined, { index: 'code', format: 'json', similarTo: 'src/queue.ts:1-4', root });
+
+          const [hit] = JSON.parse(stdout.output());
+          expect(hit).toMatchObject({ filePath: 'vendor/queue.ts', startLine: 11, endLine: 13 });
+          expect(hit.locations).toEqual([{ filePath: 'vendor/queue.ts', startLine: 11, endLine: 13 }]);
+          expect(hit.highlights.every((span: { line: number }) => span.line >= 11 && span.line <= 13)).toBe(true);
+        }));
+
+      it('SHOULD keep chunks of the same file that do not overlap the lines', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          mockLocations({ 'chunk-1': [{ filePath: 'src/queue.ts', startLine: 4, endLine: 6 }] });
+          vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({})]);
+          const stdout = captureStdout();
+
+          await search(undefined, { index: 'code', similarTo: 'src/queue.ts:1-2', root });
+
+          expect(stdout.output()).toContain('Code similar to: src/queue.ts:1-2');
+          expect(stdout.output()).toContain('1. src/queue.ts:4-6');
+        }));
+
+      it('SHOULD retrieve more candidates WHEN the windows of one function fill the first batch', () =>
+        withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+          const split = { parentSymbol: 'parseTree', filePath: 'src/tree.ts' };
+          const candidates = [
+            ...Array.from({ length: 150 }, (_, i) => makeResult({ ...split, id: `window-${i}`, score: 0.9 })),
+            makeResult({ id: 'chunk-2', filePath: 'src/stack.ts', score: 0.5 }),
+          ];
+          const searchSpy = vi
+            .spyOn(elasticsearch, 'searchCodeChunks')
+            .mockImplementation(async (_query, _index, limit) => candidates.slice(0, limit));
+          const stdout = captureStdout();
+
+          await search(undefined, { index: 'code', format: 'json', similarTo: 'src/queue.ts:5-6', root });
+
+          expect(searchSpy.mock.calls.map(([, , limit]) => limit)).toEqual([100, 1000]);
+          const hits = JSON.parse(stdout.output());
+          expect(hits.map((hit: { filePath: string }) => hit.filePath)).toEqual(['src/tree.ts', 'src/stack.ts']);
+        }));
+
+      it('SHOULD reject a malformed range, empty lines, and a query alongside it', async () => {
+        await expect(search(undefined, { index: 'code', similarTo: 'src/queue.ts:6-4', root })).rejects.toThrow(
+          'Invalid --similar-to value: src/queue.ts:6-4'
+        );
+        await expect(search(undefined, { index: 'code', similarTo: 'src/queue.ts', root })).rejects.toThrow(
+          'Invalid --similar-to value: src/queue.ts'
+        );
+        await expect(search(undefined, { index: 'code', similarTo: 'src/queue.ts:3', root })).rejects.toThrow(
+          'are empty'
+        );
+        await expect(search('parse', { index: 'code', similarTo: 'src/queue.ts:4-6', root })).rejects.toThrow(
+          'Pass --similar-to without a query or --symbol.'
+        );
+      });
+    });
+
+    it('SHOULD fuse semantic and keyword results in hybrid mode', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([
+          makeResult({ id: 'semantic-only', score: 12, filePath: 'src/a.ts' }),
+          makeResult({ id: 'both', score: 11, filePath: 'src/b.ts' }),
+        ]);
+        const keywordSpy = vi
+          .spyOn(elasticsearch, 'searchByKeyword')
+          .mockResolvedValue([
+            makeResult({ id: 'both', score: 3.2, filePath: 'src/b.ts' }),
+            makeResult({ id: 'keyword-only', score: 1.5, filePath: 'src/c.ts' }),
+          ]);
+        const stdout = captureStdout();
+
+        await search('parseQueue', { index: 'code', format: 'json', mode: 'hybrid' });
+
+        expect(keywordSpy).toHaveBeenCalledWith('parseQueue', 'code', 10, {}, { overfetchFactor: 10 });
+        const hits = JSON.parse(stdout.output());
+        expect(hits.map((hit: { filePath: string }) => hit.filePath)).toEqual(['src/b.ts', 'src/a.ts', 'src/c.ts']);
+        expect(hits.map((hit: { signals: string[] }) => hit.signals)).toEqual([
+          ['semantic', 'keyword'],
+          ['semantic'],
+          ['keyword'],
+        ]);
+      }));
+
+    it('SHOULD explain the contribution of each signal WHEN --explain is given', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([
+          makeResult({ id: 'semantic-only', score: 12, filePath: 'src/a.ts' }),
+          makeResult({ id: 'both', score: 11, filePath: 'src/b.ts' }),
+        ]);
+        vi.spyOn(elasticsearch, 'searchByKeyword').mockResolvedValue([
+          makeResult({ id: 'both', score: 3.2, filePath: 'src/b.ts' }),
+        ]);
+        const stdout = captureStdout();
+
+        await search('parseQueue', { index: 'code', format: 'json', mode: 'hybrid', explain: true });
+
+        const [both, semanticOnly] = JSON.parse(stdout.output());
+        expect(both.explain).toEqual({
+          mode: 'hybrid',
+          fusion: 'rrf',
+          signals: [
+            { signal: 'semantic', rawScore: 11, rank: 2, weight: 0.5, contribution: 0.5 / 62 },
+            { signal: 'keyword', rawScore: 3.2, rank: 1, weight: 0.5, contribution: 0.5 / 61 },
+          ],
+          retrievalScore: both.score,
+          rerankScore: null,
+          score: both.score,
+        });
+        expect(semanticOnly.explain.signals.map((signal: { signal: string }) => signal.signal)).toEqual(['semantic']);
+      }));
+
+    it('SHOULD print the explanation below each result', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        vi.spyOn(elasticsearch, 'searchCodeChunks').mockResolvedValue([makeResult({ filePath: 'src/a.ts' })]);
+        vi.spyOn(elasticsearch, 'searchByKeyword').mockResolvedValue([]);
+        const stdout = captureStdout();
+
+        await search('parseQueue', { index: 'code', mode: 'hybrid', explain: true });
+
+        expect(stdout.output()).toContain(
+          [
+            '   semantic: similarity 0.9000 at rank 1, weight 0.50 -> 0.0082',
+            '   keyword: not found -> 0',
+            '   retrieval score: 0.0082 (hybrid, rrf)',
+            '   final score: 0.0082',
+          ].join('\n')
+        );
+      }));
+
+    it('SHOULD not need semantic search in keyword mode', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        const semanticSpy = vi.spyOn(elasticsearch, 'searchCodeChunks');
+        vi.spyOn(elasticsearch, 'searchByKeyword').mockResolvedValue([makeResult({ score: 4.2 })]);
+        const stdout = captureStdout();
+
+        await search('parseQueue', { index: 'code', format: 'json', mode: 'keyword' });
+
+        expect(semanticSpy).not.toHaveBeenCalled();
+        expect(elasticsearch.indexHasSemanticTextField).not.toHaveBeenCalled();
+        expect(JSON.parse(stdout.output())[0]).toMatchObject({ score: 4.2, signals: ['keyword'] });
+      }));
+
+    it('SHOULD pass --lang, --path, and --kind to the search as filters', () =>
+      withTestEnv({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: undefined }, async () => {
+        const searchSpy = vi
+          .spyOn(elasticsearch, 'searchCodeChunks')
+          .mockResolvedValue([makeResult({ language: 'go', filePath: 'cmd/server/main.go' })]);
+        captureStdout();
+
+        await search('start the server', { index: 'code', format: 'json', lang: 'Go', path: 'cmd/**', kind: 'func' });
+
+        expect(searchSpy).toHaveBeenCalledWith(
+          'start the server',
+          'code',
+          10,
+          { language: 'go', path: 'cmd/**', kind: 'func' },
+          { overfetchFactor: 10 }
+        );
+      }));
+
+    it('SHOULD reject an unknown --lang', async () => {
+      await expect(search('q', { index: 'code', lang: 'klingon' })).rejects.toThrow(
+        'Invalid --lang value: klingon. Must be one of:'
+      );
+    });
+
+    it('SHOULD reject an --alpha outside [0, 1]', async () => {
+      await expect(search('q', { index: 'code', mode: 'hybrid', alpha: '1.5' })).rejects.toThrow(
+        'Invalid --alpha value: 1.5'
+      );
+    });
+
+    it('SHOULD reject an invalid --context-lines', async () => {
+      await expect(search('q', { index: 'code', contextLines: '-1' })).rejects.toThrow(
+        'Invalid --context-lines value: -1'
+      );
+    });
+
+    it('SHOULD reject an invalid --min-score', async () => {
+      await expect(search('q', { index: 'code', minScore: 'abc' })).rejects.toThrow('Invalid --min-score value: abc');
+    });
+
+    it('SHOULD reject an invalid --rerank-candidates', async () => {
+      await expect(search('q', { index: 'code', rerank: true, rerankCandidates: '0' })).rejects.toThrow(
+        'Invalid --rerank-candidates value: 0'
+      );
+    });
+  });
+
+  describe('WHEN SCS_IDXR_EMBEDDER is set', () => {
+    let tmpDir: string;
+
+    beforeEach(() => {
+      tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-search-'));
+    });
+
+    afterEach(() => {
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    });
+
+    it('SHOULD embed the query and search the configured store', () =>
+      withTestEnv(
+        { SCS_IDXR_EMBEDDER: 'noop', SCS_IDXR_STORE: 'sqlite', SCS_IDXR_SQLITE_STORE_DIR: tmpDir },
+        async () => {
+          const embedder = new NoopEmbedder();
+          const chunk: CodeChunk = {
+            type: 'code',
+            language: 'typescript',
+            filePath: 'src/retry.ts',
+            startLine: 4,
+            endLine: 4,
+            chunk_hash: 'retry',
+            content: 'retryWithBackoff();',
+            semantic_text: 'retry with backoff',
+            created_at: '2024-01-01T00:00:00.000Z',
+            updated_at: '2024-01-01T00:00:00.000Z',
+          };
+          const [vector] = await embedder.embed([chunk.semantic_text]);
+          const store = new SqliteStore({ dbPath: path.join(tmpDir, 'code.db') });
+          await store.indexChunks([{ ...chunk, code_vector: vector }]);
+          await store.close();
+          const searchSpy = vi.spyOn(elasticsearch, 'searchCodeChunks');
+          const stdout = captureStdout();
+
+          await search('retry with backoff', { index: 'code', format: 'json' });
+
+          expect(searchSpy).not.toHaveBeenCalled();
+          const [hit] = JSON.parse(stdout.output());
+          expect(hit).toMatchObject({ filePath: 'src/retry.ts', startLine: 4, endLine: 4, symbol: null });
+          expect(hit.score).toBeCloseTo(1, 5);
+        }
+      ));
+  });
+
+  describe('WHEN --symbol is given', () => {
+    let tmpDir: string;
+    const env = () => ({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: 'sqlite', SCS_IDXR_SQLITE_STORE_DIR: tmpDir });
+
+    beforeEach(async () => {
+      tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-search-'));
+      const chunk = (name: string, filePath: string, startLine: number): CodeChunk => ({
+        type: 'code',
+        language: 'typescript',
+        kind: 'function_declaration',
+        filePath,
+        startLine,
+        endLine: startLine + 2,
+        symbols: [
+          { name, kind: 'function.name', line: startLine },
+          { name: 'readFile', kind: 'function.call', line: startLine + 1 },
+        ],
+        chunk_hash: name,
+        content: `function ${name}() {\n  return readFile();\n}`,
+        semantic_text: name,
+        created_at: '2024-01-01T00:00:00.000Z',
+        updated_at: '2024-01-01T00:00:00.000Z',
+      });
+      const store = new SqliteStore({ dbPath: path.join(tmpDir, 'code.db') });
+      await store.indexChunks([
+        chunk('parseConfig', 'src/config.ts', 10),
+        chunk('parseConfigFile', 'src/files.ts', 1),
+        chunk('praseConfig', 'src/typo.ts', 5),
+      ]);
+      await store.close();
+    });
+
+    afterEach(() => {
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    });
+
+    it('SHOULD print the definitions of matching symbols as JSON, best match first, without an embedder', () =>
+      withTestEnv(env(), async () => {
+        const stdout = captureStdout();
+
+        await search(undefined, { index: 'code', format: 'json', symbol: 'ParseConfig' });
+
+        const hits = JSON.parse(stdout.output());
+        expect(hits.map((hit: { symbol: string; match: string }) => [hit.symbol, hit.match])).toEqual([
+          ['parseConfig', 'exact'],
+          ['parseConfigFile', 'prefix'],
+          ['praseConfig', 'fuzzy'],
+        ]);
+        expect(hits[0]).toEqual({
+          symbol: 'parseConfig',
+          kind: 'function.name',
+          containerPath: null,
+          filePath: 'src/config.ts',
+          line: 10,
+          startLine: 10,
+          endLine: 12,
+          language: 'typescript',
+          score: 0.95,
+          match: 'exact',
+          workspace: null,
+        });
+      }));
+
+    it('SHOULD print one line per symbol by default and honor --limit', () =>
+      withTestEnv(env(), async () => {
+        const stdout = captureStdout();
+
+        await search(undefined, { index: 'code', symbol: 'parseConfig', limit: '1' });
+
+        expect(stdout.output()).toBe(
+          [
+            'Symbols matching: "parseConfig"',
+            '',
+            '1. parseConfig (function.name)  src/config.ts:10  (exact, score: 1.00)',
+            '',
+            'Total results: 1',
+          ].join('\n')
+        );
+      }));
+
+    it('SHOULD not list symbols that are only called', () =>
+      withTestEnv(env(), async () => {
+        const stdout = captureStdout();
+
+        await search(undefined, { index: 'code', format: 'json', symbol: 'readFile' });
+
+        expect(JSON.parse(stdout.output())).toEqual([]);
+      }));
+
+    it('SHOULD need exactly one of a query and --symbol', async () => {
+      await expect(search('parse', { index: 'code', symbol: 'parseConfig' })).rejects.toThrow(/not both/);
+      await expect(search(undefined, { index: 'code' })).rejects.toThrow(/Pass a query, or a symbol name/);
+    });
+  });
+});
@@ -0,0 +1,101 @@
+import { describe, it, expect } from 'vitest';
+
+import {
+  MAX_POST_FILTER_CANDIDATES,
+  createPathMatcher,
+  expandKindFilter,
+  fetchPostFiltered,
+  hasSearchFilters,
+} from '../../src/utils/search_filters';
+
+describe('createPathMatcher', () => {
+  it('SHOULD treat patterns without wildcards as path prefixes', () => {
+    const matches = createPathMatcher('internal/');
+
+    expect(matches('internal/server/http.go')).toBe(true);
+    expect(matches('cmd/internal/main.go')).toBe(false);
+    expect(createPathMatcher('./src/')('src/index.ts')).toBe(true);
+  });
+
+  it('SHOULD keep single-star globs within one directory', () => {
+    const matches = createPathMatcher('src/*.ts');
+
+    expect(matches('src/index.ts')).toBe(true);
+    expect(matches('src/utils/parser.ts')).toBe(false);
+    expect(matches('src/index.tsx')).toBe(false);
+  });
+
+  it('SHOULD let double-star globs span directories', () => {
+    expect(createPathMatcher('cmd/**')('cmd/server/main.go')).toBe(true);
+    expect(createPathMatcher('**/*_test.go')('handler_test.go')).toBe(true);
+    expect(createPathMatcher('**/*_test.go')('pkg/api/handler_test.go')).toBe(true);
+    expect(createPathMatcher('**/*_test.go')('pkg/api/handler.go')).toBe(false);
+  });
+
+  it('SHOULD match glob metacharacters other than * and ? literally', () => {
+    expect(createPathMatcher('src/(legacy)/*.js')('src/(legacy)/a.js')).toBe(true);
+    expect(createPathMatcher('src/?.js')('src/a.js')).toBe(true);
+    expect(createPathMatcher('src/?.js')('src/ab.js')).toBe(false);
+  });
+});
+
+describe('expandKindFilter', () => {
+  it('SHOULD expand categories to the node types of all languages', () => {
+    expect(expandKindFilter('func')).toEqual(expect.arrayContaining(['function_declaration', 'method_definition']));
+    expect(expandKindFilter('type')).toEqual(expect.arrayContaining(['interface_declaration', 'type_declaration']));
+    expect(expandKindFilter('const')).toContain('const_declaration');
+  });
+
+  it('SHOULD pass other kinds through as node types', () => {
+    expect(expandKindFilter('class_declaration')).toEqual(['class_declaration']);
+  });
+});
+
+describe('hasSearchFilters', () => {
+  it('SHOULD ignore unset and empty filters', () => {
+    expect(hasSearchFilters(undefined)).toBe(false);
+    expect(hasSearchFilters({ language: '' })).toBe(false);
+    expect(hasSearchFilters({ kind: 'func' })).toBe(true);
+  });
+});
+
+describe('fetchPostFiltered', () => {
+  const search = (matching: number[], pool: number) => {
+    const requested: number[] = [];
+    const fetch = async (candidates: number) => {
+      requested.push(candidates);
+      const retrieved = Array.from({ length: Math.min(candidates, pool) }, (_, i) => i);
+      return { results: retrieved.filter((i) => matching.includes(i)), exhausted: candidates >= pool };
+    };
+    return { requested, fetch };
+  };
+
+  it('SHOULD stop after one search when enough candidates pass', async () => {
+    const { requested, fetch } = search([1, 3, 5], 1000);
+
+    expect(await fetchPostFiltered(2, 10, fetch)).toEqual([1, 3]);
+    expect(requested).toEqual([20]);
+  });
+
+  it('SHOULD fetch more candidates until k pass', async () => {
+    const { requested, fetch } = search([150, 420], 1000);
+
+    expect(await fetchPostFiltered(2, 10, fetch)).toEqual([150, 420]);
+    expect(requested).toEqual([20, 200, 2000]);
+  });
+
+  it('SHOULD stop once the store has no more candidates', async () => {
+    const { requested, fetch } = search([7], 30);
+
+    expect(await fetchPostFiltered(2, 10, fetch)).toEqual([7]);
+    expect(requested).toEqual([20, 200]);
+  });
+
+  it('SHOULD bound the candidates of a filter that matches nothing', async () => {
+    const { requested, fetch } = search([], Infinity);
+
+    expect(await fetchPostFiltered(5, 1, fetch)).toEqual([]);
+    expect(requested.at(-1)).toBe(MAX_POST_FILTER_CANDIDATES);
+    expect(requested.length).toBeLessThan(15);
+  });
+});
@@ -0,0 +1,137 @@
+import http from 'http';
+import { AddressInfo } from 'net';
+import { describe, it, expect, afterEach, vi } from 'vitest';
+
+import { createSearchServer } from '../../src/commands/serve_command';
+import { SearchHit } from '../../src/utils/search';
+
+const HIT: SearchHit = {
+  filePath: 'src/queue.ts',
+  startLine: 10,
+  endLine: 12,
+  symbol: 'parseQueue',
+  kind: 'function_declaration',
+  language: 'typescript',
+  score: 0.9,
+  snippet: 'function parseQueue() {}',
+  contextBefore: null,
+  contextAfter: null,
+  stale: null,
+  signals: ['semantic'],
+  locations: [{ filePath: 'src/queue.ts', startLine: 10, endLine: 12 }],
+  blame: null,
+  workspace: null,
+  highlights: [{ start: 9, end: 19, line: 10 }],
+};
+
+describe('search server', () => {
+  let server: http.Server | undefined;
+
+  afterEach(async () => {
+    await new Promise((resolve) => server?.close(resolve) ?? resolve(undefined));
+    server = undefined;
+  });
+
+  async function start(
+    search: (query: string, options: object) => Promise<SearchHit[]>,
+    options: { requestTimeoutMs?: number; authToken?: string } = {}
+  ): Promise<string> {
+    server = createSearchServer({ search }, { requestTimeoutMs: 5000, ...options });
+    await new Promise<void>((resolve) => server!.listen(0, '127.0.0.1', resolve));
+    return `http://127.0.0.1:${(server.address() as AddressInfo).port}`;
+  }
+
+  const postSearch = (url: string, body: unknown, headers: Record<string, string> = {}) =>
+    fetch(`${url}/search`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', ...headers },
+      body: typeof body === 'string' ? body : JSON.stringify(body),
+    });
+
+  it('SHOULD answer health checks', async () => {
+    const url = await start(async () => []);
+
+    const response = await fetch(`${url}/healthz`);
+
+    expect(response.status).toBe(200);
+    expect(await response.json()).toEqual({ status: 'ok' });
+  });
+
+  it('SHOULD search the index with the query, limit, and filters of the request', async () => {
+    const search = vi.fn(async () => [HIT]);
+    const url = await start(search);
+
+    const response = await postSearch(url, { query: 'parse the queue', limit: 3, filters: { language: 'typescript' } });
+
+    expect(response.status).toBe(200);
+    expect(await response.json()).toEqual({ results: [HIT] });
+    expect(search).toHaveBeenCalledWith('parse the queue', {
+      limit: 3,
+      mode: undefined,
+      filters: { language: 'typescript' },
+    });
+  });
+
+  it('SHOULD serve concurrent requests', async () => {
+    const url = await start(async (query) => {
+      await new Promise((resolve) => setTimeout(resolve, 20));
+      return [{ ...HIT, symbol: query }];
+    });
+
+    const responses = await Promise.all(['a', 'b', 'c'].map((query) => postSearch(url, { query })));
+    const bodies = await Promise.all(responses.map((response) => response.json()));
+
+    expect(bodies.map((body) => body.results[0].symbol)).toEqual(['a', 'b', 'c']);
+  });
+
+  it('SHOULD reject invalid requests with 400', async () => {
+    const search = vi.fn(async () => []);
+    const url = await start(search);
+
+    const invalid = [
+      'not json',
+      { limit: 5 },
+      { query: 'q', limit: 0 },
+      { query: 'q', mode: 'fuzzy' },
+      { query: 'q', filters: { owner: 'me' } },
+    ];
+    for (const body of invalid) {
+      const response = await postSearch(url, body);
+      expect(response.status).toBe(400);
+      expect((await response.json()).error).toEqual(expect.any(String));
+    }
+    expect(search).not.toHaveBeenCalled();
+  });
+
+  it('SHOULD require the bearer token for searches when one is configured', async () => {
+    const url = await start(async () => [HIT], { authToken: 'secret' });
+
+    const missing = await postSearch(url, { query: 'q' });
+    expect(missing.status).toBe(401);
+    expect(missing.headers.get('www-authenticate')).toBe('Bearer');
+    expect((await postSearch(url, { query: 'q' }, { Authorization: 'Bearer wrong' })).status).toBe(401);
+    expect((await postSearch(url, { query: 'q' }, { Authorization: 'Bearer secret' })).status).toBe(200);
+    expect((await fetch(`${url}/healthz`)).status).toBe(200);
+  });
+
+  it('SHOULD answer with 503 when a search exceeds the request timeout', async () => {
+    const url = await start(() => new Promise(() => undefined), { requestTimeoutMs: 50 });
+
+    const response = await postSearch(url, { query: 'q' });
+
+    expect(response.status).toBe(503);
+    expect((await response.json()).error).toMatch(/did not finish within 50 ms/);
+  });
+
+  it('SHOULD report search failures with 500 and unknown routes with 404', async () => {
+    const url = await start(async () => {
+      throw new Error('Semantic search needs an embedder.');
+    });
+
+    const failed = await postSearch(url, { query: 'q' });
+    expect(failed.status).toBe(500);
+    expect(await failed.json()).toEqual({ error: 'Semantic search needs an embedder.' });
+    expect((await fetch(`${url}/nope`)).status).toBe(404);
+    expect((await fetch(`${url}/search`)).status).toBe(405);
+  });
+});
@@ -0,0 +1,59 @@
+import { describe, it, expect } from 'vitest';
+
+import { getSqlStatementVerb, getSqlTableSymbols, splitSqlStatements } from '../../src/utils/sql';
+
+describe('getSqlStatementVerb', () => {
+  it('should recognize statements by their shape', () => {
+    const join = '\n  SELECT *\n  FROM orders o JOIN customers c ON c.id = o.customer_id\n';
+
+    expect(getSqlStatementVerb('UPDATE orders SET status = $1 WHERE id = $2')).toBe('update');
+    expect(getSqlStatementVerb(join)).toBe('select');
+    expect(getSqlStatementVerb('insert into audit (event) values (?)')).toBe('insert');
+    expect(getSqlStatementVerb('WITH recent AS (SELECT 1) SELECT * FROM recent')).toBe('with');
+    expect(getSqlStatementVerb('-- expired sessions\ndelete from sessions where expires_at < now()')).toBe('delete');
+  });
+
+  it('should not take prose starting with a statement verb for SQL', () => {
+    expect(getSqlStatementVerb('Update the cache')).toBeUndefined();
+    expect(getSqlStatementVerb('Delete the file?')).toBeUndefined();
+    expect(getSqlStatementVerb('Select a file from the list')).toBeUndefined();
+    expect(getSqlStatementVerb('select the rows from the table where the id matches.')).toBeUndefined();
+  });
+});
+
+describe('splitSqlStatements', () => {
+  it('should split at semicolons outside strings, comments, and dollar-quoted bodies', () => {
+    const script = [
+      "CREATE TABLE notes (body text DEFAULT 'a;b');",
+      '-- touch; clears the notes',
+      'CREATE FUNCTION touch() RETURNS trigger AS $$',
+      'BEGIN',
+      '  UPDATE notes SET body = NULL;',
+      'END;',
+      '$$ LANGUAGE plpgsql;',
+      '/* only a comment; */',
+    ].join('\n');
+
+    const statements = splitSqlStatements(script);
+
+    expect(statements.map((statement) => [statement.keyword, statement.start])).toEqual([
+      ['create', 0],
+      ['create', 46],
+    ]);
+    expect(statements[1].text.split('\n')).toHaveLength(6);
+  });
+});
+
+describe('getSqlTableSymbols', () => {
+  it('should name the defined table and the tables a statement reads or writes', () => {
+    expect(getSqlTableSymbols('CREATE TABLE IF NOT EXISTS "orders" (id int)', 4)).toEqual([
+      { name: 'orders', kind: 'table.name', line: 4 },
+    ]);
+    expect(
+      getSqlTableSymbols('INSERT INTO orders (id)\nSELECT id FROM staging\nON CONFLICT (id) DO UPDATE SET id = 1', 1)
+    ).toEqual([
+      { name: 'orders', kind: 'table.reference', line: 1 },
+      { name: 'staging', kind: 'table.reference', line: 2 },
+    ]);
+  });
+});
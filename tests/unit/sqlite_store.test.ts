@@ -0,0 +1,430 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { createChunkStore } from '../../src/utils/chunk_store';
+import { ElasticsearchStore } from '../../src/utils/elasticsearch_store';
+import { CodeChunk, getChunkDocumentId } from '../../src/utils/elasticsearch';
+import { withTestEnv } from './utils/test_env';
+import { makeChunk } from './utils/fixtures';
+
+describe('SqliteStore', () => {
+  let tmpDir: string;
+  let dbPath: string;
+  let store: SqliteStore;
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-sqlite-store-'));
+    dbPath = path.join(tmpDir, 'nested', 'store.db');
+    store = new SqliteStore({ dbPath });
+  });
+
+  afterEach(async () => {
+    await store.close();
+    vi.restoreAllMocks();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  it('SHOULD create the database and schema on first use', async () => {
+    expect(fs.existsSync(dbPath)).toBe(false);
+
+    await store.setup();
+
+    expect(fs.existsSync(dbPath)).toBe(true);
+    expect(await store.getVectorDimensions()).toBeNull();
+  });
+
+  it('SHOULD upsert chunks by chunk id', async () => {
+    const chunk = makeChunk({ code_vector: [1, 0, 0] });
+
+    const first = await store.indexChunks([chunk]);
+    const second = await store.indexChunks([{ ...chunk, semantic_text: 'updated', code_vector: [0, 1, 0] }]);
+
+    expect(first.succeeded).toHaveLength(1);
+    expect(second.succeeded).toHaveLength(1);
+    const results = await store.search([0, 1, 0], 10);
+    expect(results).toHaveLength(1);
+    expect(results[0].semantic_text).toBe('updated');
+    expect(results[0].score).toBeCloseTo(1, 6);
+  });
+
+  it('SHOULD return the top-k chunks with scores, best match first', async () => {
+    await store.indexChunks([
+      makeChunk({ content: 'a', chunk_hash: 'a', code_vector: [1, 0, 0] }),
+      makeChunk({ content: 'b', chunk_hash: 'b', filePath: 'src/b.ts', code_vector: [0.8, 0.6, 0] }),
+      makeChunk({ content: 'c', chunk_hash: 'c', filePath: 'src/c.ts', code_vector: [0, 0, 1] }),
+    ]);
+
+    const results = await store.search([1, 0, 0], 2);
+
+    expect(results.map((r) => r.content)).toEqual(['a', 'b']);
+    expect(results[0].score).toBeCloseTo(1, 6);
+    expect(results[1].score).toBeCloseTo(0.8, 6);
+    expect(results[1]).toMatchObject({ filePath: 'src/b.ts', startLine: 1, endLine: 3, language: 'typescript' });
+  });
+
+  it('SHOULD reject chunks whose vectors do not match the stored dimensions', async () => {
+    await store.indexChunks([makeChunk({ code_vector: [1, 0, 0] })]);
+
+    const result = await store.indexChunks([makeChunk({ content: 'other', code_vector: [1, 0] })]);
+
+    expect(result.succeeded).toEqual([]);
+    expect(result.failed).toHaveLength(1);
+    expect(result.failed[0].error).toEqual({ message: 'code_vector has 2 dimensions, store expects 3' });
+    await expect(store.search([1, 0], 1)).rejects.toThrow(/3/);
+  });
+
+  it('SHOULD score vectors of any length by cosine similarity WHEN the metric is cosine', async () => {
+    await store.indexChunks([makeChunk({ code_vector: [3, 4, 0] })]);
+
+    const [result] = await store.search([0, 2, 0], 1);
+
+    expect(result.score).toBeCloseTo(0.8, 6);
+  });
+
+  it('SHOULD rank the nearest vectors first WHEN the metric is euclidean', async () => {
+    const euclidean = new SqliteStore({ dbPath: path.join(tmpDir, 'l2.db'), metric: 'euclidean' });
+    try {
+      await euclidean.indexChunks([
+        makeChunk({ content: 'far', chunk_hash: 'far', code_vector: [4, 0, 0] }),
+        makeChunk({ content: 'near', chunk_hash: 'near', filePath: 'src/b.ts', code_vector: [2, 1, 0] }),
+      ]);
+
+      const results = await euclidean.search([2, 0, 0], 2);
+
+      expect(results.map((r) => r.content)).toEqual(['near', 'far']);
+      expect(results[0].score).toBeCloseTo(0.5, 6);
+      expect(results[1].score).toBeCloseTo(0.2, 6);
+    } finally {
+      await euclidean.close();
+    }
+  });
+
+  it('SHOULD refuse a store written for another metric', async () => {
+    await store.indexChunks([makeChunk({ code_vector: [1, 0, 0] })]);
+    await store.close();
+
+    store = new SqliteStore({ dbPath, metric: 'dot_product' });
+
+    await expect(store.search([1, 0, 0], 1)).rejects.toThrow(/holds vectors compared by cosine, but the dot_product/);
+    await expect(store.indexChunks([makeChunk({ content: 'other', code_vector: [0, 1, 0] })])).rejects.toThrow(
+      /Recreate the store/
+    );
+  });
+
+  it('SHOULD delete locations by file path and drop orphaned chunks', async () => {
+    const shared = { content: 'shared', chunk_hash: 'shared', code_vector: [1, 0, 0] };
+    await store.indexChunks([
+      makeChunk({ ...shared, filePath: 'src/a.ts' }),
+      makeChunk({ ...shared, filePath: 'src/b.ts', git_file_hash: 'hash-b' }),
+      makeChunk({ content: 'only-a', chunk_hash: 'only-a', code_vector: [0, 1, 0] }),
+    ]);
+
+    expect(await store.getIndexedFilePaths()).toEqual(['src/a.ts', 'src/b.ts']);
+
+    const deleted = await store.deleteDocumentsByFilePaths(['src/a.ts']);
+
+    expect(deleted).toEqual({ locations: 2, chunks: 1 });
+    expect(await store.getIndexedFilePaths()).toEqual(['src/b.ts']);
+    const results = await store.search([1, 0, 0], 10);
+    expect(results.map((r) => r.content)).toEqual(['shared']);
+    expect(results[0].filePath).toBe('src/b.ts');
+    expect(results[0].git_file_hash).toBe('hash-b');
+    expect(await store.getIndexedFileHashes('main')).toEqual(new Map([['src/b.ts', new Set(['hash-b'])]]));
+  });
+
+  it('SHOULD keep the chunks in keepChunkIds with their vectors WHEN their file is deleted', async () => {
+    const kept = makeChunk({ content: 'unchanged', chunk_hash: 'unchanged', code_vector: [0, 0, 1] });
+    await store.indexChunks([kept, makeChunk({ content: 'edited', chunk_hash: 'edited', code_vector: [0, 1, 0] })]);
+    const keptId = getChunkDocumentId(kept);
+
+    const deleted = await store.deleteDocumentsByFilePaths(['src/a.ts'], { keepChunkIds: new Set([keptId]) });
+
+    expect(deleted).toEqual({ locations: 2, chunks: 1 });
+    expect(await store.getIndexedFilePaths()).toEqual([]);
+    expect(await store.getChunkVectors([keptId, getChunkDocumentId(makeChunk({ content: 'edited' }))])).toEqual(
+      new Map([[keptId, [0, 0, 1]]])
+    );
+
+    await store.indexChunks([{ ...kept, startLine: 10, endLine: 12, code_vector: undefined }]);
+
+    const [result] = await store.search([0, 0, 1], 1);
+    expect(result).toMatchObject({ content: 'unchanged', startLine: 10 });
+  });
+
+  it('SHOULD return the blame of each location', async () => {
+    const blame = { commit: 'a'.repeat(40), author: 'Ada', date: '2024-05-01T10:00:00.000Z' };
+    await store.indexChunks([
+      makeChunk({ code_vector: [1, 0, 0], blame }),
+      makeChunk({ filePath: 'src/b.ts', code_vector: [1, 0, 0] }),
+    ]);
+
+    const [result] = await store.search([1, 0, 0], 1);
+    const locations = await store.getChunkLocations([result.id], 10);
+
+    expect(result.blame).toEqual(blame);
+    expect(locations[result.id].map((location) => location.blame)).toEqual([blame, undefined]);
+  });
+
+  it('SHOULD rank exact symbol matches first in keyword search', async () => {
+    await store.indexChunks([
+      makeChunk({ content: 'return parseQueue(items);', chunk_hash: 'caller', filePath: 'src/caller.ts' }),
+      makeChunk({
+        content: 'function parseQueue(raw) {\n  return raw.split(",");\n}',
+        chunk_hash: 'definition',
+        filePath: 'src/queue.ts',
+        symbols: [{ name: 'parseQueue', kind: 'function.name', line: 1 }],
+      }),
+      makeChunk({ content: 'const unrelated = true;', chunk_hash: 'other', filePath: 'src/other.ts' }),
+    ]);
+
+    const results = await store.keywordSearch('where is parseQueue()?', 10);
+
+    expect(results.map((r) => r.filePath)).toEqual(['src/queue.ts', 'src/caller.ts']);
+    expect(results[0].score).toBeGreaterThan(results[1].score);
+    expect(await store.keywordSearch('!!!', 10)).toEqual([]);
+  });
+
+  it('SHOULD match the words of compound symbol names in keyword search', async () => {
+    await store.indexChunks([
+      makeChunk({
+        content: 'func ParseJSONConfig(raw []byte) (*Config, error) {\n\treturn decode(raw)\n}',
+        chunk_hash: 'definition',
+        filePath: 'config/parse.go',
+        symbols: [{ name: 'ParseJSONConfig', kind: 'function.name', line: 1 }],
+      }),
+      makeChunk({ content: 'const unrelated = true;', chunk_hash: 'other', filePath: 'src/other.ts' }),
+    ]);
+
+    expect((await store.keywordSearch('parse json', 10)).map((r) => r.filePath)).toEqual(['config/parse.go']);
+    expect((await store.keywordSearch('parse_json_config', 10)).map((r) => r.filePath)).toEqual(['config/parse.go']);
+  });
+
+  describe('WHEN search filters are given', () => {
+    beforeEach(async () => {
+      await store.indexChunks([
+        makeChunk({
+          content: 'func Serve() {}',
+          chunk_hash: 'serve',
+          language: 'go',
+          kind: 'function_declaration',
+          filePath: 'cmd/server/main.go',
+          code_vector: [1, 0, 0],
+        }),
+        makeChunk({
+          content: 'type Server struct {}',
+          chunk_hash: 'server',
+          language: 'go',
+          kind: 'type_declaration',
+          filePath: 'internal/server.go',
+          code_vector: [0.9, 0.1, 0],
+        }),
+        makeChunk({
+          content: 'function serve() {}',
+          chunk_hash: 'serve-ts',
+          kind: 'function_declaration',
+          filePath: 'cmd/serve.ts',
+          code_vector: [0.8, 0.2, 0],
+        }),
+      ]);
+    });
+
+    it('SHOULD only score chunks matching every filter', async () => {
+      const byLanguage = await store.search([1, 0, 0], 10, { language: 'go' });
+      const byKind = await store.search([1, 0, 0], 10, { language: 'go', kind: 'func' });
+
+      expect(byLanguage.map((r) => r.filePath)).toEqual(['cmd/server/main.go', 'internal/server.go']);
+      expect(byKind.map((r) => r.filePath)).toEqual(['cmd/server/main.go']);
+    });
+
+    it('SHOULD match path prefixes and globs', async () => {
+      const byPrefix = await store.search([1, 0, 0], 10, { path: 'internal/' });
+      const byGlob = await store.search([1, 0, 0], 10, { path: 'cmd/**' });
+
+      expect(byPrefix.map((r) => r.filePath)).toEqual(['internal/server.go']);
+      expect(byGlob.map((r) => r.filePath)).toEqual(['cmd/server/main.go', 'cmd/serve.ts']);
+    });
+
+    it('SHOULD report a location under the filtered path', async () => {
+      await store.indexChunks([
+        makeChunk({
+          content: 'type Server struct {}',
+          chunk_hash: 'server',
+          language: 'go',
+          kind: 'type_declaration',
+          filePath: 'vendor/server.go',
+          code_vector: [0.9, 0.1, 0],
+        }),
+      ]);
+
+      const [result] = await store.search([1, 0, 0], 1, { path: 'vendor/*.go' });
+
+      expect(result.filePath).toBe('vendor/server.go');
+    });
+
+    it('SHOULD apply filters to keyword search', async () => {
+      const results = await store.keywordSearch('Serve serve', 10, { kind: 'func', path: 'cmd/' });
+
+      expect(results.map((r) => r.filePath).sort()).toEqual(['cmd/serve.ts', 'cmd/server/main.go']);
+      expect(await store.keywordSearch('Server', 10, { language: 'typescript' })).toEqual([]);
+    });
+  });
+
+  describe('WHEN several workspaces share the store', () => {
+    beforeEach(async () => {
+      const shared = { content: 'shared', chunk_hash: 'shared', code_vector: [1, 0, 0] };
+      await store.indexChunks([
+        makeChunk({ ...shared, workspace: 'api' }),
+        makeChunk({ ...shared, workspace: 'web', git_file_hash: 'hash-web' }),
+        makeChunk({ content: 'web only', chunk_hash: 'web', filePath: 'src/web.ts', workspace: 'web' }),
+        makeChunk({ content: 'unlabeled', chunk_hash: 'old', filePath: 'src/old.ts', code_vector: [0, 1, 0] }),
+      ]);
+    });
+
+    it('SHOULD scope file hashes, paths, and deletes to one workspace and its unlabeled locations', async () => {
+      expect(await store.getIndexedFileHashes('main', 'api')).toEqual(
+        new Map([
+          ['src/a.ts', new Set(['hash-a'])],
+          ['src/old.ts', new Set(['hash-a'])],
+        ])
+      );
+      expect(await store.getIndexedFilePaths('web')).toEqual(['src/a.ts', 'src/old.ts', 'src/web.ts']);
+
+      const deleted = await store.deleteDocumentsByFilePaths(['src/a.ts'], { workspace: 'api' });
+
+      expect(deleted).toEqual({ locations: 1, chunks: 0 });
+      const [result] = await store.search([1, 0, 0], 1);
+      expect(result).toMatchObject({ content: 'shared', workspace: 'web', git_file_hash: 'hash-web' });
+    });
+
+    it('SHOULD only return chunks with a location in the filtered workspace', async () => {
+      const results = await store.search([1, 0, 0], 10, { workspace: 'api' });
+
+      expect(results.map((r) => [r.content, r.workspace])).toEqual([
+        ['shared', 'api'],
+        ['unlabeled', undefined],
+      ]);
+      expect((await store.keywordSearch('web', 10, { workspace: 'api' })).map((r) => r.content)).toEqual([]);
+    });
+
+    it('SHOULD count the files and chunks of each workspace', async () => {
+      expect(await store.getWorkspaces()).toEqual([
+        { workspace: null, files: 1, chunks: 1 },
+        { workspace: 'api', files: 1, chunks: 1 },
+        { workspace: 'web', files: 2, chunks: 2 },
+      ]);
+    });
+  });
+
+  it('SHOULD drop deleted chunks from keyword search', async () => {
+    await store.indexChunks([makeChunk({ content: 'retry_with_backoff();', chunk_hash: 'retry' })]);
+
+    await store.deleteDocumentsByFilePaths(['src/a.ts']);
+
+    expect(await store.keywordSearch('retry_with_backoff', 10)).toEqual([]);
+  });
+
+  it('SHOULD count files, chunks, languages, and kinds', async () => {
+    await store.indexChunks([
+      makeChunk({ content: 'function a() {}', kind: 'function_declaration' }),
+      makeChunk({ content: 'function a() {}', kind: 'function_declaration', filePath: 'src/copy.ts' }),
+      makeChunk({ content: 'class B {}', kind: 'class_declaration' }),
+      makeChunk({ content: '# Docs', language: 'markdown', type: 'doc', filePath: 'README.md' }),
+    ]);
+
+    const stats = await store.getStats();
+
+    expect(stats).toMatchObject({
+      files: 3,
+      chunks: 3,
+      languages: { typescript: 2, markdown: 1 },
+      kinds: { function_declaration: 1, class_declaration: 1 },
+    });
+    expect(stats.sizeBytes).toBeGreaterThan(0);
+  });
+
+  it('SHOULD persist the last indexed commit per branch', async () => {
+    expect(await store.getLastIndexedCommit('main')).toBeNull();
+
+    await store.updateLastIndexedCommit('main', 'abc');
+    await store.updateLastIndexedCommit('main', 'def');
+
+    expect(await store.getLastIndexedCommit('main')).toBe('def');
+    expect(await store.getLastIndexedCommit('other')).toBeNull();
+  });
+
+  it('SHOULD record the embedding model until clean', async () => {
+    expect(await store.getEmbeddingModel()).toBeNull();
+
+    await store.setEmbeddingModel({ embedder: 'noop', template: '{text}' });
+    await store.setEmbeddingModel({ embedder: 'http:small', template: '{symbol}\n{body}' });
+    expect(await store.getEmbeddingModel()).toEqual({ embedder: 'http:small', template: '{symbol}\n{body}' });
+
+    await store.clean();
+    expect(await store.getEmbeddingModel()).toBeNull();
+  });
+
+  it('SHOULD export each chunk with its vector once per location, a page at a time', async () => {
+    const blame = { commit: 'a'.repeat(40), author: 'Ada', date: '2024-05-01T10:00:00.000Z' };
+    const chunks = [
+      makeChunk({ code_vector: [1, 0, 0], directoryPath: 'src', directoryName: 'src', directoryDepth: 1, blame }),
+      makeChunk({ filePath: 'src/b.ts', startLine: 4, endLine: 6, code_vector: [1, 0, 0] }),
+      makeChunk({ content: 'const c = 3;', chunk_hash: 'chunk-c', filePath: 'src/c.ts', code_vector: [0, 0, 1] }),
+    ];
+    await store.indexChunks(chunks);
+
+    const pages: CodeChunk[][] = [];
+    for await (const page of store.exportChunks(1)) {
+      pages.push(page);
+    }
+
+    expect(pages.map((page) => page.length).sort()).toEqual([1, 2]);
+    expect(pages.flat()).toEqual(
+      expect.arrayContaining(
+        chunks.map((chunk) => ({ ...chunk, created_at: expect.any(String), updated_at: expect.any(String) }))
+      )
+    );
+  });
+
+  it('SHOULD remove all chunks on clean', async () => {
+    await store.indexChunks([makeChunk({ code_vector: [1, 0, 0] })]);
+
+    await store.clean();
+
+    expect(await store.search([1, 0, 0], 10)).toEqual([]);
+    expect(await store.getVectorDimensions()).toBeNull();
+  });
+
+  it('SHOULD surface a clear error when the filesystem is read-only', async () => {
+    vi.spyOn(fs, 'mkdirSync').mockImplementation(() => {
+      throw Object.assign(new Error(`EROFS: read-only file system, mkdir '${tmpDir}'`), { code: 'EROFS' });
+    });
+
+    await expect(store.setup()).rejects.toThrow(
+      `SQLite store "${dbPath}" is not writable (EROFS: read-only file system, mkdir '${tmpDir}')`
+    );
+  });
+});
+
+describe('createChunkStore', () => {
+  it('SHOULD default to the Elasticsearch store', () =>
+    withTestEnv({ SCS_IDXR_STORE: undefined }, () => {
+      expect(createChunkStore('idx')).toBeInstanceOf(ElasticsearchStore);
+    }));
+
+  it('SHOULD create a SQLite store when SCS_IDXR_STORE=sqlite', () =>
+    withTestEnv({ SCS_IDXR_STORE: 'SQLite' }, () => {
+      expect(createChunkStore('idx').backend).toBe('sqlite');
+    }));
+
+  it('SHOULD reject unknown vector metrics', () =>
+    withTestEnv({ SCS_IDXR_STORE: 'sqlite', SCS_IDXR_VECTOR_METRIC: 'manhattan' }, () => {
+      expect(() => createChunkStore('idx')).toThrow('Unknown vector metric "manhattan"');
+    }));
+
+  it('SHOULD reject unknown backends', () => {
+    expect(() => createChunkStore('idx', 'redis')).toThrow('Unknown store backend "redis"');
+  });
+});
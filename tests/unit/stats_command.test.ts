@@ -0,0 +1,77 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { stats } from '../../src/commands/stats_command';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { withTestEnv } from './utils/test_env';
+import { makeChunk, captureStdout } from './utils/fixtures';
+
+describe('stats command', () => {
+  let tmpDir: string;
+
+  beforeEach(async () => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-stats-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'code.db') });
+    await store.indexChunks([
+      makeChunk({ kind: 'function_declaration', code_vector: [1, 0, 0] }),
+      makeChunk({ kind: 'function_declaration', chunk_hash: 'b', filePath: 'src/b.ts', code_vector: [1, 0, 0] }),
+      makeChunk({
+        kind: 'section',
+        chunk_hash: 'c',
+        content: '# C',
+        filePath: 'README.md',
+        language: 'markdown',
+        code_vector: [1, 0, 0],
+      }),
+    ]);
+    await store.close();
+  });
+
+  afterEach(() => {
+    vi.restoreAllMocks();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  const env = () => ({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: 'sqlite', SCS_IDXR_SQLITE_STORE_DIR: tmpDir });
+
+  it('SHOULD print the counts as JSON, largest first', () =>
+    withTestEnv(env(), async () => {
+      const stdout = captureStdout();
+
+      await stats({ index: 'code', format: 'json' });
+
+      const parsed = JSON.parse(stdout.output());
+      expect(parsed).toMatchObject({
+        index: 'code',
+        backend: 'sqlite',
+        files: 3,
+        chunks: 3,
+        vectorDimensions: 3,
+        embedder: null,
+      });
+      expect(Object.entries(parsed.languages)).toEqual([
+        ['typescript', 2],
+        ['markdown', 1],
+      ]);
+      expect(Object.entries(parsed.kinds)).toEqual([
+        ['function_declaration', 2],
+        ['section', 1],
+      ]);
+      expect(parsed.sizeBytes).toBeGreaterThan(0);
+    }));
+
+  it('SHOULD print a readable summary by default', () =>
+    withTestEnv(env(), async () => {
+      const stdout = captureStdout();
+
+      await stats({ index: 'code' });
+
+      const output = stdout.output();
+      expect(output).toContain('Store backend:      sqlite');
+      expect(output).toContain('Chunks:             3');
+      expect(output).toContain('Embedder:           none');
+      expect(output).toContain('Chunks per language:\n  typescript  2\n  markdown    1');
+    }));
+});
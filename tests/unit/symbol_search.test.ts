@@ -0,0 +1,100 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach } from 'vitest';
+
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { editDistance, isDefinitionKind, scoreSymbolName, searchSymbols } from '../../src/utils/symbol_search';
+import { makeChunk } from './utils/fixtures';
+
+describe('symbol_search', () => {
+  it('SHOULD prefer exact, then prefix, then word, then fuzzy matches', () => {
+    expect(scoreSymbolName('parseConfig', 'parseConfig')).toEqual({ score: 1, match: 'exact' });
+    expect(scoreSymbolName('parseConfig', 'ParseConfig')).toEqual({ score: 0.95, match: 'exact' });
+    expect(scoreSymbolName('parse', 'parseConfig')?.match).toBe('prefix');
+    expect(scoreSymbolName('config parse', 'parseJsonConfig')?.match).toBe('words');
+    expect(scoreSymbolName('praseConfig', 'parseConfig')?.match).toBe('fuzzy');
+    expect(scoreSymbolName('parseConfig', 'renderView')).toBeUndefined();
+
+    const scores = ['parseConfig', 'parseConfigFile', 'parseJsonConfig', 'praseConfig'].map(
+      (name) => scoreSymbolName('parseConfig', name)?.score ?? 0
+    );
+    expect([...scores].sort((a, b) => b - a)).toEqual(scores);
+  });
+
+  it('SHOULD bound the edit distance', () => {
+    expect(editDistance('kitten', 'sitting')).toBe(3);
+    expect(editDistance('kitten', 'sitting', 1)).toBe(2);
+    expect(editDistance('a', 'abcd', 2)).toBe(3);
+  });
+
+  it('SHOULD treat names and declarations as definitions, but not calls or imports', () => {
+    expect(isDefinitionKind('function.name')).toBe(true);
+    expect(isDefinitionKind('variable.declaration')).toBe(true);
+    expect(isDefinitionKind('function.call')).toBe(false);
+    expect(isDefinitionKind('import.name')).toBe(false);
+  });
+
+  describe('WHEN searching a store', () => {
+    let tmpDir: string;
+    let store: SqliteStore;
+
+    beforeEach(async () => {
+      tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-symbols-'));
+      store = new SqliteStore({ dbPath: path.join(tmpDir, 'code.db') });
+      const total = { name: 'total', kind: 'method.name', line: 3 };
+      await store.indexChunks([
+        makeChunk({
+          language: 'java',
+          filePath: 'src/Invoice.java',
+          chunk_hash: 'class',
+          startLine: 1,
+          endLine: 5,
+          containerPath: 'com.acme',
+          symbols: [{ name: 'Invoice', kind: 'class.name', line: 1 }, total],
+        }),
+        makeChunk({
+          language: 'java',
+          filePath: 'src/Invoice.java',
+          chunk_hash: 'method',
+          startLine: 3,
+          endLine: 4,
+          containerPath: 'com.acme.Invoice',
+          symbols: [total],
+        }),
+        makeChunk({
+          language: 'java',
+          chunk_hash: 'other',
+          filePath: 'src/Order.java',
+          startLine: 2,
+          endLine: 3,
+          containerPath: 'com.acme.Order',
+          symbols: [{ name: 'total', kind: 'method.name', line: 2 }],
+        }),
+      ]);
+    });
+
+    afterEach(async () => {
+      await store.close();
+      fs.rmSync(tmpDir, { recursive: true, force: true });
+    });
+
+    it('SHOULD report a symbol once, on the smallest chunk defining it', async () => {
+      const hits = await searchSymbols(store, 'total', 10);
+
+      expect(hits.map((hit) => [hit.filePath, hit.line, hit.startLine, hit.endLine])).toEqual([
+        ['src/Invoice.java', 3, 3, 4],
+        ['src/Order.java', 2, 2, 3],
+      ]);
+    });
+
+    it('SHOULD rank definitions in the containers a query names first', async () => {
+      const hits = await searchSymbols(store, 'Order.total', 10);
+
+      expect(hits.map((hit) => [hit.containerPath, hit.score])).toEqual([
+        ['com.acme.Order', 1],
+        ['com.acme.Invoice', 0.5],
+      ]);
+    });
+  });
+});
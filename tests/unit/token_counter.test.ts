@@ -0,0 +1,48 @@
+import { describe, it, expect } from 'vitest';
+import { estimateTokens, splitByTokens, truncateToTokens } from '../../src/utils/token_counter';
+
+const countWords = (text: string) => text.split(/\s+/).filter(Boolean).length;
+
+describe('estimateTokens', () => {
+  it('SHOULD count a token per four characters, rounding up', () => {
+    expect(estimateTokens('')).toBe(0);
+    expect(estimateTokens('abcd')).toBe(1);
+    expect(estimateTokens('abcde')).toBe(2);
+  });
+});
+
+describe('truncateToTokens', () => {
+  it('SHOULD return the longest prefix within the budget', () => {
+    expect(truncateToTokens('a'.repeat(10), 2)).toBe('aaaaaaaa');
+    expect(truncateToTokens('one two three four', 2, countWords)).toBe('one two ');
+  });
+
+  it('SHOULD return texts within the budget as they are', () => {
+    expect(truncateToTokens('short', 10)).toBe('short');
+  });
+});
+
+describe('splitByTokens', () => {
+  it('SHOULD split at line breaks into windows within the budget', () => {
+    const text = ['a b', 'c d', 'e f', 'g'].join('\n');
+
+    expect(splitByTokens(text, 4, countWords)).toEqual([
+      { text: 'a b\nc d', startLine: 0, endLine: 1, truncated: false },
+      { text: 'e f\ng', startLine: 2, endLine: 3, truncated: false },
+    ]);
+  });
+
+  it('SHOULD truncate a line over the budget into a window of its own', () => {
+    const text = ['a', 'b c d e f', 'g'].join('\n');
+
+    expect(splitByTokens(text, 2, countWords)).toEqual([
+      { text: 'a', startLine: 0, endLine: 0, truncated: false },
+      { text: 'b c ', startLine: 1, endLine: 1, truncated: true },
+      { text: 'g', startLine: 2, endLine: 2, truncated: false },
+    ]);
+  });
+
+  it('SHOULD keep a text within the budget as one window', () => {
+    expect(splitByTokens('x\ny', 100)).toEqual([{ text: 'x\ny', startLine: 0, endLine: 1, truncated: false }]);
+  });
+});
@@ -0,0 +1,56 @@
+import { vi } from 'vitest';
+import { CodeChunk, SearchResult } from '../../../src/utils/elasticsearch';
+
+const TIMESTAMP = '2024-01-01T00:00:00.000Z';
+
+/**
+ * Builds a chunk of `src/a.ts` on `main`, with `overrides` applied.
+ */
+export function makeChunk(overrides: Partial<CodeChunk> = {}): CodeChunk {
+  return {
+    type: 'code',
+    language: 'typescript',
+    filePath: 'src/a.ts',
+    git_file_hash: 'hash-a',
+    git_branch: 'main',
+    chunk_hash: 'chunk-a',
+    startLine: 1,
+    endLine: 3,
+    content: 'const a = 1;',
+    semantic_text: 'const a = 1;',
+    created_at: TIMESTAMP,
+    updated_at: TIMESTAMP,
+    ...overrides,
+  };
+}
+
+/**
+ * Builds a search hit on a `parseQueue` function, with `overrides` applied.
+ */
+export function makeResult(overrides: Partial<SearchResult> = {}): SearchResult {
+  return {
+    id: 'chunk-1',
+    score: 0.9,
+    type: 'code',
+    language: 'typescript',
+    kind: 'function_declaration',
+    symbols: [{ name: 'parseQueue', kind: 'function.name', line: 3 }],
+    chunk_hash: 'hash',
+    content: '  function parseQueue() {\n    return 1;\n  }\n',
+    semantic_text: 'parseQueue',
+    created_at: TIMESTAMP,
+    updated_at: TIMESTAMP,
+    ...overrides,
+  };
+}
+
+/**
+ * Captures what a command prints with `console.log`; restore it with `vi.restoreAllMocks()`.
+ */
+export function captureStdout(): { output: () => string } {
+  const lines: string[] = [];
+  vi.spyOn(console, 'log').mockImplementation((...args: unknown[]) => {
+    lines.push(args.join(' '));
+  });
+  return { output: () => lines.join('\n') };
+}
@@ -0,0 +1,30 @@
+import { describe, it, expect } from 'vitest';
+
+import { normalizeVector, parseVectorMetric, prepareVector, scoreVectors } from '../../src/utils/vector_metric';
+
+describe('vector metrics', () => {
+  it('SHOULD parse metric names case-insensitively', () => {
+    expect(parseVectorMetric('Dot_Product')).toBe('dot_product');
+    expect(() => parseVectorMetric('manhattan')).toThrow(
+      'Unknown vector metric "manhattan". Supported metrics: cosine, dot_product, euclidean.'
+    );
+  });
+
+  it('SHOULD scale vectors to unit length and leave the zero vector alone', () => {
+    expect(normalizeVector([3, 4])).toEqual([0.6, 0.8]);
+    expect(normalizeVector([0, 0])).toEqual([0, 0]);
+  });
+
+  it('SHOULD only normalize vectors for cosine', () => {
+    expect(prepareVector([3, 4], 'cosine')).toEqual([0.6, 0.8]);
+    expect(prepareVector([3, 4], 'dot_product')).toEqual([3, 4]);
+    expect(prepareVector([3, 4], 'euclidean')).toEqual([3, 4]);
+  });
+
+  it('SHOULD score vectors with each metric, higher is better', () => {
+    expect(scoreVectors([3, 4], [2, 0], 'cosine')).toBeCloseTo(0.6, 6);
+    expect(scoreVectors([3, 4], [2, 0], 'dot_product')).toBe(6);
+    expect(scoreVectors([3, 4], [2, 0], 'euclidean')).toBeCloseTo(1 / 18, 6);
+    expect(scoreVectors([0, 0], [2, 0], 'cosine')).toBe(0);
+  });
+});
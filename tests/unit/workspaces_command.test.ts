@@ -0,0 +1,64 @@
+import path from 'path';
+import fs from 'fs';
+import os from 'os';
+import { describe, it, expect, beforeEach, afterEach, vi } from 'vitest';
+
+import { workspaces } from '../../src/commands/workspaces_command';
+import { SqliteStore } from '../../src/utils/sqlite_store';
+import { withTestEnv } from './utils/test_env';
+import { makeChunk, captureStdout } from './utils/fixtures';
+
+describe('workspaces command', () => {
+  let tmpDir: string;
+
+  beforeEach(async () => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'scs-workspaces-'));
+    const store = new SqliteStore({ dbPath: path.join(tmpDir, 'code.db') });
+    await store.indexChunks([
+      makeChunk({ workspace: 'web' }),
+      makeChunk({ chunk_hash: 'b', content: 'b();', filePath: 'src/b.ts', workspace: 'web' }),
+      makeChunk({ workspace: 'api' }),
+      makeChunk({ chunk_hash: 'c', content: 'c();', filePath: 'src/c.ts' }),
+    ]);
+    await store.close();
+  });
+
+  afterEach(() => {
+    vi.restoreAllMocks();
+    fs.rmSync(tmpDir, { recursive: true, force: true });
+  });
+
+  const env = () => ({ SCS_IDXR_EMBEDDER: undefined, SCS_IDXR_STORE: 'sqlite', SCS_IDXR_SQLITE_STORE_DIR: tmpDir });
+
+  it('SHOULD print the workspaces as JSON, unlabeled locations first', () =>
+    withTestEnv(env(), async () => {
+      const stdout = captureStdout();
+
+      await workspaces({ index: 'code', format: 'json' });
+
+      expect(JSON.parse(stdout.output())).toEqual({
+        index: 'code',
+        workspaces: [
+          { workspace: null, files: 1, chunks: 1 },
+          { workspace: 'api', files: 1, chunks: 1 },
+          { workspace: 'web', files: 2, chunks: 2 },
+        ],
+      });
+    }));
+
+  it('SHOULD print a readable list by default', () =>
+    withTestEnv(env(), async () => {
+      const stdout = captureStdout();
+
+      await workspaces({ index: 'code' });
+
+      expect(stdout.output()).toBe(
+        [
+          'Workspaces in code:',
+          '  (unlabeled)  1 file(s), 1 chunk(s)',
+          '  api          1 file(s), 1 chunk(s)',
+          '  web          2 file(s), 2 chunk(s)',
+        ].join('\n')
+      );
+    }));
+});